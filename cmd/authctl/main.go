@@ -0,0 +1,157 @@
+// Command authctl runs admin tasks against a running auth service through the admin API
+//
+//	authctl import -url http://localhost:8080 -wait users.ndjson
+//
+// The admin token is read from -token or ADMIN_API_TOKEN.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// userImport is the progress of an import, as returned by the admin API
+type userImport struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Processed int64  `json:"processed"`
+	Imported  int64  `json:"imported"`
+	Skipped   int64  `json:"skipped"`
+	Failed    int64  `json:"failed"`
+	Error     string `json:"error"`
+	Errors    []struct {
+		Line  int    `json:"line"`
+		Email string `json:"email"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	switch os.Args[1] {
+	case "import":
+		if err := runImport(ctx, os.Args[2:]); err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	log.Fatal("Usage: authctl import [-url URL] [-token TOKEN] [-format ndjson|csv] [-wait] FILE")
+}
+
+// runImport uploads an NDJSON or CSV file of users and optionally waits for the import to complete
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	baseURL := fs.String("url", "http://localhost:8080", "base URL of the auth service")
+	token := fs.String("token", os.Getenv("ADMIN_API_TOKEN"), "admin API token")
+	format := fs.String("format", "", "file format, ndjson or csv (default: from the file extension)")
+	wait := fs.Bool("wait", false, "wait for the import to complete and print its progress")
+	interval := fs.Duration("interval", 2*time.Second, "how often to poll the progress with -wait")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		usage()
+	}
+	path := fs.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = "csv"
+		case ".ndjson", ".jsonl":
+			*format = "ndjson"
+		default:
+			return fmt.Errorf("can't tell the format of %s, set -format", path)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	endpoint := strings.TrimRight(*baseURL, "/") + "/api/v1/admin/users/import"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"?format="+*format, file)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	var progress userImport
+	if err := call(req, *token, http.StatusAccepted, &progress); err != nil {
+		return err
+	}
+	log.Printf("Started import %s with %d records", progress.ID, progress.Total)
+
+	for *wait && progress.Status == "processing" {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(*interval):
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/"+progress.ID, nil)
+		if err != nil {
+			return err
+		}
+		if err := call(req, *token, http.StatusOK, &progress); err != nil {
+			return err
+		}
+		log.Printf("Processed %d/%d: %d imported, %d skipped, %d failed",
+			progress.Processed, progress.Total, progress.Imported, progress.Skipped, progress.Failed)
+	}
+
+	for _, failure := range progress.Errors {
+		log.Printf("Line %d (%s): %s", failure.Line, failure.Email, failure.Error)
+	}
+	if progress.Status == "failed" {
+		return errors.New(progress.Error)
+	}
+	log.Printf("Import %s is %s", progress.ID, progress.Status)
+	return nil
+}
+
+// call sends an admin API request and decodes the response, other statuses than expected are errors
+func call(req *http.Request, token string, expected int, out any) error {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expected {
+		return fmt.Errorf("%s %s: status %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,49 @@
+// Command loadgen sends register, login, refresh and validate traffic to a running
+// auth service at a fixed rate and prints latency percentiles per scenario
+//
+//	go run ./cmd/loadgen -url http://localhost:8080 -rps 200 -duration 1m -mix validate=8,refresh=2
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/tests/load"
+)
+
+func main() {
+	var (
+		cfg load.Config
+		mix string
+	)
+	flag.StringVar(&cfg.BaseURL, "url", "http://localhost:8080", "base URL of the auth service")
+	flag.IntVar(&cfg.RPS, "rps", 50, "target requests per second over all scenarios")
+	flag.DurationVar(&cfg.Duration, "duration", 30*time.Second, "how long to generate traffic")
+	flag.IntVar(&cfg.Concurrency, "concurrency", 100, "maximum requests in flight, excess requests are dropped")
+	flag.IntVar(&cfg.Users, "users", 10, "users registered before the run for login, refresh and validate")
+	flag.StringVar(&mix, "mix", "register=1,login=2,refresh=2,validate=5", "relative weight of each scenario")
+	flag.Parse()
+
+	var err error
+	if cfg.Mix, err = load.ParseMix(mix); err != nil {
+		log.Fatalf("Invalid -mix: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	log.Printf("Sending %d rps to %s for %s", cfg.RPS, cfg.BaseURL, cfg.Duration)
+	report, err := load.Run(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Load test failed: %v", err)
+	}
+
+	if err := report.Print(os.Stdout); err != nil {
+		log.Fatalf("Failed to print report: %v", err)
+	}
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -12,10 +16,34 @@ import (
 	"go.uber.org/zap"
 )
 
+// @title Auth Service API
+// @version 1.0.0
+// @description Authentication and authorization service: registration, login, sessions and tokens
+// @contact.name Pavel Peremyshlev
+// @contact.email peremyshlevv@bk.ru
+// @BasePath /api
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token as "Bearer <token>"
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name Authorization
+// @description Admin API token as "Bearer <token>"
 func main() {
+	configFile := flag.String("config", "", "YAML or JSON config file, environment variables override its values (default: $CONFIG_FILE)")
+	validateConfig := flag.Bool("validate-config", false, "check the configuration, print every problem and exit")
+	flag.Parse()
+
 	ctx := context.Background()
 
-	cfg, err := config.Load(ctx)
+	cfg, err := config.LoadFile(ctx, *configFile)
+	if *validateConfig {
+		if !reportConfig(os.Stdout, cfg, err) {
+			os.Exit(1)
+		}
+		return
+	}
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -25,7 +53,10 @@ func main() {
 		log.Fatalf("Failed to initialize infrastructure: %v", err)
 	}
 
-	application := app.NewApp(infra, cfg)
+	application, err := app.NewApp(infra, cfg)
+	if err != nil {
+		infra.Logger().Fatal("Failed to initialize application", zap.Error(err))
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -43,3 +74,30 @@ func main() {
 		infra.Logger().Fatal("Application failed", zap.Error(err))
 	}
 }
+
+// reportConfig prints the result of loading the configuration and reports whether it is valid
+func reportConfig(w io.Writer, cfg *config.Config, err error) bool {
+	var validationErr *config.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		fmt.Fprintf(w, "Configuration has %d problem(s):\n", len(validationErr.Problems))
+		for _, problem := range validationErr.Problems {
+			fmt.Fprintf(w, "  - %s\n", problem)
+		}
+		return false
+	case err != nil:
+		// Variables that can't be parsed stop loading before validation
+		fmt.Fprintf(w, "Configuration could not be loaded:\n  - %v\n", err)
+		return false
+	}
+
+	storage := cfg.Database.Driver
+	if cfg.InMemoryStorage() {
+		storage = config.DevStorageMemory
+	}
+	fmt.Fprintf(w, "Configuration is valid\n")
+	fmt.Fprintf(w, "  env:     %s\n", cfg.Env)
+	fmt.Fprintf(w, "  listen:  %s:%s\n", cfg.Server.Host, cfg.Server.Port)
+	fmt.Fprintf(w, "  storage: %s\n", storage)
+	return true
+}
@@ -5,14 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prperemyshlev/auth-service-2/internal/config"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/encryption"
 	"github.com/prperemyshlev/auth-service-2/internal/handler"
+	"github.com/prperemyshlev/auth-service-2/internal/kerberos"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
 	"github.com/prperemyshlev/auth-service-2/internal/repository"
 	"github.com/prperemyshlev/auth-service-2/internal/service"
 	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"github.com/prperemyshlev/auth-service-2/pkg/mailer"
 	"github.com/prperemyshlev/auth-service-2/pkg/observability"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
@@ -20,43 +31,410 @@ import (
 
 const shutdownTimeout = 5 * time.Second
 
+// drainRetryAfter is suggested to clients rejected while draining, another instance serves them by then
+const drainRetryAfter = 5 * time.Second
+
 type App struct {
 	infra  Infrastructure
 	config *config.Config
 	router *gin.Engine
 	server *http.Server
+	// internalRouter serves operational endpoints, it is router unless INTERNAL_PORT is set
+	internalRouter *gin.Engine
+	// internalServer is nil unless INTERNAL_PORT is set
+	internalServer *http.Server
+	ipFilter       *service.IPFilter
+	featureFlags   *service.FeatureFlags
+	// jwtKeys is nil unless JWT_KEYRING is redis
+	jwtKeys *service.JWTKeyring
+	jobs    *jobs.Runner
+	// audit is nil unless AUDIT_SINK is set
+	audit  *observability.AuditExporter
+	emails *service.EmailService
+	// redirects validates the URLs OAuth callbacks, magic links and email verification return users to
+	redirects *service.RedirectValidator
+	erasures  *service.ErasureService
+	// reencryption re-encrypts encrypted columns after key rotations, nil unless ENCRYPTION_KEYS is set
+	reencryption *service.ReencryptionService
+	// emailNormalization re-normalizes the emails of existing users when EMAIL_NORMALIZE_* changes
+	emailNormalization *service.EmailNormalizationService
+	// tokenCleanup purges expired and revoked refresh tokens after the retention
+	tokenCleanup *service.TokenCleanupService
+	// unverified expires accounts never verified, nil unless UNVERIFIED_EXPIRY_DAYS is set
+	unverified *service.UnverifiedExpiryService
+	// sessionEvents delivers the session events published by any replica to the streams of this one
+	sessionEvents *service.SessionEvents
+	// invalidations runs the hooks of local caches for the cache invalidations published by any replica
+	invalidations *service.CacheInvalidations
+	// draining is set on shutdown, new logins are rejected and /health fails from then on
+	draining  *atomic.Bool
+	drainOnce sync.Once
+	drainErr  error
 }
 
-func NewApp(infra Infrastructure, cfg *config.Config) *App {
-	repos := repository.NewRepositories(infra.Postgres())
+func NewApp(infra Infrastructure, cfg *config.Config) (*App, error) {
+	repos := repository.Instrument(infra.Repositories(), infra.Logger(), cfg.Database.SlowQueryThreshold.Duration)
+
+	signingKeys := []utils.SigningKey{utils.NewSigningKey(cfg.JWT.Secret)}
+	for _, secret := range cfg.JWT.PreviousSecrets {
+		signingKeys = append(signingKeys, utils.NewSigningKey(secret))
+	}
+	keys := utils.StaticSigningKeys(signingKeys[0], signingKeys[1:]...)
+	var jwtKeyring *service.JWTKeyring
+	if cfg.JWT.Keyring == "redis" {
+		// Replaced keys validate tokens as long as refresh tokens signed with them are valid
+		jwtKeyring = service.NewJWTKeyring(signingKeys, infra.Redis(), cfg.JWT.RefreshTokenExpiry.Duration, cfg.JWT.KeyringReloadInterval.Duration)
+		keys = jwtKeyring
+	}
 
 	jwtManager := utils.NewJWTManager(
 		cfg.JWT.Secret,
 		cfg.JWT.AccessTokenExpiry.Duration,
 		cfg.JWT.RefreshTokenExpiry.Duration,
+		utils.WithSigningKeys(keys),
+		utils.WithIssuer(cfg.JWT.Issuer),
+		utils.WithAudience(cfg.JWT.Audience...),
+		utils.WithLeeway(cfg.JWT.Leeway.Duration),
 	)
 
+	featureFlags := service.NewFeatureFlags(featureFlagDefaults(cfg.FeatureFlags), infra.Redis(), cfg.FeatureFlags.ReloadInterval.Duration)
+	accessTokens := service.NewJWTAccessTokens(jwtManager, service.WithFeatureClaims(featureFlags))
+	if cfg.JWT.AccessTokenFormat == service.AccessTokenFormatOpaque {
+		accessTokens = service.NewOpaqueAccessTokens(infra.Redis(), cfg.JWT.AccessTokenExpiry.Duration, service.WithFeatureClaims(featureFlags))
+	}
+
 	blacklistService := service.NewTokenBlacklistService(infra.Redis())
+	revocationService := service.NewRevocationService(infra.Redis(), repos.Token, cfg.JWT.AccessTokenExpiry.Duration)
+	sessionEvents := service.NewSessionEvents(infra.Redis())
+	cacheInvalidations := service.NewCacheInvalidations(infra.Redis())
+	revocationService.OnRevoke(func(ctx context.Context, r service.Revocation) {
+		sessionEvents.Publish(ctx, service.SessionEvent{Type: service.SessionEventLogoutAll, UserID: r.UserID})
+		cacheInvalidations.Publish(ctx, service.CacheInvalidation{Reason: service.CacheInvalidationRevoked, UserID: r.UserID})
+	})
+	var validationCache *service.ValidationCache
+	if cfg.JWT.ValidationCacheTTL.Duration > 0 {
+		validationCache = service.NewValidationCache(cfg.JWT.ValidationCacheTTL.Duration, cfg.JWT.ValidationCacheSize)
+		cacheInvalidations.OnInvalidate(func(ctx context.Context, inv service.CacheInvalidation) {
+			validationCache.Invalidate(inv.UserID)
+		})
+	}
 	rateLimiter := service.NewRateLimiter(infra.Redis())
-	healthChecker := NewHealthChecker(infra)
+	ipFilter := service.NewIPFilter(repos.IPRule, infra.Redis(), cfg.IPFilter.ReloadInterval.Duration)
+	tenantService := service.NewTenantService(repos.Tenant, infra.Redis(), cfg.Tenants.CacheTTL.Duration)
+	statsService := service.NewStatsService(repos.Stats, infra.Redis(), cfg.Admin.StatsCacheTTL.Duration)
+	redirects := service.NewRedirectValidator(cfg.Redirect.AllowedURLs)
+
+	var (
+		encryptor    *encryption.Encryptor
+		reencryption *service.ReencryptionService
+	)
+	if len(cfg.Encryption.Keys) > 0 {
+		keyring, err := encryption.NewKeyring(cfg.Encryption.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize encryption keys: %w", err)
+		}
+		encryptor = encryption.New(keyring)
+		reencryption = service.NewReencryptionService(encryptor, cfg.Encryption.ReencryptInterval.Duration, cfg.Encryption.ReencryptBatchSize,
+			service.NewProviderTokenReencryption(repos.OAuthProvider))
+	}
+	draining := new(atomic.Bool)
+
+	captchaVerifier, err := service.NewCaptchaVerifier(cfg.Captcha.Provider, cfg.Captcha.Secret, cfg.Captcha.MinScore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize captcha verifier: %w", err)
+	}
+
+	jobRunner := jobs.NewRunner(infra.Redis(), infra.Logger(), jobs.Config{
+		Workers:      cfg.Jobs.Workers,
+		MaxAttempts:  cfg.Jobs.MaxAttempts,
+		RetryBackoff: cfg.Jobs.RetryBackoff.Duration,
+	})
+
+	mail, err := mailer.New(mailer.Config{
+		Provider: cfg.Mailer.Provider,
+		From:     cfg.Mailer.From,
+		SMTP: mailer.SMTPConfig{
+			Host:     cfg.Mailer.SMTPHost,
+			Port:     cfg.Mailer.SMTPPort,
+			Username: cfg.Mailer.SMTPUsername,
+			Password: cfg.Mailer.SMTPPassword,
+		},
+		SESRegion:      cfg.Mailer.SESRegion,
+		SendGridAPIKey: cfg.Mailer.SendGridAPIKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize mailer: %w", err)
+	}
+
+	healthChecker, err := NewHealthChecker(infra, mail, draining.Load)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize health checker: %w", err)
+	}
+
+	emailService, err := service.NewEmailService(jobRunner, mail, cfg.Mailer.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize email service: %w", err)
+	}
+
+	erasureService := service.NewErasureService(repos.Erasure, repos.User, repos.OAuthProvider, revocationService, jobRunner, service.ErasureConfig{
+		Mode:          cfg.Erasure.Mode,
+		GracePeriod:   cfg.Erasure.GracePeriod.Duration,
+		SweepInterval: cfg.Erasure.SweepInterval.Duration,
+	})
+	erasureService.Subscribe(func(ctx context.Context, event service.UserErasedEvent) error {
+		infra.Logger().Info("User erased",
+			zap.String("event", "user.erased"),
+			zap.String("user_id", event.UserID),
+			zap.String("erasure_id", event.ErasureID),
+			zap.String("requested_by", event.RequestedBy),
+			zap.String("mode", event.Mode),
+		)
+		return nil
+	})
+
+	var unverifiedExpiry *service.UnverifiedExpiryService
+	if cfg.Unverified.ExpiryDays > 0 {
+		unverifiedExpiry = service.NewUnverifiedExpiryService(repos.User, erasureService, emailService, service.UnverifiedExpiryConfig{
+			Expiry:        time.Duration(cfg.Unverified.ExpiryDays) * 24 * time.Hour,
+			Action:        cfg.Unverified.Action,
+			SweepInterval: cfg.Unverified.SweepInterval.Duration,
+		})
+		unverifiedExpiry.OnDeactivate(func(ctx context.Context, userID string) {
+			cacheInvalidations.Publish(ctx, service.CacheInvalidation{Reason: service.CacheInvalidationDeactivated, UserID: userID})
+		})
+	}
+
+	emailNormalizer := utils.NewEmailNormalizer(cfg.Email.NormalizePlusDomains, cfg.Email.NormalizeDotDomains)
+	invitationService := service.NewInvitationService(repos.Invitation, emailNormalizer, service.InvitationConfig{
+		Required:   cfg.Invitation.Required,
+		AllowUsers: cfg.Invitation.AllowUsers,
+		TTL:        cfg.Invitation.TTL.Duration,
+	})
+	consentService := service.NewConsentService(repos.Consent, cfg.Consent.TermsVersion, cfg.Consent.PrivacyVersion)
+	erasureService.AddStep(service.ErasureStep{Name: "consents", Erase: repos.Consent.DeleteByUserID})
+	erasureService.AddStep(service.ErasureStep{Name: "invitations", Erase: repos.Invitation.DeleteByUserID})
+	erasureService.AddStep(service.ErasureStep{Name: "identities", Erase: repos.Identity.DeleteByUserID})
+	erasureService.AddStep(service.ErasureStep{Name: "user_flags", Erase: repos.UserFlags.DeleteByUserID})
+	organizationService := service.NewOrganizationService(repos.Organization, repos.User, invitationService, emailNormalizer, accessTokens)
+	invitationService.OnAccept(organizationService.AcceptInvitation)
+	erasureService.AddStep(service.ErasureStep{Name: "memberships", Erase: organizationService.DeleteMemberships})
 
+	passwordHasher := service.NewPasswordHasher(cfg.Security.BCryptCost, cfg.Security.BCryptConcurrency, cfg.Security.BCryptQueueSize)
+	enumerationPolicy := service.NewEnumerationPolicy(service.EnumerationConfig{
+		UniformResponses: cfg.Enumeration.UniformResponses,
+		TargetLimit:      cfg.Enumeration.TargetLimit,
+		IPLimit:          cfg.Enumeration.IPLimit,
+		Window:           cfg.Enumeration.Window.Duration,
+	}, rateLimiter, passwordHasher)
+
+	var auditor observability.Auditor = observability.NopAuditor{}
+	var auditExporter *observability.AuditExporter
+	if cfg.Audit.Sink != observability.AuditSinkNone {
+		auditExporter, err = observability.NewAuditExporter(observability.AuditConfig{
+			Sink:          cfg.Audit.Sink,
+			Format:        cfg.Audit.Format,
+			SyslogNetwork: cfg.Audit.SyslogNetwork,
+			SyslogAddress: cfg.Audit.SyslogAddress,
+			HTTPURL:       cfg.Audit.HTTPURL,
+			HTTPToken:     cfg.Audit.HTTPToken,
+			BufferSize:    cfg.Audit.BufferSize,
+			BatchSize:     cfg.Audit.BatchSize,
+			FlushInterval: cfg.Audit.FlushInterval.Duration,
+		}, infra.Logger())
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize audit export: %w", err)
+		}
+		auditor = auditExporter
+	}
+
+	loginDelays := make([]time.Duration, 0, len(cfg.LoginThrottle.Delays))
+	for _, delay := range cfg.LoginThrottle.Delays {
+		loginDelays = append(loginDelays, delay.Duration)
+	}
+
+	var shadowIdP *service.ShadowIdP
+	if cfg.ShadowIdP.Enabled() {
+		keycloak := service.NewKeycloakIdP(cfg.ShadowIdP.URL, cfg.ShadowIdP.Realm, cfg.ShadowIdP.ClientID, cfg.ShadowIdP.ClientSecret,
+			&http.Client{Timeout: cfg.ShadowIdP.Timeout.Duration})
+		shadowIdP = service.NewShadowIdP(keycloak, featureFlags, cfg.ShadowIdP.Timeout.Duration, cfg.ShadowIdP.Concurrency)
+	}
+
+	emailDomains := service.NewEmailDomainPolicy(cfg.Email.AllowedDomains)
+	var newDeviceAlerts *service.EmailService
+	if cfg.Session.NewDeviceAlerts {
+		newDeviceAlerts = emailService
+	}
 	authService := service.NewAuthService(
 		repos.User,
 		repos.Token,
 		jwtManager,
+		accessTokens,
 		blacklistService,
-		cfg.Security.BCryptCost,
+		revocationService,
+		emailNormalizer,
+		passwordHasher,
+		enumerationPolicy,
+		consentService,
+		invitationService,
+		organizationService,
+		service.NewDeviceBinding(cfg.DeviceBinding.Mode, auditor),
+		service.NewLoginThrottle(infra.Redis(), loginDelays, cfg.LoginThrottle.Window.Duration),
+		auditor,
 		cfg.JWT.RefreshTokenExpiry.Duration,
+		cfg.Session.MaxPerUser,
+		service.WithEmailVerification(cfg.Email.VerificationPolicy),
+		service.WithLoginStats(statsService),
+		service.WithSessionEvents(sessionEvents),
+		service.WithValidationCache(validationCache),
+		service.WithCacheInvalidations(cacheInvalidations),
+		service.WithShadowIdP(shadowIdP),
+		service.WithEmailDomains(emailDomains),
+		service.WithLocator(infra.GeoIP()),
+		service.WithNewDeviceAlerts(newDeviceAlerts),
 	)
 
-	authHandler := handler.NewAuthHandler(authService)
+	authHandler := handler.NewAuthHandler(authService, handler.CookieOptions{
+		Secure: cfg.Cookie.Secure,
+		Domain: cfg.Cookie.Domain,
+	})
+	userImportService := service.NewUserImportService(infra.Redis(), repos.User, emailNormalizer, passwordHasher, jobRunner)
+	userSearchService := service.NewUserSearchService(repos.User, repos.OAuthProvider, repos.UserFlags)
+	userFlagsService := service.NewUserFlagsService(repos.User, repos.UserFlags, auditor)
+	restrictionService := service.NewRestrictionService(repos.User, revocationService, auditor)
+	adminHandler := handler.NewAdminHandler(ipFilter, revocationService, erasureService, userImportService, userSearchService, userFlagsService, restrictionService, featureFlags, tenantService, statsService, jwtKeyring, emailDomains)
+	erasureHandler := handler.NewErasureHandler(erasureService)
+	consentHandler := handler.NewConsentHandler(consentService)
+	invitationHandler := handler.NewInvitationHandler(invitationService)
+	organizationHandler := handler.NewOrganizationHandler(organizationService)
+	providerRegistry, err := oauth.NewRegistry(oauthProviders(cfg.OAuth)...)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens of provider accounts are only stored encrypted
+	var providerTokens *service.ProviderTokenService
+	if encryptor != nil {
+		providerTokens = service.NewProviderTokenService(repos.OAuthProvider, encryptor, providerRegistry)
+	}
+	oauthService := service.NewOAuthService(authService, repos.User, repos.OAuthProvider, emailNormalizer, redirects, infra.Redis(), service.OAuthConfig{
+		Registration:       cfg.Features.Registration,
+		InvitationRequired: cfg.Invitation.Required,
+		StateTTL:           cfg.OAuth.StateTTL.Duration,
+		EmailDomains:       emailDomains,
+	}, providerRegistry, providerTokens)
+	oauthHandler := handler.NewOAuthHandler(oauthService, authHandler)
+	var providerTokenHandler *handler.ProviderTokenHandler
+	if providerTokens != nil {
+		providerTokenHandler = handler.NewProviderTokenHandler(providerTokens)
+	}
+
+	var accountEventsHandler *handler.AccountEventsHandler
+	if cfg.AccountEvents.Enabled() {
+		accountEvents := service.NewAccountEventService(repos.User, repos.OAuthProvider, revocationService, infra.Redis(), auditor, cfg.AccountEvents.Deactivate)
+		accountEvents.OnDeactivate(func(ctx context.Context, userID string) {
+			cacheInvalidations.Publish(ctx, service.CacheInvalidation{Reason: service.CacheInvalidationDeactivated, UserID: userID})
+		})
+		var sources []oauth.AccountEventSource
+		if len(cfg.AccountEvents.AppleClientIDs) > 0 {
+			sources = append(sources, oauth.NewAppleAccountEvents(cfg.AccountEvents.AppleClientIDs, nil))
+		}
+		if len(cfg.AccountEvents.GoogleClientIDs) > 0 {
+			sources = append(sources, oauth.NewGoogleAccountEvents(cfg.AccountEvents.GoogleClientIDs, nil))
+		}
+		accountEventsHandler = handler.NewAccountEventsHandler(accountEvents, sources...)
+	}
+
+	var kerberosHandler *handler.KerberosHandler
+	if cfg.Kerberos.Enabled() {
+		keytab, err := kerberos.LoadKeytab(cfg.Kerberos.KeytabPath)
+		if err != nil {
+			return nil, err
+		}
+		acceptor := kerberos.NewAcceptor(kerberos.Config{
+			Keytab:           keytab,
+			ServicePrincipal: cfg.Kerberos.ServicePrincipal,
+			MaxClockSkew:     cfg.Kerberos.MaxClockSkew.Duration,
+		})
+		kerberosHandler = handler.NewKerberosHandler(service.NewKerberosService(authService, repos.User, repos.Identity, emailNormalizer, acceptor, service.KerberosConfig{
+			Realms:      cfg.Kerberos.Realms,
+			UserMapping: cfg.Kerberos.UserMapping,
+			EmailDomain: cfg.Kerberos.EmailDomain,
+		}), authHandler)
+	}
+	var siweHandler *handler.SIWEHandler
+	if cfg.SIWE.Enabled() {
+		siweHandler = handler.NewSIWEHandler(service.NewSIWEService(authService, repos.User, repos.Identity, infra.Redis(), service.SIWEConfig{
+			Domain:             cfg.SIWE.Domain,
+			ChainIDs:           cfg.SIWE.ChainIDs,
+			NonceTTL:           cfg.SIWE.NonceTTL.Duration,
+			Registration:       cfg.Features.Registration,
+			InvitationRequired: cfg.Invitation.Required,
+			EmailDomains:       emailDomains,
+		}), authHandler)
+	}
+	passwordService := service.NewPasswordService(repos.User, oauthService, passwordHasher, auditor)
+	passwordService.OnPasswordChange(func(ctx context.Context, userID string) {
+		sessionEvents.Publish(ctx, service.SessionEvent{Type: service.SessionEventPasswordChanged, UserID: userID})
+	})
+	passwordHandler := handler.NewPasswordHandler(passwordService)
+	sessionEventsHandler := handler.NewSessionEventsHandler(sessionEvents)
+	gatewayConfigHandler := handler.NewGatewayConfigHandler(dto.GatewayConfigResponse{
+		Issuer:               cfg.JWT.Issuer,
+		Audience:             cfg.JWT.Audience,
+		AccessTokenFormat:    cfg.JWT.AccessTokenFormat,
+		SigningAlgorithms:    []string{"HS256"},
+		AccessTokenLifetime:  int64(cfg.JWT.AccessTokenExpiry.Seconds()),
+		RefreshTokenLifetime: int64(cfg.JWT.RefreshTokenExpiry.Seconds()),
+		Leeway:               int64(cfg.JWT.Leeway.Seconds()),
+	})
+	recoveryHandler := handler.NewRecoveryHandler(service.NewRecoveryService(repos.User, repos.OAuthProvider, oauthService, rateLimiter,
+		revocationService, emailService, emailNormalizer, auditor, service.RecoveryConfig{
+			MinLinkAge:    cfg.Recovery.MinLinkAge.Duration,
+			MaxAttempts:   cfg.Recovery.MaxAttempts,
+			AttemptWindow: cfg.Recovery.AttemptWindow.Duration,
+			EmailDomains:  emailDomains,
+		}))
+
+	var graphQLHandler *handler.GraphQLHandler
+	if cfg.GraphQL.Enabled {
+		graphQLHandler, err = handler.NewGraphQLHandler(authService, cfg.Features.PasswordLogin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metricsMiddleware, err := handler.MetricsMiddleware(infra.MeterProvider())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize http metrics: %w", err)
+	}
+	if err := registerBuildInfo(infra.MeterProvider()); err != nil {
+		return nil, err
+	}
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Security.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("failed to set trusted proxies: %w", err)
+	}
 	router.Use(otelgin.Middleware("auth-service"))
-	router.Use(handler.LoggerMiddleware(infra.Logger()))
-	router.Use(handler.CORSMiddleware(cfg.CORS.AllowedOrigins, cfg.CORS.AllowedMethods, cfg.CORS.AllowedHeaders))
+	router.Use(metricsMiddleware)
+	router.Use(handler.RequestIDMiddleware())
+	router.Use(handler.ClientInfoMiddleware())
+	router.Use(handler.LocaleMiddleware())
+	router.Use(handler.LoggerMiddleware(infra.Logger(), cfg.Log.SampledRoutes, cfg.Log.SampleRate))
+	router.Use(handler.CORSMiddleware(handler.CORSOptions{
+		AllowedOrigins: cfg.CORS.AllowedOrigins,
+		AllowedMethods: cfg.CORS.AllowedMethods,
+		AllowedHeaders: cfg.CORS.AllowedHeaders,
+		ExposedHeaders: cfg.CORS.ExposedHeaders,
+		MaxAge:         cfg.CORS.MaxAge.Duration,
+		RouteOrigins:   cfg.CORS.RouteOrigins,
+	}))
+	if cfg.IPFilter.Enabled {
+		router.Use(handler.IPFilterMiddleware(ipFilter))
+	}
 
-	setupRoutes(router, cfg, authHandler, authService, rateLimiter, healthChecker, infra.MetricsHandler())
+	drain := handler.DrainMiddleware(draining.Load, drainRetryAfter)
+	tenant := handler.TenantMiddleware(tenantService)
+	setupRoutes(router, cfg, authHandler, adminHandler, erasureHandler, consentHandler, invitationHandler, organizationHandler, passwordHandler, recoveryHandler, oauthHandler, providerTokenHandler, kerberosHandler, siweHandler, graphQLHandler, sessionEventsHandler, gatewayConfigHandler, accountEventsHandler, authService, rateLimiter, captchaVerifier, drain, tenant)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port),
@@ -64,65 +442,471 @@ func NewApp(infra Infrastructure, cfg *config.Config) *App {
 		ReadTimeout:  cfg.Server.ReadTimeout.Duration,
 		WriteTimeout: cfg.Server.WriteTimeout.Duration,
 	}
+	// Event streams would hold up the drain until its timeout otherwise
+	srv.RegisterOnShutdown(sessionEvents.Close)
 
-	return &App{
-		infra:  infra,
-		config: cfg,
-		router: router,
-		server: srv,
+	internalRouter := router
+	var internalSrv *http.Server
+	if cfg.Internal.Enabled() {
+		tlsConfig, err := internalTLSConfig(cfg.Internal)
+		if err != nil {
+			return nil, err
+		}
+
+		internalRouter = gin.New()
+		// Client IPs of peers are logged and audited, forwarded ones only count from trusted proxies
+		if err := internalRouter.SetTrustedProxies(cfg.Security.TrustedProxies); err != nil {
+			return nil, fmt.Errorf("failed to set trusted proxies of the internal listener: %w", err)
+		}
+		internalRouter.Use(gin.Recovery())
+		internalSrv = &http.Server{
+			Addr:         fmt.Sprintf("%s:%s", cfg.Internal.Host, cfg.Internal.Port),
+			Handler:      internalRouter,
+			ReadTimeout:  cfg.Server.ReadTimeout.Duration,
+			WriteTimeout: cfg.Server.WriteTimeout.Duration,
+			TLSConfig:    tlsConfig,
+		}
+	}
+	setupInternalRoutes(internalRouter, healthChecker, infra.MetricsHandler())
+	if cfg.Internal.MTLSEnabled() {
+		setupPeerRoutes(internalRouter, cfg, infra.Logger(), authHandler, adminHandler, invitationHandler, kerberosHandler)
+	}
+	if cfg.ExtAuthz.Enabled {
+		setupExtAuthzRoutes(internalRouter, cfg, authService)
 	}
+	if cfg.Debug.Enabled && internalSrv != nil {
+		handler.RegisterDebugRoutes(internalRouter, infra.LogLevel())
+	}
+
+	return &App{
+		infra:              infra,
+		config:             cfg,
+		router:             router,
+		server:             srv,
+		internalRouter:     internalRouter,
+		internalServer:     internalSrv,
+		ipFilter:           ipFilter,
+		featureFlags:       featureFlags,
+		jwtKeys:            jwtKeyring,
+		jobs:               jobRunner,
+		audit:              auditExporter,
+		emails:             emailService,
+		redirects:          redirects,
+		erasures:           erasureService,
+		reencryption:       reencryption,
+		emailNormalization: service.NewEmailNormalizationService(repos.User, emailNormalizer, infra.Redis()),
+		tokenCleanup:       service.NewTokenCleanupService(repos.Token, cfg.Session.HistoryRetention.Duration, cfg.Session.CleanupInterval.Duration),
+		unverified:         unverifiedExpiry,
+		sessionEvents:      sessionEvents,
+		invalidations:      cacheInvalidations,
+		draining:           draining,
+	}, nil
 }
 
 func (a *App) Router() *gin.Engine {
 	return a.router
 }
 
+// InternalRouter returns the router of operational endpoints
+// It is the public router unless a separate internal listener is configured.
+func (a *App) InternalRouter() *gin.Engine {
+	return a.internalRouter
+}
+
+// setupInternalRoutes registers operational endpoints, which are never meant for API clients
+func setupInternalRoutes(router *gin.Engine, healthChecker *HealthChecker, metricsHandler http.Handler) {
+	router.GET("/metrics", observability.PrometheusHandler(metricsHandler))
+	router.GET("/health", healthChecker.Handler)
+	router.GET("/version", versionHandler)
+}
+
 func setupRoutes(
 	router *gin.Engine,
 	cfg *config.Config,
 	authHandler *handler.AuthHandler,
+	adminHandler *handler.AdminHandler,
+	erasureHandler *handler.ErasureHandler,
+	consentHandler *handler.ConsentHandler,
+	invitationHandler *handler.InvitationHandler,
+	organizationHandler *handler.OrganizationHandler,
+	passwordHandler *handler.PasswordHandler,
+	recoveryHandler *handler.RecoveryHandler,
+	oauthHandler *handler.OAuthHandler,
+	providerTokenHandler *handler.ProviderTokenHandler,
+	kerberosHandler *handler.KerberosHandler,
+	siweHandler *handler.SIWEHandler,
+	graphQLHandler *handler.GraphQLHandler,
+	sessionEventsHandler *handler.SessionEventsHandler,
+	gatewayConfigHandler *handler.GatewayConfigHandler,
+	accountEventsHandler *handler.AccountEventsHandler,
 	authService service.AuthService,
-	rateLimiter *service.RateLimiter,
-	healthChecker *HealthChecker,
-	metricsHandler http.Handler,
+	rateLimiter service.RateLimiter,
+	captchaVerifier service.CaptchaVerifier,
+	drain gin.HandlerFunc,
+	tenant gin.HandlerFunc,
 ) {
-	router.GET("/metrics", observability.PrometheusHandler(metricsHandler))
-	router.GET("/health", healthChecker.Handler)
+	if cfg.DocsEnabled() {
+		router.GET(handler.OpenAPIPath, handler.OpenAPIHandler)
+		router.GET("/swagger/*any", handler.SwaggerUIHandler())
+	}
+	if cfg.Redirect.ChangePasswordURL != "" {
+		router.GET(handler.ChangePasswordPath, handler.ChangePasswordRedirect(cfg.Redirect.ChangePasswordURL))
+	}
+
+	rateLimit := handler.RateLimitPolicyMiddleware(rateLimiter, rateLimitPolicies(cfg.Security.EffectiveRateLimitPolicies(), cfg.Security.RateLimitRestrictedPercent))
+	captcha := handler.CaptchaMiddleware(captchaVerifier, withV2Routes(cfg.Captcha.Routes))
+	timeouts := requestTimeouts(cfg.Security.RequestTimeouts)
+	for _, version := range []handler.APIVersion{handler.APIVersion1, handler.APIVersion2} {
+		// Event streams last as long as clients stay connected, the timeout buffers responses besides
+		timeouts[version.Prefix()+"/auth/events"] = 0
+	}
+	timeout := handler.TimeoutMiddleware(timeouts, cfg.Security.RequestTimeout.Duration)
+
+	// Read-only routes accept access tokens that expired moments ago, see JWT_EXPIRY_GRACE
+	readAuth := handler.AuthMiddleware(authService, handler.WithExpiryGrace(cfg.JWT.ExpiryGrace.Duration))
+
+	// Routes acting on other users need a verified email, see EMAIL_VERIFICATION_POLICY
+	verified := func(c *gin.Context) { c.Next() }
+	if cfg.Email.VerificationPolicy != service.EmailVerificationOff {
+		verified = handler.RequireVerifiedEmail(authService)
+	}
+
+	// Auth routes are shared between API versions, handlers adapt to the version of the group
+	authRoutes := func(auth *gin.RouterGroup) {
+		// Password hashing makes these the slowest requests, they are refused while draining
+		auth.POST("/register", handler.Feature(cfg.Features.Registration, drain, rateLimit, captcha, authHandler.Register)...)
+		auth.POST("/register/invite/:token", handler.Feature(cfg.Features.Registration, drain, rateLimit, captcha, authHandler.RegisterWithInvitation)...)
+		auth.POST("/login", handler.Feature(cfg.Features.PasswordLogin, drain, rateLimit, captcha, authHandler.Login)...)
+		auth.POST("/set-password", handler.Feature(cfg.Features.PasswordLogin, drain, handler.AuthMiddleware(authService), rateLimit, passwordHandler.SetPassword)...)
+		auth.GET("/oauth/:provider", handler.Feature(cfg.Features.OAuth, rateLimit, oauthHandler.Authorize)...)
+		auth.GET("/oauth/:provider/callback", handler.Feature(cfg.Features.OAuth, rateLimit, oauthHandler.Callback)...)
+		auth.POST("/oauth/token", handler.Feature(cfg.Features.OAuth, rateLimit, oauthHandler.Token)...)
+		// Users who lost access to their email recover the account by signing in with a linked provider
+		auth.POST("/recovery/email", handler.Feature(cfg.Features.OAuth, handler.AuthMiddleware(authService), rateLimit, recoveryHandler.ChangeEmail)...)
+		// Tokens of linked provider accounts, only with ENCRYPTION_KEYS
+		if providerTokenHandler != nil {
+			auth.GET("/providers/:provider/token", handler.Feature(cfg.Features.OAuth, handler.AuthMiddleware(authService), rateLimit, providerTokenHandler.GetToken)...)
+		}
+		// SPNEGO sign-in of the on-premises variant, only with a keytab
+		if kerberosHandler != nil {
+			auth.POST("/kerberos", rateLimit, kerberosHandler.Negotiate)
+		}
+		// Sign-in with Ethereum wallets, only with SIWE_DOMAIN
+		if siweHandler != nil {
+			auth.GET("/siwe/nonce", rateLimit, siweHandler.Nonce)
+			auth.POST("/siwe/verify", rateLimit, siweHandler.Verify)
+		}
+		auth.POST("/refresh", rateLimit, authHandler.Refresh)
+		auth.GET("/username-available", rateLimit, authHandler.UsernameAvailable)
+		auth.POST("/introspect", rateLimit, authHandler.Introspect)
+		auth.GET("/config", rateLimit, gatewayConfigHandler.GetConfig)
+		auth.POST("/logout", handler.AuthMiddleware(authService), rateLimit, authHandler.Logout)
+		auth.GET("/me", readAuth, rateLimit, authHandler.GetMe)
+		auth.PATCH("/me", handler.AuthMiddleware(authService), rateLimit, authHandler.UpdateMe)
+		auth.POST("/me/erasure", handler.AuthMiddleware(authService), rateLimit, erasureHandler.RequestErasure)
+		auth.DELETE("/me/erasure", handler.AuthMiddleware(authService), rateLimit, erasureHandler.CancelErasure)
+		auth.GET("/me/consents", readAuth, rateLimit, consentHandler.GetConsents)
+		auth.POST("/me/consents", handler.AuthMiddleware(authService), rateLimit, consentHandler.AcceptConsent)
+		auth.GET("/sessions", readAuth, rateLimit, authHandler.ListSessions)
+		auth.GET("/events", sessionEventsHandler.Authenticate(authService), rateLimit, sessionEventsHandler.Stream)
+		auth.POST("/events/ticket", handler.AuthMiddleware(authService), rateLimit, sessionEventsHandler.Ticket)
+		auth.DELETE("/sessions/:id", handler.AuthMiddleware(authService), rateLimit, authHandler.RevokeSession)
+
+		// Users only manage their own invitations, and only when they may invite
+		if cfg.Invitation.AllowUsers {
+			auth.GET("/invitations", readAuth, rateLimit, verified, invitationHandler.ListInvitations)
+			auth.POST("/invitations", handler.AuthMiddleware(authService), rateLimit, verified, invitationHandler.CreateInvitation)
+			auth.DELETE("/invitations/:id", handler.AuthMiddleware(authService), rateLimit, verified, invitationHandler.RevokeInvitation)
+		}
+
+		organizations := func(authenticate, h gin.HandlerFunc) []gin.HandlerFunc {
+			return handler.Feature(cfg.Features.Organizations, authenticate, rateLimit, verified, h)
+		}
+		auth.GET("/orgs", organizations(readAuth, organizationHandler.ListOrganizations)...)
+		auth.POST("/orgs", organizations(handler.AuthMiddleware(authService), organizationHandler.CreateOrganization)...)
+		auth.POST("/orgs/:id/token", organizations(handler.AuthMiddleware(authService), organizationHandler.IssueToken)...)
+		auth.GET("/orgs/:id/members", organizations(readAuth, organizationHandler.ListMembers)...)
+		auth.POST("/orgs/:id/members", organizations(handler.AuthMiddleware(authService), organizationHandler.AddMember)...)
+		auth.PATCH("/orgs/:id/members/:user_id", organizations(handler.AuthMiddleware(authService), organizationHandler.UpdateMember)...)
+		auth.DELETE("/orgs/:id/members/:user_id", organizations(handler.AuthMiddleware(authService), organizationHandler.RemoveMember)...)
+	}
+
+	api := router.Group(handler.APIVersion1.Prefix(), handler.APIVersionMiddleware(handler.APIVersion1), timeout)
+	{
+		authRoutes(api.Group("/auth", handler.DeprecationMiddleware(handler.APIVersion2, cfg.API.V1Sunset), tenant))
+
+		// Admin API is only exposed when an admin token is configured
+		if cfg.Admin.APIToken != "" {
+			adminRoutes(api.Group("/admin", handler.AdminMiddleware(cfg.Admin.APIToken)), adminHandler, invitationHandler, kerberosHandler)
+		}
+		// Token revocation for OAuth clients is only exposed when clients are configured
+		if len(cfg.TokenRevocation.Clients) > 0 {
+			api.POST("/oauth/revoke", rateLimit, handler.NewTokenRevocationHandler(authService, cfg.TokenRevocation.Clients).Revoke)
+		}
+		// Provider notifications are signed and come in bursts from few addresses, they aren't rate limited
+		if accountEventsHandler != nil {
+			api.POST("/oauth/events/:provider", accountEventsHandler.Receive)
+		}
+	}
 
-	api := router.Group("/api/v1")
+	apiV2 := router.Group(handler.APIVersion2.Prefix(), handler.APIVersionMiddleware(handler.APIVersion2), timeout)
 	{
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register",
-				handler.RateLimitMiddleware(rateLimiter, cfg.Security.RateLimitRequests, cfg.Security.RateLimitWindow.Duration, handler.IPBasedKey),
-				authHandler.Register,
-			)
-			auth.POST("/login",
-				handler.RateLimitMiddleware(rateLimiter, cfg.Security.RateLimitRequests, cfg.Security.RateLimitWindow.Duration, handler.IPBasedKey),
-				authHandler.Login,
-			)
-			auth.POST("/refresh", authHandler.Refresh)
-			auth.POST("/logout", handler.AuthMiddleware(authService), authHandler.Logout)
-			auth.GET("/me", handler.AuthMiddleware(authService), authHandler.GetMe)
+		authRoutes(apiV2.Group("/auth", tenant))
+	}
+
+	// GraphQL is optional, anonymous requests may only log in or refresh tokens
+	// Logging in is guarded like the login endpoint of API v2, on top of the limit of /graphql
+	if graphQLHandler != nil {
+		handlers := []gin.HandlerFunc{handler.APIVersionMiddleware(handler.APIVersion2), timeout, handler.OptionalAuthMiddleware(authService), rateLimit}
+		handlers = append(handlers, graphQLHandler.LoginGuard(handler.APIVersion2.Prefix()+"/auth/login", drain, rateLimit, captcha)...)
+		router.POST("/graphql", append(handlers, graphQLHandler.Serve)...)
+	}
+}
+
+// adminRoutes registers the admin API on a group authenticating admins
+func adminRoutes(admin *gin.RouterGroup, adminHandler *handler.AdminHandler, invitationHandler *handler.InvitationHandler, kerberosHandler *handler.KerberosHandler) {
+	admin.GET("/stats", adminHandler.GetStats)
+	admin.GET("/ip-rules", adminHandler.ListIPRules)
+	admin.POST("/ip-rules", adminHandler.CreateIPRule)
+	admin.DELETE("/ip-rules/:id", adminHandler.DeleteIPRule)
+	admin.POST("/revocations", adminHandler.CreateRevocation)
+	admin.GET("/tenants", adminHandler.ListTenants)
+	admin.PUT("/tenants/:id", adminHandler.SaveTenant)
+	admin.DELETE("/tenants/:id", adminHandler.DeleteTenant)
+	admin.GET("/tenants/:id/email-domains", adminHandler.GetTenantEmailDomains)
+	admin.PUT("/tenants/:id/email-domains", adminHandler.SetTenantEmailDomains)
+	admin.GET("/jwt-keys", adminHandler.ListJWTKeys)
+	admin.POST("/jwt-keys/rotate", adminHandler.RotateJWTKey)
+	admin.GET("/feature-flags", adminHandler.ListFeatureFlags)
+	admin.PUT("/feature-flags/:name", adminHandler.SetFeatureFlag)
+	admin.DELETE("/feature-flags/:name", adminHandler.ResetFeatureFlag)
+	admin.GET("/users/:id/erasure", adminHandler.GetUserErasure)
+	admin.POST("/users/:id/erasure", adminHandler.EraseUser)
+	admin.GET("/users/search", adminHandler.SearchUsers)
+	admin.GET("/users/:id", adminHandler.GetUser)
+	admin.PUT("/users/:id/flags", adminHandler.UpdateUserFlags)
+	admin.PUT("/users/:id/restriction", adminHandler.SetUserRestriction)
+	admin.POST("/users/import", adminHandler.ImportUsers)
+	admin.GET("/users/import/:id", adminHandler.GetUserImport)
+	admin.GET("/invitations", invitationHandler.ListInvitations)
+	admin.POST("/invitations", invitationHandler.CreateInvitation)
+	admin.DELETE("/invitations/:id", invitationHandler.RevokeInvitation)
+	if kerberosHandler != nil {
+		admin.POST("/users/:id/kerberos-principals", kerberosHandler.LinkPrincipal)
+	}
+}
+
+// setupExtAuthzRoutes serves the Envoy ext_authz service on the internal listener, to callers
+// authenticated with mutual TLS when it is enabled
+func setupExtAuthzRoutes(router *gin.Engine, cfg *config.Config, authService service.AuthService) {
+	var handlers []gin.HandlerFunc
+	if cfg.Internal.MTLSEnabled() {
+		handlers = append(handlers, handler.PeerAuthMiddleware(cfg.Internal.AllowedSPIFFEIDs))
+	}
+	extAuthzHandler := handler.NewExtAuthzHandler(authService, cfg.ExtAuthz.Cookie, handler.WithExpiryGrace(cfg.JWT.ExpiryGrace.Duration))
+	router.Any(cfg.ExtAuthz.PathPrefix+"/*path", append(handlers, extAuthzHandler.Check)...)
+}
+
+// setupPeerRoutes serves introspection and the admin API on the internal listener to callers
+// authenticated with mutual TLS, so that internal services need no static admin token
+// The paths are those of the public listener.
+func setupPeerRoutes(
+	router *gin.Engine,
+	cfg *config.Config,
+	logger *zap.Logger,
+	authHandler *handler.AuthHandler,
+	adminHandler *handler.AdminHandler,
+	invitationHandler *handler.InvitationHandler,
+	kerberosHandler *handler.KerberosHandler,
+) {
+	peer := router.Group("",
+		handler.RequestIDMiddleware(),
+		handler.ClientInfoMiddleware(),
+		handler.LocaleMiddleware(),
+		handler.LoggerMiddleware(logger, nil, 0),
+		handler.PeerAuthMiddleware(cfg.Internal.AllowedSPIFFEIDs),
+	)
+
+	for _, version := range []handler.APIVersion{handler.APIVersion1, handler.APIVersion2} {
+		peer.POST(version.Prefix()+"/auth/introspect", handler.APIVersionMiddleware(version), authHandler.Introspect)
+	}
+	adminRoutes(peer.Group(handler.APIVersion1.Prefix()+"/admin", handler.APIVersionMiddleware(handler.APIVersion1)), adminHandler, invitationHandler, kerberosHandler)
+}
+
+// featureFlagDefaults converts configured feature flags into flags
+func featureFlagDefaults(cfg config.FeatureFlagsConfig) []domain.FeatureFlag {
+	flags := make([]domain.FeatureFlag, 0, len(cfg.Defaults))
+	for name, percentage := range cfg.Defaults {
+		flags = append(flags, domain.FeatureFlag{
+			Name:       name,
+			Percentage: percentage,
+			Claim:      slices.Contains(cfg.Claims, name),
+		})
+	}
+	return flags
+}
+
+// oauthProviders creates the configured OAuth providers
+func oauthProviders(cfg config.OAuthConfig) []oauth.Provider {
+	var providers []oauth.Provider
+	if cfg.GitHub.Enabled() {
+		providers = append(providers, oauth.NewGitHub(oauthProviderConfig(cfg.GitHub)))
+	}
+	if cfg.GitLab.Enabled() {
+		providers = append(providers, oauth.NewGitLab(oauthProviderConfig(cfg.GitLab)))
+	}
+	return providers
+}
+
+// oauthProviderConfig converts a configured OAuth application into a provider config
+func oauthProviderConfig(cfg config.OAuthProviderConfig) oauth.Config {
+	return oauth.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		BaseURL:      cfg.URL,
+	}
+}
+
+// rateLimitPolicies converts configured policies into handler policies
+// Restricted users get restrictedPercent of each limit, at least 1.
+func rateLimitPolicies(policies config.RateLimitPolicies, restrictedPercent int) map[string]handler.RateLimitPolicy {
+	result := make(map[string]handler.RateLimitPolicy, len(policies))
+	for route, policy := range policies {
+		keyFunc := handler.IPBasedKey
+		if policy.Key == config.RateLimitKeyUser {
+			keyFunc = handler.UserBasedKey
+		}
+
+		result[route] = handler.RateLimitPolicy{
+			Limit:           policy.Limit,
+			RestrictedLimit: max(policy.Limit*restrictedPercent/100, 1),
+			Window:          policy.Window.Duration,
+			KeyFunc:         keyFunc,
+		}
+	}
+
+	// Policies of v1 routes also apply to v2 unless configured explicitly, both versions share
+	// the limit so that clients don't get it twice by switching versions
+	for route, policy := range result {
+		if v2Route, ok := toV2Route(route); ok {
+			if _, exists := result[v2Route]; !exists {
+				policy.Bucket = route
+				result[v2Route] = policy
+			}
 		}
 	}
+
+	return result
+}
+
+// requestTimeouts converts configured timeouts, v1 timeouts also apply to v2 unless configured explicitly
+func requestTimeouts(timeouts config.RouteTimeouts) map[string]time.Duration {
+	result := make(map[string]time.Duration, len(timeouts))
+	for route, timeout := range timeouts {
+		result[route] = timeout.Duration
+	}
+
+	for route, timeout := range result {
+		if v2Route, ok := toV2Route(route); ok {
+			if _, exists := result[v2Route]; !exists {
+				result[v2Route] = timeout
+			}
+		}
+	}
+
+	return result
+}
+
+// withV2Routes adds the v2 counterparts of configured v1 routes
+func withV2Routes(routes []string) []string {
+	result := append([]string(nil), routes...)
+	for _, route := range routes {
+		if v2Route, ok := toV2Route(route); ok && !slices.Contains(routes, v2Route) {
+			result = append(result, v2Route)
+		}
+	}
+	return result
+}
+
+// toV2Route maps a route template of API v1 to the same route of API v2
+func toV2Route(route string) (string, bool) {
+	path, ok := strings.CutPrefix(route, handler.APIVersion1.Prefix()+"/")
+	if !ok {
+		return "", false
+	}
+	return handler.APIVersion2.Prefix() + "/" + path, true
 }
 
 func (a *App) Run(ctx context.Context) error {
-	errChan := make(chan error, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Background loops log their failures with the application logger
+	ctx = observability.ContextWithLogger(ctx, a.infra.Logger())
+
+	if a.config.IPFilter.Enabled {
+		if err := a.ipFilter.Reload(ctx); err != nil {
+			return fmt.Errorf("failed to load ip rules: %w", err)
+		}
+		go a.ipFilter.Run(ctx)
+	}
+
+	if err := a.featureFlags.Reload(ctx); err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	go a.featureFlags.Run(ctx)
+
+	if a.jwtKeys != nil {
+		if err := a.jwtKeys.Reload(ctx); err != nil {
+			return fmt.Errorf("failed to load jwt keys: %w", err)
+		}
+		go a.jwtKeys.Run(ctx)
+	}
+
+	go a.erasures.Run(ctx)
+	go a.sessionEvents.Run(ctx)
+	go a.invalidations.Run(ctx)
+	go a.tokenCleanup.Run(ctx)
+	go a.emailNormalization.Run(ctx)
+	if a.reencryption != nil {
+		go a.reencryption.Run(ctx)
+	}
+	if a.unverified != nil {
+		go a.unverified.Run(ctx)
+	}
 
+	jobsDone := make(chan struct{})
 	go func() {
-		a.infra.Logger().Info("Application starting",
-			zap.String("host", a.config.Server.Host),
-			zap.String("port", a.config.Server.Port),
-		)
+		a.jobs.Run(ctx)
+		close(jobsDone)
+	}()
 
-		if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			a.infra.Logger().Error("Server error", zap.Error(err))
-			errChan <- err
+	auditDone := make(chan struct{})
+	go func() {
+		if a.audit != nil {
+			a.audit.Run(ctx)
 		}
+		close(auditDone)
 	}()
 
+	errChan := make(chan error, 2)
+
+	a.infra.Logger().Info("Application starting",
+		zap.String("host", a.config.Server.Host),
+		zap.String("port", a.config.Server.Port),
+	)
+	go a.serve(a.server, "Server", errChan)
+
+	if a.internalServer != nil {
+		a.infra.Logger().Info("Internal listener starting",
+			zap.String("host", a.config.Internal.Host),
+			zap.String("port", a.config.Internal.Port),
+			zap.Bool("tls", a.config.Internal.TLSEnabled()),
+			zap.Bool("mtls", a.config.Internal.MTLSEnabled()),
+		)
+		go a.serve(a.internalServer, "Internal server", errChan)
+	}
+
 	var serverErr error
 	select {
 	case err := <-errChan:
@@ -132,6 +916,23 @@ func (a *App) Run(ctx context.Context) error {
 		a.infra.Logger().Info("Application stopped by context")
 	}
 
+	// In-flight requests may still enqueue jobs and use storage, so they finish first,
+	// then jobs in progress and pending audit events, and connections are closed last
+	a.drain()
+	cancel()
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelWait()
+	select {
+	case <-jobsDone:
+	case <-waitCtx.Done():
+		a.infra.Logger().Warn("Timed out waiting for background jobs to finish")
+	}
+	select {
+	case <-auditDone:
+	case <-waitCtx.Done():
+		a.infra.Logger().Warn("Timed out exporting audit events")
+	}
+
 	if err := a.Shutdown(); err != nil {
 		a.infra.Logger().Error("Shutdown error", zap.Error(err))
 		if serverErr != nil {
@@ -143,23 +944,65 @@ func (a *App) Run(ctx context.Context) error {
 	return serverErr
 }
 
+// serve runs srv until it is shut down and reports other failures to errChan
+func (a *App) serve(srv *http.Server, name string, errChan chan<- error) {
+	listen := srv.ListenAndServe
+	if srv.TLSConfig != nil {
+		// Certificates are loaded into the TLS config already
+		listen = func() error { return srv.ListenAndServeTLS("", "") }
+	}
+	if err := listen(); err != nil && err != http.ErrServerClosed {
+		a.infra.Logger().Error(name+" error", zap.Error(err))
+		errChan <- err
+	}
+}
+
+// Draining reports whether the application is shutting down
+func (a *App) Draining() bool {
+	return a.draining.Load()
+}
+
+// drain stops accepting connections and waits for in-flight requests up to SERVER_DRAIN_TIMEOUT
+// Requests still running after that are cut off. Only the first call drains, later calls
+// return its result.
+func (a *App) drain() error {
+	a.drainOnce.Do(func() {
+		a.draining.Store(true)
+		a.infra.Logger().Info("Draining connections",
+			zap.Duration("delay", a.config.Server.DrainDelay.Duration),
+			zap.Duration("timeout", a.config.Server.DrainTimeout.Duration),
+		)
+
+		if delay := a.config.Server.DrainDelay.Duration; delay > 0 {
+			time.Sleep(delay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.Server.DrainTimeout.Duration)
+		defer cancel()
+
+		if err := a.server.Shutdown(ctx); err != nil {
+			a.infra.Logger().Warn("Timed out draining connections, closing them", zap.Error(err))
+			a.drainErr = errors.Join(err, a.server.Close())
+		}
+	})
+	return a.drainErr
+}
+
 func (a *App) Shutdown() error {
 	a.infra.Logger().Info("Application shutting down...")
 
+	drainErr := a.drain()
+
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
-	errs := make(chan error, 2)
-
-	go func() {
-		errs <- a.server.Shutdown(ctx)
-	}()
-
-	go func() {
-		errs <- a.infra.Shutdown(ctx)
-	}()
+	var internalErr error
+	if a.internalServer != nil {
+		internalErr = a.internalServer.Shutdown(ctx)
+	}
 
-	err := errors.Join(<-errs, <-errs)
+	// Storage is closed after the requests using it are done
+	err := errors.Join(drainErr, internalErr, a.infra.Shutdown(ctx))
 	if err != nil {
 		a.infra.Logger().Error("Shutdown failed", zap.Error(err))
 		return err
@@ -0,0 +1,626 @@
+package app
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/buildinfo"
+	"github.com/prperemyshlev/auth-service-2/internal/config"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"go.uber.org/zap"
+)
+
+func TestAppWithInMemoryStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("REDIRECT_CHANGE_PASSWORD_URL", "https://app.example.com/settings/password")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+	if infra.Postgres() != nil {
+		t.Error("Expected no Postgres connection with in-memory storage")
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	body := `{"email":"user@example.com","password":"Password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/health+json" {
+		t.Errorf("Expected application/health+json, got %s", contentType)
+	}
+
+	var health healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	redis := health.Checks["redis:responseTime"]
+	if health.Status != healthPass || len(redis) != 1 || redis[0].Status != healthPass || redis[0].ObservedUnit != "ms" {
+		t.Errorf("Expected a passing redis check with its latency, got %+v", health)
+	}
+	if _, ok := health.Checks["uptime"]; !ok || health.Version == "" || health.ReleaseID == "" {
+		t.Errorf("Expected uptime and version, got %+v", health)
+	}
+	if _, ok := health.Checks["migrations:version"]; ok {
+		t.Error("Expected no migrations check with in-memory storage")
+	}
+
+	rec = httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/change-password", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://app.example.com/settings/password" {
+		t.Errorf("Expected a redirect to the change-password page, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestAppDrainRejectsLogins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("SERVER_DRAIN_DELAY", "500ms")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		application.Shutdown()
+		close(done)
+	}()
+	for !application.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The listener stays open for SERVER_DRAIN_DELAY, requests are still served meanwhile
+	rec := httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected health status 503 while draining, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"user@example.com","password":"Password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected login status 503 while draining, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") != "5" {
+		t.Errorf("Expected Retry-After 5, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	<-done
+}
+
+func TestAppInternalListener(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("INTERNAL_PORT", "9091")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	for _, path := range []string{"/metrics", "/health", "/version"} {
+		rec := httptest.NewRecorder()
+		application.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected %s to be absent from the public router, got %d", path, rec.Code)
+		}
+
+		rec = httptest.NewRecorder()
+		application.InternalRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected %s on the internal router, got %d", path, rec.Code)
+		}
+	}
+
+	// Peers can't claim another client IP without TRUSTED_PROXIES
+	application.InternalRouter().GET("/client-ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+	req := httptest.NewRequest(http.MethodGet, "/client-ip", nil)
+	req.RemoteAddr = "192.0.2.1:4321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	rec := httptest.NewRecorder()
+	application.InternalRouter().ServeHTTP(rec, req)
+	if rec.Body.String() != "192.0.2.1" {
+		t.Errorf("Expected the peer address as client IP, got %q", rec.Body.String())
+	}
+}
+
+func TestAppVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	rec := httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info buildinfo.Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || info.Version == "" || !strings.HasPrefix(info.GoVersion, "go") {
+		t.Errorf("Expected build information, got %s (%v)", rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `build_info{`) || !strings.Contains(rec.Body.String(), `version="`+info.Version+`"`) {
+		t.Errorf("Expected a build_info gauge, got %s", rec.Body.String())
+	}
+}
+
+func TestAppDisabledFeatures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("REGISTRATION_ENABLED", "false")
+	t.Setenv("ORGANIZATIONS_ENABLED", "false")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/v2/auth/register"},
+		{http.MethodPost, "/api/v2/auth/register/invite/token"},
+		{http.MethodGet, "/api/v2/auth/orgs"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{"email":"user@example.com","password":"Password123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		application.Router().ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), `"code":"feature_disabled"`) {
+			t.Errorf("Expected %s to be disabled, got %d: %s", route.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/auth/login", strings.NewReader(`{"identifier":"user@example.com","password":"Password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected logins to stay enabled, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAppRateLimitSharedAcrossVersions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("RATE_LIMIT_POLICIES", "/api/v1/auth/refresh=2/1m/ip")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	// The v2 route inherits the v1 policy and its limit, switching versions doesn't reset it
+	for i, route := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/auth/refresh", http.StatusBadRequest},
+		{"/api/v2/auth/refresh", http.StatusBadRequest},
+		{"/api/v2/auth/refresh", http.StatusTooManyRequests},
+		{"/api/v1/auth/refresh", http.StatusTooManyRequests},
+	} {
+		req := httptest.NewRequest(http.MethodPost, route.path, nil)
+		rec := httptest.NewRecorder()
+		application.Router().ServeHTTP(rec, req)
+		if rec.Code != route.status {
+			t.Errorf("Request %d to %s: expected status %d, got %d: %s", i+1, route.path, route.status, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestAppExpiryGrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("JWT_LEEWAY", "0s")
+	t.Setenv("JWT_EXPIRY_GRACE", "2m")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", strings.NewReader(`{"email":"user@example.com","password":"Password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, req)
+	var registered struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &registered); err != nil || registered.User.ID == "" {
+		t.Fatalf("Failed to register: %d %s", rec.Code, rec.Body.String())
+	}
+
+	expired, err := utils.NewJWTManager(cfg.JWT.Secret, -time.Minute, time.Hour, utils.WithLeeway(0)).GenerateAccessToken(registered.User.ID, "user@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+expired)
+	rec = httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Warning"), "expired") {
+		t.Errorf("Expected a recently expired token to be accepted with a warning, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/auth/me", strings.NewReader(`{"first_name":"Jane"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+expired)
+	rec = httptest.NewRecorder()
+	application.Router().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an expired token to be rejected on writes, got %d", rec.Code)
+	}
+}
+
+func TestAppDebugEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("INTERNAL_PORT", "9091")
+	t.Setenv("DEBUG_ENABLED", "true")
+	t.Setenv("LOG_LEVEL", "info")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	serve := func(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve(application.Router(), http.MethodGet, "/debug/vars", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected debug endpoints to be absent from the public router, got %d", rec.Code)
+	}
+
+	internal := application.InternalRouter()
+	if rec := serve(internal, http.MethodGet, "/debug/vars", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"goroutines"`) {
+		t.Errorf("Expected runtime stats, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(internal, http.MethodGet, "/debug/pprof/heap", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected heap profile, got %d", rec.Code)
+	}
+
+	if rec := serve(internal, http.MethodPut, "/debug/log-level", `{"level":"debug"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected log level to change, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !infra.Logger().Core().Enabled(zap.DebugLevel) {
+		t.Error("Expected debug logs to be enabled")
+	}
+	if rec := serve(internal, http.MethodGet, "/debug/log-level", ""); !strings.Contains(rec.Body.String(), `"debug"`) {
+		t.Errorf("Expected current level debug, got %s", rec.Body.String())
+	}
+}
+
+func TestAppInternalMutualTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pki := newTestPKI(t)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("INTERNAL_PORT", "9091")
+	t.Setenv("INTERNAL_TLS_CERT_PATH", pki.serverCert)
+	t.Setenv("INTERNAL_TLS_KEY_PATH", pki.serverKey)
+	t.Setenv("INTERNAL_TLS_CLIENT_CA_PATH", pki.caCert)
+	t.Setenv("INTERNAL_ALLOWED_SPIFFE_IDS", "spiffe://example.org/ns/prod")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	infra, err := NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+
+	application, err := NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	defer application.Shutdown()
+
+	server := httptest.NewUnstartedServer(application.InternalRouter())
+	server.TLS = application.internalServer.TLSConfig
+	server.StartTLS()
+	defer server.Close()
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pki.pool, Certificates: certs}}}
+	}
+	introspect := func(c *http.Client) int {
+		resp, err := c.Post(server.URL+"/api/v2/auth/introspect", "application/json", strings.NewReader(`{"token":"invalid"}`))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := introspect(client(pki.client(t, "spiffe://example.org/ns/prod/sa/gateway"))); status != http.StatusOK {
+		t.Errorf("Expected introspection for an allowed peer, got %d", status)
+	}
+	if status := introspect(client(pki.client(t, "spiffe://example.org/ns/dev/sa/gateway"))); status != http.StatusForbidden {
+		t.Errorf("Expected other peers to be rejected, got %d", status)
+	}
+	if status := introspect(client()); status != http.StatusUnauthorized {
+		t.Errorf("Expected callers without certificate to be rejected, got %d", status)
+	}
+
+	// Probes don't present certificates
+	resp, err := client().Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected /health without client certificate, got %d", resp.StatusCode)
+	}
+}
+
+func TestRedisTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	serverCert, err := tls.LoadX509KeyPair(pki.serverCert, pki.serverKey)
+	if err != nil {
+		t.Fatalf("Failed to load server certificate: %v", err)
+	}
+	server, err := miniredis.RunTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start Redis: %v", err)
+	}
+	t.Cleanup(server.Close)
+	server.RequireUserAuth("auth-service", "secret")
+
+	dir := t.TempDir()
+	client := pki.client(t, "spiffe://example.org/ns/prod/sa/auth-service")
+	key, _ := x509.MarshalECPrivateKey(client.PrivateKey.(*ecdsa.PrivateKey))
+	cfg := config.RedisConfig{
+		TLSEnabled:  true,
+		TLSCAPath:   pki.caCert,
+		TLSCertPath: writePEM(t, filepath.Join(dir, "client.pem"), "CERTIFICATE", client.Certificate[0]),
+		TLSKeyPath:  writePEM(t, filepath.Join(dir, "client-key.pem"), "EC PRIVATE KEY", key),
+	}
+
+	tlsConfig, err := redisTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create TLS configuration: %v", err)
+	}
+	redis, err := database.NewRedis(server.Addr(), "secret", 0, database.WithUsername("auth-service"), database.WithTLS(tlsConfig))
+	if err != nil {
+		t.Fatalf("Failed to connect over TLS: %v", err)
+	}
+	redis.Close()
+
+	if _, err := database.NewRedis(server.Addr(), "secret", 0, database.WithTLS(tlsConfig)); err == nil {
+		t.Error("Expected the default user to be refused")
+	}
+	cfg.TLSCertPath, cfg.TLSKeyPath = "", ""
+	withoutCert, _ := redisTLSConfig(cfg)
+	if _, err := database.NewRedis(server.Addr(), "secret", 0, database.WithUsername("auth-service"), database.WithTLS(withoutCert)); err == nil {
+		t.Error("Expected connections without client certificate to be refused")
+	}
+	if tlsConfig, err := redisTLSConfig(config.RedisConfig{}); tlsConfig != nil || err != nil {
+		t.Errorf("Expected no TLS unless enabled, got %v (%v)", tlsConfig, err)
+	}
+}
+
+// testPKI is a CA issuing certificates for tests, the CA and a server certificate for 127.0.0.1 are written to files
+type testPKI struct {
+	pool       *x509.CertPool
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	caCert     string
+	serverCert string
+	serverKey  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+
+	pki := &testPKI{pool: x509.NewCertPool(), ca: ca, caKey: caKey}
+	pki.pool.AddCert(ca)
+	pki.caCert = writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+
+	server := pki.issue(t, &x509.Certificate{IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})
+	key, _ := x509.MarshalECPrivateKey(server.PrivateKey.(*ecdsa.PrivateKey))
+	pki.serverCert = writePEM(t, filepath.Join(dir, "server.pem"), "CERTIFICATE", server.Certificate[0])
+	pki.serverKey = writePEM(t, filepath.Join(dir, "server-key.pem"), "EC PRIVATE KEY", key)
+	return pki
+}
+
+// client issues a client certificate with a SPIFFE ID
+func (p *testPKI) client(t *testing.T, spiffeID string) tls.Certificate {
+	id, _ := url.Parse(spiffeID)
+	return p.issue(t, &x509.Certificate{URIs: []*url.URL{id}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+}
+
+// issue signs a certificate for a new key, template sets the SANs and usages
+func (p *testPKI) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writePEM writes a PEM block to path and returns the path
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
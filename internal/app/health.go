@@ -2,52 +2,210 @@ package app
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
+	"fmt"
+	"io/fs"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/buildinfo"
+	"github.com/prperemyshlev/auth-service-2/migrations"
+	sqlitemigrations "github.com/prperemyshlev/auth-service-2/migrations/sqlite"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/mailer"
 )
 
 const healthCheckTimeout = 2 * time.Second
 
+// Health statuses, warn doesn't take the instance out of rotation
+const (
+	healthPass = "pass"
+	healthWarn = "warn"
+	healthFail = "fail"
+)
+
+// healthResponse is an application/health+json response as in draft-inadarei-api-health-check
+type healthResponse struct {
+	Status    string                   `json:"status"`
+	Version   string                   `json:"version"`
+	ReleaseID string                   `json:"releaseId"`
+	Output    string                   `json:"output,omitempty"`
+	Checks    map[string][]healthCheck `json:"checks"`
+}
+
+// healthCheck is the result of checking one dependency
+type healthCheck struct {
+	ComponentType string    `json:"componentType"`
+	ObservedValue any       `json:"observedValue,omitempty"`
+	ObservedUnit  string    `json:"observedUnit,omitempty"`
+	Status        string    `json:"status"`
+	Time          time.Time `json:"time"`
+	Output        string    `json:"output,omitempty"`
+}
+
 type HealthChecker struct {
 	infra Infrastructure
+	mail  mailer.Mailer
+	// migration is the version of the last migration this build expects, 0 without database
+	migration uint
+	startedAt time.Time
+	// draining reports whether the application is shutting down
+	draining func() bool
 }
 
-func NewHealthChecker(infra Infrastructure) *HealthChecker {
-	return &HealthChecker{
-		infra: infra,
+func NewHealthChecker(infra Infrastructure, mail mailer.Mailer, draining func() bool) (*HealthChecker, error) {
+	h := &HealthChecker{
+		infra:     infra,
+		mail:      mail,
+		startedAt: time.Now(),
+		draining:  draining,
+	}
+
+	var expected fs.FS
+	switch {
+	case infra.Postgres() != nil:
+		expected = migrations.FS
+	case infra.SQLite() != nil:
+		expected = sqlitemigrations.FS
+	default:
+		return h, nil
+	}
+
+	var err error
+	if h.migration, err = database.LatestMigration(expected); err != nil {
+		return nil, err
 	}
+	return h, nil
 }
 
-func (h *HealthChecker) check(ctx context.Context) error {
+// check runs the dependency checks concurrently, keyed by component and measurement
+func (h *HealthChecker) check(ctx context.Context) map[string][]healthCheck {
 	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
 	defer cancel()
 
-	errs := make(chan error, 2)
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		checks = make(map[string][]healthCheck)
+	)
+	run := func(name string, check func(context.Context) healthCheck) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := check(ctx)
+			mu.Lock()
+			checks[name] = []healthCheck{result}
+			mu.Unlock()
+		}()
+	}
 
-	go func() {
-		errs <- h.infra.Postgres().Ping(ctx)
-	}()
+	// At most one database is used, none with in-memory storage
+	switch {
+	case h.infra.Postgres() != nil:
+		run("postgres:responseTime", latencyCheck(true, h.infra.Postgres().Ping))
+		run("migrations:version", h.migrationCheck(h.infra.Postgres().MigrationVersion))
+	case h.infra.SQLite() != nil:
+		run("sqlite:responseTime", latencyCheck(true, h.infra.SQLite().Ping))
+		run("migrations:version", h.migrationCheck(h.infra.SQLite().MigrationVersion))
+	}
+	run("redis:responseTime", latencyCheck(true, h.infra.Redis().Ping))
+	// Emails are sent by retried jobs, so an unreachable mail server only warns
+	if pinger, ok := h.mail.(mailer.Pinger); ok {
+		run("smtp:responseTime", latencyCheck(false, pinger.Ping))
+	}
+	wg.Wait()
 
-	go func() {
-		errs <- h.infra.Redis().Ping(ctx)
-	}()
+	return checks
+}
 
-	return errors.Join(<-errs, <-errs)
+// latencyCheck pings a dependency and reports how long it took, failures of a dependency that
+// isn't critical only warn
+func latencyCheck(critical bool, ping func(context.Context) error) func(context.Context) healthCheck {
+	return func(ctx context.Context) healthCheck {
+		start := time.Now()
+		err := ping(ctx)
+		result := healthCheck{
+			ComponentType: "datastore",
+			ObservedValue: float64(time.Since(start).Microseconds()) / 1000,
+			ObservedUnit:  "ms",
+			Status:        healthPass,
+			Time:          start.UTC(),
+		}
+		if !critical {
+			result.ComponentType = "component"
+		}
+		if err != nil {
+			result.Status, result.Output = healthWarn, err.Error()
+			if critical {
+				result.Status = healthFail
+			}
+		}
+		return result
+	}
+}
+
+// migrationCheck fails while the schema is behind this build or a migration failed halfway,
+// schemas ahead of it are expected during rolling deployments
+func (h *HealthChecker) migrationCheck(version func(context.Context) (uint, bool, error)) func(context.Context) healthCheck {
+	return func(ctx context.Context) healthCheck {
+		result := healthCheck{ComponentType: "datastore", Status: healthPass, Time: time.Now().UTC()}
+		current, dirty, err := version(ctx)
+		switch {
+		case err != nil:
+			result.Status, result.Output = healthFail, err.Error()
+			return result
+		case dirty:
+			result.Status, result.Output = healthFail, fmt.Sprintf("migration %d is dirty", current)
+		case current < h.migration:
+			result.Status, result.Output = healthFail, fmt.Sprintf("schema is at migration %d, expected %d", current, h.migration)
+		}
+		result.ObservedValue = current
+		return result
+	}
 }
 
 func (h *HealthChecker) Handler(c *gin.Context) {
-	if err := h.check(c.Request.Context()); err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status": "fail",
-			"error":  err.Error(),
-		})
-		return
+	response := healthResponse{
+		Status:    healthPass,
+		Version:   buildinfo.Version,
+		ReleaseID: buildinfo.Commit,
+	}
+
+	// Fail while draining so load balancers stop routing new requests here
+	if h.draining() {
+		response.Status, response.Output = healthFail, "draining"
+		response.Checks = make(map[string][]healthCheck)
+	} else {
+		response.Checks = h.check(c.Request.Context())
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "pass",
-	})
+	for _, checks := range response.Checks {
+		for _, check := range checks {
+			if check.Status == healthFail || response.Status == healthPass {
+				response.Status = check.Status
+			}
+		}
+	}
+
+	response.Checks["uptime"] = []healthCheck{{
+		ComponentType: "system",
+		ObservedValue: time.Since(h.startedAt).Seconds(),
+		ObservedUnit:  "s",
+		Status:        healthPass,
+		Time:          time.Now().UTC(),
+	}}
+
+	status := http.StatusOK
+	if response.Status == healthFail {
+		status = http.StatusServiceUnavailable
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(status, "application/health+json", body)
 }
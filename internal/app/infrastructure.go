@@ -5,30 +5,48 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/prperemyshlev/auth-service-2/internal/config"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/memory"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/sqlite"
+	sqlitemigrations "github.com/prperemyshlev/auth-service-2/migrations/sqlite"
 	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/geoip"
 	"github.com/prperemyshlev/auth-service-2/pkg/observability"
 	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 )
 
 type Infrastructure interface {
+	// Postgres and SQLite return nil unless the database driver selects them
 	Postgres() *database.Postgres
+	SQLite() *database.SQLite
 	Redis() *database.Redis
+	Repositories() *repository.Repositories
 	Logger() *zap.Logger
+	// LogLevel is the level of Logger, changing it takes effect immediately
+	LogLevel() zap.AtomicLevel
 	MetricsHandler() http.Handler
 	MeterProvider() *metric.MeterProvider
+	GeoIP() geoip.Locator
 
 	Shutdown(ctx context.Context) error
 }
 
 type infrastructure struct {
 	postgres       *database.Postgres
+	sqlite         *database.SQLite
 	redis          *database.Redis
+	repositories   *repository.Repositories
 	logger         *zap.Logger
+	logLevel       zap.AtomicLevel
 	metricsHandler http.Handler
 	meterProvider  *metric.MeterProvider
+	geoIP          geoip.Locator
+	tracerProvider *trace.TracerProvider
 }
 
 var _ Infrastructure = &infrastructure{}
@@ -36,49 +54,186 @@ var _ Infrastructure = &infrastructure{}
 func NewInfrastructure(ctx context.Context, cfg config.Config) (*infrastructure, error) {
 	i := &infrastructure{}
 
-	logger, err := observability.InitLogger(cfg.Env)
+	logger, logLevel, err := observability.InitLoggerWithLevel(observability.LoggerConfig{
+		Env:    cfg.Env,
+		Level:  cfg.Log.Level,
+		Format: cfg.Log.Format,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 	i.logger = logger
+	i.logLevel = logLevel
 
-	postgres, err := database.NewPostgres(cfg.Postgres.DSN())
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	if cfg.Tracing.Enabled {
+		tracerProvider, err := observability.InitTracing(ctx, "auth-service", cfg.Tracing.Endpoint, cfg.Tracing.Insecure, cfg.Tracing.SampleRatio)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize tracing: %w", err)
+		}
+		i.tracerProvider = tracerProvider
 	}
-	i.postgres = postgres
 
-	redis, err := database.NewRedis(cfg.Redis.Address(), cfg.Redis.Password, cfg.Redis.DB)
-	if err != nil {
-		_ = i.postgres.Close()
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	if cfg.InMemoryStorage() {
+		if err := i.initMemoryStorage(); err != nil {
+			return nil, err
+		}
+		logger.Warn("In-memory storage is enabled, all data is lost on restart")
+	} else if err := i.initStorage(ctx, cfg); err != nil {
+		return nil, err
 	}
-	i.redis = redis
 
 	meterProvider, metricsHandler, err := observability.InitTelemetry("auth-service")
 	if err != nil {
-		_ = i.postgres.Close()
-		_ = i.redis.Close()
+		_ = i.closeStorage()
 		return nil, fmt.Errorf("failed to initialize telemetry: %w", err)
 	}
 	i.meterProvider = meterProvider
 	i.metricsHandler = metricsHandler
 
+	i.geoIP = geoip.Noop()
+	if cfg.GeoIP.Enabled {
+		locator, err := geoip.Open(cfg.GeoIP.DatabasePath)
+		switch {
+		case errors.Is(err, geoip.ErrDatabaseNotFound):
+			// Degrade gracefully, locations are an enrichment only
+			logger.Warn("GeoIP database not found, locations will not be resolved", zap.String("path", cfg.GeoIP.DatabasePath))
+		case err != nil:
+			_ = i.closeStorage()
+			return nil, fmt.Errorf("failed to initialize geoip: %w", err)
+		default:
+			i.geoIP = locator
+		}
+	}
+
 	return i, nil
 }
 
+// initStorage connects to the configured database and Redis
+// Connecting is retried for up to STARTUP_RETRY_MAX_WAIT, so the service may start before them.
+func (i *infrastructure) initStorage(ctx context.Context, cfg config.Config) error {
+	switch cfg.Database.Driver {
+	case config.DatabaseDriverSQLite:
+		if err := i.initSQLite(cfg.Database.SQLitePath); err != nil {
+			return err
+		}
+	default:
+		postgres, err := database.ConnectWithRetry(ctx, i.retryPolicy(cfg.Startup, "PostgreSQL"), func() (*database.Postgres, error) {
+			return database.NewPostgres(cfg.Postgres.DSN())
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+		}
+		i.postgres = postgres
+		i.repositories = repository.NewRepositories(postgres)
+	}
+
+	redisTLS, err := redisTLSConfig(cfg.Redis)
+	if err != nil {
+		_ = i.closeStorage()
+		return err
+	}
+	redis, err := database.ConnectWithRetry(ctx, i.retryPolicy(cfg.Startup, "Redis"), func() (*database.Redis, error) {
+		return database.NewRedis(cfg.Redis.Address(), cfg.Redis.Password, cfg.Redis.DB,
+			database.WithUsername(cfg.Redis.Username),
+			database.WithTLS(redisTLS),
+			database.WithRetries(cfg.Redis.MaxRetries, cfg.Redis.MinRetryBackoff.Duration, cfg.Redis.MaxRetryBackoff.Duration),
+			database.WithDialTimeout(cfg.Redis.DialTimeout.Duration),
+		)
+	})
+	if err != nil {
+		_ = i.closeStorage()
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	i.redis = redis
+
+	return nil
+}
+
+// retryPolicy returns the startup retry policy of a dependency, logging every failed attempt
+func (i *infrastructure) retryPolicy(cfg config.StartupConfig, dependency string) database.RetryPolicy {
+	return database.RetryPolicy{
+		InitialBackoff: cfg.RetryInitialBackoff.Duration,
+		MaxBackoff:     cfg.RetryMaxBackoff.Duration,
+		MaxWait:        cfg.RetryMaxWait.Duration,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			i.logger.Warn(dependency+" is not available yet, retrying",
+				zap.Int("attempt", attempt),
+				zap.Duration("delay", delay),
+				zap.Error(err),
+			)
+		},
+	}
+}
+
+// initSQLite opens the SQLite database at path and brings its schema up to date
+func (i *infrastructure) initSQLite(path string) error {
+	db, err := database.NewSQLite(path)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+
+	if err := db.Migrate(sqlitemigrations.FS); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("failed to migrate SQLite database: %w", err)
+	}
+
+	i.sqlite = db
+	i.repositories = sqlite.NewRepositories(db)
+	return nil
+}
+
+// initMemoryStorage keeps repositories in memory and starts an in-process Redis,
+// so token blacklist, rate limits and jobs work unchanged without external dependencies
+func (i *infrastructure) initMemoryStorage() error {
+	redis, err := database.NewInMemoryRedis()
+	if err != nil {
+		return fmt.Errorf("failed to start in-memory Redis: %w", err)
+	}
+	i.redis = redis
+
+	i.repositories = memory.NewRepositories()
+	return nil
+}
+
+// closeStorage closes the connections opened by initStorage or initMemoryStorage
+func (i *infrastructure) closeStorage() error {
+	var errs []error
+	if i.postgres != nil {
+		errs = append(errs, i.postgres.Close())
+	}
+	if i.sqlite != nil {
+		errs = append(errs, i.sqlite.Close())
+	}
+	if i.redis != nil {
+		errs = append(errs, i.redis.Close())
+	}
+	return errors.Join(errs...)
+}
+
 func (i *infrastructure) Postgres() *database.Postgres {
 	return i.postgres
 }
 
+func (i *infrastructure) SQLite() *database.SQLite {
+	return i.sqlite
+}
+
 func (i *infrastructure) Redis() *database.Redis {
 	return i.redis
 }
 
+func (i *infrastructure) Repositories() *repository.Repositories {
+	return i.repositories
+}
+
 func (i *infrastructure) Logger() *zap.Logger {
 	return i.logger
 }
 
+func (i *infrastructure) LogLevel() zap.AtomicLevel {
+	return i.logLevel
+}
+
 func (i *infrastructure) MetricsHandler() http.Handler {
 	return i.metricsHandler
 }
@@ -87,13 +242,18 @@ func (i *infrastructure) MeterProvider() *metric.MeterProvider {
 	return i.meterProvider
 }
 
+func (i *infrastructure) GeoIP() geoip.Locator {
+	return i.geoIP
+}
+
 func (i *infrastructure) Shutdown(ctx context.Context) error {
-	errs := make(chan error, 4)
+	errs := make(chan error, 5)
 
-	go func() { errs <- i.postgres.Close() }()
-	go func() { errs <- i.redis.Close() }()
+	go func() { errs <- i.closeStorage() }()
 	go func() { errs <- i.logger.Sync() }()
 	go func() { errs <- observability.Shutdown(ctx, i.meterProvider, i.logger) }()
+	go func() { errs <- i.geoIP.Close() }()
+	go func() { errs <- observability.ShutdownTracing(ctx, i.tracerProvider) }()
 
-	return errors.Join(<-errs, <-errs, <-errs, <-errs)
+	return errors.Join(<-errs, <-errs, <-errs, <-errs, <-errs)
 }
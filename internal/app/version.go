@@ -0,0 +1,43 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/buildinfo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const buildInfoMeterName = "github.com/prperemyshlev/auth-service-2/internal/app"
+
+// registerBuildInfo exports a build_info gauge, always 1, labeled with the build information,
+// so that dashboards can correlate changes with deployments
+func registerBuildInfo(meterProvider metric.MeterProvider) error {
+	info := buildinfo.Get()
+	attributes := metric.WithAttributes(
+		attribute.String("version", info.Version),
+		attribute.String("commit", info.Commit),
+		attribute.String("build_date", info.Date),
+		attribute.String("go_version", info.GoVersion),
+	)
+
+	_, err := meterProvider.Meter(buildInfoMeterName).Int64ObservableGauge("build_info",
+		metric.WithDescription("Build information of the running binary, always 1"),
+		metric.WithInt64Callback(func(_ context.Context, observer metric.Int64Observer) error {
+			observer.Observe(1, attributes)
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create build info gauge: %w", err)
+	}
+	return nil
+}
+
+// versionHandler returns the build information of the running binary
+func versionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, buildinfo.Get())
+}
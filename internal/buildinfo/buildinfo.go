@@ -0,0 +1,60 @@
+// Package buildinfo holds the version of the running binary, injected at build time with
+//
+//	-ldflags "-X github.com/prperemyshlev/auth-service-2/internal/buildinfo.Version=1.2.0 -X github.com/prperemyshlev/auth-service-2/internal/buildinfo.Commit=$(git rev-parse HEAD) -X github.com/prperemyshlev/auth-service-2/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// make build sets all of them.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	// Version is the semantic version of the release
+	Version = "dev"
+	// Commit is the git commit the binary was built from, taken from the VCS information
+	// embedded by go build when not injected
+	Commit = ""
+	// Date is when the binary was built in RFC 3339, the commit time when not injected
+	Date = ""
+)
+
+// Info describes the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+}
+
+func init() {
+	commit, date := "unknown", "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				commit = setting.Value
+			case "vcs.time":
+				date = setting.Value
+			}
+		}
+	}
+
+	if Commit == "" {
+		Commit = commit
+	}
+	if Date == "" {
+		Date = date
+	}
+}
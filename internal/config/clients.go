@@ -0,0 +1,34 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ClientSecrets maps client IDs to their secrets
+type ClientSecrets map[string]string
+
+// EnvDecode implements envconfig.Decoder to parse clients in the form
+// "client_id=secret,client_id=secret"
+func (s *ClientSecrets) EnvDecode(ctx context.Context, v string) error {
+	clients := make(ClientSecrets)
+
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(entry, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || strings.TrimSpace(secret) == "" {
+			return fmt.Errorf("invalid client %q: expected client_id=secret", id)
+		}
+
+		clients[id] = strings.TrimSpace(secret)
+	}
+
+	*s = clients
+	return nil
+}
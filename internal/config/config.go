@@ -3,25 +3,179 @@ package config
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 )
 
 type Config struct {
 	Server   ServerConfig   `env:",prefix=SERVER_"`
+	Internal InternalConfig `env:",prefix=INTERNAL_"`
+	Debug    DebugConfig    `env:",prefix=DEBUG_"`
+	Database DatabaseConfig `env:",prefix=DATABASE_"`
 	Postgres PostgresConfig `env:",prefix=POSTGRES_"`
 	Redis    RedisConfig    `env:",prefix=REDIS_"`
+	// Startup waits for PostgreSQL and Redis to come up
+	Startup  StartupConfig  `env:",prefix=STARTUP_"`
 	JWT      JWTConfig      `env:",prefix=JWT_"`
+	Session  SessionConfig  `env:",prefix=SESSION_"`
 	Security SecurityConfig `env:",prefix="`
 	CORS     CORSConfig     `env:",prefix=CORS_"`
-	Env      string         `env:"ENV,default=development"`
+	Captcha  CaptchaConfig  `env:",prefix=CAPTCHA_"`
+	// Enumeration protects public endpoints from revealing which accounts exist
+	Enumeration EnumerationConfig `env:",prefix=ENUMERATION_"`
+	// LoginThrottle delays logins after consecutive failures of the account
+	LoginThrottle LoginThrottleConfig `env:",prefix=LOGIN_THROTTLE_"`
+	IPFilter      IPFilterConfig      `env:",prefix=IP_FILTER_"`
+	Cookie        CookieConfig        `env:",prefix=COOKIE_"`
+	Admin         AdminConfig         `env:",prefix=ADMIN_"`
+	Erasure       ErasureConfig       `env:",prefix=ERASURE_"`
+	Unverified    UnverifiedConfig    `env:",prefix=UNVERIFIED_"`
+	Consent       ConsentConfig       `env:",prefix=CONSENT_"`
+	Invitation    InvitationConfig    `env:",prefix=INVITATION_"`
+	// DeviceBinding binds refresh tokens to the device they were issued to
+	DeviceBinding DeviceBindingConfig `env:",prefix=DEVICE_BINDING_"`
+	GeoIP         GeoIPConfig         `env:",prefix=GEOIP_"`
+	Tracing       TracingConfig       `env:",prefix=TRACING_"`
+	Log           LogConfig           `env:",prefix=LOG_"`
+	// Audit exports security events to a SIEM
+	Audit   AuditConfig   `env:",prefix=AUDIT_"`
+	Email   EmailConfig   `env:",prefix=EMAIL_"`
+	Mailer  MailerConfig  `env:",prefix=MAILER_"`
+	Jobs    JobsConfig    `env:",prefix=JOBS_"`
+	Docs    DocsConfig    `env:",prefix=DOCS_"`
+	API     APIConfig     `env:",prefix=API_"`
+	GraphQL GraphQLConfig `env:",prefix=GRAPHQL_"`
+	// FeatureFlags are the defaults of feature flags, the admin API changes them at runtime
+	FeatureFlags FeatureFlagsConfig `env:",prefix=FEATURE_FLAGS_"`
+	// Tenants are managed through the admin API, requests name theirs with the X-Tenant-ID header
+	Tenants TenantsConfig `env:",prefix=TENANTS_"`
+	// Redirect is the allow-list of URLs flows send users back to, tenants replace it with theirs
+	Redirect RedirectConfig `env:",prefix=REDIRECT_"`
+	// OAuth signs users in with OAuth providers, a provider is enabled once its client ID is set
+	OAuth OAuthConfig `env:",prefix=OAUTH_"`
+	// Recovery lets users who lost access to their email change it after signing in with a linked provider
+	Recovery RecoveryConfig `env:",prefix=RECOVERY_"`
+	// Kerberos signs users of domain-joined browsers in with SPNEGO, enabled once a keytab is set
+	Kerberos KerberosConfig `env:",prefix=KERBEROS_"`
+	// SIWE signs users in with Ethereum wallets (EIP-4361), enabled once a domain is set
+	SIWE SIWEConfig `env:",prefix=SIWE_"`
+	// Encryption encrypts sensitive columns, e.g. MFA secrets and tokens of OAuth providers
+	Encryption EncryptionConfig `env:",prefix=ENCRYPTION_"`
+	// ShadowIdP mirrors registrations and logins to an identity provider the service may be replaced by
+	ShadowIdP ShadowIdPConfig `env:",prefix=SHADOW_IDP_"`
+	// ExtAuthz answers the external authorization filter of Envoy on the internal listener
+	ExtAuthz ExtAuthzConfig `env:",prefix=EXT_AUTHZ_"`
+	// TokenRevocation authenticates the clients of the RFC 7009 revocation endpoint
+	TokenRevocation TokenRevocationConfig `env:",prefix=TOKEN_REVOCATION_"`
+	// AccountEvents receives the account deletion and revocation notifications of Apple and Google
+	AccountEvents AccountEventsConfig `env:",prefix=ACCOUNT_EVENTS_"`
+	// Features turns off features, e.g. registration during a closed beta
+	Features FeaturesConfig `env:",prefix="`
+	// DevStorage replaces Postgres and Redis for local development, see DevStorageMemory
+	DevStorage string `env:"DEV_STORAGE"`
+	Env        string `env:"ENV,default=development"`
 }
 
+// DevStorageMemory keeps all data in process memory, so the service runs without external dependencies
+const DevStorageMemory = "memory"
+
 type ServerConfig struct {
 	Port         string   `env:"PORT,default=8080"`
 	Host         string   `env:"HOST,default=0.0.0.0"`
 	ReadTimeout  Duration `env:"READ_TIMEOUT,default=15s"`
 	WriteTimeout Duration `env:"WRITE_TIMEOUT,default=15s"`
+	// DrainTimeout bounds the wait for in-flight requests on shutdown
+	DrainTimeout Duration `env:"DRAIN_TIMEOUT,default=30s"`
+	// DrainDelay keeps the listener open after /health starts failing,
+	// giving load balancers time to take the instance out of rotation
+	DrainDelay Duration `env:"DRAIN_DELAY,default=0s"`
+}
+
+// InternalConfig is the listener of operational endpoints (/metrics, /health)
+// that must not be reachable through the public load balancer
+type InternalConfig struct {
+	// Port enables the internal listener, the endpoints stay on the public listener when empty
+	Port string `env:"PORT,default="`
+	Host string `env:"HOST,default=0.0.0.0"`
+	// TLSCertPath and TLSKeyPath serve the internal listener over TLS
+	TLSCertPath string `env:"TLS_CERT_PATH,default="`
+	TLSKeyPath  string `env:"TLS_KEY_PATH,default="`
+	// TLSClientCAPath enables mutual TLS: callers presenting a client certificate signed by
+	// these CAs reach introspection and the admin API on the internal listener
+	TLSClientCAPath string `env:"TLS_CLIENT_CA_PATH,default="`
+	// AllowedSPIFFEIDs restricts mutual TLS callers to these SPIFFE IDs or ID prefixes,
+	// e.g. spiffe://example.org/ns/prod, any verified certificate is accepted when empty
+	AllowedSPIFFEIDs []string `env:"ALLOWED_SPIFFE_IDS,default="`
+}
+
+// Enabled reports whether operational endpoints are served on a separate listener
+func (i InternalConfig) Enabled() bool {
+	return i.Port != ""
+}
+
+// TLSEnabled reports whether the internal listener serves TLS
+func (i InternalConfig) TLSEnabled() bool {
+	return i.TLSCertPath != ""
+}
+
+// MTLSEnabled reports whether internal callers can authenticate with client certificates
+func (i InternalConfig) MTLSEnabled() bool {
+	return i.TLSClientCAPath != ""
+}
+
+// ExtAuthzConfig serves the HTTP service of the Envoy ext_authz filter, so that the mesh edge
+// checks access tokens with the service itself
+type ExtAuthzConfig struct {
+	Enabled bool `env:"ENABLED,default=false"`
+	// PathPrefix is the path_prefix of the http_service, Envoy appends the path of the checked request
+	PathPrefix string `env:"PATH_PREFIX,default=/ext_authz"`
+	// Cookie names a cookie carrying the access token, read when there is no Authorization header
+	Cookie string `env:"COOKIE,default="`
+}
+
+// TokenRevocationConfig configures POST /api/v1/oauth/revoke
+type TokenRevocationConfig struct {
+	// Clients may revoke any token of the service, the endpoint is disabled when empty
+	Clients ClientSecrets `env:"CLIENTS,default="`
+}
+
+// AccountEventsConfig configures POST /api/v1/oauth/events/:provider, the receiver of a provider is
+// served once its client IDs are set
+type AccountEventsConfig struct {
+	// AppleClientIDs are the Services IDs and bundle IDs of Sign in with Apple notifications are sent for
+	AppleClientIDs []string `env:"APPLE_CLIENT_IDS,default="`
+	// GoogleClientIDs are the OAuth client IDs of the project receiving Cross-Account Protection events
+	GoogleClientIDs []string `env:"GOOGLE_CLIENT_IDS,default="`
+	// Deactivate deactivates users whose provider account was deleted, connections are unlinked anyway
+	Deactivate bool `env:"DEACTIVATE,default=false"`
+}
+
+// Enabled reports whether the receiver of any provider is served
+func (a AccountEventsConfig) Enabled() bool {
+	return len(a.AppleClientIDs) > 0 || len(a.GoogleClientIDs) > 0
+}
+
+type DebugConfig struct {
+	// Enabled serves pprof, runtime stats and the log level endpoint on the internal listener
+	Enabled bool `env:"ENABLED,default=false"`
+}
+
+// Supported DATABASE_DRIVER values
+const (
+	DatabaseDriverPostgres = "postgres"
+	// DatabaseDriverSQLite requires a binary built with the sqlite tag
+	DatabaseDriverSQLite = "sqlite"
+)
+
+type DatabaseConfig struct {
+	Driver string `env:"DRIVER,default=postgres"`
+	// SQLitePath is the database file of the sqlite driver, migrations are applied on startup
+	SQLitePath string `env:"SQLITE_PATH,default=auth-service.db"`
+	// SlowQueryThreshold logs repository operations taking at least as long, 0 disables the logging
+	SlowQueryThreshold Duration `env:"SLOW_QUERY_THRESHOLD,default=200ms"`
 }
 
 type PostgresConfig struct {
@@ -31,6 +185,20 @@ type PostgresConfig struct {
 	Password string `env:"PASSWORD,default=auth_service_password"`
 	DBName   string `env:"DB,default=auth_service_db"`
 	SSLMode  string `env:"SSLMODE,default=disable"`
+	// SSLRootCert verifies the server with these CAs, for sslmode verify-ca and verify-full
+	SSLRootCert string `env:"SSLROOTCERT,default="`
+	// SSLCert and SSLKey present a client certificate
+	SSLCert string `env:"SSLCERT,default="`
+	SSLKey  string `env:"SSLKEY,default="`
+	// StatementTimeout aborts statements running longer, 0 keeps the server default
+	StatementTimeout Duration `env:"STATEMENT_TIMEOUT,default=0s"`
+	// ApplicationName is shown in pg_stat_activity and the server logs
+	ApplicationName string `env:"APPLICATION_NAME,default="`
+	// SearchPath sets the schemas looked up for the tables of the service, e.g. auth,public
+	SearchPath string `env:"SEARCH_PATH,default="`
+	// URL replaces the connection string built from the settings above, as a postgres:// URL or
+	// key=value pairs, for managed databases needing parameters not covered by them
+	URL string `env:"URL,default="`
 }
 
 type RedisConfig struct {
@@ -38,30 +206,440 @@ type RedisConfig struct {
 	Port     string `env:"PORT,default=6379"`
 	Password string `env:"PASSWORD,default="`
 	DB       int    `env:"DB,default=0"`
+	// Username authenticates with REDIS_PASSWORD as an ACL user (Redis 6+), the default user when empty
+	Username string `env:"USERNAME,default="`
+	// MaxRetries retries commands failing with network errors, with backoff between the bounds
+	MaxRetries      int      `env:"MAX_RETRIES,default=3"`
+	MinRetryBackoff Duration `env:"MIN_RETRY_BACKOFF,default=8ms"`
+	MaxRetryBackoff Duration `env:"MAX_RETRY_BACKOFF,default=512ms"`
+	DialTimeout     Duration `env:"DIAL_TIMEOUT,default=5s"`
+	// TLSEnabled connects over TLS, as managed offerings such as ElastiCache and Azure Cache require
+	TLSEnabled bool `env:"TLS_ENABLED,default=false"`
+	// TLSCAPath verifies the server with these CAs instead of the system ones
+	TLSCAPath string `env:"TLS_CA_PATH,default="`
+	// TLSCertPath and TLSKeyPath present a client certificate
+	TLSCertPath string `env:"TLS_CERT_PATH,default="`
+	TLSKeyPath  string `env:"TLS_KEY_PATH,default="`
+	// TLSInsecureSkipVerify accepts any server certificate, only meant for testing
+	TLSInsecureSkipVerify bool `env:"TLS_INSECURE_SKIP_VERIFY,default=false"`
+}
+
+// StartupConfig configures connection attempts on startup
+// Delays double from RetryInitialBackoff up to RetryMaxBackoff, the service gives up after
+// RetryMaxWait, 0 fails at once when a dependency is not available.
+type StartupConfig struct {
+	RetryMaxWait        Duration `env:"RETRY_MAX_WAIT,default=60s"`
+	RetryInitialBackoff Duration `env:"RETRY_INITIAL_BACKOFF,default=500ms"`
+	RetryMaxBackoff     Duration `env:"RETRY_MAX_BACKOFF,default=10s"`
 }
 
 type JWTConfig struct {
-	Secret             string   `env:"SECRET,required"`
-	AccessTokenExpiry  Duration `env:"ACCESS_TOKEN_EXPIRY,default=15m"`
+	Secret string `env:"SECRET"`
+	// PreviousSecrets keep validating tokens after JWT_SECRET is replaced, until they expire
+	PreviousSecrets []string `env:"PREVIOUS_SECRETS,default="`
+	// Keyring is "config" to sign with JWT_SECRET, or "redis" to rotate secrets at runtime through
+	// the admin API, synchronized by Redis and reloaded every KeyringReloadInterval
+	Keyring               string   `env:"KEYRING,default=config"`
+	KeyringReloadInterval Duration `env:"KEYRING_RELOAD_INTERVAL,default=1m"`
+	AccessTokenExpiry     Duration `env:"ACCESS_TOKEN_EXPIRY,default=15m"`
+	// AccessTokenFormat is "jwt" for self-contained tokens or "opaque" for random tokens
+	// validated by lookup in Redis, refresh tokens are JWTs either way
+	AccessTokenFormat  string   `env:"ACCESS_TOKEN_FORMAT,default=jwt"`
 	RefreshTokenExpiry Duration `env:"REFRESH_TOKEN_EXPIRY,default=7d"`
+	// Issuer and Audience are set as iss and aud claims and required on validated tokens,
+	// so tokens can't be replayed across environments sharing a secret
+	Issuer   string   `env:"ISSUER"`
+	Audience []string `env:"AUDIENCE,default="`
+	// Leeway tolerates clock skew of clients and other instances when validating exp, iat and nbf
+	Leeway Duration `env:"LEEWAY,default=30s"`
+	// ExpiryGrace additionally accepts access tokens expired for less than it on read-only routes,
+	// so that requests racing with a refresh don't fail; 0 turns it off
+	ExpiryGrace Duration `env:"EXPIRY_GRACE,default=0s"`
+	// ValidationCacheTTL keeps validated access tokens in memory, skipping Redis checks for that long;
+	// entries are dropped on revocation through pub/sub. 0 turns the cache off
+	ValidationCacheTTL Duration `env:"VALIDATION_CACHE_TTL,default=0s"`
+	// ValidationCacheSize is the number of tokens cached, the least recently used are dropped
+	ValidationCacheSize int `env:"VALIDATION_CACHE_SIZE,default=10000"`
+}
+
+// SessionConfig bounds the concurrent sessions (refresh tokens) of users
+type SessionConfig struct {
+	// MaxPerUser is the maximum number of concurrent sessions of a user, the oldest ones are ended
+	// on login once it is exceeded; 0 is unlimited
+	MaxPerUser int `env:"MAX_PER_USER,default=50"`
+	// HistoryRetention is how long expired and revoked refresh tokens are kept for investigations
+	HistoryRetention Duration `env:"HISTORY_RETENTION,default=30d"`
+	// CleanupInterval is how often tokens past the retention are purged
+	CleanupInterval Duration `env:"CLEANUP_INTERVAL,default=1h"`
+	// NewDeviceAlerts emails users about logins from devices or countries none of their sessions is from
+	NewDeviceAlerts bool `env:"NEW_DEVICE_ALERTS,default=false"`
 }
 
 type SecurityConfig struct {
-	BCryptCost        int      `env:"BCRYPT_COST,default=12"`
-	RateLimitRequests int      `env:"RATE_LIMIT_REQUESTS,default=10"`
-	RateLimitWindow   Duration `env:"RATE_LIMIT_WINDOW,default=1m"`
+	BCryptCost int `env:"BCRYPT_COST,default=12"`
+	// BCryptConcurrency bounds simultaneous hashing, 0 uses the number of CPUs
+	BCryptConcurrency int `env:"BCRYPT_CONCURRENCY,default=0"`
+	// BCryptQueueSize is how many hashing operations may wait for a slot before requests fail with 503
+	BCryptQueueSize   int               `env:"BCRYPT_QUEUE_SIZE,default=100"`
+	RateLimitRequests int               `env:"RATE_LIMIT_REQUESTS,default=10"`
+	RateLimitWindow   Duration          `env:"RATE_LIMIT_WINDOW,default=1m"`
+	RateLimitPolicies RateLimitPolicies `env:"RATE_LIMIT_POLICIES,default=/api/v1/auth/refresh=5/1m/ip,/api/v1/auth/forgot-password=3/15m/ip,/api/v1/auth/username-available=30/1m/ip,/graphql=60/1m/ip"`
+	// RateLimitRestrictedPercent is the share of each rate limit granted to users an admin limited
+	RateLimitRestrictedPercent int `env:"RATE_LIMIT_RESTRICTED_PERCENT,default=20"`
+	// RequestTimeout applies to API routes without an entry in RequestTimeouts
+	RequestTimeout Duration `env:"REQUEST_TIMEOUT,default=5s"`
+	// RequestTimeouts gives routes hashing passwords a longer budget and cheap reads a shorter one
+	RequestTimeouts RouteTimeouts `env:"REQUEST_TIMEOUTS,default=/api/v1/auth/register=10s,/api/v1/auth/login=10s,/api/v1/auth/me=2s,/api/v1/admin/users/import=10s"`
+	// TrustedProxies lists proxy IPs/CIDRs allowed to set X-Forwarded-For; empty trusts none
+	TrustedProxies []string `env:"TRUSTED_PROXIES,default="`
 }
 
 type CORSConfig struct {
+	// AllowedOrigins are origins like https://app.example.com, https://*.example.com for its subdomains, or * for any
 	AllowedOrigins []string `env:"ALLOWED_ORIGINS,default=http://localhost:3000"`
-	AllowedMethods []string `env:"ALLOWED_METHODS,default=GET,POST,PUT,DELETE,OPTIONS"`
-	AllowedHeaders []string `env:"ALLOWED_HEADERS,default=Content-Type,Authorization"`
+	AllowedMethods []string `env:"ALLOWED_METHODS,default=GET,POST,PUT,PATCH,DELETE,OPTIONS"`
+	AllowedHeaders []string `env:"ALLOWED_HEADERS,default=Content-Type,Authorization,X-Captcha-Token,Accept-Language,X-Device-ID,X-Tenant-ID"`
+	// ExposedHeaders are readable by scripts, e.g. the rate limit headers to back off before a 429
+	ExposedHeaders []string `env:"EXPOSED_HEADERS,default=RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,X-RateLimit-Limit,X-RateLimit-Remaining,Retry-After,X-Request-ID"`
+	// MaxAge is how long browsers cache preflight responses, 0 omits Access-Control-Max-Age
+	MaxAge Duration `env:"MAX_AGE,default=10m"`
+	// RouteOrigins replace AllowedOrigins for paths under a prefix, the longest matching prefix applies
+	RouteOrigins RouteOrigins `env:"ROUTE_ORIGINS,default="`
+}
+
+// CookieConfig applies to the API v1 refresh token cookie
+type CookieConfig struct {
+	// Secure restricts the cookie to HTTPS, required in production
+	Secure bool   `env:"SECURE,default=true"`
+	Domain string `env:"DOMAIN,default="`
+}
+
+type CaptchaConfig struct {
+	Provider string   `env:"PROVIDER,default=none"`
+	Secret   string   `env:"SECRET,default="`
+	MinScore float64  `env:"MIN_SCORE,default=0.5"`
+	Routes   []string `env:"ROUTES,default=/api/v1/auth/register,/api/v1/auth/login,/api/v1/auth/forgot-password"`
+}
+
+// EnumerationConfig is the anti-enumeration policy of endpoints looking accounts up by email or username
+type EnumerationConfig struct {
+	// UniformResponses answers the same, in the same time, whether or not an account exists
+	UniformResponses bool `env:"UNIFORM_RESPONSES,default=true"`
+	// TargetLimit and IPLimit bound lookups per email or username and per client IP, 0 disables them
+	TargetLimit int      `env:"TARGET_LIMIT,default=10"`
+	IPLimit     int      `env:"IP_LIMIT,default=100"`
+	Window      Duration `env:"WINDOW,default=15m"`
+}
+
+// LoginThrottleConfig configures progressive login delays per account
+type LoginThrottleConfig struct {
+	// Delays is the delay of a login after 0, 1, 2... consecutive failures, the last one applies to
+	// further failures; empty disables throttling
+	Delays []Duration `env:"DELAYS,default=0s,1s,2s,5s"`
+	// Window is how long failures are remembered after the last one
+	Window Duration `env:"WINDOW,default=15m"`
+}
+
+type IPFilterConfig struct {
+	Enabled        bool     `env:"ENABLED,default=true"`
+	ReloadInterval Duration `env:"RELOAD_INTERVAL,default=1m"`
+}
+
+type AdminConfig struct {
+	APIToken string `env:"API_TOKEN,default="`
+	// StatsCacheTTL is how long the statistics of the admin dashboard are cached in Redis
+	StatsCacheTTL Duration `env:"STATS_CACHE_TTL,default=1m"`
+}
+
+// ErasureConfig configures the erasure of users on request, the right to be forgotten
+type ErasureConfig struct {
+	// Mode is delete to delete user rows or anonymize to keep them stripped of personal data
+	Mode string `env:"MODE,default=delete"`
+	// GracePeriod delays erasures requested by users, who can cancel them meanwhile, 0 erases at once
+	GracePeriod   Duration `env:"GRACE_PERIOD,default=168h"`
+	SweepInterval Duration `env:"SWEEP_INTERVAL,default=1h"`
+}
+
+// UnverifiedConfig is the retention policy of accounts whose email was never verified
+type UnverifiedConfig struct {
+	// ExpiryDays is the age at which unverified accounts expire, 0 keeps them; users are warned by
+	// email two days before
+	ExpiryDays int `env:"EXPIRY_DAYS,default=0"`
+	// Action is delete to erase expired accounts or deactivate to keep their row deactivated
+	Action        string   `env:"ACTION,default=delete"`
+	SweepInterval Duration `env:"SWEEP_INTERVAL,default=1h"`
+}
+
+// ConsentConfig holds the published versions of the policy documents users must accept
+// A document with an empty version is not required
+type ConsentConfig struct {
+	TermsVersion   string `env:"TERMS_VERSION,default="`
+	PrivacyVersion string `env:"PRIVACY_VERSION,default="`
+}
+
+// InvitationConfig configures signup invitations
+type InvitationConfig struct {
+	// Required makes registration invite-only
+	Required bool `env:"REQUIRED,default=false"`
+	// AllowUsers lets any user invite, otherwise only admins can
+	AllowUsers bool     `env:"ALLOW_USERS,default=false"`
+	TTL        Duration `env:"TTL,default=168h"`
+}
+
+// DeviceBindingConfig configures the binding of refresh tokens to devices
+type DeviceBindingConfig struct {
+	// Mode is "off", "log" to only log refresh attempts from another device or "enforce" to reject them
+	Mode string `env:"MODE,default=off"`
+}
+
+type GeoIPConfig struct {
+	Enabled      bool   `env:"ENABLED,default=false"`
+	DatabasePath string `env:"DATABASE_PATH,default=/usr/share/GeoIP/GeoLite2-City.mmdb"`
+}
+
+type TracingConfig struct {
+	Enabled     bool    `env:"ENABLED,default=false"`
+	Endpoint    string  `env:"ENDPOINT,default=localhost:4318"`
+	Insecure    bool    `env:"INSECURE,default=true"`
+	SampleRatio float64 `env:"SAMPLE_RATIO,default=1.0"`
+}
+
+type LogConfig struct {
+	// Level and Format default to info/json in production and debug/console otherwise
+	Level         string   `env:"LEVEL,default="`
+	Format        string   `env:"FORMAT,default="`
+	SampledRoutes []string `env:"SAMPLED_ROUTES,default=/health,/metrics"`
+	SampleRate    int      `env:"SAMPLE_RATE,default=100"`
+}
+
+// AuditConfig configures the export of security events to a SIEM
+type AuditConfig struct {
+	// Sink is none, syslog or http
+	Sink string `env:"SINK,default=none"`
+	// Format of syslog messages, cef or leef
+	Format        string `env:"FORMAT,default=cef"`
+	SyslogNetwork string `env:"SYSLOG_NETWORK,default=udp"`
+	SyslogAddress string `env:"SYSLOG_ADDRESS,default="`
+	HTTPURL       string `env:"HTTP_URL,default="`
+	HTTPToken     string `env:"HTTP_TOKEN,default="`
+	// BufferSize bounds queued events, events are dropped while the SIEM can't keep up
+	BufferSize    int      `env:"BUFFER_SIZE,default=10000"`
+	BatchSize     int      `env:"BATCH_SIZE,default=100"`
+	FlushInterval Duration `env:"FLUSH_INTERVAL,default=1s"`
+}
+
+type EmailConfig struct {
+	// Domains where "+tags" and dots in the local part are ignored for uniqueness, "*" matches all
+	NormalizePlusDomains []string `env:"NORMALIZE_PLUS_DOMAINS,default=gmail.com,googlemail.com"`
+	NormalizeDotDomains  []string `env:"NORMALIZE_DOT_DOMAINS,default=gmail.com,googlemail.com"`
+	// VerificationPolicy is "off", "block" to refuse logins of users with an unverified email or
+	// "restrict" to let them log in but refuse routes requiring a verified email
+	VerificationPolicy string `env:"VERIFICATION_POLICY,default=off"`
+	// AllowedDomains restricts registration to emails of these domains, *.example.com matches the
+	// subdomains of example.com; anyone may register when empty. Tenants may have their own.
+	AllowedDomains []string `env:"ALLOWED_DOMAINS,default="`
+}
+
+type MailerConfig struct {
+	// Provider is one of none, smtp, ses, sendgrid
+	Provider       string `env:"PROVIDER,default=none"`
+	From           string `env:"FROM,default="`
+	SMTPHost       string `env:"SMTP_HOST,default="`
+	SMTPPort       string `env:"SMTP_PORT,default=587"`
+	SMTPUsername   string `env:"SMTP_USERNAME,default="`
+	SMTPPassword   string `env:"SMTP_PASSWORD,default="`
+	SESRegion      string `env:"SES_REGION,default="`
+	SendGridAPIKey string `env:"SENDGRID_API_KEY,default="`
+	DefaultLocale  string `env:"DEFAULT_LOCALE,default=en"`
 }
 
-// DSN returns PostgreSQL connection string
+type JobsConfig struct {
+	Workers      int      `env:"WORKERS,default=4"`
+	MaxAttempts  int      `env:"MAX_ATTEMPTS,default=5"`
+	RetryBackoff Duration `env:"RETRY_BACKOFF,default=10s"`
+}
+
+type DocsConfig struct {
+	// Enabled serves /swagger/index.html and /openapi.json, never in production
+	Enabled bool `env:"ENABLED,default=true"`
+}
+
+type APIConfig struct {
+	// V1Sunset is the planned removal date of API v1 (RFC 3339) announced in the Sunset header
+	V1Sunset time.Time `env:"V1_SUNSET"`
+}
+
+// FeaturesConfig enables features, routes of disabled ones respond 404 with the feature_disabled code
+type FeaturesConfig struct {
+	// Registration is turned off e.g. for a closed beta, users can still be imported by admins
+	Registration bool `env:"REGISTRATION_ENABLED,default=true"`
+	// PasswordLogin is turned off for SSO-only deployments, issued tokens can still be refreshed
+	PasswordLogin bool `env:"PASSWORD_LOGIN_ENABLED,default=true"`
+	Organizations bool `env:"ORGANIZATIONS_ENABLED,default=true"`
+	OAuth         bool `env:"OAUTH_ENABLED,default=true"`
+}
+
+type GraphQLConfig struct {
+	Enabled bool `env:"ENABLED,default=false"`
+}
+
+// FeatureFlagsConfig configures feature flags consulted by the service and exposed in tokens
+type FeatureFlagsConfig struct {
+	// Defaults turns flags on, off or on for a percentage of users, e.g. "magic_links=on,v2_responses=25%"
+	Defaults FeatureFlagDefaults `env:"DEFAULTS,default="`
+	// Claims lists flags set in the features claim of access tokens of users they are on for
+	Claims []string `env:"CLAIMS,default="`
+	// ReloadInterval is how often flags changed at runtime are reloaded besides change notifications
+	ReloadInterval Duration `env:"RELOAD_INTERVAL,default=1m"`
+}
+
+type TenantsConfig struct {
+	// CacheTTL is how long tenants are cached in Redis, changes through the admin API apply at once
+	CacheTTL Duration `env:"CACHE_TTL,default=5m"`
+}
+
+type RedirectConfig struct {
+	// AllowedURLs are the URLs, and paths below them, that OAuth callbacks, magic links and email
+	// verification may redirect to for requests without a tenant. The first one is the default.
+	AllowedURLs []string `env:"ALLOWED_URLS,default="`
+	// ChangePasswordURL is the change-password page of the frontend /.well-known/change-password
+	// redirects password managers to, the route isn't served when empty
+	ChangePasswordURL string `env:"CHANGE_PASSWORD_URL,default="`
+}
+
+type OAuthConfig struct {
+	GitHub OAuthProviderConfig `env:",prefix=GITHUB_"`
+	GitLab OAuthProviderConfig `env:",prefix=GITLAB_"`
+	// StateTTL is how long users have to sign in at the provider
+	StateTTL Duration `env:"STATE_TTL,default=10m"`
+}
+
+// RecoveryConfig configures the risk checks of account recovery
+type RecoveryConfig struct {
+	// MinLinkAge is how long a provider account must have been linked to recover the account with it
+	MinLinkAge Duration `env:"MIN_LINK_AGE,default=168h"`
+	// MaxAttempts limits the email changes of a user per AttemptWindow, 0 turns the limit off
+	MaxAttempts   int      `env:"MAX_ATTEMPTS,default=3"`
+	AttemptWindow Duration `env:"ATTEMPT_WINDOW,default=24h"`
+}
+
+// OAuthProviderConfig configures the OAuth application registered with a provider
+type OAuthProviderConfig struct {
+	ClientID     string `env:"CLIENT_ID,default="`
+	ClientSecret string `env:"CLIENT_SECRET,default="`
+	// RedirectURL is the callback registered with the provider, /api/v1/auth/oauth/<provider>/callback
+	RedirectURL string `env:"REDIRECT_URL,default="`
+	// URL points to GitHub Enterprise Server or a self-managed GitLab instance
+	URL string `env:"URL,default="`
+}
+
+// Enabled reports whether the provider is configured
+func (o OAuthProviderConfig) Enabled() bool {
+	return o.ClientID != ""
+}
+
+type KerberosConfig struct {
+	// KeytabPath is the keytab of the service principal, e.g. exported with ktpass or kadmin
+	KeytabPath string `env:"KEYTAB_PATH,default="`
+	// ServicePrincipal selects the keytab entry, e.g. HTTP/auth.corp.example.com, by default
+	// the principal the ticket was issued for
+	ServicePrincipal string `env:"SERVICE_PRINCIPAL,default="`
+	// Realms are the realms whose principals may sign in, e.g. realms trusted by the KDC aren't
+	Realms []string `env:"REALMS,default="`
+	// UserMapping maps jdoe@CORP.EXAMPLE.COM to the user with username jdoe (username) or the
+	// user with email jdoe@<EMAIL_DOMAIN> (email)
+	UserMapping string `env:"USER_MAPPING,default=username"`
+	// EmailDomain is the domain of emails of the email mapping, the lowercased realm when empty
+	EmailDomain  string   `env:"EMAIL_DOMAIN,default="`
+	MaxClockSkew Duration `env:"MAX_CLOCK_SKEW,default=5m"`
+}
+
+// Enabled reports whether SPNEGO sign-in is configured
+func (k KerberosConfig) Enabled() bool {
+	return k.KeytabPath != ""
+}
+
+type SIWEConfig struct {
+	// Domain is the domain clients put in messages, e.g. app.example.com, messages for other
+	// domains are refused
+	Domain string `env:"DOMAIN,default="`
+	// ChainIDs are the chains messages may name, e.g. 1 for Ethereum mainnet
+	ChainIDs []int64 `env:"CHAIN_IDS,default=1"`
+	// NonceTTL is how long users have to sign a message after requesting its nonce
+	NonceTTL Duration `env:"NONCE_TTL,default=5m"`
+}
+
+// Enabled reports whether sign-in with Ethereum is configured
+func (s SIWEConfig) Enabled() bool {
+	return s.Domain != ""
+}
+
+type ShadowIdPConfig struct {
+	// Provider is "none" or "keycloak"; users are only mirrored while the shadow_idp feature flag is on for them
+	Provider string `env:"PROVIDER,default=none"`
+	// URL is the base URL of the provider, e.g. https://keycloak.example.com
+	URL   string `env:"URL,default="`
+	Realm string `env:"REALM,default="`
+	// ClientID and ClientSecret are a client allowed to manage users and to use the password grant
+	ClientID     string `env:"CLIENT_ID,default="`
+	ClientSecret string `env:"CLIENT_SECRET,default="`
+	// Timeout bounds each mirrored registration or login, Concurrency the mirrors running at once
+	Timeout     Duration `env:"TIMEOUT,default=5s"`
+	Concurrency int      `env:"CONCURRENCY,default=10"`
+}
+
+// Enabled reports whether an external identity provider is mirrored to
+func (s ShadowIdPConfig) Enabled() bool {
+	return s.Provider != "none"
+}
+
+type EncryptionConfig struct {
+	// Keys are key encryption keys as id:base64-key entries of 32-byte keys, the first one
+	// encrypts new values and the others are kept to decrypt values until they are re-encrypted
+	Keys []string `env:"KEYS,default="`
+	// ReencryptInterval is how often values encrypted with older keys are re-encrypted
+	ReencryptInterval  Duration `env:"REENCRYPT_INTERVAL,default=1h"`
+	ReencryptBatchSize int      `env:"REENCRYPT_BATCH_SIZE,default=100"`
+}
+
+// DSN returns PostgreSQL connection string, URL when set
 func (p PostgresConfig) DSN() string {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		p.Host, p.Port, p.User, p.Password, p.DBName, p.SSLMode)
+	if p.URL != "" {
+		return p.URL
+	}
+
+	pairs := []string{
+		"host=" + dsnValue(p.Host),
+		"port=" + dsnValue(p.Port),
+		"user=" + dsnValue(p.User),
+		"password=" + dsnValue(p.Password),
+		"dbname=" + dsnValue(p.DBName),
+		"sslmode=" + dsnValue(p.SSLMode),
+	}
+	optional := func(key, value string) {
+		if value != "" {
+			pairs = append(pairs, key+"="+dsnValue(value))
+		}
+	}
+	optional("sslrootcert", p.SSLRootCert)
+	optional("sslcert", p.SSLCert)
+	optional("sslkey", p.SSLKey)
+	optional("application_name", p.ApplicationName)
+	// Parameters unknown to the driver are sent to the server as run-time parameters
+	optional("search_path", p.SearchPath)
+	if p.StatementTimeout.Duration > 0 {
+		optional("statement_timeout", strconv.FormatInt(p.StatementTimeout.Milliseconds(), 10))
+	}
+
+	return strings.Join(pairs, " ")
+}
+
+// dsnValue quotes a connection string value if it is empty or contains spaces, quotes or backslashes
+func dsnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\\t\n") {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
 
 // Address returns Redis connection address
@@ -69,22 +647,67 @@ func (r RedisConfig) Address() string {
 	return fmt.Sprintf("%s:%s", r.Host, r.Port)
 }
 
-// Load loads configuration from environment variables
-func Load(ctx context.Context) (*Config, error) {
+// Load loads configuration from environment variables and the file named by CONFIG_FILE
+// Every variable can also be read from a file named by <NAME>_FILE or reference a secret
+// in Vault or AWS Secrets Manager, sources add further secret managers, see SecretSource
+func Load(ctx context.Context, sources ...SecretSource) (*Config, error) {
+	return LoadFile(ctx, "", sources...)
+}
+
+// LoadFile loads configuration from a YAML or JSON file overridden by environment variables
+// An empty path falls back to CONFIG_FILE, without either only the environment is used.
+func LoadFile(ctx context.Context, path string, sources ...SecretSource) (*Config, error) {
 	var config Config
 
-	if err := envconfig.Process(ctx, &config); err != nil {
+	env := envconfig.OsLookuper()
+	if path == "" {
+		path, _ = env.Lookup("CONFIG_FILE")
+	}
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		// Environment variables are the final layer
+		env = envconfig.MultiLookuper(env, file)
+	}
+
+	// Secret manager settings themselves may come from files
+	bootstrap := newSecretLookuper(ctx, envconfig.OsLookuper(), nil)
+	lookuper := newSecretLookuper(ctx, env, append(defaultSecretSources(bootstrap), sources...))
+	if bootstrap.err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", bootstrap.err)
+	}
+
+	if err := envconfig.ProcessWith(ctx, &envconfig.Config{Target: &config, Lookuper: lookuper}); err != nil {
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
+	if lookuper.err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", lookuper.err)
+	}
 
-	// Validate JWT secret length
-	if len(config.JWT.Secret) < 32 {
-		return nil, fmt.Errorf("JWT_SECRET must be at least 32 characters long")
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
 }
 
+// InMemoryStorage reports whether data is kept in process memory instead of Postgres and Redis
+func (c *Config) InMemoryStorage() bool {
+	return c.DevStorage == DevStorageMemory
+}
+
+// IsProduction reports whether the service runs with ENV=production
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// DocsEnabled reports whether the API documentation is served
+func (c *Config) DocsEnabled() bool {
+	return c.Docs.Enabled && !c.IsProduction()
+}
+
 // LoadWithDefaults loads configuration with default context
 func LoadWithDefaults() (*Config, error) {
 	return Load(context.Background())
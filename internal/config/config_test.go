@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"errors"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -47,10 +49,34 @@ func TestLoad(t *testing.T) {
 		t.Errorf("Expected JWT.RefreshTokenExpiry to be 7d, got %v", cfg.JWT.RefreshTokenExpiry.Duration)
 	}
 
+	if cfg.JWT.Leeway.Duration != 30*time.Second {
+		t.Errorf("Expected JWT.Leeway to be 30s, got %v", cfg.JWT.Leeway.Duration)
+	}
+
 	if cfg.Security.BCryptCost != 12 {
 		t.Errorf("Expected Security.BCryptCost to be 12, got %d", cfg.Security.BCryptCost)
 	}
 
+	if len(cfg.Security.TrustedProxies) != 0 {
+		t.Errorf("Expected no trusted proxies by default, got %v", cfg.Security.TrustedProxies)
+	}
+
+	if !cfg.API.V1Sunset.IsZero() {
+		t.Errorf("Expected no API v1 sunset date by default, got %v", cfg.API.V1Sunset)
+	}
+
+	if cfg.Erasure.Mode != "delete" || cfg.Erasure.GracePeriod.Duration != 7*24*time.Hour {
+		t.Errorf("Expected erasures to delete users after 7d, got %s after %v", cfg.Erasure.Mode, cfg.Erasure.GracePeriod.Duration)
+	}
+
+	if cfg.Invitation.Required || cfg.Invitation.TTL.Duration != 7*24*time.Hour {
+		t.Errorf("Expected open registration and invitations valid for 7d, got %v and %v", cfg.Invitation.Required, cfg.Invitation.TTL.Duration)
+	}
+
+	if len(cfg.LoginThrottle.Delays) != 4 || cfg.LoginThrottle.Delays[3].Duration != 5*time.Second {
+		t.Errorf("Expected login delays of 0s, 1s, 2s and 5s, got %v", cfg.LoginThrottle.Delays)
+	}
+
 	if cfg.Env != "development" {
 		t.Errorf("Expected Env to be 'development', got '%s'", cfg.Env)
 	}
@@ -73,6 +99,7 @@ func TestLoadWithCustomValues(t *testing.T) {
 	os.Setenv("POSTGRES_HOST", "postgres.example.com")
 	os.Setenv("JWT_ACCESS_TOKEN_EXPIRY", "30m")
 	os.Setenv("ENV", "production")
+	os.Setenv("API_V1_SUNSET", "2027-06-30T00:00:00Z")
 	defer func() {
 		os.Unsetenv("JWT_SECRET")
 		os.Unsetenv("SERVER_PORT")
@@ -80,6 +107,7 @@ func TestLoadWithCustomValues(t *testing.T) {
 		os.Unsetenv("POSTGRES_HOST")
 		os.Unsetenv("JWT_ACCESS_TOKEN_EXPIRY")
 		os.Unsetenv("ENV")
+		os.Unsetenv("API_V1_SUNSET")
 	}()
 
 	ctx := context.Background()
@@ -107,6 +135,14 @@ func TestLoadWithCustomValues(t *testing.T) {
 	if cfg.Env != "production" {
 		t.Errorf("Expected Env to be 'production', got '%s'", cfg.Env)
 	}
+
+	if !cfg.API.V1Sunset.Equal(time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected API.V1Sunset to be 2027-06-30, got %v", cfg.API.V1Sunset)
+	}
+
+	if cfg.DocsEnabled() {
+		t.Error("Expected API docs to be disabled in production")
+	}
 }
 
 func TestLoadWithoutJWTSecret(t *testing.T) {
@@ -132,6 +168,59 @@ func TestLoadWithShortJWTSecret(t *testing.T) {
 	}
 }
 
+func TestLoadDatabaseDriver(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+
+	t.Setenv("DATABASE_DRIVER", "sqlite")
+	cfg, err := Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Database.SQLitePath != "auth-service.db" {
+		t.Errorf("Expected default SQLite path, got %q", cfg.Database.SQLitePath)
+	}
+
+	t.Setenv("DATABASE_DRIVER", "mysql")
+	if _, err := Load(context.Background()); err == nil {
+		t.Error("Expected error for an unsupported DATABASE_DRIVER")
+	}
+}
+
+func TestLoadDevStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage string
+		env     string
+		wantErr bool
+	}{
+		{name: "memory in development", storage: "memory", env: "development"},
+		{name: "unknown storage", storage: "sqlite", env: "development", wantErr: true},
+		{name: "memory in production", storage: "memory", env: "production", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+			t.Setenv("DEV_STORAGE", tt.storage)
+			t.Setenv("ENV", tt.env)
+
+			cfg, err := Load(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error for invalid DEV_STORAGE")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load configuration: %v", err)
+			}
+			if !cfg.InMemoryStorage() {
+				t.Error("Expected in-memory storage to be enabled")
+			}
+		})
+	}
+}
+
 func TestPostgresDSN(t *testing.T) {
 	pg := PostgresConfig{
 		Host:     "localhost",
@@ -149,6 +238,35 @@ func TestPostgresDSN(t *testing.T) {
 	}
 }
 
+func TestPostgresDSNOptions(t *testing.T) {
+	pg := PostgresConfig{
+		Host:             "db.example.com",
+		Port:             "5432",
+		User:             "auth",
+		Password:         `it's a \secret`,
+		DBName:           "auth",
+		SSLMode:          "verify-full",
+		SSLRootCert:      "/etc/ssl/rds-ca.pem",
+		SSLCert:          "/etc/ssl/client.pem",
+		SSLKey:           "/etc/ssl/client-key.pem",
+		StatementTimeout: Duration{Duration: 5 * time.Second},
+		ApplicationName:  "auth-service",
+		SearchPath:       "auth,public",
+	}
+
+	expected := `host=db.example.com port=5432 user=auth password='it\'s a \\secret' dbname=auth sslmode=verify-full ` +
+		`sslrootcert=/etc/ssl/rds-ca.pem sslcert=/etc/ssl/client.pem sslkey=/etc/ssl/client-key.pem ` +
+		`application_name=auth-service search_path=auth,public statement_timeout=5000`
+	if dsn := pg.DSN(); dsn != expected {
+		t.Errorf("Expected DSN to be '%s', got '%s'", expected, dsn)
+	}
+
+	pg.URL = "postgres://auth@db.example.com/auth?sslmode=verify-full&target_session_attrs=read-write"
+	if dsn := pg.DSN(); dsn != pg.URL {
+		t.Errorf("Expected the URL to replace the DSN, got '%s'", dsn)
+	}
+}
+
 func TestRedisAddress(t *testing.T) {
 	redis := RedisConfig{
 		Host: "localhost",
@@ -161,3 +279,246 @@ func TestRedisAddress(t *testing.T) {
 		t.Errorf("Expected Address to be '%s', got '%s'", expected, addr)
 	}
 }
+
+func TestRateLimitPoliciesDecode(t *testing.T) {
+	var policies RateLimitPolicies
+	err := policies.EnvDecode(context.Background(), "/api/v1/auth/refresh=5/1m/ip, /api/v1/auth/me=100/1h/user,/api/v1/auth/login=3/30s")
+	if err != nil {
+		t.Fatalf("Failed to decode policies: %v", err)
+	}
+
+	if len(policies) != 3 {
+		t.Fatalf("Expected 3 policies, got %d", len(policies))
+	}
+
+	me := policies["/api/v1/auth/me"]
+	if me.Limit != 100 || me.Window.Duration != time.Hour || me.Key != RateLimitKeyUser {
+		t.Errorf("Unexpected policy for /me: %+v", me)
+	}
+
+	login := policies["/api/v1/auth/login"]
+	if login.Key != RateLimitKeyIP {
+		t.Errorf("Expected default key strategy to be ip, got '%s'", login.Key)
+	}
+
+	for _, invalid := range []string{"/login", "/login=abc/1m", "/login=5/xyz", "/login=5/1m/email", "/login=0/1m"} {
+		if err := policies.EnvDecode(context.Background(), invalid); err == nil {
+			t.Errorf("Expected error for policy '%s'", invalid)
+		}
+	}
+}
+
+func TestRouteTimeoutsDecode(t *testing.T) {
+	var timeouts RouteTimeouts
+	if err := timeouts.EnvDecode(context.Background(), "/api/v1/auth/login=10s, /api/v1/auth/me=500ms"); err != nil {
+		t.Fatalf("Failed to decode timeouts: %v", err)
+	}
+	if timeouts["/api/v1/auth/login"].Duration != 10*time.Second || timeouts["/api/v1/auth/me"].Duration != 500*time.Millisecond {
+		t.Errorf("Unexpected timeouts: %v", timeouts)
+	}
+
+	for _, invalid := range []string{"/login", "/login=abc", "=5s"} {
+		if err := timeouts.EnvDecode(context.Background(), invalid); err == nil {
+			t.Errorf("Expected error for timeout '%s'", invalid)
+		}
+	}
+}
+
+func TestRouteOriginsDecode(t *testing.T) {
+	var routes RouteOrigins
+	if err := routes.EnvDecode(context.Background(), "/api/v1/admin=https://admin.example.com, https://ops.example.com,/api/v1/oauth="); err != nil {
+		t.Fatalf("Failed to decode route origins: %v", err)
+	}
+	if strings.Join(routes["/api/v1/admin"], " ") != "https://admin.example.com https://ops.example.com" {
+		t.Errorf("Unexpected admin origins: %v", routes["/api/v1/admin"])
+	}
+	if origins, ok := routes["/api/v1/oauth"]; !ok || len(origins) != 0 {
+		t.Errorf("Expected no origins for /api/v1/oauth, got %v", routes)
+	}
+
+	for _, invalid := range []string{"https://app.example.com", "=https://app.example.com"} {
+		if err := routes.EnvDecode(context.Background(), invalid); err == nil {
+			t.Errorf("Expected error for route origins '%s'", invalid)
+		}
+	}
+}
+
+func TestEffectiveRateLimitPolicies(t *testing.T) {
+	security := SecurityConfig{
+		RateLimitRequests: 10,
+		RateLimitWindow:   Duration{Duration: time.Minute},
+		RateLimitPolicies: RateLimitPolicies{
+			"/api/v1/auth/login": {Limit: 3, Window: Duration{Duration: time.Minute}, Key: RateLimitKeyIP},
+		},
+	}
+
+	policies := security.EffectiveRateLimitPolicies()
+
+	if policies["/api/v1/auth/register"].Limit != 10 {
+		t.Errorf("Expected register to fall back to global limit, got %d", policies["/api/v1/auth/register"].Limit)
+	}
+
+	if policies["/api/v1/auth/login"].Limit != 3 {
+		t.Errorf("Expected explicit login policy to win, got %d", policies["/api/v1/auth/login"].Limit)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	t.Setenv("JWT_SECRET", "short")
+	t.Setenv("SERVER_PORT", "70000")
+	t.Setenv("BCRYPT_COST", "3")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "app.example.com")
+
+	_, err := Load(context.Background())
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	for _, want := range []string{"SERVER_PORT", "JWT_SECRET", "BCRYPT_COST", "CORS_ALLOWED_ORIGINS"} {
+		found := false
+		for _, problem := range validationErr.Problems {
+			if strings.HasPrefix(problem, want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected a problem with %s, got %v", want, validationErr.Problems)
+		}
+	}
+}
+
+func TestValidateProduction(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*Config)
+		problem string
+	}{
+		{name: "valid", mutate: func(*Config) {}},
+		{name: "insecure cookie", mutate: func(c *Config) { c.Cookie.Secure = false }, problem: "COOKIE_SECURE must be true in production"},
+		{name: "no CORS origins", mutate: func(c *Config) { c.CORS.AllowedOrigins = nil }, problem: "CORS_ALLOWED_ORIGINS must not be empty in production"},
+		{name: "any CORS origin", mutate: func(c *Config) { c.CORS.AllowedOrigins = []string{"*"} }, problem: "CORS_ALLOWED_ORIGINS must not contain * in production"},
+		{name: "CORS wildcard inside host", mutate: func(c *Config) { c.CORS.AllowedOrigins = []string{"https://app.*.example.com"} }, problem: `CORS_ALLOWED_ORIGINS entry "https://app.*.example.com" may only start with *. followed by a domain like example.com`},
+		{name: "CORS route override without path", mutate: func(c *Config) {
+			c.CORS.RouteOrigins = RouteOrigins{"api/v1/admin": {"https://admin.example.com"}}
+		}, problem: `CORS_ROUTE_ORIGINS prefix "api/v1/admin" must be a path like /api/v1/admin`},
+		{name: "CORS max age above a day", mutate: func(c *Config) { c.CORS.MaxAge = Duration{Duration: 48 * time.Hour} }, problem: "CORS_MAX_AGE must be between 0 and 24h, got 48h0m0s"},
+		{name: "bcrypt cost above maximum", mutate: func(c *Config) { c.Security.BCryptCost = 32 }, problem: "BCRYPT_COST must be between 4 and 31, got 32"},
+		{name: "restricted rate limit share above 100", mutate: func(c *Config) { c.Security.RateLimitRestrictedPercent = 150 }, problem: "RATE_LIMIT_RESTRICTED_PERCENT must be between 1 and 100, got 150"},
+		{name: "oauth provider without secret", mutate: func(c *Config) {
+			c.OAuth.GitHub = OAuthProviderConfig{ClientID: "client", RedirectURL: "https://auth.example.com/api/v1/auth/oauth/github/callback"}
+		}, problem: "OAUTH_GITHUB_CLIENT_SECRET is required when OAUTH_GITHUB_CLIENT_ID is set"},
+		{name: "oauth provider without redirect url", mutate: func(c *Config) {
+			c.OAuth.GitLab = OAuthProviderConfig{ClientID: "client", ClientSecret: "secret"}
+		}, problem: `OAUTH_GITLAB_REDIRECT_URL must be an http(s) URL, got ""`},
+		{name: "kerberos without realms", mutate: func(c *Config) { c.Kerberos.KeytabPath = "/etc/auth/http.keytab" }, problem: "KERBEROS_REALMS is required when KERBEROS_KEYTAB_PATH is set"},
+		{name: "unknown kerberos user mapping", mutate: func(c *Config) {
+			c.Kerberos.KeytabPath, c.Kerberos.Realms, c.Kerberos.UserMapping = "/etc/auth/http.keytab", []string{"CORP.EXAMPLE.COM"}, "upn"
+		}, problem: "KERBEROS_USER_MAPPING must be username or email, got upn"},
+		{name: "unverified expiry within the warning", mutate: func(c *Config) { c.Unverified.ExpiryDays = 2 }, problem: "UNVERIFIED_EXPIRY_DAYS must be 0 or at least 3, got 2"},
+		{name: "unknown unverified action", mutate: func(c *Config) { c.Unverified.Action = "suspend" }, problem: "UNVERIFIED_ACTION must be delete or deactivate, got suspend"},
+		{name: "recovery without attempt window", mutate: func(c *Config) { c.Recovery.AttemptWindow = Duration{} }, problem: "RECOVERY_ATTEMPT_WINDOW must be positive, got 0s"},
+		{name: "admin stats without cache", mutate: func(c *Config) { c.Admin.StatsCacheTTL = Duration{} }, problem: "ADMIN_STATS_CACHE_TTL must be positive, got 0s"},
+		{name: "siwe without chains", mutate: func(c *Config) { c.SIWE.Domain, c.SIWE.ChainIDs = "app.example.com", nil }, problem: "SIWE_CHAIN_IDS is required when SIWE_DOMAIN is set"},
+		{name: "unknown email verification policy", mutate: func(c *Config) { c.Email.VerificationPolicy = "strict" }, problem: "EMAIL_VERIFICATION_POLICY must be off, block or restrict, got strict"},
+		{name: "unknown device binding mode", mutate: func(c *Config) { c.DeviceBinding.Mode = "strict" }, problem: "DEVICE_BINDING_MODE must be off, log or enforce, got strict"},
+		{name: "unknown access token format", mutate: func(c *Config) { c.JWT.AccessTokenFormat = "paseto" }, problem: "JWT_ACCESS_TOKEN_FORMAT must be jwt or opaque, got paseto"},
+		{name: "negative JWT leeway", mutate: func(c *Config) { c.JWT.Leeway.Duration = -time.Second }, problem: "JWT_LEEWAY must not be negative, got -1s"},
+		{name: "JWT expiry grace above token lifetime", mutate: func(c *Config) { c.JWT.ExpiryGrace.Duration = time.Hour }, problem: "JWT_EXPIRY_GRACE must be between 0 and JWT_ACCESS_TOKEN_EXPIRY, got 1h0m0s"},
+		{name: "Postgres client key without certificate", mutate: func(c *Config) { c.Postgres.SSLKey = "/etc/ssl/client-key.pem" }, problem: "POSTGRES_SSLCERT and POSTGRES_SSLKEY must be set together"},
+		{name: "negative Postgres statement timeout", mutate: func(c *Config) { c.Postgres.StatementTimeout.Duration = -time.Second }, problem: "POSTGRES_STATEMENT_TIMEOUT must not be negative, got -1s"},
+		{name: "unknown shadow IdP", mutate: func(c *Config) { c.ShadowIdP.Provider = "auth0" }, problem: "SHADOW_IDP_PROVIDER must be none or keycloak, got auth0"},
+		{name: "shadow IdP without client", mutate: func(c *Config) { c.ShadowIdP.Provider = "keycloak" }, problem: "SHADOW_IDP_URL, SHADOW_IDP_REALM, SHADOW_IDP_CLIENT_ID and SHADOW_IDP_CLIENT_SECRET are required when SHADOW_IDP_PROVIDER is keycloak"},
+		{name: "Redis TLS settings without TLS", mutate: func(c *Config) { c.Redis.TLSCAPath = "/etc/redis/ca.pem" }, problem: "REDIS_TLS_* settings require REDIS_TLS_ENABLED"},
+		{name: "Redis TLS without verification", mutate: func(c *Config) { c.Redis.TLSEnabled, c.Redis.TLSInsecureSkipVerify = true, true }, problem: "REDIS_TLS_INSECURE_SKIP_VERIFY is not allowed in production"},
+		{name: "Redis TLS key without certificate", mutate: func(c *Config) { c.Redis.TLSEnabled = true; c.Redis.TLSKeyPath = "/etc/redis/key.pem" }, problem: "REDIS_TLS_CERT_PATH and REDIS_TLS_KEY_PATH must be set together"},
+		{name: "relative change-password URL", mutate: func(c *Config) { c.Redirect.ChangePasswordURL = "/settings/password" }, problem: `REDIRECT_CHANGE_PASSWORD_URL must be an http(s) URL like https://app.example.com/settings/password, got "/settings/password"`},
+		{name: "allowed email domain with local part", mutate: func(c *Config) { c.Email.AllowedDomains = []string{"admin@acme.com"} }, problem: `EMAIL_ALLOWED_DOMAINS must contain domains like example.com or *.example.com, got "admin@acme.com"`},
+		{name: "account event deactivation without providers", mutate: func(c *Config) { c.AccountEvents.Deactivate = true }, problem: "ACCOUNT_EVENTS_DEACTIVATE requires ACCOUNT_EVENTS_APPLE_CLIENT_IDS or ACCOUNT_EVENTS_GOOGLE_CLIENT_IDS"},
+		{name: "ext_authz without internal listener", mutate: func(c *Config) { c.ExtAuthz.Enabled = true }, problem: "EXT_AUTHZ_ENABLED requires INTERNAL_PORT, ext_authz is never served on the public listener"},
+		{name: "ext_authz prefix with trailing slash", mutate: func(c *Config) {
+			c.ExtAuthz.Enabled, c.ExtAuthz.PathPrefix, c.Internal.Port = true, "/ext_authz/", "9090"
+		}, problem: `EXT_AUTHZ_PATH_PREFIX must be a path without trailing slash like /ext_authz, got "/ext_authz/"`},
+		{name: "JWT validation cache TTL too long", mutate: func(c *Config) { c.JWT.ValidationCacheTTL.Duration = time.Hour }, problem: "JWT_VALIDATION_CACHE_TTL must be between 0 and 1m0s, got 1h0m0s"},
+		{name: "JWT validation cache without size", mutate: func(c *Config) { c.JWT.ValidationCacheTTL.Duration = time.Second; c.JWT.ValidationCacheSize = 0 }, problem: "JWT_VALIDATION_CACHE_SIZE must be positive, got 0"},
+		{name: "negative slow query threshold", mutate: func(c *Config) { c.Database.SlowQueryThreshold.Duration = -time.Millisecond }, problem: "DATABASE_SLOW_QUERY_THRESHOLD must not be negative, got -1ms"},
+		{name: "negative session limit", mutate: func(c *Config) { c.Session.MaxPerUser = -1 }, problem: "SESSION_MAX_PER_USER must not be negative, got -1"},
+		{name: "negative session history retention", mutate: func(c *Config) { c.Session.HistoryRetention.Duration = -time.Hour }, problem: "SESSION_HISTORY_RETENTION must not be negative, got -1h0m0s"},
+		{name: "zero session cleanup interval", mutate: func(c *Config) { c.Session.CleanupInterval.Duration = 0 }, problem: "SESSION_CLEANUP_INTERVAL must be positive, got 0s"},
+		{name: "empty JWT audience", mutate: func(c *Config) { c.JWT.Audience = []string{"api", ""} }, problem: "JWT_AUDIENCE must not contain empty entries"},
+		{name: "negative startup wait", mutate: func(c *Config) { c.Startup.RetryMaxWait.Duration = -time.Second }, problem: "STARTUP_RETRY_MAX_WAIT must not be negative, got -1s"},
+		{name: "startup backoff above maximum", mutate: func(c *Config) { c.Startup.RetryInitialBackoff.Duration = time.Minute }, problem: "STARTUP_RETRY_INITIAL_BACKOFF must be positive and at most STARTUP_RETRY_MAX_BACKOFF"},
+		{name: "login delay above login timeout", mutate: func(c *Config) { c.LoginThrottle.Delays = []Duration{{Duration: time.Minute}} }, problem: "LOGIN_THROTTLE_DELAYS must be shorter than the login request timeout 10s, got 1m0s"},
+		{name: "negative login delay", mutate: func(c *Config) { c.LoginThrottle.Delays = []Duration{{Duration: -time.Second}} }, problem: "LOGIN_THROTTLE_DELAYS must not be negative, got -1s"},
+		{name: "negative redis retries", mutate: func(c *Config) { c.Redis.MaxRetries = -1 }, problem: "REDIS_MAX_RETRIES must not be negative, got -1"},
+		{name: "unknown audit sink", mutate: func(c *Config) { c.Audit.Sink = "kafka" }, problem: "AUDIT_SINK must be none, syslog or http, got kafka"},
+		{name: "syslog audit without address", mutate: func(c *Config) { c.Audit.Sink = "syslog" }, problem: `AUDIT_SYSLOG_ADDRESS must be host:port, got ""`},
+		{name: "unknown audit format", mutate: func(c *Config) {
+			c.Audit.Sink, c.Audit.Format, c.Audit.SyslogAddress = "syslog", "json", "siem.internal:514"
+		}, problem: "AUDIT_FORMAT must be cef or leef, got json"},
+		{name: "http audit without URL", mutate: func(c *Config) { c.Audit.Sink = "http" }, problem: `AUDIT_HTTP_URL must be an http(s) URL, got ""`},
+		{name: "internal TLS without listener", mutate: func(c *Config) { c.Internal.TLSCertPath, c.Internal.TLSKeyPath = "cert.pem", "key.pem" }, problem: "INTERNAL_TLS_* settings require INTERNAL_PORT"},
+		{name: "invalid SPIFFE ID", mutate: func(c *Config) {
+			c.Internal = InternalConfig{Port: "9090", TLSCertPath: "cert.pem", TLSKeyPath: "key.pem", TLSClientCAPath: "ca.pem", AllowedSPIFFEIDs: []string{"example.org/gateway"}}
+		}, problem: `INTERNAL_ALLOWED_SPIFFE_IDS must contain SPIFFE IDs like spiffe://example.org/service, got "example.org/gateway"`},
+		{name: "unknown JWT keyring", mutate: func(c *Config) { c.JWT.Keyring = "vault" }, problem: "JWT_KEYRING must be config or redis, got vault"},
+		{name: "short encryption key", mutate: func(c *Config) { c.Encryption.Keys = []string{"k1:c2hvcnQ="} }, problem: `ENCRYPTION_KEYS entries must be id:key with 32 base64-encoded bytes, got one with id "k1"`},
+		{name: "relative redirect URL", mutate: func(c *Config) { c.Redirect.AllowedURLs = []string{"/auth"} }, problem: `REDIRECT_ALLOWED_URLS entry "/auth" must be an http(s) URL like https://app.example.com/auth`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+			t.Setenv("ENV", "production")
+			cfg, err := Load(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to load configuration: %v", err)
+			}
+
+			tt.mutate(cfg)
+			err = cfg.Validate()
+			if tt.problem == "" {
+				if err != nil {
+					t.Errorf("Expected no problems, got %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 || validationErr.Problems[0] != tt.problem {
+				t.Errorf("Expected problem %q, got %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestFeatureFlagDefaultsDecode(t *testing.T) {
+	var defaults FeatureFlagDefaults
+	if err := defaults.EnvDecode(context.Background(), "magic_links=on, mfa=off,v2_responses=25%"); err != nil {
+		t.Fatalf("Failed to decode feature flags: %v", err)
+	}
+	if defaults["magic_links"] != 100 || defaults["mfa"] != 0 || defaults["v2_responses"] != 25 || len(defaults) != 3 {
+		t.Errorf("Unexpected feature flags: %v", defaults)
+	}
+
+	for _, invalid := range []string{"mfa", "mfa=maybe", "mfa=101%", "=on"} {
+		if err := defaults.EnvDecode(context.Background(), invalid); err == nil {
+			t.Errorf("Expected error for feature flag '%s'", invalid)
+		}
+	}
+}
+
+func TestClientSecretsDecode(t *testing.T) {
+	var clients ClientSecrets
+	if err := clients.EnvDecode(context.Background(), "gateway=s3cret=, mobile = other"); err != nil {
+		t.Fatalf("Failed to decode clients: %v", err)
+	}
+	if clients["gateway"] != "s3cret=" || clients["mobile"] != "other" || len(clients) != 2 {
+		t.Errorf("Unexpected clients: %v", clients)
+	}
+
+	for _, invalid := range []string{"gateway", "gateway=", "=s3cret"} {
+		if err := clients.EnvDecode(context.Background(), invalid); err == nil {
+			t.Errorf("Expected error for client '%s'", invalid)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RouteOrigins maps path prefixes (e.g. /api/v1/admin) to the CORS origins allowed instead of
+// CORS_ALLOWED_ORIGINS
+type RouteOrigins map[string][]string
+
+// EnvDecode implements envconfig.Decoder to parse overrides in the form
+// "prefix=origin,origin,prefix=origin"; entries without "=" add an origin to the previous prefix
+func (r *RouteOrigins) EnvDecode(_ context.Context, v string) error {
+	routes := make(RouteOrigins)
+
+	prefix := ""
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		origin := entry
+		if route, value, ok := strings.Cut(entry, "="); ok {
+			prefix, origin = strings.TrimSpace(route), strings.TrimSpace(value)
+			if prefix == "" {
+				return fmt.Errorf("invalid CORS route origins %q: expected prefix=origin", entry)
+			}
+			routes[prefix] = nil
+		} else if prefix == "" {
+			return fmt.Errorf("invalid CORS route origins %q: expected prefix=origin", entry)
+		}
+
+		if origin != "" {
+			routes[prefix] = append(routes[prefix], origin)
+		}
+	}
+
+	*r = routes
+	return nil
+}
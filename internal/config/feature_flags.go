@@ -0,0 +1,59 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FeatureFlagDefaults maps feature flag names to the percentage of users they are on for
+type FeatureFlagDefaults map[string]int
+
+// EnvDecode implements envconfig.Decoder to parse flags in the form
+// "name=on,name=off,name=25%", on and off are 100% and 0%
+func (d *FeatureFlagDefaults) EnvDecode(ctx context.Context, v string) error {
+	defaults := make(FeatureFlagDefaults)
+
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid feature flag %q: expected name=on|off|percentage%%", entry)
+		}
+
+		percentage, err := parseFeatureFlagSpec(strings.TrimSpace(spec))
+		if err != nil {
+			return fmt.Errorf("invalid feature flag %s: %w", name, err)
+		}
+
+		defaults[name] = percentage
+	}
+
+	*d = defaults
+	return nil
+}
+
+func parseFeatureFlagSpec(spec string) (int, error) {
+	switch strings.ToLower(spec) {
+	case "on", "true":
+		return 100, nil
+	case "off", "false":
+		return 0, nil
+	}
+
+	value, ok := strings.CutSuffix(spec, "%")
+	if !ok {
+		return 0, fmt.Errorf("expected on, off or a percentage, got %q", spec)
+	}
+	percentage, err := strconv.Atoi(value)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, fmt.Errorf("percentage must be between 0%% and 100%%, got %q", spec)
+	}
+	return percentage, nil
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileLookuper serves values of a YAML or JSON config file by their environment variable names
+// Nested keys are joined with "_" and uppercased, so server.port is SERVER_PORT:
+//
+//	server:
+//	  port: 8080
+//	jwt:
+//	  access_token_expiry: 30m
+//	bcrypt_cost: 12
+//	cors:
+//	  allowed_origins: [https://app.example.com]
+//	rate_limit_policies:
+//	  /api/v1/auth/refresh: 5/1m/ip
+type fileLookuper map[string]string
+
+// Lookup implements envconfig.Lookuper
+func (f fileLookuper) Lookup(key string) (string, bool) {
+	value, ok := f[key]
+	return value, ok
+}
+
+// readConfigFile reads a .yaml, .yml or .json file and rejects settings the service doesn't know
+func readConfigFile(path string) (fileLookuper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s must be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(fileLookuper)
+	if err := flatten(values, "", doc); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	known := envKeys(reflect.TypeOf(Config{}), "")
+	var unknown []string
+	for key := range values {
+		if !known[strings.TrimSuffix(key, fileSuffix)] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("invalid config file %s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+
+	return values, nil
+}
+
+// flatten converts nested maps into environment variable names and values
+// Maps that aren't settings themselves, like rate_limit_policies, are stored in the
+// key=value,key=value form of their variable.
+func flatten(values fileLookuper, prefix string, node map[string]any) error {
+	for name, value := range node {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		if nested, ok := value.(map[string]any); ok && !mapSetting(key) {
+			if err := flatten(values, key, nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s, err := settingValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		values[key] = s
+	}
+	return nil
+}
+
+// mapSetting reports whether the variable key holds a map
+func mapSetting(key string) bool {
+	return key == "RATE_LIMIT_POLICIES" || key == "REQUEST_TIMEOUTS" || key == "FEATURE_FLAGS_DEFAULTS" || key == "TOKEN_REVOCATION_CLIENTS" || key == "CORS_ROUTE_ORIGINS"
+}
+
+// settingValue formats a value like the corresponding environment variable
+func settingValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := settingValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		entries := make([]string, 0, len(v))
+		for k, item := range v {
+			s, err := settingValue(item)
+			if err != nil {
+				return "", err
+			}
+			entries = append(entries, k+"="+s)
+		}
+		sort.Strings(entries)
+		return strings.Join(entries, ","), nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// envKeys returns the environment variable names of the settings of a config struct
+func envKeys(t reflect.Type, prefix string) map[string]bool {
+	keys := make(map[string]bool)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" && field.Type.Kind() == reflect.Struct {
+			nestedPrefix := prefix
+			for _, opt := range strings.Split(opts, ",") {
+				if p, ok := strings.CutPrefix(opt, "prefix="); ok {
+					nestedPrefix += p
+				}
+			}
+			for key := range envKeys(field.Type, nestedPrefix) {
+				keys[key] = true
+			}
+			continue
+		}
+		keys[prefix+name] = true
+	}
+	return keys
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFileYAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+server:
+  port: 9090
+  read_timeout: 30s
+jwt:
+  secret: `+testJWTSecret+`
+  access_token_expiry: 30m
+bcrypt_cost: 10
+cors:
+  allowed_origins:
+    - https://app.example.com
+    - https://admin.example.com
+rate_limit_policies:
+  /api/v1/auth/refresh: 20/1m/user
+tracing:
+  enabled: true
+  sample_ratio: 0.25
+`)
+	// Environment variables override the file
+	t.Setenv("SERVER_PORT", "7070")
+
+	cfg, err := LoadFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	if cfg.Server.Port != "7070" {
+		t.Errorf("Expected SERVER_PORT from env to win, got %s", cfg.Server.Port)
+	}
+	if cfg.Server.ReadTimeout.Duration != 30*time.Second {
+		t.Errorf("Expected read timeout from file, got %s", cfg.Server.ReadTimeout.Duration)
+	}
+	if cfg.JWT.Secret != testJWTSecret || cfg.JWT.AccessTokenExpiry.Duration != 30*time.Minute {
+		t.Errorf("Unexpected JWT config: %+v", cfg.JWT)
+	}
+	if cfg.Security.BCryptCost != 10 {
+		t.Errorf("Expected bcrypt cost 10, got %d", cfg.Security.BCryptCost)
+	}
+	if strings.Join(cfg.CORS.AllowedOrigins, " ") != "https://app.example.com https://admin.example.com" {
+		t.Errorf("Unexpected CORS origins: %v", cfg.CORS.AllowedOrigins)
+	}
+	if policy := cfg.Security.RateLimitPolicies["/api/v1/auth/refresh"]; policy.Limit != 20 || policy.Key != RateLimitKeyUser {
+		t.Errorf("Unexpected refresh policy: %+v", policy)
+	}
+	if !cfg.Tracing.Enabled || cfg.Tracing.SampleRatio != 0.25 {
+		t.Errorf("Unexpected tracing config: %+v", cfg.Tracing)
+	}
+	// Unset values keep their defaults
+	if cfg.Redis.Port != "6379" {
+		t.Errorf("Expected default Redis port, got %s", cfg.Redis.Port)
+	}
+}
+
+func TestLoadFileJSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"jwt": {"secret": "`+testJWTSecret+`"}, "env": "staging", "graphql": {"enabled": true}}`)
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Env != "staging" || !cfg.GraphQL.Enabled {
+		t.Errorf("Expected values from the CONFIG_FILE, got env=%s graphql=%v", cfg.Env, cfg.GraphQL.Enabled)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{name: "unknown setting", file: "config.yaml", content: "jwt:\n  secrt: x\n", want: "unknown settings JWT_SECRT"},
+		{name: "unsupported extension", file: "config.toml", content: "", want: "must be .yaml, .yml or .json"},
+		{name: "invalid syntax", file: "config.json", content: "{", want: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_SECRET", testJWTSecret)
+			_, err := LoadFile(context.Background(), writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rate limit key strategies
+const (
+	RateLimitKeyIP   = "ip"
+	RateLimitKeyUser = "user"
+)
+
+// Routes covered by the global RATE_LIMIT_REQUESTS/RATE_LIMIT_WINDOW pair
+// unless an explicit policy is configured for them
+var defaultRateLimitedRoutes = []string{
+	"/api/v1/auth/register",
+	"/api/v1/auth/login",
+}
+
+// RateLimitPolicy describes how requests to a single route are limited
+type RateLimitPolicy struct {
+	Limit  int
+	Window Duration
+	Key    string
+}
+
+// RateLimitPolicies maps route templates (e.g. /api/v1/auth/login) to their policy
+type RateLimitPolicies map[string]RateLimitPolicy
+
+// EnvDecode implements envconfig.Decoder to parse policies in the form
+// "route=limit/window[/key],route=limit/window[/key]"
+func (p *RateLimitPolicies) EnvDecode(ctx context.Context, v string) error {
+	policies := make(RateLimitPolicies)
+
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok || route == "" {
+			return fmt.Errorf("invalid rate limit policy %q: expected route=limit/window[/key]", entry)
+		}
+
+		policy, err := parseRateLimitPolicy(spec)
+		if err != nil {
+			return fmt.Errorf("invalid rate limit policy for %s: %w", route, err)
+		}
+
+		policies[strings.TrimSpace(route)] = policy
+	}
+
+	*p = policies
+	return nil
+}
+
+func parseRateLimitPolicy(spec string) (RateLimitPolicy, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return RateLimitPolicy{}, fmt.Errorf("expected limit/window[/key], got %q", spec)
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("invalid limit %q", parts[0])
+	}
+
+	var window Duration
+	if err := window.EnvDecode(context.Background(), parts[1]); err != nil {
+		return RateLimitPolicy{}, err
+	}
+	if window.Duration <= 0 {
+		return RateLimitPolicy{}, fmt.Errorf("window must be positive")
+	}
+
+	key := RateLimitKeyIP
+	if len(parts) == 3 {
+		key = parts[2]
+	}
+	if key != RateLimitKeyIP && key != RateLimitKeyUser {
+		return RateLimitPolicy{}, fmt.Errorf("unknown key strategy %q", key)
+	}
+
+	return RateLimitPolicy{Limit: limit, Window: window, Key: key}, nil
+}
+
+// EffectiveRateLimitPolicies returns configured policies, falling back to the
+// global limit for register and login when they aren't configured explicitly
+func (s SecurityConfig) EffectiveRateLimitPolicies() RateLimitPolicies {
+	policies := make(RateLimitPolicies, len(s.RateLimitPolicies)+len(defaultRateLimitedRoutes))
+
+	for _, route := range defaultRateLimitedRoutes {
+		policies[route] = RateLimitPolicy{
+			Limit:  s.RateLimitRequests,
+			Window: s.RateLimitWindow,
+			Key:    RateLimitKeyIP,
+		}
+	}
+
+	for route, policy := range s.RateLimitPolicies {
+		policies[route] = policy
+	}
+
+	return policies
+}
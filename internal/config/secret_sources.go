@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const secretRequestTimeout = 10 * time.Second
+
+// vaultSource reads secrets from the HashiCorp Vault HTTP API
+type vaultSource struct {
+	addr       string
+	token      string
+	namespace  string
+	httpClient *http.Client
+}
+
+// NewVaultSource creates a source for references like vault://secret/data/auth-service#jwt_secret
+// The path is read with GET /v1/<path>, both KV v1 and KV v2 responses are supported.
+func NewVaultSource(addr, token, namespace string) SecretSource {
+	return &vaultSource{
+		addr:       strings.TrimRight(addr, "/"),
+		token:      token,
+		namespace:  namespace,
+		httpClient: &http.Client{Timeout: secretRequestTimeout},
+	}
+}
+
+func (v *vaultSource) Scheme() string {
+	return "vault"
+}
+
+func (v *vaultSource) Resolve(ctx context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("vault reference %q must be vault://<path>#<key>", ref)
+	}
+	if v.token == "" {
+		return "", errors.New("VAULT_TOKEN is required to read secrets from vault")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := doSecretRequest(v.httpClient, req, &body); err != nil {
+		return "", fmt.Errorf("vault %s: %w", path, err)
+	}
+
+	data := body.Data
+	// KV v2 nests the secret in data.data
+	if nested, ok := data["data"]; ok {
+		var kv2 map[string]json.RawMessage
+		if err := json.Unmarshal(nested, &kv2); err == nil {
+			data = kv2
+		}
+	}
+
+	return secretField(data, key, "vault "+path)
+}
+
+// AWSSecretsManagerConfig configures the AWS Secrets Manager source
+type AWSSecretsManagerConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint overrides the regional endpoint, e.g. for LocalStack
+	Endpoint string
+}
+
+// awsSecretsManagerSource reads secrets with the GetSecretValue API
+// Only static credentials are supported, instance and web identity roles are not.
+type awsSecretsManagerSource struct {
+	cfg        AWSSecretsManagerConfig
+	signer     *v4.Signer
+	httpClient *http.Client
+}
+
+// NewAWSSecretsManagerSource creates a source for references like awssm://auth-service/prod#jwt_secret
+// The secret is a name or ARN, the optional key selects a field of a JSON secret.
+func NewAWSSecretsManagerSource(cfg AWSSecretsManagerConfig) SecretSource {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", cfg.Region)
+	}
+	return &awsSecretsManagerSource{
+		cfg:        cfg,
+		signer:     v4.NewSigner(),
+		httpClient: &http.Client{Timeout: secretRequestTimeout},
+	}
+}
+
+func (a *awsSecretsManagerSource) Scheme() string {
+	return "awssm"
+}
+
+func (a *awsSecretsManagerSource) Resolve(ctx context.Context, ref string) (string, error) {
+	secretID, key, _ := strings.Cut(ref, "#")
+	if secretID == "" {
+		return "", fmt.Errorf("aws secrets manager reference %q must be awssm://<secret>[#<key>]", ref)
+	}
+	if a.cfg.AccessKeyID == "" || a.cfg.SecretAccessKey == "" {
+		return "", errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required to read secrets from AWS Secrets Manager")
+	}
+
+	payload, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create aws request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	hash := sha256.Sum256(payload)
+	credentials := aws.Credentials{
+		AccessKeyID:     a.cfg.AccessKeyID,
+		SecretAccessKey: a.cfg.SecretAccessKey,
+		SessionToken:    a.cfg.SessionToken,
+	}
+	if err := a.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "secretsmanager", a.cfg.Region, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to sign aws request: %w", err)
+	}
+
+	var body struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := doSecretRequest(a.httpClient, req, &body); err != nil {
+		return "", fmt.Errorf("aws secret %s: %w", secretID, err)
+	}
+	if body.SecretString == nil {
+		return "", fmt.Errorf("aws secret %s has no string value", secretID)
+	}
+	if key == "" {
+		return *body.SecretString, nil
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(*body.SecretString), &data); err != nil {
+		return "", fmt.Errorf("aws secret %s is not a JSON object: %w", secretID, err)
+	}
+	return secretField(data, key, "aws secret "+secretID)
+}
+
+// doSecretRequest sends req and decodes a successful JSON response into out
+func doSecretRequest(httpClient *http.Client, req *http.Request, out any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// The body is not included, it may echo parts of the secret
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// secretField returns the string field key of a secret, where names the secret in errors
+func secretField(data map[string]json.RawMessage, key, where string) (string, error) {
+	raw, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("%s has no key %q", where, key)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("%s key %q is not a string", where, key)
+	}
+	return value, nil
+}
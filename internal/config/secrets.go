@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// fileSuffix marks variables holding the path of a file with the actual value,
+// e.g. JWT_SECRET_FILE=/run/secrets/jwt_secret for Docker and Kubernetes secret mounts
+const fileSuffix = "_FILE"
+
+// SecretSource resolves references to secrets kept outside the environment
+// A variable whose value starts with "<scheme>://" is replaced by the resolved secret,
+// e.g. JWT_SECRET=vault://secret/data/auth-service#jwt_secret
+type SecretSource interface {
+	// Scheme is the reference prefix handled by the source, e.g. "vault"
+	Scheme() string
+	// Resolve returns the secret referenced by ref, which excludes the scheme prefix
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// secretLookuper extends an envconfig.Lookuper with *_FILE variables and secret references
+// Lookuper can't return errors, the first one is kept in err and checked after processing.
+type secretLookuper struct {
+	ctx     context.Context
+	env     envconfig.Lookuper
+	sources map[string]SecretSource
+	cache   map[string]string
+	err     error
+}
+
+func newSecretLookuper(ctx context.Context, env envconfig.Lookuper, sources []SecretSource) *secretLookuper {
+	l := &secretLookuper{
+		ctx:     ctx,
+		env:     env,
+		sources: make(map[string]SecretSource, len(sources)),
+		cache:   make(map[string]string),
+	}
+	for _, source := range sources {
+		l.sources[source.Scheme()] = source
+	}
+	return l
+}
+
+// Lookup implements envconfig.Lookuper
+// A variable set directly wins over its *_FILE variant.
+func (l *secretLookuper) Lookup(key string) (string, bool) {
+	value, ok := l.env.Lookup(key)
+	if !ok {
+		path, fileOK := l.env.Lookup(key + fileSuffix)
+		if !fileOK || path == "" {
+			return "", false
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.fail(fmt.Errorf("failed to read %s%s: %w", key, fileSuffix, err))
+			return "", false
+		}
+		// Secret files usually end with a newline
+		value, ok = strings.TrimRight(string(data), "\r\n"), true
+	}
+
+	resolved, err := l.resolve(value)
+	if err != nil {
+		l.fail(fmt.Errorf("failed to resolve %s: %w", key, err))
+		return "", false
+	}
+	return resolved, ok
+}
+
+// resolve replaces a secret reference by the secret, other values are returned unchanged
+func (l *secretLookuper) resolve(value string) (string, error) {
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+	source, ok := l.sources[scheme]
+	if !ok {
+		// Not a reference, e.g. a URL
+		return value, nil
+	}
+
+	if secret, ok := l.cache[value]; ok {
+		return secret, nil
+	}
+	secret, err := source.Resolve(l.ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	l.cache[value] = secret
+	return secret, nil
+}
+
+func (l *secretLookuper) fail(err error) {
+	if l.err == nil {
+		l.err = err
+	}
+}
+
+// defaultSecretSources returns the secret managers configured in env
+// They are bootstrap settings read before the configuration, so the standard
+// variable names of the tools are used.
+func defaultSecretSources(env envconfig.Lookuper) []SecretSource {
+	lookup := func(key string) string {
+		value, _ := env.Lookup(key)
+		return value
+	}
+
+	var sources []SecretSource
+	if addr := lookup("VAULT_ADDR"); addr != "" {
+		sources = append(sources, NewVaultSource(addr, lookup("VAULT_TOKEN"), lookup("VAULT_NAMESPACE")))
+	}
+	if region := lookup("AWS_REGION"); region != "" {
+		sources = append(sources, NewAWSSecretsManagerSource(AWSSecretsManagerConfig{
+			Region:          region,
+			AccessKeyID:     lookup("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: lookup("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    lookup("AWS_SESSION_TOKEN"),
+			Endpoint:        lookup("AWS_ENDPOINT_URL_SECRETS_MANAGER"),
+		}))
+	}
+	return sources
+}
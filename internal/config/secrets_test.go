@@ -0,0 +1,167 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testJWTSecret = "test-secret-key-that-is-at-least-32-characters-long"
+
+func writeSecretFile(t *testing.T, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	return path
+}
+
+func TestLoadSecretsFromFiles(t *testing.T) {
+	t.Setenv("JWT_SECRET_FILE", writeSecretFile(t, testJWTSecret+"\n"))
+	t.Setenv("POSTGRES_PASSWORD_FILE", writeSecretFile(t, "db-password"))
+
+	cfg, err := Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.JWT.Secret != testJWTSecret {
+		t.Errorf("Expected JWT secret from file without trailing newline, got %q", cfg.JWT.Secret)
+	}
+	if cfg.Postgres.Password != "db-password" {
+		t.Errorf("Expected Postgres password from file, got %q", cfg.Postgres.Password)
+	}
+
+	// A variable set directly wins over the file
+	t.Setenv("POSTGRES_PASSWORD", "from-env")
+	cfg, err = Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Postgres.Password != "from-env" {
+		t.Errorf("Expected Postgres password from env, got %q", cfg.Postgres.Password)
+	}
+}
+
+func TestLoadSecretFileMissing(t *testing.T) {
+	t.Setenv("JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	_, err := Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "JWT_SECRET_FILE") {
+		t.Errorf("Expected an error naming JWT_SECRET_FILE, got %v", err)
+	}
+}
+
+type staticSource map[string]string
+
+func (staticSource) Scheme() string { return "static" }
+
+func (s staticSource) Resolve(_ context.Context, ref string) (string, error) {
+	return s[ref], nil
+}
+
+func TestLoadWithSecretSource(t *testing.T) {
+	t.Setenv("JWT_SECRET", "static://jwt")
+	// Values of unknown schemes are kept as they are
+	t.Setenv("TRACING_ENDPOINT", "http://collector:4318")
+
+	cfg, err := Load(context.Background(), staticSource{"jwt": testJWTSecret})
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.JWT.Secret != testJWTSecret {
+		t.Errorf("Expected JWT secret from the source, got %q", cfg.JWT.Secret)
+	}
+	if cfg.Tracing.Endpoint != "http://collector:4318" {
+		t.Errorf("Expected tracing endpoint to be unchanged, got %q", cfg.Tracing.Endpoint)
+	}
+}
+
+func TestVaultSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/auth-service":
+			_, _ = io.WriteString(w, `{"data":{"data":{"jwt_secret":"`+testJWTSecret+`"},"metadata":{"version":3}}}`)
+		case "/v1/kv/auth-service":
+			_, _ = io.WriteString(w, `{"data":{"redis_password":"redis-password"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN_FILE", writeSecretFile(t, "vault-token\n"))
+	t.Setenv("JWT_SECRET", "vault://secret/data/auth-service#jwt_secret")
+	t.Setenv("REDIS_PASSWORD", "vault://kv/auth-service#redis_password")
+
+	cfg, err := Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.JWT.Secret != testJWTSecret {
+		t.Errorf("Expected JWT secret from KV v2, got %q", cfg.JWT.Secret)
+	}
+	if cfg.Redis.Password != "redis-password" {
+		t.Errorf("Expected Redis password from KV v1, got %q", cfg.Redis.Password)
+	}
+
+	t.Setenv("REDIS_PASSWORD", "vault://kv/auth-service#missing")
+	if _, err := Load(context.Background()); err == nil || !strings.Contains(err.Error(), "REDIS_PASSWORD") {
+		t.Errorf("Expected an error for a missing key, got %v", err)
+	}
+}
+
+func TestAWSSecretsManagerSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req struct{ SecretId string }
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.SecretId != "auth-service/prod" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		secret, _ := json.Marshal(map[string]string{"jwt_secret": testJWTSecret})
+		_ = json.NewEncoder(w).Encode(map[string]string{"SecretString": string(secret)})
+	}))
+	defer server.Close()
+
+	source := NewAWSSecretsManagerSource(AWSSecretsManagerConfig{
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Endpoint:        server.URL,
+	})
+
+	secret, err := source.Resolve(context.Background(), "auth-service/prod#jwt_secret")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if secret != testJWTSecret {
+		t.Errorf("Expected the JSON field of the secret, got %q", secret)
+	}
+
+	whole, err := source.Resolve(context.Background(), "auth-service/prod")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !strings.Contains(whole, "jwt_secret") {
+		t.Errorf("Expected the whole secret string, got %q", whole)
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// RouteTimeouts maps route templates (e.g. /api/v1/auth/login) to their request timeout
+type RouteTimeouts map[string]Duration
+
+// EnvDecode implements envconfig.Decoder to parse timeouts in the form
+// "route=duration,route=duration"
+func (t *RouteTimeouts) EnvDecode(ctx context.Context, v string) error {
+	timeouts := make(RouteTimeouts)
+
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok || route == "" {
+			return fmt.Errorf("invalid request timeout %q: expected route=duration", entry)
+		}
+
+		var timeout Duration
+		if err := timeout.EnvDecode(ctx, strings.TrimSpace(spec)); err != nil {
+			return fmt.Errorf("invalid request timeout for %s: %w", route, err)
+		}
+
+		timeouts[strings.TrimSpace(route)] = timeout
+	}
+
+	*t = timeouts
+	return nil
+}
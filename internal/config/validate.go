@@ -0,0 +1,611 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bcrypt cost bounds, see golang.org/x/crypto/bcrypt MinCost and MaxCost
+const (
+	minBCryptCost = 4
+	maxBCryptCost = 31
+)
+
+const minJWTSecretLength = 32
+
+// maxValidationCacheTTL bounds how long replicas that missed an invalidation accept revoked tokens
+const maxValidationCacheTTL = time.Minute
+
+// emailDomainPattern matches the entries of EMAIL_ALLOWED_DOMAINS
+var emailDomainPattern = regexp.MustCompile(`^(\*\.)?([a-z0-9-]+\.)+[a-z0-9-]+$`)
+
+// ValidationError lists every problem found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// problems collects validation failures
+type problems []string
+
+func (p *problems) addf(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+// Validate checks the whole configuration and reports all problems at once
+// The returned error is a *ValidationError
+func (c *Config) Validate() error {
+	var p problems
+
+	c.validateServer(&p)
+	c.validateStorage(&p)
+	c.validateSecurity(&p)
+	c.validateProduction(&p)
+
+	// Validate CAPTCHA settings
+	if c.Captcha.Provider != "none" && c.Captcha.Secret == "" {
+		p.addf("CAPTCHA_SECRET is required when CAPTCHA_PROVIDER is %s", c.Captcha.Provider)
+	}
+	if c.Captcha.MinScore < 0 || c.Captcha.MinScore > 1 {
+		p.addf("CAPTCHA_MIN_SCORE must be between 0 and 1, got %g", c.Captcha.MinScore)
+	}
+
+	// Validate anti-enumeration limits
+	if c.Enumeration.TargetLimit < 0 || c.Enumeration.IPLimit < 0 {
+		p.addf("ENUMERATION_TARGET_LIMIT and ENUMERATION_IP_LIMIT must not be negative")
+	}
+	if (c.Enumeration.TargetLimit > 0 || c.Enumeration.IPLimit > 0) && c.Enumeration.Window.Duration <= 0 {
+		p.addf("ENUMERATION_WINDOW must be positive, got %s", c.Enumeration.Window.Duration)
+	}
+
+	// Validate login throttling, delays must leave time to check the password within the login timeout
+	loginTimeout, ok := c.Security.RequestTimeouts["/api/v1/auth/login"]
+	if !ok {
+		loginTimeout = c.Security.RequestTimeout
+	}
+	for _, delay := range c.LoginThrottle.Delays {
+		if delay.Duration < 0 {
+			p.addf("LOGIN_THROTTLE_DELAYS must not be negative, got %s", delay.Duration)
+		} else if loginTimeout.Duration > 0 && delay.Duration >= loginTimeout.Duration {
+			p.addf("LOGIN_THROTTLE_DELAYS must be shorter than the login request timeout %s, got %s", loginTimeout.Duration, delay.Duration)
+		}
+	}
+	if len(c.LoginThrottle.Delays) > 0 && c.LoginThrottle.Window.Duration <= 0 {
+		p.addf("LOGIN_THROTTLE_WINDOW must be positive, got %s", c.LoginThrottle.Window.Duration)
+	}
+
+	// Validate erasure settings
+	if c.Erasure.Mode != "delete" && c.Erasure.Mode != "anonymize" {
+		p.addf("ERASURE_MODE must be delete or anonymize, got %s", c.Erasure.Mode)
+	}
+	if c.Erasure.GracePeriod.Duration < 0 {
+		p.addf("ERASURE_GRACE_PERIOD must not be negative, got %s", c.Erasure.GracePeriod.Duration)
+	}
+	if c.Erasure.SweepInterval.Duration <= 0 {
+		p.addf("ERASURE_SWEEP_INTERVAL must be positive, got %s", c.Erasure.SweepInterval.Duration)
+	}
+
+	// Users are warned two days before their unverified account expires
+	if c.Unverified.ExpiryDays != 0 && c.Unverified.ExpiryDays < 3 {
+		p.addf("UNVERIFIED_EXPIRY_DAYS must be 0 or at least 3, got %d", c.Unverified.ExpiryDays)
+	}
+	if c.Unverified.Action != "delete" && c.Unverified.Action != "deactivate" {
+		p.addf("UNVERIFIED_ACTION must be delete or deactivate, got %s", c.Unverified.Action)
+	}
+	if c.Unverified.SweepInterval.Duration <= 0 {
+		p.addf("UNVERIFIED_SWEEP_INTERVAL must be positive, got %s", c.Unverified.SweepInterval.Duration)
+	}
+
+	// Validate policy versions, they are stored in columns of 50 characters
+	if len(c.Consent.TermsVersion) > 50 || len(c.Consent.PrivacyVersion) > 50 {
+		p.addf("CONSENT_TERMS_VERSION and CONSENT_PRIVACY_VERSION must be at most 50 characters")
+	}
+
+	// Validate invitation settings
+	if c.Invitation.TTL.Duration <= 0 {
+		p.addf("INVITATION_TTL must be positive, got %s", c.Invitation.TTL.Duration)
+	}
+
+	// Validate device binding
+	if !slices.Contains([]string{"off", "log", "enforce"}, c.DeviceBinding.Mode) {
+		p.addf("DEVICE_BINDING_MODE must be off, log or enforce, got %s", c.DeviceBinding.Mode)
+	}
+
+	if !slices.Contains([]string{"off", "block", "restrict"}, c.Email.VerificationPolicy) {
+		p.addf("EMAIL_VERIFICATION_POLICY must be off, block or restrict, got %s", c.Email.VerificationPolicy)
+	}
+	for _, entry := range c.Email.AllowedDomains {
+		if !emailDomainPattern.MatchString(strings.ToLower(strings.TrimPrefix(entry, "@"))) {
+			p.addf("EMAIL_ALLOWED_DOMAINS must contain domains like example.com or *.example.com, got %q", entry)
+		}
+	}
+
+	// Validate feature flags, only configured flags can be exposed in tokens by default
+	for _, name := range c.FeatureFlags.Claims {
+		if _, ok := c.FeatureFlags.Defaults[name]; !ok {
+			p.addf("FEATURE_FLAGS_CLAIMS must name flags of FEATURE_FLAGS_DEFAULTS, got %s", name)
+		}
+	}
+	if c.FeatureFlags.ReloadInterval.Duration <= 0 {
+		p.addf("FEATURE_FLAGS_RELOAD_INTERVAL must be positive, got %s", c.FeatureFlags.ReloadInterval.Duration)
+	}
+
+	if c.Admin.StatsCacheTTL.Duration <= 0 {
+		p.addf("ADMIN_STATS_CACHE_TTL must be positive, got %s", c.Admin.StatsCacheTTL.Duration)
+	}
+	if c.Tenants.CacheTTL.Duration <= 0 {
+		p.addf("TENANTS_CACHE_TTL must be positive, got %s", c.Tenants.CacheTTL.Duration)
+	}
+	for _, allowed := range c.Redirect.AllowedURLs {
+		if u, err := url.Parse(allowed); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			p.addf("REDIRECT_ALLOWED_URLS entry %q must be an http(s) URL like https://app.example.com/auth", allowed)
+		}
+	}
+	if c.Redirect.ChangePasswordURL != "" {
+		if u, err := url.Parse(c.Redirect.ChangePasswordURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.addf("REDIRECT_CHANGE_PASSWORD_URL must be an http(s) URL like https://app.example.com/settings/password, got %q", c.Redirect.ChangePasswordURL)
+		}
+	}
+
+	c.validateOAuth(&p)
+	c.validateRecovery(&p)
+	c.validateKerberos(&p)
+	c.validateSIWE(&p)
+
+	// Validate log and tracing settings
+	if c.Log.Format != "" && c.Log.Format != "json" && c.Log.Format != "console" {
+		p.addf("LOG_FORMAT must be json or console, got %s", c.Log.Format)
+	}
+	if c.Log.SampleRate < 1 {
+		p.addf("LOG_SAMPLE_RATE must be at least 1, got %d", c.Log.SampleRate)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		p.addf("TRACING_SAMPLE_RATIO must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	// Validate audit export
+	c.validateAudit(&p)
+	c.validateEncryption(&p)
+	c.validateShadowIdP(&p)
+
+	// Validate background jobs
+	if c.Jobs.Workers < 1 {
+		p.addf("JOBS_WORKERS must be at least 1, got %d", c.Jobs.Workers)
+	}
+	if c.Jobs.MaxAttempts < 1 {
+		p.addf("JOBS_MAX_ATTEMPTS must be at least 1, got %d", c.Jobs.MaxAttempts)
+	}
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
+
+func (c *Config) validateAudit(p *problems) {
+	switch c.Audit.Sink {
+	case "none":
+		return
+	case "syslog":
+		if !slices.Contains([]string{"cef", "leef"}, c.Audit.Format) {
+			p.addf("AUDIT_FORMAT must be cef or leef, got %s", c.Audit.Format)
+		}
+		if !slices.Contains([]string{"udp", "tcp"}, c.Audit.SyslogNetwork) {
+			p.addf("AUDIT_SYSLOG_NETWORK must be udp or tcp, got %s", c.Audit.SyslogNetwork)
+		}
+		if _, _, err := net.SplitHostPort(c.Audit.SyslogAddress); err != nil {
+			p.addf("AUDIT_SYSLOG_ADDRESS must be host:port, got %q", c.Audit.SyslogAddress)
+		}
+	case "http":
+		if u, err := url.Parse(c.Audit.HTTPURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.addf("AUDIT_HTTP_URL must be an http(s) URL, got %q", c.Audit.HTTPURL)
+		}
+	default:
+		p.addf("AUDIT_SINK must be none, syslog or http, got %s", c.Audit.Sink)
+		return
+	}
+
+	if c.Audit.BufferSize < 1 {
+		p.addf("AUDIT_BUFFER_SIZE must be at least 1, got %d", c.Audit.BufferSize)
+	}
+	if c.Audit.BatchSize < 1 {
+		p.addf("AUDIT_BATCH_SIZE must be at least 1, got %d", c.Audit.BatchSize)
+	}
+	if c.Audit.FlushInterval.Duration <= 0 {
+		p.addf("AUDIT_FLUSH_INTERVAL must be positive, got %s", c.Audit.FlushInterval.Duration)
+	}
+}
+
+func (c *Config) validateOAuth(p *problems) {
+	providers := []struct {
+		name   string
+		config OAuthProviderConfig
+	}{
+		{"GITHUB", c.OAuth.GitHub},
+		{"GITLAB", c.OAuth.GitLab},
+	}
+	for _, provider := range providers {
+		if !provider.config.Enabled() {
+			continue
+		}
+		if provider.config.ClientSecret == "" {
+			p.addf("OAUTH_%s_CLIENT_SECRET is required when OAUTH_%s_CLIENT_ID is set", provider.name, provider.name)
+		}
+		if u, err := url.Parse(provider.config.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.addf("OAUTH_%s_REDIRECT_URL must be an http(s) URL, got %q", provider.name, provider.config.RedirectURL)
+		}
+		if provider.config.URL != "" {
+			if u, err := url.Parse(provider.config.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				p.addf("OAUTH_%s_URL must be an http(s) URL, got %q", provider.name, provider.config.URL)
+			}
+		}
+	}
+	if c.OAuth.StateTTL.Duration <= 0 {
+		p.addf("OAUTH_STATE_TTL must be positive, got %s", c.OAuth.StateTTL.Duration)
+	}
+	if c.AccountEvents.Deactivate && !c.AccountEvents.Enabled() {
+		p.addf("ACCOUNT_EVENTS_DEACTIVATE requires ACCOUNT_EVENTS_APPLE_CLIENT_IDS or ACCOUNT_EVENTS_GOOGLE_CLIENT_IDS")
+	}
+}
+
+func (c *Config) validateRecovery(p *problems) {
+	if c.Recovery.MinLinkAge.Duration < 0 {
+		p.addf("RECOVERY_MIN_LINK_AGE must not be negative, got %s", c.Recovery.MinLinkAge.Duration)
+	}
+	if c.Recovery.MaxAttempts < 0 {
+		p.addf("RECOVERY_MAX_ATTEMPTS must not be negative, got %d", c.Recovery.MaxAttempts)
+	}
+	if c.Recovery.MaxAttempts > 0 && c.Recovery.AttemptWindow.Duration <= 0 {
+		p.addf("RECOVERY_ATTEMPT_WINDOW must be positive, got %s", c.Recovery.AttemptWindow.Duration)
+	}
+}
+
+func (c *Config) validateKerberos(p *problems) {
+	if !c.Kerberos.Enabled() {
+		return
+	}
+	if len(c.Kerberos.Realms) == 0 {
+		p.addf("KERBEROS_REALMS is required when KERBEROS_KEYTAB_PATH is set")
+	}
+	if !slices.Contains([]string{"username", "email"}, c.Kerberos.UserMapping) {
+		p.addf("KERBEROS_USER_MAPPING must be username or email, got %s", c.Kerberos.UserMapping)
+	}
+	if c.Kerberos.MaxClockSkew.Duration <= 0 {
+		p.addf("KERBEROS_MAX_CLOCK_SKEW must be positive, got %s", c.Kerberos.MaxClockSkew.Duration)
+	}
+}
+
+func (c *Config) validateSIWE(p *problems) {
+	if !c.SIWE.Enabled() {
+		return
+	}
+	if len(c.SIWE.ChainIDs) == 0 {
+		p.addf("SIWE_CHAIN_IDS is required when SIWE_DOMAIN is set")
+	}
+	for _, id := range c.SIWE.ChainIDs {
+		if id <= 0 {
+			p.addf("SIWE_CHAIN_IDS entries must be positive, got %d", id)
+		}
+	}
+	if c.SIWE.NonceTTL.Duration <= 0 {
+		p.addf("SIWE_NONCE_TTL must be positive, got %s", c.SIWE.NonceTTL.Duration)
+	}
+}
+
+func (c *Config) validateShadowIdP(p *problems) {
+	switch c.ShadowIdP.Provider {
+	case "none":
+		return
+	case "keycloak":
+	default:
+		p.addf("SHADOW_IDP_PROVIDER must be none or keycloak, got %s", c.ShadowIdP.Provider)
+		return
+	}
+	if c.ShadowIdP.URL == "" || c.ShadowIdP.Realm == "" || c.ShadowIdP.ClientID == "" || c.ShadowIdP.ClientSecret == "" {
+		p.addf("SHADOW_IDP_URL, SHADOW_IDP_REALM, SHADOW_IDP_CLIENT_ID and SHADOW_IDP_CLIENT_SECRET are required when SHADOW_IDP_PROVIDER is %s", c.ShadowIdP.Provider)
+	}
+	if c.ShadowIdP.Timeout.Duration <= 0 {
+		p.addf("SHADOW_IDP_TIMEOUT must be positive, got %s", c.ShadowIdP.Timeout.Duration)
+	}
+	if c.ShadowIdP.Concurrency <= 0 {
+		p.addf("SHADOW_IDP_CONCURRENCY must be positive, got %d", c.ShadowIdP.Concurrency)
+	}
+}
+
+func (c *Config) validateEncryption(p *problems) {
+	ids := make(map[string]bool, len(c.Encryption.Keys))
+	for _, entry := range c.Encryption.Keys {
+		id, encoded, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if key, err := base64.StdEncoding.DecodeString(encoded); id == "" || err != nil || len(key) != 32 {
+			p.addf("ENCRYPTION_KEYS entries must be id:key with 32 base64-encoded bytes, got one with id %q", id)
+			continue
+		}
+		if ids[id] {
+			p.addf("ENCRYPTION_KEYS contains key %s twice", id)
+		}
+		ids[id] = true
+	}
+	if c.Encryption.ReencryptInterval.Duration <= 0 {
+		p.addf("ENCRYPTION_REENCRYPT_INTERVAL must be positive, got %s", c.Encryption.ReencryptInterval.Duration)
+	}
+	if c.Encryption.ReencryptBatchSize < 1 {
+		p.addf("ENCRYPTION_REENCRYPT_BATCH_SIZE must be at least 1, got %d", c.Encryption.ReencryptBatchSize)
+	}
+}
+
+func (c *Config) validateServer(p *problems) {
+	validatePort(p, "SERVER_PORT", c.Server.Port)
+	if c.Internal.Enabled() {
+		validatePort(p, "INTERNAL_PORT", c.Internal.Port)
+		if c.Internal.Port == c.Server.Port {
+			p.addf("INTERNAL_PORT must differ from SERVER_PORT")
+		}
+	}
+	if c.Internal.TLSEnabled() || c.Internal.TLSKeyPath != "" || c.Internal.MTLSEnabled() {
+		if !c.Internal.Enabled() {
+			p.addf("INTERNAL_TLS_* settings require INTERNAL_PORT")
+		}
+		if c.Internal.TLSCertPath == "" || c.Internal.TLSKeyPath == "" {
+			p.addf("INTERNAL_TLS_CERT_PATH and INTERNAL_TLS_KEY_PATH must be set together")
+		}
+	}
+	if len(c.Internal.AllowedSPIFFEIDs) > 0 && !c.Internal.MTLSEnabled() {
+		p.addf("INTERNAL_ALLOWED_SPIFFE_IDS requires INTERNAL_TLS_CLIENT_CA_PATH")
+	}
+	for _, id := range c.Internal.AllowedSPIFFEIDs {
+		if u, err := url.Parse(id); err != nil || u.Scheme != "spiffe" || u.Host == "" {
+			p.addf("INTERNAL_ALLOWED_SPIFFE_IDS must contain SPIFFE IDs like spiffe://example.org/service, got %q", id)
+		}
+	}
+	if c.Debug.Enabled && !c.Internal.Enabled() {
+		p.addf("DEBUG_ENABLED requires INTERNAL_PORT, debug endpoints are never served on the public listener")
+	}
+	if c.ExtAuthz.Enabled {
+		if !c.Internal.Enabled() {
+			p.addf("EXT_AUTHZ_ENABLED requires INTERNAL_PORT, ext_authz is never served on the public listener")
+		}
+		if !strings.HasPrefix(c.ExtAuthz.PathPrefix, "/") || strings.HasSuffix(c.ExtAuthz.PathPrefix, "/") {
+			p.addf("EXT_AUTHZ_PATH_PREFIX must be a path without trailing slash like /ext_authz, got %q", c.ExtAuthz.PathPrefix)
+		}
+	}
+	if c.Server.ReadTimeout.Duration <= 0 {
+		p.addf("SERVER_READ_TIMEOUT must be positive, got %s", c.Server.ReadTimeout.Duration)
+	}
+	if c.Server.WriteTimeout.Duration <= 0 {
+		p.addf("SERVER_WRITE_TIMEOUT must be positive, got %s", c.Server.WriteTimeout.Duration)
+	}
+	if c.Server.DrainTimeout.Duration <= 0 {
+		p.addf("SERVER_DRAIN_TIMEOUT must be positive, got %s", c.Server.DrainTimeout.Duration)
+	}
+	if c.Server.DrainDelay.Duration < 0 {
+		p.addf("SERVER_DRAIN_DELAY must not be negative, got %s", c.Server.DrainDelay.Duration)
+	}
+}
+
+func (c *Config) validateStorage(p *problems) {
+	// Validate development storage
+	if c.DevStorage != "" && c.DevStorage != DevStorageMemory {
+		p.addf("DEV_STORAGE must be empty or %s, got %s", DevStorageMemory, c.DevStorage)
+	}
+	if c.InMemoryStorage() {
+		// Database and Redis settings are not used
+		return
+	}
+
+	// Validate database settings
+	switch c.Database.Driver {
+	case DatabaseDriverPostgres:
+		// The other settings are ignored with a URL
+		if c.Postgres.URL == "" {
+			validatePort(p, "POSTGRES_PORT", c.Postgres.Port)
+		}
+		if (c.Postgres.SSLCert == "") != (c.Postgres.SSLKey == "") {
+			p.addf("POSTGRES_SSLCERT and POSTGRES_SSLKEY must be set together")
+		}
+		if c.Postgres.StatementTimeout.Duration < 0 {
+			p.addf("POSTGRES_STATEMENT_TIMEOUT must not be negative, got %s", c.Postgres.StatementTimeout.Duration)
+		}
+	case DatabaseDriverSQLite:
+		if c.Database.SQLitePath == "" {
+			p.addf("DATABASE_SQLITE_PATH is required when DATABASE_DRIVER is %s", DatabaseDriverSQLite)
+		}
+	default:
+		p.addf("DATABASE_DRIVER must be %s or %s, got %s", DatabaseDriverPostgres, DatabaseDriverSQLite, c.Database.Driver)
+	}
+	if c.Database.SlowQueryThreshold.Duration < 0 {
+		p.addf("DATABASE_SLOW_QUERY_THRESHOLD must not be negative, got %s", c.Database.SlowQueryThreshold.Duration)
+	}
+
+	validatePort(p, "REDIS_PORT", c.Redis.Port)
+	if c.Redis.DB < 0 {
+		p.addf("REDIS_DB must not be negative, got %d", c.Redis.DB)
+	}
+	if !c.Redis.TLSEnabled && (c.Redis.TLSCAPath != "" || c.Redis.TLSCertPath != "" || c.Redis.TLSKeyPath != "" || c.Redis.TLSInsecureSkipVerify) {
+		p.addf("REDIS_TLS_* settings require REDIS_TLS_ENABLED")
+	}
+	if (c.Redis.TLSCertPath == "") != (c.Redis.TLSKeyPath == "") {
+		p.addf("REDIS_TLS_CERT_PATH and REDIS_TLS_KEY_PATH must be set together")
+	}
+	if c.Redis.MaxRetries < 0 {
+		p.addf("REDIS_MAX_RETRIES must not be negative, got %d", c.Redis.MaxRetries)
+	}
+	if c.Redis.MinRetryBackoff.Duration > c.Redis.MaxRetryBackoff.Duration {
+		p.addf("REDIS_MIN_RETRY_BACKOFF must not exceed REDIS_MAX_RETRY_BACKOFF")
+	}
+
+	if c.Startup.RetryMaxWait.Duration < 0 {
+		p.addf("STARTUP_RETRY_MAX_WAIT must not be negative, got %s", c.Startup.RetryMaxWait.Duration)
+	}
+	if c.Startup.RetryInitialBackoff.Duration <= 0 || c.Startup.RetryMaxBackoff.Duration < c.Startup.RetryInitialBackoff.Duration {
+		p.addf("STARTUP_RETRY_INITIAL_BACKOFF must be positive and at most STARTUP_RETRY_MAX_BACKOFF")
+	}
+}
+
+func (c *Config) validateSecurity(p *problems) {
+	switch {
+	case c.JWT.Secret == "":
+		p.addf("JWT_SECRET is required")
+	case len(c.JWT.Secret) < minJWTSecretLength:
+		p.addf("JWT_SECRET must be at least %d characters long", minJWTSecretLength)
+	}
+	for _, secret := range c.JWT.PreviousSecrets {
+		if len(secret) < minJWTSecretLength {
+			p.addf("JWT_PREVIOUS_SECRETS must be at least %d characters long", minJWTSecretLength)
+			break
+		}
+	}
+	if c.JWT.Keyring != "config" && c.JWT.Keyring != "redis" {
+		p.addf("JWT_KEYRING must be config or redis, got %s", c.JWT.Keyring)
+	}
+	if c.JWT.KeyringReloadInterval.Duration <= 0 {
+		p.addf("JWT_KEYRING_RELOAD_INTERVAL must be positive, got %s", c.JWT.KeyringReloadInterval.Duration)
+	}
+	if c.JWT.AccessTokenExpiry.Duration <= 0 {
+		p.addf("JWT_ACCESS_TOKEN_EXPIRY must be positive, got %s", c.JWT.AccessTokenExpiry.Duration)
+	}
+	if c.JWT.RefreshTokenExpiry.Duration <= 0 {
+		p.addf("JWT_REFRESH_TOKEN_EXPIRY must be positive, got %s", c.JWT.RefreshTokenExpiry.Duration)
+	}
+	if c.JWT.AccessTokenFormat != "jwt" && c.JWT.AccessTokenFormat != "opaque" {
+		p.addf("JWT_ACCESS_TOKEN_FORMAT must be jwt or opaque, got %s", c.JWT.AccessTokenFormat)
+	}
+	if c.JWT.Leeway.Duration < 0 {
+		p.addf("JWT_LEEWAY must not be negative, got %s", c.JWT.Leeway.Duration)
+	}
+	if c.JWT.ExpiryGrace.Duration < 0 || c.JWT.ExpiryGrace.Duration > c.JWT.AccessTokenExpiry.Duration {
+		p.addf("JWT_EXPIRY_GRACE must be between 0 and JWT_ACCESS_TOKEN_EXPIRY, got %s", c.JWT.ExpiryGrace.Duration)
+	}
+	if c.JWT.ValidationCacheTTL.Duration < 0 || c.JWT.ValidationCacheTTL.Duration > maxValidationCacheTTL {
+		p.addf("JWT_VALIDATION_CACHE_TTL must be between 0 and %s, got %s", maxValidationCacheTTL, c.JWT.ValidationCacheTTL.Duration)
+	}
+	if c.JWT.ValidationCacheTTL.Duration > 0 && c.JWT.ValidationCacheSize <= 0 {
+		p.addf("JWT_VALIDATION_CACHE_SIZE must be positive, got %d", c.JWT.ValidationCacheSize)
+	}
+	if slices.Contains(c.JWT.Audience, "") {
+		p.addf("JWT_AUDIENCE must not contain empty entries")
+	}
+	if c.Session.MaxPerUser < 0 {
+		p.addf("SESSION_MAX_PER_USER must not be negative, got %d", c.Session.MaxPerUser)
+	}
+	if c.Session.HistoryRetention.Duration < 0 {
+		p.addf("SESSION_HISTORY_RETENTION must not be negative, got %s", c.Session.HistoryRetention.Duration)
+	}
+	if c.Session.CleanupInterval.Duration <= 0 {
+		p.addf("SESSION_CLEANUP_INTERVAL must be positive, got %s", c.Session.CleanupInterval.Duration)
+	}
+
+	if c.Security.BCryptCost < minBCryptCost || c.Security.BCryptCost > maxBCryptCost {
+		p.addf("BCRYPT_COST must be between %d and %d, got %d", minBCryptCost, maxBCryptCost, c.Security.BCryptCost)
+	}
+	if c.Security.BCryptConcurrency < 0 {
+		p.addf("BCRYPT_CONCURRENCY must not be negative, got %d", c.Security.BCryptConcurrency)
+	}
+	if c.Security.BCryptQueueSize < 0 {
+		p.addf("BCRYPT_QUEUE_SIZE must not be negative, got %d", c.Security.BCryptQueueSize)
+	}
+	if c.Security.RateLimitRequests < 1 {
+		p.addf("RATE_LIMIT_REQUESTS must be at least 1, got %d", c.Security.RateLimitRequests)
+	}
+	if c.Security.RateLimitWindow.Duration <= 0 {
+		p.addf("RATE_LIMIT_WINDOW must be positive, got %s", c.Security.RateLimitWindow.Duration)
+	}
+	if c.Security.RateLimitRestrictedPercent < 1 || c.Security.RateLimitRestrictedPercent > 100 {
+		p.addf("RATE_LIMIT_RESTRICTED_PERCENT must be between 1 and 100, got %d", c.Security.RateLimitRestrictedPercent)
+	}
+
+	// A request outliving SERVER_WRITE_TIMEOUT gets its connection closed instead of a 504
+	validateRequestTimeout(p, "REQUEST_TIMEOUT", c.Security.RequestTimeout.Duration, c.Server.WriteTimeout.Duration)
+	for _, route := range slices.Sorted(maps.Keys(c.Security.RequestTimeouts)) {
+		validateRequestTimeout(p, "REQUEST_TIMEOUTS entry "+route, c.Security.RequestTimeouts[route].Duration, c.Server.WriteTimeout.Duration)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		validateCORSOrigin(p, "CORS_ALLOWED_ORIGINS entry", origin)
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(c.CORS.RouteOrigins)) {
+		if !strings.HasPrefix(prefix, "/") {
+			p.addf("CORS_ROUTE_ORIGINS prefix %q must be a path like /api/v1/admin", prefix)
+		}
+		for _, origin := range c.CORS.RouteOrigins[prefix] {
+			validateCORSOrigin(p, "CORS_ROUTE_ORIGINS entry of "+prefix, origin)
+		}
+	}
+	// Browsers cap the cache of preflights at 2 hours (Chromium) to 24 hours (Firefox)
+	if c.CORS.MaxAge.Duration < 0 || c.CORS.MaxAge.Duration > 24*time.Hour {
+		p.addf("CORS_MAX_AGE must be between 0 and 24h, got %s", c.CORS.MaxAge.Duration)
+	}
+}
+
+// validateCORSOrigin checks an origin like https://app.example.com, https://*.example.com or *
+func validateCORSOrigin(p *problems, name, origin string) {
+	if origin == "*" {
+		return
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		p.addf("%s %q must be an origin like https://app.example.com, https://*.example.com or *", name, origin)
+		return
+	}
+	if host := u.Hostname(); strings.Contains(host, "*") {
+		if parent, ok := strings.CutPrefix(host, "*."); !ok || strings.Contains(parent, "*") || !strings.Contains(parent, ".") {
+			p.addf("%s %q may only start with *. followed by a domain like example.com", name, origin)
+		}
+	}
+}
+
+// validateProduction enforces settings that are optional in development
+func (c *Config) validateProduction(p *problems) {
+	if !c.IsProduction() {
+		return
+	}
+
+	if c.InMemoryStorage() {
+		p.addf("DEV_STORAGE=%s is not allowed in production", DevStorageMemory)
+	}
+	if len(c.CORS.AllowedOrigins) == 0 {
+		p.addf("CORS_ALLOWED_ORIGINS must not be empty in production")
+	}
+	// Responses allow credentials, * would let any site act with the cookies of the user
+	if slices.Contains(c.CORS.AllowedOrigins, "*") {
+		p.addf("CORS_ALLOWED_ORIGINS must not contain * in production")
+	}
+	for _, prefix := range slices.Sorted(maps.Keys(c.CORS.RouteOrigins)) {
+		if slices.Contains(c.CORS.RouteOrigins[prefix], "*") {
+			p.addf("CORS_ROUTE_ORIGINS entry of %s must not contain * in production", prefix)
+		}
+	}
+	if !c.Cookie.Secure {
+		p.addf("COOKIE_SECURE must be true in production")
+	}
+	// Sessions, blacklists and rate limits live in Redis, its server must be verified
+	if c.Redis.TLSInsecureSkipVerify {
+		p.addf("REDIS_TLS_INSECURE_SKIP_VERIFY is not allowed in production")
+	}
+}
+
+func validateRequestTimeout(p *problems, name string, timeout, writeTimeout time.Duration) {
+	switch {
+	case timeout <= 0:
+		p.addf("%s must be positive, got %s", name, timeout)
+	case writeTimeout > 0 && timeout >= writeTimeout:
+		p.addf("%s must be shorter than SERVER_WRITE_TIMEOUT (%s), got %s", name, writeTimeout, timeout)
+	}
+}
+
+func validatePort(p *problems, name, port string) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		p.addf("%s must be a port between 1 and 65535, got %q", name, port)
+	}
+}
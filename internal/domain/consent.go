@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// Policy documents users consent to
+const (
+	ConsentDocumentTerms   = "terms"
+	ConsentDocumentPrivacy = "privacy"
+)
+
+// Consent records that a user accepted a version of a policy document
+// Consents are never updated, accepting a new version adds a record, so they form an audit trail.
+type Consent struct {
+	ID         string    `json:"id" db:"id"`
+	UserID     string    `json:"user_id" db:"user_id"`
+	Document   string    `json:"document" db:"document"` // terms, privacy
+	Version    string    `json:"version" db:"version"`
+	AcceptedAt time.Time `json:"accepted_at" db:"accepted_at"`
+	IPAddress  *string   `json:"ip_address" db:"ip_address"`
+}
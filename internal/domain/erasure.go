@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// Erasure requesters
+const (
+	ErasureRequestedByUser  = "user"
+	ErasureRequestedByAdmin = "admin"
+	// ErasureRequestedByRetention is the erasure of an account that was never verified
+	ErasureRequestedByRetention = "retention"
+)
+
+// Erasure modes
+const (
+	// ErasureModeDelete deletes the user row along with everything referencing it
+	ErasureModeDelete = "delete"
+	// ErasureModeAnonymize keeps the user row, stripped of personal data and deactivated
+	ErasureModeAnonymize = "anonymize"
+)
+
+// Erasure represents a right-to-be-forgotten request, kept as a tombstone once carried out
+// It outlives the user and holds no personal data, the email is only kept as a SHA-256 hash.
+type Erasure struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      string     `json:"user_id" db:"user_id"`
+	EmailHash   string     `json:"email_hash" db:"email_hash"`
+	RequestedBy string     `json:"requested_by" db:"requested_by"` // user, admin, retention
+	Mode        string     `json:"mode" db:"mode"`                 // delete, anonymize
+	RequestedAt time.Time  `json:"requested_at" db:"requested_at"`
+	EraseAfter  time.Time  `json:"erase_after" db:"erase_after"`
+	ErasedAt    *time.Time `json:"erased_at" db:"erased_at"`
+}
+
+// IsPending reports whether the erasure hasn't been carried out yet
+func (e *Erasure) IsPending() bool {
+	return e.ErasedAt == nil
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"hash/fnv"
+	"regexp"
+	"slices"
+)
+
+var featureFlagNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// IsValidFeatureFlagName reports whether name is 1-64 lowercase letters, digits, dots, underscores or hyphens
+func IsValidFeatureFlagName(name string) bool {
+	return featureFlagNamePattern.MatchString(name)
+}
+
+// FeatureFlag turns a feature on for a share of users and for members of tenants
+type FeatureFlag struct {
+	Name string `json:"name"`
+	// Percentage of users the flag is on for, 0 turns it off and 100 on for everyone
+	Percentage int `json:"percentage"`
+	// Tenants are organizations the flag is on for regardless of the percentage
+	Tenants []string `json:"tenants,omitempty"`
+	// Claim exposes the flag in the features claim of access tokens
+	Claim bool `json:"claim"`
+}
+
+// EnabledFor reports whether the flag is on for a user, a member of orgID unless it is empty
+// Users are assigned to the percentage by a hash of the flag name and user ID, so raising it
+// keeps the flag on for users who had it already.
+func (f FeatureFlag) EnabledFor(userID, orgID string) bool {
+	if orgID != "" && slices.Contains(f.Tenants, orgID) {
+		return true
+	}
+	if f.Percentage <= 0 {
+		return false
+	}
+	if f.Percentage >= 100 {
+		return true
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(f.Name + ":" + userID))
+	return int(h.Sum32()%100) < f.Percentage
+}
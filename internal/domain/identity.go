@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Types of identities
+const (
+	// IdentityTypeEthereum is an Ethereum wallet, the subject is its EIP-55 checksummed address
+	IdentityTypeEthereum = "ethereum"
+	// IdentityTypeKerberos is a Kerberos principal, the subject is name@REALM with the name
+	// lowercased and the realm uppercased
+	IdentityTypeKerberos = "kerberos"
+)
+
+// Identity is a credential a user signs in with besides email and password, e.g. a wallet
+type Identity struct {
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	Type   string `json:"type" db:"type"`
+	// Subject identifies the credential within its type, e.g. a wallet address
+	Subject   string    `json:"subject" db:"subject"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
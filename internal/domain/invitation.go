@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+// Invitation statuses
+const (
+	InvitationStatusPending  = "pending"
+	InvitationStatusAccepted = "accepted"
+	InvitationStatusRevoked  = "revoked"
+	InvitationStatusExpired  = "expired"
+)
+
+// Invitation represents a signup invitation bound to an email
+// Only the SHA-256 hash of the token is stored, the token is handed out once on creation.
+type Invitation struct {
+	ID              string  `json:"id" db:"id"`
+	TokenHash       string  `json:"-" db:"token_hash"`
+	Email           string  `json:"email" db:"email"`
+	EmailNormalized string  `json:"-" db:"email_normalized"`
+	Role            *string `json:"role" db:"role"`
+	Tenant          *string `json:"tenant" db:"tenant"`
+	// InvitedBy is the inviting user, nil for invitations created by admins
+	InvitedBy  *string    `json:"invited_by" db:"invited_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at" db:"accepted_at"`
+	AcceptedBy *string    `json:"accepted_by" db:"accepted_by"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+// Status returns the status of the invitation at the given time
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationStatusExpired
+	default:
+		return InvitationStatusPending
+	}
+}
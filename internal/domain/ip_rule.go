@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// IP rule actions
+const (
+	IPRuleAllow = "allow"
+	IPRuleDeny  = "deny"
+)
+
+// IPRule represents an allow or deny rule for a CIDR range
+type IPRule struct {
+	ID        string    `json:"id" db:"id"`
+	CIDR      string    `json:"cidr" db:"cidr"`
+	Action    string    `json:"action" db:"action"` // allow, deny
+	Comment   *string   `json:"comment" db:"comment"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
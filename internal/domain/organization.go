@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// Organization roles, from the most to the least privileged
+const (
+	// OrgRoleOwner manages members, including other owners
+	OrgRoleOwner = "owner"
+	// OrgRoleAdmin manages members except owners
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization represents a team of users
+type Organization struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Membership represents the role of a user in an organization
+type Membership struct {
+	OrgID     string    `json:"org_id" db:"org_id"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Role      string    `json:"role" db:"role"` // owner, admin, member
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// IsValidOrgRole reports whether role is an organization role
+func IsValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+// CanManageMembers reports whether the role can add, change and remove members
+func (m *Membership) CanManageMembers() bool {
+	return m.Role == OrgRoleOwner || m.Role == OrgRoleAdmin
+}
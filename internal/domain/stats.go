@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// UserCounts counts the users of the service
+type UserCounts struct {
+	Total    int64
+	Active   int64
+	Verified int64
+}
+
+// DailyCount is a count of one UTC day
+type DailyCount struct {
+	Day   time.Time
+	Count int64
+}
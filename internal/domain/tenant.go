@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"regexp"
+	"time"
+)
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,99}$`)
+
+// IsValidTenantID reports whether id is 1-100 lowercase letters, digits, dots, underscores or hyphens
+func IsValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// Tenant is a frontend of a multi-tenant deployment with its own email sender, branding,
+// redirect URLs, cookie domain and allowed email domains. Unset settings fall back to the service
+// configuration.
+type Tenant struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// EmailFrom is the sender of emails to users of the tenant
+	EmailFrom  *string `json:"email_from" db:"email_from"`
+	BrandName  *string `json:"brand_name" db:"brand_name"`
+	LogoURL    *string `json:"logo_url" db:"logo_url"`
+	BrandColor *string `json:"brand_color" db:"brand_color"`
+	// RedirectURLs are where links in emails may send users back to, the first one is the default
+	RedirectURLs []string `json:"redirect_urls" db:"redirect_urls"`
+	CookieDomain *string  `json:"cookie_domain" db:"cookie_domain"`
+	// AllowedEmailDomains restricts registration to emails of these domains, the configured ones when empty
+	AllowedEmailDomains []string  `json:"allowed_email_domains" db:"allowed_email_domains"`
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
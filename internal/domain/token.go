@@ -8,6 +8,13 @@ type TokenClaims struct {
 	Email  string `json:"email"`
 	Exp    int64  `json:"exp"`
 	Iat    int64  `json:"iat"`
+	// OrgID and OrgRole are set when the token is scoped to an organization
+	OrgID   string `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+	// Features are the feature flags exposed to clients that are on for the user
+	Features []string `json:"features,omitempty"`
+	// Restricted is set for users limited by an admin, resource servers may refuse them some actions
+	Restricted bool `json:"restricted,omitempty"`
 }
 
 // TokenPair represents a pair of access and refresh tokens
@@ -1,36 +1,98 @@
 package domain
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // User represents a user in the system
 type User struct {
 	ID              string     `json:"id" db:"id"`
 	Email           string     `json:"email" db:"email"`
+	EmailNormalized string     `json:"-" db:"email_normalized"`
+	Username        *string    `json:"username" db:"username"`
 	PasswordHash    string     `json:"-" db:"password_hash"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 	LastLoginAt     *time.Time `json:"last_login_at" db:"last_login_at"`
+	// LastLoginIP is the client IP of the last login, PreviousLogin* describe the login before it
+	LastLoginIP     *string    `json:"last_login_ip" db:"last_login_ip"`
+	PreviousLoginAt *time.Time `json:"previous_login_at" db:"previous_login_at"`
+	PreviousLoginIP *string    `json:"previous_login_ip" db:"previous_login_ip"`
+	LoginCount      int        `json:"login_count" db:"login_count"`
 	IsActive        bool       `json:"is_active" db:"is_active"`
 	IsEmailVerified bool       `json:"is_email_verified" db:"is_email_verified"`
+	FirstName       *string    `json:"first_name" db:"first_name"`
+	LastName        *string    `json:"last_name" db:"last_name"`
+	DisplayName     *string    `json:"display_name" db:"display_name"`
+	AvatarURL       *string    `json:"avatar_url" db:"avatar_url"`
+	Locale          *string    `json:"locale" db:"locale"`
+	// Restriction is set by admins on abusive accounts, one of the Restriction* levels
+	Restriction string `json:"restriction" db:"restriction"`
+	// UnverifiedWarnedAt is when the user was warned that the account expires unless the email is verified
+	UnverifiedWarnedAt *time.Time `json:"-" db:"unverified_warned_at"`
 }
 
+// HasPlaceholderEmail reports whether the email is a placeholder under the reserved .invalid TLD,
+// e.g. of users created for wallets, that can't receive or verify emails
+func (u *User) HasPlaceholderEmail() bool {
+	return strings.HasSuffix(u.Email, ".invalid")
+}
+
+// Restriction levels of users
+const (
+	RestrictionNone = "none"
+	// RestrictionLimited users get access tokens with the restricted claim and lower rate limits
+	RestrictionLimited = "limited"
+	// RestrictionBanned users can't log in or refresh their tokens
+	RestrictionBanned = "banned"
+)
+
 // RefreshToken represents a refresh token in the system
 type RefreshToken struct {
-	ID         string    `json:"id" db:"id"`
-	UserID     string    `json:"user_id" db:"user_id"`
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	// SessionID is shared by the tokens rotated from one login, the ID of the first one
+	SessionID  string    `json:"session_id" db:"session_id"`
 	TokenHash  string    `json:"-" db:"token_hash"`
 	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	DeviceInfo *string   `json:"device_info" db:"device_info"`
 	IPAddress  *string   `json:"ip_address" db:"ip_address"`
+	// DeviceFingerprint is a hash of the device the token was issued to, nil when not bound
+	DeviceFingerprint *string `json:"-" db:"device_fingerprint"`
+	// RevokedAt and RevokeReason are set when the token is revoked, revoked tokens are kept
+	// for investigations until they are purged
+	RevokedAt    *time.Time `json:"revoked_at" db:"revoked_at"`
+	RevokeReason *string    `json:"revoke_reason" db:"revoke_reason"`
 }
 
+// Reasons of refresh token revocations
+const (
+	// TokenRevokeRotated is the revocation of a token replaced on refresh
+	TokenRevokeRotated = "rotated"
+	TokenRevokeLogout  = "logout"
+	// TokenRevokeSession is the revocation of a session by its user
+	TokenRevokeSession = "session_revoked"
+	// TokenRevokeSessionLimit is the eviction of the oldest sessions over the session limit
+	TokenRevokeSessionLimit = "session_limit"
+	// TokenRevokeRevocation is a revocation of all tokens of a user or of all users by an admin
+	TokenRevokeRevocation = "revocation"
+	// TokenRevokeClient is the revocation of a token by a client through the RFC 7009 endpoint
+	TokenRevokeClient = "client_revoked"
+)
+
 // OAuthProvider represents an OAuth provider connection for a user
 type OAuthProvider struct {
 	ID             string    `json:"id" db:"id"`
 	UserID         string    `json:"user_id" db:"user_id"`
-	Provider       string    `json:"provider" db:"provider"` // google, apple, facebook
+	Provider       string    `json:"provider" db:"provider"` // google, apple, facebook, github, gitlab
 	ProviderUserID string    `json:"provider_user_id" db:"provider_user_id"`
 	Email          *string   `json:"email" db:"email"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+
+	// AccessToken and RefreshToken are the encrypted tokens of the provider, nil unless stored
+	AccessToken    *string    `json:"-" db:"access_token"`
+	RefreshToken   *string    `json:"-" db:"refresh_token"`
+	TokenExpiresAt *time.Time `json:"-" db:"token_expires_at"`
 }
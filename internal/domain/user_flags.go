@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// UserFlags holds the notes and flags support keeps on a user, e.g. chargeback or abuse-suspect
+// They are edited through the admin API only and never shown to the user.
+type UserFlags struct {
+	UserID    string    `json:"user_id" db:"user_id"`
+	Notes     string    `json:"notes" db:"notes"`
+	Flags     []string  `json:"flags" db:"flags"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// UpdatedBy identifies who edited them last: admin for the admin token, or the SPIFFE ID of an internal service
+	UpdatedBy string `json:"updated_by" db:"updated_by"`
+}
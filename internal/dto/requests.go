@@ -1,14 +1,33 @@
 package dto
 
+import "time"
+
 // RegisterRequest represents a registration request
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email" validate:"required,email"`
-	Password string `json:"password" binding:"required,min=8" validate:"required,min=8"`
+	Email    string  `json:"email" binding:"required,email" validate:"required,email"`
+	Username *string `json:"username,omitempty" binding:"omitempty,min=3,max=32" validate:"omitempty,min=3,max=32"`
+	Password string  `json:"password" binding:"required,min=8" validate:"required,min=8"`
+	// AcceptedTermsVersion and AcceptedPrivacyVersion are the policy versions the user accepted,
+	// required when the service publishes them
+	AcceptedTermsVersion   string `json:"accepted_terms_version,omitempty" example:"2024-01"`
+	AcceptedPrivacyVersion string `json:"accepted_privacy_version,omitempty" example:"2024-01"`
+}
+
+// RegisterWithInvitationRequest represents a registration request with an invitation
+// The email is the one the invitation was created for
+type RegisterWithInvitationRequest struct {
+	Username               *string `json:"username,omitempty" binding:"omitempty,min=3,max=32" validate:"omitempty,min=3,max=32"`
+	Password               string  `json:"password" binding:"required,min=8" validate:"required,min=8"`
+	AcceptedTermsVersion   string  `json:"accepted_terms_version,omitempty" example:"2024-01"`
+	AcceptedPrivacyVersion string  `json:"accepted_privacy_version,omitempty" example:"2024-01"`
 }
 
 // LoginRequest represents a login request
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email" validate:"required,email"`
+	// Identifier is either an email or a username
+	Identifier string `json:"identifier" binding:"required_without=Email" validate:"required_without=Email"`
+	// Email is kept for backward compatibility, use Identifier instead
+	Email    string `json:"email,omitempty" binding:"omitempty,email" validate:"omitempty,email"`
 	Password string `json:"password" binding:"required" validate:"required"`
 }
 
@@ -20,20 +39,242 @@ type AuthResponse struct {
 	User        UserInfo `json:"user"`
 }
 
+// TokenResponse represents an authentication response of API v2
+// The refresh token is returned in the body instead of a cookie
+type TokenResponse struct {
+	AuthResponse
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in"`
+	// ExpiresAt and RefreshExpiresAt are the RFC3339 expiry times of the tokens,
+	// so clients can refresh ahead of time
+	ExpiresAt        string `json:"expires_at" example:"2025-01-01T12:15:00Z"`
+	RefreshExpiresAt string `json:"refresh_expires_at" example:"2025-01-08T12:00:00Z"`
+	// SessionID identifies the session in /auth/sessions and stays the same on refresh
+	SessionID string `json:"session_id"`
+}
+
+// RefreshRequest represents a token refresh request of API v2
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required" validate:"required"`
+}
+
+// LogoutRequest represents a logout request of API v2
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // UserInfo represents user information in response
 type UserInfo struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
+	ID       string  `json:"id"`
+	Email    string  `json:"email"`
+	Username *string `json:"username,omitempty"`
 }
 
 // UserResponse represents a user response
+// PreviousLoginAt and PreviousLoginIP describe the login before the last one, so that clients
+// can show a "last login from X at Y" banner in the current session
 type UserResponse struct {
 	ID              string  `json:"id"`
 	Email           string  `json:"email"`
+	Username        *string `json:"username"`
 	CreatedAt       string  `json:"created_at"`
 	UpdatedAt       string  `json:"updated_at"`
 	LastLoginAt     *string `json:"last_login_at"`
+	LastLoginIP     *string `json:"last_login_ip"`
+	PreviousLoginAt *string `json:"previous_login_at"`
+	PreviousLoginIP *string `json:"previous_login_ip"`
+	LoginCount      int     `json:"login_count"`
 	IsEmailVerified bool    `json:"is_email_verified"`
+	FirstName       *string `json:"first_name"`
+	LastName        *string `json:"last_name"`
+	DisplayName     *string `json:"display_name"`
+	AvatarURL       *string `json:"avatar_url"`
+	Locale          *string `json:"locale"`
+}
+
+// AdminUserResponse represents a user found by an admin search
+type AdminUserResponse struct {
+	UserResponse
+	IsActive bool `json:"is_active"`
+	// Restriction is none, limited or banned
+	Restriction string `json:"restriction" example:"none"`
+	// MatchedBy tells what the query matched: id, provider_user_id or email, or flag when listing flagged users
+	MatchedBy string `json:"matched_by" example:"email"`
+	// Provider is the provider of the account matched by provider_user_id
+	Provider string `json:"provider,omitempty" example:"github"`
+	// Flags are the support flags of the user
+	Flags []string `json:"flags" example:"chargeback"`
+}
+
+// AdminUserDetailsResponse represents a user with the notes and flags support keeps on it
+type AdminUserDetailsResponse struct {
+	UserResponse
+	IsActive bool `json:"is_active"`
+	// Restriction is none, limited or banned
+	Restriction string   `json:"restriction" example:"none"`
+	Notes       string   `json:"notes" example:"Asked for a refund on 2024-01-02"`
+	Flags       []string `json:"flags" example:"chargeback,abuse-suspect"`
+	// FlagsUpdatedAt and FlagsUpdatedBy tell when and by whom notes or flags were last edited
+	FlagsUpdatedAt *string `json:"flags_updated_at"`
+	FlagsUpdatedBy *string `json:"flags_updated_by" example:"admin"`
+}
+
+// SetUserRestrictionRequest represents a request to change the restriction level of a user
+type SetUserRestrictionRequest struct {
+	Restriction string `json:"restriction" binding:"required,oneof=none limited banned" validate:"required,oneof=none limited banned" example:"limited"`
+}
+
+// LinkKerberosPrincipalRequest represents a request to link a Kerberos principal to a user
+type LinkKerberosPrincipalRequest struct {
+	Principal string `json:"principal" binding:"required" validate:"required" example:"jdoe@CORP.EXAMPLE.COM"`
+}
+
+// UserRestrictionResponse represents the restriction level of a user
+type UserRestrictionResponse struct {
+	UserID      string `json:"user_id"`
+	Restriction string `json:"restriction" example:"limited"`
+	// SessionsRevoked is the number of sessions ended by a ban
+	SessionsRevoked int64 `json:"sessions_revoked"`
+}
+
+// UpdateUserFlagsRequest represents a request to replace the notes and flags of a user
+// Flags are lowercase words separated by hyphens, e.g. "abuse-suspect"
+type UpdateUserFlagsRequest struct {
+	Notes string   `json:"notes" binding:"max=10000" validate:"max=10000"`
+	Flags []string `json:"flags" binding:"max=20" validate:"max=20"`
+}
+
+// UpdateProfileRequest represents a partial profile update request
+// Omitted fields are left unchanged, empty strings clear the field
+type UpdateProfileRequest struct {
+	Username    *string `json:"username" binding:"omitempty,min=3,max=32" validate:"omitempty,min=3,max=32"`
+	FirstName   *string `json:"first_name" binding:"omitempty,max=100" validate:"omitempty,max=100"`
+	LastName    *string `json:"last_name" binding:"omitempty,max=100" validate:"omitempty,max=100"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100" validate:"omitempty,max=100"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,max=2048,url" validate:"omitempty,max=2048,url"`
+	Locale      *string `json:"locale" binding:"omitempty,max=35,bcp47_language_tag" validate:"omitempty,max=35,bcp47_language_tag"`
+}
+
+// SetPasswordRequest represents a request to add a password to an account created with an OAuth provider
+type SetPasswordRequest struct {
+	Password string `json:"password" binding:"required,min=8" validate:"required,min=8"`
+}
+
+// RecoveryEmailRequest represents a request to change the email of an account recovered with a provider
+type RecoveryEmailRequest struct {
+	Email string `json:"email" binding:"required,email" validate:"required,email"`
+}
+
+// OAuthTokenRequest represents a request to exchange the login code of an OAuth sign-in for tokens
+type OAuthTokenRequest struct {
+	Code string `json:"code" binding:"required" validate:"required"`
+}
+
+// SIWEVerifyRequest represents a request to sign in with a signed EIP-4361 message
+type SIWEVerifyRequest struct {
+	Message string `json:"message" binding:"required,max=4096" validate:"required,max=4096"`
+	// Signature is the hex encoded personal_sign signature of the message
+	Signature string `json:"signature" binding:"required,max=200" validate:"required,max=200"`
+}
+
+// SIWENonceResponse represents a nonce for a sign-in with Ethereum message
+type SIWENonceResponse struct {
+	Nonce string `json:"nonce"`
+}
+
+// ProviderTokenResponse represents an access token of a linked provider account
+type ProviderTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	// ExpiresAt is omitted for tokens that don't expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UsernameAvailabilityResponse represents a username availability check response
+type UsernameAvailabilityResponse struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+}
+
+// SessionResponse represents an active session of the user
+type SessionResponse struct {
+	ID         string  `json:"id"`
+	CreatedAt  string  `json:"created_at"`
+	ExpiresAt  string  `json:"expires_at"`
+	DeviceInfo *string `json:"device_info"`
+	IPAddress  *string `json:"ip_address"`
+	// Location is where the session was started from, e.g. "Berlin, Germany", when GeoIP is enabled
+	Location *string `json:"location" example:"Berlin, Germany"`
+}
+
+// SessionEventResponse represents an event of the session events stream
+type SessionEventResponse struct {
+	// Type is session_revoked, password_changed or logout_all
+	Type string `json:"type" example:"session_revoked"`
+	// SessionID is the session that ended, for session_revoked
+	SessionID string `json:"session_id,omitempty"`
+	At        string `json:"at" example:"2026-01-02T03:04:05Z"`
+}
+
+// SessionEventsTicketResponse represents a ticket opening the session events stream
+type SessionEventsTicketResponse struct {
+	Ticket string `json:"ticket"`
+	// ExpiresIn is the number of seconds the ticket can be redeemed in
+	ExpiresIn int `json:"expires_in" example:"30"`
+}
+
+// IntrospectRequest represents a token introspection request (RFC 7662), form or JSON encoded
+type IntrospectRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+// RevokeTokenRequest represents a token revocation request (RFC 7009)
+// Clients authenticate with HTTP Basic or with client_id and client_secret in the form.
+type RevokeTokenRequest struct {
+	Token string `form:"token" binding:"required"`
+	// TokenTypeHint is access_token or refresh_token, it only decides which kind is looked up first
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// OAuthErrorResponse represents an error of the OAuth endpoints (RFC 6749 section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// IntrospectionResponse represents a token introspection response (RFC 7662)
+// Only Active is set for invalid, expired or revoked tokens
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Sub       string   `json:"sub,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	OrgID     string   `json:"org_id,omitempty"`
+	OrgRole   string   `json:"org_role,omitempty"`
+	Features  []string `json:"features,omitempty"`
+	// Restricted is set for users an admin limited
+	Restricted bool `json:"restricted,omitempty"`
+}
+
+// GatewayConfigResponse describes how access tokens are verified, for configuring API gateways
+// There is no JWKS URI: tokens are signed with HMAC secrets, which are shared with gateways out
+// of band. Gateways that can't hold the secret, and all of them for opaque tokens, introspect.
+type GatewayConfigResponse struct {
+	Issuer   string   `json:"issuer,omitempty"`
+	Audience []string `json:"audience,omitempty"`
+	// AccessTokenFormat is "jwt" for self-contained tokens or "opaque" for tokens only introspection checks
+	AccessTokenFormat string   `json:"access_token_format"`
+	SigningAlgorithms []string `json:"signing_algorithms"`
+	// IntrospectionEndpoint is the path of the RFC 7662 endpoint on this service
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	// Lifetimes and leeway are in seconds
+	AccessTokenLifetime  int64 `json:"access_token_lifetime"`
+	RefreshTokenLifetime int64 `json:"refresh_token_lifetime"`
+	Leeway               int64 `json:"leeway"`
 }
 
 // SuccessResponse represents a success response
@@ -43,7 +284,318 @@ type SuccessResponse struct {
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string      `json:"error"`
-	Message string      `json:"message"`
-	Details interface{} `json:"details,omitempty"`
+	Error string `json:"error"`
+	// Code is a machine-readable error code, returned by API v2 only
+	Code      string       `json:"code,omitempty"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError represents a request field that failed validation
+type FieldError struct {
+	// Field is the JSON name of the field, nested fields are separated by dots
+	Field string `json:"field" example:"password"`
+	// Rule is the validation rule the field breaks, e.g. required, email, min or, for passwords,
+	// the password policy rules min_length, uppercase, lowercase and number
+	Rule    string `json:"rule" example:"uppercase"`
+	Message string `json:"message" example:"Must contain an uppercase letter"`
+}
+
+// CreateIPRuleRequest represents a request to create an IP rule
+type CreateIPRuleRequest struct {
+	CIDR    string  `json:"cidr" binding:"required" validate:"required"`
+	Action  string  `json:"action" binding:"required,oneof=allow deny" validate:"required,oneof=allow deny"`
+	Comment *string `json:"comment,omitempty"`
+}
+
+// IPRuleResponse represents an IP rule response
+type IPRuleResponse struct {
+	ID        string  `json:"id"`
+	CIDR      string  `json:"cidr"`
+	Action    string  `json:"action"`
+	Comment   *string `json:"comment"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// SetFeatureFlagRequest represents a request to change a feature flag at runtime
+type SetFeatureFlagRequest struct {
+	// Percentage of users the flag is on for, 0 turns it off and 100 on for everyone
+	Percentage *int `json:"percentage" binding:"required,min=0,max=100" validate:"required,min=0,max=100"`
+	// Tenants are organization IDs the flag is on for regardless of the percentage
+	Tenants []string `json:"tenants,omitempty"`
+	// Claim exposes the flag in the features claim of access tokens
+	Claim bool `json:"claim"`
+}
+
+// FeatureFlagResponse represents a feature flag response
+type FeatureFlagResponse struct {
+	Name       string   `json:"name"`
+	Percentage int      `json:"percentage"`
+	Tenants    []string `json:"tenants"`
+	Claim      bool     `json:"claim"`
+	// Overridden is set when the flag was changed at runtime instead of being configured
+	Overridden bool `json:"overridden"`
+}
+
+// SaveTenantRequest represents a request to create a tenant or replace its settings
+type SaveTenantRequest struct {
+	Name string `json:"name" binding:"required,max=100" validate:"required,max=100" example:"Acme"`
+	// EmailFrom is the sender of emails to users of the tenant, the configured sender when empty
+	EmailFrom  *string `json:"email_from,omitempty" binding:"omitempty,max=255" validate:"omitempty,max=255" example:"Acme <no-reply@acme.com>"`
+	BrandName  *string `json:"brand_name,omitempty" binding:"omitempty,max=100" validate:"omitempty,max=100"`
+	LogoURL    *string `json:"logo_url,omitempty" example:"https://acme.com/logo.png"`
+	BrandColor *string `json:"brand_color,omitempty" example:"#1a2b3c"`
+	// RedirectURLs are where links in emails may send users back to, the first one is the default
+	RedirectURLs []string `json:"redirect_urls,omitempty"`
+	// CookieDomain overrides the domain of the refresh token cookie
+	CookieDomain *string `json:"cookie_domain,omitempty" example:".acme.com"`
+	// AllowedEmailDomains restricts registration to emails of these domains, the configured ones when empty
+	AllowedEmailDomains []string `json:"allowed_email_domains,omitempty" example:"acme.com,*.acme.com"`
+}
+
+// TenantResponse represents a tenant response
+type TenantResponse struct {
+	ID                  string   `json:"id"`
+	Name                string   `json:"name"`
+	EmailFrom           *string  `json:"email_from"`
+	BrandName           *string  `json:"brand_name"`
+	LogoURL             *string  `json:"logo_url"`
+	BrandColor          *string  `json:"brand_color"`
+	RedirectURLs        []string `json:"redirect_urls"`
+	CookieDomain        *string  `json:"cookie_domain"`
+	AllowedEmailDomains []string `json:"allowed_email_domains"`
+	CreatedAt           string   `json:"created_at"`
+	UpdatedAt           string   `json:"updated_at"`
+}
+
+// SetEmailDomainsRequest represents a request to replace the email domains allowed to register
+type SetEmailDomainsRequest struct {
+	// Domains like acme.com, *.acme.com matches its subdomains; empty falls back to EMAIL_ALLOWED_DOMAINS
+	Domains []string `json:"domains" example:"acme.com,*.acme.com"`
+}
+
+// EmailDomainsResponse represents the email domains allowed to register with a tenant
+type EmailDomainsResponse struct {
+	TenantID string `json:"tenant_id"`
+	// Domains are those allowed to register, anyone may register when empty
+	Domains []string `json:"domains"`
+	// Inherited is set when the tenant has no domains of its own and the configured ones apply
+	Inherited bool `json:"inherited"`
+}
+
+// JWTKeyResponse represents a JWT signing key, without its secret
+type JWTKeyResponse struct {
+	ID string `json:"id"`
+	// CreatedAt and ActivatesAt are set on keys added by rotations
+	CreatedAt   *string `json:"created_at,omitempty"`
+	ActivatesAt *string `json:"activates_at,omitempty"`
+	// Current is set on the key new tokens are signed with
+	Current bool `json:"current"`
+	// Configured is set on JWT_SECRET and JWT_PREVIOUS_SECRETS
+	Configured bool `json:"configured"`
+}
+
+// Revocation scopes
+const (
+	RevocationScopeUser = "user"
+	RevocationScopeAll  = "all"
+)
+
+// CreateRevocationRequest revokes the tokens of a user or of all users, issued before a moment
+type CreateRevocationRequest struct {
+	Scope string `json:"scope" binding:"required,oneof=user all" validate:"required,oneof=user all" example:"user"`
+	// UserID is required for the user scope
+	UserID string `json:"user_id,omitempty" example:"550e8400-e29b-41d4-a716-446655440000"`
+	// IssuedBefore defaults to now, i.e. all tokens issued so far
+	IssuedBefore *time.Time `json:"issued_before,omitempty" example:"2026-01-02T15:04:05Z"`
+}
+
+// RevocationResponse represents the result of a revocation
+type RevocationResponse struct {
+	Scope  string `json:"scope"`
+	UserID string `json:"user_id,omitempty"`
+	// NotValidBefore is the issue time access tokens need to stay valid
+	NotValidBefore       string `json:"not_valid_before"`
+	RefreshTokensDeleted int64  `json:"refresh_tokens_deleted"`
+}
+
+// Erasure statuses
+const (
+	ErasureStatusPending = "pending"
+	ErasureStatusErased  = "erased"
+)
+
+// ErasureResponse represents an account erasure, pending or carried out
+// Once carried out it is the tombstone kept as compliance evidence
+type ErasureResponse struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status" example:"pending"`
+	// EmailHash is the hex SHA-256 of the normalized email of the erased account
+	EmailHash   string  `json:"email_hash"`
+	RequestedBy string  `json:"requested_by" example:"user"`
+	Mode        string  `json:"mode" example:"delete"`
+	RequestedAt string  `json:"requested_at"`
+	EraseAfter  string  `json:"erase_after"`
+	ErasedAt    *string `json:"erased_at"`
+}
+
+// UserImportResponse represents the progress of a bulk user import
+// Processed counts the imported, skipped and failed records, the import is completed once all are processed
+type UserImportResponse struct {
+	ID        string `json:"id"`
+	Status    string `json:"status" example:"processing"`
+	Total     int64  `json:"total"`
+	Processed int64  `json:"processed"`
+	Imported  int64  `json:"imported"`
+	// Skipped counts records whose email belongs to a user already
+	Skipped   int64  `json:"skipped"`
+	Failed    int64  `json:"failed"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt string `json:"created_at"`
+	// Errors lists the first failed records
+	Errors []UserImportErrorResponse `json:"errors"`
+}
+
+// UserImportErrorResponse represents a record of an import that failed
+type UserImportErrorResponse struct {
+	Line  int    `json:"line"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// AdminStatsResponse represents the aggregates shown on the admin dashboard
+// Login counts and daily active users are only recorded since the service counts them.
+type AdminStatsResponse struct {
+	GeneratedAt string `json:"generated_at"`
+	// Days is the length of the time-series and of the login counts, today included
+	Days           int             `json:"days" example:"30"`
+	Users          UserStats       `json:"users"`
+	ActiveUsers    ActiveUserStats `json:"active_users"`
+	ActiveSessions int64           `json:"active_sessions"`
+	Logins         LoginStats      `json:"logins"`
+	Daily          []DailyStats    `json:"daily"`
+}
+
+// UserStats counts the users
+type UserStats struct {
+	Total    int64 `json:"total"`
+	Active   int64 `json:"active"`
+	Verified int64 `json:"verified"`
+}
+
+// ActiveUserStats counts the users who logged in recently
+type ActiveUserStats struct {
+	Last24h int64 `json:"last_24h"`
+	Last7d  int64 `json:"last_7d"`
+	Last30d int64 `json:"last_30d"`
+}
+
+// LoginStats counts the logins of a period
+type LoginStats struct {
+	Success int64 `json:"success"`
+	Failure int64 `json:"failure"`
+	// FailureRate is the share of failed logins, 0 without logins
+	FailureRate float64 `json:"failure_rate" example:"0.05"`
+}
+
+// DailyStats are the counts of one UTC day
+type DailyStats struct {
+	Date          string `json:"date" example:"2026-01-02"`
+	Registrations int64  `json:"registrations"`
+	ActiveUsers   int64  `json:"active_users"`
+	Logins        int64  `json:"logins"`
+	FailedLogins  int64  `json:"failed_logins"`
+}
+
+// ConsentResponse represents the consent of the user to the current version of a policy document
+// Pending consents have to be accepted again, e.g. after a new version was published
+type ConsentResponse struct {
+	Document        string  `json:"document" example:"terms"`
+	CurrentVersion  string  `json:"current_version" example:"2024-01"`
+	AcceptedVersion *string `json:"accepted_version"`
+	AcceptedAt      *string `json:"accepted_at"`
+	Pending         bool    `json:"pending"`
+}
+
+// AcceptConsentRequest represents the acceptance of the current version of a policy document
+type AcceptConsentRequest struct {
+	Document string `json:"document" binding:"required,oneof=terms privacy" validate:"required,oneof=terms privacy" example:"terms"`
+	Version  string `json:"version" binding:"required,max=50" validate:"required,max=50" example:"2024-01"`
+}
+
+// CreateInvitationRequest represents a request to invite a user to sign up
+// Role and Tenant are recorded on the invitation for the service that admits the user
+type CreateInvitationRequest struct {
+	Email  string  `json:"email" binding:"required,email" validate:"required,email"`
+	Role   *string `json:"role,omitempty" binding:"omitempty,max=50" validate:"omitempty,max=50" example:"member"`
+	Tenant *string `json:"tenant,omitempty" binding:"omitempty,max=100" validate:"omitempty,max=100"`
+}
+
+// InvitationResponse represents a signup invitation
+type InvitationResponse struct {
+	ID     string  `json:"id"`
+	Email  string  `json:"email"`
+	Role   *string `json:"role"`
+	Tenant *string `json:"tenant"`
+	// InvitedBy is the inviting user, null for invitations created by admins
+	InvitedBy  *string `json:"invited_by"`
+	Status     string  `json:"status" example:"pending"`
+	CreatedAt  string  `json:"created_at"`
+	ExpiresAt  string  `json:"expires_at"`
+	AcceptedAt *string `json:"accepted_at"`
+	AcceptedBy *string `json:"accepted_by"`
+}
+
+// CreateInvitationResponse represents a created invitation
+// The token is only returned here, the invited user registers with it
+type CreateInvitationResponse struct {
+	InvitationResponse
+	Token string `json:"token"`
+}
+
+// CreateOrganizationRequest represents a request to create an organization owned by the user
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100" validate:"required,max=100" example:"Acme"`
+}
+
+// OrganizationResponse represents an organization along with the role of the user in it
+type OrganizationResponse struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role" example:"owner"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AddMemberRequest represents a request to add a user to an organization by email
+type AddMemberRequest struct {
+	Email string `json:"email" binding:"required,email" validate:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=owner admin member" validate:"required,oneof=owner admin member" example:"member"`
+}
+
+// UpdateMemberRequest represents a request to change the role of a member
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member" validate:"required,oneof=owner admin member" example:"admin"`
+}
+
+// MemberResponse represents a member of an organization
+type MemberResponse struct {
+	UserID   string `json:"user_id"`
+	Email    string `json:"email"`
+	Role     string `json:"role" example:"member"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// AddMemberResponse represents the result of adding a member
+// Member is set when the user exists, otherwise the email is invited and Invitation is set
+type AddMemberResponse struct {
+	Member     *MemberResponse           `json:"member,omitempty"`
+	Invitation *CreateInvitationResponse `json:"invitation,omitempty"`
+}
+
+// OrganizationTokenResponse represents an access token scoped to an organization
+type OrganizationTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	ExpiresIn   int    `json:"expires_in"`
 }
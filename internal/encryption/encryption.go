@@ -0,0 +1,154 @@
+// Package encryption encrypts sensitive columns, e.g. MFA secrets, phone numbers and tokens of
+// upstream OAuth providers, with envelope encryption: every value is encrypted with its own
+// AES-256-GCM data key, which is wrapped with a key encryption key of a KeyProvider. Values are
+// tagged with the ID of the key encryption key, so keys can be rotated and values re-encrypted.
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks encrypted values, the version allows changing the format later
+const (
+	prefix    = "enc:v1:"
+	separator = ":"
+)
+
+var (
+	// ErrMalformed is returned when a value isn't an encrypted value
+	ErrMalformed = errors.New("malformed encrypted value")
+
+	// ErrUnknownKey is returned when a value was encrypted with a key the provider doesn't have
+	ErrUnknownKey = errors.New("unknown encryption key")
+
+	// ErrDecrypt is returned when a value was tampered with or belongs to other associated data
+	ErrDecrypt = errors.New("failed to decrypt value")
+)
+
+// Encryptor encrypts and decrypts column values
+type Encryptor struct {
+	keys KeyProvider
+}
+
+// New creates an encryptor wrapping data keys with keys
+func New(keys KeyProvider) *Encryptor {
+	return &Encryptor{keys: keys}
+}
+
+// Encrypt encrypts plaintext as enc:v1:<key ID>:<wrapped data key>:<ciphertext>
+// associatedData binds the value to where it is stored, e.g. the table, column and row ID,
+// so that it can't be copied to another row; decrypting requires the same associated data.
+func (e *Encryptor) Encrypt(ctx context.Context, plaintext, associatedData string) (string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, []byte(plaintext), []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+
+	keyID := e.keys.CurrentKeyID()
+	wrapped, err := e.keys.Wrap(ctx, keyID, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	return prefix + keyID + separator +
+		base64.RawURLEncoding.EncodeToString(wrapped) + separator +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt with the same associated data
+func (e *Encryptor) Decrypt(ctx context.Context, value, associatedData string) (string, error) {
+	keyID, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := e.keys.Unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, ciphertext, []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsReencryption reports whether value was encrypted with another key than the current one
+func (e *Encryptor) NeedsReencryption(value string) bool {
+	keyID, err := KeyID(value)
+	return err == nil && keyID != e.keys.CurrentKeyID()
+}
+
+// KeyPrefix returns the prefix of values encrypted with the current key, so that
+// repositories can find values that need re-encryption without decrypting them
+func (e *Encryptor) KeyPrefix() string {
+	return prefix + e.keys.CurrentKeyID() + separator
+}
+
+// Reencrypt encrypts value with the current key if it was encrypted with another one
+// It reports whether value was re-encrypted.
+func (e *Encryptor) Reencrypt(ctx context.Context, value, associatedData string) (string, bool, error) {
+	if !e.NeedsReencryption(value) {
+		return value, false, nil
+	}
+	plaintext, err := e.Decrypt(ctx, value, associatedData)
+	if err != nil {
+		return "", false, err
+	}
+	reencrypted, err := e.Encrypt(ctx, plaintext, associatedData)
+	if err != nil {
+		return "", false, err
+	}
+	return reencrypted, true, nil
+}
+
+// IsEncrypted reports whether value looks like an encrypted value, e.g. to encrypt legacy plaintext columns
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key encryption key value was encrypted with
+func KeyID(value string) (string, error) {
+	keyID, _, _, err := parse(value)
+	return keyID, err
+}
+
+// parse splits an encrypted value into the key ID, the wrapped data key and the ciphertext
+func parse(value string) (string, []byte, []byte, error) {
+	if !IsEncrypted(value) {
+		return "", nil, nil, ErrMalformed
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), separator)
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
@@ -0,0 +1,110 @@
+package encryption_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/encryption"
+)
+
+func newKey(t *testing.T, id string) string {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key)
+}
+
+func newEncryptor(t *testing.T, keys ...string) *encryption.Encryptor {
+	t.Helper()
+
+	keyring, err := encryption.NewKeyring(keys)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return encryption.New(keyring)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	enc := newEncryptor(t, newKey(t, "k1"))
+	ctx := context.Background()
+
+	value, err := enc.Encrypt(ctx, "+15551234567", "users.phone:user-1")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if !strings.HasPrefix(value, "enc:v1:k1:") || strings.Contains(value, "5551234567") {
+		t.Fatalf("Expected a value tagged with k1 without the plaintext, got %q", value)
+	}
+
+	plaintext, err := enc.Decrypt(ctx, value, "users.phone:user-1")
+	if err != nil || plaintext != "+15551234567" {
+		t.Fatalf("Expected the plaintext back, got %q (%v)", plaintext, err)
+	}
+
+	if _, err := enc.Decrypt(ctx, value, "users.phone:user-2"); !errors.Is(err, encryption.ErrDecrypt) {
+		t.Errorf("Expected a value copied to another row to fail, got %v", err)
+	}
+	tampered := value[:len(value)-2] + "AA"
+	if _, err := enc.Decrypt(ctx, tampered, "users.phone:user-1"); err == nil {
+		t.Error("Expected a tampered value to fail")
+	}
+	if _, err := enc.Decrypt(ctx, "+15551234567", "users.phone:user-1"); !errors.Is(err, encryption.ErrMalformed) {
+		t.Errorf("Expected plaintext to be malformed, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKeyEntry := newKey(t, "k1"), newKey(t, "k2")
+	ctx := context.Background()
+
+	value, err := newEncryptor(t, oldKey).Encrypt(ctx, "secret", "oauth.refresh_token:1")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	rotated := newEncryptor(t, newKeyEntry, oldKey)
+	if !rotated.NeedsReencryption(value) {
+		t.Fatal("Expected a value of the old key to need re-encryption")
+	}
+	reencrypted, changed, err := rotated.Reencrypt(ctx, value, "oauth.refresh_token:1")
+	if err != nil || !changed {
+		t.Fatalf("Failed to re-encrypt: %v", err)
+	}
+	if keyID, _ := encryption.KeyID(reencrypted); keyID != "k2" {
+		t.Errorf("Expected the value to be re-encrypted with k2, got %s", keyID)
+	}
+	if _, changed, _ := rotated.Reencrypt(ctx, reencrypted, "oauth.refresh_token:1"); changed {
+		t.Error("Expected a value of the current key to be left alone")
+	}
+
+	// Once the old key is dropped, only re-encrypted values can be read
+	current := newEncryptor(t, newKeyEntry)
+	if plaintext, err := current.Decrypt(ctx, reencrypted, "oauth.refresh_token:1"); err != nil || plaintext != "secret" {
+		t.Errorf("Expected the re-encrypted value to decrypt, got %q (%v)", plaintext, err)
+	}
+	if _, err := current.Decrypt(ctx, value, "oauth.refresh_token:1"); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for a dropped key, got %v", err)
+	}
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	tests := map[string][]string{
+		"no keys":      nil,
+		"missing id":   {"c2VjcmV0"},
+		"short key":    {"k1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		"invalid key":  {"k1:not base64"},
+		"duplicate id": {newKey(t, "k1"), newKey(t, "k1")},
+	}
+	for name, entries := range tests {
+		if _, err := encryption.NewKeyring(entries); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
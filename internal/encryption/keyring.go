@@ -0,0 +1,122 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keySize is the size of AES-256 keys, both key encryption keys and data keys
+const keySize = 32
+
+// KeyProvider wraps data keys with key encryption keys, which never leave it, e.g. a KMS
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the key new data keys are wrapped with
+	CurrentKeyID() string
+	// Wrap encrypts a data key with the key encryption key keyID
+	Wrap(ctx context.Context, keyID string, dataKey []byte) ([]byte, error)
+	// Unwrap decrypts a data key wrapped with the key encryption key keyID
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Keyring is a KeyProvider holding AES-256 key encryption keys in process memory, e.g. from config
+// Rotating keys means prepending a new one and keeping the old ones until values are re-encrypted.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from "id:key" entries with base64-encoded 32-byte keys
+// The first entry is the current key.
+func NewKeyring(entries []string) (*Keyring, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("keyring requires at least one key")
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(entries))}
+	for _, entry := range entries {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" || strings.Contains(id, separator) {
+			return nil, fmt.Errorf("key entry must be id:base64-key, got id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("key %s must be %d base64-encoded bytes", id, keySize)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key %s", id)
+		}
+
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.current == "" {
+			k.current = id
+		}
+	}
+
+	return k, nil
+}
+
+// CurrentKeyID returns the ID of the first key
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// Wrap encrypts a data key with the key keyID
+func (k *Keyring) Wrap(ctx context.Context, keyID string, dataKey []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return seal(aead, dataKey, []byte(keyID))
+}
+
+// Unwrap decrypts a data key wrapped with the key keyID
+func (k *Keyring) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(aead, wrapped, []byte(keyID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a ciphertext produced by seal
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+// maxAccountEventSize limits the body of account event notifications, which hold a single token
+const maxAccountEventSize = 64 << 10
+
+// AccountEventsHandler receives the account event notifications identity providers send
+// server-to-server, they are authenticated by the signature of the provider
+type AccountEventsHandler struct {
+	events  *service.AccountEventService
+	sources map[string]oauth.AccountEventSource
+}
+
+// NewAccountEventsHandler creates a new account events handler for the notifications of sources
+func NewAccountEventsHandler(events *service.AccountEventService, sources ...oauth.AccountEventSource) *AccountEventsHandler {
+	h := &AccountEventsHandler{events: events, sources: make(map[string]oauth.AccountEventSource, len(sources))}
+	for _, source := range sources {
+		h.sources[source.Provider()] = source
+	}
+	return h
+}
+
+// Receive handles account event notifications of a provider
+// @Summary Receive provider account events
+// @Description Server-to-server notifications of identity providers: apple receives the notifications of Sign in with Apple as {"payload":"<JWS>"}, google the security event tokens of Cross-Account Protection (RISC) as application/secevent+jwt.
+// @Description Revoked consents and deleted or disabled provider accounts unlink the provider, disabled accounts and sign-outs at the provider also end the sessions of the user, and deleted accounts deactivate the user with ACCOUNT_EVENTS_DEACTIVATE. Events of accounts that aren't linked, and replayed tokens, are accepted and ignored.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Param provider path string true "apple or google"
+// @Success 202 "Accepted"
+// @Failure 400 {object} dto.ErrorResponse "The notification isn't signed by the provider for a configured client ID"
+// @Failure 404 {object} dto.ErrorResponse "No client IDs are configured for the provider"
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse "The keys of the provider couldn't be loaded, retry later"
+// @Router /v1/oauth/events/{provider} [post]
+func (h *AccountEventsHandler) Receive(c *gin.Context) {
+	source, ok := h.sources[c.Param("provider")]
+	if !ok {
+		respondError(c, http.StatusNotFound, "Not found", "Provider not found")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAccountEventSize))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Bad request", "Failed to read the notification")
+		return
+	}
+
+	ctx := c.Request.Context()
+	events, err := source.Parse(ctx, body)
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidAccountEvent) {
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+			return
+		}
+		observability.LoggerFromContext(ctx).Warn("Failed to verify account event", zap.String("provider", source.Provider()), zap.Error(err))
+		respondError(c, http.StatusServiceUnavailable, "Service unavailable", "The notification couldn't be verified, retry later")
+		return
+	}
+
+	// Events already applied are harmless when the provider retries the notification, replayed
+	// tokens are dropped and acknowledged alike
+	duplicate, err := h.events.Deliver(ctx, events)
+	if err != nil {
+		observability.LoggerFromContext(ctx).Error("Failed to apply account event", zap.String("provider", source.Provider()), zap.Error(err))
+		respondError(c, http.StatusInternalServerError, "Internal server error", "Failed to apply the account event")
+		return
+	}
+	if duplicate {
+		observability.LoggerFromContext(ctx).Info("Dropped replayed account event", zap.String("provider", source.Provider()), zap.String("token_id", events[0].TokenID))
+	}
+
+	c.Status(http.StatusAccepted)
+}
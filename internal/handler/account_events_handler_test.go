@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/memory"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+// fakeAccountEvents reads notifications of the form "<type> <subject> [<token ID>]", "invalid" and
+// "unavailable"
+type fakeAccountEvents struct{}
+
+func (fakeAccountEvents) Provider() string {
+	return oauth.ProviderApple
+}
+
+func (fakeAccountEvents) Parse(_ context.Context, body []byte) ([]oauth.AccountEvent, error) {
+	switch string(body) {
+	case "invalid":
+		return nil, fmt.Errorf("%w: bad signature", oauth.ErrInvalidAccountEvent)
+	case "unavailable":
+		return nil, errors.New("failed to fetch JWKS")
+	}
+	eventType, subject, _ := strings.Cut(string(body), " ")
+	subject, tokenID, _ := strings.Cut(subject, " ")
+	return []oauth.AccountEvent{{Provider: oauth.ProviderApple, Subject: subject, Type: eventType, TokenID: tokenID, TokenExpiry: time.Now().Add(time.Hour)}}, nil
+}
+
+func TestAccountEventsReceive(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	redis := testutil.NewRedis(t)
+	events := service.NewAccountEventService(repos.User, repos.OAuthProvider,
+		service.NewRevocationService(redis, repos.Token, 15*time.Minute), redis, nil, false)
+	if err := repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: "user-1", Provider: oauth.ProviderApple, ProviderUserID: "apple-1"}); err != nil {
+		t.Fatalf("Failed to link provider: %v", err)
+	}
+
+	router := gin.New()
+	router.POST("/oauth/events/:provider", NewAccountEventsHandler(events, fakeAccountEvents{}).Receive)
+
+	tests := []struct {
+		name     string
+		provider string
+		body     string
+		status   int
+	}{
+		{name: "consent revoked", provider: "apple", body: oauth.AccountEventConsentRevoked + " apple-1", status: http.StatusAccepted},
+		{name: "redelivered", provider: "apple", body: oauth.AccountEventConsentRevoked + " apple-1", status: http.StatusAccepted},
+		{name: "token", provider: "apple", body: oauth.AccountEventSessionsRevoked + " apple-2 jti-1", status: http.StatusAccepted},
+		{name: "replayed token", provider: "apple", body: oauth.AccountEventSessionsRevoked + " apple-2 jti-1", status: http.StatusAccepted},
+		{name: "invalid signature", provider: "apple", body: "invalid", status: http.StatusBadRequest},
+		{name: "keys unavailable", provider: "apple", body: "unavailable", status: http.StatusServiceUnavailable},
+		{name: "unconfigured provider", provider: "google", body: oauth.AccountEventDeleted + " 1", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/oauth/events/"+tt.provider, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if _, err := repos.OAuthProvider.GetByProvider(ctx, oauth.ProviderApple, "apple-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected the connection to be unlinked, got %v", err)
+	}
+}
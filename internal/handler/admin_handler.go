@@ -0,0 +1,931 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// maxUserImportSize bounds the size of an import file, enough for a few hundred thousand users
+const maxUserImportSize = 256 << 20
+
+// AdminHandler handles admin API requests
+type AdminHandler struct {
+	ipFilter    *service.IPFilter
+	revocations *service.RevocationService
+	erasures    *service.ErasureService
+	imports     *service.UserImportService
+	search      *service.UserSearchService
+	userFlags   *service.UserFlagsService
+	restriction *service.RestrictionService
+	features    *service.FeatureFlags
+	tenants     *service.TenantService
+	stats       *service.StatsService
+	// jwtKeys is nil unless JWT_KEYRING is redis
+	jwtKeys      *service.JWTKeyring
+	emailDomains *service.EmailDomainPolicy
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(ipFilter *service.IPFilter, revocations *service.RevocationService, erasures *service.ErasureService, imports *service.UserImportService, search *service.UserSearchService, userFlags *service.UserFlagsService, restriction *service.RestrictionService, features *service.FeatureFlags, tenants *service.TenantService, stats *service.StatsService, jwtKeys *service.JWTKeyring, emailDomains *service.EmailDomainPolicy) *AdminHandler {
+	return &AdminHandler{
+		ipFilter:     ipFilter,
+		revocations:  revocations,
+		erasures:     erasures,
+		imports:      imports,
+		search:       search,
+		userFlags:    userFlags,
+		restriction:  restriction,
+		features:     features,
+		tenants:      tenants,
+		stats:        stats,
+		jwtKeys:      jwtKeys,
+		emailDomains: emailDomains,
+	}
+}
+
+// ListIPRules handles listing IP rules
+// @Summary List IP rules
+// @Description List all IP allow/deny rules
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Success 200 {array} dto.IPRuleResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/ip-rules [get]
+func (h *AdminHandler) ListIPRules(c *gin.Context) {
+	rules, err := h.ipFilter.ListRules(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	response := make([]dto.IPRuleResponse, 0, len(rules))
+	for _, rule := range rules {
+		response = append(response, ipRuleResponse(rule))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateIPRule handles creating an IP rule
+// @Summary Create IP rule
+// @Description Allow or deny a CIDR range, applied to all replicas without redeploying
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateIPRuleRequest true "IP rule"
+// @Success 201 {object} dto.IPRuleResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/ip-rules [post]
+func (h *AdminHandler) CreateIPRule(c *gin.Context) {
+	var req dto.CreateIPRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	rule := &domain.IPRule{
+		CIDR:    req.CIDR,
+		Action:  req.Action,
+		Comment: req.Comment,
+	}
+
+	err := h.ipFilter.AddRule(c.Request.Context(), rule)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidIPRule):
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+		case errors.Is(err, repository.ErrDuplicateIPRule):
+			respondError(c, http.StatusConflict, "Conflict", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, ipRuleResponse(rule))
+}
+
+// DeleteIPRule handles deleting an IP rule
+// @Summary Delete IP rule
+// @Description Delete an IP allow/deny rule
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "Rule ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/ip-rules/{id} [delete]
+func (h *AdminHandler) DeleteIPRule(c *gin.Context) {
+	err := h.ipFilter.RemoveRule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: "IP rule deleted successfully",
+	})
+}
+
+// CreateRevocation handles revoking tokens
+// @Summary Revoke tokens
+// @Description Revoke all tokens of a user or of all users issued before a moment (now by default), e.g. after a credential leak.
+// @Description Sessions are ended and access tokens issued before the moment are rejected until they expire.
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateRevocationRequest true "Revocation"
+// @Success 201 {object} dto.RevocationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/revocations [post]
+func (h *AdminHandler) CreateRevocation(c *gin.Context) {
+	var req dto.CreateRevocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	revocation := service.Revocation{}
+	switch req.Scope {
+	case dto.RevocationScopeUser:
+		if req.UserID == "" {
+			respondError(c, http.StatusBadRequest, "Validation failed", "user_id is required for the user scope")
+			return
+		}
+		revocation.UserID = req.UserID
+	case dto.RevocationScopeAll:
+		if req.UserID != "" {
+			respondError(c, http.StatusBadRequest, "Validation failed", "user_id is only allowed for the user scope")
+			return
+		}
+	}
+	if req.IssuedBefore != nil {
+		revocation.IssuedBefore = *req.IssuedBefore
+	}
+
+	result, err := h.revocations.Revoke(c.Request.Context(), revocation)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.RevocationResponse{
+		Scope:                req.Scope,
+		UserID:               revocation.UserID,
+		NotValidBefore:       result.NotValidBefore.UTC().Format(time.RFC3339),
+		RefreshTokensDeleted: result.RefreshTokensDeleted,
+	})
+}
+
+// EraseUser handles erasing a user
+// @Summary Erase user
+// @Description Erase a user at once, the right to be forgotten. The account is deleted or anonymized depending on ERASURE_MODE,
+// @Description sessions and OAuth connections are removed and a tombstone without personal data is kept.
+// @Description A pending erasure requested by the user is carried out early, erasing an erased user returns its tombstone.
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.ErasureResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/{id}/erasure [post]
+func (h *AdminHandler) EraseUser(c *gin.Context) {
+	erasure, err := h.erasures.Erase(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, erasureResponse(erasure))
+}
+
+// GetUserErasure handles getting the erasure of a user
+// @Summary Get user erasure
+// @Description Get the pending erasure of a user or the tombstone of an erased user
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.ErasureResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/{id}/erasure [get]
+func (h *AdminHandler) GetUserErasure(c *gin.Context) {
+	erasure, err := h.erasures.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, erasureResponse(erasure))
+}
+
+// ImportUsers handles starting a bulk user import
+// @Summary Import users
+// @Description Import users from an NDJSON or CSV file, e.g. when migrating from a legacy system. The format is taken from
+// @Description the format query parameter or the Content-Type (application/x-ndjson or text/csv), CSV files need a header row.
+// @Description Records have an email and either a password_hash, bcrypt or a supported legacy format, or force_password_reset, users forced to reset their
+// @Description password are created without one. Optional fields are username, first_name, last_name, display_name, locale and email_verified.
+// @Description Users are created in the background, invalid records are reported as failed and existing emails are skipped.
+// @Tags admin
+// @Security AdminToken
+// @Accept plain
+// @Produce json
+// @Param format query string false "File format" Enums(ndjson, csv)
+// @Param file body string true "NDJSON or CSV file"
+// @Success 202 {object} dto.UserImportResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/import [post]
+func (h *AdminHandler) ImportUsers(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = userImportFormat(c.GetHeader("Content-Type"))
+	}
+	if format == "" {
+		respondError(c, http.StatusBadRequest, "Bad request", "Unknown file format, set the format query parameter or the Content-Type")
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxUserImportSize)
+	userImport, err := h.imports.Start(c.Request.Context(), format, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			respondError(c, http.StatusRequestEntityTooLarge, "Request entity too large", "Import files are limited to %d bytes", tooLarge.Limit)
+		case errors.Is(err, service.ErrInvalidUserImport):
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, userImportResponse(userImport))
+}
+
+// GetUserImport handles getting the progress of a bulk user import
+// @Summary Get user import
+// @Description Get the progress of a user import and its first failed records, imports are kept for 7 days
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "Import ID"
+// @Success 200 {object} dto.UserImportResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/import/{id} [get]
+func (h *AdminHandler) GetUserImport(c *gin.Context) {
+	userImport, err := h.imports.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, userImportResponse(userImport))
+}
+
+// ListJWTKeys handles listing JWT signing keys
+// @Summary List JWT signing keys
+// @Description List the HMAC keys tokens are validated with and the one signing new tokens, without their secrets
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Success 200 {array} dto.JWTKeyResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Router /v1/admin/jwt-keys [get]
+func (h *AdminHandler) ListJWTKeys(c *gin.Context) {
+	if h.jwtKeys == nil {
+		respondError(c, http.StatusConflict, "Conflict", "JWT keys are only managed at runtime when JWT_KEYRING is redis")
+		return
+	}
+
+	keys := h.jwtKeys.List()
+	response := make([]dto.JWTKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, jwtKeyResponse(key))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RotateJWTKey handles rotating the JWT signing key
+// @Summary Rotate JWT signing key
+// @Description Add a random HMAC secret that signs new tokens once every replica has loaded it, after JWT_KEYRING_RELOAD_INTERVAL.
+// @Description Tokens signed with replaced keys stay valid until refresh tokens issued with them expire.
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Success 201 {object} dto.JWTKeyResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/jwt-keys/rotate [post]
+func (h *AdminHandler) RotateJWTKey(c *gin.Context) {
+	if h.jwtKeys == nil {
+		respondError(c, http.StatusConflict, "Conflict", "JWT keys are only managed at runtime when JWT_KEYRING is redis")
+		return
+	}
+
+	key, err := h.jwtKeys.Rotate(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, jwtKeyResponse(*key))
+}
+
+// SearchUsers handles searching users
+// @Summary Search users
+// @Description Find users for support by ID, by the ID of an account they linked at a provider (e.g. a GitHub user ID), or by partial email, ignoring case.
+// @Description Matches are returned in this order, partial emails need at least 3 characters.
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param q query string false "User ID, provider user ID or part of an email, required without flag"
+// @Param flag query string false "Only return users with this support flag, without q the last flagged users are listed"
+// @Param limit query int false "Maximum number of users, 1 to 100" default(20)
+// @Success 200 {array} dto.AdminUserResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/search [get]
+func (h *AdminHandler) SearchUsers(c *gin.Context) {
+	limit := service.DefaultUserSearchLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Bad request", "limit must be a number")
+			return
+		}
+		limit = parsed
+	}
+
+	users, err := h.search.Search(c.Request.Context(), c.Query("q"), c.Query("flag"), limit)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUserSearch) {
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser handles getting a user
+// @Summary Get user
+// @Description Get a user along with the notes and flags support keeps on it
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.AdminUserDetailsResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/{id} [get]
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, err := h.userFlags.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserFlags handles replacing the notes and flags of a user
+// @Summary Update user notes and flags
+// @Description Replace the free-form notes and the flags support keeps on a user, e.g. chargeback or abuse-suspect.
+// @Description Flags are lowercase words separated by hyphens, up to 20 per user. Edits are audited with who made them,
+// @Description the SPIFFE ID of mutual TLS callers or "admin".
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.UpdateUserFlagsRequest true "Notes and flags"
+// @Success 200 {object} dto.AdminUserDetailsResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/{id}/flags [put]
+func (h *AdminHandler) UpdateUserFlags(c *gin.Context) {
+	var req dto.UpdateUserFlagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	user, err := h.userFlags.Update(c.Request.Context(), c.Param("id"), adminActor(c), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidUserFlags):
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+		case errors.Is(err, repository.ErrNotFound):
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// SetUserRestriction handles changing the restriction level of a user
+// @Summary Set user restriction
+// @Description Restrict an abusive account. Limited users get access tokens with the restricted claim and RATE_LIMIT_RESTRICTED_PERCENT
+// @Description of the rate limits, from their next token on. Banned users are refused sign in and refresh with the account_banned code
+// @Description and their tokens are revoked. Changes are audited with who made them, the SPIFFE ID of mutual TLS callers or "admin".
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.SetUserRestrictionRequest true "Restriction level"
+// @Success 200 {object} dto.UserRestrictionResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/{id}/restriction [put]
+func (h *AdminHandler) SetUserRestriction(c *gin.Context) {
+	var req dto.SetUserRestrictionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	restriction, err := h.restriction.Set(c.Request.Context(), c.Param("id"), adminActor(c), req.Restriction)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRestriction):
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+		case errors.Is(err, repository.ErrNotFound):
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, restriction)
+}
+
+// GetStats handles getting the statistics of the admin dashboard
+// @Summary Get statistics
+// @Description Aggregate counts of users and sessions and daily time-series of registrations, active users and logins over the last days (UTC, today included), for dashboards.
+// @Description Results are cached for ADMIN_STATS_CACHE_TTL. Logins and daily active users are counted since the service records them, for up to 90 days.
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param days query int false "Days of the time-series, 1 to 90" default(30)
+// @Success 200 {object} dto.AdminStatsResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/stats [get]
+func (h *AdminHandler) GetStats(c *gin.Context) {
+	days := service.DefaultStatsDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Bad request", "days must be a number")
+			return
+		}
+		days = parsed
+	}
+
+	stats, err := h.stats.Stats(c.Request.Context(), days)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidStatsPeriod) {
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// ListFeatureFlags handles listing feature flags
+// @Summary List feature flags
+// @Description List configured feature flags and flags changed at runtime
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Success 200 {array} dto.FeatureFlagResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/admin/feature-flags [get]
+func (h *AdminHandler) ListFeatureFlags(c *gin.Context) {
+	flags := h.features.List()
+
+	response := make([]dto.FeatureFlagResponse, 0, len(flags))
+	for _, flag := range flags {
+		response = append(response, featureFlagResponse(flag))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetFeatureFlag handles changing a feature flag
+// @Summary Set feature flag
+// @Description Turn a feature flag on for a percentage of users and for members of organizations,
+// @Description applied to all replicas without redeploying. The flag overrides its configured default until it is reset.
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param name path string true "Flag name"
+// @Param request body dto.SetFeatureFlagRequest true "Feature flag"
+// @Success 200 {object} dto.FeatureFlagResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/feature-flags/{name} [put]
+func (h *AdminHandler) SetFeatureFlag(c *gin.Context) {
+	var req dto.SetFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	flag := &domain.FeatureFlag{
+		Name:       c.Param("name"),
+		Percentage: *req.Percentage,
+		Tenants:    req.Tenants,
+		Claim:      req.Claim,
+	}
+
+	if err := h.features.Set(c.Request.Context(), flag); err != nil {
+		if errors.Is(err, service.ErrInvalidFeatureFlag) {
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, featureFlagResponse(service.FeatureFlagState{FeatureFlag: *flag, Overridden: true}))
+}
+
+// ResetFeatureFlag handles resetting a feature flag
+// @Summary Reset feature flag
+// @Description Remove the runtime change of a feature flag, restoring its configured default
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param name path string true "Flag name"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/feature-flags/{name} [delete]
+func (h *AdminHandler) ResetFeatureFlag(c *gin.Context) {
+	if err := h.features.Reset(c.Request.Context(), c.Param("name")); err != nil {
+		if errors.Is(err, service.ErrFeatureFlagNotFound) {
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: "Feature flag reset successfully",
+	})
+}
+
+// ListTenants handles listing tenants
+// @Summary List tenants
+// @Description List tenants with their email sender, branding, redirect URLs and cookie domain
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Success 200 {array} dto.TenantResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/tenants [get]
+func (h *AdminHandler) ListTenants(c *gin.Context) {
+	tenants, err := h.tenants.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	response := make([]dto.TenantResponse, 0, len(tenants))
+	for _, tenant := range tenants {
+		response = append(response, tenantResponse(tenant))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SaveTenant handles creating or replacing a tenant
+// @Summary Save tenant
+// @Description Create a tenant or replace its settings. Requests name their tenant with the X-Tenant-ID header,
+// @Description emails are then sent from its sender and branded, and links may only send users back to its redirect URLs.
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Param request body dto.SaveTenantRequest true "Tenant settings"
+// @Success 200 {object} dto.TenantResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/tenants/{id} [put]
+func (h *AdminHandler) SaveTenant(c *gin.Context) {
+	var req dto.SaveTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	tenant := &domain.Tenant{
+		ID:                  c.Param("id"),
+		Name:                req.Name,
+		EmailFrom:           req.EmailFrom,
+		BrandName:           req.BrandName,
+		LogoURL:             req.LogoURL,
+		BrandColor:          req.BrandColor,
+		RedirectURLs:        req.RedirectURLs,
+		CookieDomain:        req.CookieDomain,
+		AllowedEmailDomains: req.AllowedEmailDomains,
+	}
+
+	if err := h.tenants.Save(c.Request.Context(), tenant); err != nil {
+		if errors.Is(err, service.ErrInvalidTenant) {
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, tenantResponse(tenant))
+}
+
+// GetTenantEmailDomains handles getting the email domains allowed to register with a tenant
+// @Summary Get allowed email domains
+// @Description Get the email domains allowed to register with a tenant, those of EMAIL_ALLOWED_DOMAINS when the tenant has none
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} dto.EmailDomainsResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/tenants/{id}/email-domains [get]
+func (h *AdminHandler) GetTenantEmailDomains(c *gin.Context) {
+	tenant, err := h.tenants.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrTenantNotFound) {
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, h.emailDomainsResponse(c.Request.Context(), tenant))
+}
+
+// SetTenantEmailDomains handles replacing the email domains allowed to register with a tenant
+// @Summary Set allowed email domains
+// @Description Replace the email domains allowed to register with a tenant, e.g. ["acme.com", "*.acme.com"] where *. matches subdomains.
+// @Description Other emails are refused with email_domain_not_allowed, invited users excepted. An empty list falls back to EMAIL_ALLOWED_DOMAINS.
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Param request body dto.SetEmailDomainsRequest true "Allowed email domains"
+// @Success 200 {object} dto.EmailDomainsResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/tenants/{id}/email-domains [put]
+func (h *AdminHandler) SetTenantEmailDomains(c *gin.Context) {
+	var req dto.SetEmailDomainsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	tenant, err := h.tenants.SetAllowedEmailDomains(c.Request.Context(), c.Param("id"), req.Domains)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTenantNotFound):
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+		case errors.Is(err, service.ErrInvalidTenant):
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, h.emailDomainsResponse(c.Request.Context(), tenant))
+}
+
+// emailDomainsResponse reports the email domains that apply to requests of a tenant
+func (h *AdminHandler) emailDomainsResponse(ctx context.Context, tenant *domain.Tenant) dto.EmailDomainsResponse {
+	domains := h.emailDomains.AllowList(service.ContextWithTenant(ctx, tenant))
+	if domains == nil {
+		domains = []string{}
+	}
+	return dto.EmailDomainsResponse{
+		TenantID:  tenant.ID,
+		Domains:   domains,
+		Inherited: len(tenant.AllowedEmailDomains) == 0,
+	}
+}
+
+// DeleteTenant handles deleting a tenant
+// @Summary Delete tenant
+// @Description Delete a tenant, requests naming it are rejected afterwards
+// @Tags admin
+// @Security AdminToken
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} dto.SuccessResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/tenants/{id} [delete]
+func (h *AdminHandler) DeleteTenant(c *gin.Context) {
+	if err := h.tenants.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, service.ErrTenantNotFound) {
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Message: "Tenant deleted successfully",
+	})
+}
+
+// adminActor identifies who calls the admin API for the audit trail
+// Mutual TLS callers are named by their SPIFFE ID, callers with the admin token share one identity.
+func adminActor(c *gin.Context) string {
+	if peerID, ok := PeerIDFromContext(c.Request.Context()); ok {
+		return peerID
+	}
+	return "admin"
+}
+
+func ipRuleResponse(rule *domain.IPRule) dto.IPRuleResponse {
+	return dto.IPRuleResponse{
+		ID:        rule.ID,
+		CIDR:      rule.CIDR,
+		Action:    rule.Action,
+		Comment:   rule.Comment,
+		CreatedAt: rule.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func featureFlagResponse(flag service.FeatureFlagState) dto.FeatureFlagResponse {
+	tenants := flag.Tenants
+	if tenants == nil {
+		tenants = []string{}
+	}
+	return dto.FeatureFlagResponse{
+		Name:       flag.Name,
+		Percentage: flag.Percentage,
+		Tenants:    tenants,
+		Claim:      flag.Claim,
+		Overridden: flag.Overridden,
+	}
+}
+
+func tenantResponse(tenant *domain.Tenant) dto.TenantResponse {
+	redirectURLs := tenant.RedirectURLs
+	if redirectURLs == nil {
+		redirectURLs = []string{}
+	}
+	allowedEmailDomains := tenant.AllowedEmailDomains
+	if allowedEmailDomains == nil {
+		allowedEmailDomains = []string{}
+	}
+	return dto.TenantResponse{
+		ID:                  tenant.ID,
+		Name:                tenant.Name,
+		EmailFrom:           tenant.EmailFrom,
+		BrandName:           tenant.BrandName,
+		LogoURL:             tenant.LogoURL,
+		BrandColor:          tenant.BrandColor,
+		RedirectURLs:        redirectURLs,
+		CookieDomain:        tenant.CookieDomain,
+		AllowedEmailDomains: allowedEmailDomains,
+		CreatedAt:           tenant.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:           tenant.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// userImportFormat maps the Content-Type of an import file to its format
+func userImportFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/json":
+		return service.UserImportFormatNDJSON
+	case "text/csv":
+		return service.UserImportFormatCSV
+	default:
+		return ""
+	}
+}
+
+func userImportResponse(userImport *service.UserImport) dto.UserImportResponse {
+	response := dto.UserImportResponse{
+		ID:        userImport.ID,
+		Status:    userImport.Status,
+		Total:     userImport.Total,
+		Processed: userImport.Processed(),
+		Imported:  userImport.Imported,
+		Skipped:   userImport.Skipped,
+		Failed:    userImport.Failed,
+		Error:     userImport.Error,
+		CreatedAt: userImport.CreatedAt.UTC().Format(time.RFC3339),
+		Errors:    make([]dto.UserImportErrorResponse, 0, len(userImport.Errors)),
+	}
+	for _, importErr := range userImport.Errors {
+		response.Errors = append(response.Errors, dto.UserImportErrorResponse{
+			Line:  importErr.Line,
+			Email: importErr.Email,
+			Error: importErr.Error,
+		})
+	}
+	return response
+}
+
+func jwtKeyResponse(key service.JWTKeyState) dto.JWTKeyResponse {
+	response := dto.JWTKeyResponse{ID: key.ID, Current: key.Current, Configured: key.Configured}
+	if !key.Configured {
+		createdAt := key.CreatedAt.UTC().Format(time.RFC3339)
+		activatesAt := key.ActivatesAt.UTC().Format(time.RFC3339)
+		response.CreatedAt, response.ActivatesAt = &createdAt, &activatesAt
+	}
+	return response
+}
@@ -1,23 +1,40 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/i18n"
 	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+const (
+	refreshTokenCookie = "refresh_token"
+	// refreshTokenCookiePath limits the API v1 refresh token cookie to the refresh endpoint
+	refreshTokenCookiePath = "/api/v1/auth/refresh"
 )
 
 // AuthHandler handles authentication requests
+// Handlers are shared between API versions and adapt token transport to the request version
 type AuthHandler struct {
 	authService service.AuthService
+	cookies     CookieOptions
+}
+
+// CookieOptions configures the API v1 refresh token cookie
+type CookieOptions struct {
+	Secure bool
+	Domain string
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(authService service.AuthService) *AuthHandler {
+func NewAuthHandler(authService service.AuthService, cookies CookieOptions) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		cookies:     cookies,
 	}
 }
 
@@ -28,183 +45,452 @@ func NewAuthHandler(authService service.AuthService) *AuthHandler {
 // @Accept json
 // @Produce json
 // @Param request body dto.RegisterRequest true "Registration request"
-// @Success 201 {object} dto.AuthResponse
+// @Success 201 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Registration is invite-only, or not open to the domain of the email (email_domain_not_allowed)"
+// @Failure 404 {object} dto.ErrorResponse "Registration is disabled"
 // @Failure 409 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts for this email or client, retry after Retry-After seconds"
 // @Failure 500 {object} dto.ErrorResponse
-// @Router /auth/register [post]
+// @Failure 503 {object} dto.ErrorResponse "Password hashing is saturated, retry after Retry-After seconds"
+// @Router /v1/auth/register [post]
+// @Router /v2/auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req dto.RegisterRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Validation failed",
-			Message: err.Error(),
-		})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	response, err := h.authService.Register(c.Request.Context(), &req)
 	if err != nil {
+		if respondRetryable(c, err) {
+			return
+		}
 		// Check if user already exists
-		if strings.Contains(err.Error(), "already exists") {
-			c.JSON(http.StatusConflict, dto.ErrorResponse{
-				Error:   "Conflict",
-				Message: err.Error(),
-			})
+		if errors.Is(err, service.ErrUserExists) || errors.Is(err, service.ErrUsernameTaken) {
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+			return
+		}
+		if errors.Is(err, service.ErrInvitationRequired) || errors.Is(err, service.ErrEmailDomainNotAllowed) {
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
 			return
 		}
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Bad request",
-			Message: err.Error(),
-		})
+		respondServiceError(c, http.StatusBadRequest, "Bad request", err)
 		return
 	}
 
-	// Set refresh token in httpOnly cookie
-	c.SetCookie("refresh_token", response.RefreshToken, response.ExpiresIn, "/api/v1/auth/refresh", "", true, true)
+	h.respondTokens(c, http.StatusCreated, response)
+}
 
-	c.JSON(http.StatusCreated, response.AuthResponse)
+// RegisterWithInvitation handles registration with an invitation
+// @Summary Register with an invitation
+// @Description Register the user invited by the token, with the email of the invitation. Each invitation can be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param token path string true "Invitation token"
+// @Param request body dto.RegisterWithInvitationRequest true "Registration request"
+// @Success 201 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
+// @Failure 400 {object} dto.ErrorResponse "Invalid request or invitation"
+// @Failure 404 {object} dto.ErrorResponse "Registration is disabled"
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts for this email or client, retry after Retry-After seconds"
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse "Password hashing is saturated, retry after Retry-After seconds"
+// @Router /v1/auth/register/invite/{token} [post]
+// @Router /v2/auth/register/invite/{token} [post]
+func (h *AuthHandler) RegisterWithInvitation(c *gin.Context) {
+	var req dto.RegisterWithInvitationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	response, err := h.authService.RegisterWithInvitation(c.Request.Context(), c.Param("token"), &req)
+	if err != nil {
+		if respondRetryable(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrUserExists) || errors.Is(err, service.ErrUsernameTaken) {
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+			return
+		}
+		respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+		return
+	}
+
+	h.respondTokens(c, http.StatusCreated, response)
 }
 
 // Login handles user login
 // @Summary Login user
-// @Description Authenticate user with email and password
+// @Description Authenticate user with email or username and password
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body dto.LoginRequest true "Login request"
-// @Success 200 {object} dto.AuthResponse
+// @Success 200 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "The email isn't verified and EMAIL_VERIFICATION_POLICY is block, or an admin banned the account"
+// @Failure 404 {object} dto.ErrorResponse "Password login is disabled"
 // @Failure 500 {object} dto.ErrorResponse
-// @Router /auth/login [post]
+// @Failure 503 {object} dto.ErrorResponse "Password hashing is saturated, retry after Retry-After seconds"
+// @Router /v1/auth/login [post]
+// @Router /v2/auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req dto.LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Validation failed",
-			Message: err.Error(),
-		})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	response, err := h.authService.Login(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Error:   "Unauthorized",
-			Message: err.Error(),
-		})
+		if respondRetryable(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) || errors.Is(err, service.ErrAccountBanned) {
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+			return
+		}
+		respondServiceError(c, http.StatusUnauthorized, "Unauthorized", err)
 		return
 	}
 
-	// Set refresh token in httpOnly cookie
-	c.SetCookie("refresh_token", response.RefreshToken, response.ExpiresIn, "/api/v1/auth/refresh", "", true, true)
-
-	c.JSON(http.StatusOK, response.AuthResponse)
+	h.respondTokens(c, http.StatusOK, response)
 }
 
 // Refresh handles token refresh
 // @Summary Refresh tokens
-// @Description Refresh access and refresh tokens
+// @Description Refresh access and refresh tokens. v1 reads the refresh token from the cookie, v2 from the body
 // @Tags auth
+// @Accept json
 // @Produce json
-// @Success 200 {object} dto.AuthResponse
+// @Param request body dto.RefreshRequest false "Refresh request (v2 only)"
+// @Success 200 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
-// @Router /auth/refresh [post]
+// @Router /v1/auth/refresh [post]
+// @Router /v2/auth/refresh [post]
 func (h *AuthHandler) Refresh(c *gin.Context) {
-	refreshToken, err := c.Cookie("refresh_token")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Error:   "Bad request",
-			Message: "Refresh token not found in cookie",
-		})
-		return
+	var refreshToken string
+	if apiVersion(c) >= APIVersion2 {
+		var req dto.RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+			return
+		}
+		refreshToken = req.RefreshToken
+	} else {
+		cookie, err := c.Cookie(refreshTokenCookie)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "Bad request", "Refresh token not found in cookie")
+			return
+		}
+		refreshToken = cookie
 	}
 
 	response, err := h.authService.RefreshToken(c.Request.Context(), refreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Error:   "Unauthorized",
-			Message: err.Error(),
-		})
+		if respondRetryable(c, err) {
+			return
+		}
+		respondServiceError(c, http.StatusUnauthorized, "Unauthorized", err)
 		return
 	}
 
-	// Set new refresh token in httpOnly cookie
-	c.SetCookie("refresh_token", response.RefreshToken, response.ExpiresIn, "/api/v1/auth/refresh", "", true, true)
-
-	c.JSON(http.StatusOK, response.AuthResponse)
+	h.respondTokens(c, http.StatusOK, response)
 }
 
 // Logout handles user logout
 // @Summary Logout user
-// @Description Logout user and invalidate refresh token
+// @Description Logout user and invalidate refresh token. v2 accepts the refresh token in the body
 // @Tags auth
 // @Security BearerAuth
+// @Accept json
 // @Produce json
+// @Param request body dto.LogoutRequest false "Logout request (v2 only)"
 // @Success 200 {object} dto.SuccessResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
-// @Router /auth/logout [post]
+// @Router /v1/auth/logout [post]
+// @Router /v2/auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Error:   "Unauthorized",
-			Message: "User ID not found in context",
-		})
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
 		return
 	}
 
-	refreshToken, _ := c.Cookie("refresh_token")
+	var refreshToken string
+	if apiVersion(c) >= APIVersion2 {
+		// The body is optional, the access token alone is enough to log out
+		var req dto.LogoutRequest
+		if c.Request.Body != http.NoBody {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+				return
+			}
+		}
+		refreshToken = req.RefreshToken
+	} else {
+		refreshToken, _ = c.Cookie(refreshTokenCookie)
+	}
 
 	err := h.authService.Logout(c.Request.Context(), userID.(string), refreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "Internal server error",
-			Message: err.Error(),
-		})
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
 		return
 	}
 
-	// Clear refresh token cookie
-	c.SetCookie("refresh_token", "", -1, "/api/v1/auth/refresh", "", true, true)
+	if apiVersion(c) < APIVersion2 {
+		// Clear refresh token cookie
+		h.setRefreshCookie(c, "", -1)
+	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{
-		Message: "Logged out successfully",
+		Message: i18n.Translate(Locale(c), "Logged out successfully"),
 	})
 }
 
 // GetMe handles getting current user profile
 // @Summary Get current user profile
-// @Description Get information about the current authenticated user
+// @Description Get information about the current authenticated user, as MessagePack if preferred in Accept. Responses carry a weak ETag, clients polling the profile send it in If-None-Match to get 304 while it is unchanged
 // @Tags auth
 // @Security BearerAuth
-// @Produce json
+// @Produce json,application/x-msgpack
+// @Param If-None-Match header string false "ETag of the profile the client has"
 // @Success 200 {object} dto.UserResponse
+// @Success 304 "The profile is unchanged"
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
-// @Router /auth/me [get]
+// @Router /v1/auth/me [get]
+// @Router /v2/auth/me [get]
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Error:   "Unauthorized",
-			Message: "User ID not found in context",
-		})
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
 		return
 	}
 
 	user, err := h.authService.GetUser(c.Request.Context(), userID.(string))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error:   "Internal server error",
-			Message: err.Error(),
-		})
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	etag := userETag(user)
+	setProfileValidators(c, etag)
+	if notModified(c, etag) {
+		return
+	}
+
+	respondNegotiated(c, http.StatusOK, user)
+}
+
+// UpdateMe handles partial updates of the current user profile
+// @Summary Update current user profile
+// @Description Partially update profile fields of the current authenticated user
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.UpdateProfileRequest true "Profile fields to update"
+// @Success 200 {object} dto.UserResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/me [patch]
+// @Router /v2/auth/me [patch]
+func (h *AuthHandler) UpdateMe(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	var req dto.UpdateProfileRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := h.authService.UpdateProfile(c.Request.Context(), userID.(string), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidUsername):
+			respondServiceError(c, http.StatusBadRequest, "Validation failed", err)
+		case errors.Is(err, service.ErrUsernameTaken):
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
 		return
 	}
 
+	setProfileValidators(c, userETag(user))
 	c.JSON(http.StatusOK, user)
 }
+
+// UsernameAvailable handles username availability checks
+// @Summary Check username availability
+// @Description Check whether a username is valid and not taken
+// @Tags auth
+// @Produce json
+// @Param username query string true "Username to check"
+// @Success 200 {object} dto.UsernameAvailabilityResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts for this username or client, retry after Retry-After seconds"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/username-available [get]
+// @Router /v2/auth/username-available [get]
+func (h *AuthHandler) UsernameAvailable(c *gin.Context) {
+	username := c.Query("username")
+	if username == "" {
+		respondError(c, http.StatusBadRequest, "Validation failed", "Username is required")
+		return
+	}
+
+	available, err := h.authService.IsUsernameAvailable(c.Request.Context(), username)
+	if err != nil {
+		if respondRetryable(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidUsername) {
+			respondServiceError(c, http.StatusBadRequest, "Validation failed", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.UsernameAvailabilityResponse{
+		Username:  utils.SanitizeUsername(username),
+		Available: available,
+	})
+}
+
+// ListSessions handles listing active sessions of the current user
+// @Summary List sessions
+// @Description List active sessions (refresh tokens) of the current authenticated user, newest first
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.SessionResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/sessions [get]
+// @Router /v2/auth/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), userID.(string))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession handles ending a session of the current user
+// @Summary Revoke session
+// @Description Revoke a session of the current authenticated user, its refresh token stops working
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/sessions/{id} [delete]
+// @Router /v2/auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	if err := h.authService.RevokeSession(c.Request.Context(), userID.(string), c.Param("id")); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Introspect handles access token introspection for resource servers
+// @Summary Introspect access token
+// @Description Check whether an access token is active (RFC 7662), i.e. valid, unexpired and not revoked. Answered as MessagePack if preferred in Accept
+// @Tags auth
+// @Accept json,x-www-form-urlencoded
+// @Produce json,application/x-msgpack
+// @Param request body dto.IntrospectRequest true "Introspection request"
+// @Success 200 {object} dto.IntrospectionResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/introspect [post]
+// @Router /v2/auth/introspect [post]
+func (h *AuthHandler) Introspect(c *gin.Context) {
+	var req dto.IntrospectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	claims, err := h.authService.ValidateToken(c.Request.Context(), req.Token)
+	if err != nil {
+		// Invalid and revoked tokens are a regular answer, not an error
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenRevoked) {
+			respondNegotiated(c, http.StatusOK, dto.IntrospectionResponse{Active: false})
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	respondNegotiated(c, http.StatusOK, dto.IntrospectionResponse{
+		Active:     true,
+		Sub:        claims.UserID,
+		Email:      claims.Email,
+		Exp:        claims.Exp,
+		Iat:        claims.Iat,
+		TokenType:  "Bearer",
+		OrgID:      claims.OrgID,
+		OrgRole:    claims.OrgRole,
+		Features:   claims.Features,
+		Restricted: claims.Restricted,
+	})
+}
+
+// respondTokens writes issued tokens in the format of the request API version
+// v1 sets the refresh token in an httpOnly cookie, v2 returns it in the body
+func (h *AuthHandler) respondTokens(c *gin.Context, status int, response *service.AuthResponseWithRefreshToken) {
+	if apiVersion(c) >= APIVersion2 {
+		c.JSON(status, tokenResponse(response))
+		return
+	}
+
+	h.setRefreshCookie(c, response.RefreshToken, response.ExpiresIn)
+	c.JSON(status, response.AuthResponse)
+}
+
+// setRefreshCookie sets the httpOnly refresh token cookie, a negative maxAge deletes it
+// The cookie domain of the tenant of the request overrides the configured one.
+func (h *AuthHandler) setRefreshCookie(c *gin.Context, value string, maxAge int) {
+	domain := h.cookies.Domain
+	if tenant := service.TenantFromContext(c.Request.Context()); tenant != nil && tenant.CookieDomain != nil {
+		domain = *tenant.CookieDomain
+	}
+	c.SetCookie(refreshTokenCookie, value, maxAge, refreshTokenCookiePath, domain, h.cookies.Secure, true)
+}
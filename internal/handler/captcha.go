@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+const (
+	// CaptchaHeader is the request header carrying the CAPTCHA token
+	CaptchaHeader = "X-Captcha-Token"
+	// captchaBodyField is the JSON body field carrying the CAPTCHA token
+	captchaBodyField = "captcha_token"
+	// maxCaptchaBodySize limits the body read for the token, the forms of protected routes are small
+	maxCaptchaBodySize = 64 << 10
+)
+
+// CaptchaMiddleware verifies CAPTCHA tokens on the configured route templates
+// Routes that are not listed are passed through; a nil verifier disables the check
+func CaptchaMiddleware(verifier service.CaptchaVerifier, routes []string) gin.HandlerFunc {
+	protected := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		protected[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if verifier == nil || !protected[policyRoute(c)] {
+			c.Next()
+			return
+		}
+
+		token, err := captchaToken(c)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, "Request entity too large", "Request bodies are limited to %d bytes", tooLarge.Limit)
+			c.Abort()
+			return
+		}
+		if token == "" {
+			respondError(c, http.StatusBadRequest, "Bad request", "Captcha token is required")
+			c.Abort()
+			return
+		}
+
+		if err := verifier.Verify(c.Request.Context(), token, ClientIP(c)); err != nil {
+			if errors.Is(err, service.ErrCaptchaFailed) {
+				respondError(c, http.StatusForbidden, "Forbidden", "Captcha verification failed")
+			} else {
+				respondError(c, http.StatusServiceUnavailable, "Service unavailable", "Captcha verification is temporarily unavailable")
+			}
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// captchaToken extracts the token from the header or the JSON body, "" when there is none
+// The body is restored so that handlers can bind it afterwards. Bodies over maxCaptchaBodySize
+// fail with *http.MaxBytesError.
+func captchaToken(c *gin.Context) (string, error) {
+	if token := c.GetHeader(CaptchaHeader); token != "" {
+		return token, nil
+	}
+
+	if c.Request.Body == nil {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCaptchaBodySize))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil
+	}
+
+	var token string
+	if err := json.Unmarshal(payload[captchaBodyField], &token); err != nil {
+		return "", nil
+	}
+
+	return token, nil
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// acceptingCaptcha accepts the token "ok"
+type acceptingCaptcha struct{}
+
+func (acceptingCaptcha) Verify(_ context.Context, token, _ string) error {
+	if token != "ok" {
+		return service.ErrCaptchaFailed
+	}
+	return nil
+}
+
+func TestCaptchaMiddlewareBody(t *testing.T) {
+	router := gin.New()
+	router.POST("/login", CaptchaMiddleware(acceptingCaptcha{}, []string{"/login"}), func(c *gin.Context) {
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.String(http.StatusOK, body.Email)
+	})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "token in body", body: `{"captcha_token":"ok","email":"user@example.com"}`, status: http.StatusOK},
+		{name: "no token", body: `{"email":"user@example.com"}`, status: http.StatusBadRequest},
+		{name: "oversized body", body: `{"captcha_token":"ok","email":"` + strings.Repeat("a", maxCaptchaBodySize) + `"}`, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			// The handler still binds the body read for the token
+			if tt.status == http.StatusOK && rec.Body.String() != "user@example.com" {
+				t.Errorf("Expected the body to be restored, got %q", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// ClientIP returns the client IP address of the request
+// Forwarding headers are only honored when the direct peer is one of the
+// trusted proxies configured on the router, so clients cannot spoof their IP
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// DeviceIDHeader carries a stable identifier of the client device, used to bind refresh tokens
+const DeviceIDHeader = "X-Device-ID"
+
+// maxDeviceIDLength bounds the device ID, longer ones are ignored
+const maxDeviceIDLength = 128
+
+// ClientInfoMiddleware stores the client IP, user agent and device ID in the request context
+// so that services can record them, e.g. as refresh token session metadata
+func ClientInfoMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deviceID := c.GetHeader(DeviceIDHeader)
+		if len(deviceID) > maxDeviceIDLength {
+			deviceID = ""
+		}
+		ctx := service.ContextWithClientInfo(c.Request.Context(), service.ClientInfo{
+			IP:        ClientIP(c),
+			UserAgent: c.Request.UserAgent(),
+			DeviceID:  deviceID,
+		})
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// ConsentHandler handles the consents of users to the terms of service and privacy policy
+type ConsentHandler struct {
+	consents *service.ConsentService
+}
+
+// NewConsentHandler creates a new consent handler
+func NewConsentHandler(consents *service.ConsentService) *ConsentHandler {
+	return &ConsentHandler{consents: consents}
+}
+
+// GetConsents handles listing the consents of the current user
+// @Summary Get policy consents
+// @Description Get the consent of the current user to each published policy document.
+// @Description Pending documents have to be accepted again, e.g. after a new version was published.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.ConsentResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/me/consents [get]
+// @Router /v2/auth/me/consents [get]
+func (h *ConsentHandler) GetConsents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	statuses, err := h.consents.Status(c.Request.Context(), userID.(string))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	response := make([]dto.ConsentResponse, 0, len(statuses))
+	for _, status := range statuses {
+		response = append(response, consentResponse(status))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AcceptConsent handles the acceptance of a policy document by the current user
+// @Summary Accept policy document
+// @Description Accept the current version of the terms of service or privacy policy, accepting it again is a no-op
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.AcceptConsentRequest true "Accepted document version"
+// @Success 200 {object} dto.ConsentResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse "The version is not current"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/me/consents [post]
+// @Router /v2/auth/me/consents [post]
+func (h *ConsentHandler) AcceptConsent(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	var req dto.AcceptConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.consents.Accept(ctx, userID.(string), req.Document, req.Version); err != nil {
+		if errors.Is(err, service.ErrOutdatedConsent) {
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	statuses, err := h.consents.Status(ctx, userID.(string))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+	for _, status := range statuses {
+		if status.Document == req.Document {
+			c.JSON(http.StatusOK, consentResponse(status))
+			return
+		}
+	}
+	respondError(c, http.StatusInternalServerError, "Internal server error", "accepted document is not published")
+}
+
+func consentResponse(status service.ConsentStatus) dto.ConsentResponse {
+	response := dto.ConsentResponse{
+		Document:       status.Document,
+		CurrentVersion: status.CurrentVersion,
+		Pending:        status.Pending(),
+	}
+	if status.Accepted != nil {
+		acceptedAt := status.Accepted.AcceptedAt.UTC().Format(time.RFC3339)
+		response.AcceptedVersion = &status.Accepted.Version
+		response.AcceptedAt = &acceptedAt
+	}
+	return response
+}
@@ -1,35 +1,124 @@
 package handler
 
 import (
+	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// CORSOptions configures CORSMiddleware
+type CORSOptions struct {
+	// AllowedOrigins are origins like https://app.example.com, https://*.example.com for its subdomains, or * for any
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are readable by scripts, e.g. the rate limit headers
+	ExposedHeaders []string
+	// MaxAge is how long browsers cache preflight responses, 0 omits Access-Control-Max-Age
+	MaxAge time.Duration
+	// RouteOrigins replace AllowedOrigins for paths under a prefix, the longest matching prefix applies.
+	// Prefixes are matched against the request path on segment boundaries, /api/v1/admin covers
+	// /api/v1/admin/users but not /api/v1/administrator; preflights don't match a route template.
+	RouteOrigins map[string][]string
+}
+
+// corsOrigins matches the Origin header against exact origins and subdomain patterns
+type corsOrigins struct {
+	any   bool
+	exact []string
+	// subdomains hold the scheme and the parent domain of https://*.example.com as
+	// "https://" and ".example.com", with the port of the pattern if any
+	subdomains [][2]string
+}
+
+func newCORSOrigins(origins []string) corsOrigins {
+	var o corsOrigins
+	for _, origin := range origins {
+		if origin == "*" {
+			o.any = true
+		} else if scheme, parent, ok := strings.Cut(origin, "://*."); ok {
+			o.subdomains = append(o.subdomains, [2]string{scheme + "://", "." + parent})
+		} else {
+			o.exact = append(o.exact, origin)
+		}
+	}
+	return o
+}
+
+func (o corsOrigins) allows(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if o.any || slices.Contains(o.exact, origin) {
+		return true
+	}
+	for _, pattern := range o.subdomains {
+		if !strings.HasPrefix(origin, pattern[0]) || !strings.HasSuffix(origin, pattern[1]) {
+			continue
+		}
+		// The subdomain may only hold labels, so no other host, port or userinfo can sneak in
+		subdomain := origin[len(pattern[0]) : len(origin)-len(pattern[1])]
+		if subdomain != "" && strings.Trim(subdomain, "abcdefghijklmnopqrstuvwxyz0123456789-.") == "" &&
+			!strings.HasPrefix(subdomain, ".") && !strings.HasSuffix(subdomain, ".") {
+			return true
+		}
+	}
+	return false
+}
+
 // CORSMiddleware creates a CORS middleware
-func CORSMiddleware(allowedOrigins, allowedMethods, allowedHeaders []string) gin.HandlerFunc {
+func CORSMiddleware(opts CORSOptions) gin.HandlerFunc {
+	origins := newCORSOrigins(opts.AllowedOrigins)
+	routeOrigins := make(map[string]corsOrigins, len(opts.RouteOrigins))
+	prefixes := make([]string, 0, len(opts.RouteOrigins))
+	for prefix, allowed := range opts.RouteOrigins {
+		prefix = strings.TrimSuffix(prefix, "/")
+		routeOrigins[prefix] = newCORSOrigins(allowed)
+		prefixes = append(prefixes, prefix)
+	}
+	// Longest prefixes first, so /api/v1/admin/users wins over /api/v1/admin
+	slices.SortFunc(prefixes, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	allowedMethods := strings.Join(opts.AllowedMethods, ", ")
+	exposedHeaders := strings.Join(opts.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge / time.Second))
+
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 
-		// Check if origin is allowed
-		allowed := false
-		for _, o := range allowedOrigins {
-			if o == "*" || o == origin {
-				allowed = true
+		allowed := origins
+		for _, prefix := range prefixes {
+			if path := c.Request.URL.Path; path == prefix || strings.HasPrefix(path, prefix+"/") {
+				allowed = routeOrigins[prefix]
 				break
 			}
 		}
 
-		if allowed {
+		// The response depends on the origin, caches must not serve it to other origins
+		c.Writer.Header().Add("Vary", "Origin")
+		if allowed.allows(origin) {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
-		c.Writer.Header().Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+		c.Writer.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		if exposedHeaders != "" {
+			c.Writer.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if c.Request.Method == http.MethodOptions {
+			if opts.MaxAge > 0 {
+				c.Writer.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"expvar"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LogLevelPath reads (GET) and changes (PUT {"level":"debug"}) the log level at runtime
+const LogLevelPath = "/debug/log-level"
+
+// pprofProfiles are the runtime profiles served by name, see runtime/pprof
+var pprofProfiles = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+var (
+	startTime          = time.Now()
+	publishRuntimeOnce sync.Once
+)
+
+// RegisterDebugRoutes adds pprof, runtime stats and the log level endpoint
+// They expose internals of the process and must only be served on the internal listener.
+func RegisterDebugRoutes(router gin.IRouter, level zap.AtomicLevel) {
+	publishRuntimeOnce.Do(publishRuntimeStats)
+
+	debug := router.Group("/debug")
+
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	for _, profile := range pprofProfiles {
+		debug.GET("/pprof/"+profile, gin.WrapH(pprof.Handler(profile)))
+	}
+
+	debug.GET("/vars", gin.WrapH(expvar.Handler()))
+
+	debug.GET("/log-level", gin.WrapH(level))
+	debug.PUT("/log-level", gin.WrapH(level))
+}
+
+// publishRuntimeStats adds runtime figures to /debug/vars next to the default cmdline and memstats
+func publishRuntimeStats() {
+	expvar.Publish("runtime", expvar.Func(func() any {
+		return map[string]any{
+			"goroutines":     runtime.NumGoroutine(),
+			"gomaxprocs":     runtime.GOMAXPROCS(0),
+			"num_cpu":        runtime.NumCPU(),
+			"go_version":     runtime.Version(),
+			"uptime_seconds": int64(time.Since(startTime).Seconds()),
+		}
+	}))
+}
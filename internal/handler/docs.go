@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/docs"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// OpenAPIPath is the route serving the generated specification
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPIHandler serves the specification generated by swag from the handler annotations
+func OpenAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(docs.SwaggerInfo.ReadDoc()))
+}
+
+// SwaggerUIHandler serves Swagger UI under /swagger/*any backed by OpenAPIPath
+func SwaggerUIHandler() gin.HandlerFunc {
+	return ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL(OpenAPIPath))
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DrainMiddleware rejects requests with 503 while the service shuts down
+// It guards expensive routes like login, whose bcrypt work would otherwise delay the shutdown,
+// clients retry them on another instance after Retry-After.
+func DrainMiddleware(draining func() bool, retryAfter time.Duration) gin.HandlerFunc {
+	seconds := retryAfterSeconds(retryAfter)
+
+	return func(c *gin.Context) {
+		if !draining() {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.Header("Connection", "close")
+		respondError(c, http.StatusServiceUnavailable, "Service Unavailable", "Service is shutting down, try again in %ds", seconds)
+		c.Abort()
+	}
+}
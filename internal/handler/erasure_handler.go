@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// ErasureHandler handles account erasure requests of users
+type ErasureHandler struct {
+	erasures *service.ErasureService
+}
+
+// NewErasureHandler creates a new erasure handler
+func NewErasureHandler(erasures *service.ErasureService) *ErasureHandler {
+	return &ErasureHandler{erasures: erasures}
+}
+
+// RequestErasure handles a request of the current user to erase the account
+// @Summary Request account erasure
+// @Description Schedule the erasure of the current user account after the grace period, it can be cancelled until then.
+// @Description The account is deleted or anonymized, sessions and OAuth connections are removed.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 202 {object} dto.ErasureResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/me/erasure [post]
+// @Router /v2/auth/me/erasure [post]
+func (h *ErasureHandler) RequestErasure(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	erasure, err := h.erasures.Request(c.Request.Context(), userID.(string))
+	if err != nil {
+		if errors.Is(err, service.ErrErasurePending) {
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, erasureResponse(erasure))
+}
+
+// CancelErasure handles cancelling the pending erasure of the current user
+// @Summary Cancel account erasure
+// @Description Cancel the pending erasure of the current user account
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 204
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/me/erasure [delete]
+// @Router /v2/auth/me/erasure [delete]
+func (h *ErasureHandler) CancelErasure(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	if err := h.erasures.Cancel(c.Request.Context(), userID.(string)); err != nil {
+		if errors.Is(err, service.ErrErasureNotFound) {
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func erasureResponse(erasure *domain.Erasure) dto.ErasureResponse {
+	response := dto.ErasureResponse{
+		UserID:      erasure.UserID,
+		Status:      dto.ErasureStatusPending,
+		EmailHash:   erasure.EmailHash,
+		RequestedBy: erasure.RequestedBy,
+		Mode:        erasure.Mode,
+		RequestedAt: erasure.RequestedAt.UTC().Format(time.RFC3339),
+		EraseAfter:  erasure.EraseAfter.UTC().Format(time.RFC3339),
+	}
+	if erasure.ErasedAt != nil {
+		erasedAt := erasure.ErasedAt.UTC().Format(time.RFC3339)
+		response.Status = dto.ErasureStatusErased
+		response.ErasedAt = &erasedAt
+	}
+	return response
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/i18n"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// publicErrors are service errors whose messages are shown to clients and localized
+// The code is a stable machine-readable identifier returned by API v2
+var publicErrors = []struct {
+	err  error
+	code string
+}{
+	{service.ErrInvalidEmail, "invalid_email"},
+	{service.ErrWeakPassword, "weak_password"},
+	{service.ErrUserExists, "user_exists"},
+	{service.ErrInvalidUsername, "invalid_username"},
+	{service.ErrUsernameTaken, "username_taken"},
+	{service.ErrInvalidCredentials, "invalid_credentials"},
+	{service.ErrUserInactive, "user_inactive"},
+	{service.ErrAccountBanned, "account_banned"},
+	{service.ErrEmailNotVerified, "email_not_verified"},
+	{service.ErrInvalidRefreshToken, "invalid_refresh_token"},
+	{service.ErrRefreshTokenExpired, "refresh_token_expired"},
+	{service.ErrTokenRevoked, "token_revoked"},
+	{service.ErrDeviceMismatch, "device_mismatch"},
+	{service.ErrSessionNotFound, "session_not_found"},
+	{service.ErrPasswordAlreadySet, "password_already_set"},
+	{service.ErrOAuthProviderNotFound, "oauth_provider_not_found"},
+	{service.ErrInvalidOAuthState, "invalid_oauth_state"},
+	{service.ErrOAuthEmailNotVerified, "oauth_email_not_verified"},
+	{service.ErrRecoveryNotAllowed, "recovery_not_allowed"},
+	{service.ErrOAuthProviderNotLinked, "provider_not_linked"},
+	{service.ErrProviderTokenUnavailable, "provider_token_unavailable"},
+	{service.ErrInvalidKerberosTicket, "invalid_kerberos_ticket"},
+	{service.ErrKerberosUserNotFound, "kerberos_user_not_found"},
+	{service.ErrInvalidSIWEMessage, "invalid_siwe_message"},
+	{service.ErrInvalidSIWESignature, "invalid_siwe_signature"},
+	{service.ErrReauthenticationRequired, "reauthentication_required"},
+	{service.ErrInvalidToken, "invalid_token"},
+	{service.ErrServerBusy, "server_busy"},
+	{service.ErrRotationFailed, "rotation_failed"},
+	{service.ErrErasurePending, "erasure_pending"},
+	{service.ErrErasureNotFound, "erasure_not_found"},
+	{service.ErrConsentRequired, "consent_required"},
+	{service.ErrOutdatedConsent, "outdated_consent"},
+	{service.ErrInvitationRequired, "invitation_required"},
+	{service.ErrEmailDomainNotAllowed, "email_domain_not_allowed"},
+	{service.ErrInvalidInvitation, "invalid_invitation"},
+	{service.ErrInvitationNotFound, "invitation_not_found"},
+	{service.ErrOrganizationNotFound, "organization_not_found"},
+	{service.ErrMemberNotFound, "member_not_found"},
+	{service.ErrAlreadyMember, "already_member"},
+	{service.ErrOrgPermissionDenied, "org_permission_denied"},
+	{service.ErrLastOwner, "last_owner"},
+	{service.ErrTenantNotFound, "tenant_not_found"},
+	{service.ErrRedirectNotAllowed, "redirect_not_allowed"},
+	{service.ErrTooManyAttempts, "too_many_attempts"},
+	{service.ErrFeatureDisabled, "feature_disabled"},
+}
+
+// busyRetryAfter is suggested to clients rejected because password hashing is saturated
+const busyRetryAfter = time.Second
+
+// respondError writes an error response tagged with the request ID
+// The message is translated to the request locale and formatted with args if any
+func respondError(c *gin.Context, status int, errorTitle, message string, args ...any) {
+	writeError(c, status, errorTitle, "", message, args...)
+}
+
+// respondServiceError writes an error response for an error returned by a service
+// Known errors are reduced to their stable message, so that it can be localized, along with
+// the fields they reject if any
+func respondServiceError(c *gin.Context, status int, errorTitle string, err error) {
+	for _, public := range publicErrors {
+		if errors.Is(err, public.err) {
+			writeErrorDetails(c, status, errorTitle, public.code, serviceFieldErrors(c, err), public.err.Error())
+			return
+		}
+	}
+	writeError(c, status, errorTitle, "", err.Error())
+}
+
+// publicErrorCode returns the code of a public error, server_error for other errors
+func publicErrorCode(err error) string {
+	for _, public := range publicErrors {
+		if errors.Is(err, public.err) {
+			return public.code
+		}
+	}
+	return "server_error"
+}
+
+// respondRetryable writes a response with Retry-After if err means the request may succeed later:
+// 503 when the service is overloaded or a refresh token couldn't be rotated, 429 when
+// anti-enumeration limits are exhausted.
+// It reports whether a response was written.
+func respondRetryable(c *gin.Context, err error) bool {
+	var status int
+	var title string
+	retryAfter := busyRetryAfter
+	switch {
+	case errors.Is(err, service.ErrServerBusy), errors.Is(err, service.ErrRotationFailed):
+		status, title = http.StatusServiceUnavailable, "Service Unavailable"
+	case errors.Is(err, service.ErrTooManyAttempts):
+		status, title = http.StatusTooManyRequests, "Too Many Requests"
+	default:
+		return false
+	}
+
+	var retryErr *service.RetryAfterError
+	if errors.As(err, &retryErr) {
+		retryAfter = retryErr.RetryAfter
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	respondServiceError(c, status, title, err)
+	return true
+}
+
+// writeError writes the error response, API v2 responses also carry an error code
+// that defaults to the snake-cased title, e.g. "validation_failed"
+func writeError(c *gin.Context, status int, errorTitle, code, message string, args ...any) {
+	writeErrorDetails(c, status, errorTitle, code, nil, message, args...)
+}
+
+// writeErrorDetails writes the error response along with the fields the request got wrong
+func writeErrorDetails(c *gin.Context, status int, errorTitle, code string, fields []dto.FieldError, message string, args ...any) {
+	response := dto.ErrorResponse{
+		Error:     errorTitle,
+		Message:   i18n.Translate(Locale(c), message, args...),
+		Details:   fields,
+		RequestID: c.GetString("request_id"),
+	}
+
+	if apiVersion(c) >= APIVersion2 {
+		if code == "" {
+			code = strings.ReplaceAll(strings.ToLower(errorTitle), " ", "_")
+		}
+		response.Code = code
+	}
+
+	c.JSON(status, response)
+}
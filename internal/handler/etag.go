@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+// profileCacheControl lets clients keep profiles but makes them revalidate every time
+const profileCacheControl = "private, max-age=0, must-revalidate"
+
+// userETag returns a weak ETag of a user profile, derived from when it was last updated
+// The login count is included since logins don't update the profile on every backend.
+func userETag(user *dto.UserResponse) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s|%s|%d", user.ID, user.UpdatedAt, user.LoginCount)
+	return fmt.Sprintf(`W/"%x"`, hash.Sum64())
+}
+
+// setProfileValidators sets the caching headers of a user profile response
+func setProfileValidators(c *gin.Context, etag string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", profileCacheControl)
+}
+
+// notModified reports whether the copy of the client is current per If-None-Match, with the weak
+// comparison of RFC 9110, and if so responds 304
+func notModified(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			// Representations vary by Accept, see respondNegotiated
+			c.Writer.Header().Add("Vary", "Accept")
+			c.Status(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestGetMeETag(t *testing.T) {
+	user := &dto.UserResponse{ID: "user-1", Email: "alice@example.com", UpdatedAt: "2026-01-02T03:04:05Z", LoginCount: 3}
+	authService := &testutil.AuthService{
+		GetUserFunc: func(ctx context.Context, userID string) (*dto.UserResponse, error) {
+			copied := *user
+			return &copied, nil
+		},
+	}
+	handler := NewAuthHandler(authService, CookieOptions{})
+
+	router := gin.New()
+	router.GET("/me", func(c *gin.Context) {
+		c.Set("user_id", "user-1")
+		c.Next()
+	}, handler.GetMe)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || len(etag) < 4 || etag[:3] != `W/"` {
+		t.Fatalf("Expected 200 with a weak ETag, got %d and %q", rec.Code, etag)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private, max-age=0, must-revalidate" {
+		t.Errorf("Unexpected Cache-Control %q", got)
+	}
+
+	for _, ifNoneMatch := range []string{etag, etag[2:], `"other", ` + etag, "*"} {
+		rec := get(ifNoneMatch)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+			t.Errorf("Expected 304 with the ETag for If-None-Match %q, got %d", ifNoneMatch, rec.Code)
+		}
+	}
+	if rec := get(`W/"other"`); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for another ETag, got %d", rec.Code)
+	}
+
+	// Profile updates and logins change the ETag
+	user.UpdatedAt = "2026-01-02T03:04:06Z"
+	if rec := get(etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("Expected 200 with a new ETag after an update, got %d", rec.Code)
+	}
+	etag = get("").Header().Get("ETag")
+	user.LoginCount++
+	if rec := get(etag); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 after a login, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// Headers set on allowed requests for Envoy to add to the upstream request
+const (
+	ExtAuthzUserIDHeader = "X-User-Id"
+	ExtAuthzEmailHeader  = "X-User-Email"
+	// ExtAuthzRolesHeader lists the roles of the user comma-separated, the organization role of
+	// tokens scoped to an organization
+	ExtAuthzRolesHeader = "X-Roles"
+	// ExtAuthzOrgIDHeader is the organization of tokens scoped to an organization
+	ExtAuthzOrgIDHeader = "X-Org-Id"
+	// ExtAuthzRestrictedHeader is "true" for users restricted by an admin, "false" otherwise
+	ExtAuthzRestrictedHeader = "X-User-Restricted"
+)
+
+// ExtAuthzHandler implements the HTTP service of the Envoy external authorization filter
+// Envoy sends the headers of each request to check under a path prefix. A 200 response allows the
+// request and Envoy adds the identity headers of the response to it, any other response is
+// returned to the client instead.
+type ExtAuthzHandler struct {
+	authService service.AuthService
+	cookie      string
+	options     authOptions
+}
+
+// NewExtAuthzHandler creates a new ext_authz handler reading access tokens from the Authorization
+// header, or from the cookie when it isn't empty and the header is missing
+func NewExtAuthzHandler(authService service.AuthService, cookie string, opts ...AuthOption) *ExtAuthzHandler {
+	h := &ExtAuthzHandler{authService: authService, cookie: cookie}
+	for _, opt := range opts {
+		opt(&h.options)
+	}
+	return h
+}
+
+// Check allows requests carrying a valid access token and sets the identity headers
+// The identity headers are always set, even empty, so that Envoy replaces those sent by clients.
+func (h *ExtAuthzHandler) Check(c *gin.Context) {
+	token, ok := h.token(c)
+	if !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "Access token is required")
+		return
+	}
+
+	// Envoy keeps the method of the checked request, expired tokens are only accepted on reads
+	var validateOpts []service.ValidateOption
+	if h.options.expiryGrace > 0 && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+		validateOpts = append(validateOpts, service.WithExpiryGrace(h.options.expiryGrace))
+	}
+
+	claims, err := h.authService.ValidateToken(c.Request.Context(), token, validateOpts...)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenRevoked) {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	// gin drops headers set to empty values, so they are set on the writer directly
+	header := c.Writer.Header()
+	header.Set(ExtAuthzUserIDHeader, claims.UserID)
+	header.Set(ExtAuthzEmailHeader, claims.Email)
+	header.Set(ExtAuthzRolesHeader, claims.OrgRole)
+	header.Set(ExtAuthzOrgIDHeader, claims.OrgID)
+	header.Set(ExtAuthzRestrictedHeader, strconv.FormatBool(claims.Restricted))
+	c.Status(http.StatusOK)
+}
+
+// token returns the bearer token of the Authorization header, or the value of the cookie
+func (h *ExtAuthzHandler) token(c *gin.Context) (string, bool) {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		token, found := strings.CutPrefix(authHeader, "Bearer ")
+		return token, found && token != ""
+	}
+	if h.cookie == "" {
+		return "", false
+	}
+	token, err := c.Cookie(h.cookie)
+	return token, err == nil && token != ""
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestExtAuthz(t *testing.T) {
+	authService := &testutil.AuthService{
+		ValidateTokenFunc: func(ctx context.Context, token string) (*domain.TokenClaims, error) {
+			switch token {
+			case "valid":
+				return &domain.TokenClaims{UserID: "user-1", Email: "user@example.com"}, nil
+			case "org":
+				return &domain.TokenClaims{UserID: "user-1", Email: "user@example.com", OrgID: "org-1", OrgRole: "admin"}, nil
+			case "restricted":
+				return &domain.TokenClaims{UserID: "user-1", Email: "user@example.com", Restricted: true}, nil
+			}
+			return nil, service.ErrInvalidToken
+		},
+	}
+	router := gin.New()
+	router.Any("/ext_authz/*path", NewExtAuthzHandler(authService, "access_token").Check)
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string
+		cookie     string
+		status     int
+		roles      string
+		orgID      string
+		restricted string
+	}{
+		{name: "bearer token", method: http.MethodGet, header: "Bearer valid", status: http.StatusOK, restricted: "false"},
+		{name: "organization token", method: http.MethodPost, header: "Bearer org", status: http.StatusOK, roles: "admin", orgID: "org-1", restricted: "false"},
+		{name: "restricted user", method: http.MethodGet, header: "Bearer restricted", status: http.StatusOK, restricted: "true"},
+		{name: "cookie", method: http.MethodDelete, cookie: "valid", status: http.StatusOK, restricted: "false"},
+		{name: "header before cookie", method: http.MethodGet, header: "Bearer invalid", cookie: "valid", status: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodGet, header: "Bearer invalid", status: http.StatusUnauthorized},
+		{name: "wrong scheme", method: http.MethodGet, header: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized},
+		{name: "anonymous", method: http.MethodGet, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/ext_authz/api/orders?page=2", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "access_token", Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status != http.StatusOK {
+				if rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("Expected a WWW-Authenticate challenge on denials")
+				}
+				if _, found := rec.Header()[ExtAuthzUserIDHeader]; found {
+					t.Error("Expected no identity headers on denials")
+				}
+				return
+			}
+			if got := rec.Header().Get(ExtAuthzUserIDHeader); got != "user-1" {
+				t.Errorf("Expected user ID header user-1, got %q", got)
+			}
+			if got := rec.Header().Get(ExtAuthzEmailHeader); got != "user@example.com" {
+				t.Errorf("Expected email header, got %q", got)
+			}
+			// Set even when empty, so that Envoy replaces roles sent by the client
+			if roles, found := rec.Header()[ExtAuthzRolesHeader]; !found || roles[0] != tt.roles {
+				t.Errorf("Expected roles header %q, got %q", tt.roles, roles)
+			}
+			if orgID, found := rec.Header()[ExtAuthzOrgIDHeader]; !found || orgID[0] != tt.orgID {
+				t.Errorf("Expected organization header %q, got %q", tt.orgID, orgID)
+			}
+			if got := rec.Header().Get(ExtAuthzRestrictedHeader); got != tt.restricted {
+				t.Errorf("Expected restricted header %q, got %q", tt.restricted, got)
+			}
+		})
+	}
+}
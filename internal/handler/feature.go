@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// FeatureDisabled responds to routes of features turned off in the configuration
+// The route answers 404 like an unknown one, the feature_disabled code tells clients why.
+func FeatureDisabled(c *gin.Context) {
+	respondServiceError(c, http.StatusNotFound, "Not Found", service.ErrFeatureDisabled)
+	c.Abort()
+}
+
+// Feature returns the handlers of a route, or FeatureDisabled when its feature is turned off
+func Feature(enabled bool, handlers ...gin.HandlerFunc) []gin.HandlerFunc {
+	if !enabled {
+		return []gin.HandlerFunc{FeatureDisabled}
+	}
+	return handlers
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+// gatewayConfigCacheControl lets gateways and proxies reuse the configuration, it only changes on restart
+const gatewayConfigCacheControl = "public, max-age=300"
+
+// GatewayConfigHandler publishes how access tokens are verified, so that API gateways (Kong,
+// Envoy, Traefik) can be configured against the service automatically
+type GatewayConfigHandler struct {
+	config dto.GatewayConfigResponse
+}
+
+// NewGatewayConfigHandler creates a new gateway configuration handler
+// The introspection endpoint is filled in with the API version of each request.
+func NewGatewayConfigHandler(config dto.GatewayConfigResponse) *GatewayConfigHandler {
+	return &GatewayConfigHandler{config: config}
+}
+
+// GetConfig handles the token verification configuration for gateways
+// @Summary Get token verification configuration
+// @Description Describe how access tokens are verified: issuer, audience, format, signing algorithms, lifetimes and the introspection endpoint.
+// @Description There is no JWKS URI, tokens are signed with HMAC secrets shared with gateways out of band; opaque tokens can only be introspected.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} dto.GatewayConfigResponse
+// @Router /v1/auth/config [get]
+// @Router /v2/auth/config [get]
+func (h *GatewayConfigHandler) GetConfig(c *gin.Context) {
+	config := h.config
+	config.IntrospectionEndpoint = apiVersion(c).Prefix() + "/auth/introspect"
+
+	c.Header("Cache-Control", gatewayConfigCacheControl)
+	c.JSON(http.StatusOK, config)
+}
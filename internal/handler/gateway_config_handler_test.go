@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+func TestGatewayConfig(t *testing.T) {
+	h := NewGatewayConfigHandler(dto.GatewayConfigResponse{
+		Issuer:              "https://auth.example.com",
+		AccessTokenFormat:   "jwt",
+		SigningAlgorithms:   []string{"HS256"},
+		AccessTokenLifetime: 900,
+	})
+	router := gin.New()
+	for _, version := range []APIVersion{APIVersion1, APIVersion2} {
+		router.GET(version.Prefix()+"/auth/config", APIVersionMiddleware(version), h.GetConfig)
+	}
+
+	for _, version := range []APIVersion{APIVersion1, APIVersion2} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, version.Prefix()+"/auth/config", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d", version, w.Code)
+		}
+		if w.Header().Get("Cache-Control") == "" {
+			t.Errorf("Expected the configuration to be cacheable")
+		}
+
+		var config dto.GatewayConfigResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &config); err != nil {
+			t.Fatalf("Failed to decode the configuration: %v", err)
+		}
+		if config.IntrospectionEndpoint != version.Prefix()+"/auth/introspect" {
+			t.Errorf("Expected the introspection endpoint of %s, got %q", version, config.IntrospectionEndpoint)
+		}
+		if config.Issuer != "https://auth.example.com" || config.AccessTokenLifetime != 900 {
+			t.Errorf("Expected the configured issuer and lifetime, got %+v", config)
+		}
+	}
+}
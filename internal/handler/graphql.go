@@ -0,0 +1,423 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/i18n"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// graphQLRequest is a GraphQL request sent as a JSON body
+type graphQLRequest struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// maxGraphQLBodySize limits the body LoginGuard reads to find login mutations
+const maxGraphQLBodySize = 64 << 10
+
+// graphQLUserKey carries the authenticated user ID to resolvers
+type graphQLUserKey struct{}
+
+// graphQLError is a resolver error exposing the API v2 error code in extensions
+type graphQLError struct {
+	message string
+	code    string
+}
+
+func (e *graphQLError) Error() string { return e.message }
+
+func (e *graphQLError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// GraphQLHandler serves auth queries and mutations over GraphQL
+// Requests are authenticated with access tokens by OptionalAuthMiddleware, refresh tokens are passed in arguments
+type GraphQLHandler struct {
+	authService service.AuthService
+	schema      graphql.Schema
+	// passwordLogin is turned off with PASSWORD_LOGIN_ENABLED, the login mutation then fails
+	passwordLogin bool
+}
+
+// NewGraphQLHandler creates a new GraphQL handler
+func NewGraphQLHandler(authService service.AuthService, passwordLogin bool) (*GraphQLHandler, error) {
+	h := &GraphQLHandler{authService: authService, passwordLogin: passwordLogin}
+
+	schema, err := h.newSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build graphql schema: %w", err)
+	}
+	h.schema = schema
+
+	return h, nil
+}
+
+// Serve handles GraphQL requests, the schema is discoverable through introspection
+func (h *GraphQLHandler) Serve(c *gin.Context) {
+	var req graphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	if userID := c.GetString("user_id"); userID != "" {
+		ctx = context.WithValue(ctx, graphQLUserKey{}, userID)
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+
+	c.JSON(http.StatusOK, result)
+}
+
+// LoginGuard returns handlers rejecting requests with more than one login or refresh mutation, each
+// would be another password or token attempt, and running guards only on requests logging in.
+// Requests logging in get the rate limit and CAPTCHA policies of loginRoute, so that guards such as
+// RateLimitPolicyMiddleware and CaptchaMiddleware treat them like the login endpoint.
+func (h *GraphQLHandler) LoginGuard(loginRoute string, guards ...gin.HandlerFunc) []gin.HandlerFunc {
+	handlers := []gin.HandlerFunc{func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxGraphQLBodySize))
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, "Request entity too large", "Request bodies are limited to %d bytes", tooLarge.Limit)
+			c.Abort()
+			return
+		}
+
+		// Malformed requests and queries are reported by Serve
+		var req graphQLRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return
+		}
+		doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+		if err != nil {
+			return
+		}
+
+		logins, refreshes := countAuthMutations(doc, req.OperationName)
+		if logins+refreshes > 1 {
+			respondError(c, http.StatusBadRequest, "Bad request", "Only one login or refresh mutation is allowed per request")
+			c.Abort()
+			return
+		}
+		if logins > 0 {
+			c.Set(policyRouteKey, loginRoute)
+		}
+	}}
+
+	for _, guard := range guards {
+		handlers = append(handlers, func(c *gin.Context) {
+			if c.GetString(policyRouteKey) == loginRoute {
+				guard(c)
+			}
+		})
+	}
+	return handlers
+}
+
+// countAuthMutations counts the login and refresh fields of the mutations a request may run,
+// including those selected through fragments
+func countAuthMutations(doc *ast.Document, operationName string) (logins, refreshes int) {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok && fragment.Name != nil {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	var count func(set *ast.SelectionSet, spread map[string]bool)
+	count = func(set *ast.SelectionSet, spread map[string]bool) {
+		if set == nil {
+			return
+		}
+		for _, selection := range set.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				switch selection.Name.Value {
+				case "login":
+					logins++
+				case "refresh":
+					refreshes++
+				}
+			case *ast.InlineFragment:
+				count(selection.SelectionSet, spread)
+			case *ast.FragmentSpread:
+				// Spreading a fragment again selects the same fields, cycles are rejected by validation
+				name := selection.Name.Value
+				if fragment, ok := fragments[name]; ok && !spread[name] {
+					spread[name] = true
+					count(fragment.SelectionSet, spread)
+				}
+			}
+		}
+	}
+
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok || operation.Operation != ast.OperationTypeMutation {
+			continue
+		}
+		if operationName != "" && (operation.Name == nil || operation.Name.Value != operationName) {
+			continue
+		}
+		count(operation.SelectionSet, make(map[string]bool))
+	}
+	return logins, refreshes
+}
+
+func (h *GraphQLHandler) newSchema() (graphql.Schema, error) {
+	userInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserInfo",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolveUserInfo(func(u dto.UserInfo) any { return u.ID })},
+			"email":    &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveUserInfo(func(u dto.UserInfo) any { return u.Email })},
+			"username": &graphql.Field{Type: graphql.String, Resolve: resolveUserInfo(func(u dto.UserInfo) any { return u.Username })},
+		},
+	})
+
+	authPayloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuthPayload",
+		Fields: graphql.Fields{
+			"accessToken":           &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.AccessToken })},
+			"tokenType":             &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.TokenType })},
+			"expiresIn":             &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.ExpiresIn })},
+			"refreshToken":          &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.RefreshToken })},
+			"refreshTokenExpiresIn": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.RefreshTokenExpiresIn })},
+			"expiresAt":             &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.ExpiresAt })},
+			"refreshExpiresAt":      &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.RefreshExpiresAt })},
+			"sessionId":             &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.SessionID })},
+			"user":                  &graphql.Field{Type: graphql.NewNonNull(userInfoType), Resolve: resolveTokens(func(t *dto.TokenResponse) any { return t.User })},
+		},
+	})
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolveUser(func(u *dto.UserResponse) any { return u.ID })},
+			"email":           &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveUser(func(u *dto.UserResponse) any { return u.Email })},
+			"username":        &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.Username })},
+			"createdAt":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveUser(func(u *dto.UserResponse) any { return u.CreatedAt })},
+			"updatedAt":       &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveUser(func(u *dto.UserResponse) any { return u.UpdatedAt })},
+			"lastLoginAt":     &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.LastLoginAt })},
+			"lastLoginIp":     &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.LastLoginIP })},
+			"previousLoginAt": &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.PreviousLoginAt })},
+			"previousLoginIp": &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.PreviousLoginIP })},
+			"loginCount":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: resolveUser(func(u *dto.UserResponse) any { return u.LoginCount })},
+			"isEmailVerified": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: resolveUser(func(u *dto.UserResponse) any { return u.IsEmailVerified })},
+			"firstName":       &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.FirstName })},
+			"lastName":        &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.LastName })},
+			"displayName":     &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.DisplayName })},
+			"avatarUrl":       &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.AvatarURL })},
+			"locale":          &graphql.Field{Type: graphql.String, Resolve: resolveUser(func(u *dto.UserResponse) any { return u.Locale })},
+		},
+	})
+
+	sessionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Session",
+		Fields: graphql.Fields{
+			"id":         &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: resolveSession(func(s *dto.SessionResponse) any { return s.ID })},
+			"createdAt":  &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveSession(func(s *dto.SessionResponse) any { return s.CreatedAt })},
+			"expiresAt":  &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: resolveSession(func(s *dto.SessionResponse) any { return s.ExpiresAt })},
+			"deviceInfo": &graphql.Field{Type: graphql.String, Resolve: resolveSession(func(s *dto.SessionResponse) any { return s.DeviceInfo })},
+			"ipAddress":  &graphql.Field{Type: graphql.String, Resolve: resolveSession(func(s *dto.SessionResponse) any { return s.IPAddress })},
+			"location":   &graphql.Field{Type: graphql.String, Resolve: resolveSession(func(s *dto.SessionResponse) any { return s.Location })},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type:    graphql.NewNonNull(userType),
+				Resolve: h.resolveMe,
+			},
+			"sessions": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sessionType))),
+				Resolve: h.resolveSessions,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"login": &graphql.Field{
+				Type: graphql.NewNonNull(authPayloadType),
+				Args: graphql.FieldConfigArgument{
+					"identifier": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"password":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveLogin,
+			},
+			"refresh": &graphql.Field{
+				Type: graphql.NewNonNull(authPayloadType),
+				Args: graphql.FieldConfigArgument{
+					"refreshToken": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: h.resolveRefresh,
+			},
+			"logout": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"refreshToken": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: h.resolveLogout,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    query,
+		Mutation: mutation,
+	})
+}
+
+func (h *GraphQLHandler) resolveMe(p graphql.ResolveParams) (any, error) {
+	userID, err := graphQLUserID(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.authService.GetUser(p.Context, userID)
+	if err != nil {
+		return nil, graphQLServiceError(p.Context, err)
+	}
+	return user, nil
+}
+
+func (h *GraphQLHandler) resolveSessions(p graphql.ResolveParams) (any, error) {
+	userID, err := graphQLUserID(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := h.authService.ListSessions(p.Context, userID)
+	if err != nil {
+		return nil, graphQLServiceError(p.Context, err)
+	}
+	return sessions, nil
+}
+
+func (h *GraphQLHandler) resolveLogin(p graphql.ResolveParams) (any, error) {
+	if !h.passwordLogin {
+		return nil, graphQLServiceError(p.Context, service.ErrFeatureDisabled)
+	}
+
+	identifier, _ := p.Args["identifier"].(string)
+	password, _ := p.Args["password"].(string)
+
+	response, err := h.authService.Login(p.Context, &dto.LoginRequest{Identifier: identifier, Password: password})
+	if err != nil {
+		return nil, graphQLServiceError(p.Context, err)
+	}
+	return tokenResponse(response), nil
+}
+
+func (h *GraphQLHandler) resolveRefresh(p graphql.ResolveParams) (any, error) {
+	refreshToken, _ := p.Args["refreshToken"].(string)
+
+	response, err := h.authService.RefreshToken(p.Context, refreshToken)
+	if err != nil {
+		return nil, graphQLServiceError(p.Context, err)
+	}
+	return tokenResponse(response), nil
+}
+
+func (h *GraphQLHandler) resolveLogout(p graphql.ResolveParams) (any, error) {
+	userID, err := graphQLUserID(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, _ := p.Args["refreshToken"].(string)
+	if err := h.authService.Logout(p.Context, userID, refreshToken); err != nil {
+		return nil, graphQLServiceError(p.Context, err)
+	}
+	return true, nil
+}
+
+// graphQLUserID returns the authenticated user or an unauthorized error
+func graphQLUserID(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value(graphQLUserKey{}).(string)
+	if !ok || userID == "" {
+		return "", &graphQLError{
+			message: i18n.Translate(i18n.FromContext(ctx), "Authorization header is required"),
+			code:    "unauthorized",
+		}
+	}
+	return userID, nil
+}
+
+// graphQLServiceError maps service errors to localized GraphQL errors
+// Unknown errors are not exposed to clients
+func graphQLServiceError(ctx context.Context, err error) error {
+	for _, public := range publicErrors {
+		if errors.Is(err, public.err) {
+			return &graphQLError{
+				message: i18n.Translate(i18n.FromContext(ctx), public.err.Error()),
+				code:    public.code,
+			}
+		}
+	}
+	return &graphQLError{
+		message: i18n.Translate(i18n.FromContext(ctx), "Internal server error"),
+		code:    "internal_server_error",
+	}
+}
+
+// tokenResponse converts issued tokens to the payload returned by API v2 and GraphQL
+func tokenResponse(response *service.AuthResponseWithRefreshToken) *dto.TokenResponse {
+	return &dto.TokenResponse{
+		AuthResponse:          *response.AuthResponse,
+		RefreshToken:          response.RefreshToken,
+		RefreshTokenExpiresIn: response.ExpiresIn,
+		ExpiresAt:             response.AccessExpiresAt.UTC().Format(time.RFC3339),
+		RefreshExpiresAt:      response.RefreshExpiresAt.UTC().Format(time.RFC3339),
+		SessionID:             response.SessionID,
+	}
+}
+
+func resolveUserInfo(field func(dto.UserInfo) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return field(p.Source.(dto.UserInfo)), nil
+	}
+}
+
+func resolveTokens(field func(*dto.TokenResponse) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return field(p.Source.(*dto.TokenResponse)), nil
+	}
+}
+
+func resolveUser(field func(*dto.UserResponse) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return field(p.Source.(*dto.UserResponse)), nil
+	}
+}
+
+func resolveSession(field func(*dto.SessionResponse) any) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (any, error) {
+		return field(p.Source.(*dto.SessionResponse)), nil
+	}
+}
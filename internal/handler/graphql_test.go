@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestGraphQLLoginGuard(t *testing.T) {
+	limiter := &testutil.RateLimiter{}
+	rateLimit := RateLimitPolicyMiddleware(limiter, map[string]RateLimitPolicy{
+		"/login": {Limit: 2, Window: time.Minute, KeyFunc: IPBasedKey},
+	})
+
+	h := &GraphQLHandler{}
+	handlers := h.LoginGuard("/login", rateLimit, CaptchaMiddleware(acceptingCaptcha{}, []string{"/login"}))
+	router := gin.New()
+	router.POST("/graphql", append(handlers, func(c *gin.Context) {
+		// Serve still binds the body read by the guard
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})...)
+
+	login := `mutation { login(identifier: "user@example.com", password: "Password123") { accessToken } }`
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		captcha       string
+		status        int
+	}{
+		{name: "query", query: `{ me { email } }`, status: http.StatusOK},
+		{name: "aliased logins", query: `mutation { a: login(identifier: "a", password: "b") { accessToken } b: login(identifier: "a", password: "c") { accessToken } }`, status: http.StatusBadRequest},
+		{name: "login and refresh in fragments", query: `mutation { ...Login ... on Mutation { refresh(refreshToken: "t") { accessToken } } } fragment Login on Mutation { login(identifier: "a", password: "b") { accessToken } }`, status: http.StatusBadRequest},
+		{name: "other operation", query: login + ` query Me { me { email } }`, operationName: "Me", status: http.StatusOK},
+		// Like on the login endpoint, attempts without a CAPTCHA count towards the limit
+		{name: "login without captcha", query: login, status: http.StatusBadRequest},
+		{name: "login", query: login, captcha: "ok", status: http.StatusOK},
+		{name: "login over the login limit", query: login, captcha: "ok", status: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"query": tt.query, "operationName": tt.operationName})
+			req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+			if tt.captcha != "" {
+				req.Header.Set(CaptchaHeader, tt.captcha)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != string(body) {
+				t.Errorf("Expected the body to be restored, got %q", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// InvitationHandler handles signup invitations
+// It serves both the admin API, acting on all invitations, and users when they may invite,
+// acting on their own invitations.
+type InvitationHandler struct {
+	invitations *service.InvitationService
+}
+
+// NewInvitationHandler creates a new invitation handler
+func NewInvitationHandler(invitations *service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitations: invitations}
+}
+
+// CreateInvitation handles creating an invitation
+// @Summary Create invitation
+// @Description Invite an email to sign up, optionally with a role and tenant recorded on the invitation.
+// @Description The token is only returned in this response. Users can invite when INVITATION_ALLOW_USERS is enabled.
+// @Tags invitations
+// @Security AdminToken
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateInvitationRequest true "Invitation"
+// @Success 201 {object} dto.CreateInvitationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/invitations [post]
+// @Router /v1/auth/invitations [post]
+// @Router /v2/auth/invitations [post]
+func (h *InvitationHandler) CreateInvitation(c *gin.Context) {
+	var req dto.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	invitation, token, err := h.invitations.Create(c.Request.Context(), service.CreateInvitation{
+		Email:     req.Email,
+		Role:      req.Role,
+		Tenant:    req.Tenant,
+		InvitedBy: c.GetString("user_id"),
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidEmail) {
+			respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreateInvitationResponse{
+		InvitationResponse: invitationResponse(invitation),
+		Token:              token,
+	})
+}
+
+// ListInvitations handles listing invitations
+// @Summary List invitations
+// @Description List invitations newest first, all of them for admins and their own for users
+// @Tags invitations
+// @Security AdminToken
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.InvitationResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/invitations [get]
+// @Router /v1/auth/invitations [get]
+// @Router /v2/auth/invitations [get]
+func (h *InvitationHandler) ListInvitations(c *gin.Context) {
+	invitations, err := h.invitations.List(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	response := make([]dto.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		response = append(response, invitationResponse(invitation))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeInvitation handles revoking a pending invitation
+// @Summary Revoke invitation
+// @Description Revoke a pending invitation, any of them for admins and their own for users
+// @Tags invitations
+// @Security AdminToken
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Invitation ID"
+// @Success 204
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/invitations/{id} [delete]
+// @Router /v1/auth/invitations/{id} [delete]
+// @Router /v2/auth/invitations/{id} [delete]
+func (h *InvitationHandler) RevokeInvitation(c *gin.Context) {
+	if err := h.invitations.Revoke(c.Request.Context(), c.Param("id"), c.GetString("user_id")); err != nil {
+		if errors.Is(err, service.ErrInvitationNotFound) {
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func invitationResponse(invitation *domain.Invitation) dto.InvitationResponse {
+	response := dto.InvitationResponse{
+		ID:         invitation.ID,
+		Email:      invitation.Email,
+		Role:       invitation.Role,
+		Tenant:     invitation.Tenant,
+		InvitedBy:  invitation.InvitedBy,
+		Status:     invitation.Status(time.Now()),
+		CreatedAt:  invitation.CreatedAt.UTC().Format(time.RFC3339),
+		ExpiresAt:  invitation.ExpiresAt.UTC().Format(time.RFC3339),
+		AcceptedBy: invitation.AcceptedBy,
+	}
+	if invitation.AcceptedAt != nil {
+		acceptedAt := invitation.AcceptedAt.UTC().Format(time.RFC3339)
+		response.AcceptedAt = &acceptedAt
+	}
+	return response
+}
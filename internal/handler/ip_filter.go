@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// IPFilterMiddleware rejects requests from IPs blocked by the IP filter
+func IPFilterMiddleware(filter *service.IPFilter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !filter.Allowed(ClientIP(c)) {
+			respondError(c, http.StatusForbidden, "Forbidden", "Access denied")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// negotiateScheme is the authorization scheme of SPNEGO (RFC 4559)
+const negotiateScheme = "Negotiate"
+
+// KerberosHandler handles SPNEGO sign-in of domain-joined browsers
+type KerberosHandler struct {
+	kerberos *service.KerberosService
+	auth     *AuthHandler
+}
+
+// NewKerberosHandler creates a new Kerberos handler, tokens are written like those of auth
+func NewKerberosHandler(kerberos *service.KerberosService, auth *AuthHandler) *KerberosHandler {
+	return &KerberosHandler{kerberos: kerberos, auth: auth}
+}
+
+// Negotiate handles signing in with a Kerberos ticket
+// @Summary Sign in with Kerberos
+// @Description Sign in with the Kerberos ticket of a domain-joined browser (SPNEGO, RFC 4559). Requests without a ticket get 401 with "WWW-Authenticate: Negotiate", which makes browsers of intranet sites retry with "Authorization: Negotiate <token>".
+// @Description The principal signs in the user an admin linked it to, or on its first sign-in the user found by username or email (see KERBEROS_USER_MAPPING) if the user verified the email of the principal.
+// @Tags auth
+// @Produce json
+// @Param Authorization header string false "Negotiate <base64 SPNEGO token>"
+// @Success 200 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
+// @Failure 401 {object} dto.ErrorResponse "No ticket, or the ticket is invalid"
+// @Failure 403 {object} dto.ErrorResponse "No user matches the principal, or the user is inactive"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/kerberos [post]
+// @Router /v2/auth/kerberos [post]
+func (h *KerberosHandler) Negotiate(c *gin.Context) {
+	scheme, encoded, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !strings.EqualFold(scheme, negotiateScheme) || encoded == "" {
+		c.Header("WWW-Authenticate", negotiateScheme)
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "Negotiate authorization required")
+		return
+	}
+	token, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		respondServiceError(c, http.StatusUnauthorized, "Unauthorized", service.ErrInvalidKerberosTicket)
+		return
+	}
+
+	response, err := h.kerberos.Authenticate(c.Request.Context(), token, net.JoinHostPort(c.ClientIP(), "0"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidKerberosTicket):
+			respondServiceError(c, http.StatusUnauthorized, "Unauthorized", err)
+		case errors.Is(err, service.ErrKerberosUserNotFound), errors.Is(err, service.ErrUserInactive), errors.Is(err, service.ErrAccountBanned), errors.Is(err, service.ErrEmailNotVerified):
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	h.auth.respondTokens(c, http.StatusOK, response)
+}
+
+// LinkPrincipal handles linking a Kerberos principal to a user
+// @Summary Link Kerberos principal
+// @Description Link a principal like jdoe@CORP.EXAMPLE.COM of an accepted realm to a user, who signs in with its tickets from then on, e.g. users whose username or email differs from the principal.
+// @Tags admin
+// @Security AdminToken
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.LinkKerberosPrincipalRequest true "Principal"
+// @Success 201 {object} dto.SuccessResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse "The principal is linked to a user already"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/admin/users/{id}/kerberos-principals [post]
+func (h *KerberosHandler) LinkPrincipal(c *gin.Context) {
+	var req dto.LinkKerberosPrincipalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	if err := h.kerberos.Link(c.Request.Context(), c.Param("id"), req.Principal); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidKerberosPrincipal):
+			respondError(c, http.StatusBadRequest, "Bad request", err.Error())
+		case errors.Is(err, repository.ErrNotFound):
+			respondError(c, http.StatusNotFound, "Not found", err.Error())
+		case errors.Is(err, service.ErrKerberosPrincipalLinked):
+			respondError(c, http.StatusConflict, "Conflict", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Message: "Kerberos principal linked"})
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/i18n"
+)
+
+// LocaleMiddleware negotiates the response locale from the Accept-Language header
+// and stores it in the gin and request contexts
+func LocaleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		locale := i18n.Negotiate(c.GetHeader("Accept-Language"))
+
+		c.Set("locale", locale)
+		c.Request = c.Request.WithContext(i18n.WithLocale(c.Request.Context(), locale))
+		c.Header("Content-Language", locale)
+		c.Header("Vary", "Accept-Language")
+
+		c.Next()
+	}
+}
+
+// Locale returns the negotiated locale of the request
+func Locale(c *gin.Context) string {
+	if locale := c.GetString("locale"); locale != "" {
+		return locale
+	}
+	return i18n.DefaultLocale
+}
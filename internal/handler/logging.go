@@ -1,32 +1,57 @@
 package handler
 
 import (
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
 	"go.uber.org/zap"
 )
 
 // LoggerMiddleware creates a structured logging middleware
-func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
+// Successful requests to sampledRoutes are logged once per sampleRate requests,
+// failed requests are always logged. Sensitive query parameters are redacted.
+func LoggerMiddleware(logger *zap.Logger, sampledRoutes []string, sampleRate int) gin.HandlerFunc {
+	// Counters are created upfront, so the map is read-only while serving requests
+	counters := make(map[string]*atomic.Uint64, len(sampledRoutes))
+	for _, route := range sampledRoutes {
+		counters[route] = &atomic.Uint64{}
+	}
+
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
 		query := c.Request.URL.RawQuery
+		c.Request = c.Request.WithContext(observability.ContextWithLogger(c.Request.Context(), logger))
 
 		// Process request
 		c.Next()
 
-		// Log request
-		logger.Info("HTTP request",
-			zap.Int("status", c.Writer.Status()),
+		status := c.Writer.Status()
+		if counter, ok := counters[c.FullPath()]; ok && sampleRate > 1 && status < http.StatusBadRequest {
+			if counter.Add(1)%uint64(sampleRate) != 1 {
+				return
+			}
+		}
+
+		fields := []zap.Field{
+			zap.Int("status", status),
 			zap.String("method", c.Request.Method),
 			zap.String("path", path),
-			zap.String("query", query),
-			zap.String("ip", c.ClientIP()),
+			zap.String("query", observability.RedactQuery(query)),
+			zap.String("ip", ClientIP(c)),
 			zap.String("user_agent", c.Request.UserAgent()),
 			zap.Duration("latency", time.Since(start)),
 			zap.Int("size", c.Writer.Size()),
-		)
+		}
+		// Internal callers authenticated with mutual TLS are identified for auditing
+		if peerID := c.GetString("peer_id"); peerID != "" {
+			fields = append(fields, zap.String("peer_id", peerID))
+		}
+
+		// Log request
+		observability.LoggerWithContext(c.Request.Context(), logger).Info("HTTP request", fields...)
 	}
 }
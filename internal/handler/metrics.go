@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	httpMetricsMeterName = "github.com/prperemyshlev/auth-service-2/internal/handler"
+
+	// unmatchedRoute labels requests that did not match any route to keep cardinality bounded
+	unmatchedRoute = "unmatched"
+
+	// loginRouteSuffix matches the login routes of every API version
+	loginRouteSuffix = "/auth/login"
+)
+
+// MetricsMiddleware records request count, duration and in-flight requests
+// labeled by HTTP method, route template and status class
+// Logins are also recorded in a histogram of their own with buckets fit for password hashing,
+// the latency SLO is defined on it.
+func MetricsMiddleware(meterProvider metric.MeterProvider) (gin.HandlerFunc, error) {
+	meter := meterProvider.Meter(httpMetricsMeterName)
+
+	requests, err := meter.Int64Counter("http.server.requests",
+		metric.WithDescription("Number of HTTP requests handled"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create requests counter: %w", err)
+	}
+
+	duration, err := meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create duration histogram: %w", err)
+	}
+
+	loginDuration, err := meter.Float64Histogram("auth.login.duration",
+		metric.WithDescription("Duration of login requests"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.025, 0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2.5, 5, 10),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login duration histogram: %w", err)
+	}
+
+	inFlight, err := meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of HTTP requests currently in flight"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-flight gauge: %w", err)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		routeAttrs := metric.WithAttributes(
+			attribute.String("method", c.Request.Method),
+			attribute.String("route", route),
+		)
+
+		ctx := c.Request.Context()
+		inFlight.Add(ctx, 1, routeAttrs)
+		defer inFlight.Add(ctx, -1, routeAttrs)
+
+		c.Next()
+
+		attrs := metric.WithAttributes(
+			attribute.String("method", c.Request.Method),
+			attribute.String("route", route),
+			attribute.String("status_class", statusClass(c.Writer.Status())),
+		)
+		elapsed := time.Since(start).Seconds()
+		requests.Add(ctx, 1, attrs)
+		duration.Record(ctx, elapsed, attrs)
+		if strings.HasSuffix(route, loginRouteSuffix) {
+			loginDuration.Record(ctx, elapsed, metric.WithAttributes(
+				attribute.String("route", route),
+				attribute.String("status_class", statusClass(c.Writer.Status())),
+			))
+		}
+	}, nil
+}
+
+// statusClass maps a status code to its class, e.g. 404 -> "4xx"
+func statusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
@@ -1,23 +1,59 @@
 package handler
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/prperemyshlev/auth-service-2/internal/dto"
 	"github.com/prperemyshlev/auth-service-2/internal/service"
 )
 
 // AuthMiddleware validates JWT token and adds user info to context
-func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
+func AuthMiddleware(authService service.AuthService, opts ...AuthOption) gin.HandlerFunc {
+	return authMiddleware(authService, true, opts)
+}
+
+// OptionalAuthMiddleware authenticates requests carrying an Authorization header
+// Requests without the header are passed through anonymously, invalid tokens are still rejected
+func OptionalAuthMiddleware(authService service.AuthService, opts ...AuthOption) gin.HandlerFunc {
+	return authMiddleware(authService, false, opts)
+}
+
+// AuthOption configures the validation of access tokens on a route
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	expiryGrace time.Duration
+}
+
+// WithExpiryGrace accepts access tokens expired for less than grace on GET and HEAD requests,
+// which are safe to serve while the client refreshes its token. Responses to expired tokens
+// carry a Warning header.
+func WithExpiryGrace(grace time.Duration) AuthOption {
+	return func(o *authOptions) {
+		o.expiryGrace = grace
+	}
+}
+
+// expiredTokenWarning tells clients to refresh a token accepted after its expiry
+const expiredTokenWarning = `299 - "Access token expired, refresh it"`
+
+func authMiddleware(authService service.AuthService, required bool, opts []AuthOption) gin.HandlerFunc {
+	var o authOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && !required {
+			c.Next()
+			return
+		}
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error:   "Unauthorized",
-				Message: "Authorization header is required",
-			})
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Authorization header is required")
 			c.Abort()
 			return
 		}
@@ -25,26 +61,29 @@ func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 		// Extract token from "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error:   "Unauthorized",
-				Message: "Invalid authorization header format",
-			})
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Invalid authorization header format")
 			c.Abort()
 			return
 		}
 
 		token := parts[1]
 
+		// Only idempotent requests are served with recently expired tokens
+		var validateOpts []service.ValidateOption
+		if o.expiryGrace > 0 && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+			validateOpts = append(validateOpts, service.WithExpiryGrace(o.expiryGrace))
+		}
+
 		// Validate token
-		claims, err := authService.ValidateToken(c.Request.Context(), token)
+		claims, err := authService.ValidateToken(c.Request.Context(), token, validateOpts...)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-				Error:   "Unauthorized",
-				Message: "Invalid or expired token",
-			})
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Invalid or expired token")
 			c.Abort()
 			return
 		}
+		if claims.Exp <= time.Now().Unix() {
+			c.Header("Warning", expiredTokenWarning)
+		}
 
 		// Add user info to context
 		c.Set("user_id", claims.UserID)
@@ -54,3 +93,39 @@ func AuthMiddleware(authService service.AuthService) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireVerifiedEmail refuses users whose email isn't verified with 403 and the
+// email_not_verified code, it must follow AuthMiddleware
+// The user is looked up on each request, so verifying the email takes effect without a new token.
+// Users with a placeholder email under .invalid, e.g. of wallets, have nothing to verify and pass.
+func RequireVerifiedEmail(authService service.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := authService.GetUser(c.Request.Context(), c.GetString("user_id"))
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+			c.Abort()
+			return
+		}
+		if !user.IsEmailVerified && !strings.HasSuffix(user.Email, ".invalid") {
+			respondServiceError(c, http.StatusForbidden, "Forbidden", service.ErrEmailNotVerified)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminMiddleware authenticates admin API requests with a static bearer token
+func AdminMiddleware(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Invalid admin token")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
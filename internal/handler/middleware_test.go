@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/memory"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	authService := &testutil.AuthService{
+		ValidateTokenFunc: func(ctx context.Context, token string) (*domain.TokenClaims, error) {
+			if token != "valid" {
+				return nil, service.ErrInvalidToken
+			}
+			return &domain.TokenClaims{UserID: "user-1", Email: "user@example.com"}, nil
+		},
+	}
+
+	router := gin.New()
+	router.GET("/required", AuthMiddleware(authService), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("user_id"))
+	})
+	router.GET("/optional", OptionalAuthMiddleware(authService), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("user_id"))
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		status int
+		body   string
+	}{
+		{name: "valid token", path: "/required", header: "Bearer valid", status: http.StatusOK, body: "user-1"},
+		{name: "invalid token", path: "/required", header: "Bearer invalid", status: http.StatusUnauthorized},
+		{name: "missing header", path: "/required", status: http.StatusUnauthorized},
+		{name: "wrong scheme", path: "/required", header: "Token valid", status: http.StatusUnauthorized},
+		{name: "optional anonymous", path: "/optional", status: http.StatusOK, body: ""},
+		{name: "optional valid token", path: "/optional", header: "Bearer valid", status: http.StatusOK, body: "user-1"},
+		{name: "optional invalid token", path: "/optional", header: "Bearer invalid", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	authService := &testutil.AuthService{
+		ValidateTokenFunc: func(ctx context.Context, token string) (*domain.TokenClaims, error) {
+			return &domain.TokenClaims{UserID: token}, nil
+		},
+		GetUserFunc: func(ctx context.Context, userID string) (*dto.UserResponse, error) {
+			if userID == "wallet" {
+				return &dto.UserResponse{ID: userID, Email: "0xabc@wallet.invalid"}, nil
+			}
+			return &dto.UserResponse{ID: userID, Email: userID + "@example.com", IsEmailVerified: userID == "verified"}, nil
+		},
+	}
+
+	// Error codes are returned by API v2
+	router := gin.New()
+	router.Use(APIVersionMiddleware(APIVersion2))
+	router.GET("/orgs", AuthMiddleware(authService), RequireVerifiedEmail(authService), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// Placeholder emails have nothing to verify
+	for user, status := range map[string]int{"verified": http.StatusOK, "unverified": http.StatusForbidden, "wallet": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/orgs", nil)
+		req.Header.Set("Authorization", "Bearer "+user)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != status {
+			t.Errorf("Expected status %d for a %s user, got %d", status, user, rec.Code)
+		}
+		if status == http.StatusForbidden && !strings.Contains(rec.Body.String(), `"code":"email_not_verified"`) {
+			t.Errorf("Expected the email_not_verified code, got %s", rec.Body.String())
+		}
+	}
+}
+
+func TestPeerAuthMiddleware(t *testing.T) {
+	router := gin.New()
+	router.GET("/peer", PeerAuthMiddleware([]string{"spiffe://example.org/ns/prod/"}), func(c *gin.Context) {
+		id, _ := PeerIDFromContext(c.Request.Context())
+		c.String(http.StatusOK, id)
+	})
+
+	certificate := func(uri string) *x509.Certificate {
+		u, _ := url.Parse(uri)
+		return &x509.Certificate{URIs: []*url.URL{u}}
+	}
+	tests := []struct {
+		name   string
+		state  *tls.ConnectionState
+		status int
+	}{
+		{name: "no tls", status: http.StatusUnauthorized},
+		{name: "unverified certificate", state: &tls.ConnectionState{}, status: http.StatusUnauthorized},
+		{name: "no spiffe id", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate("https://example.org/gateway")}}}, status: http.StatusUnauthorized},
+		{name: "other namespace", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate("spiffe://example.org/ns/production/sa/gateway")}}}, status: http.StatusForbidden},
+		{name: "allowed", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate("spiffe://example.org/ns/prod/sa/gateway")}}}, status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/peer", nil)
+			req.TLS = tt.state
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != "spiffe://example.org/ns/prod/sa/gateway" {
+				t.Errorf("Expected the SPIFFE ID in the request context, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := &testutil.RateLimiter{}
+
+	router := gin.New()
+	router.GET("/limited", RateLimitMiddleware(limiter, 2, time.Minute, func(c *gin.Context) string { return "key" }), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+		if rec.Code != want {
+			t.Fatalf("Request %d: expected status %d, got %d", i+1, want, rec.Code)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("Request %d: expected RateLimit-Limit header, got %q", i+1, rec.Header().Get("RateLimit-Limit"))
+		}
+	}
+
+	// Storage errors fail open
+	limiter.Err = errors.New("redis unavailable")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/limited", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected requests to pass when the limiter fails, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitPolicyMiddlewareRestricted(t *testing.T) {
+	limiter := &testutil.RateLimiter{}
+	policies := map[string]RateLimitPolicy{
+		"/limited": {Limit: 10, RestrictedLimit: 1, Window: time.Minute, KeyFunc: UserBasedKey},
+	}
+
+	router := gin.New()
+	router.GET("/limited", func(c *gin.Context) {
+		userID := c.GetHeader("X-User")
+		c.Set("user_id", userID)
+		c.Set("claims", &domain.TokenClaims{UserID: userID, Restricted: userID == "restricted"})
+	}, RateLimitPolicyMiddleware(limiter, policies), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, tt := range []struct {
+		user  string
+		want  []int
+		limit string
+	}{
+		{user: "regular", want: []int{http.StatusOK, http.StatusOK}, limit: "10"},
+		{user: "restricted", want: []int{http.StatusOK, http.StatusTooManyRequests}, limit: "1"},
+	} {
+		for i, want := range tt.want {
+			req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+			req.Header.Set("X-User", tt.user)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != want || rec.Header().Get("RateLimit-Limit") != tt.limit {
+				t.Errorf("Request %d of %s: expected status %d with limit %s, got %d with %q",
+					i+1, tt.user, want, tt.limit, rec.Code, rec.Header().Get("RateLimit-Limit"))
+			}
+		}
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(TimeoutMiddleware(map[string]time.Duration{"/slow": 20 * time.Millisecond}, time.Second))
+	router.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.SetCookie("refresh_token", "late", 60, "/", "", true, true)
+		c.JSON(http.StatusOK, gin.H{"status": "late"})
+	})
+	router.GET("/fast", func(c *gin.Context) {
+		c.Header("X-Handler", "fast")
+		c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected status 504, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Set-Cookie") != "" || strings.Contains(rec.Body.String(), "late") {
+		t.Errorf("Expected the late response to be discarded, got %v %s", rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Handler") != "fast" || rec.Body.String() != `{"status":"ok"}` {
+		t.Errorf("Expected the response to pass through, got %d %v %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestTenantMiddleware(t *testing.T) {
+	tenants := service.NewTenantService(memory.NewTenantRepository(), testutil.NewRedis(t), time.Minute)
+	if err := tenants.Save(context.Background(), &domain.Tenant{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("Failed to save tenant: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/", TenantMiddleware(tenants), func(c *gin.Context) {
+		var id string
+		if tenant := service.TenantFromContext(c.Request.Context()); tenant != nil {
+			id = tenant.ID
+		}
+		c.String(http.StatusOK, id)
+	})
+
+	tests := []struct {
+		name   string
+		tenant string
+		status int
+		body   string
+	}{
+		{name: "no tenant", status: http.StatusOK},
+		{name: "known tenant", tenant: "acme", status: http.StatusOK, body: "acme"},
+		{name: "unknown tenant", tenant: "globex", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tenant != "" {
+				req.Header.Set(TenantIDHeader, tt.tenant)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusOK && rec.Body.String() != tt.body {
+				t.Errorf("Expected tenant %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(CORSMiddleware(CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		ExposedHeaders: []string{"RateLimit-Remaining", "Retry-After"},
+		MaxAge:         10 * time.Minute,
+		RouteOrigins:   map[string][]string{"/api/v1/admin": {"https://admin.corp.com"}, "/api/v1/admin/public": {"*"}},
+	}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v1/auth/me", ok)
+	router.GET("/api/v1/admin/users", ok)
+	router.GET("/api/v1/admin/public/keys", ok)
+	router.GET("/api/v1/administrator", ok)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		origin  string
+		allowed bool
+	}{
+		{name: "exact origin", method: http.MethodGet, path: "/api/v1/auth/me", origin: "https://app.example.com", allowed: true},
+		{name: "subdomain", method: http.MethodGet, path: "/api/v1/auth/me", origin: "https://eu.tenant.example.com", allowed: true},
+		{name: "subdomain preflight", method: http.MethodOptions, path: "/api/v1/auth/me", origin: "https://tenant.example.com", allowed: true},
+		{name: "parent domain", method: http.MethodGet, path: "/api/v1/auth/me", origin: "https://example.com"},
+		{name: "other scheme", method: http.MethodGet, path: "/api/v1/auth/me", origin: "http://tenant.example.com"},
+		{name: "lookalike domain", method: http.MethodGet, path: "/api/v1/auth/me", origin: "https://evilexample.com"},
+		{name: "other port", method: http.MethodGet, path: "/api/v1/auth/me", origin: "https://tenant.example.com:8443"},
+		{name: "route override", method: http.MethodGet, path: "/api/v1/admin/users", origin: "https://admin.corp.com", allowed: true},
+		{name: "origin replaced by route override", method: http.MethodOptions, path: "/api/v1/admin/users", origin: "https://app.example.com"},
+		{name: "longest route override", method: http.MethodGet, path: "/api/v1/admin/public/keys", origin: "https://partner.com", allowed: true},
+		{name: "route override on segment boundary", method: http.MethodGet, path: "/api/v1/administrator", origin: "https://app.example.com", allowed: true},
+		{name: "no route override past segment", method: http.MethodGet, path: "/api/v1/administrator", origin: "https://admin.corp.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); (got == tt.origin) != tt.allowed {
+				t.Errorf("Expected origin allowed=%t, got %q", tt.allowed, got)
+			}
+			if tt.method == http.MethodOptions && (rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Max-Age") != "600") {
+				t.Errorf("Expected a cacheable preflight, got %d %v", rec.Code, rec.Header())
+			}
+			if tt.method == http.MethodGet && rec.Header().Get("Access-Control-Expose-Headers") != "RateLimit-Remaining, Retry-After" {
+				t.Errorf("Expected the rate limit headers to be exposed, got %v", rec.Header())
+			}
+		})
+	}
+}
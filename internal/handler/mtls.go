@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// peerIDKey is the request context key of the SPIFFE ID of a mutual TLS caller
+type peerIDKey struct{}
+
+// PeerIDFromContext returns the SPIFFE ID of the mutual TLS caller of the request
+func PeerIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(peerIDKey{}).(string)
+	return id, ok
+}
+
+// SPIFFEID returns the SPIFFE ID of a certificate, i.e. its URI SAN with the spiffe scheme
+func SPIFFEID(cert *x509.Certificate) (string, bool) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" && uri.Host != "" {
+			return uri.String(), true
+		}
+	}
+	return "", false
+}
+
+// PeerAuthMiddleware authenticates internal callers by their verified client certificate
+// The SPIFFE ID of the certificate is stored in the request context and as peer_id. When allowedIDs
+// is not empty the ID must equal one of them or be below one, e.g. spiffe://example.org/ns/prod
+// allows spiffe://example.org/ns/prod/sa/gateway.
+func PeerAuthMiddleware(allowedIDs []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := c.Request.TLS
+		if state == nil || len(state.VerifiedChains) == 0 {
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Client certificate is required")
+			c.Abort()
+			return
+		}
+
+		id, ok := SPIFFEID(state.VerifiedChains[0][0])
+		if !ok {
+			respondError(c, http.StatusUnauthorized, "Unauthorized", "Client certificate has no SPIFFE ID")
+			c.Abort()
+			return
+		}
+		if !peerAllowed(id, allowedIDs) {
+			respondError(c, http.StatusForbidden, "Forbidden", "Client is not allowed")
+			c.Abort()
+			return
+		}
+
+		c.Set("peer_id", id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), peerIDKey{}, id))
+
+		c.Next()
+	}
+}
+
+// peerAllowed reports whether id is one of allowedIDs or below one of them
+func peerAllowed(id string, allowedIDs []string) bool {
+	if len(allowedIDs) == 0 {
+		return true
+	}
+	for _, allowed := range allowedIDs {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if id == allowed || strings.HasPrefix(id, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
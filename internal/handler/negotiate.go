@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Media types of MessagePack responses, the first is the one responses are labelled with
+const (
+	MIMEMsgPack    = "application/x-msgpack"
+	mimeMsgPackAlt = "application/msgpack"
+)
+
+// respondNegotiated writes obj as MessagePack to clients preferring it in Accept, as JSON otherwise
+// Internal callers of hot read endpoints use MessagePack for smaller payloads. The first supported
+// type listed in Accept wins, quality values are ignored. Error responses stay JSON.
+func respondNegotiated(c *gin.Context, status int, obj any) {
+	// Added to the Vary: Accept-Language of LocaleMiddleware
+	c.Writer.Header().Add("Vary", "Accept")
+
+	switch c.NegotiateFormat(gin.MIMEJSON, MIMEMsgPack, mimeMsgPackAlt) {
+	case MIMEMsgPack, mimeMsgPackAlt:
+		c.Header("Content-Type", MIMEMsgPack)
+		c.Render(status, render.MsgPack{Data: obj})
+	default:
+		c.JSON(status, obj)
+	}
+}
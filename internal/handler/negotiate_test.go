@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/ugorji/go/codec"
+)
+
+func TestRespondNegotiated(t *testing.T) {
+	authService := &testutil.AuthService{
+		GetUserFunc: func(ctx context.Context, userID string) (*dto.UserResponse, error) {
+			return &dto.UserResponse{ID: userID, Email: "alice@example.com", LoginCount: 3}, nil
+		},
+	}
+	handler := NewAuthHandler(authService, CookieOptions{})
+
+	router := gin.New()
+	router.GET("/me", func(c *gin.Context) {
+		c.Set("user_id", "user-1")
+		c.Next()
+	}, handler.GetMe)
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+	}{
+		{name: "default", contentType: "application/json; charset=utf-8"},
+		{name: "any", accept: "*/*", contentType: "application/json; charset=utf-8"},
+		{name: "json", accept: "application/json", contentType: "application/json; charset=utf-8"},
+		{name: "msgpack", accept: "application/x-msgpack", contentType: MIMEMsgPack},
+		{name: "msgpack alias", accept: "application/msgpack", contentType: MIMEMsgPack},
+		{name: "msgpack first", accept: "application/x-msgpack, application/json", contentType: MIMEMsgPack},
+		{name: "unsupported", accept: "application/xml", contentType: "application/json; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+				t.Fatalf("Expected Content-Type %q, got %q", tt.contentType, got)
+			}
+			if rec.Header().Get("Vary") != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", rec.Header().Values("Vary"))
+			}
+
+			var user dto.UserResponse
+			var err error
+			if tt.contentType == MIMEMsgPack {
+				err = codec.NewDecoderBytes(rec.Body.Bytes(), &codec.MsgpackHandle{}).Decode(&user)
+			} else {
+				err = json.Unmarshal(rec.Body.Bytes(), &user)
+			}
+			if err != nil || user.ID != "user-1" || user.Email != "alice@example.com" || user.LoginCount != 3 {
+				t.Errorf("Expected the user, got %+v (%v)", user, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// oauthBindingCookie binds a sign-in with a provider to the browser that started it
+const oauthBindingCookie = "oauth_binding"
+
+// OAuthHandler handles sign-in with OAuth providers
+type OAuthHandler struct {
+	oauth *service.OAuthService
+	auth  *AuthHandler
+}
+
+// NewOAuthHandler creates a new OAuth handler, tokens are written like those of auth
+func NewOAuthHandler(oauth *service.OAuthService, auth *AuthHandler) *OAuthHandler {
+	return &OAuthHandler{oauth: oauth, auth: auth}
+}
+
+// Authorize handles starting a sign-in with a provider
+// @Summary Sign in with a provider
+// @Description Redirect to the consent page of an OAuth provider (github or gitlab), with a PKCE challenge, and set the oauth_binding cookie the callback requires. Once signed in, the user is sent back to redirect_url with a one-time code to exchange at /auth/oauth/token, or with an error code.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Param redirect_url query string false "Where to send the user back, must be allowed for the oauth_callback flow"
+// @Success 302
+// @Failure 400 {object} dto.ErrorResponse "The redirect URL isn't allowed"
+// @Failure 404 {object} dto.ErrorResponse "The provider isn't configured"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/oauth/{provider} [get]
+// @Router /v2/auth/oauth/{provider} [get]
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	authURL, binding, err := h.oauth.AuthCodeURL(c.Request.Context(), c.Param("provider"), c.Query("redirect_url"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOAuthProviderNotFound):
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+		case errors.Is(err, service.ErrRedirectNotAllowed):
+			respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	// The callback is below the path of this route, providers redirect back with a top-level
+	// navigation, which carries lax cookies
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthBindingCookie, binding, 0, c.Request.URL.Path, "", h.auth.cookies.Secure, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles the provider redirecting back after a sign-in
+// @Summary OAuth callback
+// @Description Complete a sign-in with a provider and redirect to the redirect URL of the sign-in with a one-time code, or with an error code such as oauth_email_not_verified.
+// @Description Provider accounts are linked to the user with their verified email, a user is created when none matches and registration is open.
+// @Description Callbacks must come from the browser that started the sign-in, which keeps its binding in the oauth_binding cookie, and complete a sign-in once. Repeated parameters are refused.
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string true "State of the sign-in"
+// @Success 302
+// @Failure 400 {object} dto.ErrorResponse "Unknown or expired state"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/oauth/{provider}/callback [get]
+// @Router /v2/auth/oauth/{provider}/callback [get]
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	binding, _ := c.Cookie(oauthBindingCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthBindingCookie, "", -1, strings.TrimSuffix(c.Request.URL.Path, "/callback"), "", h.auth.cookies.Secure, true)
+
+	redirectURL, err := h.oauth.Callback(c.Request.Context(), c.Param("provider"), c.Request.URL.Query(), binding)
+	if err == nil {
+		c.Redirect(http.StatusFound, redirectURL)
+		return
+	}
+	if redirectURL == "" {
+		if errors.Is(err, service.ErrInvalidOAuthState) {
+			respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	// The client shows the error, with the same codes as API v2
+	if u, parseErr := url.Parse(redirectURL); parseErr == nil {
+		query := u.Query()
+		query.Set("error", publicErrorCode(err))
+		u.RawQuery = query.Encode()
+		redirectURL = u.String()
+	}
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// Token handles exchanging the login code of a sign-in with a provider for tokens
+// @Summary Exchange OAuth login code
+// @Description Exchange the one-time code a sign-in with a provider redirected back with for tokens. Codes expire after a minute.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.OAuthTokenRequest true "Login code"
+// @Success 200 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
+// @Failure 400 {object} dto.ErrorResponse "Unknown or expired code"
+// @Failure 403 {object} dto.ErrorResponse "The user is inactive, or the email isn't verified and EMAIL_VERIFICATION_POLICY is block"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/oauth/token [post]
+// @Router /v2/auth/oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	var req dto.OAuthTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	response, err := h.oauth.Token(c.Request.Context(), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOAuthState):
+			respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+		case errors.Is(err, service.ErrUserInactive), errors.Is(err, service.ErrAccountBanned), errors.Is(err, service.ErrEmailNotVerified):
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	h.auth.respondTokens(c, http.StatusOK, response)
+}
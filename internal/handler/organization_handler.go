@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// OrganizationHandler handles organizations and their members
+type OrganizationHandler struct {
+	orgs *service.OrganizationService
+}
+
+// NewOrganizationHandler creates a new organization handler
+func NewOrganizationHandler(orgs *service.OrganizationService) *OrganizationHandler {
+	return &OrganizationHandler{orgs: orgs}
+}
+
+// CreateOrganization handles creating an organization
+// @Summary Create organization
+// @Description Create an organization, the current user becomes its owner
+// @Tags organizations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateOrganizationRequest true "Organization"
+// @Success 201 {object} dto.OrganizationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs [post]
+// @Router /v2/auth/orgs [post]
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req dto.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		respondError(c, http.StatusBadRequest, "Validation failed", "Name is required")
+		return
+	}
+
+	created, err := h.orgs.Create(c.Request.Context(), name, c.GetString("user_id"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, organizationResponse(*created))
+}
+
+// ListOrganizations handles listing the organizations of the current user
+// @Summary List organizations
+// @Description List the organizations of the current user along with their role, oldest membership first.
+// @Description Access tokens are scoped to the first one by default.
+// @Tags organizations
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.OrganizationResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs [get]
+// @Router /v2/auth/orgs [get]
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	orgs, err := h.orgs.List(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	response := make([]dto.OrganizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		response = append(response, organizationResponse(org))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListMembers handles listing the members of an organization
+// @Summary List members
+// @Description List the members of an organization of the current user, oldest first
+// @Tags organizations
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {array} dto.MemberResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs/{id}/members [get]
+// @Router /v2/auth/orgs/{id}/members [get]
+func (h *OrganizationHandler) ListMembers(c *gin.Context) {
+	members, err := h.orgs.Members(c.Request.Context(), c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	response := make([]dto.MemberResponse, 0, len(members))
+	for _, member := range members {
+		response = append(response, memberResponse(member))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AddMember handles adding a member to an organization
+// @Summary Add member
+// @Description Add a user to an organization by email, owners and admins only, only owners add owners.
+// @Description An email without account is invited instead: the invitation token is only returned in this response
+// @Description and the user joins the organization when registering with it.
+// @Tags organizations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Param request body dto.AddMemberRequest true "Member"
+// @Success 201 {object} dto.AddMemberResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs/{id}/members [post]
+// @Router /v2/auth/orgs/{id}/members [post]
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	var req dto.AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	added, err := h.orgs.AddMember(c.Request.Context(), c.Param("id"), c.GetString("user_id"), req.Email, req.Role)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	var response dto.AddMemberResponse
+	if added.Member != nil {
+		member := memberResponse(added.Member)
+		response.Member = &member
+	} else {
+		response.Invitation = &dto.CreateInvitationResponse{
+			InvitationResponse: invitationResponse(added.Invitation),
+			Token:              added.Token,
+		}
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// UpdateMember handles changing the role of a member
+// @Summary Change member role
+// @Description Change the role of a member, owners and admins only. Only owners grant or revoke the owner role
+// @Description and the last owner can't be demoted.
+// @Tags organizations
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "Organization ID"
+// @Param user_id path string true "User ID"
+// @Param request body dto.UpdateMemberRequest true "Role"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs/{id}/members/{user_id} [patch]
+// @Router /v2/auth/orgs/{id}/members/{user_id} [patch]
+func (h *OrganizationHandler) UpdateMember(c *gin.Context) {
+	var req dto.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	if err := h.orgs.UpdateMemberRole(c.Request.Context(), c.Param("id"), c.GetString("user_id"), c.Param("user_id"), req.Role); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveMember handles removing a member from an organization
+// @Summary Remove member
+// @Description Remove a member from an organization, owners and admins only. Members leave by removing themselves,
+// @Description the last owner can't be removed.
+// @Tags organizations
+// @Security BearerAuth
+// @Param id path string true "Organization ID"
+// @Param user_id path string true "User ID"
+// @Success 204
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs/{id}/members/{user_id} [delete]
+// @Router /v2/auth/orgs/{id}/members/{user_id} [delete]
+func (h *OrganizationHandler) RemoveMember(c *gin.Context) {
+	if err := h.orgs.RemoveMember(c.Request.Context(), c.Param("id"), c.GetString("user_id"), c.Param("user_id")); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// IssueToken handles issuing an access token scoped to an organization
+// @Summary Switch organization
+// @Description Issue an access token with the org_id and org_role claims of an organization of the current user.
+// @Description Refreshing tokens scopes them to the default organization again.
+// @Tags organizations
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} dto.OrganizationTokenResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified while EMAIL_VERIFICATION_POLICY is set"
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/orgs/{id}/token [post]
+// @Router /v2/auth/orgs/{id}/token [post]
+func (h *OrganizationHandler) IssueToken(c *gin.Context) {
+	token, err := h.orgs.Token(c.Request.Context(), c.Param("id"), c.GetString("user_id"))
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.OrganizationTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   h.orgs.AccessTokenExpiry(),
+	})
+}
+
+// respondOrganizationError writes the response of an error returned by the organization service
+func respondOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOrganizationNotFound), errors.Is(err, service.ErrMemberNotFound):
+		respondServiceError(c, http.StatusNotFound, "Not found", err)
+	case errors.Is(err, service.ErrOrgPermissionDenied):
+		respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+	case errors.Is(err, service.ErrAlreadyMember), errors.Is(err, service.ErrLastOwner):
+		respondServiceError(c, http.StatusConflict, "Conflict", err)
+	case errors.Is(err, service.ErrInvalidEmail):
+		respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+	default:
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+	}
+}
+
+func organizationResponse(org service.OrganizationMembership) dto.OrganizationResponse {
+	return dto.OrganizationResponse{
+		ID:        org.Organization.ID,
+		Name:      org.Organization.Name,
+		Role:      org.Membership.Role,
+		CreatedAt: org.Organization.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+func memberResponse(member *service.Member) dto.MemberResponse {
+	return dto.MemberResponse{
+		UserID:   member.UserID,
+		Email:    member.Email,
+		Role:     member.Role,
+		JoinedAt: member.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// PasswordHandler handles the passwords of signed-in users
+type PasswordHandler struct {
+	passwords *service.PasswordService
+}
+
+// NewPasswordHandler creates a new password handler
+func NewPasswordHandler(passwords *service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{passwords: passwords}
+}
+
+// SetPassword handles adding a password to an account created with an OAuth provider
+// @Summary Set password
+// @Description Add a password to the current account, e.g. one created by signing in with Google, so the user can also log in with their email and password.
+// @Description Only accounts without a password can set one. The email must be verified, or the user must have signed in with the provider within the last 10 minutes.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.SetPasswordRequest true "New password"
+// @Success 204
+// @Failure 400 {object} dto.ErrorResponse "Invalid or weak password"
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "Email not verified and no recent sign-in with a provider"
+// @Failure 404 {object} dto.ErrorResponse "Password login is disabled"
+// @Failure 409 {object} dto.ErrorResponse "The account already has a password"
+// @Failure 500 {object} dto.ErrorResponse
+// @Failure 503 {object} dto.ErrorResponse "Password hashing is saturated, retry after Retry-After seconds"
+// @Router /v1/auth/set-password [post]
+// @Router /v2/auth/set-password [post]
+func (h *PasswordHandler) SetPassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	var req dto.SetPasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.passwords.SetPassword(c.Request.Context(), userID.(string), req.Password); err != nil {
+		if respondRetryable(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrWeakPassword):
+			respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+		case errors.Is(err, service.ErrReauthenticationRequired):
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+		case errors.Is(err, service.ErrPasswordAlreadySet):
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
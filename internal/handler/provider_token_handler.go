@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// ProviderTokenHandler hands the tokens of linked provider accounts to first-party apps
+type ProviderTokenHandler struct {
+	tokens *service.ProviderTokenService
+}
+
+// NewProviderTokenHandler creates a new provider token handler
+func NewProviderTokenHandler(tokens *service.ProviderTokenService) *ProviderTokenHandler {
+	return &ProviderTokenHandler{tokens: tokens}
+}
+
+// GetToken handles getting an access token of the provider account linked to the current user
+// @Summary Get provider token
+// @Description Get an access token of the account of a provider (github or gitlab) linked to the current user, for first-party apps calling the API of the provider on behalf of the user. Expired tokens are refreshed when the provider issued a refresh token.
+// @Description Tokens are stored when the user signs in with the provider, only with ENCRYPTION_KEYS.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.ProviderTokenResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse "The provider isn't configured, or no account of it is linked"
+// @Failure 409 {object} dto.ErrorResponse "No valid token is stored, the user has to sign in with the provider again"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/providers/{provider}/token [get]
+// @Router /v2/auth/providers/{provider}/token [get]
+func (h *ProviderTokenHandler) GetToken(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	token, err := h.tokens.Token(c.Request.Context(), userID.(string), c.Param("provider"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOAuthProviderNotFound), errors.Is(err, service.ErrOAuthProviderNotLinked):
+			respondServiceError(c, http.StatusNotFound, "Not found", err)
+		case errors.Is(err, service.ErrProviderTokenUnavailable):
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	response := dto.ProviderTokenResponse{AccessToken: token.AccessToken, TokenType: "Bearer"}
+	if !token.Expiry.IsZero() {
+		response.ExpiresAt = &token.Expiry
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, response)
+}
@@ -4,79 +4,146 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
 	"github.com/prperemyshlev/auth-service-2/internal/service"
 )
 
 // RateLimitMiddleware creates a rate limiting middleware
-func RateLimitMiddleware(rateLimiter *service.RateLimiter, limit int, window time.Duration, keyFunc func(*gin.Context) string) gin.HandlerFunc {
+func RateLimitMiddleware(rateLimiter service.RateLimiter, limit int, window time.Duration, keyFunc func(*gin.Context) string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := keyFunc(c)
 
-		allowed, err := rateLimiter.Allow(c.Request.Context(), key, limit, window)
+		result, err := rateLimiter.Allow(c.Request.Context(), key, limit, window)
 		if err != nil {
-			// If rate limit is exceeded
-			if strings.Contains(err.Error(), "rate limit exceeded") {
-				c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
-				c.Header("X-RateLimit-Retry-After", extractRetryAfter(err.Error()))
-
-				remaining, _ := rateLimiter.GetRemainingRequests(c.Request.Context(), key, limit, window)
-				c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-
-				c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
-					Error:   "Too Many Requests",
-					Message: err.Error(),
-				})
-				c.Abort()
-				return
-			}
-
-			// For other errors, allow the request but log the error
+			// For storage errors, allow the request
 			// In production, you might want to handle this differently
 			c.Next()
 			return
 		}
 
-		if !allowed {
-			remaining, _ := rateLimiter.GetRemainingRequests(c.Request.Context(), key, limit, window)
-			c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
-			c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		setRateLimitHeaders(c, result)
 
-			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
-				Error:   "Too Many Requests",
-				Message: "Rate limit exceeded",
-			})
+		if !result.Allowed {
+			retryAfter := retryAfterSeconds(result.RetryAfter(time.Now()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+			respondError(c, http.StatusTooManyRequests, "Too Many Requests", "Rate limit exceeded, try again in %ds", retryAfter)
 			c.Abort()
 			return
 		}
 
-		// Set rate limit headers
-		remaining, _ := rateLimiter.GetRemainingRequests(c.Request.Context(), key, limit, window)
-		c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
-		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-
 		c.Next()
 	}
 }
 
+// setRateLimitHeaders sets the draft-standard RateLimit-* headers
+// along with the legacy X-RateLimit-* ones kept for existing clients
+func setRateLimitHeaders(c *gin.Context, result *service.RateLimitResult) {
+	limit := strconv.Itoa(result.Limit)
+	remaining := strconv.Itoa(result.Remaining)
+	reset := retryAfterSeconds(time.Until(result.ResetAt))
+
+	c.Header("RateLimit-Limit", limit)
+	c.Header("RateLimit-Remaining", remaining)
+	c.Header("RateLimit-Reset", strconv.Itoa(reset))
+	c.Header("X-RateLimit-Limit", limit)
+	c.Header("X-RateLimit-Remaining", remaining)
+}
+
+// retryAfterSeconds rounds a duration up to whole seconds
+func retryAfterSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// RateLimitPolicy describes the limit applied to a single route
+type RateLimitPolicy struct {
+	Limit int
+	// RestrictedLimit applies instead of Limit to users with restricted access tokens, unless it is 0
+	RestrictedLimit int
+	Window          time.Duration
+	KeyFunc         func(*gin.Context) string
+	// Bucket names the counters of the policy, so that routes sharing a bucket share their limit;
+	// the route template unless set
+	Bucket string
+}
+
+// RateLimitPolicyMiddleware applies the policy registered for the matched route template.
+// Routes without a policy are passed through, so it can be attached to any route.
+// For user-keyed policies and restricted limits it must run after AuthMiddleware.
+func RateLimitPolicyMiddleware(rateLimiter service.RateLimiter, policies map[string]RateLimitPolicy) gin.HandlerFunc {
+	limiters := make(map[string]gin.HandlerFunc, len(policies))
+	restrictedLimiters := make(map[string]gin.HandlerFunc, len(policies))
+	for route, policy := range policies {
+		keyFunc := policy.KeyFunc
+		bucket := route
+		if policy.Bucket != "" {
+			bucket = policy.Bucket
+		}
+		routeKey := func(c *gin.Context) string {
+			return fmt.Sprintf("%s:%s", bucket, keyFunc(c))
+		}
+		limiters[route] = RateLimitMiddleware(rateLimiter, policy.Limit, policy.Window, routeKey)
+		if policy.RestrictedLimit > 0 {
+			restrictedLimiters[route] = RateLimitMiddleware(rateLimiter, policy.RestrictedLimit, policy.Window, routeKey)
+		}
+	}
+
+	return func(c *gin.Context) {
+		route := policyRoute(c)
+		limiter, ok := limiters[route]
+		if !ok {
+			c.Next()
+			return
+		}
+		if restricted, ok := restrictedLimiters[route]; ok && restrictedUser(c) {
+			limiter = restricted
+		}
+
+		limiter(c)
+	}
+}
+
+// policyRouteKey holds the route template whose rate limit and CAPTCHA policies apply to a request
+// instead of those of its own route, e.g. the login route for GraphQL requests logging in
+const policyRouteKey = "policy_route"
+
+// policyRoute returns the route template whose policies apply to the request
+func policyRoute(c *gin.Context) string {
+	if route := c.GetString(policyRouteKey); route != "" {
+		return route
+	}
+	return c.FullPath()
+}
+
+// restrictedUser reports whether the request is authenticated with a restricted access token
+func restrictedUser(c *gin.Context) bool {
+	claims, ok := c.Get("claims")
+	if !ok {
+		return false
+	}
+	tokenClaims, ok := claims.(*domain.TokenClaims)
+	return ok && tokenClaims.Restricted
+}
+
 // IPBasedKey extracts rate limit key from client IP
 func IPBasedKey(c *gin.Context) string {
-	// Try to get IP from X-Forwarded-For header (for proxies)
-	ip := c.GetHeader("X-Forwarded-For")
-	if ip != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		ips := strings.Split(ip, ",")
-		ip = strings.TrimSpace(ips[0])
-	} else {
-		// Fallback to RemoteAddr
-		ip = c.ClientIP()
+	return ClientIP(c)
+}
+
+// UserBasedKey extracts rate limit key from the authenticated user ID
+// Falls back to client IP for unauthenticated requests
+func UserBasedKey(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return "user:" + userID
 	}
 
-	return ip
+	return IPBasedKey(c)
 }
 
 // EmailBasedKey extracts rate limit key from request email (for login/register)
@@ -105,16 +172,3 @@ func EmailAndIPKey(c *gin.Context) string {
 	}
 	return ip
 }
-
-// extractRetryAfter extracts retry-after time from error message
-func extractRetryAfter(errMsg string) string {
-	// Extract time from error message like "rate limit exceeded, try again in 45s"
-	// This is a simplified version
-	if strings.Contains(errMsg, "try again in") {
-		parts := strings.Split(errMsg, "try again in")
-		if len(parts) > 1 {
-			return strings.TrimSpace(parts[1])
-		}
-	}
-	return "60"
-}
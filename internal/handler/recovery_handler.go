@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// RecoveryHandler handles the recovery of accounts whose users lost access to their email
+type RecoveryHandler struct {
+	recovery *service.RecoveryService
+}
+
+// NewRecoveryHandler creates a new recovery handler
+func NewRecoveryHandler(recovery *service.RecoveryService) *RecoveryHandler {
+	return &RecoveryHandler{recovery: recovery}
+}
+
+// ChangeEmail handles changing the email of an account recovered with a linked provider
+// @Summary Change email after recovery
+// @Description Change the email of the current account after signing in with a linked OAuth provider within the last 10 minutes, for users who lost access to their email. The provider account must have been linked for RECOVERY_MIN_LINK_AGE.
+// @Description The new email is verified if the provider account has it. All sessions end, the user signs in again, and the former email is notified. Attempts are limited per user and audited.
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body dto.RecoveryEmailRequest true "New email"
+// @Success 200 {object} dto.UserResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse "No recent sign-in with a provider, the provider was linked recently, or the email domain isn't allowed"
+// @Failure 409 {object} dto.ErrorResponse "The email belongs to another user"
+// @Failure 429 {object} dto.ErrorResponse "Too many attempts, retry after Retry-After seconds"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/recovery/email [post]
+// @Router /v2/auth/recovery/email [post]
+func (h *RecoveryHandler) ChangeEmail(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	var req dto.RecoveryEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	user, err := h.recovery.ChangeEmail(c.Request.Context(), userID.(string), req.Email)
+	if err != nil {
+		if respondRetryable(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrReauthenticationRequired), errors.Is(err, service.ErrRecoveryNotAllowed), errors.Is(err, service.ErrEmailDomainNotAllowed),
+			errors.Is(err, service.ErrUserInactive):
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+		case errors.Is(err, service.ErrUserExists):
+			respondServiceError(c, http.StatusConflict, "Conflict", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
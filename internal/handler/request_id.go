@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+)
+
+const (
+	// RequestIDHeader is the header used to propagate request IDs between services
+	RequestIDHeader = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware accepts an incoming X-Request-ID or generates a new one,
+// stores it in the request context and returns it in the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Request = c.Request.WithContext(observability.ContextWithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// validRequestID rejects empty, oversized or non-printable IDs to keep logs clean
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, char := range requestID {
+		if char < 0x21 || char > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
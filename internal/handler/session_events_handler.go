@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// sessionEventsHeartbeat keeps idle streams from being closed by proxies
+const sessionEventsHeartbeat = 30 * time.Second
+
+// SessionEventsHandler streams session events to the clients of users
+type SessionEventsHandler struct {
+	events *service.SessionEvents
+}
+
+// NewSessionEventsHandler creates a new session events handler
+func NewSessionEventsHandler(events *service.SessionEvents) *SessionEventsHandler {
+	return &SessionEventsHandler{events: events}
+}
+
+// Authenticate authenticates streams by the ticket query parameter, or else like AuthMiddleware
+// Browsers' EventSource can't send an Authorization header, web apps redeem a ticket instead.
+func (h *SessionEventsHandler) Authenticate(authService service.AuthService) gin.HandlerFunc {
+	bearer := AuthMiddleware(authService)
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			bearer(c)
+			return
+		}
+
+		claims, err := h.events.RedeemTicket(c.Request.Context(), ticket)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidToken) {
+				respondError(c, http.StatusUnauthorized, "Unauthorized", "Invalid or expired ticket")
+			} else {
+				respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+			}
+			c.Abort()
+			return
+		}
+		c.Set("user_id", claims.UserID)
+		c.Set("email", claims.Email)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// Ticket handles issuing a ticket for the session events stream of the current user
+// @Summary Issue a session events ticket
+// @Description Issue a one-time ticket opening the session events stream, passed as the ticket query parameter since browsers' EventSource can't send an Authorization header. The ticket expires after 30 seconds, the stream it opens when the access token does.
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.SessionEventsTicketResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/events/ticket [post]
+// @Router /v2/auth/events/ticket [post]
+func (h *SessionEventsHandler) Ticket(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+
+	ticket, err := h.events.IssueTicket(c.Request.Context(), claims.(*domain.TokenClaims))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SessionEventsTicketResponse{
+		Ticket:    ticket,
+		ExpiresIn: int(service.SessionEventsTicketTTL / time.Second),
+	})
+}
+
+// Stream handles the Server-Sent Events stream of the current user
+// @Summary Stream session events
+// @Description Stream the session events of the current user as Server-Sent Events, so that web apps log out of other tabs and devices right away instead of on the next 401.
+// @Description Events are named session_revoked (with the session_id that ended), password_changed or logout_all. The stream ends when the access token expires, clients reconnect with a fresh one.
+// @Description It also ends after logout_all, and after session_revoked for the session_id of the query. Browsers open it with a ticket from POST /auth/events/ticket.
+// @Tags auth
+// @Security BearerAuth
+// @Produce text/event-stream
+// @Param ticket query string false "Ticket from POST /auth/events/ticket, instead of the Authorization header"
+// @Param session_id query string false "Session of the client, the stream ends when it is revoked"
+// @Success 200 {object} dto.SessionEventResponse "Stream of events, the data of each is a dto.SessionEventResponse"
+// @Failure 401 {object} dto.ErrorResponse
+// @Router /v1/auth/events [get]
+// @Router /v2/auth/events [get]
+func (h *SessionEventsHandler) Stream(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "Unauthorized", "User ID not found in context")
+		return
+	}
+	sessionID := c.Query("session_id")
+
+	events, unsubscribe := h.events.Subscribe(userID.(string))
+	defer unsubscribe()
+
+	// The stream outlives the write timeout of the server, writers that can't lift it are left as is
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	// Events are only sent while the access token is valid
+	var expired <-chan time.Time
+	if claims, ok := c.Get("claims"); ok {
+		expiry := time.NewTimer(time.Until(time.Unix(claims.(*domain.TokenClaims).Exp, 0)))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+	heartbeat := time.NewTicker(sessionEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// Proxies such as nginx would buffer the stream otherwise
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-expired:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(dto.SessionEventResponse{
+				Type:      event.Type,
+				SessionID: event.SessionID,
+				At:        time.Unix(event.At, 0).UTC().Format(time.RFC3339),
+			})
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+			// Nothing more is sent to a client whose session ended
+			if event.Type == service.SessionEventLogoutAll ||
+				(event.Type == service.SessionEventRevoked && sessionID != "" && event.SessionID == sessionID) {
+				c.Writer.Flush()
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
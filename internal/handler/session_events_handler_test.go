@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestSessionEventsStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	redis := testutil.NewRedis(t)
+	events := service.NewSessionEvents(redis)
+	go events.Run(ctx)
+
+	router := gin.New()
+	router.GET("/events", func(c *gin.Context) {
+		c.Set("user_id", "user-1")
+		c.Set("claims", &domain.TokenClaims{UserID: "user-1", Exp: time.Now().Add(time.Minute).Unix()})
+		c.Next()
+	}, NewSessionEventsHandler(events).Stream)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open the stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Published until the replica has subscribed to Redis
+	lines := bufio.NewScanner(resp.Body)
+	go func() {
+		for ctx.Err() == nil {
+			events.Publish(ctx, service.SessionEvent{Type: service.SessionEventRevoked, UserID: "user-1", SessionID: "session-1"})
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	if !lines.Scan() || lines.Text() != "event: session_revoked" {
+		t.Fatalf("Expected a session_revoked event, got %q (%v)", lines.Text(), lines.Err())
+	}
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), `data: {"type":"session_revoked","session_id":"session-1","at":"`) {
+		t.Errorf("Expected the ended session in the data, got %q", lines.Text())
+	}
+	cancel()
+
+	// Streams end on shutdown
+	events.Close()
+	done := make(chan struct{})
+	go func() {
+		for lines.Scan() {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the stream to end on shutdown")
+	}
+}
+
+func TestSessionEventsStreamEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	redis := testutil.NewRedis(t)
+	events := service.NewSessionEvents(redis)
+	go events.Run(ctx)
+
+	authService := &testutil.AuthService{
+		ValidateTokenFunc: func(ctx context.Context, token string) (*domain.TokenClaims, error) {
+			if token != "valid" {
+				return nil, service.ErrInvalidToken
+			}
+			return &domain.TokenClaims{UserID: "user-1", Exp: time.Now().Add(time.Minute).Unix()}, nil
+		},
+	}
+	h := NewSessionEventsHandler(events)
+	router := gin.New()
+	router.GET("/events", h.Authenticate(authService), h.Stream)
+	router.POST("/events/ticket", AuthMiddleware(authService), h.Ticket)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	// EventSource can't send the Authorization header, the stream is opened with a ticket
+	ticket := func() string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/events/ticket", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to issue a ticket: %v", err)
+		}
+		defer resp.Body.Close()
+		var body dto.SessionEventsTicketResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusOK || body.Ticket == "" {
+			t.Fatalf("Expected a ticket, got %d %+v (%v)", resp.StatusCode, body, err)
+		}
+		return body.Ticket
+	}
+
+	tests := []struct {
+		name  string
+		event service.SessionEvent
+	}{
+		{name: "logout_all", event: service.SessionEvent{Type: service.SessionEventLogoutAll, UserID: "user-1"}},
+		{name: "own session revoked", event: service.SessionEvent{Type: service.SessionEventRevoked, UserID: "user-1", SessionID: "session-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(server.URL + "/events?session_id=session-1&ticket=" + ticket())
+			if err != nil {
+				t.Fatalf("Failed to open the stream: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("Expected the ticket to open the stream, got %d", resp.StatusCode)
+			}
+
+			// Published until the replica has subscribed to Redis, another session doesn't end the stream
+			publishCtx, stop := context.WithCancel(ctx)
+			defer stop()
+			go func() {
+				for publishCtx.Err() == nil {
+					events.Publish(publishCtx, service.SessionEvent{Type: service.SessionEventRevoked, UserID: "user-1", SessionID: "session-2"})
+					events.Publish(publishCtx, tt.event)
+					time.Sleep(20 * time.Millisecond)
+				}
+			}()
+
+			done := make(chan string)
+			go func() {
+				last := ""
+				lines := bufio.NewScanner(resp.Body)
+				for lines.Scan() {
+					if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+						last = data
+					}
+				}
+				done <- last
+			}()
+			select {
+			case last := <-done:
+				var event dto.SessionEventResponse
+				if err := json.Unmarshal([]byte(last), &event); err != nil || event.Type != tt.event.Type || event.SessionID != tt.event.SessionID {
+					t.Errorf("Expected the stream to end with %s, got %s", tt.event.Type, last)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("Expected the stream to end after %s", tt.event.Type)
+			}
+		})
+	}
+
+	// Tickets are redeemed once
+	used := ticket()
+	resp, err := http.Get(server.URL + "/events?ticket=" + used)
+	if err != nil {
+		t.Fatalf("Failed to open the stream: %v", err)
+	}
+	resp.Body.Close()
+	resp, err = http.Get(server.URL + "/events?ticket=" + used)
+	if err != nil {
+		t.Fatalf("Failed to open the stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a redeemed ticket to be refused, got %d", resp.StatusCode)
+	}
+}
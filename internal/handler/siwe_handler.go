@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// SIWEHandler handles sign-in with Ethereum wallets
+type SIWEHandler struct {
+	siwe *service.SIWEService
+	auth *AuthHandler
+}
+
+// NewSIWEHandler creates a new sign-in with Ethereum handler, tokens are written like those of auth
+func NewSIWEHandler(siwe *service.SIWEService, auth *AuthHandler) *SIWEHandler {
+	return &SIWEHandler{siwe: siwe, auth: auth}
+}
+
+// Nonce handles issuing a nonce for a sign-in message
+// @Summary Issue sign-in with Ethereum nonce
+// @Description Issue a nonce for the EIP-4361 message the wallet signs. Each nonce can be signed in with once, until SIWE_NONCE_TTL passes.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} dto.SIWENonceResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/siwe/nonce [get]
+// @Router /v2/auth/siwe/nonce [get]
+func (h *SIWEHandler) Nonce(c *gin.Context) {
+	nonce, err := h.siwe.Nonce(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, dto.SIWENonceResponse{Nonce: nonce})
+}
+
+// Verify handles signing in with a signed message
+// @Summary Sign in with Ethereum
+// @Description Sign in with an EIP-4361 message signed by the wallet with personal_sign. The message must be issued for SIWE_DOMAIN and one of SIWE_CHAIN_IDS, and carry a nonce of /auth/siwe/nonce.
+// @Description Wallets linked to no user get a new user, with a placeholder email and without password, unless registration is closed.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body dto.SIWEVerifyRequest true "Signed message"
+// @Success 200 {object} dto.AuthResponse "v1 sets the refresh token in a cookie, v2 returns dto.TokenResponse"
+// @Failure 400 {object} dto.ErrorResponse "Invalid or expired message, or unknown nonce"
+// @Failure 401 {object} dto.ErrorResponse "The signature wasn't made by the address of the message"
+// @Failure 403 {object} dto.ErrorResponse "Registration is closed or limited to allowed email domains, or the user is inactive"
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /v1/auth/siwe/verify [post]
+// @Router /v2/auth/siwe/verify [post]
+func (h *SIWEHandler) Verify(c *gin.Context) {
+	var req dto.SIWEVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "Validation failed", err.Error())
+		return
+	}
+
+	response, err := h.siwe.SignIn(c.Request.Context(), req.Message, req.Signature)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidSIWEMessage):
+			respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+		case errors.Is(err, service.ErrInvalidSIWESignature):
+			respondServiceError(c, http.StatusUnauthorized, "Unauthorized", err)
+		case errors.Is(err, service.ErrFeatureDisabled), errors.Is(err, service.ErrInvitationRequired), errors.Is(err, service.ErrEmailDomainNotAllowed), errors.Is(err, service.ErrUserInactive), errors.Is(err, service.ErrAccountBanned), errors.Is(err, service.ErrEmailNotVerified):
+			respondServiceError(c, http.StatusForbidden, "Forbidden", err)
+		default:
+			respondError(c, http.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return
+	}
+
+	h.auth.respondTokens(c, http.StatusOK, response)
+}
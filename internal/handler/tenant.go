@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// TenantIDHeader names the tenant of a request in multi-tenant deployments
+const TenantIDHeader = "X-Tenant-ID"
+
+// TenantMiddleware stores the tenant named by the X-Tenant-ID header in the request context,
+// so that emails are branded and links and cookies point to the frontend of the tenant.
+// Requests without the header have no tenant, requests naming an unknown tenant are rejected.
+func TenantMiddleware(tenants *service.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(TenantIDHeader)
+		if id == "" {
+			c.Next()
+			return
+		}
+
+		tenant, err := tenants.Get(c.Request.Context(), id)
+		if err != nil {
+			if errors.Is(err, service.ErrTenantNotFound) {
+				respondServiceError(c, http.StatusBadRequest, "Bad request", err)
+			} else {
+				respondError(c, http.StatusInternalServerError, "Internal server error", "failed to resolve tenant")
+			}
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(service.ContextWithTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutMiddleware cancels the request context after the timeout of the matched route template
+// and answers 504 instead of whatever the handler wrote by then. Routes without an entry use
+// fallback. The response is buffered until the handler returns, so it is not meant for streaming.
+func TimeoutMiddleware(timeouts map[string]time.Duration, fallback time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := timeouts[c.FullPath()]
+		if !ok {
+			timeout = fallback
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		writer := c.Writer
+		buffer := newBufferedWriter(writer)
+		c.Writer = buffer
+		c.Next()
+		c.Writer = writer
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// Headers and body of the late response, e.g. cookies of a login, are discarded
+			respondError(c, http.StatusGatewayTimeout, "Gateway Timeout", "Request took longer than %s", timeout.String())
+			c.Abort()
+			return
+		}
+
+		buffer.flush()
+	}
+}
+
+// bufferedWriter holds the response back until the handler is done
+type bufferedWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func newBufferedWriter(w gin.ResponseWriter) *bufferedWriter {
+	return &bufferedWriter{
+		ResponseWriter: w,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+	}
+}
+
+func (w *bufferedWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.Written() {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow is a no-op, the status is written by flush
+func (w *bufferedWriter) WriteHeaderNow() {}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if w.body.Len() == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+// Flush is a no-op, the body is sent at once by flush
+func (w *bufferedWriter) Flush() {}
+
+// flush copies the buffered response to the underlying writer
+func (w *bufferedWriter) flush() {
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+// TokenRevocationHandler implements the token revocation endpoint of RFC 7009 for OAuth clients
+// and gateways, which speak the standard form and error format rather than the API of the service
+type TokenRevocationHandler struct {
+	authService service.AuthService
+	clients     map[string]string
+}
+
+// NewTokenRevocationHandler creates a new token revocation handler for clients mapped to their secrets
+func NewTokenRevocationHandler(authService service.AuthService, clients map[string]string) *TokenRevocationHandler {
+	return &TokenRevocationHandler{authService: authService, clients: clients}
+}
+
+// Revoke handles token revocation requests
+// @Summary Revoke token
+// @Description Revoke a refresh token, ending its session, or an access token until it expires (RFC 7009). Clients configured in TOKEN_REVOCATION_CLIENTS authenticate with HTTP Basic or client_id and client_secret in the form.
+// @Description Unknown, expired and already revoked tokens are answered with 200 as well. Errors are OAuth errors, e.g. {"error":"invalid_client"}.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to revoke"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 "Revoked, or not a valid token"
+// @Failure 400 {object} dto.OAuthErrorResponse "invalid_request"
+// @Failure 401 {object} dto.OAuthErrorResponse "invalid_client"
+// @Failure 503 {object} dto.OAuthErrorResponse "The token may still be valid, retry later"
+// @Router /v1/oauth/revoke [post]
+func (h *TokenRevocationHandler) Revoke(c *gin.Context) {
+	// The responses must not be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+
+	var req dto.RevokeTokenRequest
+	bindErr := c.ShouldBindWith(&req, binding.FormPost)
+
+	if !h.authenticate(c, req) {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		c.JSON(http.StatusUnauthorized, dto.OAuthErrorResponse{Error: "invalid_client", ErrorDescription: "Client authentication failed"})
+		return
+	}
+	if bindErr != nil {
+		c.JSON(http.StatusBadRequest, dto.OAuthErrorResponse{Error: "invalid_request", ErrorDescription: "The token parameter is required"})
+		return
+	}
+
+	if err := h.authService.RevokeToken(c.Request.Context(), req.Token, req.TokenTypeHint); err != nil {
+		observability.LoggerFromContext(c.Request.Context()).Error("Failed to revoke token", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, dto.OAuthErrorResponse{Error: "temporarily_unavailable", ErrorDescription: "The token could not be revoked, retry later"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// authenticate checks the client credentials of HTTP Basic, whose parts are form encoded
+// (RFC 6749 section 2.3.1), or else of the form
+func (h *TokenRevocationHandler) authenticate(c *gin.Context, req dto.RevokeTokenRequest) bool {
+	clientID, clientSecret := req.ClientID, req.ClientSecret
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		var errID, errSecret error
+		clientID, errID = url.QueryUnescape(username)
+		clientSecret, errSecret = url.QueryUnescape(password)
+		if errID != nil || errSecret != nil {
+			return false
+		}
+	}
+
+	secret, ok := h.clients[clientID]
+	return ok && subtle.ConstantTimeCompare([]byte(clientSecret), []byte(secret)) == 1
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestTokenRevocation(t *testing.T) {
+	var revoked []string
+	authService := &testutil.AuthService{
+		RevokeTokenFunc: func(ctx context.Context, token, tokenTypeHint string) error {
+			if token == "unavailable" {
+				return errors.New("redis is down")
+			}
+			revoked = append(revoked, token+"/"+tokenTypeHint)
+			return nil
+		},
+	}
+	router := gin.New()
+	router.POST("/oauth/revoke", NewTokenRevocationHandler(authService, map[string]string{"gateway": "s3cret:+"}).Revoke)
+
+	tests := []struct {
+		name  string
+		form  url.Values
+		basic []string
+		// status is expected with the OAuth error code, if any
+		status int
+		error  string
+	}{
+		{name: "basic auth", form: url.Values{"token": {"t1"}, "token_type_hint": {"refresh_token"}}, basic: []string{"gateway", url.QueryEscape("s3cret:+")}, status: http.StatusOK},
+		{name: "form credentials", form: url.Values{"token": {"t2"}, "client_id": {"gateway"}, "client_secret": {"s3cret:+"}}, status: http.StatusOK},
+		{name: "wrong secret", form: url.Values{"token": {"t3"}}, basic: []string{"gateway", "wrong"}, status: http.StatusUnauthorized, error: "invalid_client"},
+		{name: "unknown client", form: url.Values{"token": {"t3"}, "client_id": {"other"}, "client_secret": {"s3cret:+"}}, status: http.StatusUnauthorized, error: "invalid_client"},
+		{name: "anonymous", form: url.Values{"token": {"t3"}}, status: http.StatusUnauthorized, error: "invalid_client"},
+		{name: "missing token", form: url.Values{"client_id": {"gateway"}, "client_secret": {"s3cret:+"}}, status: http.StatusBadRequest, error: "invalid_request"},
+		{name: "unavailable", form: url.Values{"token": {"unavailable"}, "client_id": {"gateway"}, "client_secret": {"s3cret:+"}}, status: http.StatusServiceUnavailable, error: "temporarily_unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/oauth/revoke", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basic != nil {
+				req.SetBasicAuth(tt.basic[0], tt.basic[1])
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("Expected Cache-Control no-store, got %q", rec.Header().Get("Cache-Control"))
+			}
+			if tt.error == "" {
+				return
+			}
+			var body dto.OAuthErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != tt.error {
+				t.Errorf("Expected OAuth error %s, got %s", tt.error, rec.Body.String())
+			}
+		})
+	}
+
+	if strings.Join(revoked, ",") != "t1/refresh_token,t2/" {
+		t.Errorf("Expected only the tokens of authenticated requests to be revoked, got %v", revoked)
+	}
+}
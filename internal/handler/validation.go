@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/i18n"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// Rule of field errors on values of the wrong JSON type
+const fieldRuleType = "type"
+
+// fieldRuleMessages are the messages of the field errors by rule
+// Messages of rules with a parameter, such as min, are formatted with it.
+var fieldRuleMessages = map[string]string{
+	"required":                  "This field is required",
+	"required_without":          "This field is required",
+	"email":                     "Must be a valid email address",
+	"url":                       "Must be a valid URL",
+	"bcp47_language_tag":        "Must be a valid language tag",
+	"oneof":                     "Must be one of: %s",
+	"min":                       "Must be at least %s characters long",
+	"max":                       "Must be at most %s characters long",
+	fieldRuleType:               "Has an invalid type",
+	utils.PasswordRuleMinLength: "Must be at least %d characters long",
+	utils.PasswordRuleUppercase: "Must contain an uppercase letter",
+	utils.PasswordRuleLowercase: "Must contain a lowercase letter",
+	utils.PasswordRuleNumber:    "Must contain a number",
+	"username":                  "Must be 3-32 characters of letters, digits, dots, underscores or hyphens, starting with a letter or digit",
+}
+
+func init() {
+	// Validation errors name fields as clients send them
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// bindJSON binds the request body to obj, writing a 400 response with the field errors if it is invalid
+// It reports whether the body is valid.
+func bindJSON(c *gin.Context, obj any) bool {
+	err := c.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErrs):
+		details := make([]dto.FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			details = append(details, validationFieldError(c, fieldErr))
+		}
+		writeErrorDetails(c, http.StatusBadRequest, "Validation failed", "", details, "One or more fields are invalid")
+	case errors.As(err, &typeErr):
+		details := []dto.FieldError{fieldError(c, typeErr.Field, fieldRuleType)}
+		writeErrorDetails(c, http.StatusBadRequest, "Validation failed", "", details, "One or more fields are invalid")
+	default:
+		respondError(c, http.StatusBadRequest, "Validation failed", "Request body must be a valid JSON object")
+	}
+	return false
+}
+
+// validationFieldError describes a field rejected by a binding rule
+func validationFieldError(c *gin.Context, fieldErr validator.FieldError) dto.FieldError {
+	// The namespace starts with the name of the bound struct
+	_, field, _ := strings.Cut(fieldErr.Namespace(), ".")
+	rule := fieldErr.Tag()
+
+	message, ok := fieldRuleMessages[rule]
+	switch {
+	case !ok:
+		message = "Is invalid"
+	case (rule == "min" || rule == "max") && fieldErr.Kind() != reflect.String:
+		message = strings.TrimSuffix(message, " characters long")
+	}
+	if strings.Contains(message, "%s") {
+		return dto.FieldError{Field: field, Rule: rule, Message: i18n.Translate(Locale(c), message, fieldErr.Param())}
+	}
+	return dto.FieldError{Field: field, Rule: rule, Message: i18n.Translate(Locale(c), message)}
+}
+
+// fieldError describes a field rejected by a rule without parameter
+func fieldError(c *gin.Context, field, rule string) dto.FieldError {
+	if rule == utils.PasswordRuleMinLength {
+		return dto.FieldError{Field: field, Rule: rule, Message: i18n.Translate(Locale(c), fieldRuleMessages[rule], utils.MinPasswordLength)}
+	}
+	return dto.FieldError{Field: field, Rule: rule, Message: i18n.Translate(Locale(c), fieldRuleMessages[rule])}
+}
+
+// serviceFieldErrors returns the field errors of a service error rejecting request fields, if any
+func serviceFieldErrors(c *gin.Context, err error) []dto.FieldError {
+	var policyErr *service.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		details := make([]dto.FieldError, 0, len(policyErr.Rules))
+		for _, rule := range policyErr.Rules {
+			details = append(details, fieldError(c, "password", rule))
+		}
+		return details
+	case errors.Is(err, service.ErrInvalidEmail):
+		return []dto.FieldError{fieldError(c, "email", "email")}
+	case errors.Is(err, service.ErrInvalidUsername):
+		return []dto.FieldError{fieldError(c, "username", "username")}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+func TestValidationFieldErrors(t *testing.T) {
+	authService := &testutil.AuthService{
+		RegisterFunc: func(ctx context.Context, req *dto.RegisterRequest) (*service.AuthResponseWithRefreshToken, error) {
+			return nil, &service.PasswordPolicyError{Rules: []string{utils.PasswordRuleUppercase, utils.PasswordRuleNumber}}
+		},
+	}
+	handler := NewAuthHandler(authService, CookieOptions{})
+
+	router := gin.New()
+	router.Use(LocaleMiddleware())
+	router.POST("/register", handler.Register)
+	router.POST("/login", handler.Login)
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		locale   string
+		expected []dto.FieldError
+	}{
+		{
+			name: "binding rules",
+			path: "/register",
+			body: `{"email": "not-an-email", "username": "ab"}`,
+			expected: []dto.FieldError{
+				{Field: "email", Rule: "email", Message: "Must be a valid email address"},
+				{Field: "username", Rule: "min", Message: "Must be at least 3 characters long"},
+				{Field: "password", Rule: "required", Message: "This field is required"},
+			},
+		},
+		{
+			name: "password policy",
+			path: "/register",
+			body: `{"email": "alice@example.com", "password": "password"}`,
+			expected: []dto.FieldError{
+				{Field: "password", Rule: utils.PasswordRuleUppercase, Message: "Must contain an uppercase letter"},
+				{Field: "password", Rule: utils.PasswordRuleNumber, Message: "Must contain a number"},
+			},
+		},
+		{
+			name:     "wrong type",
+			path:     "/login",
+			body:     `{"identifier": "alice", "password": 123}`,
+			expected: []dto.FieldError{{Field: "password", Rule: "type", Message: "Has an invalid type"}},
+		},
+		{
+			name:     "translated",
+			path:     "/login",
+			body:     `{}`,
+			locale:   "ru",
+			expected: []dto.FieldError{{Field: "identifier", Rule: "required_without", Message: "Обязательное поле"}, {Field: "password", Rule: "required", Message: "Обязательное поле"}},
+		},
+		{
+			name: "malformed",
+			path: "/login",
+			body: `{"identifier":`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tt.locale)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", rec.Code)
+			}
+			var response dto.ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !slices.Equal(response.Details, tt.expected) {
+				t.Errorf("Expected details %+v, got %+v", tt.expected, response.Details)
+			}
+		})
+	}
+}
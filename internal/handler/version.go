@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersion is the major version of the public API
+type APIVersion int
+
+// Supported API versions
+const (
+	// APIVersion1 keeps the refresh token in an httpOnly cookie
+	APIVersion1 APIVersion = 1
+	// APIVersion2 returns and accepts the refresh token in the body and adds error codes
+	APIVersion2 APIVersion = 2
+)
+
+const apiVersionKey = "api_version"
+
+// String returns the version as used in paths, e.g. "v1"
+func (v APIVersion) String() string {
+	return fmt.Sprintf("v%d", v)
+}
+
+// Prefix returns the route prefix of the version
+func (v APIVersion) Prefix() string {
+	return "/api/" + v.String()
+}
+
+// APIVersionMiddleware stores the API version of the route group, so that shared handlers can adapt responses
+func APIVersionMiddleware(version APIVersion) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, version)
+		c.Next()
+	}
+}
+
+// DeprecationMiddleware announces that the API version is deprecated in favor of successor
+// Sunset is the planned removal date, omitted when zero
+func DeprecationMiddleware(successor APIVersion, sunset time.Time) gin.HandlerFunc {
+	link := fmt.Sprintf(`<%s>; rel="successor-version"`, successor.Prefix())
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", link)
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+
+		c.Next()
+	}
+}
+
+// apiVersion returns the API version of the request, v1 for routes outside of versioned groups
+func apiVersion(c *gin.Context) APIVersion {
+	if version, ok := c.Get(apiVersionKey); ok {
+		return version.(APIVersion)
+	}
+	return APIVersion1
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePasswordPath is the well-known URL password managers open to let users change a password
+// (https://w3c.github.io/webappsec-change-password-url/)
+const ChangePasswordPath = "/.well-known/change-password"
+
+// ChangePasswordRedirect redirects to the change-password page of the frontend
+func ChangePasswordRedirect(pageURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Redirect(http.StatusFound, pageURL)
+	}
+}
@@ -0,0 +1,124 @@
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when no supported locale matches
+// Messages in code are written in the default locale and serve as catalog keys
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var catalogFS embed.FS
+
+var (
+	// catalogs maps locale to translations keyed by the default locale message
+	catalogs = mustLoadCatalogs()
+	matcher  language.Matcher
+	locales  []string
+)
+
+func init() {
+	locales = append(locales, DefaultLocale)
+	for locale := range catalogs {
+		if locale != DefaultLocale {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales[1:])
+
+	// The first tag is the fallback of the matcher
+	tags := make([]language.Tag, 0, len(locales))
+	for _, locale := range locales {
+		tags = append(tags, language.Make(locale))
+	}
+	matcher = language.NewMatcher(tags)
+}
+
+// Supported returns the supported locales, the default locale first
+func Supported() []string {
+	return append([]string(nil), locales...)
+}
+
+// Translate returns the message in the given locale, formatting it with args if any
+// Messages without a translation are returned as is
+func Translate(locale, message string, args ...any) string {
+	if translated, ok := catalogs[Match(locale)][message]; ok {
+		message = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// Negotiate picks the best supported locale for an Accept-Language header value
+func Negotiate(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return locales[index]
+}
+
+// Match maps an arbitrary locale such as "ru-RU" to the closest supported locale
+func Match(locale string) string {
+	if locale == "" {
+		return DefaultLocale
+	}
+	return Negotiate(locale)
+}
+
+type localeKey struct{}
+
+// WithLocale returns a copy of ctx carrying the request locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// FromContext returns the request locale stored in ctx or the default locale
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(localeKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// mustLoadCatalogs loads locales/<locale>.json files
+func mustLoadCatalogs() map[string]map[string]string {
+	files, err := fs.Glob(catalogFS, "locales/*.json")
+	if err != nil {
+		panic(fmt.Sprintf("failed to list message catalogs: %v", err))
+	}
+
+	result := make(map[string]map[string]string, len(files))
+	for _, file := range files {
+		data, err := catalogFS.ReadFile(file)
+		if err != nil {
+			panic(fmt.Sprintf("failed to read message catalog %s: %v", file, err))
+		}
+
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("failed to parse message catalog %s: %v", file, err))
+		}
+
+		result[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+
+	return result
+}
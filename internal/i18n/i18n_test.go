@@ -0,0 +1,73 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"ru-RU,ru;q=0.9,en;q=0.8", "ru"},
+		{"en-US,en;q=0.9", "en"},
+		{"de-DE", "en"},
+		{"de;q=0.9,ru;q=0.5", "ru"},
+		{"not a language", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if got := Translate("ru", "invalid credentials"); got != "Неверные учетные данные" {
+		t.Errorf("Unexpected translation: %q", got)
+	}
+	if got := Translate("ru-RU", "Rate limit exceeded, try again in %ds", 30); got != "Превышен лимит запросов, повторите через 30 с" {
+		t.Errorf("Unexpected formatted translation: %q", got)
+	}
+	if got := Translate("en", "invalid credentials"); got != "invalid credentials" {
+		t.Errorf("Expected default locale message as is, got %q", got)
+	}
+	if got := Translate("ru", "Message without translation"); got != "Message without translation" {
+		t.Errorf("Expected untranslated message as is, got %q", got)
+	}
+}
+
+func TestCatalogsCoverFormatVerbs(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for message, translated := range catalog {
+			if countVerbs(message) != countVerbs(translated) {
+				t.Errorf("%s translation of %q has mismatched format verbs", locale, message)
+			}
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != DefaultLocale {
+		t.Errorf("Expected default locale, got %q", got)
+	}
+	if got := FromContext(WithLocale(context.Background(), "ru")); got != "ru" {
+		t.Errorf("Expected ru, got %q", got)
+	}
+}
+
+func countVerbs(s string) int {
+	count := 0
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] == '%' {
+			if s[i+1] != '%' {
+				count++
+			}
+			i++
+		}
+	}
+	return count
+}
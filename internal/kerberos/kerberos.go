@@ -0,0 +1,109 @@
+// Package kerberos accepts Kerberos tickets of SPNEGO (RFC 4559) HTTP authentication, sent by
+// browsers of domain-joined machines in "Authorization: Negotiate <token>" headers.
+package kerberos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// credentialsKey is the context key gokrb5 stores the credentials of an accepted ticket under
+const credentialsKey = "github.com/jcmturner/gokrb5/v8/ctxCredentials"
+
+// ErrTicketRejected is returned for tokens that aren't valid tickets for the service, e.g. expired
+// ones, tickets of another service or replayed authenticators
+var ErrTicketRejected = errors.New("kerberos ticket rejected")
+
+// Config configures the service principal tickets are accepted for
+type Config struct {
+	Keytab *keytab.Keytab
+	// ServicePrincipal selects the keytab entry, e.g. HTTP/auth.corp.example.com, by default the
+	// principal the ticket was issued for
+	ServicePrincipal string
+	// MaxClockSkew is the tolerated difference between the clocks of clients and the service
+	MaxClockSkew time.Duration
+}
+
+// Principal is the client a ticket was issued to
+type Principal struct {
+	// Name is the principal name without realm, e.g. jdoe or jdoe/admin
+	Name  string
+	Realm string
+}
+
+// String returns the principal as name@REALM
+func (p Principal) String() string {
+	return p.Name + "@" + p.Realm
+}
+
+// Acceptor accepts SPNEGO tokens carrying Kerberos tickets for the service principal
+type Acceptor struct {
+	config Config
+}
+
+// NewAcceptor creates an acceptor with the keys of config
+func NewAcceptor(config Config) *Acceptor {
+	return &Acceptor{config: config}
+}
+
+// LoadKeytab reads a keytab file, e.g. exported with ktpass or kadmin
+func LoadKeytab(path string) (*keytab.Keytab, error) {
+	kt, err := keytab.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keytab %s: %w", path, err)
+	}
+	return kt, nil
+}
+
+// Accept verifies an SPNEGO token and returns the client principal
+// clientAddr is the address of the client, tickets restricted to other addresses are rejected.
+func (a *Acceptor) Accept(token []byte, clientAddr string) (*Principal, error) {
+	settings := []func(*service.Settings){service.DecodePAC(false)}
+	if a.config.ServicePrincipal != "" {
+		settings = append(settings, service.KeytabPrincipal(a.config.ServicePrincipal))
+	}
+	if a.config.MaxClockSkew > 0 {
+		settings = append(settings, service.MaxClockSkew(a.config.MaxClockSkew))
+	}
+	if addr, err := types.GetHostAddress(clientAddr); err == nil {
+		settings = append(settings, service.ClientAddress(addr))
+	}
+
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(token); err != nil {
+		// Some clients send the Kerberos token without the SPNEGO wrapper
+		var krb5Token spnego.KRB5Token
+		if krb5Token.Unmarshal(token) != nil {
+			return nil, fmt.Errorf("%w: malformed token: %v", ErrTicketRejected, err)
+		}
+		st = spnego.SPNEGOToken{Init: true}
+		st.NegTokenInit.MechTypes = append(st.NegTokenInit.MechTypes, krb5Token.OID)
+		st.NegTokenInit.MechTokenBytes = token
+	}
+	if st.Init && len(st.NegTokenInit.MechTypes) == 0 {
+		return nil, fmt.Errorf("%w: no mechanism offered", ErrTicketRejected)
+	}
+
+	accepted, ctx, status := spnego.SPNEGOService(a.config.Keytab, settings...).AcceptSecContext(&st)
+	if !accepted || status.Code != gssapi.StatusComplete {
+		return nil, fmt.Errorf("%w: %s", ErrTicketRejected, status)
+	}
+	creds, ok := ctx.Value(credentialsKey).(*credentials.Credentials)
+	if !ok {
+		return nil, fmt.Errorf("%w: no credentials in accepted context", ErrTicketRejected)
+	}
+
+	return &Principal{
+		Name:  strings.Join(creds.CName().NameString, "/"),
+		Realm: creds.Domain(),
+	}, nil
+}
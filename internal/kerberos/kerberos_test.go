@@ -0,0 +1,82 @@
+package kerberos
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const testRealm = "CORP.EXAMPLE.COM"
+
+// newServiceKeytab returns the keytab of HTTP/auth.corp.example.com, like one exported from the KDC
+func newServiceKeytab(t *testing.T) *keytab.Keytab {
+	t.Helper()
+	kt := keytab.New()
+	if err := kt.AddEntry("HTTP/auth.corp.example.com", testRealm, "service-password", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("Failed to create keytab: %v", err)
+	}
+	return kt
+}
+
+// newTicketToken returns the SPNEGO token a browser sends with a ticket the KDC issued to jdoe
+func newTicketToken(t *testing.T, kt *keytab.Keytab, issued time.Time) []byte {
+	t.Helper()
+	cl := client.NewWithPassword("jdoe", testRealm, "user-password", krbconfig.New())
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "auth.corp.example.com"}}
+	ticket, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), testRealm, sname, testRealm, types.NewKrbFlags(), kt,
+		etypeID.AES256_CTS_HMAC_SHA1_96, 1, issued, issued, issued.Add(10*time.Hour), issued.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to issue ticket: %v", err)
+	}
+	krb5Token, err := spnego.NewKRB5TokenAPREQ(cl, ticket, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create AP-REQ: %v", err)
+	}
+	mechToken, err := krb5Token.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal AP-REQ: %v", err)
+	}
+	st := spnego.SPNEGOToken{Init: true}
+	st.NegTokenInit.MechTypes = append(st.NegTokenInit.MechTypes, gssapi.OIDKRB5.OID())
+	st.NegTokenInit.MechTokenBytes = mechToken
+	token, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal SPNEGO token: %v", err)
+	}
+	return token
+}
+
+func TestAcceptorAccept(t *testing.T) {
+	kt := newServiceKeytab(t)
+	acceptor := NewAcceptor(Config{Keytab: kt, ServicePrincipal: "HTTP/auth.corp.example.com", MaxClockSkew: 5 * time.Minute})
+
+	principal, err := acceptor.Accept(newTicketToken(t, kt, time.Now()), "10.0.0.1:51234")
+	if err != nil {
+		t.Fatalf("Failed to accept ticket: %v", err)
+	}
+	if principal.Name != "jdoe" || principal.Realm != testRealm {
+		t.Errorf("Expected jdoe@%s, got %s", testRealm, principal)
+	}
+
+	// Tickets of another service can't be decrypted with the keys of the keytab
+	other := keytab.New()
+	if err := other.AddEntry("HTTP/auth.corp.example.com", testRealm, "other-password", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("Failed to create keytab: %v", err)
+	}
+	if _, err := acceptor.Accept(newTicketToken(t, other, time.Now()), "10.0.0.1:51234"); !errors.Is(err, ErrTicketRejected) {
+		t.Errorf("Expected ErrTicketRejected for a ticket of another key, got %v", err)
+	}
+	if _, err := acceptor.Accept([]byte("not a token"), "10.0.0.1:51234"); !errors.Is(err, ErrTicketRejected) {
+		t.Errorf("Expected ErrTicketRejected for a malformed token, got %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Providers sending account events, sign-in with them isn't part of this service but accounts
+// linked under these names are unlinked by their events
+const (
+	ProviderApple  = "apple"
+	ProviderGoogle = "google"
+)
+
+// Types of account events, each provider event maps to one of them
+const (
+	// AccountEventConsentRevoked is sent when the user stops using the account with the application
+	AccountEventConsentRevoked = "consent_revoked"
+	// AccountEventDeleted is sent when the provider account was deleted
+	AccountEventDeleted = "account_deleted"
+	// AccountEventDisabled is sent when the provider disabled the account, e.g. it was hijacked
+	AccountEventDisabled = "account_disabled"
+	// AccountEventSessionsRevoked is sent when the user signed out of all sessions at the provider
+	AccountEventSessionsRevoked = "sessions_revoked"
+)
+
+const (
+	appleIssuer   = "https://appleid.apple.com"
+	appleKeysURL  = "https://appleid.apple.com/auth/keys"
+	googleIssuer  = "https://accounts.google.com/"
+	googleKeysURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// Google security event URIs (OpenID RISC and OAuth event types)
+	riscAccountDisabled = "https://schemas.openid.net/secevent/risc/event-type/account-disabled"
+	riscAccountPurged   = "https://schemas.openid.net/secevent/risc/event-type/account-purged"
+	riscSessionsRevoked = "https://schemas.openid.net/secevent/risc/event-type/sessions-revoked"
+	riscTokensRevoked   = "https://schemas.openid.net/secevent/oauth/event-type/tokens-revoked"
+	riscAllRevoked      = "https://schemas.openid.net/secevent/risc/event-type/tokens-revoked"
+
+	keySetRefreshInterval = time.Hour
+	// keySetMinRefreshInterval limits reloads caused by events signed with unknown keys
+	keySetMinRefreshInterval = time.Minute
+	// eventLeeway tolerates clock skew on the issue and expiry times of events
+	eventLeeway = time.Minute
+	// riscMaxAge bounds the age of security event tokens, which Google issues without expiry and
+	// redelivers for days when the receiver is down
+	riscMaxAge = 7 * 24 * time.Hour
+)
+
+// ErrInvalidAccountEvent is returned for account events that aren't signed by the provider for
+// one of the client IDs, or are malformed
+var ErrInvalidAccountEvent = errors.New("invalid account event")
+
+// AccountEvent is a change of a provider account notified by the provider
+type AccountEvent struct {
+	Provider string
+	// Subject is the ID of the provider account, the provider user ID of the connection
+	Subject string
+	Type    string
+	Time    time.Time
+	// TokenID is the jti of the token carrying the event, so that replays of the token can be
+	// dropped until TokenExpiry, after which the token is refused. Empty for providers whose
+	// events are only applied idempotently.
+	TokenID     string
+	TokenExpiry time.Time
+}
+
+// AccountEventSource verifies the account event notifications of a provider
+type AccountEventSource interface {
+	// Provider returns the provider name the events are about
+	Provider() string
+	// Parse verifies a notification and returns its events, events of unhandled types are left out
+	// Unverifiable notifications are reported with ErrInvalidAccountEvent, other errors mean the
+	// keys of the provider couldn't be loaded and the notification should be retried.
+	Parse(ctx context.Context, body []byte) ([]AccountEvent, error)
+}
+
+// AppleAccountEvents verifies the server-to-server notifications of Sign in with Apple
+// Apple posts {"payload": "<JWS>"} whose events claim is itself a JSON object.
+type AppleAccountEvents struct {
+	verifier *eventVerifier
+}
+
+// NewAppleAccountEvents creates the verifier of notifications for the Services IDs and bundle IDs
+// of Sign in with Apple, httpClient loads the keys of Apple and defaults to a client with a timeout
+func NewAppleAccountEvents(clientIDs []string, httpClient *http.Client) *AppleAccountEvents {
+	return &AppleAccountEvents{verifier: newEventVerifier(appleIssuer, appleKeysURL, clientIDs, httpClient)}
+}
+
+// Provider returns ProviderApple
+func (a *AppleAccountEvents) Provider() string {
+	return ProviderApple
+}
+
+// Parse verifies a notification of Apple
+func (a *AppleAccountEvents) Parse(ctx context.Context, body []byte) ([]AccountEvent, error) {
+	var notification struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &notification); err != nil || notification.Payload == "" {
+		return nil, fmt.Errorf("%w: missing payload", ErrInvalidAccountEvent)
+	}
+
+	var claims struct {
+		jwt.RegisteredClaims
+		Events string `json:"events"`
+	}
+	if err := a.verifier.verify(ctx, notification.Payload, &claims); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Sub  string `json:"sub"`
+		// EventTime is in milliseconds
+		EventTime int64 `json:"event_time"`
+	}
+	if err := json.Unmarshal([]byte(claims.Events), &event); err != nil || event.Sub == "" {
+		return nil, fmt.Errorf("%w: malformed events claim", ErrInvalidAccountEvent)
+	}
+
+	var eventType string
+	switch event.Type {
+	case "consent-revoked":
+		eventType = AccountEventConsentRevoked
+	case "account-delete":
+		eventType = AccountEventDeleted
+	default:
+		// email-disabled and email-enabled only concern the relay of private emails
+		return nil, nil
+	}
+	return []AccountEvent{{Provider: ProviderApple, Subject: event.Sub, Type: eventType, Time: time.UnixMilli(event.EventTime)}}, nil
+}
+
+// GoogleAccountEvents verifies the security event tokens of Google Cross-Account Protection (RISC)
+// Google posts the token itself, of content type application/secevent+jwt, with an events claim
+// holding an object per event type.
+type GoogleAccountEvents struct {
+	verifier *eventVerifier
+}
+
+// NewGoogleAccountEvents creates the verifier of security events for the OAuth client IDs of the
+// project, httpClient loads the keys of Google and defaults to a client with a timeout
+func NewGoogleAccountEvents(clientIDs []string, httpClient *http.Client) *GoogleAccountEvents {
+	return &GoogleAccountEvents{verifier: newEventVerifier(googleIssuer, googleKeysURL, clientIDs, httpClient)}
+}
+
+// Provider returns ProviderGoogle
+func (g *GoogleAccountEvents) Provider() string {
+	return ProviderGoogle
+}
+
+// Parse verifies a security event token of Google
+func (g *GoogleAccountEvents) Parse(ctx context.Context, body []byte) ([]AccountEvent, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Events map[string]struct {
+			Subject struct {
+				SubjectType string `json:"subject_type"`
+				Sub         string `json:"sub"`
+			} `json:"subject"`
+		} `json:"events"`
+	}
+	if err := g.verifier.verify(ctx, strings.TrimSpace(string(body)), &claims); err != nil {
+		return nil, err
+	}
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: missing jti or iat", ErrInvalidAccountEvent)
+	}
+
+	// Tokens are refused once expired, or too old when they have no expiry
+	issuedAt := claims.IssuedAt.Time
+	expiry := issuedAt.Add(riscMaxAge)
+	if claims.ExpiresAt != nil && claims.ExpiresAt.Before(expiry) {
+		expiry = claims.ExpiresAt.Time
+	}
+	expiry = expiry.Add(eventLeeway)
+	if time.Now().After(expiry) {
+		return nil, fmt.Errorf("%w: token is too old", ErrInvalidAccountEvent)
+	}
+
+	var events []AccountEvent
+	for uri, event := range claims.Events {
+		var eventType string
+		switch uri {
+		case riscTokensRevoked, riscAllRevoked:
+			eventType = AccountEventConsentRevoked
+		case riscAccountPurged:
+			eventType = AccountEventDeleted
+		case riscAccountDisabled:
+			eventType = AccountEventDisabled
+		case riscSessionsRevoked:
+			eventType = AccountEventSessionsRevoked
+		default:
+			// e.g. verification events sent when testing the stream and account-enabled
+			continue
+		}
+		// Subjects identified otherwise, e.g. by email, can't be matched to a connection
+		if event.Subject.SubjectType != "iss-sub" || event.Subject.Sub == "" {
+			continue
+		}
+		events = append(events, AccountEvent{
+			Provider:    ProviderGoogle,
+			Subject:     event.Subject.Sub,
+			Type:        eventType,
+			Time:        issuedAt,
+			TokenID:     claims.ID,
+			TokenExpiry: expiry,
+		})
+	}
+	return events, nil
+}
+
+// eventVerifier verifies RS256 tokens of an issuer signed with the keys of its JWKS endpoint
+type eventVerifier struct {
+	issuer    string
+	audiences []string
+	keys      *rsaKeySet
+}
+
+func newEventVerifier(issuer, keysURL string, audiences []string, httpClient *http.Client) *eventVerifier {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	return &eventVerifier{
+		issuer:    issuer,
+		audiences: audiences,
+		keys:      &rsaKeySet{url: keysURL, client: httpClient, now: time.Now},
+	}
+}
+
+func (v *eventVerifier) verify(ctx context.Context, token string, claims jwt.Claims) error {
+	var keyErr error
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.keys.key(ctx, kid)
+		keyErr = err
+		return key, err
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audiences...),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(eventLeeway),
+	)
+	if err == nil {
+		return nil
+	}
+	// The keys couldn't be loaded, the notification is fine as far as we know
+	if keyErr != nil && !errors.Is(keyErr, errUnknownKey) {
+		return keyErr
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidAccountEvent, err)
+}
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// rsaKeySet caches the RSA keys of a JWKS endpoint by key ID
+type rsaKeySet struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// key returns the key with the given ID, reloading the set when it is stale or the key is unknown
+func (s *rsaKeySet) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	age := s.now().Sub(s.fetchedAt)
+	key, found := s.keys[kid]
+	if s.keys == nil || age > keySetRefreshInterval || (!found && age > keySetMinRefreshInterval) {
+		if err := s.fetch(ctx); err != nil {
+			// Keep serving cached keys while the endpoint is unavailable
+			if !found {
+				return nil, err
+			}
+			return key, nil
+		}
+		key, found = s.keys[kid]
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: %q", errUnknownKey, kid)
+	}
+	return key, nil
+}
+
+func (s *rsaKeySet) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		exponent := new(big.Int).SetBytes(e)
+		if errN != nil || errE != nil || len(n) == 0 || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+
+	s.keys = keys
+	s.fetchedAt = s.now()
+	return nil
+}
@@ -0,0 +1,152 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newKeyServer serves the public key of a new RSA key under the key ID "k1" and returns the key
+func newKeyServer(t *testing.T) (*httptest.Server, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+	return server, key
+}
+
+func signEvent(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	return signed
+}
+
+func TestAppleAccountEvents(t *testing.T) {
+	ctx := context.Background()
+	server, key := newKeyServer(t)
+	apple := NewAppleAccountEvents([]string{"com.example.web"}, nil)
+	apple.verifier.keys.url = server.URL
+
+	notification := func(claims jwt.MapClaims) []byte {
+		body, _ := json.Marshal(map[string]string{"payload": signEvent(t, key, "k1", claims)})
+		return body
+	}
+	claims := func(aud, eventType string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":    appleIssuer,
+			"aud":    aud,
+			"iat":    time.Now().Unix(),
+			"jti":    "event-1",
+			"events": `{"type":"` + eventType + `","sub":"001234.abcd","event_time":1700000000000}`,
+		}
+	}
+
+	events, err := apple.Parse(ctx, notification(claims("com.example.web", "account-delete")))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != AccountEventDeleted || events[0].Subject != "001234.abcd" || events[0].Provider != ProviderApple {
+		t.Fatalf("Expected an account deletion of 001234.abcd, got %+v", events)
+	}
+	if !events[0].Time.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("Expected the event time in milliseconds, got %s", events[0].Time)
+	}
+
+	if events, err := apple.Parse(ctx, notification(claims("com.example.web", "email-disabled"))); err != nil || len(events) != 0 {
+		t.Errorf("Expected email events to be left out, got %+v, %v", events, err)
+	}
+
+	invalid := map[string][]byte{
+		"other audience": notification(claims("com.other.app", "consent-revoked")),
+		"other issuer":   notification(jwt.MapClaims{"iss": googleIssuer, "aud": "com.example.web", "events": `{"type":"consent-revoked","sub":"1"}`}),
+		"unknown key":    []byte(`{"payload":"` + signEvent(t, key, "k2", claims("com.example.web", "consent-revoked")) + `"}`),
+		"no payload":     []byte(`{}`),
+	}
+	for name, body := range invalid {
+		if _, err := apple.Parse(ctx, body); !errors.Is(err, ErrInvalidAccountEvent) {
+			t.Errorf("%s: expected ErrInvalidAccountEvent, got %v", name, err)
+		}
+	}
+}
+
+func TestGoogleAccountEvents(t *testing.T) {
+	ctx := context.Background()
+	server, key := newKeyServer(t)
+	google := NewGoogleAccountEvents([]string{"123.apps.googleusercontent.com"}, nil)
+	google.verifier.keys.url = server.URL
+
+	token := signEvent(t, key, "k1", jwt.MapClaims{
+		"iss": googleIssuer,
+		"aud": "123.apps.googleusercontent.com",
+		"iat": time.Now().Unix(),
+		"jti": "event-1",
+		"events": map[string]any{
+			riscAccountPurged: map[string]any{"subject": map[string]string{"subject_type": "iss-sub", "iss": googleIssuer, "sub": "7654321"}},
+			"https://schemas.openid.net/secevent/risc/event-type/verification": map[string]string{"state": "test"},
+		},
+	})
+	events, err := google.Parse(ctx, []byte(token))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != AccountEventDeleted || events[0].Subject != "7654321" || events[0].Provider != ProviderGoogle {
+		t.Fatalf("Expected an account deletion of 7654321, got %+v", events)
+	}
+	// Without exp, the token is remembered for as long as it is accepted
+	if events[0].TokenID != "event-1" || time.Until(events[0].TokenExpiry) < riscMaxAge-time.Minute {
+		t.Errorf("Expected the jti and the expiry of the token, got %+v", events[0])
+	}
+
+	old := signEvent(t, key, "k1", jwt.MapClaims{
+		"iss": googleIssuer,
+		"aud": "123.apps.googleusercontent.com",
+		"iat": time.Now().Add(-riscMaxAge - time.Hour).Unix(),
+		"jti": "event-0",
+		"events": map[string]any{
+			riscAccountPurged: map[string]any{"subject": map[string]string{"subject_type": "iss-sub", "iss": googleIssuer, "sub": "7654321"}},
+		},
+	})
+	if _, err := google.Parse(ctx, []byte(old)); !errors.Is(err, ErrInvalidAccountEvent) {
+		t.Errorf("Expected ErrInvalidAccountEvent for a token older than the replay window, got %v", err)
+	}
+
+	if _, err := google.Parse(ctx, []byte("not a token")); !errors.Is(err, ErrInvalidAccountEvent) {
+		t.Errorf("Expected ErrInvalidAccountEvent for a malformed token, got %v", err)
+	}
+
+	// The keys being unavailable is no fault of the event, which should be retried
+	server.Close()
+	unavailable := NewGoogleAccountEvents([]string{"123.apps.googleusercontent.com"}, nil)
+	unavailable.verifier.keys.url = server.URL
+	if _, err := unavailable.Parse(ctx, []byte(token)); err == nil || errors.Is(err, ErrInvalidAccountEvent) {
+		t.Errorf("Expected a retryable error while the keys are unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// GitHub signs users in with GitHub OAuth apps, or GitHub Enterprise Server with a base URL
+type GitHub struct {
+	client
+	apiURL string
+}
+
+// NewGitHub creates the GitHub provider, it reads the profile and the email addresses of the account
+func NewGitHub(config Config) *GitHub {
+	webURL, apiURL := "https://github.com", "https://api.github.com"
+	if config.BaseURL != "" {
+		webURL = strings.TrimSuffix(config.BaseURL, "/")
+		apiURL = webURL + "/api/v3"
+	}
+	return &GitHub{
+		client: newClient(config, webURL+"/login/oauth/authorize", webURL+"/login/oauth/access_token", true, "read:user", "user:email"),
+		apiURL: apiURL,
+	}
+}
+
+// Name returns ProviderGitHub
+func (g *GitHub) Name() string {
+	return ProviderGitHub
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// FetchIdentity reads the account, the email of the profile is only set when public so the
+// addresses are read from /user/emails
+func (g *GitHub) FetchIdentity(ctx context.Context, token *Token) (*Identity, error) {
+	var user githubUser
+	if err := g.getJSON(ctx, token, g.apiURL+"/user", &user); err != nil {
+		return nil, err
+	}
+	var emails []githubEmail
+	if err := g.getJSON(ctx, token, g.apiURL+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider:  ProviderGitHub,
+		ID:        strconv.FormatInt(user.ID, 10),
+		Username:  user.Login,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+	for _, email := range emails {
+		switch {
+		case email.Primary && email.Verified:
+			identity.Email, identity.EmailVerified = email.Email, true
+			return identity, nil
+		case email.Verified && !identity.EmailVerified:
+			identity.Email, identity.EmailVerified = email.Email, true
+		case email.Primary && identity.Email == "":
+			identity.Email = email.Email
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,77 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// GitLab signs users in with GitLab.com, or a self-managed instance with a base URL
+type GitLab struct {
+	client
+	apiURL string
+}
+
+// NewGitLab creates the GitLab provider, it reads the profile and the email addresses of the account
+func NewGitLab(config Config) *GitLab {
+	baseURL := "https://gitlab.com"
+	if config.BaseURL != "" {
+		baseURL = strings.TrimSuffix(config.BaseURL, "/")
+	}
+	return &GitLab{
+		client: newClient(config, baseURL+"/oauth/authorize", baseURL+"/oauth/token", true, "read_user"),
+		apiURL: baseURL + "/api/v4",
+	}
+}
+
+// Name returns ProviderGitLab
+func (g *GitLab) Name() string {
+	return ProviderGitLab
+}
+
+type gitlabUser struct {
+	ID          int64   `json:"id"`
+	Username    string  `json:"username"`
+	Name        string  `json:"name"`
+	Email       string  `json:"email"`
+	AvatarURL   string  `json:"avatar_url"`
+	ConfirmedAt *string `json:"confirmed_at"`
+}
+
+type gitlabEmail struct {
+	Email       string  `json:"email"`
+	ConfirmedAt *string `json:"confirmed_at"`
+}
+
+// FetchIdentity reads the account, /user/emails is only read when the primary email isn't confirmed
+func (g *GitLab) FetchIdentity(ctx context.Context, token *Token) (*Identity, error) {
+	var user gitlabUser
+	if err := g.getJSON(ctx, token, g.apiURL+"/user", &user); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider:      ProviderGitLab,
+		ID:            strconv.FormatInt(user.ID, 10),
+		Email:         user.Email,
+		EmailVerified: user.Email != "" && user.ConfirmedAt != nil,
+		Username:      user.Username,
+		Name:          user.Name,
+		AvatarURL:     user.AvatarURL,
+	}
+	if identity.EmailVerified {
+		return identity, nil
+	}
+
+	var emails []gitlabEmail
+	if err := g.getJSON(ctx, token, g.apiURL+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		if email.ConfirmedAt != nil {
+			identity.Email, identity.EmailVerified = email.Email, true
+			break
+		}
+	}
+	return identity, nil
+}
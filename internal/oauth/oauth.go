@@ -0,0 +1,283 @@
+// Package oauth signs users in with upstream identity providers that redirect the user back, e.g.
+// OAuth 2.0 providers: providers start a sign-in, complete it on callback and read the identity of
+// the provider account. They are registered in a Registry by name, and the StateStore keeps the
+// state, nonce and PKCE verifier of sign-ins and validates callbacks, so providers are small adapters.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported providers, the names are stored in the provider column of oauth_providers
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+	randomBytes    = 32
+)
+
+// ErrExchangeFailed is returned when the provider rejects an authorization code, e.g. an expired one,
+// or redirects back without one, e.g. when the user denies access, and when it rejects a refresh token
+var ErrExchangeFailed = errors.New("authorization code exchange failed")
+
+// Config configures the OAuth application registered with a provider
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback of the service registered with the provider
+	RedirectURL string
+	// BaseURL points to a self-hosted instance, e.g. GitHub Enterprise Server or GitLab self-managed
+	BaseURL string
+	// HTTPClient overrides the client of requests to the provider
+	HTTPClient *http.Client
+}
+
+// Token is the token of the provider account, issued in exchange for an authorization code
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	// Expiry is zero for tokens that don't expire, e.g. those of GitHub OAuth apps
+	Expiry time.Time
+}
+
+// Identity is the provider account a user signed in with
+type Identity struct {
+	Provider string
+	// ID is the stable account ID at the provider, emails and usernames can change
+	ID string
+	// Email is the primary email of the account, the first verified one if it isn't verified
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+	AvatarURL     string
+}
+
+// AuthRequest binds a sign-in to the provider redirecting back, see NewAuthRequest
+type AuthRequest struct {
+	// State is echoed back by the provider and identifies the sign-in on callback
+	State string
+	// Nonce is bound into ID tokens by OpenID Connect providers, others ignore it
+	Nonce string
+	// CodeVerifier is the PKCE (RFC 7636) verifier, providers supporting PKCE send its challenge
+	CodeVerifier string
+}
+
+// NewAuthRequest creates a random state, nonce and PKCE verifier for a sign-in
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	for _, value := range []*string{&req.State, &req.Nonce, &req.CodeVerifier} {
+		random, err := randomString()
+		if err != nil {
+			return AuthRequest{}, fmt.Errorf("failed to generate auth request: %w", err)
+		}
+		*value = random
+	}
+	return req, nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the code verifier
+func (r AuthRequest) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(r.CodeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Callback is a provider redirecting back to complete a sign-in, see StateStore.Complete
+type Callback struct {
+	// Params are the query or form parameters of the redirect, e.g. code and state
+	Params url.Values
+	// Nonce and CodeVerifier are those of the AuthRequest of the sign-in
+	Nonce        string
+	CodeVerifier string
+}
+
+// Provider signs users in with an identity provider redirecting the user back
+type Provider interface {
+	// Name returns the provider name, e.g. one of the Provider constants
+	Name() string
+	// BeginAuth returns the URL the user signs in at, the provider redirects back with the state
+	BeginAuth(ctx context.Context, req AuthRequest) (string, error)
+	// HandleCallback completes the sign-in the provider redirected back with and returns its token
+	HandleCallback(ctx context.Context, callback Callback) (*Token, error)
+	// FetchIdentity reads the account the token was issued for
+	FetchIdentity(ctx context.Context, token *Token) (*Identity, error)
+}
+
+// Refresher is implemented by providers issuing refresh tokens, e.g. GitLab and GitHub apps with expiring tokens
+type Refresher interface {
+	// Refresh exchanges the refresh token of token for a new token
+	Refresh(ctx context.Context, token *Token) (*Token, error)
+}
+
+// client implements the OAuth 2.0 authorization code flow shared by providers, they add FetchIdentity
+type client struct {
+	config   Config
+	authURL  string
+	tokenURL string
+	scopes   []string
+	// pkce sends PKCE challenges and verifiers, for providers supporting them
+	pkce bool
+	http *http.Client
+}
+
+func newClient(config Config, authURL, tokenURL string, pkce bool, scopes ...string) client {
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+	}
+	return client{config: config, authURL: authURL, tokenURL: tokenURL, scopes: scopes, pkce: pkce, http: httpClient}
+}
+
+// BeginAuth returns the URL of the consent page of the provider
+func (c *client) BeginAuth(_ context.Context, req AuthRequest) (string, error) {
+	query := url.Values{
+		"client_id":     {c.config.ClientID},
+		"redirect_uri":  {c.config.RedirectURL},
+		"response_type": {"code"},
+		"scope":         {strings.Join(c.scopes, " ")},
+		"state":         {req.State},
+	}
+	if c.pkce && req.CodeVerifier != "" {
+		query.Set("code_challenge", req.CodeChallenge())
+		query.Set("code_challenge_method", "S256")
+	}
+	return c.authURL + "?" + query.Encode(), nil
+}
+
+// HandleCallback exchanges the authorization code the provider redirected back with
+func (c *client) HandleCallback(ctx context.Context, callback Callback) (*Token, error) {
+	code := callback.Params.Get("code")
+	if code == "" {
+		// Providers redirect back with an error instead, e.g. access_denied when the user denies access
+		return nil, fmt.Errorf("%w: %s", ErrExchangeFailed, callback.Params.Get("error"))
+	}
+	return c.exchange(ctx, code, callback.CodeVerifier)
+}
+
+// tokenResponse is a token endpoint response (RFC 6749 section 5), GitHub reports errors with status 200
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchange exchanges an authorization code for a token
+func (c *client) exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	form := url.Values{
+		"client_id":     {c.config.ClientID},
+		"client_secret": {c.config.ClientSecret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {c.config.RedirectURL},
+	}
+	if c.pkce && codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+	return c.requestToken(ctx, form)
+}
+
+// Refresh exchanges the refresh token of token for a new token (RFC 6749 section 6)
+// Providers not rotating refresh tokens return none, the token keeps the current one then.
+func (c *client) Refresh(ctx context.Context, token *Token) (*Token, error) {
+	if token.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: no refresh token", ErrExchangeFailed)
+	}
+	refreshed, err := c.requestToken(ctx, url.Values{
+		"client_id":     {c.config.ClientID},
+		"client_secret": {c.config.ClientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	return refreshed, nil
+}
+
+// requestToken calls the token endpoint with form
+func (c *client) requestToken(ctx context.Context, form url.Values) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchangeFailed, result.Error, result.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint returned status %d", ErrExchangeFailed, resp.StatusCode)
+	}
+
+	token := &Token{AccessToken: result.AccessToken, RefreshToken: result.RefreshToken, TokenType: result.TokenType}
+	if result.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// getJSON calls an API endpoint of the provider with the token and decodes the response into v
+func (c *client) getJSON(ctx context.Context, token *Token, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned status %d: %s", endpoint, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// randomString returns a random URL-safe string, e.g. a state
+func randomString() (string, error) {
+	buf := make([]byte, randomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,260 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newProviderServer serves the token endpoint at tokenPath and JSON responses of API paths,
+// only the code "good" and the refresh token "refresh" are exchanged
+func newProviderServer(t *testing.T, tokenPath string, responses map[string]string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(tokenPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("grant_type") == "refresh_token" && r.FormValue("refresh_token") == "refresh" && r.FormValue("client_secret") == "secret" {
+			_, _ = w.Write([]byte(`{"access_token":"token","token_type":"bearer","expires_in":7200}`))
+			return
+		}
+		if r.FormValue("code") != "good" || r.FormValue("client_secret") != "secret" {
+			// GitHub reports errors with status 200
+			_, _ = w.Write([]byte(`{"error":"bad_verification_code","error_description":"The code is incorrect or expired."}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"token","refresh_token":"refresh","token_type":"bearer","expires_in":7200}`))
+	})
+	for path, body := range responses {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+		})
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGitHubIdentity(t *testing.T) {
+	ctx := context.Background()
+	server := newProviderServer(t, "/login/oauth/access_token", map[string]string{
+		"/api/v3/user": `{"id":42,"login":"octocat","name":"The Octocat","avatar_url":"https://avatars.example.com/42"}`,
+		"/api/v3/user/emails": `[
+			{"email":"old@example.com","primary":false,"verified":true},
+			{"email":"octocat@example.com","primary":true,"verified":true}
+		]`,
+	})
+	github := NewGitHub(Config{ClientID: "client", ClientSecret: "secret", RedirectURL: "https://auth.example.com/callback", BaseURL: server.URL})
+
+	authURL, err := github.BeginAuth(ctx, AuthRequest{State: "state-1", Nonce: "nonce-1"})
+	if err != nil {
+		t.Fatalf("Failed to begin sign-in: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("Failed to parse auth URL: %v", err)
+	}
+	if parsed.Path != "/login/oauth/authorize" || parsed.Query().Get("state") != "state-1" || parsed.Query().Get("scope") != "read:user user:email" {
+		t.Errorf("Unexpected auth URL %s", authURL)
+	}
+
+	if _, err := github.HandleCallback(ctx, Callback{Params: url.Values{"code": {"bad"}}}); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Expected ErrExchangeFailed for a rejected code, got %v", err)
+	}
+	if _, err := github.HandleCallback(ctx, Callback{Params: url.Values{"error": {"access_denied"}}}); !errors.Is(err, ErrExchangeFailed) {
+		t.Errorf("Expected ErrExchangeFailed without code, got %v", err)
+	}
+	token, err := github.HandleCallback(ctx, Callback{Params: url.Values{"code": {"good"}}})
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	if token.AccessToken != "token" || token.Expiry.IsZero() {
+		t.Errorf("Unexpected token %+v", token)
+	}
+
+	identity, err := github.FetchIdentity(ctx, token)
+	if err != nil {
+		t.Fatalf("Failed to read identity: %v", err)
+	}
+	want := Identity{Provider: ProviderGitHub, ID: "42", Email: "octocat@example.com", EmailVerified: true, Username: "octocat", Name: "The Octocat", AvatarURL: "https://avatars.example.com/42"}
+	if *identity != want {
+		t.Errorf("Expected %+v, got %+v", want, *identity)
+	}
+}
+
+func TestGitLabIdentity(t *testing.T) {
+	ctx := context.Background()
+	server := newProviderServer(t, "/oauth/token", map[string]string{
+		"/api/v4/user":        `{"id":7,"username":"tanuki","name":"Tanuki","email":"unconfirmed@example.com","confirmed_at":null}`,
+		"/api/v4/user/emails": `[{"email":"pending@example.com","confirmed_at":null},{"email":"tanuki@example.com","confirmed_at":"2024-01-01T00:00:00Z"}]`,
+	})
+	gitlab := NewGitLab(Config{ClientID: "client", ClientSecret: "secret", RedirectURL: "https://auth.example.com/callback", BaseURL: server.URL + "/"})
+
+	if authURL, _ := gitlab.BeginAuth(ctx, AuthRequest{State: "state-1"}); !strings.HasPrefix(authURL, server.URL+"/oauth/authorize?") {
+		t.Errorf("Unexpected auth URL %s", authURL)
+	}
+
+	token, err := gitlab.HandleCallback(ctx, Callback{Params: url.Values{"code": {"good"}}})
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	identity, err := gitlab.FetchIdentity(ctx, token)
+	if err != nil {
+		t.Fatalf("Failed to read identity: %v", err)
+	}
+	if identity.ID != "7" || identity.Email != "tanuki@example.com" || !identity.EmailVerified {
+		t.Errorf("Expected the confirmed secondary email, got %+v", identity)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	server := newProviderServer(t, "/oauth/token", nil)
+	var gitlab Provider = NewGitLab(Config{ClientID: "client", ClientSecret: "secret", BaseURL: server.URL})
+
+	refresher, ok := gitlab.(Refresher)
+	if !ok {
+		t.Fatal("Expected GitLab to refresh tokens")
+	}
+	token, err := refresher.Refresh(ctx, &Token{AccessToken: "expired", RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatalf("Failed to refresh token: %v", err)
+	}
+	if token.AccessToken != "token" || token.RefreshToken != "refresh" || token.Expiry.IsZero() {
+		t.Errorf("Expected a new access token keeping the refresh token, got %+v", token)
+	}
+
+	for _, refreshToken := range []string{"", "revoked"} {
+		if _, err := refresher.Refresh(ctx, &Token{RefreshToken: refreshToken}); !errors.Is(err, ErrExchangeFailed) {
+			t.Errorf("Expected ErrExchangeFailed for refresh token %q, got %v", refreshToken, err)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry, err := NewRegistry(NewGitLab(Config{}), NewGitHub(Config{}))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if names := registry.Names(); len(names) != 2 || names[0] != ProviderGitHub || names[1] != ProviderGitLab {
+		t.Errorf("Expected sorted provider names, got %v", names)
+	}
+	if provider, ok := registry.Get(ProviderGitLab); !ok || provider.Name() != ProviderGitLab {
+		t.Errorf("Expected the GitLab provider, got %v", provider)
+	}
+	if _, ok := registry.Get("facebook"); ok {
+		t.Error("Expected unknown providers not to be found")
+	}
+	if err := registry.Register(NewGitHub(Config{})); err == nil {
+		t.Error("Expected registering a provider twice to fail")
+	}
+}
+
+func TestNewAuthRequest(t *testing.T) {
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatalf("Failed to create auth request: %v", err)
+	}
+	other, _ := NewAuthRequest()
+	if req.State == "" || req.Nonce == "" || req.State == req.Nonce || req.State == other.State {
+		t.Errorf("Expected distinct random state and nonce, got %+v and %+v", req, other)
+	}
+}
+
+func TestStateStore(t *testing.T) {
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	store := NewStateStore(client, time.Minute)
+
+	begin := func() (AuthRequest, string) {
+		t.Helper()
+		req, binding, err := store.Begin(ctx, ProviderGitHub, "https://app.example.com/oauth")
+		if err != nil {
+			t.Fatalf("Failed to begin sign-in: %v", err)
+		}
+		return req, binding
+	}
+
+	req, binding := begin()
+	params := url.Values{"state": {req.State}, "code": {"good"}}
+	signIn, callback, err := store.Complete(ctx, ProviderGitHub, params, binding)
+	if err != nil {
+		t.Fatalf("Failed to complete sign-in: %v", err)
+	}
+	if signIn.ReturnURL != "https://app.example.com/oauth" || callback.Nonce != req.Nonce || callback.CodeVerifier != req.CodeVerifier {
+		t.Errorf("Unexpected sign-in %+v and callback %+v", signIn, callback)
+	}
+	if _, _, err := store.Complete(ctx, ProviderGitHub, params, binding); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Expected sign-ins to complete once, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		params   func(state string) url.Values
+		binding  func(binding string) string
+		want     error
+	}{
+		{name: "another browser", provider: ProviderGitHub, params: func(state string) url.Values { return url.Values{"state": {state}, "code": {"good"}} },
+			binding: func(string) string { return "attacker" }, want: ErrInvalidState},
+		{name: "another provider", provider: ProviderGitLab, params: func(state string) url.Values { return url.Values{"state": {state}, "code": {"good"}} },
+			binding: func(binding string) string { return binding }, want: ErrInvalidState},
+		{name: "repeated code", provider: ProviderGitHub, params: func(state string) url.Values { return url.Values{"state": {state}, "code": {"good", "injected"}} },
+			binding: func(binding string) string { return binding }, want: ErrInvalidCallback},
+		{name: "code and error", provider: ProviderGitHub, params: func(state string) url.Values {
+			return url.Values{"state": {state}, "code": {"good"}, "error": {"access_denied"}}
+		}, binding: func(binding string) string { return binding }, want: ErrInvalidCallback},
+		{name: "missing state", provider: ProviderGitHub, params: func(string) url.Values { return url.Values{"code": {"good"}} },
+			binding: func(binding string) string { return binding }, want: ErrInvalidState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, binding := begin()
+			if _, _, err := store.Complete(ctx, tt.provider, tt.params(req.State), tt.binding(binding)); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	ctx := context.Background()
+	var verifier string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier = r.FormValue("code_verifier")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"bearer"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	gitlab := NewGitLab(Config{ClientID: "client", ClientSecret: "secret", BaseURL: server.URL})
+
+	// Test vector of RFC 7636 appendix B
+	req := AuthRequest{State: "state-1", CodeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	authURL, _ := gitlab.BeginAuth(ctx, req)
+	parsed, _ := url.Parse(authURL)
+	if parsed.Query().Get("code_challenge") != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" || parsed.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("Unexpected PKCE challenge in %s", authURL)
+	}
+	if _, err := gitlab.HandleCallback(ctx, Callback{Params: url.Values{"code": {"good"}}, CodeVerifier: req.CodeVerifier}); err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	if verifier != req.CodeVerifier {
+		t.Errorf("Expected the code verifier to be sent, got %q", verifier)
+	}
+}
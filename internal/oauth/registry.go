@@ -0,0 +1,49 @@
+package oauth
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Registry holds the providers users can sign in with, keyed by name
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates a registry of providers, names must be unique
+func NewRegistry(providers ...Provider) (*Registry, error) {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, provider := range providers {
+		if err := r.Register(provider); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds a provider, providers can't replace one registered under the same name
+// Providers are registered at startup, Register must not be called while the registry is in use.
+func (r *Registry) Register(provider Provider) error {
+	name := provider.Name()
+	if _, ok := r.providers[name]; ok {
+		return fmt.Errorf("provider %s is already registered", name)
+	}
+	r.providers[name] = provider
+	return nil
+}
+
+// Get returns the provider registered under name
+func (r *Registry) Get(name string) (Provider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns the names of the registered providers, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
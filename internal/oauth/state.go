@@ -0,0 +1,126 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// stateKey holds a sign-in waiting for the provider to redirect back, keyed by the hash of its state
+const stateKey = "oauth:state:"
+
+var (
+	// ErrInvalidState is returned for callbacks of unknown, expired or completed sign-ins, sign-ins
+	// of another provider and sign-ins started in another browser
+	ErrInvalidState = errors.New("unknown or expired oauth state")
+
+	// ErrInvalidCallback is returned for callbacks with ambiguous parameters, e.g. two codes
+	ErrInvalidCallback = errors.New("invalid oauth callback")
+)
+
+// SignIn is a sign-in waiting for the provider to redirect back
+type SignIn struct {
+	Provider string `json:"provider"`
+	// ReturnURL is where the caller sends the user once signed in
+	ReturnURL    string `json:"return_url"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	// BindingHash is the hash of the secret binding the sign-in to the browser that started it
+	BindingHash string `json:"binding_hash"`
+}
+
+// StateStore keeps sign-ins in Redis until the provider redirects back
+// Every sign-in gets a state, a nonce, a PKCE verifier and a binding, a secret the browser keeps,
+// e.g. in a cookie. Callbacks complete a sign-in once, and only in the browser that started it,
+// so attackers can't complete sign-ins of others or inject their code into sign-ins of victims.
+type StateStore struct {
+	client redis.Cmdable
+	ttl    time.Duration
+}
+
+// NewStateStore creates a store keeping sign-ins for ttl
+func NewStateStore(client redis.Cmdable, ttl time.Duration) *StateStore {
+	return &StateStore{client: client, ttl: ttl}
+}
+
+// Begin starts a sign-in with a provider, it returns the request to pass to Provider.BeginAuth and
+// the binding to keep in the browser
+func (s *StateStore) Begin(ctx context.Context, provider, returnURL string) (AuthRequest, string, error) {
+	req, err := NewAuthRequest()
+	if err != nil {
+		return AuthRequest{}, "", err
+	}
+	binding, err := randomString()
+	if err != nil {
+		return AuthRequest{}, "", fmt.Errorf("failed to generate binding: %w", err)
+	}
+
+	value, err := json.Marshal(SignIn{
+		Provider:     provider,
+		ReturnURL:    returnURL,
+		Nonce:        req.Nonce,
+		CodeVerifier: req.CodeVerifier,
+		BindingHash:  hashString(binding),
+	})
+	if err != nil {
+		return AuthRequest{}, "", fmt.Errorf("failed to encode sign-in: %w", err)
+	}
+	if err := s.client.Set(ctx, stateKey+hashString(req.State), value, s.ttl).Err(); err != nil {
+		return AuthRequest{}, "", fmt.Errorf("failed to store sign-in: %w", err)
+	}
+	return req, binding, nil
+}
+
+// Complete validates a callback of provider and consumes its sign-in, it returns the sign-in and
+// the callback to pass to Provider.HandleCallback. The sign-in is returned along with errors of
+// callbacks of known sign-ins, so callers can send the user back.
+func (s *StateStore) Complete(ctx context.Context, provider string, params url.Values, binding string) (*SignIn, Callback, error) {
+	// Repeated parameters are refused, providers might read another value than the service
+	for _, name := range []string{"state", "code", "error"} {
+		if len(params[name]) > 1 {
+			return nil, Callback{}, fmt.Errorf("%w: repeated %s", ErrInvalidCallback, name)
+		}
+	}
+	state := params.Get("state")
+	if state == "" {
+		return nil, Callback{}, ErrInvalidState
+	}
+
+	// The sign-in is consumed before it is validated, so it can't be completed twice
+	value, err := s.client.GetDel(ctx, stateKey+hashString(state)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, Callback{}, ErrInvalidState
+		}
+		return nil, Callback{}, fmt.Errorf("failed to load sign-in: %w", err)
+	}
+	var signIn SignIn
+	if err := json.Unmarshal(value, &signIn); err != nil {
+		return nil, Callback{}, fmt.Errorf("failed to decode sign-in: %w", err)
+	}
+	if signIn.Provider != provider {
+		return nil, Callback{}, ErrInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(hashString(binding)), []byte(signIn.BindingHash)) != 1 {
+		return nil, Callback{}, fmt.Errorf("%w: sign-in was started in another browser", ErrInvalidState)
+	}
+
+	if params.Has("code") && params.Has("error") {
+		return &signIn, Callback{}, fmt.Errorf("%w: both code and error", ErrInvalidCallback)
+	}
+	return &signIn, Callback{Params: params, Nonce: signIn.Nonce, CodeVerifier: signIn.CodeVerifier}, nil
+}
+
+// hashString returns the hex SHA-256 hash of s, states and bindings are only stored hashed
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,240 @@
+// Package otp issues one-time codes and tokens, e.g. for email verification, password reset,
+// magic links, SMS codes and MFA challenges. Only hashes of the secrets are stored, they are
+// compared in constant time, expire after a TTL, can be used once and are burned after too
+// many wrong attempts.
+package otp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errors returned when verifying a secret
+var (
+	// ErrInvalid is returned when a secret is wrong, expired or was used already
+	ErrInvalid = errors.New("one-time code is invalid or expired")
+
+	// ErrTooManyAttempts is returned once a secret was guessed wrong MaxAttempts times, it can't be used anymore
+	ErrTooManyAttempts = errors.New("too many attempts, request a new one-time code")
+)
+
+// Format is the kind of secret a Manager issues
+type Format int
+
+const (
+	// FormatCode issues short numeric codes that users type in, e.g. sent by SMS or shown in emails
+	// They are verified along with the subject they were issued to.
+	FormatCode Format = iota
+	// FormatToken issues long URL-safe tokens for links, verifying one returns its subject
+	FormatToken
+)
+
+const (
+	defaultTTL         = 15 * time.Minute
+	defaultMaxAttempts = 5
+	defaultCodeLength  = 6
+	maxCodeLength      = 12
+
+	// tokenSelectorBytes and tokenVerifierBytes are the entropy of both parts of tokens
+	tokenSelectorBytes = 12
+	tokenVerifierBytes = 32
+)
+
+// Config configures a Manager
+type Config struct {
+	// Purpose namespaces the secrets, e.g. "email_verification", secrets of one purpose don't verify for another
+	Purpose string
+	Format  Format
+	// TTL is how long secrets can be used, 15 minutes by default
+	TTL time.Duration
+	// MaxAttempts is the number of wrong attempts after which a secret is burned, 5 by default
+	MaxAttempts int
+	// CodeLength is the number of digits of FormatCode secrets, 6 by default
+	CodeLength int
+}
+
+// Record is a stored secret
+type Record struct {
+	Subject string
+	// Hash is the SHA-256 hash of the secret
+	Hash []byte
+	// Attempts counts verifications of the secret, including the current one
+	Attempts int
+}
+
+// Store keeps records until they expire
+type Store interface {
+	// Put stores rec under key until ttl passes, replacing the record the subject had
+	Put(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Attempt counts an attempt at the record under key and returns it, ErrInvalid if there is none
+	Attempt(ctx context.Context, key string) (*Record, error)
+	// Take deletes the record under key if it still has hash, ErrInvalid if it hasn't
+	Take(ctx context.Context, key string, hash []byte) error
+	// Revoke deletes the record of subject, if any
+	Revoke(ctx context.Context, subject string) error
+}
+
+// Manager issues and verifies the secrets of one purpose
+// Issuing a secret revokes the one the subject had, so only the latest secret is valid.
+type Manager struct {
+	store  Store
+	config Config
+}
+
+// New creates a manager keeping secrets in store
+func New(store Store, config Config) *Manager {
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.CodeLength <= 0 || config.CodeLength > maxCodeLength {
+		config.CodeLength = defaultCodeLength
+	}
+	return &Manager{store: store, config: config}
+}
+
+// TTL returns how long issued secrets can be used, e.g. to tell users in emails
+func (m *Manager) TTL() time.Duration {
+	return m.config.TTL
+}
+
+// Issue generates a secret for subject, e.g. a user ID, revoking the one it had
+func (m *Manager) Issue(ctx context.Context, subject string) (string, error) {
+	if subject == "" {
+		return "", errors.New("one-time secrets require a subject")
+	}
+
+	var key, secret string
+	switch m.config.Format {
+	case FormatToken:
+		selector, err := randomString(tokenSelectorBytes)
+		if err != nil {
+			return "", err
+		}
+		verifier, err := randomString(tokenVerifierBytes)
+		if err != nil {
+			return "", err
+		}
+		// The selector looks the record up, so that the verifier can be compared in constant time
+		key, secret = selector, selector+"."+verifier
+	default:
+		code, err := randomCode(m.config.CodeLength)
+		if err != nil {
+			return "", err
+		}
+		key, secret = subject, code
+	}
+
+	rec := Record{Subject: subject, Hash: m.hash(key, secret)}
+	if err := m.store.Put(ctx, key, rec, m.config.TTL); err != nil {
+		return "", fmt.Errorf("failed to store one-time secret: %w", err)
+	}
+	return secret, nil
+}
+
+// VerifyCode checks a FormatCode secret of subject and consumes it if it is right
+func (m *Manager) VerifyCode(ctx context.Context, subject, code string) error {
+	if m.config.Format != FormatCode {
+		return errors.New("VerifyCode requires FormatCode")
+	}
+	if subject == "" || code == "" {
+		return ErrInvalid
+	}
+	_, err := m.verify(ctx, subject, code)
+	return err
+}
+
+// VerifyToken checks a FormatToken secret, consumes it if it is right and returns its subject
+func (m *Manager) VerifyToken(ctx context.Context, token string) (string, error) {
+	if m.config.Format != FormatToken {
+		return "", errors.New("VerifyToken requires FormatToken")
+	}
+	selector, _, ok := strings.Cut(token, ".")
+	if !ok || selector == "" {
+		return "", ErrInvalid
+	}
+	return m.verify(ctx, selector, token)
+}
+
+// Revoke invalidates the secret of subject, e.g. once the action it was issued for is done otherwise
+func (m *Manager) Revoke(ctx context.Context, subject string) error {
+	if err := m.store.Revoke(ctx, subject); err != nil {
+		return fmt.Errorf("failed to revoke one-time secret: %w", err)
+	}
+	return nil
+}
+
+// verify counts an attempt at the record under key before comparing secret, so that guesses
+// are limited even when they are made concurrently, and takes the record if secret is right
+func (m *Manager) verify(ctx context.Context, key, secret string) (string, error) {
+	rec, err := m.store.Attempt(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrInvalid) {
+			return "", ErrInvalid
+		}
+		return "", fmt.Errorf("failed to read one-time secret: %w", err)
+	}
+
+	if rec.Attempts > m.config.MaxAttempts {
+		return "", m.burn(ctx, rec.Subject)
+	}
+	hash := m.hash(key, secret)
+	if subtle.ConstantTimeCompare(hash, rec.Hash) != 1 {
+		if rec.Attempts == m.config.MaxAttempts {
+			return "", m.burn(ctx, rec.Subject)
+		}
+		return "", ErrInvalid
+	}
+
+	if err := m.store.Take(ctx, key, hash); err != nil {
+		if errors.Is(err, ErrInvalid) {
+			// A concurrent verification used it first
+			return "", ErrInvalid
+		}
+		return "", fmt.Errorf("failed to consume one-time secret: %w", err)
+	}
+	return rec.Subject, nil
+}
+
+// burn revokes a secret guessed wrong too many times
+func (m *Manager) burn(ctx context.Context, subject string) error {
+	if err := m.store.Revoke(ctx, subject); err != nil {
+		return fmt.Errorf("failed to revoke one-time secret: %w", err)
+	}
+	return ErrTooManyAttempts
+}
+
+// hash binds a secret to the purpose and key it was issued for
+func (m *Manager) hash(key, secret string) []byte {
+	sum := sha256.Sum256([]byte(m.config.Purpose + "\x00" + key + "\x00" + secret))
+	return sum[:]
+}
+
+// randomCode returns a uniformly distributed code of length digits
+func randomCode(length int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate one-time code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
+
+// randomString returns n random bytes encoded as URL-safe base64
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate one-time token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
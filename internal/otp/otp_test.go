@@ -0,0 +1,198 @@
+package otp_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prperemyshlev/auth-service-2/internal/otp"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestManager(t *testing.T, config otp.Config) (*otp.Manager, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	store := otp.NewRedisStore(&database.Redis{Client: client}, config.Purpose)
+	return otp.New(store, config), server
+}
+
+func TestCodeSingleUse(t *testing.T) {
+	manager, _ := newTestManager(t, otp.Config{Purpose: "mfa", Format: otp.FormatCode})
+	ctx := context.Background()
+
+	code, err := manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue code: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9]{6}$`).MatchString(code) {
+		t.Fatalf("Expected a 6 digit code, got %q", code)
+	}
+
+	if err := manager.VerifyCode(ctx, "user-2", code); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected the code to be bound to its subject, got %v", err)
+	}
+	if err := manager.VerifyCode(ctx, "user-1", code); err != nil {
+		t.Fatalf("Expected the code to verify, got %v", err)
+	}
+	if err := manager.VerifyCode(ctx, "user-1", code); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected the code to be used once, got %v", err)
+	}
+}
+
+func TestCodeReissueRevokesPrevious(t *testing.T) {
+	manager, _ := newTestManager(t, otp.Config{Purpose: "mfa", Format: otp.FormatCode, CodeLength: 8})
+	ctx := context.Background()
+
+	first, err := manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue code: %v", err)
+	}
+	second, err := manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue code: %v", err)
+	}
+	if first != second {
+		if err := manager.VerifyCode(ctx, "user-1", first); !errors.Is(err, otp.ErrInvalid) {
+			t.Errorf("Expected the previous code to be revoked, got %v", err)
+		}
+	}
+	if err := manager.VerifyCode(ctx, "user-1", second); err != nil {
+		t.Errorf("Expected the latest code to verify, got %v", err)
+	}
+}
+
+func TestCodeBurnedAfterMaxAttempts(t *testing.T) {
+	manager, _ := newTestManager(t, otp.Config{Purpose: "sms", Format: otp.FormatCode, MaxAttempts: 3})
+	ctx := context.Background()
+
+	code, err := manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue code: %v", err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := manager.VerifyCode(ctx, "user-1", wrong); !errors.Is(err, otp.ErrInvalid) {
+			t.Fatalf("Expected attempt %d to be invalid, got %v", i+1, err)
+		}
+	}
+	if err := manager.VerifyCode(ctx, "user-1", wrong); !errors.Is(err, otp.ErrTooManyAttempts) {
+		t.Fatalf("Expected the last attempt to burn the code, got %v", err)
+	}
+	if err := manager.VerifyCode(ctx, "user-1", code); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected the burned code to be rejected, got %v", err)
+	}
+}
+
+func TestCodeConcurrentGuessesAreLimited(t *testing.T) {
+	manager, _ := newTestManager(t, otp.Config{Purpose: "sms", Format: otp.FormatCode, MaxAttempts: 5})
+	ctx := context.Background()
+
+	if _, err := manager.Issue(ctx, "user-1"); err != nil {
+		t.Fatalf("Failed to issue code: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	verified := 0
+	for i := 0; i < 1000; i++ {
+		wg.Add(1)
+		go func(guess int) {
+			defer wg.Done()
+			if manager.VerifyCode(ctx, "user-1", formatGuess(guess)) == nil {
+				mu.Lock()
+				verified++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Only the first 5 guesses are compared, so at most one of them can be right
+	if verified > 1 {
+		t.Errorf("Expected at most one guess to verify, got %d", verified)
+	}
+}
+
+func formatGuess(n int) string {
+	const digits = "0123456789"
+	guess := make([]byte, 6)
+	for i := len(guess) - 1; i >= 0; i-- {
+		guess[i] = digits[n%10]
+		n /= 10
+	}
+	return string(guess)
+}
+
+func TestTokenVerifyReturnsSubject(t *testing.T) {
+	manager, _ := newTestManager(t, otp.Config{Purpose: "magic_link", Format: otp.FormatToken})
+	ctx := context.Background()
+
+	token, err := manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	if _, err := manager.VerifyToken(ctx, token+"x"); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected a tampered token to be invalid, got %v", err)
+	}
+	subject, err := manager.VerifyToken(ctx, token)
+	if err != nil || subject != "user-1" {
+		t.Fatalf("Expected the token of user-1, got %q (%v)", subject, err)
+	}
+	if _, err := manager.VerifyToken(ctx, token); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected the token to be used once, got %v", err)
+	}
+	if _, err := manager.VerifyToken(ctx, "no-selector"); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected a malformed token to be invalid, got %v", err)
+	}
+}
+
+func TestTokenRevokeAndExpiry(t *testing.T) {
+	manager, server := newTestManager(t, otp.Config{Purpose: "password_reset", Format: otp.FormatToken, TTL: time.Minute})
+	ctx := context.Background()
+
+	token, err := manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if err := manager.Revoke(ctx, "user-1"); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if _, err := manager.VerifyToken(ctx, token); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected a revoked token to be invalid, got %v", err)
+	}
+
+	token, err = manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	server.FastForward(time.Minute + time.Second)
+	if _, err := manager.VerifyToken(ctx, token); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected an expired token to be invalid, got %v", err)
+	}
+
+	// Secrets of one purpose don't verify for another sharing the store
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	other := otp.New(otp.NewRedisStore(&database.Redis{Client: client}, "password_reset"), otp.Config{Purpose: "magic_link", Format: otp.FormatToken})
+	token, err = manager.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if _, err := other.VerifyToken(ctx, token); !errors.Is(err, otp.ErrInvalid) {
+		t.Errorf("Expected the token not to verify for another purpose, got %v", err)
+	}
+}
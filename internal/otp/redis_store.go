@@ -0,0 +1,141 @@
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// putScript atomically replaces the record of a subject
+//
+// KEYS[1] - record hash
+// KEYS[2] - subject index, holding the record key of the subject
+// ARGV[1] - subject
+// ARGV[2] - secret hash
+// ARGV[3] - TTL in milliseconds
+var putScript = redis.NewScript(`
+local previous = redis.call('GET', KEYS[2])
+if previous then
+	redis.call('DEL', previous)
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'subject', ARGV[1], 'hash', ARGV[2], 'attempts', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('SET', KEYS[2], KEYS[1], 'PX', ARGV[3])
+return 1
+`)
+
+// attemptScript counts an attempt at a record
+//
+// KEYS[1] - record hash
+//
+// Returns {subject, secret hash, attempts}, or nil if there is no record
+var attemptScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return nil
+end
+local attempts = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+local fields = redis.call('HMGET', KEYS[1], 'subject', 'hash')
+return {fields[1], fields[2], attempts}
+`)
+
+// takeScript deletes a record if it still has the secret hash, so it is used once
+//
+// KEYS[1] - record hash
+// ARGV[1] - secret hash
+// ARGV[2] - subject index key prefix
+//
+// Returns 1 if the record was taken, 0 otherwise
+var takeScript = redis.NewScript(`
+local fields = redis.call('HMGET', KEYS[1], 'subject', 'hash')
+if not fields[2] or fields[2] ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+local index = ARGV[2] .. fields[1]
+if redis.call('GET', index) == KEYS[1] then
+	redis.call('DEL', index)
+end
+return 1
+`)
+
+// revokeScript deletes the record of a subject
+//
+// KEYS[1] - subject index
+var revokeScript = redis.NewScript(`
+local record = redis.call('GET', KEYS[1])
+if record then
+	redis.call('DEL', record)
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// redisStore implements Store in Redis, records expire with their TTL
+type redisStore struct {
+	redis  *database.Redis
+	prefix string
+}
+
+// NewRedisStore creates a store keeping the records of purpose in Redis
+// Keys of a purpose share a hash tag, as scripts touch records found through the subject index.
+func NewRedisStore(redis *database.Redis, purpose string) Store {
+	return &redisStore{redis: redis, prefix: "otp:{" + purpose + "}:"}
+}
+
+func (s *redisStore) recordKey(key string) string {
+	return s.prefix + "record:" + key
+}
+
+func (s *redisStore) subjectPrefix() string {
+	return s.prefix + "subject:"
+}
+
+// Put stores rec under key until ttl passes, replacing the record the subject had
+func (s *redisStore) Put(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	keys := []string{s.recordKey(key), s.subjectPrefix() + rec.Subject}
+	if err := putScript.Run(ctx, s.redis.Client, keys, rec.Subject, rec.Hash, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to put record: %w", err)
+	}
+	return nil
+}
+
+// Attempt counts an attempt at the record under key and returns it
+func (s *redisStore) Attempt(ctx context.Context, key string) (*Record, error) {
+	values, err := attemptScript.Run(ctx, s.redis.Client, []string{s.recordKey(key)}).Slice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalid
+		}
+		return nil, fmt.Errorf("failed to count attempt: %w", err)
+	}
+
+	subject, _ := values[0].(string)
+	hash, _ := values[1].(string)
+	attempts, _ := values[2].(int64)
+	return &Record{Subject: subject, Hash: []byte(hash), Attempts: int(attempts)}, nil
+}
+
+// Take deletes the record under key if it still has hash
+func (s *redisStore) Take(ctx context.Context, key string, hash []byte) error {
+	taken, err := takeScript.Run(ctx, s.redis.Client, []string{s.recordKey(key)}, hash, s.subjectPrefix()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to take record: %w", err)
+	}
+	if taken == 0 {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Revoke deletes the record of subject
+func (s *redisStore) Revoke(ctx context.Context, subject string) error {
+	if err := revokeScript.Run(ctx, s.redis.Client, []string{s.subjectPrefix() + subject}).Err(); err != nil {
+		return fmt.Errorf("failed to revoke record: %w", err)
+	}
+	return nil
+}
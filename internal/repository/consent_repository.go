@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// consentRepository implements ConsentRepository interface
+type consentRepository struct {
+	db *database.Postgres
+}
+
+// NewConsentRepository creates a new consent repository
+func NewConsentRepository(db *database.Postgres) ConsentRepository {
+	return &consentRepository{db: db}
+}
+
+// Create records a consent
+func (r *consentRepository) Create(ctx context.Context, consent *domain.Consent) (err error) {
+	ctx, span := tracer.Start(ctx, "ConsentRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO consents (id, user_id, document, version, accepted_at, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	// Generate UUID if not provided
+	if consent.ID == "" {
+		consent.ID = uuid.New().String()
+	}
+
+	if consent.AcceptedAt.IsZero() {
+		consent.AcceptedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query,
+		consent.ID,
+		consent.UserID,
+		consent.Document,
+		consent.Version,
+		consent.AcceptedAt,
+		consent.IPAddress,
+	)
+
+	if err != nil {
+		// Check for unique constraint violation (same version accepted twice)
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return fmt.Errorf("consent to %s version %s already exists: %w", consent.Document, consent.Version, ErrDuplicateConsent)
+			}
+		}
+		return fmt.Errorf("failed to create consent: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUserID retrieves the consents of a user, oldest first
+func (r *consentRepository) ListByUserID(ctx context.Context, userID string) (_ []*domain.Consent, err error) {
+	ctx, span := tracer.Start(ctx, "ConsentRepository.ListByUserID")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT id, user_id, document, version, accepted_at, ip_address
+		FROM consents
+		WHERE user_id = $1
+		ORDER BY accepted_at
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+	defer rows.Close()
+
+	var consents []*domain.Consent
+	for rows.Next() {
+		consent := &domain.Consent{}
+		var ipAddress sql.NullString
+
+		err := rows.Scan(
+			&consent.ID,
+			&consent.UserID,
+			&consent.Document,
+			&consent.Version,
+			&consent.AcceptedAt,
+			&ipAddress,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan consent: %w", err)
+		}
+
+		if ipAddress.Valid {
+			consent.IPAddress = &ipAddress.String
+		}
+
+		consents = append(consents, consent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate consents: %w", err)
+	}
+
+	return consents, nil
+}
+
+// DeleteByUserID deletes all consents of a user
+func (r *consentRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "ConsentRepository.DeleteByUserID")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM consents WHERE user_id = $1`
+
+	if _, err := r.db.DB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete consents: %w", err)
+	}
+
+	return nil
+}
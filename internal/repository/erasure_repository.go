@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// erasureRepository implements ErasureRepository interface
+type erasureRepository struct {
+	db *database.Postgres
+}
+
+// NewErasureRepository creates a new erasure repository
+func NewErasureRepository(db *database.Postgres) ErasureRepository {
+	return &erasureRepository{db: db}
+}
+
+// Create creates a new erasure
+func (r *erasureRepository) Create(ctx context.Context, erasure *domain.Erasure) (err error) {
+	ctx, span := tracer.Start(ctx, "ErasureRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO user_erasures (id, user_id, email_hash, requested_by, mode, requested_at, erase_after, erased_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	// Generate UUID if not provided
+	if erasure.ID == "" {
+		erasure.ID = uuid.New().String()
+	}
+
+	if erasure.RequestedAt.IsZero() {
+		erasure.RequestedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query,
+		erasure.ID,
+		erasure.UserID,
+		erasure.EmailHash,
+		erasure.RequestedBy,
+		erasure.Mode,
+		erasure.RequestedAt,
+		erasure.EraseAfter,
+		erasure.ErasedAt,
+	)
+
+	if err != nil {
+		// Check for unique constraint violation (duplicate user_id)
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return fmt.Errorf("erasure for user %s already exists: %w", erasure.UserID, ErrDuplicateErasure)
+			}
+		}
+		return fmt.Errorf("failed to create erasure: %w", err)
+	}
+
+	return nil
+}
+
+// GetByUserID retrieves the erasure of a user
+func (r *erasureRepository) GetByUserID(ctx context.Context, userID string) (_ *domain.Erasure, err error) {
+	ctx, span := tracer.Start(ctx, "ErasureRepository.GetByUserID")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT id, user_id, email_hash, requested_by, mode, requested_at, erase_after, erased_at
+		FROM user_erasures
+		WHERE user_id = $1
+	`
+
+	erasure, err := scanErasure(r.db.DB.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("erasure for user %s not found: %w", userID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get erasure by user id: %w", err)
+	}
+
+	return erasure, nil
+}
+
+// ListDue retrieves pending erasures due at the given time, earliest first
+func (r *erasureRepository) ListDue(ctx context.Context, now time.Time, limit int) (_ []*domain.Erasure, err error) {
+	ctx, span := tracer.Start(ctx, "ErasureRepository.ListDue")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT id, user_id, email_hash, requested_by, mode, requested_at, erase_after, erased_at
+		FROM user_erasures
+		WHERE erased_at IS NULL AND erase_after <= $1
+		ORDER BY erase_after
+		LIMIT $2
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due erasures: %w", err)
+	}
+	defer rows.Close()
+
+	var erasures []*domain.Erasure
+	for rows.Next() {
+		erasure, err := scanErasure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan erasure: %w", err)
+		}
+		erasures = append(erasures, erasure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate erasures: %w", err)
+	}
+
+	return erasures, nil
+}
+
+// MarkErased records that a pending erasure was carried out
+func (r *erasureRepository) MarkErased(ctx context.Context, id string, erasedAt time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "ErasureRepository.MarkErased")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE user_erasures SET erased_at = $1 WHERE id = $2 AND erased_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, erasedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark erasure as erased: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("pending erasure with id %s not found: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// DeletePending deletes an erasure that wasn't carried out yet
+func (r *erasureRepository) DeletePending(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "ErasureRepository.DeletePending")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM user_erasures WHERE id = $1 AND erased_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete erasure: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("pending erasure with id %s not found: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanErasure scans an erasure from a row of the columns selected above
+func scanErasure(row interface{ Scan(dest ...any) error }) (*domain.Erasure, error) {
+	erasure := &domain.Erasure{}
+	var erasedAt sql.NullTime
+
+	err := row.Scan(
+		&erasure.ID,
+		&erasure.UserID,
+		&erasure.EmailHash,
+		&erasure.RequestedBy,
+		&erasure.Mode,
+		&erasure.RequestedAt,
+		&erasure.EraseAfter,
+		&erasedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if erasedAt.Valid {
+		erasure.ErasedAt = &erasedAt.Time
+	}
+
+	return erasure, nil
+}
@@ -10,9 +10,30 @@ var (
 	// ErrDuplicateEmail is returned when trying to create a user with an existing email
 	ErrDuplicateEmail = errors.New("user with this email already exists")
 
+	// ErrDuplicateUsername is returned when trying to save a user with a taken username
+	ErrDuplicateUsername = errors.New("user with this username already exists")
+
 	// ErrDuplicateToken is returned when trying to create a token with an existing hash
 	ErrDuplicateToken = errors.New("token with this hash already exists")
 
 	// ErrDuplicateOAuthProvider is returned when trying to create a duplicate OAuth provider connection
 	ErrDuplicateOAuthProvider = errors.New("oauth provider connection already exists")
+
+	// ErrDuplicateIPRule is returned when trying to create a rule for an existing CIDR
+	ErrDuplicateIPRule = errors.New("ip rule for this cidr already exists")
+
+	// ErrDuplicateConsent is returned when a user accepts the same version of a document twice
+	ErrDuplicateConsent = errors.New("consent to this version already exists")
+
+	// ErrDuplicateIdentity is returned when trying to link an identity that is linked already
+	ErrDuplicateIdentity = errors.New("identity is already linked")
+
+	// ErrDuplicateInvitation is returned when trying to create an invitation with an existing token hash
+	ErrDuplicateInvitation = errors.New("invitation with this token already exists")
+
+	// ErrDuplicateMembership is returned when adding a user to an organization twice
+	ErrDuplicateMembership = errors.New("user is already a member of this organization")
+
+	// ErrDuplicateErasure is returned when trying to create a second erasure for a user
+	ErrDuplicateErasure = errors.New("erasure for this user already exists")
 )
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// identityRepository implements IdentityRepository interface
+type identityRepository struct {
+	db *database.Postgres
+}
+
+// NewIdentityRepository creates a new identity repository
+func NewIdentityRepository(db *database.Postgres) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+// Create links an identity to a user
+func (r *identityRepository) Create(ctx context.Context, identity *domain.Identity) (err error) {
+	ctx, span := tracer.Start(ctx, "IdentityRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO identities (id, user_id, type, subject, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	// Generate UUID if not provided
+	if identity.ID == "" {
+		identity.ID = uuid.New().String()
+	}
+
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query,
+		identity.ID,
+		identity.UserID,
+		identity.Type,
+		identity.Subject,
+		identity.CreatedAt,
+	)
+
+	if err != nil {
+		// Check for unique constraint violation (identity linked to another user)
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return fmt.Errorf("%s identity %s already exists: %w", identity.Type, identity.Subject, ErrDuplicateIdentity)
+			}
+		}
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// GetBySubject retrieves an identity by type and subject
+func (r *identityRepository) GetBySubject(ctx context.Context, identityType, subject string) (_ *domain.Identity, err error) {
+	ctx, span := tracer.Start(ctx, "IdentityRepository.GetBySubject")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT id, user_id, type, subject, created_at
+		FROM identities
+		WHERE type = $1 AND subject = $2
+	`
+
+	identity := &domain.Identity{}
+	err = r.db.DB.QueryRowContext(ctx, query, identityType, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Type,
+		&identity.Subject,
+		&identity.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("identity not found: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// ListByUserID retrieves the identities of a user, oldest first
+func (r *identityRepository) ListByUserID(ctx context.Context, userID string) (_ []*domain.Identity, err error) {
+	ctx, span := tracer.Start(ctx, "IdentityRepository.ListByUserID")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT id, user_id, type, subject, created_at
+		FROM identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*domain.Identity
+	for rows.Next() {
+		identity := &domain.Identity{}
+
+		err := rows.Scan(
+			&identity.ID,
+			&identity.UserID,
+			&identity.Type,
+			&identity.Subject,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// DeleteByUserID deletes all identities of a user
+func (r *identityRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "IdentityRepository.DeleteByUserID")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM identities WHERE user_id = $1`
+
+	if _, err := r.db.DB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete identities: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,503 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// operationDuration records the duration of repository operations, exported as
+// repository_operation_duration_seconds
+var operationDuration metric.Float64Histogram
+
+func init() {
+	var err error
+	meter := otel.Meter("github.com/prperemyshlev/auth-service-2/internal/repository")
+	if operationDuration, err = meter.Float64Histogram("repository.operation.duration",
+		metric.WithDescription("Duration of repository operations, by operation"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create repository operation duration histogram: %w", err))
+	}
+}
+
+// Instrument wraps every repository of repos, whatever the storage, so that operations are timed in
+// repository.operation.duration and those slower than threshold are logged with their parameters.
+// Emails are masked and secrets like token hashes are fingerprinted; 0 disables the logging.
+func Instrument(repos *Repositories, logger *zap.Logger, threshold time.Duration) *Repositories {
+	i := &instrumentation{logger: logger, threshold: threshold}
+	return &Repositories{
+		User:          &instrumentedUserRepository{next: repos.User, i: i},
+		Token:         &instrumentedTokenRepository{next: repos.Token, i: i},
+		OAuthProvider: &instrumentedOAuthProviderRepository{next: repos.OAuthProvider, i: i},
+		IPRule:        &instrumentedIPRuleRepository{next: repos.IPRule, i: i},
+		Erasure:       &instrumentedErasureRepository{next: repos.Erasure, i: i},
+		Consent:       &instrumentedConsentRepository{next: repos.Consent, i: i},
+		Identity:      &instrumentedIdentityRepository{next: repos.Identity, i: i},
+		Invitation:    &instrumentedInvitationRepository{next: repos.Invitation, i: i},
+		Organization:  &instrumentedOrganizationRepository{next: repos.Organization, i: i},
+		Tenant:        &instrumentedTenantRepository{next: repos.Tenant, i: i},
+		Stats:         &instrumentedStatsRepository{next: repos.Stats, i: i},
+		UserFlags:     &instrumentedUserFlagsRepository{next: repos.UserFlags, i: i},
+	}
+}
+
+type instrumentation struct {
+	logger    *zap.Logger
+	threshold time.Duration
+}
+
+// observe records an operation started at start, it is deferred with the sanitized parameters
+func (i *instrumentation) observe(ctx context.Context, operation string, start time.Time, err *error, params ...zap.Field) {
+	elapsed := time.Since(start)
+	if operationDuration != nil {
+		operationDuration.Record(context.WithoutCancel(ctx), elapsed.Seconds(), metric.WithAttributes(attribute.String("operation", operation)))
+	}
+	if i.threshold <= 0 || elapsed < i.threshold {
+		return
+	}
+
+	fields := append([]zap.Field{zap.String("operation", operation), zap.Duration("duration", elapsed)}, params...)
+	if *err != nil {
+		fields = append(fields, zap.Error(*err))
+	}
+	observability.LoggerWithContext(ctx, i.logger).Warn("Slow repository operation", fields...)
+}
+
+type instrumentedUserRepository struct {
+	next UserRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedUserRepository) Create(ctx context.Context, user *domain.User) (err error) {
+	defer r.i.observe(ctx, "UserRepository.Create", time.Now(), &err, observability.Email("email", user.Email))
+	return r.next.Create(ctx, user)
+}
+
+func (r *instrumentedUserRepository) GetByEmail(ctx context.Context, email string) (_ *domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.GetByEmail", time.Now(), &err, observability.Email("email", email))
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *instrumentedUserRepository) GetByID(ctx context.Context, id string) (_ *domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.GetByID", time.Now(), &err, zap.String("user_id", id))
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *instrumentedUserRepository) GetByUsername(ctx context.Context, username string) (_ *domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.GetByUsername", time.Now(), &err, observability.Token("username", username))
+	return r.next.GetByUsername(ctx, username)
+}
+
+func (r *instrumentedUserRepository) Update(ctx context.Context, user *domain.User) (err error) {
+	defer r.i.observe(ctx, "UserRepository.Update", time.Now(), &err, zap.String("user_id", user.ID))
+	return r.next.Update(ctx, user)
+}
+
+func (r *instrumentedUserRepository) SearchByEmail(ctx context.Context, query string, limit int) (_ []*domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.SearchByEmail", time.Now(), &err, observability.Email("query", query), zap.Int("limit", limit))
+	return r.next.SearchByEmail(ctx, query, limit)
+}
+
+func (r *instrumentedUserRepository) UpdateLastLogin(ctx context.Context, userID, ip string) (err error) {
+	defer r.i.observe(ctx, "UserRepository.UpdateLastLogin", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.UpdateLastLogin(ctx, userID, ip)
+}
+
+func (r *instrumentedUserRepository) SetRestriction(ctx context.Context, userID, restriction string) (err error) {
+	defer r.i.observe(ctx, "UserRepository.SetRestriction", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.SetRestriction(ctx, userID, restriction)
+}
+
+func (r *instrumentedUserRepository) ListAfter(ctx context.Context, afterID string, limit int) (_ []*domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.ListAfter", time.Now(), &err, zap.Int("limit", limit))
+	return r.next.ListAfter(ctx, afterID, limit)
+}
+
+func (r *instrumentedUserRepository) SetEmailNormalized(ctx context.Context, userID, emailNormalized string) (err error) {
+	defer r.i.observe(ctx, "UserRepository.SetEmailNormalized", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.SetEmailNormalized(ctx, userID, emailNormalized)
+}
+
+func (r *instrumentedUserRepository) ListUnverifiedToWarn(ctx context.Context, createdBefore time.Time, limit int) (_ []*domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.ListUnverifiedToWarn", time.Now(), &err, zap.Int("limit", limit))
+	return r.next.ListUnverifiedToWarn(ctx, createdBefore, limit)
+}
+
+func (r *instrumentedUserRepository) ListUnverifiedWarnedBefore(ctx context.Context, warnedBefore time.Time, limit int) (_ []*domain.User, err error) {
+	defer r.i.observe(ctx, "UserRepository.ListUnverifiedWarnedBefore", time.Now(), &err, zap.Int("limit", limit))
+	return r.next.ListUnverifiedWarnedBefore(ctx, warnedBefore, limit)
+}
+
+func (r *instrumentedUserRepository) MarkUnverifiedWarned(ctx context.Context, userID string, at time.Time) (err error) {
+	defer r.i.observe(ctx, "UserRepository.MarkUnverifiedWarned", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.MarkUnverifiedWarned(ctx, userID, at)
+}
+
+func (r *instrumentedUserRepository) Delete(ctx context.Context, id string) (err error) {
+	defer r.i.observe(ctx, "UserRepository.Delete", time.Now(), &err, zap.String("user_id", id))
+	return r.next.Delete(ctx, id)
+}
+
+type instrumentedTokenRepository struct {
+	next TokenRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedTokenRepository) Create(ctx context.Context, token *domain.RefreshToken) (err error) {
+	defer r.i.observe(ctx, "TokenRepository.Create", time.Now(), &err, zap.String("user_id", token.UserID))
+	return r.next.Create(ctx, token)
+}
+
+func (r *instrumentedTokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (_ *domain.RefreshToken, err error) {
+	defer r.i.observe(ctx, "TokenRepository.GetByTokenHash", time.Now(), &err, observability.Token("token_hash", tokenHash))
+	return r.next.GetByTokenHash(ctx, tokenHash)
+}
+
+func (r *instrumentedTokenRepository) GetByUserID(ctx context.Context, userID string) (_ []*domain.RefreshToken, err error) {
+	defer r.i.observe(ctx, "TokenRepository.GetByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.GetByUserID(ctx, userID)
+}
+
+func (r *instrumentedTokenRepository) Revoke(ctx context.Context, tokenID, reason string) (err error) {
+	defer r.i.observe(ctx, "TokenRepository.Revoke", time.Now(), &err, zap.String("token_id", tokenID), zap.String("reason", reason))
+	return r.next.Revoke(ctx, tokenID, reason)
+}
+
+func (r *instrumentedTokenRepository) RevokeByTokenHash(ctx context.Context, tokenHash, reason string) (err error) {
+	defer r.i.observe(ctx, "TokenRepository.RevokeByTokenHash", time.Now(), &err, observability.Token("token_hash", tokenHash), zap.String("reason", reason))
+	return r.next.RevokeByTokenHash(ctx, tokenHash, reason)
+}
+
+func (r *instrumentedTokenRepository) Rotate(ctx context.Context, tokenHash string, next *domain.RefreshToken) (err error) {
+	defer r.i.observe(ctx, "TokenRepository.Rotate", time.Now(), &err, observability.Token("token_hash", tokenHash), zap.String("user_id", next.UserID))
+	return r.next.Rotate(ctx, tokenHash, next)
+}
+
+func (r *instrumentedTokenRepository) RevokeIssuedBefore(ctx context.Context, userID string, before time.Time, reason string) (_ int64, err error) {
+	defer r.i.observe(ctx, "TokenRepository.RevokeIssuedBefore", time.Now(), &err, zap.String("user_id", userID), zap.Time("before", before), zap.String("reason", reason))
+	return r.next.RevokeIssuedBefore(ctx, userID, before, reason)
+}
+
+func (r *instrumentedTokenRepository) Purge(ctx context.Context, before time.Time) (_ int64, err error) {
+	defer r.i.observe(ctx, "TokenRepository.Purge", time.Now(), &err, zap.Time("before", before))
+	return r.next.Purge(ctx, before)
+}
+
+type instrumentedOAuthProviderRepository struct {
+	next OAuthProviderRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedOAuthProviderRepository) Create(ctx context.Context, provider *domain.OAuthProvider) (err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.Create", time.Now(), &err, zap.String("user_id", provider.UserID), zap.String("provider", provider.Provider))
+	return r.next.Create(ctx, provider)
+}
+
+func (r *instrumentedOAuthProviderRepository) GetByProvider(ctx context.Context, provider, providerUserID string) (_ *domain.OAuthProvider, err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.GetByProvider", time.Now(), &err, zap.String("provider", provider), observability.Token("provider_user_id", providerUserID))
+	return r.next.GetByProvider(ctx, provider, providerUserID)
+}
+
+func (r *instrumentedOAuthProviderRepository) GetByUserID(ctx context.Context, userID string) (_ []*domain.OAuthProvider, err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.GetByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.GetByUserID(ctx, userID)
+}
+
+func (r *instrumentedOAuthProviderRepository) ListByProviderUserID(ctx context.Context, providerUserID string) (_ []*domain.OAuthProvider, err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.ListByProviderUserID", time.Now(), &err, observability.Token("provider_user_id", providerUserID))
+	return r.next.ListByProviderUserID(ctx, providerUserID)
+}
+
+func (r *instrumentedOAuthProviderRepository) UpdateTokens(ctx context.Context, provider *domain.OAuthProvider) (err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.UpdateTokens", time.Now(), &err, zap.String("provider_id", provider.ID))
+	return r.next.UpdateTokens(ctx, provider)
+}
+
+func (r *instrumentedOAuthProviderRepository) ListStaleTokens(ctx context.Context, keyPrefix string, limit int) (_ []*domain.OAuthProvider, err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.ListStaleTokens", time.Now(), &err, zap.Int("limit", limit))
+	return r.next.ListStaleTokens(ctx, keyPrefix, limit)
+}
+
+func (r *instrumentedOAuthProviderRepository) Delete(ctx context.Context, providerID string) (err error) {
+	defer r.i.observe(ctx, "OAuthProviderRepository.Delete", time.Now(), &err, zap.String("provider_id", providerID))
+	return r.next.Delete(ctx, providerID)
+}
+
+type instrumentedIPRuleRepository struct {
+	next IPRuleRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedIPRuleRepository) Create(ctx context.Context, rule *domain.IPRule) (err error) {
+	defer r.i.observe(ctx, "IPRuleRepository.Create", time.Now(), &err, zap.String("cidr", rule.CIDR))
+	return r.next.Create(ctx, rule)
+}
+
+func (r *instrumentedIPRuleRepository) List(ctx context.Context) (_ []*domain.IPRule, err error) {
+	defer r.i.observe(ctx, "IPRuleRepository.List", time.Now(), &err)
+	return r.next.List(ctx)
+}
+
+func (r *instrumentedIPRuleRepository) Delete(ctx context.Context, ruleID string) (err error) {
+	defer r.i.observe(ctx, "IPRuleRepository.Delete", time.Now(), &err, zap.String("rule_id", ruleID))
+	return r.next.Delete(ctx, ruleID)
+}
+
+type instrumentedErasureRepository struct {
+	next ErasureRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedErasureRepository) Create(ctx context.Context, erasure *domain.Erasure) (err error) {
+	defer r.i.observe(ctx, "ErasureRepository.Create", time.Now(), &err, zap.String("user_id", erasure.UserID))
+	return r.next.Create(ctx, erasure)
+}
+
+func (r *instrumentedErasureRepository) GetByUserID(ctx context.Context, userID string) (_ *domain.Erasure, err error) {
+	defer r.i.observe(ctx, "ErasureRepository.GetByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.GetByUserID(ctx, userID)
+}
+
+func (r *instrumentedErasureRepository) ListDue(ctx context.Context, now time.Time, limit int) (_ []*domain.Erasure, err error) {
+	defer r.i.observe(ctx, "ErasureRepository.ListDue", time.Now(), &err, zap.Time("now", now), zap.Int("limit", limit))
+	return r.next.ListDue(ctx, now, limit)
+}
+
+func (r *instrumentedErasureRepository) MarkErased(ctx context.Context, id string, erasedAt time.Time) (err error) {
+	defer r.i.observe(ctx, "ErasureRepository.MarkErased", time.Now(), &err, zap.String("erasure_id", id))
+	return r.next.MarkErased(ctx, id, erasedAt)
+}
+
+func (r *instrumentedErasureRepository) DeletePending(ctx context.Context, id string) (err error) {
+	defer r.i.observe(ctx, "ErasureRepository.DeletePending", time.Now(), &err, zap.String("erasure_id", id))
+	return r.next.DeletePending(ctx, id)
+}
+
+type instrumentedConsentRepository struct {
+	next ConsentRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedConsentRepository) Create(ctx context.Context, consent *domain.Consent) (err error) {
+	defer r.i.observe(ctx, "ConsentRepository.Create", time.Now(), &err, zap.String("user_id", consent.UserID), zap.String("document", consent.Document))
+	return r.next.Create(ctx, consent)
+}
+
+func (r *instrumentedConsentRepository) ListByUserID(ctx context.Context, userID string) (_ []*domain.Consent, err error) {
+	defer r.i.observe(ctx, "ConsentRepository.ListByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.ListByUserID(ctx, userID)
+}
+
+func (r *instrumentedConsentRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	defer r.i.observe(ctx, "ConsentRepository.DeleteByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.DeleteByUserID(ctx, userID)
+}
+
+type instrumentedIdentityRepository struct {
+	next IdentityRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedIdentityRepository) Create(ctx context.Context, identity *domain.Identity) (err error) {
+	defer r.i.observe(ctx, "IdentityRepository.Create", time.Now(), &err, zap.String("user_id", identity.UserID), zap.String("type", identity.Type))
+	return r.next.Create(ctx, identity)
+}
+
+func (r *instrumentedIdentityRepository) GetBySubject(ctx context.Context, identityType, subject string) (_ *domain.Identity, err error) {
+	defer r.i.observe(ctx, "IdentityRepository.GetBySubject", time.Now(), &err, zap.String("type", identityType), zap.String("subject", subject))
+	return r.next.GetBySubject(ctx, identityType, subject)
+}
+
+func (r *instrumentedIdentityRepository) ListByUserID(ctx context.Context, userID string) (_ []*domain.Identity, err error) {
+	defer r.i.observe(ctx, "IdentityRepository.ListByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.ListByUserID(ctx, userID)
+}
+
+func (r *instrumentedIdentityRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	defer r.i.observe(ctx, "IdentityRepository.DeleteByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.DeleteByUserID(ctx, userID)
+}
+
+type instrumentedInvitationRepository struct {
+	next InvitationRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedInvitationRepository) Create(ctx context.Context, invitation *domain.Invitation) (err error) {
+	defer r.i.observe(ctx, "InvitationRepository.Create", time.Now(), &err, observability.Email("email", invitation.Email))
+	return r.next.Create(ctx, invitation)
+}
+
+func (r *instrumentedInvitationRepository) GetByID(ctx context.Context, id string) (_ *domain.Invitation, err error) {
+	defer r.i.observe(ctx, "InvitationRepository.GetByID", time.Now(), &err, zap.String("invitation_id", id))
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *instrumentedInvitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (_ *domain.Invitation, err error) {
+	defer r.i.observe(ctx, "InvitationRepository.GetByTokenHash", time.Now(), &err, observability.Token("token_hash", tokenHash))
+	return r.next.GetByTokenHash(ctx, tokenHash)
+}
+
+func (r *instrumentedInvitationRepository) List(ctx context.Context, invitedBy string) (_ []*domain.Invitation, err error) {
+	defer r.i.observe(ctx, "InvitationRepository.List", time.Now(), &err, zap.String("invited_by", invitedBy))
+	return r.next.List(ctx, invitedBy)
+}
+
+func (r *instrumentedInvitationRepository) MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) (err error) {
+	defer r.i.observe(ctx, "InvitationRepository.MarkAccepted", time.Now(), &err, zap.String("invitation_id", id), zap.String("user_id", userID))
+	return r.next.MarkAccepted(ctx, id, userID, acceptedAt)
+}
+
+func (r *instrumentedInvitationRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) (err error) {
+	defer r.i.observe(ctx, "InvitationRepository.Revoke", time.Now(), &err, zap.String("invitation_id", id))
+	return r.next.Revoke(ctx, id, revokedAt)
+}
+
+func (r *instrumentedInvitationRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	defer r.i.observe(ctx, "InvitationRepository.DeleteByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.DeleteByUserID(ctx, userID)
+}
+
+type instrumentedOrganizationRepository struct {
+	next OrganizationRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedOrganizationRepository) Create(ctx context.Context, org *domain.Organization) (err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.Create", time.Now(), &err, zap.String("name", org.Name))
+	return r.next.Create(ctx, org)
+}
+
+func (r *instrumentedOrganizationRepository) GetByID(ctx context.Context, id string) (_ *domain.Organization, err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.GetByID", time.Now(), &err, zap.String("org_id", id))
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *instrumentedOrganizationRepository) Delete(ctx context.Context, id string) (err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.Delete", time.Now(), &err, zap.String("org_id", id))
+	return r.next.Delete(ctx, id)
+}
+
+func (r *instrumentedOrganizationRepository) AddMember(ctx context.Context, membership *domain.Membership) (err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.AddMember", time.Now(), &err, zap.String("org_id", membership.OrgID), zap.String("user_id", membership.UserID))
+	return r.next.AddMember(ctx, membership)
+}
+
+func (r *instrumentedOrganizationRepository) GetMember(ctx context.Context, orgID, userID string) (_ *domain.Membership, err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.GetMember", time.Now(), &err, zap.String("org_id", orgID), zap.String("user_id", userID))
+	return r.next.GetMember(ctx, orgID, userID)
+}
+
+func (r *instrumentedOrganizationRepository) ListMembers(ctx context.Context, orgID string) (_ []*domain.Membership, err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.ListMembers", time.Now(), &err, zap.String("org_id", orgID))
+	return r.next.ListMembers(ctx, orgID)
+}
+
+func (r *instrumentedOrganizationRepository) ListMemberships(ctx context.Context, userID string) (_ []*domain.Membership, err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.ListMemberships", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.ListMemberships(ctx, userID)
+}
+
+func (r *instrumentedOrganizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID, role string) (err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.UpdateMemberRole", time.Now(), &err, zap.String("org_id", orgID), zap.String("user_id", userID), zap.String("role", role))
+	return r.next.UpdateMemberRole(ctx, orgID, userID, role)
+}
+
+func (r *instrumentedOrganizationRepository) RemoveMember(ctx context.Context, orgID, userID string) (err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.RemoveMember", time.Now(), &err, zap.String("org_id", orgID), zap.String("user_id", userID))
+	return r.next.RemoveMember(ctx, orgID, userID)
+}
+
+func (r *instrumentedOrganizationRepository) DeleteMemberships(ctx context.Context, userID string) (err error) {
+	defer r.i.observe(ctx, "OrganizationRepository.DeleteMemberships", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.DeleteMemberships(ctx, userID)
+}
+
+type instrumentedTenantRepository struct {
+	next TenantRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedTenantRepository) Save(ctx context.Context, tenant *domain.Tenant) (err error) {
+	defer r.i.observe(ctx, "TenantRepository.Save", time.Now(), &err, zap.String("tenant_id", tenant.ID))
+	return r.next.Save(ctx, tenant)
+}
+
+func (r *instrumentedTenantRepository) GetByID(ctx context.Context, id string) (_ *domain.Tenant, err error) {
+	defer r.i.observe(ctx, "TenantRepository.GetByID", time.Now(), &err, zap.String("tenant_id", id))
+	return r.next.GetByID(ctx, id)
+}
+
+func (r *instrumentedTenantRepository) List(ctx context.Context) (_ []*domain.Tenant, err error) {
+	defer r.i.observe(ctx, "TenantRepository.List", time.Now(), &err)
+	return r.next.List(ctx)
+}
+
+func (r *instrumentedTenantRepository) Delete(ctx context.Context, id string) (err error) {
+	defer r.i.observe(ctx, "TenantRepository.Delete", time.Now(), &err, zap.String("tenant_id", id))
+	return r.next.Delete(ctx, id)
+}
+
+type instrumentedStatsRepository struct {
+	next StatsRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedStatsRepository) CountUsers(ctx context.Context) (_ *domain.UserCounts, err error) {
+	defer r.i.observe(ctx, "StatsRepository.CountUsers", time.Now(), &err)
+	return r.next.CountUsers(ctx)
+}
+
+func (r *instrumentedStatsRepository) CountActiveUsers(ctx context.Context, since time.Time) (_ int64, err error) {
+	defer r.i.observe(ctx, "StatsRepository.CountActiveUsers", time.Now(), &err, zap.Time("since", since))
+	return r.next.CountActiveUsers(ctx, since)
+}
+
+func (r *instrumentedStatsRepository) CountActiveSessions(ctx context.Context, now time.Time) (_ int64, err error) {
+	defer r.i.observe(ctx, "StatsRepository.CountActiveSessions", time.Now(), &err, zap.Time("now", now))
+	return r.next.CountActiveSessions(ctx, now)
+}
+
+func (r *instrumentedStatsRepository) DailyRegistrations(ctx context.Context, since time.Time) (_ []domain.DailyCount, err error) {
+	defer r.i.observe(ctx, "StatsRepository.DailyRegistrations", time.Now(), &err, zap.Time("since", since))
+	return r.next.DailyRegistrations(ctx, since)
+}
+
+type instrumentedUserFlagsRepository struct {
+	next UserFlagsRepository
+	i    *instrumentation
+}
+
+func (r *instrumentedUserFlagsRepository) Get(ctx context.Context, userID string) (_ *domain.UserFlags, err error) {
+	defer r.i.observe(ctx, "UserFlagsRepository.Get", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.Get(ctx, userID)
+}
+
+func (r *instrumentedUserFlagsRepository) ListByUserIDs(ctx context.Context, userIDs []string) (_ []*domain.UserFlags, err error) {
+	defer r.i.observe(ctx, "UserFlagsRepository.ListByUserIDs", time.Now(), &err, zap.Int("users", len(userIDs)))
+	return r.next.ListByUserIDs(ctx, userIDs)
+}
+
+func (r *instrumentedUserFlagsRepository) ListByFlag(ctx context.Context, flag string, limit int) (_ []*domain.UserFlags, err error) {
+	defer r.i.observe(ctx, "UserFlagsRepository.ListByFlag", time.Now(), &err, zap.String("flag", flag), zap.Int("limit", limit))
+	return r.next.ListByFlag(ctx, flag, limit)
+}
+
+func (r *instrumentedUserFlagsRepository) Save(ctx context.Context, flags *domain.UserFlags) (err error) {
+	defer r.i.observe(ctx, "UserFlagsRepository.Save", time.Now(), &err, zap.String("user_id", flags.UserID))
+	return r.next.Save(ctx, flags)
+}
+
+func (r *instrumentedUserFlagsRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	defer r.i.observe(ctx, "UserFlagsRepository.DeleteByUserID", time.Now(), &err, zap.String("user_id", userID))
+	return r.next.DeleteByUserID(ctx, userID)
+}
@@ -0,0 +1,53 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/memory"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestInstrumentLogsSlowOperations(t *testing.T) {
+	ctx := context.Background()
+	core, logs := observer.New(zap.WarnLevel)
+	repos := repository.Instrument(memory.NewRepositories(), zap.New(core), time.Nanosecond)
+
+	if err := repos.User.Create(ctx, &domain.User{Email: "alice@example.com", EmailNormalized: "alice@example.com"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if _, err := repos.Token.GetByTokenHash(ctx, "secret-hash"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	entries := logs.FilterMessage("Slow repository operation").AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 slow operations, got %d", len(entries))
+	}
+
+	created := entries[0].ContextMap()
+	if created["operation"] != "UserRepository.Create" || created["email"] != "a***@example.com" {
+		t.Errorf("Expected the create with a masked email, got %+v", created)
+	}
+	lookup := entries[1].ContextMap()
+	if lookup["operation"] != "TokenRepository.GetByTokenHash" || lookup["token_hash"] == "secret-hash" || lookup["error"] == nil {
+		t.Errorf("Expected the lookup with a fingerprinted hash and its error, got %+v", lookup)
+	}
+}
+
+func TestInstrumentWithoutThreshold(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	repos := repository.Instrument(memory.NewRepositories(), zap.New(core), 0)
+
+	if _, err := repos.IPRule.List(context.Background()); err != nil {
+		t.Fatalf("Failed to list IP rules: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected no logs without threshold, got %d", logs.Len())
+	}
+}
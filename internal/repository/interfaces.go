@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/prperemyshlev/auth-service-2/internal/domain"
 )
@@ -9,20 +10,56 @@ import (
 // UserRepository defines methods for user operations
 type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
+	// GetByEmail looks up a user by the normalized form of the email
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	GetByID(ctx context.Context, id string) (*domain.User, error)
+	GetByUsername(ctx context.Context, username string) (*domain.User, error)
 	Update(ctx context.Context, user *domain.User) error
-	UpdateLastLogin(ctx context.Context, userID string) error
+	// SearchByEmail returns up to limit users whose email contains query, ignoring case, ordered by email
+	SearchByEmail(ctx context.Context, query string, limit int) ([]*domain.User, error)
+	// UpdateLastLogin records a login from ip, an empty ip when unknown. The last login becomes
+	// the previous one and the login count is incremented.
+	UpdateLastLogin(ctx context.Context, userID, ip string) error
+	// SetRestriction sets the restriction level of a user, Update leaves it unchanged so that
+	// profile changes can't lift a restriction set meanwhile
+	SetRestriction(ctx context.Context, userID, restriction string) error
+	// ListAfter returns up to limit users whose ID sorts after afterID, ordered by ID, to sweep all
+	// users in batches; an empty afterID starts from the first user
+	ListAfter(ctx context.Context, afterID string, limit int) ([]*domain.User, error)
+	// SetEmailNormalized replaces the normalized email of a user, ErrDuplicateEmail if another user has it
+	SetEmailNormalized(ctx context.Context, userID, emailNormalized string) error
+	// ListUnverifiedToWarn returns up to limit active users created before createdBefore whose email
+	// was never verified nor warned about, oldest first. Placeholder emails under .invalid are left out.
+	ListUnverifiedToWarn(ctx context.Context, createdBefore time.Time, limit int) ([]*domain.User, error)
+	// ListUnverifiedWarnedBefore returns up to limit active users whose email was never verified and who
+	// were warned before warnedBefore, oldest first
+	ListUnverifiedWarnedBefore(ctx context.Context, warnedBefore time.Time, limit int) ([]*domain.User, error)
+	// MarkUnverifiedWarned records when a user was warned, ErrNotFound if the user doesn't exist or
+	// was warned already, so that concurrent sweeps warn a user once
+	MarkUnverifiedWarned(ctx context.Context, userID string, at time.Time) error
+	// Delete deletes a user, refresh tokens and OAuth connections are deleted along with it
+	Delete(ctx context.Context, id string) error
 }
 
 // TokenRepository defines methods for token operations
+// Tokens are revoked rather than deleted, revoked tokens are kept for investigations until they are
+// purged and are not returned by the lookups.
 type TokenRepository interface {
 	Create(ctx context.Context, token *domain.RefreshToken) error
 	GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	// GetByUserID returns the tokens of a user that aren't revoked, newest first
 	GetByUserID(ctx context.Context, userID string) ([]*domain.RefreshToken, error)
-	Delete(ctx context.Context, tokenID string) error
-	DeleteByTokenHash(ctx context.Context, tokenHash string) error
-	DeleteExpired(ctx context.Context) error
+	// Revoke revokes a token for reason, ErrNotFound if it doesn't exist or is revoked already
+	Revoke(ctx context.Context, tokenID, reason string) error
+	RevokeByTokenHash(ctx context.Context, tokenHash, reason string) error
+	// Rotate revokes the token with tokenHash as rotated and creates next atomically,
+	// ErrNotFound if the token doesn't exist or is revoked already, e.g. by a concurrent rotation
+	Rotate(ctx context.Context, tokenHash string, next *domain.RefreshToken) error
+	// RevokeIssuedBefore revokes tokens created before the given time, of all users when userID is empty,
+	// and returns the number of revoked tokens
+	RevokeIssuedBefore(ctx context.Context, userID string, before time.Time, reason string) (int64, error)
+	// Purge deletes tokens that expired or were revoked before the given time and returns their number
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
 
 // OAuthProviderRepository defines methods for OAuth provider operations
@@ -30,5 +67,123 @@ type OAuthProviderRepository interface {
 	Create(ctx context.Context, provider *domain.OAuthProvider) error
 	GetByProvider(ctx context.Context, provider, providerUserID string) (*domain.OAuthProvider, error)
 	GetByUserID(ctx context.Context, userID string) ([]*domain.OAuthProvider, error)
+	// ListByProviderUserID returns the connections of any provider to the account with providerUserID
+	ListByProviderUserID(ctx context.Context, providerUserID string) ([]*domain.OAuthProvider, error)
+	// UpdateTokens replaces AccessToken, RefreshToken and TokenExpiresAt of a connection
+	UpdateTokens(ctx context.Context, provider *domain.OAuthProvider) error
+	// ListStaleTokens lists up to limit connections with a stored token that doesn't start with keyPrefix,
+	// i.e. that is encrypted with another key than the current one
+	ListStaleTokens(ctx context.Context, keyPrefix string, limit int) ([]*domain.OAuthProvider, error)
 	Delete(ctx context.Context, providerID string) error
 }
+
+// IPRuleRepository defines methods for IP rule operations
+type IPRuleRepository interface {
+	Create(ctx context.Context, rule *domain.IPRule) error
+	List(ctx context.Context) ([]*domain.IPRule, error)
+	Delete(ctx context.Context, ruleID string) error
+}
+
+// ErasureRepository defines methods for right-to-be-forgotten requests and their tombstones
+type ErasureRepository interface {
+	Create(ctx context.Context, erasure *domain.Erasure) error
+	GetByUserID(ctx context.Context, userID string) (*domain.Erasure, error)
+	// ListDue returns up to limit pending erasures due at the given time, earliest first
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.Erasure, error)
+	// MarkErased records that a pending erasure was carried out, ErrNotFound if it is not pending
+	MarkErased(ctx context.Context, id string, erasedAt time.Time) error
+	// DeletePending deletes an erasure that wasn't carried out yet, ErrNotFound if there is none
+	DeletePending(ctx context.Context, id string) error
+}
+
+// ConsentRepository defines methods for policy consent operations
+type ConsentRepository interface {
+	Create(ctx context.Context, consent *domain.Consent) error
+	// ListByUserID returns the consents of a user, oldest first
+	ListByUserID(ctx context.Context, userID string) ([]*domain.Consent, error)
+	// DeleteByUserID deletes all consents of a user, e.g. when the user is erased
+	DeleteByUserID(ctx context.Context, userID string) error
+}
+
+// IdentityRepository defines methods for identities users sign in with, e.g. wallets
+type IdentityRepository interface {
+	// Create links an identity to a user, ErrDuplicateIdentity if it is linked already
+	Create(ctx context.Context, identity *domain.Identity) error
+	GetBySubject(ctx context.Context, identityType, subject string) (*domain.Identity, error)
+	// ListByUserID returns the identities of a user, oldest first
+	ListByUserID(ctx context.Context, userID string) ([]*domain.Identity, error)
+	// DeleteByUserID deletes all identities of a user, e.g. when the user is erased
+	DeleteByUserID(ctx context.Context, userID string) error
+}
+
+// InvitationRepository defines methods for signup invitation operations
+type InvitationRepository interface {
+	Create(ctx context.Context, invitation *domain.Invitation) error
+	GetByID(ctx context.Context, id string) (*domain.Invitation, error)
+	GetByTokenHash(ctx context.Context, tokenHash string) (*domain.Invitation, error)
+	// List returns invitations newest first, those created by invitedBy or all when it is empty
+	List(ctx context.Context, invitedBy string) ([]*domain.Invitation, error)
+	// MarkAccepted records that a user registered with the invitation, ErrNotFound if it was
+	// accepted or revoked before
+	MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) error
+	// Revoke revokes an invitation, ErrNotFound if it was accepted or revoked before
+	Revoke(ctx context.Context, id string, revokedAt time.Time) error
+	// DeleteByUserID deletes the invitations created or accepted by a user, e.g. when the user is erased
+	DeleteByUserID(ctx context.Context, userID string) error
+}
+
+// OrganizationRepository defines methods for organization and membership operations
+type OrganizationRepository interface {
+	Create(ctx context.Context, org *domain.Organization) error
+	GetByID(ctx context.Context, id string) (*domain.Organization, error)
+	// Delete deletes an organization along with its memberships
+	Delete(ctx context.Context, id string) error
+	// AddMember adds a user to an organization, ErrDuplicateMembership if the user is a member already
+	AddMember(ctx context.Context, membership *domain.Membership) error
+	GetMember(ctx context.Context, orgID, userID string) (*domain.Membership, error)
+	// ListMembers returns the members of an organization, oldest first
+	ListMembers(ctx context.Context, orgID string) ([]*domain.Membership, error)
+	// ListMemberships returns the memberships of a user, oldest first
+	ListMemberships(ctx context.Context, userID string) ([]*domain.Membership, error)
+	UpdateMemberRole(ctx context.Context, orgID, userID, role string) error
+	RemoveMember(ctx context.Context, orgID, userID string) error
+	// DeleteMemberships deletes the memberships of a user, e.g. when the user is erased
+	DeleteMemberships(ctx context.Context, userID string) error
+}
+
+// TenantRepository defines methods for tenant operations
+type TenantRepository interface {
+	// Save creates a tenant or replaces the settings of an existing one, keeping its creation time
+	Save(ctx context.Context, tenant *domain.Tenant) error
+	GetByID(ctx context.Context, id string) (*domain.Tenant, error)
+	// List returns all tenants ordered by ID
+	List(ctx context.Context) ([]*domain.Tenant, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// StatsRepository computes aggregates of users and sessions for the admin dashboard
+type StatsRepository interface {
+	// CountUsers counts all users, the active ones and those with a verified email
+	CountUsers(ctx context.Context) (*domain.UserCounts, error)
+	// CountActiveUsers counts the users whose last login is at or after since
+	CountActiveUsers(ctx context.Context, since time.Time) (int64, error)
+	// CountActiveSessions counts the sessions with a refresh token neither revoked nor expired at now
+	CountActiveSessions(ctx context.Context, now time.Time) (int64, error)
+	// DailyRegistrations counts the users created per UTC day at or after since, oldest first;
+	// days without registrations are left out
+	DailyRegistrations(ctx context.Context, since time.Time) ([]domain.DailyCount, error)
+}
+
+// UserFlagsRepository defines methods for the notes and flags support keeps on users
+type UserFlagsRepository interface {
+	// Get returns the notes and flags of a user, ErrNotFound if none were saved
+	Get(ctx context.Context, userID string) (*domain.UserFlags, error)
+	// ListByUserIDs returns the notes and flags saved for any of the users
+	ListByUserIDs(ctx context.Context, userIDs []string) ([]*domain.UserFlags, error)
+	// ListByFlag returns up to limit users with the flag, last edited first
+	ListByFlag(ctx context.Context, flag string, limit int) ([]*domain.UserFlags, error)
+	// Save creates or replaces the notes and flags of a user
+	Save(ctx context.Context, flags *domain.UserFlags) error
+	// DeleteByUserID deletes the notes and flags of a user, e.g. when the user is erased
+	DeleteByUserID(ctx context.Context, userID string) error
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const invitationColumns = `id, token_hash, email, email_normalized, role, tenant, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at`
+
+// invitationRepository implements InvitationRepository interface
+type invitationRepository struct {
+	db *database.Postgres
+}
+
+// NewInvitationRepository creates a new invitation repository
+func NewInvitationRepository(db *database.Postgres) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+// Create creates a new invitation
+func (r *invitationRepository) Create(ctx context.Context, invitation *domain.Invitation) (err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO invitations (` + invitationColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	// Generate UUID if not provided
+	if invitation.ID == "" {
+		invitation.ID = uuid.New().String()
+	}
+
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query,
+		invitation.ID,
+		invitation.TokenHash,
+		invitation.Email,
+		invitation.EmailNormalized,
+		invitation.Role,
+		invitation.Tenant,
+		invitation.InvitedBy,
+		invitation.CreatedAt,
+		invitation.ExpiresAt,
+		invitation.AcceptedAt,
+		invitation.AcceptedBy,
+		invitation.RevokedAt,
+	)
+
+	if err != nil {
+		// Check for unique constraint violation (duplicate token_hash)
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return fmt.Errorf("invitation token already exists: %w", ErrDuplicateInvitation)
+			}
+		}
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an invitation by ID
+func (r *invitationRepository) GetByID(ctx context.Context, id string) (_ *domain.Invitation, err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.GetByID")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE id = $1`
+
+	invitation, err := scanInvitation(r.db.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation with id %s not found: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get invitation by id: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// GetByTokenHash retrieves an invitation by the hash of its token
+func (r *invitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (_ *domain.Invitation, err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.GetByTokenHash")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE token_hash = $1`
+
+	invitation, err := scanInvitation(r.db.DB.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation not found: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get invitation by token hash: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// List retrieves invitations newest first, those created by invitedBy or all when it is empty
+func (r *invitationRepository) List(ctx context.Context, invitedBy string) (_ []*domain.Invitation, err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.List")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT ` + invitationColumns + ` FROM invitations ORDER BY created_at DESC`
+	var args []any
+	if invitedBy != "" {
+		query = `SELECT ` + invitationColumns + ` FROM invitations WHERE invited_by = $1 ORDER BY created_at DESC`
+		args = append(args, invitedBy)
+	}
+
+	rows, err := r.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []*domain.Invitation
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// MarkAccepted records that a user registered with the invitation
+func (r *invitationRepository) MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.MarkAccepted")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE invitations SET accepted_at = $1, accepted_by = $2 WHERE id = $3 AND accepted_at IS NULL AND revoked_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, acceptedAt, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark invitation as accepted: %w", err)
+	}
+
+	return requireInvitationAffected(result, id)
+}
+
+// Revoke revokes an invitation that wasn't accepted
+func (r *invitationRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.Revoke")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE invitations SET revoked_at = $1 WHERE id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, revokedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	return requireInvitationAffected(result, id)
+}
+
+// DeleteByUserID deletes the invitations created or accepted by a user
+func (r *invitationRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "InvitationRepository.DeleteByUserID")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM invitations WHERE invited_by = $1 OR accepted_by = $1`
+
+	if _, err = r.db.DB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete invitations: %w", err)
+	}
+
+	return nil
+}
+
+// requireInvitationAffected returns ErrNotFound if no pending invitation was updated
+func requireInvitationAffected(result sql.Result, id string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("pending invitation with id %s not found: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanInvitation scans an invitation from a row of invitationColumns
+func scanInvitation(row interface{ Scan(dest ...any) error }) (*domain.Invitation, error) {
+	invitation := &domain.Invitation{}
+	var role, tenant, invitedBy, acceptedBy sql.NullString
+	var acceptedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.TokenHash,
+		&invitation.Email,
+		&invitation.EmailNormalized,
+		&role,
+		&tenant,
+		&invitedBy,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&acceptedBy,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.Valid {
+		invitation.Role = &role.String
+	}
+	if tenant.Valid {
+		invitation.Tenant = &tenant.String
+	}
+	if invitedBy.Valid {
+		invitation.InvitedBy = &invitedBy.String
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	if acceptedBy.Valid {
+		invitation.AcceptedBy = &acceptedBy.String
+	}
+	if revokedAt.Valid {
+		invitation.RevokedAt = &revokedAt.Time
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// ipRuleRepository implements IPRuleRepository interface
+type ipRuleRepository struct {
+	db *database.Postgres
+}
+
+// NewIPRuleRepository creates a new IP rule repository
+func NewIPRuleRepository(db *database.Postgres) IPRuleRepository {
+	return &ipRuleRepository{db: db}
+}
+
+// Create creates a new IP rule
+func (r *ipRuleRepository) Create(ctx context.Context, rule *domain.IPRule) (err error) {
+	ctx, span := tracer.Start(ctx, "IPRuleRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO ip_rules (id, cidr, action, comment, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	// Generate UUID if not provided
+	if rule.ID == "" {
+		rule.ID = uuid.New().String()
+	}
+
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query,
+		rule.ID,
+		rule.CIDR,
+		rule.Action,
+		rule.Comment,
+		rule.CreatedAt,
+	)
+
+	if err != nil {
+		// Check for unique constraint violation (duplicate cidr)
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return fmt.Errorf("ip rule for %s already exists: %w", rule.CIDR, ErrDuplicateIPRule)
+			}
+		}
+		return fmt.Errorf("failed to create ip rule: %w", err)
+	}
+
+	return nil
+}
+
+// List retrieves all IP rules
+func (r *ipRuleRepository) List(ctx context.Context) (_ []*domain.IPRule, err error) {
+	ctx, span := tracer.Start(ctx, "IPRuleRepository.List")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT id, cidr, action, comment, created_at
+		FROM ip_rules
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ip rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*domain.IPRule
+	for rows.Next() {
+		rule := &domain.IPRule{}
+		var comment sql.NullString
+
+		err := rows.Scan(
+			&rule.ID,
+			&rule.CIDR,
+			&rule.Action,
+			&comment,
+			&rule.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ip rule: %w", err)
+		}
+
+		if comment.Valid {
+			rule.Comment = &comment.String
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate ip rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Delete deletes an IP rule by ID
+func (r *ipRuleRepository) Delete(ctx context.Context, ruleID string) (err error) {
+	ctx, span := tracer.Start(ctx, "IPRuleRepository.Delete")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM ip_rules WHERE id = $1`
+
+	result, err := r.db.DB.ExecContext(ctx, query, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete ip rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("ip rule with id %s not found: %w", ruleID, ErrNotFound)
+	}
+
+	return nil
+}
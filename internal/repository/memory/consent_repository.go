@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// consentRepository implements repository.ConsentRepository in memory
+type consentRepository struct {
+	mu       sync.RWMutex
+	consents map[string]*domain.Consent
+}
+
+// NewConsentRepository creates a new in-memory consent repository
+func NewConsentRepository() repository.ConsentRepository {
+	return &consentRepository{consents: make(map[string]*domain.Consent)}
+}
+
+// Create records a consent
+func (r *consentRepository) Create(ctx context.Context, consent *domain.Consent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if consent.ID == "" {
+		consent.ID = uuid.New().String()
+	}
+	if consent.AcceptedAt.IsZero() {
+		consent.AcceptedAt = time.Now()
+	}
+
+	for _, other := range r.consents {
+		if other.UserID == consent.UserID && other.Document == consent.Document && other.Version == consent.Version {
+			return fmt.Errorf("consent to %s version %s already exists: %w", consent.Document, consent.Version, repository.ErrDuplicateConsent)
+		}
+	}
+
+	c := *consent
+	r.consents[consent.ID] = &c
+	return nil
+}
+
+// ListByUserID retrieves the consents of a user, oldest first
+func (r *consentRepository) ListByUserID(ctx context.Context, userID string) ([]*domain.Consent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var consents []*domain.Consent
+	for _, consent := range r.consents {
+		if consent.UserID == userID {
+			c := *consent
+			consents = append(consents, &c)
+		}
+	}
+
+	sort.Slice(consents, func(i, j int) bool {
+		return consents[i].AcceptedAt.Before(consents[j].AcceptedAt)
+	})
+	return consents, nil
+}
+
+// DeleteByUserID deletes all consents of a user
+func (r *consentRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, consent := range r.consents {
+		if consent.UserID == userID {
+			delete(r.consents, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// erasureRepository implements repository.ErasureRepository in memory
+type erasureRepository struct {
+	mu       sync.RWMutex
+	erasures map[string]*domain.Erasure
+}
+
+// NewErasureRepository creates a new in-memory erasure repository
+func NewErasureRepository() repository.ErasureRepository {
+	return &erasureRepository{erasures: make(map[string]*domain.Erasure)}
+}
+
+// Create creates a new erasure
+func (r *erasureRepository) Create(ctx context.Context, erasure *domain.Erasure) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if erasure.ID == "" {
+		erasure.ID = uuid.New().String()
+	}
+	if erasure.RequestedAt.IsZero() {
+		erasure.RequestedAt = time.Now()
+	}
+
+	for _, other := range r.erasures {
+		if other.UserID == erasure.UserID {
+			return fmt.Errorf("erasure for user %s already exists: %w", erasure.UserID, repository.ErrDuplicateErasure)
+		}
+	}
+
+	r.erasures[erasure.ID] = copyErasure(erasure)
+	return nil
+}
+
+// GetByUserID retrieves the erasure of a user
+func (r *erasureRepository) GetByUserID(ctx context.Context, userID string) (*domain.Erasure, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, erasure := range r.erasures {
+		if erasure.UserID == userID {
+			return copyErasure(erasure), nil
+		}
+	}
+	return nil, fmt.Errorf("erasure for user %s not found: %w", userID, repository.ErrNotFound)
+}
+
+// ListDue retrieves pending erasures due at the given time, earliest first
+func (r *erasureRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.Erasure, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var erasures []*domain.Erasure
+	for _, erasure := range r.erasures {
+		if erasure.IsPending() && !erasure.EraseAfter.After(now) {
+			erasures = append(erasures, copyErasure(erasure))
+		}
+	}
+
+	sort.Slice(erasures, func(i, j int) bool {
+		return erasures[i].EraseAfter.Before(erasures[j].EraseAfter)
+	})
+	if len(erasures) > limit {
+		erasures = erasures[:limit]
+	}
+	return erasures, nil
+}
+
+// MarkErased records that a pending erasure was carried out
+func (r *erasureRepository) MarkErased(ctx context.Context, id string, erasedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	erasure, ok := r.erasures[id]
+	if !ok || !erasure.IsPending() {
+		return fmt.Errorf("pending erasure with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	erasure.ErasedAt = &erasedAt
+	return nil
+}
+
+// DeletePending deletes an erasure that wasn't carried out yet
+func (r *erasureRepository) DeletePending(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	erasure, ok := r.erasures[id]
+	if !ok || !erasure.IsPending() {
+		return fmt.Errorf("pending erasure with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	delete(r.erasures, id)
+	return nil
+}
+
+// copyErasure returns a copy so callers can't modify stored erasures
+func copyErasure(erasure *domain.Erasure) *domain.Erasure {
+	c := *erasure
+	if erasure.ErasedAt != nil {
+		erasedAt := *erasure.ErasedAt
+		c.ErasedAt = &erasedAt
+	}
+	return &c
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// identityRepository implements repository.IdentityRepository in memory
+type identityRepository struct {
+	mu         sync.RWMutex
+	identities map[string]*domain.Identity
+}
+
+// NewIdentityRepository creates a new in-memory identity repository
+func NewIdentityRepository() repository.IdentityRepository {
+	return &identityRepository{identities: make(map[string]*domain.Identity)}
+}
+
+// Create links an identity to a user
+func (r *identityRepository) Create(ctx context.Context, identity *domain.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if identity.ID == "" {
+		identity.ID = uuid.New().String()
+	}
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	for _, other := range r.identities {
+		if other.Type == identity.Type && other.Subject == identity.Subject {
+			return fmt.Errorf("%s identity %s already exists: %w", identity.Type, identity.Subject, repository.ErrDuplicateIdentity)
+		}
+	}
+
+	i := *identity
+	r.identities[identity.ID] = &i
+	return nil
+}
+
+// GetBySubject retrieves an identity by type and subject
+func (r *identityRepository) GetBySubject(ctx context.Context, identityType, subject string) (*domain.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, identity := range r.identities {
+		if identity.Type == identityType && identity.Subject == subject {
+			i := *identity
+			return &i, nil
+		}
+	}
+	return nil, fmt.Errorf("identity not found: %w", repository.ErrNotFound)
+}
+
+// ListByUserID retrieves the identities of a user, oldest first
+func (r *identityRepository) ListByUserID(ctx context.Context, userID string) ([]*domain.Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var identities []*domain.Identity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			i := *identity
+			identities = append(identities, &i)
+		}
+	}
+
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+	})
+	return identities, nil
+}
+
+// DeleteByUserID deletes all identities of a user
+func (r *identityRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, identity := range r.identities {
+		if identity.UserID == userID {
+			delete(r.identities, id)
+		}
+	}
+	return nil
+}
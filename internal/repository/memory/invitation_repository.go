@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// invitationRepository implements repository.InvitationRepository in memory
+type invitationRepository struct {
+	mu          sync.RWMutex
+	invitations map[string]*domain.Invitation
+}
+
+// NewInvitationRepository creates a new in-memory invitation repository
+func NewInvitationRepository() repository.InvitationRepository {
+	return &invitationRepository{invitations: make(map[string]*domain.Invitation)}
+}
+
+// Create creates a new invitation
+func (r *invitationRepository) Create(ctx context.Context, invitation *domain.Invitation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if invitation.ID == "" {
+		invitation.ID = uuid.New().String()
+	}
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	for _, other := range r.invitations {
+		if other.TokenHash == invitation.TokenHash {
+			return fmt.Errorf("invitation token already exists: %w", repository.ErrDuplicateInvitation)
+		}
+	}
+
+	r.invitations[invitation.ID] = copyInvitation(invitation)
+	return nil
+}
+
+// GetByID retrieves an invitation by ID
+func (r *invitationRepository) GetByID(ctx context.Context, id string) (*domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invitation, ok := r.invitations[id]
+	if !ok {
+		return nil, fmt.Errorf("invitation with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	return copyInvitation(invitation), nil
+}
+
+// GetByTokenHash retrieves an invitation by the hash of its token
+func (r *invitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, invitation := range r.invitations {
+		if invitation.TokenHash == tokenHash {
+			return copyInvitation(invitation), nil
+		}
+	}
+	return nil, fmt.Errorf("invitation not found: %w", repository.ErrNotFound)
+}
+
+// List retrieves invitations newest first, those created by invitedBy or all when it is empty
+func (r *invitationRepository) List(ctx context.Context, invitedBy string) ([]*domain.Invitation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var invitations []*domain.Invitation
+	for _, invitation := range r.invitations {
+		if invitedBy != "" && (invitation.InvitedBy == nil || *invitation.InvitedBy != invitedBy) {
+			continue
+		}
+		invitations = append(invitations, copyInvitation(invitation))
+	}
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].CreatedAt.After(invitations[j].CreatedAt)
+	})
+	return invitations, nil
+}
+
+// MarkAccepted records that a user registered with the invitation
+func (r *invitationRepository) MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[id]
+	if !ok || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return fmt.Errorf("pending invitation with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	invitation.AcceptedAt = &acceptedAt
+	invitation.AcceptedBy = &userID
+	return nil
+}
+
+// Revoke revokes an invitation that wasn't accepted
+func (r *invitationRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	invitation, ok := r.invitations[id]
+	if !ok || invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return fmt.Errorf("pending invitation with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	invitation.RevokedAt = &revokedAt
+	return nil
+}
+
+// DeleteByUserID deletes the invitations created or accepted by a user
+func (r *invitationRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, invitation := range r.invitations {
+		if (invitation.InvitedBy != nil && *invitation.InvitedBy == userID) || (invitation.AcceptedBy != nil && *invitation.AcceptedBy == userID) {
+			delete(r.invitations, id)
+		}
+	}
+	return nil
+}
+
+// copyInvitation returns a copy so callers can't modify stored invitations
+// Pointer fields are shared, they are replaced rather than modified in place
+func copyInvitation(invitation *domain.Invitation) *domain.Invitation {
+	c := *invitation
+	return &c
+}
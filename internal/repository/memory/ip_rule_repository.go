@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// ipRuleRepository implements repository.IPRuleRepository in memory
+type ipRuleRepository struct {
+	mu    sync.RWMutex
+	rules map[string]*domain.IPRule
+}
+
+// NewIPRuleRepository creates a new in-memory IP rule repository
+func NewIPRuleRepository() repository.IPRuleRepository {
+	return &ipRuleRepository{rules: make(map[string]*domain.IPRule)}
+}
+
+// Create creates a new IP rule
+// CIDRs are stored in canonical form, like the Postgres cidr type does
+func (r *ipRuleRepository) Create(ctx context.Context, rule *domain.IPRule) error {
+	prefix, err := netip.ParsePrefix(rule.CIDR)
+	if err != nil {
+		return fmt.Errorf("failed to create ip rule: invalid cidr %s: %w", rule.CIDR, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rule.ID == "" {
+		rule.ID = uuid.New().String()
+	}
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = time.Now()
+	}
+
+	stored := *rule
+	stored.CIDR = prefix.Masked().String()
+	for _, other := range r.rules {
+		if other.CIDR == stored.CIDR {
+			return fmt.Errorf("ip rule for %s already exists: %w", rule.CIDR, repository.ErrDuplicateIPRule)
+		}
+	}
+
+	r.rules[rule.ID] = &stored
+	return nil
+}
+
+// List retrieves all IP rules, newest first
+func (r *ipRuleRepository) List(ctx context.Context) ([]*domain.IPRule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules := make([]*domain.IPRule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		c := *rule
+		rules = append(rules, &c)
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].CreatedAt.After(rules[j].CreatedAt)
+	})
+	return rules, nil
+}
+
+// Delete deletes an IP rule by ID
+func (r *ipRuleRepository) Delete(ctx context.Context, ruleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.rules[ruleID]; !ok {
+		return fmt.Errorf("ip rule with id %s not found: %w", ruleID, repository.ErrNotFound)
+	}
+	delete(r.rules, ruleID)
+	return nil
+}
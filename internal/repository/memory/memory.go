@@ -0,0 +1,25 @@
+// Package memory implements the repositories in memory
+// It mirrors the constraints of the Postgres schema and is meant for tests and local development,
+// data is lost when the process exits.
+package memory
+
+import "github.com/prperemyshlev/auth-service-2/internal/repository"
+
+// NewRepositories creates all repositories in memory
+func NewRepositories() *repository.Repositories {
+	users, tokens := NewUserRepository(), NewTokenRepository()
+	return &repository.Repositories{
+		User:          users,
+		Token:         tokens,
+		OAuthProvider: NewOAuthProviderRepository(),
+		IPRule:        NewIPRuleRepository(),
+		Erasure:       NewErasureRepository(),
+		Consent:       NewConsentRepository(),
+		Identity:      NewIdentityRepository(),
+		Invitation:    NewInvitationRepository(),
+		Organization:  NewOrganizationRepository(),
+		Tenant:        NewTenantRepository(),
+		Stats:         NewStatsRepository(users, tokens),
+		UserFlags:     NewUserFlagsRepository(),
+	}
+}
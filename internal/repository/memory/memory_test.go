@@ -0,0 +1,587 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestUserRepositoryConstraints(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserRepository()
+
+	user := &domain.User{Email: "User@Example.com", EmailNormalized: "user@example.com", Username: stringPtr("alice")}
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if user.ID == "" || user.CreatedAt.IsZero() {
+		t.Error("Expected ID and timestamps to be set")
+	}
+
+	tests := []struct {
+		name string
+		user *domain.User
+		want error
+	}{
+		{name: "same normalized email", user: &domain.User{Email: "user+tag@example.com", EmailNormalized: "user@example.com"}, want: repository.ErrDuplicateEmail},
+		{name: "same email", user: &domain.User{Email: "User@Example.com", EmailNormalized: "other@example.com"}, want: repository.ErrDuplicateEmail},
+		{name: "same username", user: &domain.User{Email: "bob@example.com", EmailNormalized: "bob@example.com", Username: stringPtr("alice")}, want: repository.ErrDuplicateUsername},
+		{name: "unique", user: &domain.User{Email: "bob@example.com", EmailNormalized: "bob@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.Create(ctx, tt.user); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	found, err := repo.GetByUsername(ctx, "alice")
+	if err != nil || found.ID != user.ID {
+		t.Fatalf("Failed to get user by username: %v", err)
+	}
+
+	// Returned users are copies, changes need Update
+	found.Username = stringPtr("carol")
+	if _, err := repo.GetByUsername(ctx, "alice"); err != nil {
+		t.Errorf("Expected stored user to be unchanged, got %v", err)
+	}
+	if err := repo.Update(ctx, found); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, err := repo.GetByUsername(ctx, "alice"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected old username to be free, got %v", err)
+	}
+
+	if err := repo.Update(ctx, &domain.User{ID: "missing"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing user, got %v", err)
+	}
+	if err := repo.UpdateLastLogin(ctx, user.ID, "192.0.2.1"); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+	if err := repo.UpdateLastLogin(ctx, user.ID, ""); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+	if found, _ := repo.GetByEmail(ctx, "user@example.com"); found.LastLoginAt == nil || found.LastLoginIP != nil || found.LoginCount != 2 ||
+		found.PreviousLoginAt == nil || found.PreviousLoginIP == nil || *found.PreviousLoginIP != "192.0.2.1" {
+		t.Errorf("Expected the login to be recorded, got %+v", found)
+	}
+
+	if err := repo.SetRestriction(ctx, user.ID, domain.RestrictionLimited); err != nil {
+		t.Fatalf("Failed to set restriction: %v", err)
+	}
+	// Update leaves the restriction alone
+	if err := repo.Update(ctx, &domain.User{ID: user.ID, Email: user.Email, EmailNormalized: user.EmailNormalized}); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if found, _ := repo.GetByID(ctx, user.ID); found.Restriction != domain.RestrictionLimited {
+		t.Errorf("Expected the user to be limited, got %q", found.Restriction)
+	}
+	if err := repo.SetRestriction(ctx, "missing", domain.RestrictionBanned); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing user, got %v", err)
+	}
+}
+
+func TestTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewTokenRepository()
+	now := time.Now()
+
+	tokens := []*domain.RefreshToken{
+		{UserID: "user-1", TokenHash: "old", ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-time.Minute)},
+		{UserID: "user-1", TokenHash: "new", ExpiresAt: now.Add(time.Hour), CreatedAt: now},
+		{UserID: "user-1", TokenHash: "expired", ExpiresAt: now.Add(-time.Second), CreatedAt: now.Add(-time.Hour)},
+		{UserID: "user-2", TokenHash: "other", ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := repo.Create(ctx, token); err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, &domain.RefreshToken{UserID: "user-2", TokenHash: "old"}); !errors.Is(err, repository.ErrDuplicateToken) {
+		t.Errorf("Expected ErrDuplicateToken, got %v", err)
+	}
+
+	if tokens[0].SessionID != tokens[0].ID {
+		t.Errorf("Expected a token without session to start one, got %q", tokens[0].SessionID)
+	}
+	rotated := &domain.RefreshToken{UserID: tokens[0].UserID, SessionID: tokens[0].SessionID, TokenHash: "rotated", ExpiresAt: now.Add(time.Hour)}
+	if err := repo.Create(ctx, rotated); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if stored, err := repo.GetByTokenHash(ctx, "rotated"); err != nil || stored.SessionID != tokens[0].ID {
+		t.Errorf("Expected the session to be kept, got %+v %v", stored, err)
+	}
+	if err := repo.RevokeByTokenHash(ctx, "rotated", domain.TokenRevokeRotated); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := repo.GetByTokenHash(ctx, "rotated"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected revoked token to be hidden, got %v", err)
+	}
+
+	userTokens, err := repo.GetByUserID(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to get tokens: %v", err)
+	}
+	if len(userTokens) != 3 || userTokens[0].TokenHash != "new" || userTokens[2].TokenHash != "expired" {
+		t.Errorf("Expected tokens of user-1 newest first, got %d tokens", len(userTokens))
+	}
+
+	// Revoked tokens are kept until they are purged after the retention
+	if purged, err := repo.Purge(ctx, now.Add(-time.Minute)); err != nil || purged != 0 {
+		t.Errorf("Expected no tokens to be purged within the retention, got %d %v", purged, err)
+	}
+	if purged, err := repo.Purge(ctx, time.Now()); err != nil || purged != 2 {
+		t.Errorf("Expected the expired and the revoked token to be purged, got %d %v", purged, err)
+	}
+	if err := repo.RevokeByTokenHash(ctx, "rotated", domain.TokenRevokeRotated); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a purged token, got %v", err)
+	}
+
+	if err := repo.RevokeByTokenHash(ctx, "old", domain.TokenRevokeLogout); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if err := repo.Revoke(ctx, tokens[1].ID, domain.TokenRevokeSession); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if err := repo.Revoke(ctx, tokens[1].ID, domain.TokenRevokeSession); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a revoked token, got %v", err)
+	}
+
+	if revoked, err := repo.RevokeIssuedBefore(ctx, "user-1", now.Add(time.Minute), domain.TokenRevokeRevocation); err != nil || revoked != 0 {
+		t.Errorf("Expected no tokens of user-1 left, got %d %v", revoked, err)
+	}
+	if revoked, err := repo.RevokeIssuedBefore(ctx, "", now.Add(time.Minute), domain.TokenRevokeRevocation); err != nil || revoked != 1 {
+		t.Errorf("Expected the token of user-2 to be revoked, got %d %v", revoked, err)
+	}
+}
+
+func TestErasureRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewErasureRepository()
+	now := time.Now()
+
+	erasures := []*domain.Erasure{
+		{UserID: "user-1", RequestedBy: domain.ErasureRequestedByUser, EraseAfter: now.Add(-time.Minute)},
+		{UserID: "user-2", RequestedBy: domain.ErasureRequestedByAdmin, EraseAfter: now.Add(-time.Hour)},
+		{UserID: "user-3", RequestedBy: domain.ErasureRequestedByUser, EraseAfter: now.Add(time.Hour)},
+	}
+	for _, erasure := range erasures {
+		if err := repo.Create(ctx, erasure); err != nil {
+			t.Fatalf("Failed to create erasure: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, &domain.Erasure{UserID: "user-1"}); !errors.Is(err, repository.ErrDuplicateErasure) {
+		t.Errorf("Expected ErrDuplicateErasure, got %v", err)
+	}
+
+	due, err := repo.ListDue(ctx, now, 10)
+	if err != nil || len(due) != 2 || due[0].UserID != "user-2" {
+		t.Fatalf("Expected due erasures earliest first, got %d erasures %v", len(due), err)
+	}
+	if due, _ := repo.ListDue(ctx, now, 1); len(due) != 1 {
+		t.Errorf("Expected the limit to apply, got %d erasures", len(due))
+	}
+
+	if err := repo.MarkErased(ctx, erasures[1].ID, now); err != nil {
+		t.Fatalf("Failed to mark erasure: %v", err)
+	}
+	if err := repo.DeletePending(ctx, erasures[1].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected tombstones to be kept, got %v", err)
+	}
+	if due, _ := repo.ListDue(ctx, now, 10); len(due) != 1 || due[0].UserID != "user-1" {
+		t.Errorf("Expected carried out erasures not to be due, got %d erasures", len(due))
+	}
+}
+
+func TestConsentRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewConsentRepository()
+	now := time.Now()
+
+	consents := []*domain.Consent{
+		{UserID: "user-1", Document: domain.ConsentDocumentTerms, Version: "v2", AcceptedAt: now},
+		{UserID: "user-1", Document: domain.ConsentDocumentTerms, Version: "v1", AcceptedAt: now.Add(-time.Hour), IPAddress: stringPtr("192.0.2.1")},
+		{UserID: "user-2", Document: domain.ConsentDocumentTerms, Version: "v1", AcceptedAt: now},
+	}
+	for _, consent := range consents {
+		if err := repo.Create(ctx, consent); err != nil {
+			t.Fatalf("Failed to create consent: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, &domain.Consent{UserID: "user-1", Document: domain.ConsentDocumentTerms, Version: "v1"}); !errors.Is(err, repository.ErrDuplicateConsent) {
+		t.Errorf("Expected ErrDuplicateConsent, got %v", err)
+	}
+
+	listed, err := repo.ListByUserID(ctx, "user-1")
+	if err != nil || len(listed) != 2 || listed[0].Version != "v1" {
+		t.Fatalf("Expected consents of the user oldest first, got %d consents %v", len(listed), err)
+	}
+	if listed[0].IPAddress == nil || *listed[0].IPAddress != "192.0.2.1" {
+		t.Errorf("Expected the IP address to be kept, got %v", listed[0].IPAddress)
+	}
+
+	if err := repo.DeleteByUserID(ctx, "user-1"); err != nil {
+		t.Fatalf("Failed to delete consents: %v", err)
+	}
+	if listed, _ := repo.ListByUserID(ctx, "user-1"); len(listed) != 0 {
+		t.Errorf("Expected consents to be deleted, got %d", len(listed))
+	}
+	if listed, _ := repo.ListByUserID(ctx, "user-2"); len(listed) != 1 {
+		t.Errorf("Expected consents of other users to be kept, got %d", len(listed))
+	}
+}
+
+func TestIdentityRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewIdentityRepository()
+	now := time.Now()
+
+	identities := []*domain.Identity{
+		{UserID: "user-1", Type: domain.IdentityTypeEthereum, Subject: "0xB", CreatedAt: now},
+		{UserID: "user-1", Type: domain.IdentityTypeEthereum, Subject: "0xA", CreatedAt: now.Add(-time.Hour)},
+		{UserID: "user-2", Type: domain.IdentityTypeEthereum, Subject: "0xC", CreatedAt: now},
+	}
+	for _, identity := range identities {
+		if err := repo.Create(ctx, identity); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, &domain.Identity{UserID: "user-2", Type: domain.IdentityTypeEthereum, Subject: "0xA"}); !errors.Is(err, repository.ErrDuplicateIdentity) {
+		t.Errorf("Expected ErrDuplicateIdentity, got %v", err)
+	}
+
+	found, err := repo.GetBySubject(ctx, domain.IdentityTypeEthereum, "0xA")
+	if err != nil || found.UserID != "user-1" {
+		t.Fatalf("Expected the identity of user-1, got %v %v", found, err)
+	}
+	if _, err := repo.GetBySubject(ctx, "other", "0xA"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another type, got %v", err)
+	}
+
+	listed, err := repo.ListByUserID(ctx, "user-1")
+	if err != nil || len(listed) != 2 || listed[0].Subject != "0xA" {
+		t.Fatalf("Expected identities of the user oldest first, got %d identities %v", len(listed), err)
+	}
+
+	if err := repo.DeleteByUserID(ctx, "user-1"); err != nil {
+		t.Fatalf("Failed to delete identities: %v", err)
+	}
+	if listed, _ := repo.ListByUserID(ctx, "user-1"); len(listed) != 0 {
+		t.Errorf("Expected identities to be deleted, got %d", len(listed))
+	}
+	if listed, _ := repo.ListByUserID(ctx, "user-2"); len(listed) != 1 {
+		t.Errorf("Expected identities of other users to be kept, got %d", len(listed))
+	}
+}
+
+func TestInvitationRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInvitationRepository()
+	now := time.Now()
+
+	invitations := []*domain.Invitation{
+		{TokenHash: "hash-1", Email: "a@example.com", InvitedBy: stringPtr("user-1"), CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{TokenHash: "hash-2", Email: "b@example.com", CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, invitation := range invitations {
+		if err := repo.Create(ctx, invitation); err != nil {
+			t.Fatalf("Failed to create invitation: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, &domain.Invitation{TokenHash: "hash-1"}); !errors.Is(err, repository.ErrDuplicateInvitation) {
+		t.Errorf("Expected ErrDuplicateInvitation, got %v", err)
+	}
+
+	if all, _ := repo.List(ctx, ""); len(all) != 2 || all[0].TokenHash != "hash-2" {
+		t.Errorf("Expected all invitations newest first, got %d", len(all))
+	}
+	if own, _ := repo.List(ctx, "user-1"); len(own) != 1 || own[0].TokenHash != "hash-1" {
+		t.Errorf("Expected the invitations of the user, got %d", len(own))
+	}
+
+	if err := repo.MarkAccepted(ctx, invitations[0].ID, "user-2", now); err != nil {
+		t.Fatalf("Failed to accept invitation: %v", err)
+	}
+	if err := repo.MarkAccepted(ctx, invitations[0].ID, "user-3", now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected an invitation to be accepted once, got %v", err)
+	}
+	if err := repo.Revoke(ctx, invitations[0].ID, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected accepted invitations not to be revoked, got %v", err)
+	}
+	accepted, err := repo.GetByTokenHash(ctx, "hash-1")
+	if err != nil || accepted.Status(now) != domain.InvitationStatusAccepted || *accepted.AcceptedBy != "user-2" {
+		t.Fatalf("Expected the invitation to be accepted by user-2, got %+v %v", accepted, err)
+	}
+
+	if err := repo.DeleteByUserID(ctx, "user-2"); err != nil {
+		t.Fatalf("Failed to delete invitations: %v", err)
+	}
+	if _, err := repo.GetByID(ctx, invitations[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected the accepted invitation to be deleted, got %v", err)
+	}
+	if _, err := repo.GetByID(ctx, invitations[1].ID); err != nil {
+		t.Errorf("Expected other invitations to be kept, got %v", err)
+	}
+}
+
+func TestOrganizationRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewOrganizationRepository()
+	now := time.Now()
+
+	orgs := []*domain.Organization{{Name: "Acme"}, {Name: "Globex"}}
+	for _, org := range orgs {
+		if err := repo.Create(ctx, org); err != nil {
+			t.Fatalf("Failed to create organization: %v", err)
+		}
+	}
+	if err := repo.AddMember(ctx, &domain.Membership{OrgID: "missing", UserID: "user-1", Role: domain.OrgRoleMember}); err == nil {
+		t.Error("Expected members not to be added to a missing organization")
+	}
+	if err := repo.AddMember(ctx, &domain.Membership{OrgID: orgs[0].ID, UserID: "user-1", Role: "superuser"}); err == nil {
+		t.Error("Expected unknown roles to be rejected")
+	}
+
+	if err := repo.AddMember(ctx, &domain.Membership{OrgID: orgs[1].ID, UserID: "user-1", Role: domain.OrgRoleMember, CreatedAt: now}); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	if err := repo.AddMember(ctx, &domain.Membership{OrgID: orgs[0].ID, UserID: "user-1", Role: domain.OrgRoleOwner, CreatedAt: now.Add(time.Second)}); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	if err := repo.AddMember(ctx, &domain.Membership{OrgID: orgs[0].ID, UserID: "user-1", Role: domain.OrgRoleAdmin}); !errors.Is(err, repository.ErrDuplicateMembership) {
+		t.Errorf("Expected ErrDuplicateMembership, got %v", err)
+	}
+
+	if memberships, _ := repo.ListMemberships(ctx, "user-1"); len(memberships) != 2 || memberships[0].OrgID != orgs[1].ID {
+		t.Errorf("Expected the memberships of the user oldest first, got %d", len(memberships))
+	}
+
+	if err := repo.DeleteMemberships(ctx, "user-1"); err != nil {
+		t.Fatalf("Failed to delete memberships: %v", err)
+	}
+	if members, _ := repo.ListMembers(ctx, orgs[0].ID); len(members) != 0 {
+		t.Errorf("Expected the memberships to be deleted, got %d", len(members))
+	}
+	if err := repo.RemoveMember(ctx, orgs[0].ID, "user-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound when removing a deleted member, got %v", err)
+	}
+}
+
+func TestOAuthProviderRepositoryTokens(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories()
+
+	provider := &domain.OAuthProvider{UserID: "user-1", Provider: "google", ProviderUserID: "123"}
+	if err := repos.OAuthProvider.Create(ctx, provider); err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if err := repos.OAuthProvider.UpdateTokens(ctx, &domain.OAuthProvider{ID: "missing"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	accessToken := "enc:v1:old:access"
+	provider.AccessToken = &accessToken
+	if err := repos.OAuthProvider.UpdateTokens(ctx, provider); err != nil {
+		t.Fatalf("Failed to update tokens: %v", err)
+	}
+	if stale, err := repos.OAuthProvider.ListStaleTokens(ctx, "enc:v1:new:", 10); err != nil || len(stale) != 1 || *stale[0].AccessToken != accessToken {
+		t.Errorf("Expected the access token to be stale, got %v (%v)", stale, err)
+	}
+	if stale, err := repos.OAuthProvider.ListStaleTokens(ctx, "enc:v1:old:", 10); err != nil || len(stale) != 0 {
+		t.Errorf("Expected no stale tokens, got %v (%v)", stale, err)
+	}
+}
+
+func TestIPRuleRepositoryCanonicalCIDR(t *testing.T) {
+	ctx := context.Background()
+	repo := NewIPRuleRepository()
+
+	if err := repo.Create(ctx, &domain.IPRule{CIDR: "10.0.0.0/8", Action: "deny"}); err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+	if err := repo.Create(ctx, &domain.IPRule{CIDR: "10.1.2.3/8", Action: "allow"}); !errors.Is(err, repository.ErrDuplicateIPRule) {
+		t.Errorf("Expected ErrDuplicateIPRule for the same network, got %v", err)
+	}
+
+	rules, err := repo.List(ctx)
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("Expected one rule, got %d (%v)", len(rules), err)
+	}
+	if err := repo.Delete(ctx, rules[0].ID); err != nil {
+		t.Fatalf("Failed to delete rule: %v", err)
+	}
+}
+
+func TestStatsRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories()
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	users := []*domain.User{
+		{Email: "old@example.com", EmailNormalized: "old@example.com", IsActive: true, IsEmailVerified: true, CreatedAt: today.Add(-48*time.Hour + time.Hour)},
+		{Email: "new@example.com", EmailNormalized: "new@example.com", IsActive: true, CreatedAt: today.Add(time.Hour)},
+		{Email: "inactive@example.com", EmailNormalized: "inactive@example.com", CreatedAt: today.Add(2 * time.Hour)},
+	}
+	for _, user := range users {
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	if err := repos.User.UpdateLastLogin(ctx, users[0].ID, ""); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+
+	counts, err := repos.Stats.CountUsers(ctx)
+	if err != nil || *counts != (domain.UserCounts{Total: 3, Active: 2, Verified: 1}) {
+		t.Errorf("Expected 3 users, 2 active and 1 verified, got %+v (%v)", counts, err)
+	}
+	if active, err := repos.Stats.CountActiveUsers(ctx, now.Add(-time.Hour)); err != nil || active != 1 {
+		t.Errorf("Expected 1 active user, got %d (%v)", active, err)
+	}
+
+	registrations, err := repos.Stats.DailyRegistrations(ctx, today.Add(-72*time.Hour))
+	if err != nil || len(registrations) != 2 {
+		t.Fatalf("Expected registrations on 2 days, got %+v (%v)", registrations, err)
+	}
+	if !registrations[0].Day.Equal(today.Add(-48*time.Hour)) || registrations[0].Count != 1 || !registrations[1].Day.Equal(today) || registrations[1].Count != 2 {
+		t.Errorf("Expected 1 registration 2 days ago and 2 today, got %+v", registrations)
+	}
+
+	tokens := []*domain.RefreshToken{
+		{UserID: users[0].ID, TokenHash: "first", ExpiresAt: now.Add(time.Hour)},
+		{UserID: users[1].ID, TokenHash: "expired", ExpiresAt: now.Add(-time.Hour)},
+		{UserID: users[1].ID, TokenHash: "revoked", ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := repos.Token.Create(ctx, token); err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+	}
+	rotated := &domain.RefreshToken{UserID: users[0].ID, SessionID: tokens[0].SessionID, TokenHash: "rotated", ExpiresAt: now.Add(time.Hour)}
+	if err := repos.Token.Create(ctx, rotated); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if err := repos.Token.RevokeByTokenHash(ctx, "revoked", domain.TokenRevokeLogout); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if sessions, err := repos.Stats.CountActiveSessions(ctx, now); err != nil || sessions != 1 {
+		t.Errorf("Expected 1 active session, got %d (%v)", sessions, err)
+	}
+}
+
+func TestUserRepositorySearchByEmail(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories()
+
+	var users []*domain.User
+	for _, email := range []string{"John.Doe@example.com", "jane_doe@example.com", "johnny@example.org", "100%@example.com"} {
+		user := &domain.User{Email: email, EmailNormalized: email}
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{query: "JOHN", limit: 10, want: []string{"John.Doe@example.com", "johnny@example.org"}},
+		{query: "example", limit: 2, want: []string{"100%@example.com", "John.Doe@example.com"}},
+		{query: "e_d", limit: 10, want: []string{"jane_doe@example.com"}},
+		{query: "0%@", limit: 10, want: []string{"100%@example.com"}},
+		{query: "missing", limit: 10, want: nil},
+	}
+	for _, tt := range tests {
+		found, err := repos.User.SearchByEmail(ctx, tt.query, tt.limit)
+		if err != nil {
+			t.Fatalf("Failed to search %q: %v", tt.query, err)
+		}
+		var emails []string
+		for _, user := range found {
+			emails = append(emails, user.Email)
+		}
+		if !slices.Equal(emails, tt.want) {
+			t.Errorf("Expected %v for %q, got %v", tt.want, tt.query, emails)
+		}
+	}
+
+	link := &domain.OAuthProvider{UserID: users[0].ID, Provider: "github", ProviderUserID: "42"}
+	if err := repos.OAuthProvider.Create(ctx, link); err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if links, err := repos.OAuthProvider.ListByProviderUserID(ctx, "42"); err != nil || len(links) != 1 || links[0].ID != link.ID {
+		t.Errorf("Expected the github account, got %v (%v)", links, err)
+	}
+}
+
+func TestUserFlagsRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories()
+
+	var users []*domain.User
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user := &domain.User{Email: email, EmailNormalized: email}
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	if _, err := repos.UserFlags.Get(ctx, users[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound without flags, got %v", err)
+	}
+
+	now := time.Now()
+	for i, flags := range []*domain.UserFlags{
+		{UserID: users[0].ID, Notes: "Disputed a payment", Flags: []string{"chargeback"}, UpdatedAt: now.Add(-time.Hour), UpdatedBy: "admin"},
+		{UserID: users[1].ID, Flags: []string{"abuse-suspect", "chargeback"}, UpdatedAt: now, UpdatedBy: "admin"},
+	} {
+		if err := repos.UserFlags.Save(ctx, flags); err != nil {
+			t.Fatalf("Failed to save flags %d: %v", i, err)
+		}
+	}
+
+	flags, err := repos.UserFlags.Get(ctx, users[0].ID)
+	if err != nil || flags.Notes != "Disputed a payment" || !slices.Equal(flags.Flags, []string{"chargeback"}) || flags.UpdatedBy != "admin" {
+		t.Errorf("Expected the saved flags, got %+v (%v)", flags, err)
+	}
+
+	flagged, err := repos.UserFlags.ListByFlag(ctx, "chargeback", 10)
+	if err != nil || len(flagged) != 2 || flagged[0].UserID != users[1].ID {
+		t.Errorf("Expected both users, last flagged first, got %+v (%v)", flagged, err)
+	}
+	if flagged, err = repos.UserFlags.ListByFlag(ctx, "abuse", 10); err != nil || len(flagged) != 0 {
+		t.Errorf("Expected flags to match exactly, got %+v (%v)", flagged, err)
+	}
+	if listed, err := repos.UserFlags.ListByUserIDs(ctx, []string{users[0].ID, "missing"}); err != nil || len(listed) != 1 || listed[0].UserID != users[0].ID {
+		t.Errorf("Expected the flags of the first user, got %+v (%v)", listed, err)
+	}
+
+	// Saving replaces notes and flags
+	if err := repos.UserFlags.Save(ctx, &domain.UserFlags{UserID: users[0].ID, UpdatedBy: "support"}); err != nil {
+		t.Fatalf("Failed to replace flags: %v", err)
+	}
+	if flags, err = repos.UserFlags.Get(ctx, users[0].ID); err != nil || flags.Notes != "" || len(flags.Flags) != 0 || flags.UpdatedBy != "support" {
+		t.Errorf("Expected the flags to be replaced, got %+v (%v)", flags, err)
+	}
+
+	if err := repos.UserFlags.DeleteByUserID(ctx, users[1].ID); err != nil {
+		t.Fatalf("Failed to delete flags: %v", err)
+	}
+	if _, err := repos.UserFlags.Get(ctx, users[1].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after deletion, got %v", err)
+	}
+}
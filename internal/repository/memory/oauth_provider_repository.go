@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// oauthProviderRepository implements repository.OAuthProviderRepository in memory
+type oauthProviderRepository struct {
+	mu        sync.RWMutex
+	providers map[string]*domain.OAuthProvider
+}
+
+// NewOAuthProviderRepository creates a new in-memory OAuth provider repository
+func NewOAuthProviderRepository() repository.OAuthProviderRepository {
+	return &oauthProviderRepository{providers: make(map[string]*domain.OAuthProvider)}
+}
+
+// Create creates a new OAuth provider connection
+func (r *oauthProviderRepository) Create(ctx context.Context, provider *domain.OAuthProvider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if provider.ID == "" {
+		provider.ID = uuid.New().String()
+	}
+	if provider.CreatedAt.IsZero() {
+		provider.CreatedAt = time.Now()
+	}
+
+	for _, other := range r.providers {
+		if other.Provider == provider.Provider && other.ProviderUserID == provider.ProviderUserID {
+			return fmt.Errorf("oauth provider connection already exists: %w", repository.ErrDuplicateOAuthProvider)
+		}
+	}
+
+	c := *provider
+	r.providers[provider.ID] = &c
+	return nil
+}
+
+// GetByProvider retrieves an OAuth provider connection by provider and provider user ID
+func (r *oauthProviderRepository) GetByProvider(ctx context.Context, provider, providerUserID string) (*domain.OAuthProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.providers {
+		if p.Provider == provider && p.ProviderUserID == providerUserID {
+			c := *p
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("oauth provider connection not found: %w", repository.ErrNotFound)
+}
+
+// GetByUserID retrieves all OAuth provider connections for a user, newest first
+func (r *oauthProviderRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.OAuthProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var providers []*domain.OAuthProvider
+	for _, p := range r.providers {
+		if p.UserID == userID {
+			c := *p
+			providers = append(providers, &c)
+		}
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].CreatedAt.After(providers[j].CreatedAt)
+	})
+	return providers, nil
+}
+
+// ListByProviderUserID retrieves the connections of any provider to the account with providerUserID
+func (r *oauthProviderRepository) ListByProviderUserID(ctx context.Context, providerUserID string) ([]*domain.OAuthProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var providers []*domain.OAuthProvider
+	for _, p := range r.providers {
+		if p.ProviderUserID == providerUserID {
+			c := *p
+			providers = append(providers, &c)
+		}
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Provider < providers[j].Provider
+	})
+	return providers, nil
+}
+
+// UpdateTokens replaces the stored tokens of an OAuth provider connection
+func (r *oauthProviderRepository) UpdateTokens(ctx context.Context, provider *domain.OAuthProvider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.providers[provider.ID]
+	if !ok {
+		return fmt.Errorf("oauth provider with id %s not found: %w", provider.ID, repository.ErrNotFound)
+	}
+	p.AccessToken = provider.AccessToken
+	p.RefreshToken = provider.RefreshToken
+	p.TokenExpiresAt = provider.TokenExpiresAt
+	return nil
+}
+
+// ListStaleTokens lists up to limit connections with a stored token that doesn't start with keyPrefix
+func (r *oauthProviderRepository) ListStaleTokens(ctx context.Context, keyPrefix string, limit int) ([]*domain.OAuthProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stale := func(token *string) bool { return token != nil && !strings.HasPrefix(*token, keyPrefix) }
+
+	var providers []*domain.OAuthProvider
+	for _, p := range r.providers {
+		if stale(p.AccessToken) || stale(p.RefreshToken) {
+			c := *p
+			providers = append(providers, &c)
+		}
+	}
+
+	sort.Slice(providers, func(i, j int) bool { return providers[i].ID < providers[j].ID })
+	if len(providers) > limit {
+		providers = providers[:limit]
+	}
+	return providers, nil
+}
+
+// Delete deletes an OAuth provider connection by ID
+func (r *oauthProviderRepository) Delete(ctx context.Context, providerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[providerID]; !ok {
+		return fmt.Errorf("oauth provider with id %s not found: %w", providerID, repository.ErrNotFound)
+	}
+	delete(r.providers, providerID)
+	return nil
+}
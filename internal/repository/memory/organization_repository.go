@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// organizationRepository implements repository.OrganizationRepository in memory
+type organizationRepository struct {
+	mu            sync.RWMutex
+	organizations map[string]*domain.Organization
+	// memberships are keyed by organization ID, then user ID
+	memberships map[string]map[string]*domain.Membership
+}
+
+// NewOrganizationRepository creates a new in-memory organization repository
+func NewOrganizationRepository() repository.OrganizationRepository {
+	return &organizationRepository{
+		organizations: make(map[string]*domain.Organization),
+		memberships:   make(map[string]map[string]*domain.Membership),
+	}
+}
+
+// Create creates a new organization
+func (r *organizationRepository) Create(ctx context.Context, org *domain.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if org.ID == "" {
+		org.ID = uuid.New().String()
+	}
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = time.Now()
+	}
+
+	c := *org
+	r.organizations[org.ID] = &c
+	r.memberships[org.ID] = make(map[string]*domain.Membership)
+	return nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *organizationRepository) GetByID(ctx context.Context, id string) (*domain.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	org, ok := r.organizations[id]
+	if !ok {
+		return nil, fmt.Errorf("organization with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	c := *org
+	return &c, nil
+}
+
+// Delete deletes an organization along with its memberships
+func (r *organizationRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.organizations[id]; !ok {
+		return fmt.Errorf("organization with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	delete(r.organizations, id)
+	delete(r.memberships, id)
+	return nil
+}
+
+// AddMember adds a user to an organization
+func (r *organizationRepository) AddMember(ctx context.Context, membership *domain.Membership) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, ok := r.memberships[membership.OrgID]
+	if !ok {
+		return fmt.Errorf("failed to add member: organization %s does not exist", membership.OrgID)
+	}
+	if !domain.IsValidOrgRole(membership.Role) {
+		return fmt.Errorf("failed to add member: invalid role %q", membership.Role)
+	}
+	if _, ok := members[membership.UserID]; ok {
+		return fmt.Errorf("user %s is already a member of organization %s: %w", membership.UserID, membership.OrgID, repository.ErrDuplicateMembership)
+	}
+	if membership.CreatedAt.IsZero() {
+		membership.CreatedAt = time.Now()
+	}
+
+	c := *membership
+	members[membership.UserID] = &c
+	return nil
+}
+
+// GetMember retrieves the membership of a user in an organization
+func (r *organizationRepository) GetMember(ctx context.Context, orgID, userID string) (*domain.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	membership, ok := r.memberships[orgID][userID]
+	if !ok {
+		return nil, fmt.Errorf("user %s is not a member of organization %s: %w", userID, orgID, repository.ErrNotFound)
+	}
+	c := *membership
+	return &c, nil
+}
+
+// ListMembers retrieves the members of an organization, oldest first
+func (r *organizationRepository) ListMembers(ctx context.Context, orgID string) ([]*domain.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var memberships []*domain.Membership
+	for _, membership := range r.memberships[orgID] {
+		c := *membership
+		memberships = append(memberships, &c)
+	}
+	sortMemberships(memberships)
+	return memberships, nil
+}
+
+// ListMemberships retrieves the memberships of a user, oldest first
+func (r *organizationRepository) ListMemberships(ctx context.Context, userID string) ([]*domain.Membership, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var memberships []*domain.Membership
+	for _, members := range r.memberships {
+		if membership, ok := members[userID]; ok {
+			c := *membership
+			memberships = append(memberships, &c)
+		}
+	}
+	sortMemberships(memberships)
+	return memberships, nil
+}
+
+// UpdateMemberRole changes the role of a member
+func (r *organizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !domain.IsValidOrgRole(role) {
+		return fmt.Errorf("failed to update member role: invalid role %q", role)
+	}
+	membership, ok := r.memberships[orgID][userID]
+	if !ok {
+		return fmt.Errorf("user %s is not a member of organization %s: %w", userID, orgID, repository.ErrNotFound)
+	}
+	membership.Role = role
+	return nil
+}
+
+// RemoveMember removes a user from an organization
+func (r *organizationRepository) RemoveMember(ctx context.Context, orgID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.memberships[orgID][userID]; !ok {
+		return fmt.Errorf("user %s is not a member of organization %s: %w", userID, orgID, repository.ErrNotFound)
+	}
+	delete(r.memberships[orgID], userID)
+	return nil
+}
+
+// DeleteMemberships deletes the memberships of a user
+func (r *organizationRepository) DeleteMemberships(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, members := range r.memberships {
+		delete(members, userID)
+	}
+	return nil
+}
+
+// sortMemberships sorts memberships oldest first, the organization breaks ties
+// so that the order is stable
+func sortMemberships(memberships []*domain.Membership) {
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+		}
+		return memberships[i].OrgID < memberships[j].OrgID
+	})
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// statsRepository implements repository.StatsRepository over the in-memory users and tokens
+type statsRepository struct {
+	users  *userRepository
+	tokens *tokenRepository
+}
+
+// NewStatsRepository creates a stats repository counting the users and tokens of the given
+// in-memory repositories, created with NewUserRepository and NewTokenRepository
+func NewStatsRepository(users repository.UserRepository, tokens repository.TokenRepository) repository.StatsRepository {
+	return &statsRepository{users: users.(*userRepository), tokens: tokens.(*tokenRepository)}
+}
+
+// CountUsers counts all users, the active ones and those with a verified email
+func (r *statsRepository) CountUsers(ctx context.Context) (*domain.UserCounts, error) {
+	r.users.mu.RLock()
+	defer r.users.mu.RUnlock()
+
+	counts := &domain.UserCounts{Total: int64(len(r.users.users))}
+	for _, user := range r.users.users {
+		if user.IsActive {
+			counts.Active++
+		}
+		if user.IsEmailVerified {
+			counts.Verified++
+		}
+	}
+	return counts, nil
+}
+
+// CountActiveUsers counts the users whose last login is at or after since
+func (r *statsRepository) CountActiveUsers(ctx context.Context, since time.Time) (int64, error) {
+	r.users.mu.RLock()
+	defer r.users.mu.RUnlock()
+
+	var count int64
+	for _, user := range r.users.users {
+		if user.LastLoginAt != nil && !user.LastLoginAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CountActiveSessions counts the sessions with a refresh token neither revoked nor expired at now
+func (r *statsRepository) CountActiveSessions(ctx context.Context, now time.Time) (int64, error) {
+	r.tokens.mu.RLock()
+	defer r.tokens.mu.RUnlock()
+
+	sessions := make(map[string]struct{})
+	for _, token := range r.tokens.tokens {
+		if token.RevokedAt == nil && token.ExpiresAt.After(now) {
+			sessions[token.SessionID] = struct{}{}
+		}
+	}
+	return int64(len(sessions)), nil
+}
+
+// DailyRegistrations counts the users created per UTC day at or after since, oldest first
+func (r *statsRepository) DailyRegistrations(ctx context.Context, since time.Time) ([]domain.DailyCount, error) {
+	r.users.mu.RLock()
+	defer r.users.mu.RUnlock()
+
+	perDay := make(map[time.Time]int64)
+	for _, user := range r.users.users {
+		if !user.CreatedAt.Before(since) {
+			perDay[user.CreatedAt.UTC().Truncate(24*time.Hour)]++
+		}
+	}
+
+	counts := make([]domain.DailyCount, 0, len(perDay))
+	for day, count := range perDay {
+		counts = append(counts, domain.DailyCount{Day: day, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Day.Before(counts[j].Day) })
+	return counts, nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// tenantRepository implements repository.TenantRepository in memory
+type tenantRepository struct {
+	mu      sync.RWMutex
+	tenants map[string]*domain.Tenant
+}
+
+// NewTenantRepository creates a new in-memory tenant repository
+func NewTenantRepository() repository.TenantRepository {
+	return &tenantRepository{tenants: make(map[string]*domain.Tenant)}
+}
+
+// Save creates a tenant or replaces the settings of an existing one
+func (r *tenantRepository) Save(ctx context.Context, tenant *domain.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	tenant.CreatedAt = now
+	if existing, ok := r.tenants[tenant.ID]; ok {
+		tenant.CreatedAt = existing.CreatedAt
+	}
+	tenant.UpdatedAt = now
+
+	r.tenants[tenant.ID] = copyTenant(tenant)
+	return nil
+}
+
+// GetByID retrieves a tenant by ID
+func (r *tenantRepository) GetByID(ctx context.Context, id string) (*domain.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("tenant with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	return copyTenant(tenant), nil
+}
+
+// List retrieves all tenants ordered by ID
+func (r *tenantRepository) List(ctx context.Context) ([]*domain.Tenant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenants := make([]*domain.Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, copyTenant(tenant))
+	}
+
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].ID < tenants[j].ID
+	})
+	return tenants, nil
+}
+
+// Delete deletes a tenant by ID
+func (r *tenantRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tenants[id]; !ok {
+		return fmt.Errorf("tenant with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	delete(r.tenants, id)
+	return nil
+}
+
+// copyTenant copies a tenant along with its lists, so callers can't modify stored ones
+func copyTenant(tenant *domain.Tenant) *domain.Tenant {
+	c := *tenant
+	c.RedirectURLs = slices.Clone(tenant.RedirectURLs)
+	c.AllowedEmailDomains = slices.Clone(tenant.AllowedEmailDomains)
+	return &c
+}
@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// tokenRepository implements repository.TokenRepository in memory
+type tokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[string]*domain.RefreshToken
+}
+
+// NewTokenRepository creates a new in-memory token repository
+func NewTokenRepository() repository.TokenRepository {
+	return &tokenRepository{tokens: make(map[string]*domain.RefreshToken)}
+}
+
+// Create creates a new refresh token
+func (r *tokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.create(token)
+}
+
+// create stores token, the caller holds the lock
+func (r *tokenRepository) create(token *domain.RefreshToken) error {
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	if token.SessionID == "" {
+		token.SessionID = token.ID
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	for _, other := range r.tokens {
+		if other.TokenHash == token.TokenHash {
+			return fmt.Errorf("token with hash already exists: %w", repository.ErrDuplicateToken)
+		}
+	}
+
+	c := *token
+	r.tokens[token.ID] = &c
+	return nil
+}
+
+// GetByTokenHash retrieves a refresh token by its hash
+func (r *tokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.RevokedAt == nil {
+			c := *token
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("token with hash not found: %w", repository.ErrNotFound)
+}
+
+// GetByUserID retrieves all refresh tokens for a user, newest first
+func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tokens []*domain.RefreshToken
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			c := *token
+			tokens = append(tokens, &c)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// Revoke revokes a refresh token by ID
+func (r *tokenRepository) Revoke(ctx context.Context, tokenID, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenID]
+	if !ok || token.RevokedAt != nil {
+		return fmt.Errorf("token with id %s not found: %w", tokenID, repository.ErrNotFound)
+	}
+	revoke(token, time.Now(), reason)
+	return nil
+}
+
+// RevokeByTokenHash revokes a refresh token by its hash
+func (r *tokenRepository) RevokeByTokenHash(ctx context.Context, tokenHash, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.RevokedAt == nil {
+			revoke(token, time.Now(), reason)
+			return nil
+		}
+	}
+	return fmt.Errorf("token with hash not found: %w", repository.ErrNotFound)
+}
+
+// Rotate revokes the refresh token with tokenHash as rotated and creates next, neither happens if one fails
+func (r *tokenRepository) Rotate(ctx context.Context, tokenHash string, next *domain.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rotated *domain.RefreshToken
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.RevokedAt == nil {
+			rotated = token
+			break
+		}
+	}
+	if rotated == nil {
+		return fmt.Errorf("token with hash not found: %w", repository.ErrNotFound)
+	}
+
+	if err := r.create(next); err != nil {
+		return err
+	}
+	revoke(rotated, time.Now(), domain.TokenRevokeRotated)
+	return nil
+}
+
+// RevokeIssuedBefore revokes refresh tokens created before the given time, of all users when userID is empty
+func (r *tokenRepository) RevokeIssuedBefore(ctx context.Context, userID string, before time.Time, reason string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var revoked int64
+	for _, token := range r.tokens {
+		if token.RevokedAt == nil && token.CreatedAt.Before(before) && (userID == "" || token.UserID == userID) {
+			revoke(token, now, reason)
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// Purge deletes refresh tokens that expired or were revoked before the given time
+func (r *tokenRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, token := range r.tokens {
+		if token.ExpiresAt.Before(before) || (token.RevokedAt != nil && token.RevokedAt.Before(before)) {
+			delete(r.tokens, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// revoke marks token revoked at the given time
+func revoke(token *domain.RefreshToken, at time.Time, reason string) {
+	token.RevokedAt = &at
+	token.RevokeReason = &reason
+}
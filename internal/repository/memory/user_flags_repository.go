@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// userFlagsRepository implements repository.UserFlagsRepository in memory
+type userFlagsRepository struct {
+	mu    sync.RWMutex
+	flags map[string]*domain.UserFlags
+}
+
+// NewUserFlagsRepository creates a new in-memory user flags repository
+func NewUserFlagsRepository() repository.UserFlagsRepository {
+	return &userFlagsRepository{flags: make(map[string]*domain.UserFlags)}
+}
+
+// Get retrieves the notes and flags of a user
+func (r *userFlagsRepository) Get(ctx context.Context, userID string) (*domain.UserFlags, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	flags, ok := r.flags[userID]
+	if !ok {
+		return nil, fmt.Errorf("flags of user %s not found: %w", userID, repository.ErrNotFound)
+	}
+	return copyUserFlags(flags), nil
+}
+
+// ListByUserIDs retrieves the notes and flags saved for any of the users
+func (r *userFlagsRepository) ListByUserIDs(ctx context.Context, userIDs []string) ([]*domain.UserFlags, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var all []*domain.UserFlags
+	for _, userID := range userIDs {
+		if flags, ok := r.flags[userID]; ok {
+			all = append(all, copyUserFlags(flags))
+		}
+	}
+	return all, nil
+}
+
+// ListByFlag retrieves up to limit users with the flag, last edited first
+func (r *userFlagsRepository) ListByFlag(ctx context.Context, flag string, limit int) ([]*domain.UserFlags, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var all []*domain.UserFlags
+	for _, flags := range r.flags {
+		if slices.Contains(flags.Flags, flag) {
+			all = append(all, copyUserFlags(flags))
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].UpdatedAt.After(all[j].UpdatedAt)
+	})
+	if len(all) > limit {
+		all = all[:limit]
+	}
+	return all, nil
+}
+
+// Save creates or replaces the notes and flags of a user
+func (r *userFlagsRepository) Save(ctx context.Context, flags *domain.UserFlags) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if flags.UpdatedAt.IsZero() {
+		flags.UpdatedAt = time.Now()
+	}
+	r.flags[flags.UserID] = copyUserFlags(flags)
+	return nil
+}
+
+// DeleteByUserID deletes the notes and flags of a user
+func (r *userFlagsRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.flags, userID)
+	return nil
+}
+
+// copyUserFlags copies the notes and flags of a user, so callers can't modify stored ones
+func copyUserFlags(flags *domain.UserFlags) *domain.UserFlags {
+	c := *flags
+	c.Flags = slices.Clone(flags.Flags)
+	return &c
+}
@@ -0,0 +1,296 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// userRepository implements repository.UserRepository in memory
+type userRepository struct {
+	mu    sync.RWMutex
+	users map[string]*domain.User
+}
+
+// NewUserRepository creates a new in-memory user repository
+func NewUserRepository() repository.UserRepository {
+	return &userRepository{users: make(map[string]*domain.User)}
+}
+
+// Create creates a new user
+func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	if user.Restriction == "" {
+		user.Restriction = domain.RestrictionNone
+	}
+
+	// A primary key violation is reported as a duplicate email by the Postgres repository too
+	if _, exists := r.users[user.ID]; exists {
+		return fmt.Errorf("user with id %s already exists: %w", user.ID, repository.ErrDuplicateEmail)
+	}
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+
+	r.users[user.ID] = copyUser(user)
+	return nil
+}
+
+// GetByEmail retrieves a user by normalized email
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.EmailNormalized == email {
+			return copyUser(user), nil
+		}
+	}
+	return nil, fmt.Errorf("user with email %s not found: %w", email, repository.ErrNotFound)
+}
+
+// GetByID retrieves a user by ID
+func (r *userRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	return copyUser(user), nil
+}
+
+// GetByUsername retrieves a user by username
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Username != nil && *user.Username == username {
+			return copyUser(user), nil
+		}
+	}
+	return nil, fmt.Errorf("user with username %s not found: %w", username, repository.ErrNotFound)
+}
+
+// SearchByEmail returns up to limit users whose email contains query, ignoring case, ordered by email
+func (r *userRepository) SearchByEmail(ctx context.Context, query string, limit int) ([]*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	var users []*domain.User
+	for _, user := range r.users {
+		if strings.Contains(strings.ToLower(user.Email), query) {
+			users = append(users, copyUser(user))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// Update updates an existing user
+func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return fmt.Errorf("user with id %s not found: %w", user.ID, repository.ErrNotFound)
+	}
+	if err := r.checkUnique(user); err != nil {
+		return err
+	}
+
+	// Timestamps are maintained by the repository, like the Postgres trigger does for updated_at
+	updated := copyUser(user)
+	updated.CreatedAt = existing.CreatedAt
+	updated.UpdatedAt = time.Now()
+	updated.LastLoginAt = existing.LastLoginAt
+	updated.LastLoginIP = existing.LastLoginIP
+	updated.PreviousLoginAt = existing.PreviousLoginAt
+	updated.PreviousLoginIP = existing.PreviousLoginIP
+	updated.LoginCount = existing.LoginCount
+	updated.Restriction = existing.Restriction
+	updated.UnverifiedWarnedAt = existing.UnverifiedWarnedAt
+	r.users[user.ID] = updated
+	return nil
+}
+
+// UpdateLastLogin records a login of a user, the last login becomes the previous one
+func (r *userRepository) UpdateLastLogin(ctx context.Context, userID, ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return fmt.Errorf("user with id %s not found: %w", userID, repository.ErrNotFound)
+	}
+
+	now := time.Now()
+	user.PreviousLoginAt, user.PreviousLoginIP = user.LastLoginAt, user.LastLoginIP
+	user.LastLoginAt, user.LastLoginIP = &now, nil
+	if ip != "" {
+		user.LastLoginIP = &ip
+	}
+	user.LoginCount++
+	user.UpdatedAt = now
+	return nil
+}
+
+// SetRestriction sets the restriction level of a user
+func (r *userRepository) SetRestriction(ctx context.Context, userID, restriction string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return fmt.Errorf("user with id %s not found: %w", userID, repository.ErrNotFound)
+	}
+	user.Restriction = restriction
+	return nil
+}
+
+// ListUnverifiedToWarn returns up to limit unverified users created before createdBefore and not warned yet
+func (r *userRepository) ListUnverifiedToWarn(ctx context.Context, createdBefore time.Time, limit int) ([]*domain.User, error) {
+	return r.listUnverified(func(user *domain.User) bool {
+		return user.UnverifiedWarnedAt == nil && user.CreatedAt.Before(createdBefore)
+	}, limit), nil
+}
+
+// ListUnverifiedWarnedBefore returns up to limit unverified users warned before warnedBefore
+func (r *userRepository) ListUnverifiedWarnedBefore(ctx context.Context, warnedBefore time.Time, limit int) ([]*domain.User, error) {
+	return r.listUnverified(func(user *domain.User) bool {
+		return user.UnverifiedWarnedAt != nil && user.UnverifiedWarnedAt.Before(warnedBefore)
+	}, limit), nil
+}
+
+// listUnverified returns up to limit active users matching match whose email was never verified, oldest first
+// Placeholder emails under the reserved .invalid TLD have nothing to verify.
+func (r *userRepository) listUnverified(match func(user *domain.User) bool, limit int) []*domain.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*domain.User
+	for _, user := range r.users {
+		if user.IsActive && !user.IsEmailVerified && !strings.HasSuffix(user.Email, ".invalid") && match(user) {
+			users = append(users, copyUser(user))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users
+}
+
+// MarkUnverifiedWarned records that a user was warned, ErrNotFound if the user doesn't exist or was warned already
+func (r *userRepository) MarkUnverifiedWarned(ctx context.Context, userID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.UnverifiedWarnedAt != nil {
+		return fmt.Errorf("unwarned user with id %s not found: %w", userID, repository.ErrNotFound)
+	}
+	user.UnverifiedWarnedAt = &at
+	return nil
+}
+
+// ListAfter returns up to limit users whose ID sorts after afterID, ordered by ID
+func (r *userRepository) ListAfter(ctx context.Context, afterID string, limit int) ([]*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*domain.User
+	for id, user := range r.users {
+		if id > afterID {
+			users = append(users, copyUser(user))
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// SetEmailNormalized replaces the normalized email of a user
+func (r *userRepository) SetEmailNormalized(ctx context.Context, userID, emailNormalized string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return fmt.Errorf("user with id %s not found: %w", userID, repository.ErrNotFound)
+	}
+	for id, other := range r.users {
+		if id != userID && other.EmailNormalized == emailNormalized {
+			return fmt.Errorf("user with email %s already exists: %w", emailNormalized, repository.ErrDuplicateEmail)
+		}
+	}
+	user.EmailNormalized = emailNormalized
+	return nil
+}
+
+// Delete deletes a user
+// Unlike in Postgres, refresh tokens and OAuth connections of the user are kept, callers delete them
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return fmt.Errorf("user with id %s not found: %w", id, repository.ErrNotFound)
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// checkUnique enforces the unique constraints of the users table
+func (r *userRepository) checkUnique(user *domain.User) error {
+	for id, other := range r.users {
+		if id == user.ID {
+			continue
+		}
+		if other.Email == user.Email || other.EmailNormalized == user.EmailNormalized {
+			return fmt.Errorf("user with email %s already exists: %w", user.Email, repository.ErrDuplicateEmail)
+		}
+		if user.Username != nil && other.Username != nil && *other.Username == *user.Username {
+			return fmt.Errorf("user with username %s already exists: %w", *user.Username, repository.ErrDuplicateUsername)
+		}
+	}
+	return nil
+}
+
+// copyUser returns a copy so callers can't modify stored users without Update
+func copyUser(user *domain.User) *domain.User {
+	c := *user
+	return &c
+}
@@ -13,6 +13,9 @@ import (
 	"github.com/prperemyshlev/auth-service-2/pkg/database"
 )
 
+// oauthProviderColumns are the columns scanned by scanOAuthProvider
+const oauthProviderColumns = `id, user_id, provider, provider_user_id, email, created_at, access_token, refresh_token, token_expires_at`
+
 // oauthProviderRepository implements OAuthProviderRepository interface
 type oauthProviderRepository struct {
 	db *database.Postgres
@@ -24,10 +27,13 @@ func NewOAuthProviderRepository(db *database.Postgres) OAuthProviderRepository {
 }
 
 // Create creates a new OAuth provider connection
-func (r *oauthProviderRepository) Create(ctx context.Context, provider *domain.OAuthProvider) error {
+func (r *oauthProviderRepository) Create(ctx context.Context, provider *domain.OAuthProvider) (err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.Create")
+	defer func() { endSpan(span, err) }()
+
 	query := `
-		INSERT INTO oauth_providers (id, user_id, provider, provider_user_id, email, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO oauth_providers (` + oauthProviderColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	// Generate UUID if not provided
@@ -40,13 +46,16 @@ func (r *oauthProviderRepository) Create(ctx context.Context, provider *domain.O
 		provider.CreatedAt = now
 	}
 
-	_, err := r.db.DB.ExecContext(ctx, query,
+	_, err = r.db.DB.ExecContext(ctx, query,
 		provider.ID,
 		provider.UserID,
 		provider.Provider,
 		provider.ProviderUserID,
 		provider.Email,
 		provider.CreatedAt,
+		provider.AccessToken,
+		provider.RefreshToken,
+		provider.TokenExpiresAt,
 	)
 
 	if err != nil {
@@ -63,25 +72,17 @@ func (r *oauthProviderRepository) Create(ctx context.Context, provider *domain.O
 }
 
 // GetByProvider retrieves an OAuth provider connection by provider and provider user ID
-func (r *oauthProviderRepository) GetByProvider(ctx context.Context, provider, providerUserID string) (*domain.OAuthProvider, error) {
+func (r *oauthProviderRepository) GetByProvider(ctx context.Context, provider, providerUserID string) (_ *domain.OAuthProvider, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.GetByProvider")
+	defer func() { endSpan(span, err) }()
+
 	query := `
-		SELECT id, user_id, provider, provider_user_id, email, created_at
+		SELECT ` + oauthProviderColumns + `
 		FROM oauth_providers
 		WHERE provider = $1 AND provider_user_id = $2
 	`
 
-	oauthProvider := &domain.OAuthProvider{}
-	var email sql.NullString
-
-	err := r.db.DB.QueryRowContext(ctx, query, provider, providerUserID).Scan(
-		&oauthProvider.ID,
-		&oauthProvider.UserID,
-		&oauthProvider.Provider,
-		&oauthProvider.ProviderUserID,
-		&email,
-		&oauthProvider.CreatedAt,
-	)
-
+	oauthProvider, err := scanOAuthProvider(r.db.DB.QueryRowContext(ctx, query, provider, providerUserID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("oauth provider connection not found: %w", ErrNotFound)
@@ -89,17 +90,16 @@ func (r *oauthProviderRepository) GetByProvider(ctx context.Context, provider, p
 		return nil, fmt.Errorf("failed to get oauth provider: %w", err)
 	}
 
-	if email.Valid {
-		oauthProvider.Email = &email.String
-	}
-
 	return oauthProvider, nil
 }
 
 // GetByUserID retrieves all OAuth provider connections for a user
-func (r *oauthProviderRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.OAuthProvider, error) {
+func (r *oauthProviderRepository) GetByUserID(ctx context.Context, userID string) (_ []*domain.OAuthProvider, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.GetByUserID")
+	defer func() { endSpan(span, err) }()
+
 	query := `
-		SELECT id, user_id, provider, provider_user_id, email, created_at
+		SELECT ` + oauthProviderColumns + `
 		FROM oauth_providers
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -109,41 +109,80 @@ func (r *oauthProviderRepository) GetByUserID(ctx context.Context, userID string
 	if err != nil {
 		return nil, fmt.Errorf("failed to get oauth providers by user id: %w", err)
 	}
-	defer rows.Close()
 
-	var providers []*domain.OAuthProvider
-	for rows.Next() {
-		provider := &domain.OAuthProvider{}
-		var email sql.NullString
-
-		err := rows.Scan(
-			&provider.ID,
-			&provider.UserID,
-			&provider.Provider,
-			&provider.ProviderUserID,
-			&email,
-			&provider.CreatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan oauth provider: %w", err)
-		}
+	return collectOAuthProviders(rows)
+}
 
-		if email.Valid {
-			provider.Email = &email.String
-		}
+// ListByProviderUserID retrieves the connections of any provider to the account with providerUserID
+func (r *oauthProviderRepository) ListByProviderUserID(ctx context.Context, providerUserID string) (_ []*domain.OAuthProvider, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.ListByProviderUserID")
+	defer func() { endSpan(span, err) }()
 
-		providers = append(providers, provider)
+	query := `
+		SELECT ` + oauthProviderColumns + `
+		FROM oauth_providers
+		WHERE provider_user_id = $1
+		ORDER BY provider
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, providerUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth providers by provider user id: %w", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate oauth providers: %w", err)
+	return collectOAuthProviders(rows)
+}
+
+// UpdateTokens replaces the stored tokens of an OAuth provider connection
+func (r *oauthProviderRepository) UpdateTokens(ctx context.Context, provider *domain.OAuthProvider) (err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.UpdateTokens")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE oauth_providers SET access_token = $1, refresh_token = $2, token_expires_at = $3 WHERE id = $4`
+
+	result, err := r.db.DB.ExecContext(ctx, query, provider.AccessToken, provider.RefreshToken, provider.TokenExpiresAt, provider.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update oauth provider tokens: %w", err)
 	}
 
-	return providers, nil
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("oauth provider with id %s not found: %w", provider.ID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListStaleTokens lists up to limit connections with a stored token that doesn't start with keyPrefix
+func (r *oauthProviderRepository) ListStaleTokens(ctx context.Context, keyPrefix string, limit int) (_ []*domain.OAuthProvider, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.ListStaleTokens")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT ` + oauthProviderColumns + `
+		FROM oauth_providers
+		WHERE NOT starts_with(access_token, $1) OR NOT starts_with(refresh_token, $1)
+		ORDER BY id
+		LIMIT $2
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, keyPrefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stale oauth provider tokens: %w", err)
+	}
+
+	return collectOAuthProviders(rows)
 }
 
 // Delete deletes an OAuth provider connection by ID
-func (r *oauthProviderRepository) Delete(ctx context.Context, providerID string) error {
+func (r *oauthProviderRepository) Delete(ctx context.Context, providerID string) (err error) {
+	ctx, span := tracer.Start(ctx, "OAuthProviderRepository.Delete")
+	defer func() { endSpan(span, err) }()
+
 	query := `DELETE FROM oauth_providers WHERE id = $1`
 
 	result, err := r.db.DB.ExecContext(ctx, query, providerID)
@@ -162,3 +201,60 @@ func (r *oauthProviderRepository) Delete(ctx context.Context, providerID string)
 
 	return nil
 }
+
+// collectOAuthProviders scans and closes rows of oauthProviderColumns
+func collectOAuthProviders(rows *sql.Rows) ([]*domain.OAuthProvider, error) {
+	defer rows.Close()
+
+	var providers []*domain.OAuthProvider
+	for rows.Next() {
+		provider, err := scanOAuthProvider(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth provider: %w", err)
+		}
+		providers = append(providers, provider)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate oauth providers: %w", err)
+	}
+
+	return providers, nil
+}
+
+// scanOAuthProvider scans an OAuth provider connection from a row of oauthProviderColumns
+func scanOAuthProvider(row interface{ Scan(dest ...any) error }) (*domain.OAuthProvider, error) {
+	provider := &domain.OAuthProvider{}
+	var email, accessToken, refreshToken sql.NullString
+	var tokenExpiresAt sql.NullTime
+
+	err := row.Scan(
+		&provider.ID,
+		&provider.UserID,
+		&provider.Provider,
+		&provider.ProviderUserID,
+		&email,
+		&provider.CreatedAt,
+		&accessToken,
+		&refreshToken,
+		&tokenExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if email.Valid {
+		provider.Email = &email.String
+	}
+	if accessToken.Valid {
+		provider.AccessToken = &accessToken.String
+	}
+	if refreshToken.Valid {
+		provider.RefreshToken = &refreshToken.String
+	}
+	if tokenExpiresAt.Valid {
+		provider.TokenExpiresAt = &tokenExpiresAt.Time
+	}
+
+	return provider, nil
+}
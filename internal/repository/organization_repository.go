@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// organizationRepository implements OrganizationRepository interface
+type organizationRepository struct {
+	db *database.Postgres
+}
+
+// NewOrganizationRepository creates a new organization repository
+func NewOrganizationRepository(db *database.Postgres) OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// Create creates a new organization
+func (r *organizationRepository) Create(ctx context.Context, org *domain.Organization) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	query := `INSERT INTO organizations (id, name, created_at) VALUES ($1, $2, $3)`
+
+	// Generate UUID if not provided
+	if org.ID == "" {
+		org.ID = uuid.New().String()
+	}
+
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = time.Now()
+	}
+
+	if _, err = r.db.DB.ExecContext(ctx, query, org.ID, org.Name, org.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *organizationRepository) GetByID(ctx context.Context, id string) (_ *domain.Organization, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.GetByID")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT id, name, created_at FROM organizations WHERE id = $1`
+
+	org := &domain.Organization{}
+	err = r.db.DB.QueryRowContext(ctx, query, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("organization with id %s not found: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get organization by id: %w", err)
+	}
+
+	return org, nil
+}
+
+// Delete deletes an organization, its memberships are deleted by the foreign key
+func (r *organizationRepository) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.Delete")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM organizations WHERE id = $1`
+
+	result, err := r.db.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("organization with id %s not found: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// AddMember adds a user to an organization
+func (r *organizationRepository) AddMember(ctx context.Context, membership *domain.Membership) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.AddMember")
+	defer func() { endSpan(span, err) }()
+
+	query := `INSERT INTO memberships (org_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)`
+
+	if membership.CreatedAt.IsZero() {
+		membership.CreatedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query, membership.OrgID, membership.UserID, membership.Role, membership.CreatedAt)
+	if err != nil {
+		// Check for primary key violation (user is a member already)
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" { // unique_violation
+				return fmt.Errorf("user %s is already a member of organization %s: %w", membership.UserID, membership.OrgID, ErrDuplicateMembership)
+			}
+		}
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+
+	return nil
+}
+
+// GetMember retrieves the membership of a user in an organization
+func (r *organizationRepository) GetMember(ctx context.Context, orgID, userID string) (_ *domain.Membership, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.GetMember")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = $1 AND user_id = $2`
+
+	membership := &domain.Membership{}
+	err = r.db.DB.QueryRowContext(ctx, query, orgID, userID).Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %s is not a member of organization %s: %w", userID, orgID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+
+	return membership, nil
+}
+
+// ListMembers retrieves the members of an organization, oldest first
+func (r *organizationRepository) ListMembers(ctx context.Context, orgID string) (_ []*domain.Membership, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.ListMembers")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = $1 ORDER BY created_at ASC`
+
+	return r.listMemberships(ctx, query, orgID)
+}
+
+// ListMemberships retrieves the memberships of a user, oldest first
+func (r *organizationRepository) ListMemberships(ctx context.Context, userID string) (_ []*domain.Membership, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.ListMemberships")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE user_id = $1 ORDER BY created_at ASC`
+
+	return r.listMemberships(ctx, query, userID)
+}
+
+// UpdateMemberRole changes the role of a member
+func (r *organizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID, role string) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.UpdateMemberRole")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE memberships SET role = $1 WHERE org_id = $2 AND user_id = $3`
+
+	result, err := r.db.DB.ExecContext(ctx, query, role, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	return requireMembershipAffected(result, orgID, userID)
+}
+
+// RemoveMember removes a user from an organization
+func (r *organizationRepository) RemoveMember(ctx context.Context, orgID, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.RemoveMember")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM memberships WHERE org_id = $1 AND user_id = $2`
+
+	result, err := r.db.DB.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	return requireMembershipAffected(result, orgID, userID)
+}
+
+// DeleteMemberships deletes the memberships of a user
+func (r *organizationRepository) DeleteMemberships(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationRepository.DeleteMemberships")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM memberships WHERE user_id = $1`
+
+	if _, err = r.db.DB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete memberships: %w", err)
+	}
+
+	return nil
+}
+
+// listMemberships runs a query selecting memberships
+func (r *organizationRepository) listMemberships(ctx context.Context, query string, args ...any) ([]*domain.Membership, error) {
+	rows, err := r.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*domain.Membership
+	for rows.Next() {
+		membership := &domain.Membership{}
+		if err := rows.Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		memberships = append(memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate memberships: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// requireMembershipAffected returns ErrNotFound if no membership was changed
+func requireMembershipAffected(result sql.Result, orgID, userID string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user %s is not a member of organization %s: %w", userID, orgID, ErrNotFound)
+	}
+
+	return nil
+}
@@ -9,6 +9,15 @@ type Repositories struct {
 	User          UserRepository
 	Token         TokenRepository
 	OAuthProvider OAuthProviderRepository
+	IPRule        IPRuleRepository
+	Erasure       ErasureRepository
+	Consent       ConsentRepository
+	Identity      IdentityRepository
+	Invitation    InvitationRepository
+	Organization  OrganizationRepository
+	Tenant        TenantRepository
+	Stats         StatsRepository
+	UserFlags     UserFlagsRepository
 }
 
 // NewRepositories creates all repositories
@@ -17,5 +26,14 @@ func NewRepositories(db *database.Postgres) *Repositories {
 		User:          NewUserRepository(db),
 		Token:         NewTokenRepository(db),
 		OAuthProvider: NewOAuthProviderRepository(db),
+		IPRule:        NewIPRuleRepository(db),
+		Erasure:       NewErasureRepository(db),
+		Consent:       NewConsentRepository(db),
+		Identity:      NewIdentityRepository(db),
+		Invitation:    NewInvitationRepository(db),
+		Organization:  NewOrganizationRepository(db),
+		Tenant:        NewTenantRepository(db),
+		Stats:         NewStatsRepository(db),
+		UserFlags:     NewUserFlagsRepository(db),
 	}
 }
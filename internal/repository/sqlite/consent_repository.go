@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// consentRepository implements repository.ConsentRepository on SQLite
+type consentRepository struct {
+	db *database.SQLite
+}
+
+// NewConsentRepository creates a new SQLite consent repository
+func NewConsentRepository(db *database.SQLite) repository.ConsentRepository {
+	return &consentRepository{db: db}
+}
+
+// Create records a consent
+func (r *consentRepository) Create(ctx context.Context, consent *domain.Consent) error {
+	if consent.ID == "" {
+		consent.ID = uuid.New().String()
+	}
+	if consent.AcceptedAt.IsZero() {
+		consent.AcceptedAt = time.Now()
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, `INSERT INTO consents (id, user_id, document, version, accepted_at, ip_address) VALUES (?, ?, ?, ?, ?, ?)`,
+		consent.ID,
+		consent.UserID,
+		consent.Document,
+		consent.Version,
+		utc(consent.AcceptedAt),
+		consent.IPAddress,
+	)
+	if err != nil {
+		if uniqueViolation(err, "consents.user_id") {
+			return fmt.Errorf("consent to %s version %s already exists: %w", consent.Document, consent.Version, repository.ErrDuplicateConsent)
+		}
+		return fmt.Errorf("failed to create consent: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUserID retrieves the consents of a user, oldest first
+func (r *consentRepository) ListByUserID(ctx context.Context, userID string) ([]*domain.Consent, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT id, user_id, document, version, accepted_at, ip_address FROM consents WHERE user_id = ? ORDER BY accepted_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+	defer rows.Close()
+
+	var consents []*domain.Consent
+	for rows.Next() {
+		consent := &domain.Consent{}
+		var ipAddress sql.NullString
+
+		if err := rows.Scan(&consent.ID, &consent.UserID, &consent.Document, &consent.Version, &consent.AcceptedAt, &ipAddress); err != nil {
+			return nil, fmt.Errorf("failed to scan consent: %w", err)
+		}
+
+		if ipAddress.Valid {
+			consent.IPAddress = &ipAddress.String
+		}
+
+		consents = append(consents, consent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate consents: %w", err)
+	}
+
+	return consents, nil
+}
+
+// DeleteByUserID deletes all consents of a user
+func (r *consentRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, err := r.db.DB.ExecContext(ctx, `DELETE FROM consents WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete consents: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const erasureColumns = `id, user_id, email_hash, requested_by, mode, requested_at, erase_after, erased_at`
+
+// erasureRepository implements repository.ErasureRepository on SQLite
+type erasureRepository struct {
+	db *database.SQLite
+}
+
+// NewErasureRepository creates a new SQLite erasure repository
+func NewErasureRepository(db *database.SQLite) repository.ErasureRepository {
+	return &erasureRepository{db: db}
+}
+
+// Create creates a new erasure
+func (r *erasureRepository) Create(ctx context.Context, erasure *domain.Erasure) error {
+	query := `INSERT INTO user_erasures (` + erasureColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if erasure.ID == "" {
+		erasure.ID = uuid.New().String()
+	}
+	if erasure.RequestedAt.IsZero() {
+		erasure.RequestedAt = time.Now()
+	}
+
+	var erasedAt *time.Time
+	if erasure.ErasedAt != nil {
+		t := utc(*erasure.ErasedAt)
+		erasedAt = &t
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, query,
+		erasure.ID,
+		erasure.UserID,
+		erasure.EmailHash,
+		erasure.RequestedBy,
+		erasure.Mode,
+		utc(erasure.RequestedAt),
+		utc(erasure.EraseAfter),
+		erasedAt,
+	)
+	if err != nil {
+		if uniqueViolation(err, "user_erasures.user_id") {
+			return fmt.Errorf("erasure for user %s already exists: %w", erasure.UserID, repository.ErrDuplicateErasure)
+		}
+		return fmt.Errorf("failed to create erasure: %w", err)
+	}
+
+	return nil
+}
+
+// GetByUserID retrieves the erasure of a user
+func (r *erasureRepository) GetByUserID(ctx context.Context, userID string) (*domain.Erasure, error) {
+	query := `SELECT ` + erasureColumns + ` FROM user_erasures WHERE user_id = ?`
+
+	erasure, err := scanErasure(r.db.DB.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("erasure for user %s not found: %w", userID, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get erasure by user id: %w", err)
+	}
+
+	return erasure, nil
+}
+
+// ListDue retrieves pending erasures due at the given time, earliest first
+func (r *erasureRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]*domain.Erasure, error) {
+	query := `SELECT ` + erasureColumns + ` FROM user_erasures WHERE erased_at IS NULL AND erase_after <= ? ORDER BY erase_after LIMIT ?`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, utc(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due erasures: %w", err)
+	}
+	defer rows.Close()
+
+	var erasures []*domain.Erasure
+	for rows.Next() {
+		erasure, err := scanErasure(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan erasure: %w", err)
+		}
+		erasures = append(erasures, erasure)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate erasures: %w", err)
+	}
+
+	return erasures, nil
+}
+
+// MarkErased records that a pending erasure was carried out
+func (r *erasureRepository) MarkErased(ctx context.Context, id string, erasedAt time.Time) error {
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE user_erasures SET erased_at = ? WHERE id = ? AND erased_at IS NULL`, utc(erasedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark erasure as erased: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("pending erasure with id %s", id))
+}
+
+// DeletePending deletes an erasure that wasn't carried out yet
+func (r *erasureRepository) DeletePending(ctx context.Context, id string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM user_erasures WHERE id = ? AND erased_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete erasure: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("pending erasure with id %s", id))
+}
+
+// scanErasure scans a user_erasures row selected with erasureColumns
+func scanErasure(row interface{ Scan(dest ...any) error }) (*domain.Erasure, error) {
+	erasure := &domain.Erasure{}
+	var erasedAt sql.NullTime
+
+	err := row.Scan(
+		&erasure.ID,
+		&erasure.UserID,
+		&erasure.EmailHash,
+		&erasure.RequestedBy,
+		&erasure.Mode,
+		&erasure.RequestedAt,
+		&erasure.EraseAfter,
+		&erasedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if erasedAt.Valid {
+		erasure.ErasedAt = &erasedAt.Time
+	}
+
+	return erasure, nil
+}
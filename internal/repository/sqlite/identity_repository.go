@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// identityRepository implements repository.IdentityRepository on SQLite
+type identityRepository struct {
+	db *database.SQLite
+}
+
+// NewIdentityRepository creates a new SQLite identity repository
+func NewIdentityRepository(db *database.SQLite) repository.IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+// Create links an identity to a user
+func (r *identityRepository) Create(ctx context.Context, identity *domain.Identity) error {
+	if identity.ID == "" {
+		identity.ID = uuid.New().String()
+	}
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, `INSERT INTO identities (id, user_id, type, subject, created_at) VALUES (?, ?, ?, ?, ?)`,
+		identity.ID,
+		identity.UserID,
+		identity.Type,
+		identity.Subject,
+		utc(identity.CreatedAt),
+	)
+	if err != nil {
+		if uniqueViolation(err, "identities.type", "identities.subject") {
+			return fmt.Errorf("%s identity %s already exists: %w", identity.Type, identity.Subject, repository.ErrDuplicateIdentity)
+		}
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// GetBySubject retrieves an identity by type and subject
+func (r *identityRepository) GetBySubject(ctx context.Context, identityType, subject string) (*domain.Identity, error) {
+	identity := &domain.Identity{}
+	err := r.db.DB.QueryRowContext(ctx, `SELECT id, user_id, type, subject, created_at FROM identities WHERE type = ? AND subject = ?`, identityType, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.Type, &identity.Subject, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("identity not found: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// ListByUserID retrieves the identities of a user, oldest first
+func (r *identityRepository) ListByUserID(ctx context.Context, userID string) ([]*domain.Identity, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT id, user_id, type, subject, created_at FROM identities WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []*domain.Identity
+	for rows.Next() {
+		identity := &domain.Identity{}
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Type, &identity.Subject, &identity.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// DeleteByUserID deletes all identities of a user
+func (r *identityRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, err := r.db.DB.ExecContext(ctx, `DELETE FROM identities WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete identities: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const invitationColumns = `id, token_hash, email, email_normalized, role, tenant, invited_by, created_at, expires_at, accepted_at, accepted_by, revoked_at`
+
+// invitationRepository implements repository.InvitationRepository on SQLite
+type invitationRepository struct {
+	db *database.SQLite
+}
+
+// NewInvitationRepository creates a new SQLite invitation repository
+func NewInvitationRepository(db *database.SQLite) repository.InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+// Create creates a new invitation
+func (r *invitationRepository) Create(ctx context.Context, invitation *domain.Invitation) error {
+	query := `INSERT INTO invitations (` + invitationColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if invitation.ID == "" {
+		invitation.ID = uuid.New().String()
+	}
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, query,
+		invitation.ID,
+		invitation.TokenHash,
+		invitation.Email,
+		invitation.EmailNormalized,
+		invitation.Role,
+		invitation.Tenant,
+		invitation.InvitedBy,
+		utc(invitation.CreatedAt),
+		utc(invitation.ExpiresAt),
+		utcPtr(invitation.AcceptedAt),
+		invitation.AcceptedBy,
+		utcPtr(invitation.RevokedAt),
+	)
+	if err != nil {
+		if uniqueViolation(err, "invitations.token_hash") {
+			return fmt.Errorf("invitation token already exists: %w", repository.ErrDuplicateInvitation)
+		}
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an invitation by ID
+func (r *invitationRepository) GetByID(ctx context.Context, id string) (*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE id = ?`
+
+	invitation, err := scanInvitation(r.db.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation with id %s not found: %w", id, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get invitation by id: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// GetByTokenHash retrieves an invitation by the hash of its token
+func (r *invitationRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE token_hash = ?`
+
+	invitation, err := scanInvitation(r.db.DB.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("invitation not found: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get invitation by token hash: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// List retrieves invitations newest first, those created by invitedBy or all when it is empty
+func (r *invitationRepository) List(ctx context.Context, invitedBy string) ([]*domain.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations ORDER BY created_at DESC`
+	var args []any
+	if invitedBy != "" {
+		query = `SELECT ` + invitationColumns + ` FROM invitations WHERE invited_by = ? ORDER BY created_at DESC`
+		args = append(args, invitedBy)
+	}
+
+	rows, err := r.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []*domain.Invitation
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate invitations: %w", err)
+	}
+
+	return invitations, nil
+}
+
+// MarkAccepted records that a user registered with the invitation
+func (r *invitationRepository) MarkAccepted(ctx context.Context, id, userID string, acceptedAt time.Time) error {
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE invitations SET accepted_at = ?, accepted_by = ? WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL`, utc(acceptedAt), userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark invitation as accepted: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("pending invitation with id %s", id))
+}
+
+// Revoke revokes an invitation that wasn't accepted
+func (r *invitationRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) error {
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE invitations SET revoked_at = ? WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL`, utc(revokedAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("pending invitation with id %s", id))
+}
+
+// DeleteByUserID deletes the invitations created or accepted by a user
+func (r *invitationRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, err := r.db.DB.ExecContext(ctx, `DELETE FROM invitations WHERE invited_by = ? OR accepted_by = ?`, userID, userID); err != nil {
+		return fmt.Errorf("failed to delete invitations: %w", err)
+	}
+
+	return nil
+}
+
+// scanInvitation scans an invitations row selected with invitationColumns
+func scanInvitation(row interface{ Scan(dest ...any) error }) (*domain.Invitation, error) {
+	invitation := &domain.Invitation{}
+	var role, tenant, invitedBy, acceptedBy sql.NullString
+	var acceptedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.TokenHash,
+		&invitation.Email,
+		&invitation.EmailNormalized,
+		&role,
+		&tenant,
+		&invitedBy,
+		&invitation.CreatedAt,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&acceptedBy,
+		&revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.Valid {
+		invitation.Role = &role.String
+	}
+	if tenant.Valid {
+		invitation.Tenant = &tenant.String
+	}
+	if invitedBy.Valid {
+		invitation.InvitedBy = &invitedBy.String
+	}
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	if acceptedBy.Valid {
+		invitation.AcceptedBy = &acceptedBy.String
+	}
+	if revokedAt.Valid {
+		invitation.RevokedAt = &revokedAt.Time
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// ipRuleRepository implements repository.IPRuleRepository on SQLite
+type ipRuleRepository struct {
+	db *database.SQLite
+}
+
+// NewIPRuleRepository creates a new SQLite IP rule repository
+func NewIPRuleRepository(db *database.SQLite) repository.IPRuleRepository {
+	return &ipRuleRepository{db: db}
+}
+
+// Create creates a new IP rule
+// CIDRs are stored in canonical form, like the Postgres cidr type does
+func (r *ipRuleRepository) Create(ctx context.Context, rule *domain.IPRule) error {
+	prefix, err := netip.ParsePrefix(rule.CIDR)
+	if err != nil {
+		return fmt.Errorf("failed to create ip rule: invalid cidr %s: %w", rule.CIDR, err)
+	}
+
+	if rule.ID == "" {
+		rule.ID = uuid.New().String()
+	}
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, `INSERT INTO ip_rules (id, cidr, action, comment, created_at) VALUES (?, ?, ?, ?, ?)`,
+		rule.ID,
+		prefix.Masked().String(),
+		rule.Action,
+		rule.Comment,
+		utc(rule.CreatedAt),
+	)
+	if err != nil {
+		if uniqueViolation(err, "ip_rules.cidr") {
+			return fmt.Errorf("ip rule for %s already exists: %w", rule.CIDR, repository.ErrDuplicateIPRule)
+		}
+		return fmt.Errorf("failed to create ip rule: %w", err)
+	}
+
+	return nil
+}
+
+// List retrieves all IP rules, newest first
+func (r *ipRuleRepository) List(ctx context.Context) ([]*domain.IPRule, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT id, cidr, action, comment, created_at FROM ip_rules ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ip rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*domain.IPRule
+	for rows.Next() {
+		rule := &domain.IPRule{}
+		var comment sql.NullString
+
+		if err := rows.Scan(&rule.ID, &rule.CIDR, &rule.Action, &comment, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ip rule: %w", err)
+		}
+
+		if comment.Valid {
+			rule.Comment = &comment.String
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate ip rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Delete deletes an IP rule by ID
+func (r *ipRuleRepository) Delete(ctx context.Context, ruleID string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM ip_rules WHERE id = ?`, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete ip rule: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("ip rule with id %s", ruleID))
+}
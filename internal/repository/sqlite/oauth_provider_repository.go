@@ -0,0 +1,190 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const oauthProviderColumns = `id, user_id, provider, provider_user_id, email, created_at, access_token, refresh_token, token_expires_at`
+
+// oauthProviderRepository implements repository.OAuthProviderRepository on SQLite
+type oauthProviderRepository struct {
+	db *database.SQLite
+}
+
+// NewOAuthProviderRepository creates a new SQLite OAuth provider repository
+func NewOAuthProviderRepository(db *database.SQLite) repository.OAuthProviderRepository {
+	return &oauthProviderRepository{db: db}
+}
+
+// Create creates a new OAuth provider connection
+func (r *oauthProviderRepository) Create(ctx context.Context, provider *domain.OAuthProvider) error {
+	query := `INSERT INTO oauth_providers (` + oauthProviderColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if provider.ID == "" {
+		provider.ID = uuid.New().String()
+	}
+	if provider.CreatedAt.IsZero() {
+		provider.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, query,
+		provider.ID,
+		provider.UserID,
+		provider.Provider,
+		provider.ProviderUserID,
+		provider.Email,
+		utc(provider.CreatedAt),
+		provider.AccessToken,
+		provider.RefreshToken,
+		utcPtr(provider.TokenExpiresAt),
+	)
+	if err != nil {
+		if uniqueViolation(err) {
+			return fmt.Errorf("oauth provider connection already exists: %w", repository.ErrDuplicateOAuthProvider)
+		}
+		return fmt.Errorf("failed to create oauth provider: %w", err)
+	}
+
+	return nil
+}
+
+// GetByProvider retrieves an OAuth provider connection by provider and provider user ID
+func (r *oauthProviderRepository) GetByProvider(ctx context.Context, provider, providerUserID string) (*domain.OAuthProvider, error) {
+	query := `SELECT ` + oauthProviderColumns + ` FROM oauth_providers WHERE provider = ? AND provider_user_id = ?`
+
+	oauthProvider, err := scanOAuthProvider(r.db.DB.QueryRowContext(ctx, query, provider, providerUserID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("oauth provider connection not found: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get oauth provider: %w", err)
+	}
+
+	return oauthProvider, nil
+}
+
+// GetByUserID retrieves all OAuth provider connections for a user
+func (r *oauthProviderRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.OAuthProvider, error) {
+	query := `SELECT ` + oauthProviderColumns + ` FROM oauth_providers WHERE user_id = ? ORDER BY created_at DESC`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth providers by user id: %w", err)
+	}
+
+	return collectOAuthProviders(rows)
+}
+
+// ListByProviderUserID retrieves the connections of any provider to the account with providerUserID
+func (r *oauthProviderRepository) ListByProviderUserID(ctx context.Context, providerUserID string) ([]*domain.OAuthProvider, error) {
+	query := `SELECT ` + oauthProviderColumns + ` FROM oauth_providers WHERE provider_user_id = ? ORDER BY provider`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, providerUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth providers by provider user id: %w", err)
+	}
+
+	return collectOAuthProviders(rows)
+}
+
+// UpdateTokens replaces the stored tokens of an OAuth provider connection
+func (r *oauthProviderRepository) UpdateTokens(ctx context.Context, provider *domain.OAuthProvider) error {
+	query := `UPDATE oauth_providers SET access_token = ?, refresh_token = ?, token_expires_at = ? WHERE id = ?`
+
+	result, err := r.db.DB.ExecContext(ctx, query, provider.AccessToken, provider.RefreshToken, utcPtr(provider.TokenExpiresAt), provider.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update oauth provider tokens: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("oauth provider with id %s", provider.ID))
+}
+
+// ListStaleTokens lists up to limit connections with a stored token that doesn't start with keyPrefix
+func (r *oauthProviderRepository) ListStaleTokens(ctx context.Context, keyPrefix string, limit int) ([]*domain.OAuthProvider, error) {
+	query := `SELECT ` + oauthProviderColumns + ` FROM oauth_providers
+		WHERE substr(access_token, 1, length(?)) <> ? OR substr(refresh_token, 1, length(?)) <> ?
+		ORDER BY id LIMIT ?`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, keyPrefix, keyPrefix, keyPrefix, keyPrefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stale oauth provider tokens: %w", err)
+	}
+
+	return collectOAuthProviders(rows)
+}
+
+// Delete deletes an OAuth provider connection by ID
+func (r *oauthProviderRepository) Delete(ctx context.Context, providerID string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM oauth_providers WHERE id = ?`, providerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth provider: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("oauth provider with id %s", providerID))
+}
+
+// collectOAuthProviders scans and closes rows of oauthProviderColumns
+func collectOAuthProviders(rows *sql.Rows) ([]*domain.OAuthProvider, error) {
+	defer rows.Close()
+
+	var providers []*domain.OAuthProvider
+	for rows.Next() {
+		provider, err := scanOAuthProvider(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan oauth provider: %w", err)
+		}
+		providers = append(providers, provider)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate oauth providers: %w", err)
+	}
+
+	return providers, nil
+}
+
+// scanOAuthProvider scans an oauth_providers row selected with oauthProviderColumns
+func scanOAuthProvider(row interface{ Scan(dest ...any) error }) (*domain.OAuthProvider, error) {
+	provider := &domain.OAuthProvider{}
+	var email, accessToken, refreshToken sql.NullString
+	var tokenExpiresAt sql.NullTime
+
+	err := row.Scan(
+		&provider.ID,
+		&provider.UserID,
+		&provider.Provider,
+		&provider.ProviderUserID,
+		&email,
+		&provider.CreatedAt,
+		&accessToken,
+		&refreshToken,
+		&tokenExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if email.Valid {
+		provider.Email = &email.String
+	}
+	if accessToken.Valid {
+		provider.AccessToken = &accessToken.String
+	}
+	if refreshToken.Valid {
+		provider.RefreshToken = &refreshToken.String
+	}
+	if tokenExpiresAt.Valid {
+		provider.TokenExpiresAt = &tokenExpiresAt.Time
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// organizationRepository implements repository.OrganizationRepository on SQLite
+type organizationRepository struct {
+	db *database.SQLite
+}
+
+// NewOrganizationRepository creates a new SQLite organization repository
+func NewOrganizationRepository(db *database.SQLite) repository.OrganizationRepository {
+	return &organizationRepository{db: db}
+}
+
+// Create creates a new organization
+func (r *organizationRepository) Create(ctx context.Context, org *domain.Organization) error {
+	if org.ID == "" {
+		org.ID = uuid.New().String()
+	}
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = time.Now()
+	}
+
+	if _, err := r.db.DB.ExecContext(ctx, `INSERT INTO organizations (id, name, created_at) VALUES (?, ?, ?)`, org.ID, org.Name, utc(org.CreatedAt)); err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves an organization by ID
+func (r *organizationRepository) GetByID(ctx context.Context, id string) (*domain.Organization, error) {
+	org := &domain.Organization{}
+	err := r.db.DB.QueryRowContext(ctx, `SELECT id, name, created_at FROM organizations WHERE id = ?`, id).Scan(&org.ID, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("organization with id %s not found: %w", id, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get organization by id: %w", err)
+	}
+
+	return org, nil
+}
+
+// Delete deletes an organization, its memberships are deleted by the foreign key
+func (r *organizationRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM organizations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("organization with id %s", id))
+}
+
+// AddMember adds a user to an organization
+func (r *organizationRepository) AddMember(ctx context.Context, membership *domain.Membership) error {
+	if membership.CreatedAt.IsZero() {
+		membership.CreatedAt = time.Now()
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, `INSERT INTO memberships (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`,
+		membership.OrgID, membership.UserID, membership.Role, utc(membership.CreatedAt))
+	if err != nil {
+		if uniqueViolation(err, "memberships.org_id") {
+			return fmt.Errorf("user %s is already a member of organization %s: %w", membership.UserID, membership.OrgID, repository.ErrDuplicateMembership)
+		}
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+
+	return nil
+}
+
+// GetMember retrieves the membership of a user in an organization
+func (r *organizationRepository) GetMember(ctx context.Context, orgID, userID string) (*domain.Membership, error) {
+	query := `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = ? AND user_id = ?`
+
+	membership := &domain.Membership{}
+	err := r.db.DB.QueryRowContext(ctx, query, orgID, userID).Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %s is not a member of organization %s: %w", userID, orgID, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+
+	return membership, nil
+}
+
+// ListMembers retrieves the members of an organization, oldest first
+func (r *organizationRepository) ListMembers(ctx context.Context, orgID string) ([]*domain.Membership, error) {
+	return r.listMemberships(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE org_id = ? ORDER BY created_at ASC`, orgID)
+}
+
+// ListMemberships retrieves the memberships of a user, oldest first
+func (r *organizationRepository) ListMemberships(ctx context.Context, userID string) ([]*domain.Membership, error) {
+	return r.listMemberships(ctx, `SELECT org_id, user_id, role, created_at FROM memberships WHERE user_id = ? ORDER BY created_at ASC`, userID)
+}
+
+// UpdateMemberRole changes the role of a member
+func (r *organizationRepository) UpdateMemberRole(ctx context.Context, orgID, userID, role string) error {
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE memberships SET role = ? WHERE org_id = ? AND user_id = ?`, role, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("member %s of organization %s", userID, orgID))
+}
+
+// RemoveMember removes a user from an organization
+func (r *organizationRepository) RemoveMember(ctx context.Context, orgID, userID string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM memberships WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("member %s of organization %s", userID, orgID))
+}
+
+// DeleteMemberships deletes the memberships of a user
+func (r *organizationRepository) DeleteMemberships(ctx context.Context, userID string) error {
+	if _, err := r.db.DB.ExecContext(ctx, `DELETE FROM memberships WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete memberships: %w", err)
+	}
+
+	return nil
+}
+
+// listMemberships runs a query selecting memberships
+func (r *organizationRepository) listMemberships(ctx context.Context, query string, args ...any) ([]*domain.Membership, error) {
+	rows, err := r.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	defer rows.Close()
+
+	var memberships []*domain.Membership
+	for rows.Next() {
+		membership := &domain.Membership{}
+		if err := rows.Scan(&membership.OrgID, &membership.UserID, &membership.Role, &membership.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		memberships = append(memberships, membership)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate memberships: %w", err)
+	}
+
+	return memberships, nil
+}
@@ -0,0 +1,67 @@
+// Package sqlite implements the repository interfaces on top of SQLite
+// It backs lightweight single-node deployments and hermetic tests, see database.NewSQLite.
+package sqlite
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// NewRepositories creates all repositories backed by db
+func NewRepositories(db *database.SQLite) *repository.Repositories {
+	return &repository.Repositories{
+		User:          NewUserRepository(db),
+		Token:         NewTokenRepository(db),
+		OAuthProvider: NewOAuthProviderRepository(db),
+		IPRule:        NewIPRuleRepository(db),
+		Erasure:       NewErasureRepository(db),
+		Consent:       NewConsentRepository(db),
+		Identity:      NewIdentityRepository(db),
+		Invitation:    NewInvitationRepository(db),
+		Organization:  NewOrganizationRepository(db),
+		Tenant:        NewTenantRepository(db),
+		Stats:         NewStatsRepository(db),
+		UserFlags:     NewUserFlagsRepository(db),
+	}
+}
+
+// uniqueViolation reports whether err is a unique constraint violation,
+// optionally restricted to one of the given table.column names
+func uniqueViolation(err error, columns ...string) bool {
+	msg := err.Error()
+	if !strings.Contains(msg, "UNIQUE constraint failed") {
+		return false
+	}
+	if len(columns) == 0 {
+		return true
+	}
+	for _, column := range columns {
+		if strings.Contains(msg, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignKeyViolation reports whether err is a foreign key constraint violation
+func foreignKeyViolation(err error) bool {
+	return strings.Contains(err.Error(), "FOREIGN KEY constraint failed")
+}
+
+// utc converts t for storage, SQLite compares timestamps as text
+// so all of them must share the same time zone
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// utcPtr converts an optional t for storage like utc
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	converted := utc(*t)
+	return &converted
+}
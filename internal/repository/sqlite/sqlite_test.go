@@ -0,0 +1,812 @@
+//go:build sqlite
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	sqlitemigrations "github.com/prperemyshlev/auth-service-2/migrations/sqlite"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+func newTestDB(t *testing.T) *database.SQLite {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.Migrate(sqlitemigrations.FS); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestUserRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	user := &domain.User{Email: "User@Example.com", EmailNormalized: "user@example.com", PasswordHash: "hash", IsActive: true, Username: stringPtr("alice")}
+	if err := repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		user *domain.User
+		want error
+	}{
+		{name: "same normalized email", user: &domain.User{Email: "user+tag@example.com", EmailNormalized: "user@example.com"}, want: repository.ErrDuplicateEmail},
+		{name: "same username", user: &domain.User{Email: "bob@example.com", EmailNormalized: "bob@example.com", Username: stringPtr("alice")}, want: repository.ErrDuplicateUsername},
+		{name: "unique", user: &domain.User{Email: "bob@example.com", EmailNormalized: "bob@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repos.User.Create(ctx, tt.user); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	found, err := repos.User.GetByEmail(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("Failed to get user by email: %v", err)
+	}
+	if found.ID != user.ID || !found.IsActive || found.LastLoginAt != nil || !found.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("Unexpected user: %+v", found)
+	}
+
+	found.Username = stringPtr("carol")
+	if err := repos.User.Update(ctx, found); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, err := repos.User.GetByUsername(ctx, "alice"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected old username to be free, got %v", err)
+	}
+	if err := repos.User.Update(ctx, &domain.User{ID: "missing"}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing user, got %v", err)
+	}
+
+	if err := repos.User.UpdateLastLogin(ctx, user.ID, "192.0.2.1"); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+	if err := repos.User.UpdateLastLogin(ctx, user.ID, ""); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+	if found, _ := repos.User.GetByID(ctx, user.ID); found.LastLoginAt == nil || found.LastLoginIP != nil || found.LoginCount != 2 ||
+		found.PreviousLoginAt == nil || found.PreviousLoginIP == nil || *found.PreviousLoginIP != "192.0.2.1" {
+		t.Errorf("Expected the login to be recorded, got %+v", found)
+	}
+
+	if found.Restriction != domain.RestrictionNone {
+		t.Errorf("Expected users to be unrestricted by default, got %q", found.Restriction)
+	}
+	if err := repos.User.SetRestriction(ctx, user.ID, domain.RestrictionBanned); err != nil {
+		t.Fatalf("Failed to set restriction: %v", err)
+	}
+	// Update leaves the restriction alone
+	if err := repos.User.Update(ctx, found); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if found, _ := repos.User.GetByID(ctx, user.ID); found.Restriction != domain.RestrictionBanned {
+		t.Errorf("Expected the user to be banned, got %q", found.Restriction)
+	}
+	if err := repos.User.SetRestriction(ctx, "missing", domain.RestrictionBanned); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing user, got %v", err)
+	}
+}
+
+func TestTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com"}
+	if err := repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	tokens := []*domain.RefreshToken{
+		{UserID: user.ID, TokenHash: "old", ExpiresAt: now.Add(time.Hour), CreatedAt: now.Add(-time.Minute)},
+		{UserID: user.ID, TokenHash: "new", ExpiresAt: now.Add(time.Hour), CreatedAt: now, DeviceInfo: stringPtr("curl"), DeviceFingerprint: stringPtr("fingerprint")},
+		{UserID: user.ID, TokenHash: "expired", ExpiresAt: now.Add(-time.Second), CreatedAt: now.Add(-time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := repos.Token.Create(ctx, token); err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+	}
+	if err := repos.Token.Create(ctx, &domain.RefreshToken{UserID: user.ID, TokenHash: "old"}); !errors.Is(err, repository.ErrDuplicateToken) {
+		t.Errorf("Expected ErrDuplicateToken, got %v", err)
+	}
+
+	if tokens[0].SessionID != tokens[0].ID {
+		t.Errorf("Expected a token without session to start one, got %q", tokens[0].SessionID)
+	}
+	rotated := &domain.RefreshToken{UserID: tokens[0].UserID, SessionID: tokens[0].SessionID, TokenHash: "rotated", ExpiresAt: now.Add(time.Hour)}
+	if err := repos.Token.Create(ctx, rotated); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if stored, err := repos.Token.GetByTokenHash(ctx, "rotated"); err != nil || stored.SessionID != tokens[0].ID {
+		t.Errorf("Expected the session to be kept, got %+v %v", stored, err)
+	}
+	if err := repos.Token.RevokeByTokenHash(ctx, "rotated", domain.TokenRevokeRotated); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if _, err := repos.Token.GetByTokenHash(ctx, "rotated"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected revoked token to be hidden, got %v", err)
+	}
+
+	userTokens, err := repos.Token.GetByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get tokens: %v", err)
+	}
+	if len(userTokens) != 3 || userTokens[0].TokenHash != "new" || userTokens[0].DeviceInfo == nil || *userTokens[0].DeviceFingerprint != "fingerprint" {
+		t.Errorf("Expected tokens newest first, got %d tokens", len(userTokens))
+	}
+
+	// Revoked tokens are kept until they are purged after the retention
+	if purged, err := repos.Token.Purge(ctx, now.Add(-time.Minute)); err != nil || purged != 0 {
+		t.Errorf("Expected no tokens to be purged within the retention, got %d %v", purged, err)
+	}
+	if purged, err := repos.Token.Purge(ctx, time.Now()); err != nil || purged != 2 {
+		t.Errorf("Expected the expired and the revoked token to be purged, got %d %v", purged, err)
+	}
+	if _, err := repos.Token.GetByTokenHash(ctx, "old"); err != nil {
+		t.Errorf("Expected valid token to be kept, got %v", err)
+	}
+
+	if revoked, err := repos.Token.RevokeIssuedBefore(ctx, user.ID, now.Add(-30*time.Second), domain.TokenRevokeRevocation); err != nil || revoked != 1 {
+		t.Errorf("Expected the token created a minute ago to be revoked, got %d %v", revoked, err)
+	}
+	if revoked, err := repos.Token.RevokeIssuedBefore(ctx, "other-user", now.Add(time.Minute), domain.TokenRevokeRevocation); err != nil || revoked != 0 {
+		t.Errorf("Expected tokens of other users to be kept, got %d %v", revoked, err)
+	}
+
+	if err := repos.Token.Revoke(ctx, tokens[1].ID, domain.TokenRevokeSession); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if err := repos.Token.RevokeByTokenHash(ctx, "new", domain.TokenRevokeLogout); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a revoked token, got %v", err)
+	}
+}
+
+func TestErasureRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com"}
+	if err := repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := repos.Token.Create(ctx, &domain.RefreshToken{UserID: user.ID, TokenHash: "hash", ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	due := &domain.Erasure{UserID: user.ID, EmailHash: "hash", RequestedBy: domain.ErasureRequestedByUser, Mode: domain.ErasureModeDelete, EraseAfter: now.Add(-time.Minute)}
+	later := &domain.Erasure{UserID: "other-user", EmailHash: "hash", RequestedBy: domain.ErasureRequestedByUser, Mode: domain.ErasureModeDelete, EraseAfter: now.Add(time.Hour)}
+	for _, erasure := range []*domain.Erasure{due, later} {
+		if err := repos.Erasure.Create(ctx, erasure); err != nil {
+			t.Fatalf("Failed to create erasure: %v", err)
+		}
+	}
+	if err := repos.Erasure.Create(ctx, &domain.Erasure{UserID: user.ID, EmailHash: "hash", RequestedBy: domain.ErasureRequestedByAdmin, Mode: domain.ErasureModeDelete, EraseAfter: now}); !errors.Is(err, repository.ErrDuplicateErasure) {
+		t.Errorf("Expected ErrDuplicateErasure, got %v", err)
+	}
+
+	pending, err := repos.Erasure.ListDue(ctx, now, 10)
+	if err != nil || len(pending) != 1 || pending[0].ID != due.ID {
+		t.Fatalf("Expected only the due erasure, got %d erasures %v", len(pending), err)
+	}
+
+	// Refresh tokens go along with the user
+	if err := repos.User.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if _, err := repos.Token.GetByTokenHash(ctx, "hash"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected tokens of the deleted user to be deleted, got %v", err)
+	}
+
+	if err := repos.Erasure.MarkErased(ctx, due.ID, now); err != nil {
+		t.Fatalf("Failed to mark erasure: %v", err)
+	}
+	if err := repos.Erasure.MarkErased(ctx, due.ID, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a carried out erasure, got %v", err)
+	}
+	tombstone, err := repos.Erasure.GetByUserID(ctx, user.ID)
+	if err != nil || tombstone.IsPending() {
+		t.Fatalf("Expected a tombstone of the deleted user, got %v", err)
+	}
+	if err := repos.Erasure.DeletePending(ctx, tombstone.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected tombstones to be kept, got %v", err)
+	}
+	if err := repos.Erasure.DeletePending(ctx, later.ID); err != nil {
+		t.Errorf("Failed to delete pending erasure: %v", err)
+	}
+}
+
+func TestConsentRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com"}
+	if err := repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	ip := "192.0.2.1"
+	consents := []*domain.Consent{
+		{UserID: user.ID, Document: domain.ConsentDocumentPrivacy, Version: "v1", AcceptedAt: now, IPAddress: &ip},
+		{UserID: user.ID, Document: domain.ConsentDocumentTerms, Version: "v1", AcceptedAt: now.Add(-time.Hour)},
+	}
+	for _, consent := range consents {
+		if err := repos.Consent.Create(ctx, consent); err != nil {
+			t.Fatalf("Failed to create consent: %v", err)
+		}
+	}
+	if err := repos.Consent.Create(ctx, &domain.Consent{UserID: user.ID, Document: domain.ConsentDocumentTerms, Version: "v1"}); !errors.Is(err, repository.ErrDuplicateConsent) {
+		t.Errorf("Expected ErrDuplicateConsent, got %v", err)
+	}
+
+	listed, err := repos.Consent.ListByUserID(ctx, user.ID)
+	if err != nil || len(listed) != 2 || listed[0].Document != domain.ConsentDocumentTerms {
+		t.Fatalf("Expected consents oldest first, got %d consents %v", len(listed), err)
+	}
+	if listed[1].IPAddress == nil || *listed[1].IPAddress != ip {
+		t.Errorf("Expected the IP address to be kept, got %v", listed[1].IPAddress)
+	}
+
+	// Consents go along with the user
+	if err := repos.User.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if listed, _ := repos.Consent.ListByUserID(ctx, user.ID); len(listed) != 0 {
+		t.Errorf("Expected consents of the deleted user to be deleted, got %d", len(listed))
+	}
+}
+
+func TestIdentityRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com"}
+	other := &domain.User{Email: "other@example.com", EmailNormalized: "other@example.com"}
+	for _, u := range []*domain.User{user, other} {
+		if err := repos.User.Create(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	identities := []*domain.Identity{
+		{UserID: user.ID, Type: domain.IdentityTypeEthereum, Subject: "0xB", CreatedAt: now},
+		{UserID: user.ID, Type: domain.IdentityTypeEthereum, Subject: "0xA", CreatedAt: now.Add(-time.Hour)},
+	}
+	for _, identity := range identities {
+		if err := repos.Identity.Create(ctx, identity); err != nil {
+			t.Fatalf("Failed to create identity: %v", err)
+		}
+	}
+	if err := repos.Identity.Create(ctx, &domain.Identity{UserID: other.ID, Type: domain.IdentityTypeEthereum, Subject: "0xA"}); !errors.Is(err, repository.ErrDuplicateIdentity) {
+		t.Errorf("Expected ErrDuplicateIdentity, got %v", err)
+	}
+
+	found, err := repos.Identity.GetBySubject(ctx, domain.IdentityTypeEthereum, "0xA")
+	if err != nil || found.UserID != user.ID {
+		t.Fatalf("Expected the identity of the user, got %v %v", found, err)
+	}
+	if _, err := repos.Identity.GetBySubject(ctx, domain.IdentityTypeEthereum, "0xC"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	listed, err := repos.Identity.ListByUserID(ctx, user.ID)
+	if err != nil || len(listed) != 2 || listed[0].Subject != "0xA" {
+		t.Fatalf("Expected identities oldest first, got %d identities %v", len(listed), err)
+	}
+
+	// Identities go along with the user
+	if err := repos.User.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if listed, _ := repos.Identity.ListByUserID(ctx, user.ID); len(listed) != 0 {
+		t.Errorf("Expected identities of the deleted user to be deleted, got %d", len(listed))
+	}
+}
+
+func TestInvitationRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	inviter := &domain.User{Email: "inviter@example.com", EmailNormalized: "inviter@example.com"}
+	invitee := &domain.User{Email: "invitee@example.com", EmailNormalized: "invitee@example.com"}
+	for _, user := range []*domain.User{inviter, invitee} {
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	role := "member"
+	invitation := &domain.Invitation{TokenHash: "hash", Email: "invitee@example.com", EmailNormalized: "invitee@example.com", Role: &role, InvitedBy: &inviter.ID, ExpiresAt: now.Add(time.Hour)}
+	if err := repos.Invitation.Create(ctx, invitation); err != nil {
+		t.Fatalf("Failed to create invitation: %v", err)
+	}
+	if err := repos.Invitation.Create(ctx, &domain.Invitation{TokenHash: "hash", Email: "other@example.com", EmailNormalized: "other@example.com", ExpiresAt: now}); !errors.Is(err, repository.ErrDuplicateInvitation) {
+		t.Errorf("Expected ErrDuplicateInvitation, got %v", err)
+	}
+
+	if err := repos.Invitation.MarkAccepted(ctx, invitation.ID, invitee.ID, now); err != nil {
+		t.Fatalf("Failed to accept invitation: %v", err)
+	}
+	if err := repos.Invitation.Revoke(ctx, invitation.ID, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected accepted invitations not to be revoked, got %v", err)
+	}
+
+	stored, err := repos.Invitation.GetByTokenHash(ctx, "hash")
+	if err != nil {
+		t.Fatalf("Failed to get invitation: %v", err)
+	}
+	if stored.Role == nil || *stored.Role != role || stored.AcceptedBy == nil || *stored.AcceptedBy != invitee.ID {
+		t.Errorf("Unexpected invitation %+v", stored)
+	}
+	if stored.Status(now) != domain.InvitationStatusAccepted {
+		t.Errorf("Expected an accepted invitation, got %s", stored.Status(now))
+	}
+
+	// Invitations go along with the inviter
+	if err := repos.User.Delete(ctx, inviter.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if listed, _ := repos.Invitation.List(ctx, ""); len(listed) != 0 {
+		t.Errorf("Expected invitations of the deleted inviter to be deleted, got %d", len(listed))
+	}
+}
+
+func TestOrganizationRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	owner := &domain.User{Email: "owner@example.com", EmailNormalized: "owner@example.com"}
+	member := &domain.User{Email: "member@example.com", EmailNormalized: "member@example.com"}
+	for _, user := range []*domain.User{owner, member} {
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	org := &domain.Organization{Name: "Acme"}
+	if err := repos.Organization.Create(ctx, org); err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	if err := repos.Organization.AddMember(ctx, &domain.Membership{OrgID: org.ID, UserID: owner.ID, Role: domain.OrgRoleOwner, CreatedAt: now}); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+	if err := repos.Organization.AddMember(ctx, &domain.Membership{OrgID: org.ID, UserID: member.ID, Role: domain.OrgRoleMember, CreatedAt: now.Add(time.Second)}); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	if err := repos.Organization.AddMember(ctx, &domain.Membership{OrgID: org.ID, UserID: member.ID, Role: domain.OrgRoleAdmin}); !errors.Is(err, repository.ErrDuplicateMembership) {
+		t.Errorf("Expected ErrDuplicateMembership, got %v", err)
+	}
+	if err := repos.Organization.AddMember(ctx, &domain.Membership{OrgID: org.ID, UserID: owner.ID, Role: "superuser"}); err == nil {
+		t.Error("Expected unknown roles to be rejected")
+	}
+
+	if err := repos.Organization.UpdateMemberRole(ctx, org.ID, member.ID, domain.OrgRoleAdmin); err != nil {
+		t.Fatalf("Failed to update role: %v", err)
+	}
+	members, err := repos.Organization.ListMembers(ctx, org.ID)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("Expected 2 members, got %d %v", len(members), err)
+	}
+	if members[0].UserID != owner.ID || members[1].Role != domain.OrgRoleAdmin {
+		t.Errorf("Unexpected members %+v %+v", members[0], members[1])
+	}
+
+	if err := repos.Organization.RemoveMember(ctx, org.ID, member.ID); err != nil {
+		t.Fatalf("Failed to remove member: %v", err)
+	}
+	if _, err := repos.Organization.GetMember(ctx, org.ID, member.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a removed member, got %v", err)
+	}
+	if err := repos.Organization.UpdateMemberRole(ctx, org.ID, member.ID, domain.OrgRoleOwner); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound when updating a removed member, got %v", err)
+	}
+
+	// Memberships go along with the organization
+	if err := repos.Organization.Delete(ctx, org.ID); err != nil {
+		t.Fatalf("Failed to delete organization: %v", err)
+	}
+	if memberships, _ := repos.Organization.ListMemberships(ctx, owner.ID); len(memberships) != 0 {
+		t.Errorf("Expected memberships of the deleted organization to be deleted, got %d", len(memberships))
+	}
+}
+
+func TestOAuthProviderRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com"}
+	if err := repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	provider := &domain.OAuthProvider{UserID: user.ID, Provider: "google", ProviderUserID: "123"}
+	if err := repos.OAuthProvider.Create(ctx, provider); err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if err := repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: user.ID, Provider: "google", ProviderUserID: "123"}); !errors.Is(err, repository.ErrDuplicateOAuthProvider) {
+		t.Errorf("Expected ErrDuplicateOAuthProvider, got %v", err)
+	}
+	if err := repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: "missing", Provider: "google", ProviderUserID: "456"}); err == nil {
+		t.Error("Expected foreign key violation for a missing user")
+	}
+
+	found, err := repos.OAuthProvider.GetByProvider(ctx, "google", "123")
+	if err != nil || found.UserID != user.ID {
+		t.Fatalf("Failed to get provider: %v", err)
+	}
+	if found.AccessToken != nil || found.TokenExpiresAt != nil {
+		t.Errorf("Expected no tokens, got %+v", found)
+	}
+
+	accessToken, refreshToken := "enc:v1:old:access", "enc:v1:new:refresh"
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	provider.AccessToken, provider.RefreshToken, provider.TokenExpiresAt = &accessToken, &refreshToken, &expiresAt
+	if err := repos.OAuthProvider.UpdateTokens(ctx, provider); err != nil {
+		t.Fatalf("Failed to update tokens: %v", err)
+	}
+	found, err = repos.OAuthProvider.GetByProvider(ctx, "google", "123")
+	if err != nil || found.AccessToken == nil || *found.AccessToken != accessToken || !found.TokenExpiresAt.Equal(expiresAt) {
+		t.Fatalf("Expected stored tokens, got %+v (%v)", found, err)
+	}
+	if stale, err := repos.OAuthProvider.ListStaleTokens(ctx, "enc:v1:old:", 10); err != nil || len(stale) != 1 {
+		t.Errorf("Expected the refresh token to be stale, got %d (%v)", len(stale), err)
+	}
+	if stale, err := repos.OAuthProvider.ListStaleTokens(ctx, "enc:v1:new:", 10); err != nil || len(stale) != 1 {
+		t.Errorf("Expected the access token to be stale, got %d (%v)", len(stale), err)
+	}
+	provider.AccessToken = &refreshToken
+	if err := repos.OAuthProvider.UpdateTokens(ctx, provider); err != nil {
+		t.Fatalf("Failed to update tokens: %v", err)
+	}
+	if stale, err := repos.OAuthProvider.ListStaleTokens(ctx, "enc:v1:new:", 10); err != nil || len(stale) != 0 {
+		t.Errorf("Expected no stale tokens, got %d (%v)", len(stale), err)
+	}
+
+	if err := repos.OAuthProvider.Delete(ctx, provider.ID); err != nil {
+		t.Fatalf("Failed to delete provider: %v", err)
+	}
+}
+
+func TestIPRuleRepositoryCanonicalCIDR(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	if err := repos.IPRule.Create(ctx, &domain.IPRule{CIDR: "10.0.0.0/8", Action: "deny"}); err != nil {
+		t.Fatalf("Failed to create rule: %v", err)
+	}
+	if err := repos.IPRule.Create(ctx, &domain.IPRule{CIDR: "10.1.2.3/8", Action: "allow"}); !errors.Is(err, repository.ErrDuplicateIPRule) {
+		t.Errorf("Expected ErrDuplicateIPRule for the same network, got %v", err)
+	}
+
+	rules, err := repos.IPRule.List(ctx)
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("Expected one rule, got %d (%v)", len(rules), err)
+	}
+	if err := repos.IPRule.Delete(ctx, rules[0].ID); err != nil {
+		t.Fatalf("Failed to delete rule: %v", err)
+	}
+}
+
+func TestTenantRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	tenant := &domain.Tenant{ID: "acme", Name: "Acme", RedirectURLs: []string{"https://app.acme.test/auth"}}
+	if err := repos.Tenant.Save(ctx, tenant); err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+	createdAt := tenant.CreatedAt
+
+	// Saving again replaces the settings and keeps the creation time
+	tenant.CookieDomain = stringPtr(".acme.test")
+	tenant.RedirectURLs = nil
+	tenant.AllowedEmailDomains = []string{"acme.test", "*.acme.test"}
+	if err := repos.Tenant.Save(ctx, tenant); err != nil {
+		t.Fatalf("Failed to update tenant: %v", err)
+	}
+
+	found, err := repos.Tenant.GetByID(ctx, "acme")
+	if err != nil {
+		t.Fatalf("Failed to get tenant: %v", err)
+	}
+	if found.CookieDomain == nil || *found.CookieDomain != ".acme.test" || len(found.RedirectURLs) != 0 || len(found.AllowedEmailDomains) != 2 {
+		t.Errorf("Unexpected tenant %+v", found)
+	}
+	if !found.CreatedAt.Equal(createdAt) {
+		t.Errorf("Expected creation time %v to be kept, got %v", createdAt, found.CreatedAt)
+	}
+
+	if tenants, err := repos.Tenant.List(ctx); err != nil || len(tenants) != 1 {
+		t.Fatalf("Expected one tenant, got %d (%v)", len(tenants), err)
+	}
+	if err := repos.Tenant.Delete(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to delete tenant: %v", err)
+	}
+	if _, err := repos.Tenant.GetByID(ctx, "acme"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a deleted tenant, got %v", err)
+	}
+}
+
+func TestStatsRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	users := []*domain.User{
+		{Email: "old@example.com", EmailNormalized: "old@example.com", IsActive: true, IsEmailVerified: true, CreatedAt: today.Add(-48*time.Hour + time.Hour)},
+		{Email: "new@example.com", EmailNormalized: "new@example.com", IsActive: true, CreatedAt: today.Add(time.Hour)},
+		{Email: "inactive@example.com", EmailNormalized: "inactive@example.com", CreatedAt: today.Add(2 * time.Hour)},
+	}
+	for _, user := range users {
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	if err := repos.User.UpdateLastLogin(ctx, users[0].ID, ""); err != nil {
+		t.Fatalf("Failed to update last login: %v", err)
+	}
+
+	counts, err := repos.Stats.CountUsers(ctx)
+	if err != nil || *counts != (domain.UserCounts{Total: 3, Active: 2, Verified: 1}) {
+		t.Errorf("Expected 3 users, 2 active and 1 verified, got %+v (%v)", counts, err)
+	}
+	if active, err := repos.Stats.CountActiveUsers(ctx, now.Add(-time.Hour)); err != nil || active != 1 {
+		t.Errorf("Expected 1 active user, got %d (%v)", active, err)
+	}
+
+	registrations, err := repos.Stats.DailyRegistrations(ctx, today.Add(-72*time.Hour))
+	if err != nil || len(registrations) != 2 {
+		t.Fatalf("Expected registrations on 2 days, got %+v (%v)", registrations, err)
+	}
+	if !registrations[0].Day.Equal(today.Add(-48*time.Hour)) || registrations[0].Count != 1 || !registrations[1].Day.Equal(today) || registrations[1].Count != 2 {
+		t.Errorf("Expected 1 registration 2 days ago and 2 today, got %+v", registrations)
+	}
+
+	tokens := []*domain.RefreshToken{
+		{UserID: users[0].ID, TokenHash: "first", ExpiresAt: now.Add(time.Hour)},
+		{UserID: users[1].ID, TokenHash: "expired", ExpiresAt: now.Add(-time.Hour)},
+		{UserID: users[1].ID, TokenHash: "revoked", ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, token := range tokens {
+		if err := repos.Token.Create(ctx, token); err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+	}
+	rotated := &domain.RefreshToken{UserID: users[0].ID, SessionID: tokens[0].SessionID, TokenHash: "rotated", ExpiresAt: now.Add(time.Hour)}
+	if err := repos.Token.Create(ctx, rotated); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if err := repos.Token.RevokeByTokenHash(ctx, "revoked", domain.TokenRevokeLogout); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+	if sessions, err := repos.Stats.CountActiveSessions(ctx, now); err != nil || sessions != 1 {
+		t.Errorf("Expected 1 active session, got %d (%v)", sessions, err)
+	}
+}
+
+func TestUserRepositorySearchByEmail(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	var users []*domain.User
+	for _, email := range []string{"John.Doe@example.com", "jane_doe@example.com", "johnny@example.org", "100%@example.com"} {
+		user := &domain.User{Email: email, EmailNormalized: email}
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		{query: "JOHN", limit: 10, want: []string{"John.Doe@example.com", "johnny@example.org"}},
+		{query: "example", limit: 2, want: []string{"100%@example.com", "John.Doe@example.com"}},
+		{query: "e_d", limit: 10, want: []string{"jane_doe@example.com"}},
+		{query: "0%@", limit: 10, want: []string{"100%@example.com"}},
+		{query: "missing", limit: 10, want: nil},
+	}
+	for _, tt := range tests {
+		found, err := repos.User.SearchByEmail(ctx, tt.query, tt.limit)
+		if err != nil {
+			t.Fatalf("Failed to search %q: %v", tt.query, err)
+		}
+		var emails []string
+		for _, user := range found {
+			emails = append(emails, user.Email)
+		}
+		if !slices.Equal(emails, tt.want) {
+			t.Errorf("Expected %v for %q, got %v", tt.want, tt.query, emails)
+		}
+	}
+
+	link := &domain.OAuthProvider{UserID: users[0].ID, Provider: "github", ProviderUserID: "42"}
+	if err := repos.OAuthProvider.Create(ctx, link); err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if links, err := repos.OAuthProvider.ListByProviderUserID(ctx, "42"); err != nil || len(links) != 1 || links[0].ID != link.ID {
+		t.Errorf("Expected the github account, got %v (%v)", links, err)
+	}
+}
+
+func TestUserRepositoryUnverified(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+	now := time.Now()
+
+	users := map[string]*domain.User{}
+	for _, user := range []*domain.User{
+		{Email: "old@example.com", IsActive: true, CreatedAt: now.Add(-72 * time.Hour)},
+		{Email: "older@example.com", IsActive: true, CreatedAt: now.Add(-96 * time.Hour)},
+		{Email: "new@example.com", IsActive: true, CreatedAt: now},
+		{Email: "verified@example.com", IsActive: true, IsEmailVerified: true, CreatedAt: now.Add(-72 * time.Hour)},
+		{Email: "inactive@example.com", CreatedAt: now.Add(-72 * time.Hour)},
+		{Email: "0xabc@wallet.invalid", IsActive: true, CreatedAt: now.Add(-72 * time.Hour)},
+	} {
+		user.EmailNormalized = user.Email
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users[user.Email] = user
+	}
+
+	found, err := repos.User.ListUnverifiedToWarn(ctx, now.Add(-time.Hour), 10)
+	if err != nil || len(found) != 2 || found[0].Email != "older@example.com" || found[1].Email != "old@example.com" {
+		t.Fatalf("Expected the old unverified users, oldest first, got %v (%v)", found, err)
+	}
+
+	if err := repos.User.MarkUnverifiedWarned(ctx, users["older@example.com"].ID, now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Failed to mark user warned: %v", err)
+	}
+	if err := repos.User.MarkUnverifiedWarned(ctx, users["older@example.com"].ID, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a user warned already, got %v", err)
+	}
+	if found, err := repos.User.ListUnverifiedToWarn(ctx, now.Add(-time.Hour), 10); err != nil || len(found) != 1 || found[0].Email != "old@example.com" {
+		t.Errorf("Expected warned users to be left out, got %v (%v)", found, err)
+	}
+
+	found, err = repos.User.ListUnverifiedWarnedBefore(ctx, now.Add(-time.Hour), 10)
+	if err != nil || len(found) != 1 || found[0].Email != "older@example.com" || found[0].UnverifiedWarnedAt == nil {
+		t.Fatalf("Expected the warned user, got %v (%v)", found, err)
+	}
+	if found, err := repos.User.ListUnverifiedWarnedBefore(ctx, now.Add(-72*time.Hour), 10); err != nil || len(found) != 0 {
+		t.Errorf("Expected users warned later to be left out, got %v (%v)", found, err)
+	}
+
+	// Erasures of expired accounts are recorded as requested by retention
+	erasure := &domain.Erasure{UserID: users["older@example.com"].ID, EmailHash: "hash", RequestedBy: domain.ErasureRequestedByRetention, Mode: domain.ErasureModeDelete, EraseAfter: now}
+	if err := repos.Erasure.Create(ctx, erasure); err != nil {
+		t.Errorf("Failed to create retention erasure: %v", err)
+	}
+}
+
+func TestUserFlagsRepository(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	var users []*domain.User
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user := &domain.User{Email: email, EmailNormalized: email}
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	if _, err := repos.UserFlags.Get(ctx, users[0].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound without flags, got %v", err)
+	}
+
+	now := time.Now()
+	for i, flags := range []*domain.UserFlags{
+		{UserID: users[0].ID, Notes: "Disputed a payment", Flags: []string{"chargeback"}, UpdatedAt: now.Add(-time.Hour), UpdatedBy: "admin"},
+		{UserID: users[1].ID, Flags: []string{"abuse-suspect", "chargeback"}, UpdatedAt: now, UpdatedBy: "admin"},
+	} {
+		if err := repos.UserFlags.Save(ctx, flags); err != nil {
+			t.Fatalf("Failed to save flags %d: %v", i, err)
+		}
+	}
+
+	flags, err := repos.UserFlags.Get(ctx, users[0].ID)
+	if err != nil || flags.Notes != "Disputed a payment" || !slices.Equal(flags.Flags, []string{"chargeback"}) || flags.UpdatedBy != "admin" {
+		t.Errorf("Expected the saved flags, got %+v (%v)", flags, err)
+	}
+
+	flagged, err := repos.UserFlags.ListByFlag(ctx, "chargeback", 10)
+	if err != nil || len(flagged) != 2 || flagged[0].UserID != users[1].ID {
+		t.Errorf("Expected both users, last flagged first, got %+v (%v)", flagged, err)
+	}
+	if flagged, err = repos.UserFlags.ListByFlag(ctx, "abuse", 10); err != nil || len(flagged) != 0 {
+		t.Errorf("Expected flags to match exactly, got %+v (%v)", flagged, err)
+	}
+	if listed, err := repos.UserFlags.ListByUserIDs(ctx, []string{users[0].ID, "missing"}); err != nil || len(listed) != 1 || listed[0].UserID != users[0].ID {
+		t.Errorf("Expected the flags of the first user, got %+v (%v)", listed, err)
+	}
+
+	// Saving replaces notes and flags
+	if err := repos.UserFlags.Save(ctx, &domain.UserFlags{UserID: users[0].ID, UpdatedBy: "support"}); err != nil {
+		t.Fatalf("Failed to replace flags: %v", err)
+	}
+	if flags, err = repos.UserFlags.Get(ctx, users[0].ID); err != nil || flags.Notes != "" || len(flags.Flags) != 0 || flags.UpdatedBy != "support" {
+		t.Errorf("Expected the flags to be replaced, got %+v (%v)", flags, err)
+	}
+
+	if err := repos.UserFlags.DeleteByUserID(ctx, users[1].ID); err != nil {
+		t.Fatalf("Failed to delete flags: %v", err)
+	}
+	if _, err := repos.UserFlags.Get(ctx, users[1].ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after deletion, got %v", err)
+	}
+
+	err = repos.UserFlags.Save(ctx, &domain.UserFlags{UserID: "00000000-0000-0000-0000-000000000000", UpdatedBy: "admin"})
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown user, got %v", err)
+	}
+}
+
+func TestUserRepositoryNormalizedEmails(t *testing.T) {
+	ctx := context.Background()
+	repos := NewRepositories(newTestDB(t))
+
+	var ids []string
+	for _, email := range []string{"first.last@gmail.com", "firstlast@gmail.com", "other@example.com"} {
+		user := &domain.User{Email: email, EmailNormalized: email, IsActive: true}
+		if err := repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		ids = append(ids, user.ID)
+	}
+	slices.Sort(ids)
+
+	first, err := repos.User.ListAfter(ctx, "", 2)
+	if err != nil || len(first) != 2 || first[0].ID != ids[0] || first[1].ID != ids[1] {
+		t.Fatalf("Expected the first batch by ID, got %v (%v)", first, err)
+	}
+	if rest, err := repos.User.ListAfter(ctx, first[1].ID, 2); err != nil || len(rest) != 1 || rest[0].ID != ids[2] {
+		t.Errorf("Expected the users after the first batch, got %v (%v)", rest, err)
+	}
+
+	dotted, err := repos.User.GetByEmail(ctx, "first.last@gmail.com")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if err := repos.User.SetEmailNormalized(ctx, dotted.ID, "firstlast@gmail.com"); !errors.Is(err, repository.ErrDuplicateEmail) {
+		t.Errorf("Expected ErrDuplicateEmail for the normalized email of another user, got %v", err)
+	}
+	if err := repos.User.SetEmailNormalized(ctx, dotted.ID, "first.last+x@gmail.com"); err != nil {
+		t.Fatalf("Failed to set normalized email: %v", err)
+	}
+	if found, err := repos.User.GetByEmail(ctx, "first.last+x@gmail.com"); err != nil || found.ID != dotted.ID || found.Email != "first.last@gmail.com" {
+		t.Errorf("Expected the user under its new normalized email, got %+v (%v)", found, err)
+	}
+}
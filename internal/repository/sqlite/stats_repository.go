@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// statsRepository implements repository.StatsRepository on SQLite
+type statsRepository struct {
+	db *database.SQLite
+}
+
+// NewStatsRepository creates a new SQLite stats repository
+func NewStatsRepository(db *database.SQLite) repository.StatsRepository {
+	return &statsRepository{db: db}
+}
+
+// CountUsers counts all users, the active ones and those with a verified email
+func (r *statsRepository) CountUsers(ctx context.Context) (*domain.UserCounts, error) {
+	query := `SELECT COUNT(*), COALESCE(SUM(is_active), 0), COALESCE(SUM(is_email_verified), 0) FROM users`
+
+	counts := &domain.UserCounts{}
+	if err := r.db.DB.QueryRowContext(ctx, query).Scan(&counts.Total, &counts.Active, &counts.Verified); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	return counts, nil
+}
+
+// CountActiveUsers counts the users whose last login is at or after since
+func (r *statsRepository) CountActiveUsers(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	if err := r.db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE last_login_at >= ?`, utc(since)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active users: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveSessions counts the sessions with a refresh token neither revoked nor expired at now
+func (r *statsRepository) CountActiveSessions(ctx context.Context, now time.Time) (int64, error) {
+	query := `SELECT COUNT(DISTINCT session_id) FROM refresh_tokens WHERE revoked_at IS NULL AND expires_at > ?`
+
+	var count int64
+	if err := r.db.DB.QueryRowContext(ctx, query, utc(now)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+	return count, nil
+}
+
+// DailyRegistrations counts the users created per UTC day at or after since, oldest first
+// Timestamps are stored in UTC as text, their first 10 characters are the day.
+func (r *statsRepository) DailyRegistrations(ctx context.Context, since time.Time) ([]domain.DailyCount, error) {
+	query := `
+		SELECT substr(created_at, 1, 10) AS day, COUNT(*)
+		FROM users
+		WHERE created_at >= ?
+		GROUP BY day
+		ORDER BY day
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, utc(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count registrations: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.DailyCount
+	for rows.Next() {
+		var day string
+		var count domain.DailyCount
+		if err := rows.Scan(&day, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan registrations: %w", err)
+		}
+		if count.Day, err = time.Parse(time.DateOnly, day); err != nil {
+			return nil, fmt.Errorf("failed to parse registration day %q: %w", day, err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate registrations: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,177 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const tenantColumns = `id, name, email_from, brand_name, logo_url, brand_color, redirect_urls, cookie_domain, allowed_email_domains, created_at, updated_at`
+
+// tenantRepository implements repository.TenantRepository on SQLite
+type tenantRepository struct {
+	db *database.SQLite
+}
+
+// NewTenantRepository creates a new SQLite tenant repository
+func NewTenantRepository(db *database.SQLite) repository.TenantRepository {
+	return &tenantRepository{db: db}
+}
+
+// Save creates a tenant or replaces the settings of an existing one
+func (r *tenantRepository) Save(ctx context.Context, tenant *domain.Tenant) error {
+	query := `
+		INSERT INTO tenants (` + tenantColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			email_from = excluded.email_from,
+			brand_name = excluded.brand_name,
+			logo_url = excluded.logo_url,
+			brand_color = excluded.brand_color,
+			redirect_urls = excluded.redirect_urls,
+			cookie_domain = excluded.cookie_domain,
+			allowed_email_domains = excluded.allowed_email_domains,
+			updated_at = excluded.updated_at
+		RETURNING created_at, updated_at
+	`
+
+	redirectURLs, err := encodeStrings(tenant.RedirectURLs)
+	if err != nil {
+		return fmt.Errorf("failed to encode redirect urls: %w", err)
+	}
+	allowedEmailDomains, err := encodeStrings(tenant.AllowedEmailDomains)
+	if err != nil {
+		return fmt.Errorf("failed to encode allowed email domains: %w", err)
+	}
+
+	now := utc(time.Now())
+	err = r.db.DB.QueryRowContext(ctx, query,
+		tenant.ID,
+		tenant.Name,
+		tenant.EmailFrom,
+		tenant.BrandName,
+		tenant.LogoURL,
+		tenant.BrandColor,
+		redirectURLs,
+		tenant.CookieDomain,
+		allowedEmailDomains,
+		now,
+		now,
+	).Scan(&tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save tenant: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a tenant by ID
+func (r *tenantRepository) GetByID(ctx context.Context, id string) (*domain.Tenant, error) {
+	tenant, err := scanTenant(r.db.DB.QueryRowContext(ctx, `SELECT `+tenantColumns+` FROM tenants WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("tenant with id %s not found: %w", id, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get tenant by id: %w", err)
+	}
+
+	return tenant, nil
+}
+
+// List retrieves all tenants ordered by ID
+func (r *tenantRepository) List(ctx context.Context) ([]*domain.Tenant, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []*domain.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %w", err)
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tenants: %w", err)
+	}
+
+	return tenants, nil
+}
+
+// Delete deletes a tenant by ID
+func (r *tenantRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM tenants WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("tenant with id %s", id))
+}
+
+// scanTenant scans a tenants row selected with tenantColumns
+func scanTenant(row interface{ Scan(dest ...any) error }) (*domain.Tenant, error) {
+	tenant := &domain.Tenant{}
+	var emailFrom, brandName, logoURL, brandColor, cookieDomain sql.NullString
+	var redirectURLs, allowedEmailDomains string
+
+	err := row.Scan(
+		&tenant.ID,
+		&tenant.Name,
+		&emailFrom,
+		&brandName,
+		&logoURL,
+		&brandColor,
+		&redirectURLs,
+		&cookieDomain,
+		&allowedEmailDomains,
+		&tenant.CreatedAt,
+		&tenant.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(redirectURLs), &tenant.RedirectURLs); err != nil {
+		return nil, fmt.Errorf("failed to decode redirect urls: %w", err)
+	}
+	if err := json.Unmarshal([]byte(allowedEmailDomains), &tenant.AllowedEmailDomains); err != nil {
+		return nil, fmt.Errorf("failed to decode allowed email domains: %w", err)
+	}
+	if emailFrom.Valid {
+		tenant.EmailFrom = &emailFrom.String
+	}
+	if brandName.Valid {
+		tenant.BrandName = &brandName.String
+	}
+	if logoURL.Valid {
+		tenant.LogoURL = &logoURL.String
+	}
+	if brandColor.Valid {
+		tenant.BrandColor = &brandColor.String
+	}
+	if cookieDomain.Valid {
+		tenant.CookieDomain = &cookieDomain.String
+	}
+
+	return tenant, nil
+}
+
+// encodeStrings encodes a list as a JSON array, empty for nil lists
+func encodeStrings(values []string) (string, error) {
+	if values == nil {
+		return "[]", nil
+	}
+	encoded, err := json.Marshal(values)
+	return string(encoded), err
+}
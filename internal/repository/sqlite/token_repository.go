@@ -0,0 +1,232 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const tokenColumns = `id, user_id, session_id, token_hash, expires_at, created_at, device_info, ip_address, device_fingerprint`
+
+// tokenRepository implements repository.TokenRepository on SQLite
+type tokenRepository struct {
+	db *database.SQLite
+}
+
+// NewTokenRepository creates a new SQLite token repository
+func NewTokenRepository(db *database.SQLite) repository.TokenRepository {
+	return &tokenRepository{db: db}
+}
+
+// execer runs statements on the database or within a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Create creates a new refresh token in the database
+func (r *tokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	return r.create(ctx, r.db.DB, token)
+}
+
+// create inserts token with db
+func (r *tokenRepository) create(ctx context.Context, db execer, token *domain.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (` + tokenColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	if token.SessionID == "" {
+		token.SessionID = token.ID
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	_, err := db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.SessionID,
+		token.TokenHash,
+		utc(token.ExpiresAt),
+		utc(token.CreatedAt),
+		token.DeviceInfo,
+		token.IPAddress,
+		token.DeviceFingerprint,
+	)
+	if err != nil {
+		if uniqueViolation(err, "refresh_tokens.token_hash") {
+			return fmt.Errorf("token with hash already exists: %w", repository.ErrDuplicateToken)
+		}
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return nil
+}
+
+// GetByTokenHash retrieves a refresh token by its hash
+func (r *tokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	query := `SELECT ` + tokenColumns + ` FROM refresh_tokens WHERE token_hash = ? AND revoked_at IS NULL`
+
+	token, err := scanToken(r.db.DB.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("token with hash not found: %w", repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get token by hash: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetByUserID retrieves all refresh tokens for a user, newest first
+func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.RefreshToken, error) {
+	query := `SELECT ` + tokenColumns + ` FROM refresh_tokens WHERE user_id = ? AND revoked_at IS NULL ORDER BY created_at DESC`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokens by user id: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*domain.RefreshToken
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Revoke revokes a refresh token by ID
+func (r *tokenRepository) Revoke(ctx context.Context, tokenID, reason string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ?, revoke_reason = ? WHERE id = ? AND revoked_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, utc(time.Now()), reason, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("token with id %s", tokenID))
+}
+
+// RevokeByTokenHash revokes a refresh token by its hash
+func (r *tokenRepository) RevokeByTokenHash(ctx context.Context, tokenHash, reason string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ?, revoke_reason = ? WHERE token_hash = ? AND revoked_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, utc(time.Now()), reason, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token by hash: %w", err)
+	}
+
+	return requireAffected(result, "token with hash")
+}
+
+// Rotate revokes the refresh token with tokenHash as rotated and creates next in one transaction
+func (r *tokenRepository) Rotate(ctx context.Context, tokenHash string, next *domain.RefreshToken) error {
+	tx, err := r.db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin token rotation: %w", err)
+	}
+	// Rolling back after the commit is a no-op
+	defer func() { _ = tx.Rollback() }()
+
+	query := `UPDATE refresh_tokens SET revoked_at = ?, revoke_reason = ? WHERE token_hash = ? AND revoked_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, utc(time.Now()), domain.TokenRevokeRotated, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke rotated token: %w", err)
+	}
+	if err := requireAffected(result, "token with hash"); err != nil {
+		return err
+	}
+
+	if err := r.create(ctx, tx, next); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit token rotation: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeIssuedBefore revokes refresh tokens created before the given time, of all users when userID is empty
+func (r *tokenRepository) RevokeIssuedBefore(ctx context.Context, userID string, before time.Time, reason string) (int64, error) {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = ?, revoke_reason = ?
+		WHERE revoked_at IS NULL AND created_at < ? AND (? = '' OR user_id = ?)
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, utc(time.Now()), reason, utc(before), userID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke tokens issued before %s: %w", before, err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke tokens issued before %s: %w", before, err)
+	}
+	return revoked, nil
+}
+
+// Purge deletes refresh tokens that expired or were revoked before the given time
+func (r *tokenRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at < ? OR revoked_at < ?`, utc(before), utc(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge tokens: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge tokens: %w", err)
+	}
+	return purged, nil
+}
+
+// scanToken scans a refresh_tokens row selected with tokenColumns
+func scanToken(row interface{ Scan(dest ...any) error }) (*domain.RefreshToken, error) {
+	token := &domain.RefreshToken{}
+	var deviceInfo, ipAddress, deviceFingerprint sql.NullString
+
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.SessionID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&deviceInfo,
+		&ipAddress,
+		&deviceFingerprint,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if deviceInfo.Valid {
+		token.DeviceInfo = &deviceInfo.String
+	}
+	if ipAddress.Valid {
+		token.IPAddress = &ipAddress.String
+	}
+	if deviceFingerprint.Valid {
+		token.DeviceFingerprint = &deviceFingerprint.String
+	}
+
+	return token, nil
+}
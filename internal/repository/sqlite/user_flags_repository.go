@@ -0,0 +1,153 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const userFlagsColumns = `user_id, notes, flags, updated_at, updated_by`
+
+// userFlagsRepository implements repository.UserFlagsRepository on SQLite
+type userFlagsRepository struct {
+	db *database.SQLite
+}
+
+// NewUserFlagsRepository creates a new SQLite user flags repository
+func NewUserFlagsRepository(db *database.SQLite) repository.UserFlagsRepository {
+	return &userFlagsRepository{db: db}
+}
+
+// Get retrieves the notes and flags of a user
+func (r *userFlagsRepository) Get(ctx context.Context, userID string) (*domain.UserFlags, error) {
+	query := `SELECT ` + userFlagsColumns + ` FROM user_flags WHERE user_id = ?`
+
+	flags, err := scanUserFlags(r.db.DB.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("flags of user %s not found: %w", userID, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user flags: %w", err)
+	}
+	return flags, nil
+}
+
+// ListByUserIDs retrieves the notes and flags saved for any of the users
+func (r *userFlagsRepository) ListByUserIDs(ctx context.Context, userIDs []string) ([]*domain.UserFlags, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(userIDs))
+	for i, userID := range userIDs {
+		args[i] = userID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")
+	query := `SELECT ` + userFlagsColumns + ` FROM user_flags WHERE user_id IN (` + placeholders + `)`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user flags: %w", err)
+	}
+	return collectUserFlags(rows)
+}
+
+// ListByFlag retrieves up to limit users with the flag, last edited first
+func (r *userFlagsRepository) ListByFlag(ctx context.Context, flag string, limit int) ([]*domain.UserFlags, error) {
+	query := `
+		SELECT ` + userFlagsColumns + `
+		FROM user_flags
+		WHERE EXISTS (SELECT 1 FROM json_each(user_flags.flags) WHERE json_each.value = ?)
+		ORDER BY updated_at DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, flag, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by flag: %w", err)
+	}
+	return collectUserFlags(rows)
+}
+
+// Save creates or replaces the notes and flags of a user
+func (r *userFlagsRepository) Save(ctx context.Context, flags *domain.UserFlags) error {
+	query := `
+		INSERT INTO user_flags (` + userFlagsColumns + `)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			notes = excluded.notes,
+			flags = excluded.flags,
+			updated_at = excluded.updated_at,
+			updated_by = excluded.updated_by
+	`
+
+	if flags.UpdatedAt.IsZero() {
+		flags.UpdatedAt = time.Now()
+	}
+	encoded, err := json.Marshal(flags.Flags)
+	if err != nil {
+		return fmt.Errorf("failed to encode flags: %w", err)
+	}
+	if flags.Flags == nil {
+		encoded = []byte("[]")
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query, flags.UserID, flags.Notes, string(encoded), utc(flags.UpdatedAt), flags.UpdatedBy)
+	if err != nil {
+		if foreignKeyViolation(err) {
+			return fmt.Errorf("user with id %s not found: %w", flags.UserID, repository.ErrNotFound)
+		}
+		return fmt.Errorf("failed to save user flags: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByUserID deletes the notes and flags of a user
+func (r *userFlagsRepository) DeleteByUserID(ctx context.Context, userID string) error {
+	if _, err := r.db.DB.ExecContext(ctx, `DELETE FROM user_flags WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete user flags: %w", err)
+	}
+	return nil
+}
+
+// collectUserFlags scans and closes rows of userFlagsColumns
+func collectUserFlags(rows *sql.Rows) ([]*domain.UserFlags, error) {
+	defer rows.Close()
+
+	var all []*domain.UserFlags
+	for rows.Next() {
+		flags, err := scanUserFlags(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user flags: %w", err)
+		}
+		all = append(all, flags)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate user flags: %w", err)
+	}
+
+	return all, nil
+}
+
+// scanUserFlags scans a user_flags row selected with userFlagsColumns
+func scanUserFlags(row interface{ Scan(dest ...any) error }) (*domain.UserFlags, error) {
+	flags := &domain.UserFlags{}
+	var encoded string
+	if err := row.Scan(&flags.UserID, &flags.Notes, &encoded, &flags.UpdatedAt, &flags.UpdatedBy); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(encoded), &flags.Flags); err != nil {
+		return nil, fmt.Errorf("failed to decode flags: %w", err)
+	}
+	return flags, nil
+}
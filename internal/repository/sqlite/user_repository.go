@@ -0,0 +1,353 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+const userColumns = `id, email, email_normalized, username, password_hash, created_at, updated_at, last_login_at, is_active, is_email_verified,
+	first_name, last_name, display_name, avatar_url, locale, login_count, last_login_ip, previous_login_at, previous_login_ip, restriction,
+	unverified_warned_at`
+
+// userRepository implements repository.UserRepository on SQLite
+type userRepository struct {
+	db *database.SQLite
+}
+
+// NewUserRepository creates a new SQLite user repository
+func NewUserRepository(db *database.SQLite) repository.UserRepository {
+	return &userRepository{db: db}
+}
+
+// Create creates a new user in the database
+func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+	query := `
+		INSERT INTO users (id, email, password_hash, created_at, updated_at, is_active, is_email_verified,
+			first_name, last_name, display_name, avatar_url, locale, username, email_normalized, restriction)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+	if user.Restriction == "" {
+		user.Restriction = domain.RestrictionNone
+	}
+
+	_, err := r.db.DB.ExecContext(ctx, query,
+		user.ID,
+		user.Email,
+		user.PasswordHash,
+		utc(user.CreatedAt),
+		utc(user.UpdatedAt),
+		user.IsActive,
+		user.IsEmailVerified,
+		user.FirstName,
+		user.LastName,
+		user.DisplayName,
+		user.AvatarURL,
+		user.Locale,
+		user.Username,
+		user.EmailNormalized,
+		user.Restriction,
+	)
+	if err != nil {
+		if dupErr := duplicateUserError(err, user); dupErr != nil {
+			return dupErr
+		}
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// GetByEmail retrieves a user by normalized email
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := r.get(ctx, "email_normalized", email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user with email %s not found: %w", email, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return user, nil
+}
+
+// GetByID retrieves a user by ID
+func (r *userRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	user, err := r.get(ctx, "id", id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user with id %s not found: %w", id, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	return user, nil
+}
+
+// GetByUsername retrieves a user by username
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	user, err := r.get(ctx, "username", username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user with username %s not found: %w", username, repository.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	}
+	return user, nil
+}
+
+// get retrieves a user by a unique column, column is never user input
+func (r *userRepository) get(ctx context.Context, column, value string) (*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + column + ` = ?`
+	return scanUser(r.db.DB.QueryRowContext(ctx, query, value))
+}
+
+// SearchByEmail returns up to limit users whose email contains query, ignoring case for ASCII letters
+func (r *userRepository) SearchByEmail(ctx context.Context, query string, limit int) ([]*domain.User, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE email LIKE ? ESCAPE '\' ORDER BY email LIMIT ?`,
+		repository.ContainsPattern(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// unverifiedUsers selects active users whose email was never verified
+// Placeholder emails under the reserved .invalid TLD, e.g. of wallet users, have nothing to verify.
+const unverifiedUsers = `is_email_verified = 0 AND is_active = 1 AND email NOT LIKE '%.invalid'`
+
+// ListUnverifiedToWarn returns up to limit unverified users created before createdBefore and not warned yet
+func (r *userRepository) ListUnverifiedToWarn(ctx context.Context, createdBefore time.Time, limit int) ([]*domain.User, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users
+		WHERE `+unverifiedUsers+` AND unverified_warned_at IS NULL AND created_at < ? ORDER BY created_at LIMIT ?`,
+		utc(createdBefore), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unverified users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// ListUnverifiedWarnedBefore returns up to limit unverified users warned before warnedBefore
+func (r *userRepository) ListUnverifiedWarnedBefore(ctx context.Context, warnedBefore time.Time, limit int) ([]*domain.User, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users
+		WHERE `+unverifiedUsers+` AND unverified_warned_at < ? ORDER BY created_at LIMIT ?`,
+		utc(warnedBefore), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unverified users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// MarkUnverifiedWarned records that a user was warned, ErrNotFound if the user doesn't exist or was warned already
+func (r *userRepository) MarkUnverifiedWarned(ctx context.Context, userID string, at time.Time) error {
+	result, err := r.db.DB.ExecContext(ctx,
+		`UPDATE users SET unverified_warned_at = ? WHERE id = ? AND unverified_warned_at IS NULL`, utc(at), userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark user warned: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("unwarned user with id %s", userID))
+}
+
+// scanUsers scans and closes rows selected with userColumns
+func scanUsers(rows *sql.Rows) ([]*domain.User, error) {
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// scanUser scans a users row selected with userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (*domain.User, error) {
+	user := &domain.User{}
+	var lastLoginAt, previousLoginAt, unverifiedWarnedAt sql.NullTime
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.EmailNormalized,
+		&user.Username,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&lastLoginAt,
+		&user.IsActive,
+		&user.IsEmailVerified,
+		&user.FirstName,
+		&user.LastName,
+		&user.DisplayName,
+		&user.AvatarURL,
+		&user.Locale,
+		&user.LoginCount,
+		&user.LastLoginIP,
+		&previousLoginAt,
+		&user.PreviousLoginIP,
+		&user.Restriction,
+		&unverifiedWarnedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	if previousLoginAt.Valid {
+		user.PreviousLoginAt = &previousLoginAt.Time
+	}
+	if unverifiedWarnedAt.Valid {
+		user.UnverifiedWarnedAt = &unverifiedWarnedAt.Time
+	}
+
+	return user, nil
+}
+
+// Update updates an existing user
+func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
+	query := `
+		UPDATE users
+		SET email = ?, password_hash = ?, is_active = ?, is_email_verified = ?,
+			first_name = ?, last_name = ?, display_name = ?, avatar_url = ?, locale = ?, username = ?,
+			email_normalized = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query,
+		user.Email,
+		user.PasswordHash,
+		user.IsActive,
+		user.IsEmailVerified,
+		user.FirstName,
+		user.LastName,
+		user.DisplayName,
+		user.AvatarURL,
+		user.Locale,
+		user.Username,
+		user.EmailNormalized,
+		utc(time.Now()),
+		user.ID,
+	)
+	if err != nil {
+		if dupErr := duplicateUserError(err, user); dupErr != nil {
+			return dupErr
+		}
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("user with id %s", user.ID))
+}
+
+// UpdateLastLogin records a login of a user, the last login becomes the previous one
+func (r *userRepository) UpdateLastLogin(ctx context.Context, userID, ip string) error {
+	query := `
+		UPDATE users
+		SET previous_login_at = last_login_at, previous_login_ip = last_login_ip,
+			last_login_at = ?, last_login_ip = NULLIF(?, ''), login_count = login_count + 1
+		WHERE id = ?
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, utc(time.Now()), ip, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last login: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("user with id %s", userID))
+}
+
+// SetRestriction sets the restriction level of a user
+func (r *userRepository) SetRestriction(ctx context.Context, userID, restriction string) error {
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE users SET restriction = ? WHERE id = ?`, restriction, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set user restriction: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("user with id %s", userID))
+}
+
+// ListAfter returns up to limit users whose ID sorts after afterID, ordered by ID
+func (r *userRepository) ListAfter(ctx context.Context, afterID string, limit int) ([]*domain.User, error) {
+	rows, err := r.db.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users WHERE id > ? ORDER BY id LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// SetEmailNormalized replaces the normalized email of a user
+func (r *userRepository) SetEmailNormalized(ctx context.Context, userID, emailNormalized string) error {
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE users SET email_normalized = ? WHERE id = ?`, emailNormalized, userID)
+	if err != nil {
+		if dupErr := duplicateUserError(err, &domain.User{Email: emailNormalized}); dupErr != nil {
+			return dupErr
+		}
+		return fmt.Errorf("failed to set normalized email: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("user with id %s", userID))
+}
+
+// Delete deletes a user, refresh tokens and OAuth connections are deleted by ON DELETE CASCADE
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.DB.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return requireAffected(result, fmt.Sprintf("user with id %s", id))
+}
+
+// duplicateUserError maps unique violations on users to repository errors
+// Returns nil if err is not a unique violation
+func duplicateUserError(err error, user *domain.User) error {
+	if !uniqueViolation(err) {
+		return nil
+	}
+
+	if uniqueViolation(err, "users.username") && user.Username != nil {
+		return fmt.Errorf("user with username %s already exists: %w", *user.Username, repository.ErrDuplicateUsername)
+	}
+	return fmt.Errorf("user with email %s already exists: %w", user.Email, repository.ErrDuplicateEmail)
+}
+
+// requireAffected returns repository.ErrNotFound if result affected no rows
+func requireAffected(result sql.Result, record string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s not found: %w", record, repository.ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// statsRepository implements StatsRepository interface
+type statsRepository struct {
+	db *database.Postgres
+}
+
+// NewStatsRepository creates a new stats repository
+func NewStatsRepository(db *database.Postgres) StatsRepository {
+	return &statsRepository{db: db}
+}
+
+// CountUsers counts all users, the active ones and those with a verified email
+func (r *statsRepository) CountUsers(ctx context.Context) (_ *domain.UserCounts, err error) {
+	ctx, span := tracer.Start(ctx, "StatsRepository.CountUsers")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE is_active),
+			COUNT(*) FILTER (WHERE is_email_verified)
+		FROM users
+	`
+
+	counts := &domain.UserCounts{}
+	if err := r.db.DB.QueryRowContext(ctx, query).Scan(&counts.Total, &counts.Active, &counts.Verified); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	return counts, nil
+}
+
+// CountActiveUsers counts the users whose last login is at or after since
+func (r *statsRepository) CountActiveUsers(ctx context.Context, since time.Time) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "StatsRepository.CountActiveUsers")
+	defer func() { endSpan(span, err) }()
+
+	var count int64
+	if err := r.db.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE last_login_at >= $1`, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active users: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveSessions counts the sessions with a refresh token neither revoked nor expired at now
+func (r *statsRepository) CountActiveSessions(ctx context.Context, now time.Time) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "StatsRepository.CountActiveSessions")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT COUNT(DISTINCT session_id) FROM refresh_tokens WHERE revoked_at IS NULL AND expires_at > $1`
+
+	var count int64
+	if err := r.db.DB.QueryRowContext(ctx, query, now).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+	return count, nil
+}
+
+// DailyRegistrations counts the users created per UTC day at or after since, oldest first
+func (r *statsRepository) DailyRegistrations(ctx context.Context, since time.Time) (_ []domain.DailyCount, err error) {
+	ctx, span := tracer.Start(ctx, "StatsRepository.DailyRegistrations")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT date_trunc('day', created_at) AS day, COUNT(*)
+		FROM users
+		WHERE created_at >= $1
+		GROUP BY day
+		ORDER BY day
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count registrations: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.DailyCount
+	for rows.Next() {
+		var count domain.DailyCount
+		if err := rows.Scan(&count.Day, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan registrations: %w", err)
+		}
+		count.Day = count.Day.UTC()
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate registrations: %w", err)
+	}
+
+	return counts, nil
+}
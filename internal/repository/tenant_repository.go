@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// tenantColumns are the columns scanned by scanTenant
+const tenantColumns = `id, name, email_from, brand_name, logo_url, brand_color, redirect_urls, cookie_domain, allowed_email_domains, created_at, updated_at`
+
+// tenantRepository implements TenantRepository interface
+type tenantRepository struct {
+	db *database.Postgres
+}
+
+// NewTenantRepository creates a new tenant repository
+func NewTenantRepository(db *database.Postgres) TenantRepository {
+	return &tenantRepository{db: db}
+}
+
+// Save creates a tenant or replaces the settings of an existing one
+func (r *tenantRepository) Save(ctx context.Context, tenant *domain.Tenant) (err error) {
+	ctx, span := tracer.Start(ctx, "TenantRepository.Save")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO tenants (` + tenantColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+		ON CONFLICT (id) DO UPDATE SET
+			name = EXCLUDED.name,
+			email_from = EXCLUDED.email_from,
+			brand_name = EXCLUDED.brand_name,
+			logo_url = EXCLUDED.logo_url,
+			brand_color = EXCLUDED.brand_color,
+			redirect_urls = EXCLUDED.redirect_urls,
+			cookie_domain = EXCLUDED.cookie_domain,
+			allowed_email_domains = EXCLUDED.allowed_email_domains,
+			updated_at = EXCLUDED.updated_at
+		RETURNING created_at, updated_at
+	`
+
+	err = r.db.DB.QueryRowContext(ctx, query,
+		tenant.ID,
+		tenant.Name,
+		tenant.EmailFrom,
+		tenant.BrandName,
+		tenant.LogoURL,
+		tenant.BrandColor,
+		pq.Array(tenant.RedirectURLs),
+		tenant.CookieDomain,
+		pq.Array(tenant.AllowedEmailDomains),
+		time.Now(),
+	).Scan(&tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save tenant: %w", err)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a tenant by ID
+func (r *tenantRepository) GetByID(ctx context.Context, id string) (_ *domain.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantRepository.GetByID")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT ` + tenantColumns + `
+		FROM tenants
+		WHERE id = $1
+	`
+
+	tenant, err := scanTenant(r.db.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("tenant with id %s not found: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get tenant by id: %w", err)
+	}
+
+	return tenant, nil
+}
+
+// List retrieves all tenants ordered by ID
+func (r *tenantRepository) List(ctx context.Context) (_ []*domain.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantRepository.List")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT ` + tenantColumns + `
+		FROM tenants
+		ORDER BY id
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []*domain.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %w", err)
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tenants: %w", err)
+	}
+
+	return tenants, nil
+}
+
+// Delete deletes a tenant by ID
+func (r *tenantRepository) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "TenantRepository.Delete")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM tenants WHERE id = $1`
+
+	result, err := r.db.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("tenant with id %s not found: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanTenant scans a tenant from a row of tenantColumns
+func scanTenant(row interface{ Scan(dest ...any) error }) (*domain.Tenant, error) {
+	tenant := &domain.Tenant{}
+	var emailFrom, brandName, logoURL, brandColor, cookieDomain sql.NullString
+	var redirectURLs, allowedEmailDomains pq.StringArray
+
+	err := row.Scan(
+		&tenant.ID,
+		&tenant.Name,
+		&emailFrom,
+		&brandName,
+		&logoURL,
+		&brandColor,
+		&redirectURLs,
+		&cookieDomain,
+		&allowedEmailDomains,
+		&tenant.CreatedAt,
+		&tenant.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if emailFrom.Valid {
+		tenant.EmailFrom = &emailFrom.String
+	}
+	if brandName.Valid {
+		tenant.BrandName = &brandName.String
+	}
+	if logoURL.Valid {
+		tenant.LogoURL = &logoURL.String
+	}
+	if brandColor.Valid {
+		tenant.BrandColor = &brandColor.String
+	}
+	if cookieDomain.Valid {
+		tenant.CookieDomain = &cookieDomain.String
+	}
+	tenant.RedirectURLs = redirectURLs
+	tenant.AllowedEmailDomains = allowedEmailDomains
+
+	return tenant, nil
+}
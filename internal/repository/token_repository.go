@@ -23,31 +23,49 @@ func NewTokenRepository(db *database.Postgres) TokenRepository {
 	return &tokenRepository{db: db}
 }
 
+// execer runs statements on the database or within a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 // Create creates a new refresh token in the database
-func (r *tokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+func (r *tokenRepository) Create(ctx context.Context, token *domain.RefreshToken) (err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.Create")
+	defer func() { endSpan(span, err) }()
+
+	return r.create(ctx, r.db.DB, token)
+}
+
+// create inserts token with db
+func (r *tokenRepository) create(ctx context.Context, db execer, token *domain.RefreshToken) error {
 	query := `
-		INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at, device_info, ip_address)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO refresh_tokens (id, user_id, session_id, token_hash, expires_at, created_at, device_info, ip_address, device_fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	// Generate UUID if not provided
 	if token.ID == "" {
 		token.ID = uuid.New().String()
 	}
+	if token.SessionID == "" {
+		token.SessionID = token.ID
+	}
 
 	now := time.Now()
 	if token.CreatedAt.IsZero() {
 		token.CreatedAt = now
 	}
 
-	_, err := r.db.DB.ExecContext(ctx, query,
+	_, err := db.ExecContext(ctx, query,
 		token.ID,
 		token.UserID,
+		token.SessionID,
 		token.TokenHash,
 		token.ExpiresAt,
 		token.CreatedAt,
 		token.DeviceInfo,
 		token.IPAddress,
+		token.DeviceFingerprint,
 	)
 
 	if err != nil {
@@ -64,24 +82,29 @@ func (r *tokenRepository) Create(ctx context.Context, token *domain.RefreshToken
 }
 
 // GetByTokenHash retrieves a refresh token by its hash
-func (r *tokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+func (r *tokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (_ *domain.RefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.GetByTokenHash")
+	defer func() { endSpan(span, err) }()
+
 	query := `
-		SELECT id, user_id, token_hash, expires_at, created_at, device_info, ip_address
+		SELECT id, user_id, session_id, token_hash, expires_at, created_at, device_info, ip_address, device_fingerprint
 		FROM refresh_tokens
-		WHERE token_hash = $1
+		WHERE token_hash = $1 AND revoked_at IS NULL
 	`
 
 	token := &domain.RefreshToken{}
-	var deviceInfo, ipAddress sql.NullString
+	var deviceInfo, ipAddress, deviceFingerprint sql.NullString
 
-	err := r.db.DB.QueryRowContext(ctx, query, tokenHash).Scan(
+	err = r.db.DB.QueryRowContext(ctx, query, tokenHash).Scan(
 		&token.ID,
 		&token.UserID,
+		&token.SessionID,
 		&token.TokenHash,
 		&token.ExpiresAt,
 		&token.CreatedAt,
 		&deviceInfo,
 		&ipAddress,
+		&deviceFingerprint,
 	)
 
 	if err != nil {
@@ -97,16 +120,22 @@ func (r *tokenRepository) GetByTokenHash(ctx context.Context, tokenHash string)
 	if ipAddress.Valid {
 		token.IPAddress = &ipAddress.String
 	}
+	if deviceFingerprint.Valid {
+		token.DeviceFingerprint = &deviceFingerprint.String
+	}
 
 	return token, nil
 }
 
 // GetByUserID retrieves all refresh tokens for a user
-func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.RefreshToken, error) {
+func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) (_ []*domain.RefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.GetByUserID")
+	defer func() { endSpan(span, err) }()
+
 	query := `
-		SELECT id, user_id, token_hash, expires_at, created_at, device_info, ip_address
+		SELECT id, user_id, session_id, token_hash, expires_at, created_at, device_info, ip_address, device_fingerprint
 		FROM refresh_tokens
-		WHERE user_id = $1
+		WHERE user_id = $1 AND revoked_at IS NULL
 		ORDER BY created_at DESC
 	`
 
@@ -119,16 +148,18 @@ func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]*do
 	var tokens []*domain.RefreshToken
 	for rows.Next() {
 		token := &domain.RefreshToken{}
-		var deviceInfo, ipAddress sql.NullString
+		var deviceInfo, ipAddress, deviceFingerprint sql.NullString
 
 		err := rows.Scan(
 			&token.ID,
 			&token.UserID,
+			&token.SessionID,
 			&token.TokenHash,
 			&token.ExpiresAt,
 			&token.CreatedAt,
 			&deviceInfo,
 			&ipAddress,
+			&deviceFingerprint,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan token: %w", err)
@@ -140,6 +171,9 @@ func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]*do
 		if ipAddress.Valid {
 			token.IPAddress = &ipAddress.String
 		}
+		if deviceFingerprint.Valid {
+			token.DeviceFingerprint = &deviceFingerprint.String
+		}
 
 		tokens = append(tokens, token)
 	}
@@ -151,13 +185,16 @@ func (r *tokenRepository) GetByUserID(ctx context.Context, userID string) ([]*do
 	return tokens, nil
 }
 
-// Delete deletes a refresh token by ID
-func (r *tokenRepository) Delete(ctx context.Context, tokenID string) error {
-	query := `DELETE FROM refresh_tokens WHERE id = $1`
+// Revoke revokes a refresh token by ID
+func (r *tokenRepository) Revoke(ctx context.Context, tokenID, reason string) (err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.Revoke")
+	defer func() { endSpan(span, err) }()
 
-	result, err := r.db.DB.ExecContext(ctx, query, tokenID)
+	query := `UPDATE refresh_tokens SET revoked_at = $1, revoke_reason = $2 WHERE id = $3 AND revoked_at IS NULL`
+
+	result, err := r.db.DB.ExecContext(ctx, query, time.Now(), reason, tokenID)
 	if err != nil {
-		return fmt.Errorf("failed to delete token: %w", err)
+		return fmt.Errorf("failed to revoke token: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -172,13 +209,16 @@ func (r *tokenRepository) Delete(ctx context.Context, tokenID string) error {
 	return nil
 }
 
-// DeleteByTokenHash deletes a refresh token by its hash
-func (r *tokenRepository) DeleteByTokenHash(ctx context.Context, tokenHash string) error {
-	query := `DELETE FROM refresh_tokens WHERE token_hash = $1`
+// RevokeByTokenHash revokes a refresh token by its hash
+func (r *tokenRepository) RevokeByTokenHash(ctx context.Context, tokenHash, reason string) (err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.RevokeByTokenHash")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE refresh_tokens SET revoked_at = $1, revoke_reason = $2 WHERE token_hash = $3 AND revoked_at IS NULL`
 
-	result, err := r.db.DB.ExecContext(ctx, query, tokenHash)
+	result, err := r.db.DB.ExecContext(ctx, query, time.Now(), reason, tokenHash)
 	if err != nil {
-		return fmt.Errorf("failed to delete token by hash: %w", err)
+		return fmt.Errorf("failed to revoke token by hash: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -193,14 +233,83 @@ func (r *tokenRepository) DeleteByTokenHash(ctx context.Context, tokenHash strin
 	return nil
 }
 
-// DeleteExpired deletes all expired refresh tokens
-func (r *tokenRepository) DeleteExpired(ctx context.Context) error {
-	query := `DELETE FROM refresh_tokens WHERE expires_at < $1`
+// Rotate revokes the refresh token with tokenHash as rotated and creates next in one transaction
+func (r *tokenRepository) Rotate(ctx context.Context, tokenHash string, next *domain.RefreshToken) (err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.Rotate")
+	defer func() { endSpan(span, err) }()
 
-	_, err := r.db.DB.ExecContext(ctx, query, time.Now())
+	tx, err := r.db.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to delete expired tokens: %w", err)
+		return fmt.Errorf("failed to begin token rotation: %w", err)
+	}
+	// Rolling back after the commit is a no-op
+	defer func() { _ = tx.Rollback() }()
+
+	// Concurrent rotations of the same token wait for the row lock, then find it revoked
+	query := `UPDATE refresh_tokens SET revoked_at = $1, revoke_reason = $2 WHERE token_hash = $3 AND revoked_at IS NULL`
+
+	result, err := tx.ExecContext(ctx, query, time.Now(), domain.TokenRevokeRotated, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to revoke rotated token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("token with hash not found: %w", ErrNotFound)
+	}
+
+	if err := r.create(ctx, tx, next); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit token rotation: %w", err)
 	}
 
 	return nil
 }
+
+// RevokeIssuedBefore revokes refresh tokens created before the given time, of all users when userID is empty
+func (r *tokenRepository) RevokeIssuedBefore(ctx context.Context, userID string, before time.Time, reason string) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.RevokeIssuedBefore")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		UPDATE refresh_tokens SET revoked_at = $1, revoke_reason = $2
+		WHERE revoked_at IS NULL AND created_at < $3 AND ($4 = '' OR user_id::text = $4)
+	`
+
+	result, err := r.db.DB.ExecContext(ctx, query, time.Now(), reason, before, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke tokens issued before %s: %w", before, err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke tokens issued before %s: %w", before, err)
+	}
+	return revoked, nil
+}
+
+// Purge deletes refresh tokens that expired or were revoked before the given time
+func (r *tokenRepository) Purge(ctx context.Context, before time.Time) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "TokenRepository.Purge")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM refresh_tokens WHERE expires_at < $1 OR revoked_at < $1`
+
+	result, err := r.db.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge tokens: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge tokens: %w", err)
+	}
+	return purged, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = operationTracer{Tracer: otel.Tracer("github.com/prperemyshlev/auth-service-2/internal/repository")}
+
+// postgresErrors counts failed repository operations, exported as postgres_errors_total
+var postgresErrors metric.Int64Counter
+
+func init() {
+	var err error
+	meter := otel.Meter("github.com/prperemyshlev/auth-service-2/internal/repository")
+	if postgresErrors, err = meter.Int64Counter("postgres.errors",
+		metric.WithDescription("Number of failed PostgreSQL operations, by repository operation"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create postgres errors counter: %w", err))
+	}
+}
+
+// expectedErrors are outcomes of operations rather than failures of the database
+var expectedErrors = []error{
+	ErrNotFound,
+	ErrDuplicateEmail,
+	ErrDuplicateUsername,
+	ErrDuplicateToken,
+	ErrDuplicateOAuthProvider,
+	ErrDuplicateIPRule,
+	ErrDuplicateConsent,
+	ErrDuplicateInvitation,
+	ErrDuplicateMembership,
+	ErrDuplicateErasure,
+	context.Canceled,
+}
+
+// operationTracer starts spans named after repository operations, e.g. "TokenRepository.Create"
+type operationTracer struct {
+	trace.Tracer
+}
+
+// operationSpan is a span that remembers its operation for metrics
+type operationSpan struct {
+	trace.Span
+	operation string
+}
+
+// Start starts the span of an operation
+func (t operationTracer) Start(ctx context.Context, operation string, opts ...trace.SpanStartOption) (context.Context, operationSpan) {
+	ctx, span := t.Tracer.Start(ctx, operation, opts...)
+	return ctx, operationSpan{Span: span, operation: operation}
+}
+
+// endSpan records err on span, if any, and ends it
+// Missing records are an expected outcome and are not reported as span errors,
+// failures of the database are also counted in postgresErrors.
+func endSpan(span operationSpan, err error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if err != nil && !isExpectedError(err) && postgresErrors != nil {
+		postgresErrors.Add(context.Background(), 1, metric.WithAttributes(attribute.String("operation", span.operation)))
+	}
+	span.End()
+}
+
+// isExpectedError reports whether err is an expected outcome of an operation
+func isExpectedError(err error) bool {
+	for _, expected := range expectedErrors {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
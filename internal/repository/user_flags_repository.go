@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+)
+
+// userFlagsColumns are the columns scanned by scanUserFlags
+const userFlagsColumns = `user_id, notes, flags, updated_at, updated_by`
+
+// userFlagsRepository implements UserFlagsRepository interface
+type userFlagsRepository struct {
+	db *database.Postgres
+}
+
+// NewUserFlagsRepository creates a new user flags repository
+func NewUserFlagsRepository(db *database.Postgres) UserFlagsRepository {
+	return &userFlagsRepository{db: db}
+}
+
+// Get retrieves the notes and flags of a user
+func (r *userFlagsRepository) Get(ctx context.Context, userID string) (_ *domain.UserFlags, err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsRepository.Get")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT ` + userFlagsColumns + ` FROM user_flags WHERE user_id = $1`
+
+	flags, err := scanUserFlags(r.db.DB.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("flags of user %s not found: %w", userID, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user flags: %w", err)
+	}
+	return flags, nil
+}
+
+// ListByUserIDs retrieves the notes and flags saved for any of the users
+func (r *userFlagsRepository) ListByUserIDs(ctx context.Context, userIDs []string) (_ []*domain.UserFlags, err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsRepository.ListByUserIDs")
+	defer func() { endSpan(span, err) }()
+
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + userFlagsColumns + ` FROM user_flags WHERE user_id = ANY($1::uuid[])`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user flags: %w", err)
+	}
+	return collectUserFlags(rows)
+}
+
+// ListByFlag retrieves up to limit users with the flag, last edited first
+// The GIN index on flags serves the containment.
+func (r *userFlagsRepository) ListByFlag(ctx context.Context, flag string, limit int) (_ []*domain.UserFlags, err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsRepository.ListByFlag")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		SELECT ` + userFlagsColumns + `
+		FROM user_flags
+		WHERE flags @> ARRAY[$1]::text[]
+		ORDER BY updated_at DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.DB.QueryContext(ctx, query, flag, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users by flag: %w", err)
+	}
+	return collectUserFlags(rows)
+}
+
+// Save creates or replaces the notes and flags of a user
+func (r *userFlagsRepository) Save(ctx context.Context, flags *domain.UserFlags) (err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsRepository.Save")
+	defer func() { endSpan(span, err) }()
+
+	query := `
+		INSERT INTO user_flags (` + userFlagsColumns + `)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			notes = EXCLUDED.notes,
+			flags = EXCLUDED.flags,
+			updated_at = EXCLUDED.updated_at,
+			updated_by = EXCLUDED.updated_by
+	`
+
+	if flags.UpdatedAt.IsZero() {
+		flags.UpdatedAt = time.Now()
+	}
+
+	_, err = r.db.DB.ExecContext(ctx, query, flags.UserID, flags.Notes, pq.Array(flags.Flags), flags.UpdatedAt, flags.UpdatedBy)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" { // foreign_key_violation
+			return fmt.Errorf("user with id %s not found: %w", flags.UserID, ErrNotFound)
+		}
+		return fmt.Errorf("failed to save user flags: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByUserID deletes the notes and flags of a user
+func (r *userFlagsRepository) DeleteByUserID(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsRepository.DeleteByUserID")
+	defer func() { endSpan(span, err) }()
+
+	if _, err := r.db.DB.ExecContext(ctx, `DELETE FROM user_flags WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete user flags: %w", err)
+	}
+	return nil
+}
+
+// collectUserFlags scans and closes rows of userFlagsColumns
+func collectUserFlags(rows *sql.Rows) ([]*domain.UserFlags, error) {
+	defer rows.Close()
+
+	var all []*domain.UserFlags
+	for rows.Next() {
+		flags, err := scanUserFlags(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user flags: %w", err)
+		}
+		all = append(all, flags)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate user flags: %w", err)
+	}
+
+	return all, nil
+}
+
+// scanUserFlags scans a user_flags row selected with userFlagsColumns
+func scanUserFlags(row interface{ Scan(dest ...any) error }) (*domain.UserFlags, error) {
+	flags := &domain.UserFlags{}
+	if err := row.Scan(&flags.UserID, &flags.Notes, pq.Array(&flags.Flags), &flags.UpdatedAt, &flags.UpdatedBy); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
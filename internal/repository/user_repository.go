@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +14,11 @@ import (
 	"github.com/prperemyshlev/auth-service-2/pkg/database"
 )
 
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, email, email_normalized, username, password_hash, created_at, updated_at, last_login_at, is_active, is_email_verified,
+	first_name, last_name, display_name, avatar_url, locale, login_count, last_login_ip, previous_login_at, previous_login_ip, restriction,
+	unverified_warned_at`
+
 // userRepository implements UserRepository interface
 type userRepository struct {
 	db *database.Postgres
@@ -24,10 +30,14 @@ func NewUserRepository(db *database.Postgres) UserRepository {
 }
 
 // Create creates a new user in the database
-func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
+func (r *userRepository) Create(ctx context.Context, user *domain.User) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.Create")
+	defer func() { endSpan(span, err) }()
+
 	query := `
-		INSERT INTO users (id, email, password_hash, created_at, updated_at, is_active, is_email_verified)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO users (id, email, password_hash, created_at, updated_at, is_active, is_email_verified,
+			first_name, last_name, display_name, avatar_url, locale, username, email_normalized, restriction)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 	`
 
 	// Generate UUID if not provided
@@ -42,8 +52,11 @@ func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 	if user.UpdatedAt.IsZero() {
 		user.UpdatedAt = now
 	}
+	if user.Restriction == "" {
+		user.Restriction = domain.RestrictionNone
+	}
 
-	_, err := r.db.DB.ExecContext(ctx, query,
+	_, err = r.db.DB.ExecContext(ctx, query,
 		user.ID,
 		user.Email,
 		user.PasswordHash,
@@ -51,14 +64,20 @@ func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 		user.UpdatedAt,
 		user.IsActive,
 		user.IsEmailVerified,
+		user.FirstName,
+		user.LastName,
+		user.DisplayName,
+		user.AvatarURL,
+		user.Locale,
+		user.Username,
+		user.EmailNormalized,
+		user.Restriction,
 	)
 
 	if err != nil {
-		// Check for unique constraint violation (duplicate email)
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" { // unique_violation
-				return fmt.Errorf("user with email %s already exists: %w", user.Email, ErrDuplicateEmail)
-			}
+		// Check for unique constraint violation (duplicate email or username)
+		if dupErr := duplicateUserError(err, user); dupErr != nil {
+			return dupErr
 		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
@@ -66,28 +85,14 @@ func (r *userRepository) Create(ctx context.Context, user *domain.User) error {
 	return nil
 }
 
-// GetByEmail retrieves a user by email
-func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `
-		SELECT id, email, password_hash, created_at, updated_at, last_login_at, is_active, is_email_verified
-		FROM users
-		WHERE email = $1
-	`
+// GetByEmail retrieves a user by normalized email
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (_ *domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.GetByEmail")
+	defer func() { endSpan(span, err) }()
 
-	user := &domain.User{}
-	var lastLoginAt sql.NullTime
-
-	err := r.db.DB.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&lastLoginAt,
-		&user.IsActive,
-		&user.IsEmailVerified,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE email_normalized = $1`
 
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("user with email %s not found: %w", email, ErrNotFound)
@@ -95,35 +100,17 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*domain.
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
-	}
-
 	return user, nil
 }
 
 // GetByID retrieves a user by ID
-func (r *userRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
-	query := `
-		SELECT id, email, password_hash, created_at, updated_at, last_login_at, is_active, is_email_verified
-		FROM users
-		WHERE id = $1
-	`
-
-	user := &domain.User{}
-	var lastLoginAt sql.NullTime
+func (r *userRepository) GetByID(ctx context.Context, id string) (_ *domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.GetByID")
+	defer func() { endSpan(span, err) }()
 
-	err := r.db.DB.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&lastLoginAt,
-		&user.IsActive,
-		&user.IsEmailVerified,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("user with id %s not found: %w", id, ErrNotFound)
@@ -131,18 +118,37 @@ func (r *userRepository) GetByID(ctx context.Context, id string) (*domain.User,
 		return nil, fmt.Errorf("failed to get user by id: %w", err)
 	}
 
-	if lastLoginAt.Valid {
-		user.LastLoginAt = &lastLoginAt.Time
+	return user, nil
+}
+
+// GetByUsername retrieves a user by username
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (_ *domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.GetByUsername")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
+
+	user, err := scanUser(r.db.DB.QueryRowContext(ctx, query, username))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user with username %s not found: %w", username, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
 	}
 
 	return user, nil
 }
 
 // Update updates an existing user
-func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
+func (r *userRepository) Update(ctx context.Context, user *domain.User) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.Update")
+	defer func() { endSpan(span, err) }()
+
 	query := `
 		UPDATE users
-		SET email = $2, password_hash = $3, is_active = $4, is_email_verified = $5
+		SET email = $2, password_hash = $3, is_active = $4, is_email_verified = $5,
+			first_name = $6, last_name = $7, display_name = $8, avatar_url = $9, locale = $10, username = $11,
+			email_normalized = $12
 		WHERE id = $1
 	`
 
@@ -152,13 +158,18 @@ func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
 		user.PasswordHash,
 		user.IsActive,
 		user.IsEmailVerified,
+		user.FirstName,
+		user.LastName,
+		user.DisplayName,
+		user.AvatarURL,
+		user.Locale,
+		user.Username,
+		user.EmailNormalized,
 	)
 
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok {
-			if pqErr.Code == "23505" { // unique_violation
-				return fmt.Errorf("user with email %s already exists: %w", user.Email, ErrDuplicateEmail)
-			}
+		if dupErr := duplicateUserError(err, user); dupErr != nil {
+			return dupErr
 		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
@@ -175,15 +186,102 @@ func (r *userRepository) Update(ctx context.Context, user *domain.User) error {
 	return nil
 }
 
-// UpdateLastLogin updates the last login timestamp for a user
-func (r *userRepository) UpdateLastLogin(ctx context.Context, userID string) error {
+// SearchByEmail returns up to limit users whose email contains query, ignoring case
+// The pg_trgm index on email serves the ILIKE without scanning all users.
+func (r *userRepository) SearchByEmail(ctx context.Context, query string, limit int) (_ []*domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.SearchByEmail")
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.db.DB.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE email ILIKE $1
+		ORDER BY email
+		LIMIT $2
+	`, ContainsPattern(query), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// unverifiedUsers selects active users whose email was never verified
+// Placeholder emails under the reserved .invalid TLD, e.g. of wallet users, have nothing to verify.
+const unverifiedUsers = `is_email_verified = false AND is_active = true AND email NOT LIKE '%.invalid'`
+
+// ListUnverifiedToWarn returns up to limit unverified users created before createdBefore and not warned yet
+func (r *userRepository) ListUnverifiedToWarn(ctx context.Context, createdBefore time.Time, limit int) (_ []*domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.ListUnverifiedToWarn")
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.db.DB.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE `+unverifiedUsers+` AND unverified_warned_at IS NULL AND created_at < $1
+		ORDER BY created_at
+		LIMIT $2
+	`, createdBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unverified users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// ListUnverifiedWarnedBefore returns up to limit unverified users warned before warnedBefore
+func (r *userRepository) ListUnverifiedWarnedBefore(ctx context.Context, warnedBefore time.Time, limit int) (_ []*domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.ListUnverifiedWarnedBefore")
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.db.DB.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE `+unverifiedUsers+` AND unverified_warned_at < $1
+		ORDER BY created_at
+		LIMIT $2
+	`, warnedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unverified users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// MarkUnverifiedWarned records that a user was warned at the given time, ErrNotFound if the user
+// doesn't exist or was warned already
+func (r *userRepository) MarkUnverifiedWarned(ctx context.Context, userID string, at time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.MarkUnverifiedWarned")
+	defer func() { endSpan(span, err) }()
+
+	result, err := r.db.DB.ExecContext(ctx,
+		`UPDATE users SET unverified_warned_at = $1 WHERE id = $2 AND unverified_warned_at IS NULL`, at, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark user warned: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("unwarned user with id %s not found: %w", userID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// UpdateLastLogin records a login of a user, the last login becomes the previous one
+func (r *userRepository) UpdateLastLogin(ctx context.Context, userID, ip string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.UpdateLastLogin")
+	defer func() { endSpan(span, err) }()
+
 	query := `
 		UPDATE users
-		SET last_login_at = $1
-		WHERE id = $2
+		SET previous_login_at = last_login_at, previous_login_ip = last_login_ip,
+			last_login_at = $1, last_login_ip = NULLIF($2, ''), login_count = login_count + 1
+		WHERE id = $3
 	`
 
-	result, err := r.db.DB.ExecContext(ctx, query, time.Now(), userID)
+	result, err := r.db.DB.ExecContext(ctx, query, time.Now(), ip, userID)
 	if err != nil {
 		return fmt.Errorf("failed to update last login: %w", err)
 	}
@@ -199,3 +297,183 @@ func (r *userRepository) UpdateLastLogin(ctx context.Context, userID string) err
 
 	return nil
 }
+
+// SetRestriction sets the restriction level of a user
+func (r *userRepository) SetRestriction(ctx context.Context, userID, restriction string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.SetRestriction")
+	defer func() { endSpan(span, err) }()
+
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE users SET restriction = $1 WHERE id = $2`, restriction, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set user restriction: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %s not found: %w", userID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// ListAfter returns up to limit users whose ID sorts after afterID, ordered by ID
+func (r *userRepository) ListAfter(ctx context.Context, afterID string, limit int) (_ []*domain.User, err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.ListAfter")
+	defer func() { endSpan(span, err) }()
+
+	// The nil UUID sorts before all others
+	if afterID == "" {
+		afterID = uuid.Nil.String()
+	}
+	rows, err := r.db.DB.QueryContext(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// SetEmailNormalized replaces the normalized email of a user
+func (r *userRepository) SetEmailNormalized(ctx context.Context, userID, emailNormalized string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.SetEmailNormalized")
+	defer func() { endSpan(span, err) }()
+
+	result, err := r.db.DB.ExecContext(ctx, `UPDATE users SET email_normalized = $1 WHERE id = $2`, emailNormalized, userID)
+	if err != nil {
+		if dupErr := duplicateUserError(err, &domain.User{Email: emailNormalized}); dupErr != nil {
+			return dupErr
+		}
+		return fmt.Errorf("failed to set normalized email: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %s not found: %w", userID, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Delete deletes a user, refresh tokens and OAuth connections are deleted by ON DELETE CASCADE
+func (r *userRepository) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "UserRepository.Delete")
+	defer func() { endSpan(span, err) }()
+
+	query := `DELETE FROM users WHERE id = $1`
+
+	result, err := r.db.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user with id %s not found: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// duplicateUserError maps unique violations on users to repository errors
+// Returns nil if err is not a unique violation
+func duplicateUserError(err error, user *domain.User) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code != "23505" { // unique_violation
+		return nil
+	}
+
+	if pqErr.Constraint == "idx_users_username" && user.Username != nil {
+		return fmt.Errorf("user with username %s already exists: %w", *user.Username, ErrDuplicateUsername)
+	}
+	return fmt.Errorf("user with email %s already exists: %w", user.Email, ErrDuplicateEmail)
+}
+
+// scanUser scans a users row selected with userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (*domain.User, error) {
+	user := &domain.User{}
+	var lastLoginAt, previousLoginAt, unverifiedWarnedAt sql.NullTime
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.EmailNormalized,
+		&user.Username,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&lastLoginAt,
+		&user.IsActive,
+		&user.IsEmailVerified,
+		&user.FirstName,
+		&user.LastName,
+		&user.DisplayName,
+		&user.AvatarURL,
+		&user.Locale,
+		&user.LoginCount,
+		&user.LastLoginIP,
+		&previousLoginAt,
+		&user.PreviousLoginIP,
+		&user.Restriction,
+		&unverifiedWarnedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastLoginAt.Valid {
+		user.LastLoginAt = &lastLoginAt.Time
+	}
+	if previousLoginAt.Valid {
+		user.PreviousLoginAt = &previousLoginAt.Time
+	}
+	if unverifiedWarnedAt.Valid {
+		user.UnverifiedWarnedAt = &unverifiedWarnedAt.Time
+	}
+
+	return user, nil
+}
+
+// scanUsers scans and closes rows selected with userColumns
+func scanUsers(rows *sql.Rows) ([]*domain.User, error) {
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate users: %w", err)
+	}
+
+	return users, nil
+}
+
+// ContainsPattern returns a LIKE pattern matching values that contain s, the wildcards of s are
+// escaped with a backslash
+func ContainsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// AccessTokenFormatJWT issues self-contained signed tokens
+	AccessTokenFormatJWT = "jwt"
+	// AccessTokenFormatOpaque issues random tokens whose claims are kept in Redis
+	AccessTokenFormatOpaque = "opaque"
+)
+
+const (
+	opaqueAccessTokenKey   = "access_token:"
+	opaqueAccessTokenBytes = 32
+)
+
+// AccessTokenStrategy issues and validates access tokens
+// Validate wraps ErrInvalidToken for tokens that are malformed, expired or unknown,
+// other errors mean the token could not be checked.
+type AccessTokenStrategy interface {
+	// Issue issues an access token of user, scoped to an organization unless membership is nil
+	Issue(ctx context.Context, user *domain.User, membership *domain.Membership) (string, error)
+	// Validate validates a token, also accepting tokens expired for less than expiryGrace if the format allows it
+	Validate(ctx context.Context, token string, expiryGrace time.Duration) (*domain.TokenClaims, error)
+	// ExpiresIn returns the access token lifetime in seconds
+	ExpiresIn() int
+}
+
+// AccessTokenOption configures an access token strategy
+type AccessTokenOption func(*accessTokenOptions)
+
+type accessTokenOptions struct {
+	features *FeatureFlags
+}
+
+// WithFeatureClaims sets the flags exposed as claims that are on for the user as the features claim
+func WithFeatureClaims(features *FeatureFlags) AccessTokenOption {
+	return func(o *accessTokenOptions) {
+		o.features = features
+	}
+}
+
+// ValidateOption relaxes the validation of access tokens on some routes
+type ValidateOption func(*validateOptions)
+
+type validateOptions struct {
+	expiryGrace time.Duration
+}
+
+// WithExpiryGrace accepts access tokens expired for less than grace, smoothing over clock skew and
+// requests racing with a refresh. Opaque tokens are deleted once expired and never accepted late.
+func WithExpiryGrace(grace time.Duration) ValidateOption {
+	return func(o *validateOptions) {
+		o.expiryGrace = grace
+	}
+}
+
+func newAccessTokenOptions(opts []AccessTokenOption) accessTokenOptions {
+	var o accessTokenOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// claims returns the claims of a token of user scoped to membership, if any, without Exp and Iat
+// Tokens of limited users are marked restricted.
+func (o accessTokenOptions) claims(user *domain.User, membership *domain.Membership) *domain.TokenClaims {
+	claims := &domain.TokenClaims{
+		UserID:     user.ID,
+		Email:      user.Email,
+		Restricted: user.Restriction == domain.RestrictionLimited,
+	}
+	if membership != nil {
+		claims.OrgID = membership.OrgID
+		claims.OrgRole = membership.Role
+	}
+	claims.Features = o.features.Claims(user.ID, claims.OrgID)
+	return claims
+}
+
+// jwtAccessTokens issues JWTs, resource servers can validate them without calling the service
+type jwtAccessTokens struct {
+	jwtManager *utils.JWTManager
+	accessTokenOptions
+}
+
+// NewJWTAccessTokens creates the default access token strategy issuing JWTs
+func NewJWTAccessTokens(jwtManager *utils.JWTManager, opts ...AccessTokenOption) AccessTokenStrategy {
+	return &jwtAccessTokens{jwtManager: jwtManager, accessTokenOptions: newAccessTokenOptions(opts)}
+}
+
+// Issue issues a signed access token
+func (s *jwtAccessTokens) Issue(_ context.Context, user *domain.User, membership *domain.Membership) (string, error) {
+	return s.jwtManager.GenerateAccessTokenWithClaims(s.claims(user, membership))
+}
+
+// Validate checks the signature and claims of a token
+func (s *jwtAccessTokens) Validate(_ context.Context, token string, expiryGrace time.Duration) (*domain.TokenClaims, error) {
+	claims, err := s.jwtManager.ValidateTokenWithGrace(token, expiryGrace)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// ExpiresIn returns the access token lifetime in seconds
+func (s *jwtAccessTokens) ExpiresIn() int {
+	return s.jwtManager.GetAccessTokenExpiry()
+}
+
+// opaqueAccessTokens issues random tokens and keeps their claims in Redis until they expire
+// Tokens carry no information and are validated by lookup, deleting the key revokes a token at once.
+// Only hashes of tokens are used as keys.
+type opaqueAccessTokens struct {
+	redis  *database.Redis
+	expiry time.Duration
+	accessTokenOptions
+}
+
+// NewOpaqueAccessTokens creates an access token strategy issuing opaque tokens
+func NewOpaqueAccessTokens(redis *database.Redis, expiry time.Duration, opts ...AccessTokenOption) AccessTokenStrategy {
+	return &opaqueAccessTokens{redis: redis, expiry: expiry, accessTokenOptions: newAccessTokenOptions(opts)}
+}
+
+// Issue generates a random token and stores its claims
+func (s *opaqueAccessTokens) Issue(ctx context.Context, user *domain.User, membership *domain.Membership) (string, error) {
+	buf := make([]byte, opaqueAccessTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	claims := s.claims(user, membership)
+	claims.Exp = now.Add(s.expiry).Unix()
+	claims.Iat = now.Unix()
+
+	value, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+	if err := s.redis.Client.Set(ctx, opaqueAccessTokenKey+hashOpaqueToken(token), value, s.expiry).Err(); err != nil {
+		return "", fmt.Errorf("failed to store access token: %w", err)
+	}
+
+	return token, nil
+}
+
+// Validate looks up the claims of a token, expired tokens are gone whatever the grace period
+func (s *opaqueAccessTokens) Validate(ctx context.Context, token string, _ time.Duration) (*domain.TokenClaims, error) {
+	value, err := s.redis.Client.Get(ctx, opaqueAccessTokenKey+hashOpaqueToken(token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: unknown or expired token", ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("failed to look up access token: %w", err)
+	}
+
+	var claims domain.TokenClaims
+	if err := json.Unmarshal(value, &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode token claims: %w", err)
+	}
+	return &claims, nil
+}
+
+// ExpiresIn returns the access token lifetime in seconds
+func (s *opaqueAccessTokens) ExpiresIn() int {
+	return int(s.expiry.Seconds())
+}
+
+// hashOpaqueToken returns the hex SHA-256 of a token, so tokens can't be read from Redis
+func hashOpaqueToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
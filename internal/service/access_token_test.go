@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOpaqueAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	tokens := service.NewOpaqueAccessTokens(env.Redis, 15*time.Minute)
+
+	user := &domain.User{ID: "user-1", Email: "user@example.com", Restriction: domain.RestrictionLimited}
+	token, err := tokens.Issue(ctx, user, &domain.Membership{OrgID: "org-1", Role: domain.OrgRoleAdmin})
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if _, err := env.JWT.ValidateToken(token); err == nil {
+		t.Error("Expected an opaque token not to be a JWT")
+	}
+
+	claims, err := tokens.Validate(ctx, token, 0)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Email != "user@example.com" || claims.OrgID != "org-1" || claims.OrgRole != domain.OrgRoleAdmin || !claims.Restricted {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if claims.Exp-claims.Iat != int64((15*time.Minute).Seconds()) || tokens.ExpiresIn() != 900 {
+		t.Errorf("Expected a lifetime of 15m, got %+v", claims)
+	}
+
+	if _, err := tokens.Validate(ctx, "unknown", 0); !errors.Is(err, service.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an unknown token, got %v", err)
+	}
+
+	// Tokens vanish from Redis when they expire
+	env.Redis.Client.FlushAll(ctx)
+	if _, err := tokens.Validate(ctx, token, 0); !errors.Is(err, service.ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken for an expired token, got %v", err)
+	}
+}
+
+func TestAuthServiceOpaqueAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	tokens := service.NewOpaqueAccessTokens(env.Redis, 15*time.Minute)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{TTL: time.Hour})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), tokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	revocations := service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, tokens, service.NewTokenBlacklistService(env.Redis),
+		revocations, utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0)
+
+	registered, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	if registered.AuthResponse.ExpiresIn != 900 {
+		t.Errorf("Expected expires_in of 900, got %d", registered.AuthResponse.ExpiresIn)
+	}
+
+	claims, err := auth.ValidateToken(ctx, registered.AuthResponse.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to validate access token: %v", err)
+	}
+	if claims.UserID != registered.AuthResponse.User.ID {
+		t.Errorf("Expected claims of the user, got %+v", claims)
+	}
+
+	// Refresh tokens stay JWTs
+	refreshed, err := auth.RefreshToken(ctx, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if _, err := auth.ValidateToken(ctx, refreshed.AuthResponse.AccessToken); err != nil {
+		t.Errorf("Failed to validate refreshed access token: %v", err)
+	}
+
+	if _, err := revocations.Revoke(ctx, service.Revocation{UserID: claims.UserID, IssuedBefore: time.Now().Add(time.Second)}); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if _, err := auth.ValidateToken(ctx, refreshed.AuthResponse.AccessToken); !errors.Is(err, service.ErrTokenRevoked) {
+		t.Errorf("Expected revoked opaque tokens to be rejected, got %v", err)
+	}
+}
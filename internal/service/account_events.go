@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+)
+
+// accountEventTokenKey marks the tokens of account events already delivered, by provider and jti
+const accountEventTokenKey = "account_events:token:"
+
+// AccountEventService applies the account events identity providers notify, e.g. Apple when a
+// user stops using Sign in with Apple or deletes the Apple ID
+// Revoked consents and deleted or disabled provider accounts unlink the connection, the sessions of
+// the user end when the provider account was disabled or signed out everywhere, and deleted
+// provider accounts deactivate the user when Deactivate is set. Events of accounts that aren't
+// linked are ignored, so that redelivered events are harmless. Replayed tokens of providers
+// giving them an ID are dropped by Deliver, a replayed sign-out would otherwise end new sessions.
+type AccountEventService struct {
+	users       repository.UserRepository
+	oauthRepo   repository.OAuthProviderRepository
+	revocations *RevocationService
+	redis       *database.Redis
+	auditor     observability.Auditor
+	// deactivate deactivates users whose provider account was deleted
+	deactivate bool
+	hooks      []DeactivationHook
+}
+
+// NewAccountEventService creates a new account event service
+func NewAccountEventService(users repository.UserRepository, oauthRepo repository.OAuthProviderRepository, revocations *RevocationService, redis *database.Redis, auditor observability.Auditor, deactivate bool) *AccountEventService {
+	return &AccountEventService{
+		users:       users,
+		oauthRepo:   oauthRepo,
+		revocations: revocations,
+		redis:       redis,
+		auditor:     auditorOrNop(auditor),
+		deactivate:  deactivate,
+	}
+}
+
+// OnDeactivate adds a hook run after a user was deactivated by an account event
+// Hooks must be added before the service is used.
+func (s *AccountEventService) OnDeactivate(hook DeactivationHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Deliver applies the events of a notification and reports whether its token was delivered before
+// Tokens are remembered by ID until they expire, the events of a replayed token are dropped. A
+// token whose events fail to apply is forgotten, so that the provider can retry it.
+func (s *AccountEventService) Deliver(ctx context.Context, events []oauth.AccountEvent) (duplicate bool, err error) {
+	if len(events) == 0 || events[0].TokenID == "" {
+		for _, event := range events {
+			if err := s.Handle(ctx, event); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	key := accountEventTokenKey + events[0].Provider + ":" + events[0].TokenID
+	// The expiry includes the leeway, the token is refused before the key is gone
+	ttl := max(time.Until(events[0].TokenExpiry), time.Second)
+	fresh, err := s.redis.Client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record account event token: %w", err)
+	}
+	if !fresh {
+		return true, nil
+	}
+
+	for _, event := range events {
+		if err := s.Handle(ctx, event); err != nil {
+			if delErr := s.redis.Client.Del(ctx, key).Err(); delErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to forget account event token: %w", delErr))
+			}
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Handle applies an account event to the user linked to the provider account
+func (s *AccountEventService) Handle(ctx context.Context, event oauth.AccountEvent) (err error) {
+	ctx, span := tracer.Start(ctx, "AccountEventService.Handle")
+	defer func() { endSpan(span, err) }()
+
+	connection, err := s.oauthRepo.GetByProvider(ctx, event.Provider, event.Subject)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	switch event.Type {
+	case oauth.AccountEventSessionsRevoked:
+		if _, err := s.revocations.Revoke(ctx, Revocation{UserID: connection.UserID}); err != nil {
+			return err
+		}
+	case oauth.AccountEventConsentRevoked, oauth.AccountEventDeleted, oauth.AccountEventDisabled:
+		// Sessions end first, an unlinked connection isn't found again when the event is retried
+		if event.Type == oauth.AccountEventDisabled {
+			if _, err := s.revocations.Revoke(ctx, Revocation{UserID: connection.UserID}); err != nil {
+				return err
+			}
+		}
+		if event.Type == oauth.AccountEventDeleted && s.deactivate {
+			if err := s.deactivateUser(ctx, connection.UserID); err != nil {
+				return err
+			}
+		}
+		if err := s.oauthRepo.Delete(ctx, connection.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	auditEvent := newAuditEvent(ctx, AuditProviderAccountEvent, observability.AuditOutcomeSuccess)
+	auditEvent.UserID = connection.UserID
+	auditEvent.Actor = event.Provider
+	auditEvent.Reason = fmt.Sprintf("event=%s", event.Type)
+	s.auditor.Audit(ctx, auditEvent)
+	return nil
+}
+
+// deactivateUser deactivates the account of a user and ends its sessions
+func (s *AccountEventService) deactivateUser(ctx context.Context, userID string) error {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsActive {
+		user.IsActive = false
+		if err := s.users.Update(ctx, user); err != nil {
+			return err
+		}
+	}
+	if _, err := s.revocations.Revoke(ctx, Revocation{UserID: user.ID}); err != nil {
+		return err
+	}
+	for _, hook := range s.hooks {
+		hook(ctx, user.ID)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestAccountEventService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	events := service.NewAccountEventService(env.Repos.User, env.Repos.OAuthProvider,
+		service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute), env.Redis, auditor, true)
+	var deactivated []string
+	events.OnDeactivate(func(ctx context.Context, userID string) {
+		deactivated = append(deactivated, userID)
+	})
+
+	register := func(email string) (string, string) {
+		t.Helper()
+		registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: email, Password: "Password123"})
+		if err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+		return registered.AuthResponse.User.ID, registered.RefreshToken
+	}
+	link := func(userID, provider, sub string) {
+		t.Helper()
+		if err := env.Repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: userID, Provider: provider, ProviderUserID: sub}); err != nil {
+			t.Fatalf("Failed to link provider: %v", err)
+		}
+	}
+	linked := func(provider, sub string) bool {
+		_, err := env.Repos.OAuthProvider.GetByProvider(ctx, provider, sub)
+		return !errors.Is(err, repository.ErrNotFound)
+	}
+
+	// Revoked consent unlinks the provider only
+	revokedID, revokedRefresh := register("revoked@example.com")
+	link(revokedID, oauth.ProviderApple, "apple-1")
+	if err := events.Handle(ctx, oauth.AccountEvent{Provider: oauth.ProviderApple, Subject: "apple-1", Type: oauth.AccountEventConsentRevoked}); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if linked(oauth.ProviderApple, "apple-1") {
+		t.Error("Expected the connection to be unlinked")
+	}
+	if _, err := env.Service.RefreshToken(ctx, revokedRefresh); err != nil {
+		t.Errorf("Expected the sessions to survive a revoked consent, got %v", err)
+	}
+	event, ok := auditor.last(service.AuditProviderAccountEvent)
+	if !ok || event.UserID != revokedID || event.Actor != oauth.ProviderApple || event.Reason != "event=consent_revoked" {
+		t.Errorf("Expected the event to be audited, got %+v", event)
+	}
+
+	// Deleted provider accounts deactivate the user
+	deletedID, deletedRefresh := register("deleted@example.com")
+	link(deletedID, oauth.ProviderGoogle, "google-1")
+	if err := events.Handle(ctx, oauth.AccountEvent{Provider: oauth.ProviderGoogle, Subject: "google-1", Type: oauth.AccountEventDeleted}); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	user, err := env.Repos.User.GetByID(ctx, deletedID)
+	if err != nil || user.IsActive {
+		t.Errorf("Expected the user to be deactivated, got %+v (%v)", user, err)
+	}
+	if linked(oauth.ProviderGoogle, "google-1") {
+		t.Error("Expected the connection to be unlinked")
+	}
+	if _, err := env.Service.RefreshToken(ctx, deletedRefresh); err == nil {
+		t.Error("Expected the sessions of a deactivated user to end")
+	}
+	if len(deactivated) != 1 || deactivated[0] != deletedID {
+		t.Errorf("Expected the deactivation hook to run for %s, got %v", deletedID, deactivated)
+	}
+
+	// Events of accounts that aren't linked, e.g. redelivered ones, are ignored
+	if err := events.Handle(ctx, oauth.AccountEvent{Provider: oauth.ProviderGoogle, Subject: "google-1", Type: oauth.AccountEventDeleted}); err != nil {
+		t.Errorf("Expected a redelivered event to be ignored, got %v", err)
+	}
+	if len(deactivated) != 1 {
+		t.Errorf("Expected no deactivation for unlinked accounts, got %v", deactivated)
+	}
+}
+
+func TestAccountEventServiceDeliver(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	events := service.NewAccountEventService(env.Repos.User, env.Repos.OAuthProvider,
+		service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute), env.Redis, nil, false)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	userID := registered.AuthResponse.User.ID
+	if err := env.Repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: userID, Provider: oauth.ProviderGoogle, ProviderUserID: "google-1"}); err != nil {
+		t.Fatalf("Failed to link provider: %v", err)
+	}
+
+	signOut := []oauth.AccountEvent{{
+		Provider:    oauth.ProviderGoogle,
+		Subject:     "google-1",
+		Type:        oauth.AccountEventSessionsRevoked,
+		TokenID:     "jti-1",
+		TokenExpiry: time.Now().Add(time.Hour),
+	}}
+	if duplicate, err := events.Deliver(ctx, signOut); err != nil || duplicate {
+		t.Fatalf("Expected the token to be delivered, got %v (%v)", duplicate, err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, registered.RefreshToken); err == nil {
+		t.Error("Expected the sign-out at Google to end the sessions")
+	}
+
+	// A replayed token doesn't end the sessions started since, revocations are kept in seconds
+	time.Sleep(time.Second)
+	login, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if duplicate, err := events.Deliver(ctx, signOut); err != nil || !duplicate {
+		t.Fatalf("Expected the replayed token to be dropped, got %v (%v)", duplicate, err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, login.RefreshToken); err != nil {
+		t.Errorf("Expected the session to survive the replayed token, got %v", err)
+	}
+}
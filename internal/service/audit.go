@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+)
+
+// Audited security events, exported to the SIEM when AUDIT_SINK is set
+const (
+	AuditLoginSuccess         = "login.success"
+	AuditLoginFailure         = "login.failure"
+	AuditRefreshTokenReuse    = "refresh_token.reuse"
+	AuditRefreshTokenMismatch = "refresh_token.device_mismatch"
+	AuditSessionEvicted       = "session.evicted"
+	AuditPasswordSet          = "password.set"
+	AuditRecoveryEmailChanged = "recovery.email_changed"
+	AuditRecoveryDenied       = "recovery.denied"
+	AuditUserFlagsUpdated     = "user.flags_updated"
+	AuditRestrictionChanged   = "user.restriction_changed"
+	AuditProviderAccountEvent = "provider.account_event"
+)
+
+// auditEvents describes the audited events, with their name and severity (0-10)
+var auditEvents = map[string]struct {
+	name     string
+	severity int
+}{
+	AuditLoginSuccess:         {"Login succeeded", 1},
+	AuditLoginFailure:         {"Login failed", 5},
+	AuditRefreshTokenReuse:    {"Revoked refresh token reused", 8},
+	AuditRefreshTokenMismatch: {"Refresh token used from another device", 7},
+	AuditSessionEvicted:       {"Oldest session ended over the session limit", 3},
+	AuditPasswordSet:          {"Password added to an account without one", 4},
+	AuditRecoveryEmailChanged: {"Email changed through account recovery", 6},
+	AuditRecoveryDenied:       {"Account recovery refused by a risk check", 6},
+	AuditUserFlagsUpdated:     {"Support notes or flags of a user edited", 3},
+	AuditRestrictionChanged:   {"Restriction of a user changed", 6},
+	AuditProviderAccountEvent: {"Account event of an identity provider applied", 5},
+}
+
+// newAuditEvent creates an audit event of the client of ctx
+func newAuditEvent(ctx context.Context, eventType, outcome string) observability.AuditEvent {
+	client := ClientInfoFromContext(ctx)
+	return observability.AuditEvent{
+		Type:      eventType,
+		Name:      auditEvents[eventType].name,
+		Severity:  auditEvents[eventType].severity,
+		Outcome:   outcome,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+}
+
+// auditorOrNop returns auditor, or an auditor discarding events when it is nil
+func auditorOrNop(auditor observability.Auditor) observability.Auditor {
+	if auditor == nil {
+		return observability.NopAuditor{}
+	}
+	return auditor
+}
@@ -0,0 +1,104 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// recordingAuditor keeps audited events in memory
+type recordingAuditor struct {
+	mu     sync.Mutex
+	events []observability.AuditEvent
+}
+
+func (a *recordingAuditor) Audit(_ context.Context, event observability.AuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, event)
+}
+
+// last returns the last audited event of a type
+func (a *recordingAuditor) last(eventType string) (observability.AuditEvent, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := len(a.events) - 1; i >= 0; i-- {
+		if a.events[i].Type == eventType {
+			return a.events[i], true
+		}
+	}
+	return observability.AuditEvent{}, false
+}
+
+func TestAuthServiceAudit(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingEnforce, auditor), nil, auditor, time.Hour, 0)
+
+	phone := service.ContextWithClientInfo(context.Background(), service.ClientInfo{IP: "203.0.113.10", UserAgent: "app/1.0", DeviceID: "device-1"})
+	registered, err := auth.Register(phone, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	userID := registered.AuthResponse.User.ID
+
+	if _, err := auth.Login(phone, &dto.LoginRequest{Email: "user@example.com", Password: "wrong-password"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	event, ok := auditor.last(service.AuditLoginFailure)
+	if !ok {
+		t.Fatal("Expected a failed login to be audited")
+	}
+	if event.UserID != userID || event.User != "u***@example.com" || event.Reason != "invalid_password" ||
+		event.Outcome != observability.AuditOutcomeFailure || event.IP != "203.0.113.10" || event.Severity == 0 {
+		t.Errorf("Unexpected failed login event: %+v", event)
+	}
+
+	if _, err := auth.Login(phone, &dto.LoginRequest{Email: "nobody@example.com", Password: "Password123"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if event, _ := auditor.last(service.AuditLoginFailure); event.Reason != "unknown_user" || event.UserID != "" {
+		t.Errorf("Unexpected unknown user event: %+v", event)
+	}
+
+	if _, err := auth.Login(phone, &dto.LoginRequest{Email: "user@example.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if event, ok := auditor.last(service.AuditLoginSuccess); !ok || event.UserID != userID || event.Outcome != observability.AuditOutcomeSuccess {
+		t.Errorf("Unexpected login event: %+v", event)
+	}
+
+	laptop := service.ContextWithClientInfo(context.Background(), service.ClientInfo{DeviceID: "device-2"})
+	if _, err := auth.RefreshToken(laptop, registered.RefreshToken); !errors.Is(err, service.ErrDeviceMismatch) {
+		t.Fatalf("Expected ErrDeviceMismatch, got %v", err)
+	}
+	if event, ok := auditor.last(service.AuditRefreshTokenMismatch); !ok || event.SessionID == "" || event.Outcome != observability.AuditOutcomeFailure {
+		t.Errorf("Unexpected device mismatch event: %+v", event)
+	}
+
+	// Rotated tokens are revoked, using one again is audited
+	if _, err := auth.RefreshToken(phone, registered.RefreshToken); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if _, err := auth.RefreshToken(phone, registered.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+	if event, ok := auditor.last(service.AuditRefreshTokenReuse); !ok || event.UserID != userID {
+		t.Errorf("Unexpected refresh token reuse event: %+v", event)
+	}
+}
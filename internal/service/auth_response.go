@@ -2,24 +2,49 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/prperemyshlev/auth-service-2/internal/domain"
 	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
 )
 
+// maxDeviceInfoLength matches the refresh_tokens.device_info column size
+const maxDeviceInfoLength = 255
+
 // AuthResponseWithRefreshToken contains auth response and refresh token
 type AuthResponseWithRefreshToken struct {
 	AuthResponse *dto.AuthResponse
 	RefreshToken string
 	ExpiresIn    int // Refresh token expiry in seconds
+	// SessionID stays the same when the refresh token is rotated
+	SessionID        string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
 }
 
 // generateAuthResponseWithRefreshToken generates access and refresh tokens and returns auth response with refresh token
-func (s *authService) generateAuthResponseWithRefreshToken(ctx context.Context, user *domain.User) (*AuthResponseWithRefreshToken, error) {
+// The refresh token continues the session sessionID, a new session is started when it is empty
+// and ends the oldest sessions of the user over the session limit. The refresh token with hash
+// replaces, if any, is revoked in the same transaction; ErrTokenRevoked if it was revoked already.
+func (s *authService) generateAuthResponseWithRefreshToken(ctx context.Context, user *domain.User, sessionID, replaces string) (_ *AuthResponseWithRefreshToken, err error) {
+	defer func() { s.metrics.recordIssue(ctx, err) }()
+
+	// Scope the access token to the default organization of the user, if any
+	membership, err := s.orgs.DefaultMembership(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization membership: %w", err)
+	}
+
+	issuedAt := time.Now()
+
 	// Generate access token
-	accessToken, err := s.jwtManager.GenerateAccessToken(user.ID, user.Email)
+	accessToken, err := s.accessTokens.Issue(ctx, user, membership)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -36,26 +61,107 @@ func (s *authService) generateAuthResponseWithRefreshToken(ctx context.Context,
 	// Save refresh token to database
 	refreshTokenEntity := &domain.RefreshToken{
 		UserID:    user.ID,
+		SessionID: sessionID,
 		TokenHash: tokenHash,
-		ExpiresAt: time.Now().Add(s.refreshTokenExpiry),
+		ExpiresAt: issuedAt.Add(s.refreshTokenExpiry),
+		// Bind the token to the device of the client
+		DeviceFingerprint: s.deviceBinding.Fingerprint(ctx),
 	}
 
-	err = s.tokenRepo.Create(ctx, refreshTokenEntity)
+	// Record session metadata of the client the token is issued to
+	client := ClientInfoFromContext(ctx)
+	if client.IP != "" {
+		refreshTokenEntity.IPAddress = &client.IP
+	}
+	if client.UserAgent != "" {
+		deviceInfo := truncate(client.UserAgent, maxDeviceInfoLength)
+		refreshTokenEntity.DeviceInfo = &deviceInfo
+	}
+
+	if replaces != "" {
+		err = s.tokenRepo.Rotate(ctx, replaces, refreshTokenEntity)
+		if errors.Is(err, repository.ErrNotFound) {
+			// A concurrent request rotated the token first
+			return nil, fmt.Errorf("refresh token was rotated already: %w", ErrTokenRevoked)
+		}
+	} else {
+		err = s.tokenRepo.Create(ctx, refreshTokenEntity)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to save refresh token: %w", err)
 	}
+	if sessionID == "" {
+		s.limitSessions(ctx, user.ID, refreshTokenEntity.SessionID)
+	}
 
 	return &AuthResponseWithRefreshToken{
 		AuthResponse: &dto.AuthResponse{
 			AccessToken: accessToken,
 			TokenType:   "Bearer",
-			ExpiresIn:   s.jwtManager.GetAccessTokenExpiry(),
+			ExpiresIn:   s.accessTokens.ExpiresIn(),
 			User: dto.UserInfo{
-				ID:    user.ID,
-				Email: user.Email,
+				ID:       user.ID,
+				Email:    user.Email,
+				Username: user.Username,
 			},
 		},
-		RefreshToken: refreshToken,
-		ExpiresIn:    int(s.refreshTokenExpiry.Seconds()),
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int(s.refreshTokenExpiry.Seconds()),
+		SessionID:        refreshTokenEntity.SessionID,
+		AccessExpiresAt:  issuedAt.Add(time.Duration(s.accessTokens.ExpiresIn()) * time.Second),
+		RefreshExpiresAt: refreshTokenEntity.ExpiresAt,
 	}, nil
 }
+
+// limitSessions ends the oldest sessions of a user over the session limit, the current session is
+// always kept. Failures are logged, the sessions are evicted on the next login.
+func (s *authService) limitSessions(ctx context.Context, userID, current string) {
+	if s.maxSessions <= 0 {
+		return
+	}
+
+	tokens, err := s.tokenRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		observability.LoggerFromContext(ctx).Warn("Failed to list sessions over the limit", zap.String("user_id", userID), zap.Error(err))
+		return
+	}
+
+	// Tokens are listed newest first, so the sessions seen first are the most recent ones
+	now := time.Now()
+	kept := map[string]bool{current: true}
+	evicted := make(map[string]bool)
+	for _, token := range tokens {
+		if kept[token.SessionID] || token.ExpiresAt.Before(now) {
+			continue
+		}
+		if len(kept) < s.maxSessions {
+			kept[token.SessionID] = true
+			continue
+		}
+
+		if err := s.tokenRepo.Revoke(ctx, token.ID, domain.TokenRevokeSessionLimit); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to evict session over the limit", zap.String("user_id", userID), zap.String("session_id", token.SessionID), zap.Error(err))
+			continue
+		}
+		if !evicted[token.SessionID] {
+			evicted[token.SessionID] = true
+			event := newAuditEvent(ctx, AuditSessionEvicted, observability.AuditOutcomeSuccess)
+			event.UserID = userID
+			event.SessionID = token.SessionID
+			event.Reason = "session_limit"
+			s.auditor.Audit(ctx, event)
+			s.publishSessionRevoked(ctx, userID, token.SessionID)
+		}
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting UTF-8 characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -6,12 +6,17 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/prperemyshlev/auth-service-2/internal/domain"
 	"github.com/prperemyshlev/auth-service-2/internal/dto"
 	"github.com/prperemyshlev/auth-service-2/internal/repository"
 	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/geoip"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
 )
 
 // authService implements AuthService interface
@@ -19,9 +24,116 @@ type authService struct {
 	userRepo           repository.UserRepository
 	tokenRepo          repository.TokenRepository
 	jwtManager         *utils.JWTManager
+	accessTokens       AccessTokenStrategy
 	blacklistService   *TokenBlacklistService
-	bcryptCost         int
+	revocations        *RevocationService
+	emailNormalizer    *utils.EmailNormalizer
+	passwordHasher     *PasswordHasher
+	enumeration        *EnumerationPolicy
+	consents           *ConsentService
+	invitations        *InvitationService
+	orgs               *OrganizationService
+	deviceBinding      *DeviceBinding
+	loginThrottle      *LoginThrottle
+	auditor            observability.Auditor
 	refreshTokenExpiry time.Duration
+	// maxSessions bounds the sessions of a user, the oldest ones are ended on login; 0 is unlimited
+	maxSessions int
+	// emailVerification is one of the EmailVerification policies
+	emailVerification string
+	metrics           *tokenMetrics
+	// loginStats counts logins for the admin dashboard, nil unless WithLoginStats is given
+	loginStats *StatsService
+	// sessionEvents tells other clients about ended sessions, nil unless WithSessionEvents is given
+	sessionEvents *SessionEvents
+	// validationCache skips Redis checks of recently validated tokens, nil unless WithValidationCache is given
+	validationCache *ValidationCache
+	// invalidations drops revoked access tokens from validation caches, nil unless WithCacheInvalidations is given
+	invalidations *CacheInvalidations
+	// shadowIdP mirrors registrations and logins to an external identity provider, nil unless WithShadowIdP is given
+	shadowIdP *ShadowIdP
+	// emailDomains restricts the domains of registered emails, nil unless WithEmailDomains is given
+	emailDomains *EmailDomainPolicy
+	// locator resolves the locations of sessions and logins, nil unless WithLocator is given
+	locator geoip.Locator
+	// newDeviceAlerts emails users about logins from unknown devices, nil unless WithNewDeviceAlerts is given
+	newDeviceAlerts *EmailService
+}
+
+// Email verification policies
+const (
+	// EmailVerificationOff doesn't require verified emails
+	EmailVerificationOff = "off"
+	// EmailVerificationBlock refuses logins until the email is verified
+	EmailVerificationBlock = "block"
+	// EmailVerificationRestrict lets users log in, routes requiring a verified email refuse them
+	EmailVerificationRestrict = "restrict"
+)
+
+// AuthServiceOption configures optional behavior of the auth service
+type AuthServiceOption func(*authService)
+
+// WithEmailVerification sets the email verification policy, EmailVerificationOff by default
+func WithEmailVerification(policy string) AuthServiceOption {
+	return func(s *authService) {
+		s.emailVerification = policy
+	}
+}
+
+// WithLoginStats counts logins for the admin statistics
+func WithLoginStats(stats *StatsService) AuthServiceOption {
+	return func(s *authService) {
+		s.loginStats = stats
+	}
+}
+
+// WithSessionEvents publishes the sessions ended by logout or revocation
+func WithSessionEvents(events *SessionEvents) AuthServiceOption {
+	return func(s *authService) {
+		s.sessionEvents = events
+	}
+}
+
+// WithValidationCache caches the claims of validated access tokens
+func WithValidationCache(cache *ValidationCache) AuthServiceOption {
+	return func(s *authService) {
+		s.validationCache = cache
+	}
+}
+
+// WithCacheInvalidations publishes invalidations of cached validations for revoked access tokens
+func WithCacheInvalidations(invalidations *CacheInvalidations) AuthServiceOption {
+	return func(s *authService) {
+		s.invalidations = invalidations
+	}
+}
+
+// WithShadowIdP mirrors registrations and logins to an external identity provider
+func WithShadowIdP(shadow *ShadowIdP) AuthServiceOption {
+	return func(s *authService) {
+		s.shadowIdP = shadow
+	}
+}
+
+// WithEmailDomains restricts registration to emails of the domains the policy allows
+func WithEmailDomains(policy *EmailDomainPolicy) AuthServiceOption {
+	return func(s *authService) {
+		s.emailDomains = policy
+	}
+}
+
+// WithLocator resolves the locations of sessions and logins, e.g. with a GeoIP database
+func WithLocator(locator geoip.Locator) AuthServiceOption {
+	return func(s *authService) {
+		s.locator = locator
+	}
+}
+
+// WithNewDeviceAlerts emails users about logins from devices or countries none of their sessions is from
+func WithNewDeviceAlerts(emails *EmailService) AuthServiceOption {
+	return func(s *authService) {
+		s.newDeviceAlerts = emails
+	}
 }
 
 // NewAuthService creates a new auth service
@@ -29,44 +141,146 @@ func NewAuthService(
 	userRepo repository.UserRepository,
 	tokenRepo repository.TokenRepository,
 	jwtManager *utils.JWTManager,
+	accessTokens AccessTokenStrategy,
 	blacklistService *TokenBlacklistService,
-	bcryptCost int,
+	revocations *RevocationService,
+	emailNormalizer *utils.EmailNormalizer,
+	passwordHasher *PasswordHasher,
+	enumeration *EnumerationPolicy,
+	consents *ConsentService,
+	invitations *InvitationService,
+	orgs *OrganizationService,
+	deviceBinding *DeviceBinding,
+	loginThrottle *LoginThrottle,
+	auditor observability.Auditor,
 	refreshTokenExpiry time.Duration,
+	maxSessions int,
+	opts ...AuthServiceOption,
 ) AuthService {
-	return &authService{
+	s := &authService{
 		userRepo:           userRepo,
 		tokenRepo:          tokenRepo,
 		jwtManager:         jwtManager,
+		accessTokens:       accessTokens,
 		blacklistService:   blacklistService,
-		bcryptCost:         bcryptCost,
+		revocations:        revocations,
+		emailNormalizer:    emailNormalizer,
+		passwordHasher:     passwordHasher,
+		enumeration:        enumeration,
+		consents:           consents,
+		invitations:        invitations,
+		orgs:               orgs,
+		deviceBinding:      deviceBinding,
+		loginThrottle:      loginThrottleOrNop(loginThrottle),
+		auditor:            auditorOrNop(auditor),
 		refreshTokenExpiry: refreshTokenExpiry,
+		maxSessions:        maxSessions,
+		emailVerification:  EmailVerificationOff,
+		metrics:            newTokenMetrics(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Register registers a new user
-func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (*AuthResponseWithRefreshToken, error) {
+func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+	defer func() { endSpan(span, err) }()
+
+	if s.invitations.Required() {
+		return nil, ErrInvitationRequired
+	}
+	return s.register(ctx, req, nil)
+}
+
+// RegisterWithInvitation registers the invited user with the email of the invitation
+func (s *authService) RegisterWithInvitation(ctx context.Context, token string, req *dto.RegisterWithInvitationRequest) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RegisterWithInvitation")
+	defer func() { endSpan(span, err) }()
+
+	invitation, err := s.invitations.lookup(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.register(ctx, &dto.RegisterRequest{
+		Email:                  invitation.Email,
+		Username:               req.Username,
+		Password:               req.Password,
+		AcceptedTermsVersion:   req.AcceptedTermsVersion,
+		AcceptedPrivacyVersion: req.AcceptedPrivacyVersion,
+	}, invitation)
+}
+
+// register creates a user and signs it in, accepting the invitation if there is one
+func (s *authService) register(ctx context.Context, req *dto.RegisterRequest, invitation *domain.Invitation) (*AuthResponseWithRefreshToken, error) {
 	// Validate email format
 	if !utils.ValidateEmail(req.Email) {
-		return nil, fmt.Errorf("invalid email format")
+		return nil, ErrInvalidEmail
+	}
+
+	// Invited users may register with any email, the invitation was issued to it deliberately
+	if invitation == nil {
+		if err := s.emailDomains.Check(ctx, req.Email); err != nil {
+			return nil, err
+		}
 	}
 
 	// Validate password
-	if !utils.ValidatePassword(req.Password) {
-		return nil, fmt.Errorf("password must be at least 8 characters long and contain uppercase, lowercase, and number")
+	if err := checkPasswordPolicy(req.Password); err != nil {
+		return nil, err
+	}
+
+	// Validate username
+	var username *string
+	if req.Username != nil {
+		sanitized := utils.SanitizeUsername(*req.Username)
+		if !utils.ValidateUsername(sanitized) {
+			return nil, ErrInvalidUsername
+		}
+		username = &sanitized
 	}
 
-	// Check if user already exists
-	_, err := s.userRepo.GetByEmail(ctx, req.Email)
+	// Check that the current policy versions are accepted
+	if err := s.consents.CheckAccepted(map[string]string{
+		domain.ConsentDocumentTerms:   req.AcceptedTermsVersion,
+		domain.ConsentDocumentPrivacy: req.AcceptedPrivacyVersion,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Check if user already exists, comparing normalized emails so that
+	// aliases like user+1@gmail.com can't be used to create duplicate accounts.
+	// The conflict reveals the account, so probing emails here is limited too.
+	emailNormalized := s.emailNormalizer.Normalize(req.Email)
+	if err := s.enumeration.Allow(ctx, EnumerationEndpointRegister, emailNormalized); err != nil {
+		return nil, err
+	}
+	_, err := s.userRepo.GetByEmail(ctx, emailNormalized)
 	if err == nil {
-		return nil, fmt.Errorf("user with email %s already exists", req.Email)
+		s.enumeration.Observe(ctx, EnumerationEndpointRegister, true)
+		return nil, fmt.Errorf("user with email %s already exists: %w", req.Email, ErrUserExists)
 	}
 	// If error is not NotFound, return it
 	if !errors.Is(err, repository.ErrNotFound) {
 		return nil, fmt.Errorf("failed to check user existence: %w", err)
 	}
+	s.enumeration.Observe(ctx, EnumerationEndpointRegister, false)
+
+	if username != nil {
+		available, err := s.usernameAvailable(ctx, *username)
+		if err != nil {
+			return nil, err
+		}
+		if !available {
+			return nil, fmt.Errorf("user with username %s already exists: %w", *username, ErrUsernameTaken)
+		}
+	}
 
 	// Hash password
-	passwordHash, err := utils.HashPassword(req.Password, s.bcryptCost)
+	passwordHash, err := s.passwordHasher.Hash(ctx, req.Password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -74,58 +288,210 @@ func (s *authService) Register(ctx context.Context, req *dto.RegisterRequest) (*
 	// Create user
 	user := &domain.User{
 		Email:           utils.SanitizeEmail(req.Email),
+		EmailNormalized: emailNormalized,
+		Username:        username,
 		PasswordHash:    passwordHash,
 		IsActive:        true,
 		IsEmailVerified: false,
 	}
 
-	err = s.userRepo.Create(ctx, user)
-	if err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateUsername) {
+			return nil, fmt.Errorf("user with username %s already exists: %w", *username, ErrUsernameTaken)
+		}
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// Record the consents and claim the invitation, a user without them must not be left behind
+	if err := s.consents.Record(ctx, user.ID); err != nil {
+		return nil, s.discardUser(ctx, user.ID, err)
+	}
+	if invitation != nil {
+		if err := s.invitations.accept(ctx, invitation, user.ID); err != nil {
+			return nil, s.discardUser(ctx, user.ID, err)
+		}
+	}
+	s.shadowIdP.MirrorRegistration(ctx, user, req.Password)
+
 	// Generate tokens
-	return s.generateAuthResponseWithRefreshToken(ctx, user)
+	return s.generateAuthResponseWithRefreshToken(ctx, user, "", "")
 }
 
 // Login authenticates a user
-func (s *authService) Login(ctx context.Context, req *dto.LoginRequest) (*AuthResponseWithRefreshToken, error) {
-	// Get user by email
-	user, err := s.userRepo.GetByEmail(ctx, utils.SanitizeEmail(req.Email))
+func (s *authService) Login(ctx context.Context, req *dto.LoginRequest) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer func() { endSpan(span, err) }()
+
+	// Email is accepted for backward compatibility with clients that don't send identifier
+	identifier := req.Identifier
+	if identifier == "" {
+		identifier = req.Email
+	}
+
+	// Get user by email or username
+	var user *domain.User
+	var lookup string
+	if utils.IsEmailIdentifier(identifier) {
+		lookup = s.emailNormalizer.Normalize(identifier)
+		user, err = s.userRepo.GetByEmail(ctx, lookup)
+	} else {
+		lookup = utils.SanitizeUsername(identifier)
+		user, err = s.userRepo.GetByUsername(ctx, lookup)
+	}
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
-			return nil, fmt.Errorf("invalid email or password")
+			s.enumeration.Observe(ctx, EnumerationEndpointLogin, false)
+			// Unknown accounts are throttled and take as long as wrong passwords
+			account := "identifier:" + lookup
+			if err := s.loginThrottle.Wait(ctx, account); err != nil {
+				return nil, err
+			}
+			if err := s.enumeration.SimulatePasswordCheck(ctx, req.Password); err != nil {
+				return nil, fmt.Errorf("failed to check password: %w", err)
+			}
+			s.loginThrottle.Failure(ctx, account)
+			s.auditLoginFailure(ctx, "", identifier, "unknown_user")
+			return nil, ErrInvalidCredentials
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	s.enumeration.Observe(ctx, EnumerationEndpointLogin, true)
 
-	// Check if user is active
-	if !user.IsActive {
-		return nil, fmt.Errorf("user account is inactive")
+	// Consecutive failures slow down further attempts against the account
+	if err := s.loginThrottle.Wait(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	// Check if user is active, with uniform responses only once the password proved
+	// that the client knows the account
+	if !user.IsActive && !s.enumeration.UniformResponses() {
+		s.auditLoginFailure(ctx, user.ID, identifier, "inactive")
+		return nil, ErrUserInactive
 	}
 
 	// Check password
-	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
-		return nil, fmt.Errorf("invalid email or password")
+	valid, err := s.passwordHasher.Check(ctx, req.Password, user.PasswordHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check password: %w", err)
+	}
+	if !valid {
+		s.loginThrottle.Failure(ctx, user.ID)
+		s.auditLoginFailure(ctx, user.ID, identifier, "invalid_password")
+		return nil, ErrInvalidCredentials
+	}
+	if !user.IsActive {
+		s.auditLoginFailure(ctx, user.ID, identifier, "inactive")
+		return nil, ErrUserInactive
+	}
+	s.loginThrottle.Success(ctx, user.ID)
+	s.shadowIdP.MirrorLogin(ctx, user, req.Password)
+	if s.blocksUnverified(user) {
+		s.auditLoginFailure(ctx, user.ID, identifier, "email_not_verified")
+		return nil, ErrEmailNotVerified
+	}
+
+	// Imported legacy hashes are replaced while the password is known, failures are retried
+	// on the next login
+	if s.passwordHasher.NeedsRehash(user.PasswordHash) {
+		if err := s.rehashPassword(ctx, user, req.Password); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to upgrade password hash", zap.String("user_id", user.ID), zap.Error(err))
+		}
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// IssueSession logs in a user authenticated by other means, e.g. an OAuth provider
+func (s *authService) IssueSession(ctx context.Context, userID string) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.IssueSession")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+	if s.blocksUnverified(user) {
+		return nil, ErrEmailNotVerified
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// blocksUnverified reports whether the email verification policy refuses the login of a user
+// Placeholder emails, e.g. of wallet users, have nothing to verify and aren't subject to it.
+func (s *authService) blocksUnverified(user *domain.User) bool {
+	return s.emailVerification == EmailVerificationBlock && !user.IsEmailVerified && !user.HasPlaceholderEmail()
+}
+
+// startSession records a successful login and issues tokens of a new session
+// Banned users are refused here, whatever the way they authenticated.
+func (s *authService) startSession(ctx context.Context, user *domain.User) (*AuthResponseWithRefreshToken, error) {
+	if user.Restriction == domain.RestrictionBanned {
+		s.auditLoginFailure(ctx, user.ID, "", "banned")
+		return nil, ErrAccountBanned
 	}
 
-	// Update last login
-	err = s.userRepo.UpdateLastLogin(ctx, user.ID)
+	// Update last login, failures don't fail the login
+	err := s.userRepo.UpdateLastLogin(ctx, user.ID, ClientInfoFromContext(ctx).IP)
 	if err != nil {
-		// Log error but don't fail the login
-		_ = err
+		observability.LoggerFromContext(ctx).Warn("Failed to update last login", zap.String("user_id", user.ID), zap.Error(err))
+	}
+
+	location := s.locate(ctx, ClientInfoFromContext(ctx).IP)
+	event := newAuditEvent(ctx, AuditLoginSuccess, observability.AuditOutcomeSuccess)
+	event.UserID = user.ID
+	event.Location = location.String()
+	s.auditor.Audit(ctx, event)
+	if s.loginStats != nil {
+		s.loginStats.RecordLogin(ctx, user.ID, true)
 	}
+	s.alertNewDevice(ctx, user, location)
 
 	// Generate tokens
-	return s.generateAuthResponseWithRefreshToken(ctx, user)
+	return s.generateAuthResponseWithRefreshToken(ctx, user, "", "")
+}
+
+// rehashPassword replaces the password hash of a user with a bcrypt hash
+func (s *authService) rehashPassword(ctx context.Context, user *domain.User, password string) error {
+	passwordHash, err := s.passwordHasher.Hash(ctx, password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.PasswordHash = passwordHash
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	return nil
+}
+
+// auditLoginFailure records a failed login, the identifier is masked when it is an email
+func (s *authService) auditLoginFailure(ctx context.Context, userID, identifier, reason string) {
+	event := newAuditEvent(ctx, AuditLoginFailure, observability.AuditOutcomeFailure)
+	event.UserID = userID
+	event.User = identifier
+	if utils.IsEmailIdentifier(identifier) {
+		event.User = observability.MaskEmail(identifier)
+	}
+	event.Reason = reason
+	event.Location = s.locate(ctx, event.IP).String()
+	s.auditor.Audit(ctx, event)
+	if s.loginStats != nil {
+		s.loginStats.RecordLogin(ctx, userID, false)
+	}
 }
 
 // RefreshToken refreshes access and refresh tokens
-func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*AuthResponseWithRefreshToken, error) {
+func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RefreshToken")
+	defer func() { endSpan(span, err) }()
+
 	// Validate refresh token
 	userID, err := s.jwtManager.ValidateRefreshToken(refreshToken)
 	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefreshToken, err)
 	}
 
 	// Hash the refresh token to check in database
@@ -135,14 +501,18 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*A
 	dbToken, err := s.tokenRepo.GetByTokenHash(ctx, tokenHash)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
-			return nil, fmt.Errorf("invalid refresh token")
+			// Rotated tokens stay blacklisted until they expire, using one again hints at a stolen token
+			if reused, _ := s.blacklistService.IsTokenBlacklisted(ctx, refreshToken); reused {
+				s.auditRefreshTokenReuse(ctx, userID, "")
+			}
+			return nil, ErrInvalidRefreshToken
 		}
 		return nil, fmt.Errorf("failed to get token: %w", err)
 	}
 
 	// Check if token is expired
 	if time.Now().After(dbToken.ExpiresAt) {
-		return nil, fmt.Errorf("refresh token expired")
+		return nil, ErrRefreshTokenExpired
 	}
 
 	// Check if token is blacklisted
@@ -151,7 +521,13 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*A
 		return nil, fmt.Errorf("failed to check token blacklist: %w", err)
 	}
 	if isBlacklisted {
-		return nil, fmt.Errorf("refresh token is blacklisted")
+		s.auditRefreshTokenReuse(ctx, dbToken.UserID, dbToken.SessionID)
+		return nil, fmt.Errorf("refresh token is blacklisted: %w", ErrTokenRevoked)
+	}
+
+	// Check that the token is used by the device it was issued to
+	if err := s.deviceBinding.Check(ctx, dbToken); err != nil {
+		return nil, err
 	}
 
 	// Get user
@@ -162,28 +538,47 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*A
 
 	// Check if user is active
 	if !user.IsActive {
-		return nil, fmt.Errorf("user account is inactive")
+		return nil, ErrUserInactive
+	}
+	if user.Restriction == domain.RestrictionBanned {
+		return nil, ErrAccountBanned
 	}
 
-	// Invalidate old refresh token (add to blacklist and delete from DB)
-	err = s.blacklistService.AddToken(ctx, refreshToken, s.refreshTokenExpiry)
-	if err != nil {
-		// Log error but continue
-		_ = err
+	// Blacklist the old refresh token first so that its reuse is detected. Rotation fails closed,
+	// the token isn't rotated without the blacklist entry and stays valid for a retry.
+	if err := s.blacklistService.AddToken(ctx, refreshToken, s.refreshTokenExpiry); err != nil {
+		return nil, fmt.Errorf("%w: failed to blacklist refresh token: %w", ErrRotationFailed, err)
 	}
 
-	err = s.tokenRepo.DeleteByTokenHash(ctx, tokenHash)
+	// Revoke the old refresh token and save the new one within the same session in one transaction
+	response, err := s.generateAuthResponseWithRefreshToken(ctx, user, dbToken.SessionID, tokenHash)
 	if err != nil {
-		// Log error but continue
-		_ = err
+		if errors.Is(err, ErrTokenRevoked) {
+			return nil, err
+		}
+		// Nothing was rotated, lift the blacklist entry so that the token isn't taken for a reused one
+		if err := s.blacklistService.RemoveToken(ctx, refreshToken); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to lift blacklist entry of refresh token", zap.String("session_id", dbToken.SessionID), zap.Error(err))
+		}
+		return nil, fmt.Errorf("%w: %w", ErrRotationFailed, err)
 	}
 
-	// Generate new tokens
-	return s.generateAuthResponseWithRefreshToken(ctx, user)
+	return response, nil
+}
+
+// auditRefreshTokenReuse records the use of a revoked refresh token
+func (s *authService) auditRefreshTokenReuse(ctx context.Context, userID, sessionID string) {
+	event := newAuditEvent(ctx, AuditRefreshTokenReuse, observability.AuditOutcomeFailure)
+	event.UserID = userID
+	event.SessionID = sessionID
+	s.auditor.Audit(ctx, event)
 }
 
 // Logout logs out a user
-func (s *authService) Logout(ctx context.Context, userID, refreshToken string) error {
+func (s *authService) Logout(ctx context.Context, userID, refreshToken string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Logout")
+	defer func() { endSpan(span, err) }()
+
 	if refreshToken != "" {
 		// Hash the refresh token
 		tokenHash := s.hashToken(refreshToken)
@@ -191,68 +586,361 @@ func (s *authService) Logout(ctx context.Context, userID, refreshToken string) e
 		// Check if token exists
 		dbToken, err := s.tokenRepo.GetByTokenHash(ctx, tokenHash)
 		if err == nil && dbToken.UserID == userID {
-			// Add to blacklist
+			// Add to blacklist, failures are logged and the logout continues
 			err = s.blacklistService.AddToken(ctx, refreshToken, s.refreshTokenExpiry)
 			if err != nil {
-				// Log error but continue
-				_ = err
+				observability.LoggerFromContext(ctx).Warn("Failed to blacklist refresh token on logout", zap.String("session_id", dbToken.SessionID), zap.Error(err))
 			}
 
-			// Delete from database
-			err = s.tokenRepo.DeleteByTokenHash(ctx, tokenHash)
+			// Revoke in database
+			err = s.tokenRepo.RevokeByTokenHash(ctx, tokenHash, domain.TokenRevokeLogout)
 			if err != nil {
-				// Log error but continue
-				_ = err
+				observability.LoggerFromContext(ctx).Warn("Failed to revoke refresh token on logout", zap.String("session_id", dbToken.SessionID), zap.Error(err))
 			}
+			s.publishSessionRevoked(ctx, userID, dbToken.SessionID)
 		}
 	}
 
 	return nil
 }
 
+// Token type hints of RFC 7009 revocation requests
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// RevokeToken revokes a refresh token in the database or blocks an access token until it expires
+// The hint only decides which kind is looked up first (RFC 7009). Access tokens of a revoked refresh
+// token stay valid until they expire, as after a logout.
+func (s *authService) RevokeToken(ctx context.Context, token, tokenTypeHint string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeToken")
+	defer func() { endSpan(span, err) }()
+
+	revokers := []func(ctx context.Context, token string) (bool, error){s.revokeAccessToken, s.revokeRefreshToken}
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		slices.Reverse(revokers)
+	}
+	for _, revoke := range revokers {
+		if found, err := revoke(ctx, token); found || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAccessToken blacklists an access token for the rest of its lifetime and drops it from the
+// validation caches of all replicas, reporting whether it is a valid access token
+func (s *authService) revokeAccessToken(ctx context.Context, token string) (bool, error) {
+	claims, err := s.accessTokens.Validate(ctx, token, 0)
+	if errors.Is(err, ErrInvalidToken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := s.blacklistService.AddToken(ctx, token, time.Duration(s.accessTokens.ExpiresIn())*time.Second); err != nil {
+		return false, err
+	}
+	if s.invalidations != nil {
+		s.invalidations.Publish(ctx, CacheInvalidation{Reason: CacheInvalidationRevoked, UserID: claims.UserID})
+	}
+	return true, nil
+}
+
+// revokeRefreshToken revokes a refresh token, reporting whether it is one that wasn't revoked yet
+func (s *authService) revokeRefreshToken(ctx context.Context, token string) (bool, error) {
+	tokenHash := s.hashToken(token)
+	dbToken, err := s.tokenRepo.GetByTokenHash(ctx, tokenHash)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if dbToken.RevokedAt != nil {
+		return false, nil
+	}
+	// Only unrevoked tokens are revoked, a concurrent rotation or logout may have revoked it meanwhile
+	err = s.tokenRepo.RevokeByTokenHash(ctx, tokenHash, domain.TokenRevokeClient)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	// Refreshes check the database too, a failure to blacklist is only logged. Expired tokens
+	// are refused anyway, a blacklist entry without a TTL would never expire.
+	if ttl := time.Until(dbToken.ExpiresAt); ttl > 0 {
+		if err := s.blacklistService.AddToken(ctx, token, ttl); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to blacklist revoked refresh token", zap.String("session_id", dbToken.SessionID), zap.Error(err))
+		}
+	}
+	s.publishSessionRevoked(ctx, dbToken.UserID, dbToken.SessionID)
+	return true, nil
+}
+
 // GetUser gets user information
-func (s *authService) GetUser(ctx context.Context, userID string) (*dto.UserResponse, error) {
+func (s *authService) GetUser(ctx context.Context, userID string) (_ *dto.UserResponse, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.GetUser")
+	defer func() { endSpan(span, err) }()
+
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	response := &dto.UserResponse{
-		ID:              user.ID,
-		Email:           user.Email,
-		CreatedAt:       user.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:       user.UpdatedAt.Format(time.RFC3339),
-		IsEmailVerified: user.IsEmailVerified,
+	return userResponse(user), nil
+}
+
+// UpdateProfile applies a partial update to the user's profile
+func (s *authService) UpdateProfile(ctx context.Context, userID string, req *dto.UpdateProfileRequest) (_ *dto.UserResponse, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.UpdateProfile")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if user.LastLoginAt != nil {
-		lastLogin := user.LastLoginAt.Format(time.RFC3339)
-		response.LastLoginAt = &lastLogin
+	if req.Username != nil {
+		username := utils.SanitizeUsername(*req.Username)
+		if !utils.ValidateUsername(username) {
+			return nil, ErrInvalidUsername
+		}
+		user.Username = &username
 	}
 
-	return response, nil
+	applyProfileField(&user.FirstName, req.FirstName)
+	applyProfileField(&user.LastName, req.LastName)
+	applyProfileField(&user.DisplayName, req.DisplayName)
+	applyProfileField(&user.AvatarURL, req.AvatarURL)
+	applyProfileField(&user.Locale, req.Locale)
+
+	err = s.userRepo.Update(ctx, user)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateUsername) {
+			return nil, fmt.Errorf("user with username %s already exists: %w", *user.Username, ErrUsernameTaken)
+		}
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// Re-read the user to return the updated_at set by the database
+	user, err = s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return userResponse(user), nil
+}
+
+// IsUsernameAvailable checks if a username is valid and not taken
+func (s *authService) IsUsernameAvailable(ctx context.Context, username string) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.IsUsernameAvailable")
+	defer func() { endSpan(span, err) }()
+
+	username = utils.SanitizeUsername(username)
+	if !utils.ValidateUsername(username) {
+		return false, ErrInvalidUsername
+	}
+
+	// Availability tells whether an account exists by design, so the policy only limits it
+	if err := s.enumeration.Allow(ctx, EnumerationEndpointUsernameAvailable, username); err != nil {
+		return false, err
+	}
+
+	available, err := s.usernameAvailable(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	s.enumeration.Observe(ctx, EnumerationEndpointUsernameAvailable, !available)
+
+	return available, nil
+}
+
+// usernameAvailable checks if a sanitized username is not taken
+func (s *authService) usernameAvailable(ctx context.Context, username string) (bool, error) {
+	_, err := s.userRepo.GetByUsername(ctx, username)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return false, fmt.Errorf("failed to check username availability: %w", err)
+	}
+
+	return true, nil
 }
 
 // ValidateToken validates an access token
-func (s *authService) ValidateToken(ctx context.Context, token string) (*domain.TokenClaims, error) {
+func (s *authService) ValidateToken(ctx context.Context, token string, opts ...ValidateOption) (_ *domain.TokenClaims, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ValidateToken")
+	defer func() {
+		s.metrics.recordValidation(ctx, err)
+		endSpan(span, err)
+	}()
+
+	var o validateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var generation uint64
+	if s.validationCache != nil {
+		var cached *domain.TokenClaims
+		if cached, generation = s.validationCache.get(ctx, token, o.expiryGrace); cached != nil {
+			return cached, nil
+		}
+	}
+
 	// Check if token is blacklisted
 	isBlacklisted, err := s.blacklistService.IsTokenBlacklisted(ctx, token)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check token blacklist: %w", err)
 	}
 	if isBlacklisted {
-		return nil, fmt.Errorf("token is blacklisted")
+		return nil, fmt.Errorf("token is blacklisted: %w", ErrTokenRevoked)
 	}
 
 	// Validate token
-	claims, err := s.jwtManager.ValidateToken(token)
+	claims, err := s.accessTokens.Validate(ctx, token, o.expiryGrace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if tokens of the user issued before a revocation
+	revoked, err := s.revocations.IsRevoked(ctx, claims.UserID, claims.Iat)
 	if err != nil {
-		return nil, fmt.Errorf("invalid token: %w", err)
+		return nil, fmt.Errorf("failed to check token revocations: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("token was issued before a revocation: %w", ErrTokenRevoked)
 	}
 
+	if s.validationCache != nil {
+		s.validationCache.put(token, claims, generation)
+	}
 	return claims, nil
 }
 
+// applyProfileField sets field to the trimmed value if it was provided
+// An empty value clears the field
+func applyProfileField(field **string, value *string) {
+	if value == nil {
+		return
+	}
+
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		*field = nil
+		return
+	}
+	*field = &trimmed
+}
+
+// ListSessions returns the active sessions (unexpired refresh tokens) of a user, newest first
+func (s *authService) ListSessions(ctx context.Context, userID string) (_ []*dto.SessionResponse, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ListSessions")
+	defer func() { endSpan(span, err) }()
+
+	tokens, err := s.tokenRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	now := time.Now()
+	sessions := make([]*dto.SessionResponse, 0, len(tokens))
+	for _, token := range tokens {
+		if token.ExpiresAt.Before(now) {
+			continue
+		}
+		sessions = append(sessions, &dto.SessionResponse{
+			ID:         token.SessionID,
+			CreatedAt:  token.CreatedAt.Format(time.RFC3339),
+			ExpiresAt:  token.ExpiresAt.Format(time.RFC3339),
+			DeviceInfo: token.DeviceInfo,
+			IPAddress:  token.IPAddress,
+			Location:   s.sessionLocation(ctx, token),
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session of the user by revoking its refresh token
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeSession")
+	defer func() { endSpan(span, err) }()
+
+	// Sessions are looked up among the user's tokens, so that other users' sessions can't be revoked
+	tokens, err := s.tokenRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	for _, token := range tokens {
+		if token.SessionID != sessionID {
+			continue
+		}
+		if err := s.tokenRepo.Revoke(ctx, token.ID, domain.TokenRevokeSession); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return ErrSessionNotFound
+			}
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+		s.publishSessionRevoked(ctx, userID, sessionID)
+		return nil
+	}
+
+	return ErrSessionNotFound
+}
+
+// publishSessionRevoked tells the clients of the user that a session ended
+func (s *authService) publishSessionRevoked(ctx context.Context, userID, sessionID string) {
+	if s.sessionEvents != nil {
+		s.sessionEvents.Publish(ctx, SessionEvent{Type: SessionEventRevoked, UserID: userID, SessionID: sessionID})
+	}
+}
+
+// userResponse converts a user to its API representation
+func userResponse(user *domain.User) *dto.UserResponse {
+	response := &dto.UserResponse{
+		ID:              user.ID,
+		Email:           user.Email,
+		Username:        user.Username,
+		CreatedAt:       user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       user.UpdatedAt.Format(time.RFC3339),
+		LastLoginIP:     user.LastLoginIP,
+		PreviousLoginIP: user.PreviousLoginIP,
+		LoginCount:      user.LoginCount,
+		IsEmailVerified: user.IsEmailVerified,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		DisplayName:     user.DisplayName,
+		AvatarURL:       user.AvatarURL,
+		Locale:          user.Locale,
+	}
+
+	if user.LastLoginAt != nil {
+		lastLogin := user.LastLoginAt.Format(time.RFC3339)
+		response.LastLoginAt = &lastLogin
+	}
+	if user.PreviousLoginAt != nil {
+		previousLogin := user.PreviousLoginAt.Format(time.RFC3339)
+		response.PreviousLoginAt = &previousLogin
+	}
+
+	return response
+}
+
+// discardUser deletes a user whose registration failed with err and returns err
+func (s *authService) discardUser(ctx context.Context, userID string, err error) error {
+	if deleteErr := s.userRepo.Delete(context.WithoutCancel(ctx), userID); deleteErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to delete user: %w", deleteErr))
+	}
+	return err
+}
+
 // hashToken hashes a token using SHA256
 func (s *authService) hashToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
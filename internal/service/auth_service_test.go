@@ -0,0 +1,468 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAuthService creates an auth service of env with the given consents and invitations,
+// nil ones are not required. Registering with an invitation joins the organization of its tenant.
+func newAuthService(env *testutil.AuthEnv, consents *service.ConsentService, invitations *service.InvitationService) service.AuthService {
+	if consents == nil {
+		consents = service.NewConsentService(env.Repos.Consent, "", "")
+	}
+	if invitations == nil {
+		invitations = service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{TTL: time.Hour})
+	}
+
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	invitations.OnAccept(orgs.AcceptInvitation)
+
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	return service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), consents, invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0)
+}
+
+func TestAuthServiceRegisterAndLogin(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "User@Example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	if _, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"}); !errors.Is(err, service.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+	if _, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "weak@example.com", Password: "weak"}); !errors.Is(err, service.ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+
+	loggedIn, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if loggedIn.AuthResponse.User.ID != registered.AuthResponse.User.ID {
+		t.Errorf("Expected the registered user, got %s", loggedIn.AuthResponse.User.ID)
+	}
+
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Wrong1234"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	claims, err := env.Service.ValidateToken(ctx, loggedIn.AuthResponse.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to validate access token: %v", err)
+	}
+	if claims.UserID != registered.AuthResponse.User.ID {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+}
+
+func TestAuthServiceLoginUpgradesLegacyHash(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	user := &domain.User{
+		Email:           "legacy@example.com",
+		EmailNormalized: "legacy@example.com",
+		PasswordHash:    "$1$saltsalt$LQjc41g.x5TIs3YZr.UWF/",
+		IsActive:        true,
+	}
+	if err := env.Repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "legacy@example.com", Password: "Wrong1234"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if stored, _ := env.Repos.User.GetByID(ctx, user.ID); stored.PasswordHash != user.PasswordHash {
+		t.Errorf("Expected the legacy hash to stay after a failed login, got %s", stored.PasswordHash)
+	}
+
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "legacy@example.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Failed to login with the legacy hash: %v", err)
+	}
+	stored, err := env.Repos.User.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !utils.IsBcryptHash(stored.PasswordHash) || !utils.CheckPasswordHash("Password123", stored.PasswordHash) {
+		t.Errorf("Expected the hash to be upgraded to bcrypt, got %s", stored.PasswordHash)
+	}
+}
+
+func TestAuthServiceLoginStats(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	for _, ip := range []string{"192.0.2.1", "198.51.100.7"} {
+		clientCtx := service.ContextWithClientInfo(ctx, service.ClientInfo{IP: ip})
+		if _, err := env.Service.Login(clientCtx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}); err != nil {
+			t.Fatalf("Failed to login: %v", err)
+		}
+	}
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Wrong1234"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	user, err := env.Service.GetUser(ctx, registered.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user.LoginCount != 2 || user.LastLoginAt == nil || user.LastLoginIP == nil || *user.LastLoginIP != "198.51.100.7" {
+		t.Errorf("Expected the last of 2 logins from 198.51.100.7, got %+v", user)
+	}
+	if user.PreviousLoginAt == nil || user.PreviousLoginIP == nil || *user.PreviousLoginIP != "192.0.2.1" {
+		t.Errorf("Expected the previous login from 192.0.2.1, got %+v", user)
+	}
+}
+
+func TestAuthServiceRefreshRotation(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	refreshed, err := env.Service.RefreshToken(ctx, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if refreshed.RefreshToken == registered.RefreshToken {
+		t.Error("Expected the refresh token to be rotated")
+	}
+	if refreshed.SessionID == "" || refreshed.SessionID != registered.SessionID {
+		t.Errorf("Expected the session to be kept on rotation, got %q and %q", registered.SessionID, refreshed.SessionID)
+	}
+	if !refreshed.RefreshExpiresAt.After(refreshed.AccessExpiresAt) || time.Until(refreshed.AccessExpiresAt) > 15*time.Minute {
+		t.Errorf("Unexpected expiry times: access %v, refresh %v", refreshed.AccessExpiresAt, refreshed.RefreshExpiresAt)
+	}
+
+	if _, err := env.Service.RefreshToken(ctx, registered.RefreshToken); err == nil {
+		t.Error("Expected the rotated refresh token to be rejected")
+	}
+}
+
+func TestAuthServiceSessions(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	first, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	second, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if second.SessionID == first.SessionID {
+		t.Error("Expected every login to start a session")
+	}
+	// Rotation keeps the session listed under its ID
+	if _, err := env.Service.RefreshToken(ctx, second.RefreshToken); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	sessions, err := env.Service.ListSessions(ctx, first.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != second.SessionID || sessions[1].ID != first.SessionID {
+		t.Fatalf("Expected both sessions by their IDs, got %+v", sessions)
+	}
+
+	for _, session := range sessions {
+		if err := env.Service.RevokeSession(ctx, first.AuthResponse.User.ID, session.ID); err != nil {
+			t.Fatalf("Failed to revoke session: %v", err)
+		}
+	}
+	if err := env.Service.RevokeSession(ctx, first.AuthResponse.User.ID, sessions[0].ID); !errors.Is(err, service.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, first.RefreshToken); err == nil {
+		t.Error("Expected the refresh token of a revoked session to be rejected")
+	}
+}
+
+func TestAuthServiceRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	loggedIn, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	other, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "other@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	// The hint only orders the lookups, a wrong one still revokes
+	if err := env.Service.RevokeToken(ctx, registered.AuthResponse.AccessToken, service.TokenTypeHintRefreshToken); err != nil {
+		t.Fatalf("Failed to revoke access token: %v", err)
+	}
+	if _, err := env.Service.ValidateToken(ctx, registered.AuthResponse.AccessToken); !errors.Is(err, service.ErrTokenRevoked) {
+		t.Errorf("Expected the revoked access token to be rejected, got %v", err)
+	}
+	if _, err := env.Service.ValidateToken(ctx, other.AuthResponse.AccessToken); err != nil {
+		t.Errorf("Expected other access tokens to stay valid, got %v", err)
+	}
+
+	if err := env.Service.RevokeToken(ctx, registered.RefreshToken, ""); err != nil {
+		t.Fatalf("Failed to revoke refresh token: %v", err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, registered.RefreshToken); err == nil {
+		t.Error("Expected the revoked refresh token to be rejected")
+	}
+	sessions, err := env.Service.ListSessions(ctx, registered.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != loggedIn.SessionID {
+		t.Errorf("Expected only the other session to be left, got %+v", sessions)
+	}
+
+	// Unknown and already revoked tokens are ignored (RFC 7009 section 2.2)
+	for _, token := range []string{"unknown", registered.RefreshToken, registered.AuthResponse.AccessToken} {
+		if err := env.Service.RevokeToken(ctx, token, service.TokenTypeHintAccessToken); err != nil {
+			t.Errorf("Expected %q to be ignored, got %v", token, err)
+		}
+	}
+}
+
+func TestAuthServiceRevokeRefreshTokenBlacklist(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	hash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	for _, token := range []string{"active", "revoked"} {
+		if err := env.Repos.Token.Create(ctx, &domain.RefreshToken{UserID: "user-1", TokenHash: hash(token), ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+	}
+	if err := env.Repos.Token.RevokeByTokenHash(ctx, hash("revoked"), domain.TokenRevokeLogout); err != nil {
+		t.Fatalf("Failed to revoke token: %v", err)
+	}
+
+	// Revoked tokens are blacklisted for the rest of their lifetime, not the full refresh token expiry
+	for _, token := range []string{"active", "revoked"} {
+		if err := env.Service.RevokeToken(ctx, token, service.TokenTypeHintRefreshToken); err != nil {
+			t.Fatalf("Failed to revoke %s token: %v", token, err)
+		}
+	}
+	if ttl := env.Redis.Client.TTL(ctx, "blacklist:token:active").Val(); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected the token to be blacklisted until it expires in an hour, got %s", ttl)
+	}
+	// Tokens revoked before are left alone
+	if n := env.Redis.Client.Exists(ctx, "blacklist:token:revoked").Val(); n != 0 {
+		t.Error("Expected the already revoked token not to be blacklisted again")
+	}
+}
+
+func TestAuthServiceSessionLimit(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, auditor, time.Hour, 2)
+
+	first, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	second, err := auth.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if _, ok := auditor.last(service.AuditSessionEvicted); ok {
+		t.Error("Expected no eviction within the limit")
+	}
+
+	third, err := auth.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	sessions, err := auth.ListSessions(ctx, first.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != third.SessionID || sessions[1].ID != second.SessionID {
+		t.Fatalf("Expected the 2 newest sessions, got %+v", sessions)
+	}
+	if _, err := auth.RefreshToken(ctx, first.RefreshToken); err == nil {
+		t.Error("Expected the refresh token of the evicted session to be rejected")
+	}
+
+	event, ok := auditor.last(service.AuditSessionEvicted)
+	if !ok || event.UserID != first.AuthResponse.User.ID || event.SessionID != first.SessionID || event.Reason != "session_limit" {
+		t.Errorf("Expected the eviction of the oldest session to be audited, got %+v", event)
+	}
+}
+
+func TestAuthServiceStorageErrors(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	storageErr := errors.New("connection refused")
+
+	users := &testutil.UserRepository{
+		Base: env.Repos.User,
+		GetByEmailFunc: func(ctx context.Context, email string) (*domain.User, error) {
+			return nil, storageErr
+		},
+	}
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	enumeration := service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher)
+	failing := service.NewAuthService(users, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis), service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher, enumeration, service.NewConsentService(env.Repos.Consent, "", ""), service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{}), service.NewOrganizationService(env.Repos.Organization, users, nil, nil, env.AccessTokens), service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0)
+
+	_, err := failing.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if !errors.Is(err, storageErr) {
+		t.Errorf("Expected the storage error to be propagated, got %v", err)
+	}
+}
+
+func TestAuthServiceLogsNonFatalFailures(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+	core, logs := observer.New(zap.WarnLevel)
+	ctx := observability.ContextWithLogger(observability.ContextWithRequestID(context.Background(), "req-1"), zap.New(core))
+
+	if _, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	users := &testutil.UserRepository{
+		Base: env.Repos.User,
+		UpdateLastLoginFunc: func(ctx context.Context, userID, ip string) error {
+			return errors.New("connection refused")
+		},
+	}
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	auth := service.NewAuthService(users, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{}),
+		service.NewOrganizationService(env.Repos.Organization, users, nil, nil, env.AccessTokens), service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0)
+
+	if _, err := auth.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Expected the login to succeed despite the failure, got %v", err)
+	}
+
+	entries := logs.FilterMessage("Failed to update last login").AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("Expected the failure to be logged, got %d entries", logs.Len())
+	}
+	if fields := entries[0].ContextMap(); fields["request_id"] != "req-1" || fields["error"] != "connection refused" {
+		t.Errorf("Expected the request ID and error to be logged, got %+v", fields)
+	}
+}
+
+func TestAuthServiceRefreshRotationFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	tokens := &testutil.TokenRepository{
+		Base: env.Repos.Token,
+		RotateFunc: func(ctx context.Context, tokenHash string, next *domain.RefreshToken) error {
+			return errors.New("connection refused")
+		},
+	}
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	failing := service.NewAuthService(env.Repos.User, tokens, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{}),
+		service.NewOrganizationService(env.Repos.Organization, env.Repos.User, nil, nil, env.AccessTokens), service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0)
+
+	if _, err := failing.RefreshToken(ctx, registered.RefreshToken); !errors.Is(err, service.ErrRotationFailed) {
+		t.Fatalf("Expected ErrRotationFailed, got %v", err)
+	}
+
+	// Nothing was rotated, so the token stays valid for a retry
+	refreshed, err := env.Service.RefreshToken(ctx, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected the token to be rotated on retry, got %v", err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, registered.RefreshToken); !errors.Is(err, service.ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for the rotated token, got %v", err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, refreshed.RefreshToken); err != nil {
+		t.Errorf("Failed to refresh with the new token: %v", err)
+	}
+}
+
+func TestAuthServiceEmailVerificationBlocksLogin(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0,
+		service.WithEmailVerification(service.EmailVerificationBlock))
+
+	registered, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	login := &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}
+	if _, err := auth.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "wrong"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("Expected wrong passwords to be reported first, got %v", err)
+	}
+	if _, err := auth.Login(ctx, login); !errors.Is(err, service.ErrEmailNotVerified) {
+		t.Fatalf("Expected ErrEmailNotVerified, got %v", err)
+	}
+
+	user, err := env.Repos.User.GetByID(ctx, registered.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	user.IsEmailVerified = true
+	if err := env.Repos.User.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, err := auth.Login(ctx, login); err != nil {
+		t.Errorf("Expected a verified user to log in, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+// CacheInvalidationChannel carries cache invalidations to all replicas and to downstream services
+// that cache token checks, e.g. resource servers with authmw.Config.IntrospectionCacheTTL
+const CacheInvalidationChannel = "cache_invalidation"
+
+// Cache invalidation reasons
+const (
+	// CacheInvalidationRevoked is published when tokens were revoked, by an admin, a ban, recovery or erasure
+	CacheInvalidationRevoked = "revoked"
+	// CacheInvalidationDeactivated is published when the account of a user was deactivated
+	CacheInvalidationDeactivated = "deactivated"
+)
+
+// CacheInvalidation tells caches to drop what they cached about a user
+type CacheInvalidation struct {
+	Reason string `json:"reason"`
+	// UserID is the user whose entries are dropped, all entries are dropped when empty
+	UserID string `json:"user_id,omitempty"`
+	At     int64  `json:"at"`
+}
+
+// CacheInvalidationHook is run on every replica for each invalidation published by any of them
+type CacheInvalidationHook func(ctx context.Context, inv CacheInvalidation)
+
+// CacheInvalidations publishes cache invalidations through Redis pub/sub
+// Caches in front of Redis checks would otherwise keep accepting revoked tokens until their
+// entries expire. Delivery is best effort, caches must still bound how long entries live.
+type CacheInvalidations struct {
+	redis *database.Redis
+	hooks []CacheInvalidationHook
+}
+
+// NewCacheInvalidations creates cache invalidations
+func NewCacheInvalidations(redis *database.Redis) *CacheInvalidations {
+	return &CacheInvalidations{redis: redis}
+}
+
+// OnInvalidate adds a hook run for each invalidation received by Run
+// Hooks must be added before the service is used.
+func (c *CacheInvalidations) OnInvalidate(hook CacheInvalidationHook) {
+	c.hooks = append(c.hooks, hook)
+}
+
+// Publish sends an invalidation to all replicas and downstream subscribers
+// Failures are logged, they don't fail the action the invalidation is about.
+func (c *CacheInvalidations) Publish(ctx context.Context, inv CacheInvalidation) {
+	if inv.At == 0 {
+		inv.At = time.Now().Unix()
+	}
+
+	payload, err := json.Marshal(inv)
+	if err == nil {
+		err = c.redis.Client.Publish(ctx, CacheInvalidationChannel, payload).Err()
+	}
+	if err != nil {
+		observability.LoggerFromContext(ctx).Warn("Failed to publish cache invalidation",
+			zap.String("reason", inv.Reason), zap.String("user_id", inv.UserID), zap.Error(err))
+	}
+}
+
+// Run runs the hooks for the invalidations published by any replica until ctx is cancelled
+func (c *CacheInvalidations) Run(ctx context.Context) {
+	pubsub := c.redis.Client.Subscribe(ctx, CacheInvalidationChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var inv CacheInvalidation
+			if err := json.Unmarshal([]byte(message.Payload), &inv); err != nil {
+				observability.LoggerFromContext(ctx).Warn("Failed to decode cache invalidation", zap.Error(err))
+				continue
+			}
+			for _, hook := range c.hooks {
+				hook(ctx, inv)
+			}
+		}
+	}
+}
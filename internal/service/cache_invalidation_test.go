@@ -0,0 +1,43 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestCacheInvalidations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	redis := testutil.NewRedis(t)
+
+	received := make(chan service.CacheInvalidation, 1)
+	invalidations := service.NewCacheInvalidations(redis)
+	invalidations.OnInvalidate(func(ctx context.Context, inv service.CacheInvalidation) {
+		received <- inv
+	})
+	go invalidations.Run(ctx)
+	// Invalidations published before the replica subscribed are lost
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		subscribed, err := redis.Client.PubSubNumSub(ctx, service.CacheInvalidationChannel).Result()
+		if err == nil && subscribed[service.CacheInvalidationChannel] > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the subscription")
+		}
+	}
+
+	invalidations.Publish(ctx, service.CacheInvalidation{Reason: service.CacheInvalidationDeactivated, UserID: "alice"})
+	select {
+	case inv := <-received:
+		if inv.Reason != service.CacheInvalidationDeactivated || inv.UserID != "alice" || inv.At == 0 {
+			t.Errorf("Unexpected invalidation %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the invalidation")
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported CAPTCHA providers
+const (
+	CaptchaProviderNone      = "none"
+	CaptchaProviderRecaptcha = "recaptcha"
+	CaptchaProviderHCaptcha  = "hcaptcha"
+	CaptchaProviderTurnstile = "turnstile"
+)
+
+const captchaVerifyTimeout = 5 * time.Second
+
+var captchaEndpoints = map[string]string{
+	CaptchaProviderRecaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	CaptchaProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	CaptchaProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// ErrCaptchaFailed is returned when a CAPTCHA token is rejected by the provider
+var ErrCaptchaFailed = errors.New("captcha verification failed")
+
+// CaptchaVerifier verifies CAPTCHA tokens issued to clients
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// siteVerifyCaptcha implements CaptchaVerifier for providers exposing
+// the reCAPTCHA-compatible siteverify API (reCAPTCHA v3, hCaptcha, Turnstile)
+type siteVerifyCaptcha struct {
+	endpoint string
+	secret   string
+	minScore float64
+	client   *http.Client
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      *float64 `json:"score,omitempty"`
+	ErrorCodes []string `json:"error-codes,omitempty"`
+}
+
+// NewCaptchaVerifier creates a verifier for the given provider
+// Returns nil verifier when provider is "none" or empty
+func NewCaptchaVerifier(provider, secret string, minScore float64) (CaptchaVerifier, error) {
+	if provider == "" || provider == CaptchaProviderNone {
+		return nil, nil
+	}
+
+	endpoint, ok := captchaEndpoints[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown captcha provider: %s", provider)
+	}
+
+	if secret == "" {
+		return nil, fmt.Errorf("captcha secret is required for provider %s", provider)
+	}
+
+	return &siteVerifyCaptcha{
+		endpoint: endpoint,
+		secret:   secret,
+		minScore: minScore,
+		client:   &http.Client{Timeout: captchaVerifyTimeout},
+	}, nil
+}
+
+// Verify checks the token against the provider's siteverify endpoint
+func (v *siteVerifyCaptcha) Verify(ctx context.Context, token, remoteIP string) error {
+	form := url.Values{
+		"secret":   {v.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call captcha provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha provider returned status %d", resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrCaptchaFailed, strings.Join(result.ErrorCodes, ", "))
+	}
+
+	// Only reCAPTCHA v3 returns a score
+	if result.Score != nil && *result.Score < v.minScore {
+		return fmt.Errorf("%w: score %.2f is below threshold", ErrCaptchaFailed, *result.Score)
+	}
+
+	return nil
+}
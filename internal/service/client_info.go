@@ -0,0 +1,24 @@
+package service
+
+import "context"
+
+// ClientInfo describes the client that issued the current request
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	// DeviceID is the identifier the client sends for its device, if any
+	DeviceID string
+}
+
+type clientInfoKey struct{}
+
+// ContextWithClientInfo returns a copy of ctx carrying client information
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns the client information stored in ctx, if any
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
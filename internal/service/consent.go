@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// ConsentStatus is the consent of a user to the current version of a policy document
+type ConsentStatus struct {
+	Document       string
+	CurrentVersion string
+	// Accepted is the latest consent of the user to the document, nil if none
+	Accepted *domain.Consent
+}
+
+// Pending reports whether the user has to be prompted to accept the current version
+func (s ConsentStatus) Pending() bool {
+	return s.Accepted == nil || s.Accepted.Version != s.CurrentVersion
+}
+
+// ConsentService tracks which versions of the terms of service and privacy policy users accepted
+// Only documents with a published version are required, and only their current version can be
+// accepted. Every acceptance is kept with its time and client IP as evidence.
+type ConsentService struct {
+	repo     repository.ConsentRepository
+	versions map[string]string
+}
+
+// NewConsentService creates a consent service for the published document versions,
+// a document with an empty version is not required
+func NewConsentService(repo repository.ConsentRepository, termsVersion, privacyVersion string) *ConsentService {
+	versions := make(map[string]string, 2)
+	if termsVersion != "" {
+		versions[domain.ConsentDocumentTerms] = termsVersion
+	}
+	if privacyVersion != "" {
+		versions[domain.ConsentDocumentPrivacy] = privacyVersion
+	}
+	return &ConsentService{repo: repo, versions: versions}
+}
+
+// CheckAccepted verifies that accepted, document to version, covers the current versions
+func (s *ConsentService) CheckAccepted(accepted map[string]string) error {
+	for document, version := range s.versions {
+		if accepted[document] != version {
+			return ErrConsentRequired
+		}
+	}
+	return nil
+}
+
+// Record stores the consents of a new user to the current versions
+func (s *ConsentService) Record(ctx context.Context, userID string) error {
+	for document, version := range s.versions {
+		if err := s.create(ctx, userID, document, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status returns the consent of the user to each published document
+func (s *ConsentService) Status(ctx context.Context, userID string) (_ []ConsentStatus, err error) {
+	ctx, span := tracer.Start(ctx, "ConsentService.Status")
+	defer func() { endSpan(span, err) }()
+
+	consents, err := s.repo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consents are listed oldest first, so the latest one of a document wins
+	latest := make(map[string]*domain.Consent, len(consents))
+	for _, consent := range consents {
+		latest[consent.Document] = consent
+	}
+
+	statuses := make([]ConsentStatus, 0, len(s.versions))
+	for _, document := range []string{domain.ConsentDocumentTerms, domain.ConsentDocumentPrivacy} {
+		version, ok := s.versions[document]
+		if !ok {
+			continue
+		}
+		statuses = append(statuses, ConsentStatus{
+			Document:       document,
+			CurrentVersion: version,
+			Accepted:       latest[document],
+		})
+	}
+	return statuses, nil
+}
+
+// Accept records the consent of the user to the current version of a document
+// Accepting a version again is a no-op.
+func (s *ConsentService) Accept(ctx context.Context, userID, document, version string) (err error) {
+	ctx, span := tracer.Start(ctx, "ConsentService.Accept")
+	defer func() { endSpan(span, err) }()
+
+	current, ok := s.versions[document]
+	if !ok || version != current {
+		return ErrOutdatedConsent
+	}
+
+	err = s.create(ctx, userID, document, version)
+	if errors.Is(err, repository.ErrDuplicateConsent) {
+		return nil
+	}
+	return err
+}
+
+// create stores a consent given from the client IP of the request
+func (s *ConsentService) create(ctx context.Context, userID, document, version string) error {
+	consent := &domain.Consent{
+		UserID:     userID,
+		Document:   document,
+		Version:    version,
+		AcceptedAt: time.Now(),
+	}
+	if ip := ClientInfoFromContext(ctx).IP; ip != "" {
+		consent.IPAddress = &ip
+	}
+
+	if err := s.repo.Create(ctx, consent); err != nil {
+		return fmt.Errorf("failed to record consent to %s version %s: %w", document, version, err)
+	}
+	return nil
+}
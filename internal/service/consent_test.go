@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestConsentRequiredAtRegistration(t *testing.T) {
+	ctx := service.ContextWithClientInfo(context.Background(), service.ClientInfo{IP: "192.0.2.1"})
+	env := testutil.NewAuthEnv(t)
+	auth := newAuthService(env, service.NewConsentService(env.Repos.Consent, "2024-01", "2024-02"), nil)
+
+	_, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123", AcceptedTermsVersion: "2024-01", AcceptedPrivacyVersion: "2023-12"})
+	if !errors.Is(err, service.ErrConsentRequired) {
+		t.Fatalf("Expected ErrConsentRequired for an outdated version, got %v", err)
+	}
+	if _, err := env.Repos.User.GetByEmail(ctx, "user@example.com"); err == nil {
+		t.Error("Expected no user to be created without consent")
+	}
+
+	registered, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123", AcceptedTermsVersion: "2024-01", AcceptedPrivacyVersion: "2024-02"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	consents, err := env.Repos.Consent.ListByUserID(ctx, registered.AuthResponse.User.ID)
+	if err != nil || len(consents) != 2 {
+		t.Fatalf("Expected both consents to be recorded, got %d consents %v", len(consents), err)
+	}
+	for _, consent := range consents {
+		if consent.IPAddress == nil || *consent.IPAddress != "192.0.2.1" {
+			t.Errorf("Expected the client IP to be recorded, got %v", consent.IPAddress)
+		}
+	}
+}
+
+func TestConsentRepromptAfterNewVersion(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auth := newAuthService(env, service.NewConsentService(env.Repos.Consent, "v1", ""), nil)
+
+	registered, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123", AcceptedTermsVersion: "v1"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	userID := registered.AuthResponse.User.ID
+
+	// A new version of the terms is published
+	consents := service.NewConsentService(env.Repos.Consent, "v2", "")
+	statuses, err := consents.Status(ctx, userID)
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("Expected the status of the terms only, got %d statuses %v", len(statuses), err)
+	}
+	if !statuses[0].Pending() || statuses[0].Accepted.Version != "v1" {
+		t.Errorf("Expected the new version to be pending, got %+v", statuses[0])
+	}
+
+	if err := consents.Accept(ctx, userID, domain.ConsentDocumentTerms, "v1"); !errors.Is(err, service.ErrOutdatedConsent) {
+		t.Errorf("Expected ErrOutdatedConsent for an old version, got %v", err)
+	}
+	if err := consents.Accept(ctx, userID, domain.ConsentDocumentPrivacy, "v2"); !errors.Is(err, service.ErrOutdatedConsent) {
+		t.Errorf("Expected ErrOutdatedConsent for an unpublished document, got %v", err)
+	}
+	for range 2 {
+		if err := consents.Accept(ctx, userID, domain.ConsentDocumentTerms, "v2"); err != nil {
+			t.Fatalf("Failed to accept terms: %v", err)
+		}
+	}
+
+	statuses, _ = consents.Status(ctx, userID)
+	if statuses[0].Pending() {
+		t.Errorf("Expected the terms to be accepted, got %+v", statuses[0].Accepted)
+	}
+	if history, _ := env.Repos.Consent.ListByUserID(ctx, userID); len(history) != 2 {
+		t.Errorf("Expected both versions to be kept as audit trail, got %d", len(history))
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Device binding modes
+const (
+	// DeviceBindingOff doesn't record devices
+	DeviceBindingOff = "off"
+	// DeviceBindingLog logs refresh attempts from another device but allows them
+	DeviceBindingLog = "log"
+	// DeviceBindingEnforce rejects refresh attempts from another device
+	DeviceBindingEnforce = "enforce"
+)
+
+// DeviceBinding binds refresh tokens to the device they were issued to
+// A device is identified by the device ID sent by the client or, without one, by its user agent
+// and the network of its IP (/24 for IPv4, /64 for IPv6), so that clients changing addresses
+// within their network aren't affected. Only a hash of the device is stored with the token.
+type DeviceBinding struct {
+	mode    string
+	auditor observability.Auditor
+}
+
+// NewDeviceBinding creates a device binding in one of the DeviceBinding* modes
+// Mismatches are reported to auditor, which may be nil.
+func NewDeviceBinding(mode string, auditor observability.Auditor) *DeviceBinding {
+	return &DeviceBinding{mode: mode, auditor: auditorOrNop(auditor)}
+}
+
+// Fingerprint returns the fingerprint to store with a refresh token issued to the client of ctx,
+// nil when binding is off or the client can't be identified
+func (b *DeviceBinding) Fingerprint(ctx context.Context) *string {
+	if b.mode == DeviceBindingOff {
+		return nil
+	}
+
+	fingerprint := deviceFingerprint(ClientInfoFromContext(ctx))
+	if fingerprint == "" {
+		return nil
+	}
+	return &fingerprint
+}
+
+// Check reports whether the refresh token may be used by the client of ctx
+// Tokens issued without fingerprint are accepted, a mismatch is logged and rejected with
+// ErrDeviceMismatch in enforce mode.
+func (b *DeviceBinding) Check(ctx context.Context, token *domain.RefreshToken) error {
+	if b.mode == DeviceBindingOff || token.DeviceFingerprint == nil {
+		return nil
+	}
+
+	client := ClientInfoFromContext(ctx)
+	if deviceFingerprint(client) == *token.DeviceFingerprint {
+		return nil
+	}
+
+	enforced := b.mode == DeviceBindingEnforce
+	trace.SpanFromContext(ctx).AddEvent("device_mismatch", trace.WithAttributes(attribute.Bool("enforced", enforced)))
+	observability.LoggerFromContext(ctx).Warn("Refresh token used from another device",
+		zap.String("user_id", token.UserID),
+		zap.String("session_id", token.SessionID),
+		zap.String("ip", client.IP),
+		zap.String("user_agent", client.UserAgent),
+		zap.Bool("rejected", enforced),
+	)
+
+	event := newAuditEvent(ctx, AuditRefreshTokenMismatch, observability.AuditOutcomeSuccess)
+	if enforced {
+		event.Outcome = observability.AuditOutcomeFailure
+	}
+	event.UserID = token.UserID
+	event.SessionID = token.SessionID
+	b.auditor.Audit(ctx, event)
+
+	if enforced {
+		return ErrDeviceMismatch
+	}
+	return nil
+}
+
+// deviceFingerprint hashes the device ID of a client or its user agent and network,
+// an empty string means the client can't be identified
+func deviceFingerprint(client ClientInfo) string {
+	var device string
+	switch {
+	case client.DeviceID != "":
+		device = "id:" + client.DeviceID
+	case client.UserAgent != "" || client.IP != "":
+		device = "ua:" + client.UserAgent + "\nnet:" + networkPrefix(client.IP)
+	default:
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(device))
+	return hex.EncodeToString(hash[:])
+}
+
+// networkPrefix returns the /24 network of an IPv4 or the /64 network of an IPv6 address
+func networkPrefix(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	addr = addr.Unmap()
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
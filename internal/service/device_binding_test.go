@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newDeviceBoundAuthService creates an auth service of env binding refresh tokens in mode
+func newDeviceBoundAuthService(env *testutil.AuthEnv, mode string) service.AuthService {
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	return service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(mode, nil), nil, nil, time.Hour, 0)
+}
+
+func TestDeviceBinding(t *testing.T) {
+	phone := service.ClientInfo{IP: "203.0.113.10", UserAgent: "app/1.0", DeviceID: "device-1"}
+	tests := []struct {
+		name    string
+		mode    string
+		issued  service.ClientInfo
+		refresh service.ClientInfo
+		wantErr error
+	}{
+		{name: "same device", mode: service.DeviceBindingEnforce, issued: phone, refresh: service.ClientInfo{IP: "198.51.100.7", UserAgent: "app/1.1", DeviceID: "device-1"}},
+		{name: "other device", mode: service.DeviceBindingEnforce, issued: phone, refresh: service.ClientInfo{IP: "203.0.113.10", UserAgent: "app/1.0", DeviceID: "device-2"}, wantErr: service.ErrDeviceMismatch},
+		{name: "other device logged only", mode: service.DeviceBindingLog, issued: phone, refresh: service.ClientInfo{DeviceID: "device-2"}},
+		{name: "binding off", mode: service.DeviceBindingOff, issued: phone, refresh: service.ClientInfo{DeviceID: "device-2"}},
+		{name: "same network without device ID", mode: service.DeviceBindingEnforce, issued: service.ClientInfo{IP: "203.0.113.10", UserAgent: "browser"}, refresh: service.ClientInfo{IP: "203.0.113.99", UserAgent: "browser"}},
+		{name: "same IPv6 network", mode: service.DeviceBindingEnforce, issued: service.ClientInfo{IP: "2001:db8:1:2::1", UserAgent: "browser"}, refresh: service.ClientInfo{IP: "2001:db8:1:2:ffff::9", UserAgent: "browser"}},
+		{name: "other network", mode: service.DeviceBindingEnforce, issued: service.ClientInfo{IP: "203.0.113.10", UserAgent: "browser"}, refresh: service.ClientInfo{IP: "203.0.114.10", UserAgent: "browser"}, wantErr: service.ErrDeviceMismatch},
+		{name: "other user agent", mode: service.DeviceBindingEnforce, issued: service.ClientInfo{IP: "203.0.113.10", UserAgent: "browser"}, refresh: service.ClientInfo{IP: "203.0.113.10", UserAgent: "curl"}, wantErr: service.ErrDeviceMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testutil.NewAuthEnv(t)
+			auth := newDeviceBoundAuthService(env, tt.mode)
+
+			registered, err := auth.Register(service.ContextWithClientInfo(context.Background(), tt.issued), &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+			if err != nil {
+				t.Fatalf("Failed to register: %v", err)
+			}
+
+			_, err = auth.RefreshToken(service.ContextWithClientInfo(context.Background(), tt.refresh), registered.RefreshToken)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDeviceBindingOfUnboundTokens(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+
+	// Tokens issued while binding was off stay valid when it is enforced
+	registered, err := newDeviceBoundAuthService(env, service.DeviceBindingOff).Register(context.Background(), &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	auth := newDeviceBoundAuthService(env, service.DeviceBindingEnforce)
+	ctx := service.ContextWithClientInfo(context.Background(), service.ClientInfo{DeviceID: "device-1"})
+	refreshed, err := auth.RefreshToken(ctx, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected an unbound token to be accepted, got %v", err)
+	}
+
+	// and are bound from the next rotation on
+	other := service.ContextWithClientInfo(context.Background(), service.ClientInfo{DeviceID: "device-2"})
+	if _, err := auth.RefreshToken(other, refreshed.RefreshToken); !errors.Is(err, service.ErrDeviceMismatch) {
+		t.Errorf("Expected ErrDeviceMismatch, got %v", err)
+	}
+}
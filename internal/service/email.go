@@ -0,0 +1,303 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/i18n"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"github.com/prperemyshlev/auth-service-2/pkg/mailer"
+)
+
+// Email templates
+const (
+	EmailTemplateVerification     = "verification"
+	EmailTemplatePasswordReset    = "password_reset"
+	EmailTemplateNewDevice        = "new_device"
+	EmailTemplateEmailChanged     = "email_changed"
+	EmailTemplateUnverifiedExpiry = "unverified_expiry"
+)
+
+const (
+	// sendEmailJob is the job type used to deliver rendered emails
+	sendEmailJob = "email.send"
+
+	fallbackEmailLocale = "en"
+)
+
+//go:embed templates/email/*.tmpl
+var emailTemplatesFS embed.FS
+
+// EmailBranding is the branding of the tenant of a request shown in emails,
+// templates leave out empty fields
+type EmailBranding struct {
+	Name    string
+	LogoURL string
+	Color   string
+}
+
+// LinkEmailData is the template data for emails containing an action link
+type LinkEmailData struct {
+	Link      string
+	ExpiresIn string
+	Brand     EmailBranding
+}
+
+// NewDeviceEmailData is the template data for new device sign-in alerts
+type NewDeviceEmailData struct {
+	Device   string
+	IP       string
+	Location string
+	Time     string
+	Brand    EmailBranding
+}
+
+// EmailChangedEmailData is the template data for notices sent to the former email of an account
+type EmailChangedEmailData struct {
+	// NewEmail is masked, the former owner of the address may not be the user anymore
+	NewEmail string
+	Provider string
+	Time     string
+	Brand    EmailBranding
+}
+
+// UnverifiedExpiryEmailData is the template data for warnings sent before unverified accounts expire
+type UnverifiedExpiryEmailData struct {
+	// ExpiresOn is the date the account expires at, e.g. 2024-01-02
+	ExpiresOn string
+	// Deactivate is set when expired accounts are deactivated rather than deleted
+	Deactivate bool
+	Brand      EmailBranding
+}
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// EmailService renders localized emails and delivers them asynchronously through the job runner
+// Templates live in templates/email as <name>.<locale>.tmpl and define "subject", "text" and "html"
+type EmailService struct {
+	runner        *jobs.Runner
+	mailer        mailer.Mailer
+	defaultLocale string
+	templates     map[string]*emailTemplate
+}
+
+// NewEmailService creates a new email service and registers the delivery job handler
+func NewEmailService(runner *jobs.Runner, m mailer.Mailer, defaultLocale string) (*EmailService, error) {
+	templates, err := loadEmailTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultLocale == "" {
+		defaultLocale = fallbackEmailLocale
+	}
+
+	s := &EmailService{
+		runner:        runner,
+		mailer:        m,
+		defaultLocale: strings.ToLower(defaultLocale),
+		templates:     templates,
+	}
+	runner.Register(sendEmailJob, s.deliver)
+
+	return s, nil
+}
+
+// Send renders the template in the given locale and enqueues the email for delivery
+// Callers pass the locale from the user profile; when it is empty the request locale is used.
+// Emails are sent from the sender of the tenant of the request, if it has one.
+func (s *EmailService) Send(ctx context.Context, to, templateName, locale string, data any) error {
+	msg, err := s.Render(to, templateName, s.requestLocale(ctx, locale), data)
+	if err != nil {
+		return err
+	}
+	if tenant := TenantFromContext(ctx); tenant != nil && tenant.EmailFrom != nil {
+		msg.From = *tenant.EmailFrom
+	}
+
+	if err := s.runner.Enqueue(ctx, sendEmailJob, msg); err != nil {
+		return fmt.Errorf("failed to enqueue email: %w", err)
+	}
+
+	return nil
+}
+
+// SendVerification sends an email address verification link
+func (s *EmailService) SendVerification(ctx context.Context, to, locale, link string, expiresIn time.Duration) error {
+	return s.Send(ctx, to, EmailTemplateVerification, locale, LinkEmailData{
+		Link:      link,
+		ExpiresIn: formatEmailDuration(expiresIn, s.resolveLocale(EmailTemplateVerification, s.requestLocale(ctx, locale))),
+		Brand:     emailBranding(ctx),
+	})
+}
+
+// SendPasswordReset sends a password reset link
+func (s *EmailService) SendPasswordReset(ctx context.Context, to, locale, link string, expiresIn time.Duration) error {
+	return s.Send(ctx, to, EmailTemplatePasswordReset, locale, LinkEmailData{
+		Link:      link,
+		ExpiresIn: formatEmailDuration(expiresIn, s.resolveLocale(EmailTemplatePasswordReset, s.requestLocale(ctx, locale))),
+		Brand:     emailBranding(ctx),
+	})
+}
+
+// SendNewDeviceAlert notifies the user about a sign-in from a new device
+func (s *EmailService) SendNewDeviceAlert(ctx context.Context, to, locale string, data NewDeviceEmailData) error {
+	data.Brand = emailBranding(ctx)
+	return s.Send(ctx, to, EmailTemplateNewDevice, locale, data)
+}
+
+// SendEmailChanged notifies the former email of an account that the email was changed
+func (s *EmailService) SendEmailChanged(ctx context.Context, to, locale string, data EmailChangedEmailData) error {
+	data.Brand = emailBranding(ctx)
+	return s.Send(ctx, to, EmailTemplateEmailChanged, locale, data)
+}
+
+// SendUnverifiedExpiry warns the user that the account expires unless the email is verified
+func (s *EmailService) SendUnverifiedExpiry(ctx context.Context, to, locale string, data UnverifiedExpiryEmailData) error {
+	data.Brand = emailBranding(ctx)
+	return s.Send(ctx, to, EmailTemplateUnverifiedExpiry, locale, data)
+}
+
+// Render renders the template in the best matching locale
+func (s *EmailService) Render(to, templateName, locale string, data any) (*mailer.Message, error) {
+	tmpl, ok := s.templates[templateKey(templateName, s.resolveLocale(templateName, locale))]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template: %s", templateName)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render email subject: %w", err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return nil, fmt.Errorf("failed to render email text: %w", err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return nil, fmt.Errorf("failed to render email html: %w", err)
+	}
+
+	return &mailer.Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()),
+		HTML:    strings.TrimSpace(html.String()),
+	}, nil
+}
+
+// emailBranding returns the branding of the tenant of the request, if any
+func emailBranding(ctx context.Context) EmailBranding {
+	var branding EmailBranding
+	tenant := TenantFromContext(ctx)
+	if tenant == nil {
+		return branding
+	}
+
+	branding.Name = tenant.Name
+	if tenant.BrandName != nil {
+		branding.Name = *tenant.BrandName
+	}
+	if tenant.LogoURL != nil {
+		branding.LogoURL = *tenant.LogoURL
+	}
+	if tenant.BrandColor != nil {
+		branding.Color = *tenant.BrandColor
+	}
+	return branding
+}
+
+// requestLocale returns locale or the request locale if it is empty
+func (s *EmailService) requestLocale(ctx context.Context, locale string) string {
+	if locale == "" {
+		return i18n.FromContext(ctx)
+	}
+	return locale
+}
+
+// resolveLocale picks the requested locale, its base language, the default locale or English
+func (s *EmailService) resolveLocale(templateName, locale string) string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	base, _, _ := strings.Cut(locale, "-")
+
+	for _, candidate := range []string{locale, base, s.defaultLocale, fallbackEmailLocale} {
+		if _, ok := s.templates[templateKey(templateName, candidate)]; ok {
+			return candidate
+		}
+	}
+	return fallbackEmailLocale
+}
+
+// deliver is the job handler sending a rendered email
+func (s *EmailService) deliver(ctx context.Context, payload json.RawMessage) error {
+	var msg mailer.Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return jobs.Permanent(fmt.Errorf("failed to decode email: %w", err))
+	}
+
+	if err := s.mailer.Send(ctx, &msg); err != nil {
+		if errors.Is(err, mailer.ErrRejected) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// loadEmailTemplates parses all embedded templates keyed by name and locale
+func loadEmailTemplates() (map[string]*emailTemplate, error) {
+	files, err := fs.Glob(emailTemplatesFS, "templates/email/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list email templates: %w", err)
+	}
+
+	templates := make(map[string]*emailTemplate, len(files))
+	for _, file := range files {
+		name, locale, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".tmpl"), ".")
+		if !ok {
+			return nil, fmt.Errorf("email template %s must be named <name>.<locale>.tmpl", file)
+		}
+
+		text, err := texttemplate.ParseFS(emailTemplatesFS, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+		html, err := htmltemplate.ParseFS(emailTemplatesFS, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", file, err)
+		}
+
+		templates[templateKey(name, locale)] = &emailTemplate{text: text, html: html}
+	}
+
+	return templates, nil
+}
+
+func templateKey(name, locale string) string {
+	return name + "." + locale
+}
+
+// formatEmailDuration formats link lifetimes like "24 h" or "30 min" in the given locale
+func formatEmailDuration(d time.Duration, locale string) string {
+	hours, minutes := "h", "min"
+	if locale == "ru" {
+		hours, minutes = "ч", "мин"
+	}
+
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d %s", int(d.Hours()), hours)
+	}
+	return fmt.Sprintf("%d %s", int(d.Minutes()), minutes)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxEmailDomains limits the allow-list of a tenant
+const maxEmailDomains = 100
+
+// EmailDomainPolicy restricts registration to emails of allowed domains, e.g. for internal tools
+// open to the employees of a company only
+// The allow-list is the one of the tenant of the request, or the configured one for requests
+// without a tenant or tenants without allowed domains; anyone may register when both are empty.
+// An entry matches the domain itself, an entry like *.example.com the subdomains of example.com.
+// Invited users register regardless of their domain.
+type EmailDomainPolicy struct {
+	allowed []string
+}
+
+// NewEmailDomainPolicy creates a policy with the allow-list of requests without a tenant
+// Invalid entries are skipped, they are rejected when validating the configuration.
+func NewEmailDomainPolicy(allowed []string) *EmailDomainPolicy {
+	p := &EmailDomainPolicy{}
+	for _, entry := range allowed {
+		if entry, err := normalizeEmailDomain(entry); err == nil {
+			p.allowed = append(p.allowed, entry)
+		}
+	}
+	return p
+}
+
+// Check returns ErrEmailDomainNotAllowed if the domain of email may not register
+// A nil policy allows every domain.
+func (p *EmailDomainPolicy) Check(ctx context.Context, email string) error {
+	allowed := p.AllowList(ctx)
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return ErrEmailDomainNotAllowed
+	}
+	domainName := strings.TrimSuffix(strings.ToLower(email[at+1:]), ".")
+	for _, entry := range allowed {
+		if parent, ok := strings.CutPrefix(entry, "*."); ok {
+			if strings.HasSuffix(domainName, "."+parent) {
+				return nil
+			}
+		} else if domainName == entry {
+			return nil
+		}
+	}
+	return ErrEmailDomainNotAllowed
+}
+
+// AllowList returns the allowed domains of the tenant of the request, or the configured ones
+func (p *EmailDomainPolicy) AllowList(ctx context.Context) []string {
+	if tenant := TenantFromContext(ctx); tenant != nil && len(tenant.AllowedEmailDomains) > 0 {
+		return tenant.AllowedEmailDomains
+	}
+	if p == nil {
+		return nil
+	}
+	return p.allowed
+}
+
+// normalizeEmailDomains lowercases the entries of an allow-list and drops duplicates, or returns
+// an error for entries that aren't domains
+func normalizeEmailDomains(domains []string) ([]string, error) {
+	if len(domains) > maxEmailDomains {
+		return nil, fmt.Errorf("at most %d allowed email domains are allowed", maxEmailDomains)
+	}
+
+	normalized := make([]string, 0, len(domains))
+	for _, entry := range domains {
+		entry, err := normalizeEmailDomain(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(normalized, entry) {
+			normalized = append(normalized, entry)
+		}
+	}
+	return normalized, nil
+}
+
+// normalizeEmailDomain lowercases a domain like example.com or *.example.com, with an optional @
+func normalizeEmailDomain(entry string) (string, error) {
+	entry = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(entry), "@"))
+	name := strings.TrimPrefix(entry, "*.")
+	if len(name) > maxTenantSettingLength || !strings.Contains(name, ".") || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return "", fmt.Errorf("allowed email domain %q must be a domain like example.com or *.example.com", entry)
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '.' {
+			return "", fmt.Errorf("allowed email domain %q must be a domain like example.com or *.example.com", entry)
+		}
+	}
+	return entry, nil
+}
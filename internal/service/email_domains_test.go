@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEmailDomainPolicy(t *testing.T) {
+	policy := service.NewEmailDomainPolicy([]string{"Acme.com", "@*.corp.acme.com", "not a domain"})
+	tenant := service.ContextWithTenant(context.Background(), &domain.Tenant{ID: "partner", AllowedEmailDomains: []string{"partner.com"}})
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		email   string
+		allowed bool
+	}{
+		{name: "configured domain", ctx: context.Background(), email: "user@ACME.com", allowed: true},
+		{name: "subdomain of wildcard", ctx: context.Background(), email: "user@eu.corp.acme.com", allowed: true},
+		{name: "apex of wildcard", ctx: context.Background(), email: "user@corp.acme.com"},
+		{name: "subdomain without wildcard", ctx: context.Background(), email: "user@mail.acme.com"},
+		{name: "lookalike domain", ctx: context.Background(), email: "user@evilacme.com"},
+		{name: "tenant domain", ctx: tenant, email: "user@partner.com", allowed: true},
+		{name: "configured domain on tenant", ctx: tenant, email: "user@acme.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.ctx, tt.email)
+			if tt.allowed && err != nil {
+				t.Errorf("Expected %s to be allowed, got %v", tt.email, err)
+			}
+			if !tt.allowed && !errors.Is(err, service.ErrEmailDomainNotAllowed) {
+				t.Errorf("Expected ErrEmailDomainNotAllowed for %s, got %v", tt.email, err)
+			}
+		})
+	}
+
+	var open *service.EmailDomainPolicy
+	if err := open.Check(context.Background(), "user@example.com"); err != nil {
+		t.Errorf("Expected a nil policy to allow every domain, got %v", err)
+	}
+}
+
+func TestAuthServiceEmailDomains(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{TTL: time.Hour})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0,
+		service.WithEmailDomains(service.NewEmailDomainPolicy([]string{"acme.com"})))
+
+	if _, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@acme.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Failed to register with an allowed domain: %v", err)
+	}
+	if _, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@gmail.com", Password: "Password123"}); !errors.Is(err, service.ErrEmailDomainNotAllowed) {
+		t.Errorf("Expected ErrEmailDomainNotAllowed, got %v", err)
+	}
+
+	// Invitations are issued deliberately, invited users register with any domain
+	_, token, err := invitations.Create(ctx, service.CreateInvitation{Email: "contractor@gmail.com"})
+	if err != nil {
+		t.Fatalf("Failed to invite: %v", err)
+	}
+	if _, err := auth.RegisterWithInvitation(ctx, token, &dto.RegisterWithInvitationRequest{Password: "Password123"}); err != nil {
+		t.Errorf("Expected the invited user to register, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// emailNormalizationPolicyKey holds the policy the normalized emails of all users follow
+	emailNormalizationPolicyKey = "email_normalization:policy"
+	// emailNormalizationBatch is the number of users read at once
+	emailNormalizationBatch = 500
+)
+
+// EmailCollision is a user whose email normalizes to the normalized email of another user
+type EmailCollision struct {
+	UserID      string
+	OtherUserID string
+	// EmailNormalized is the normalized email both users have under the current policy
+	EmailNormalized string
+}
+
+// EmailNormalizationService re-normalizes the stored emails of existing users when the
+// normalization policy changes, since logins and lookups search emails normalized with the
+// current policy. Users whose email then collides with another user keep their former normalized
+// email and are reported until an admin changes the email of one of them; the policy is recorded
+// once all users follow it, so that later starts skip the sweep.
+type EmailNormalizationService struct {
+	users      repository.UserRepository
+	normalizer *utils.EmailNormalizer
+	redis      *database.Redis
+}
+
+// NewEmailNormalizationService creates a new email normalization service
+func NewEmailNormalizationService(users repository.UserRepository, normalizer *utils.EmailNormalizer, redis *database.Redis) *EmailNormalizationService {
+	return &EmailNormalizationService{users: users, normalizer: normalizer, redis: redis}
+}
+
+// NormalizeAll normalizes the emails of all users with the current policy unless they follow it
+// already, and returns the number of users updated and the collisions left to resolve
+func (s *EmailNormalizationService) NormalizeAll(ctx context.Context) (updated int, collisions []EmailCollision, err error) {
+	ctx, span := tracer.Start(ctx, "EmailNormalizationService.NormalizeAll")
+	defer func() { endSpan(span, err) }()
+
+	policy := s.normalizer.Policy()
+	current, err := s.redis.Client.Get(ctx, emailNormalizationPolicyKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, nil, fmt.Errorf("failed to get email normalization policy: %w", err)
+	}
+	if current == policy {
+		return 0, nil, nil
+	}
+
+	afterID := ""
+	for {
+		users, err := s.users.ListAfter(ctx, afterID, emailNormalizationBatch)
+		if err != nil {
+			return updated, collisions, fmt.Errorf("failed to list users: %w", err)
+		}
+
+		for _, user := range users {
+			normalized := s.normalizer.Normalize(user.Email)
+			if normalized == user.EmailNormalized {
+				continue
+			}
+
+			err := s.users.SetEmailNormalized(ctx, user.ID, normalized)
+			if errors.Is(err, repository.ErrDuplicateEmail) {
+				other, lookupErr := s.users.GetByEmail(ctx, normalized)
+				if lookupErr != nil {
+					return updated, collisions, fmt.Errorf("failed to get colliding user: %w", lookupErr)
+				}
+				collisions = append(collisions, EmailCollision{UserID: user.ID, OtherUserID: other.ID, EmailNormalized: normalized})
+				continue
+			}
+			if err != nil {
+				return updated, collisions, fmt.Errorf("failed to normalize email of user %s: %w", user.ID, err)
+			}
+			updated++
+		}
+
+		if len(users) < emailNormalizationBatch {
+			break
+		}
+		afterID = users[len(users)-1].ID
+	}
+
+	// Collisions are reported again on the next start until they are resolved
+	if len(collisions) == 0 {
+		if err := s.redis.Client.Set(ctx, emailNormalizationPolicyKey, policy, 0).Err(); err != nil {
+			return updated, nil, fmt.Errorf("failed to record email normalization policy: %w", err)
+		}
+	}
+	return updated, collisions, nil
+}
+
+// Run normalizes the emails of all users once and logs the outcome
+func (s *EmailNormalizationService) Run(ctx context.Context) {
+	logger := observability.LoggerFromContext(ctx)
+
+	updated, collisions, err := s.NormalizeAll(ctx)
+	if err != nil {
+		logger.Error("Failed to normalize user emails", zap.Int("updated", updated), zap.Error(err))
+		return
+	}
+	if updated > 0 {
+		logger.Info("Normalized user emails with the current policy", zap.Int("updated", updated))
+	}
+	for _, collision := range collisions {
+		logger.Warn("User email collides with another user under the normalization policy, change the email of one of them",
+			zap.String("user_id", collision.UserID), zap.String("other_user_id", collision.OtherUserID))
+	}
+}
@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEmailNormalizationServiceNormalizeAll(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	normalizer := utils.NewEmailNormalizer([]string{"gmail.com"}, []string{"gmail.com"})
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	invitations := service.NewInvitationService(env.Repos.Invitation, normalizer, service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, normalizer, env.AccessTokens)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), normalizer, hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0)
+
+	hash, err := hasher.Hash(ctx, "Password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	// Users stored before the policy applied have their email only lowercased
+	legacy := &domain.User{Email: "First.Last@gmail.com", EmailNormalized: "first.last@gmail.com", PasswordHash: hash, IsActive: true}
+	dotted := &domain.User{Email: "a.b@gmail.com", EmailNormalized: "a.b@gmail.com", IsActive: true}
+	other := &domain.User{Email: "ab@gmail.com", EmailNormalized: "ab@gmail.com", IsActive: true}
+	for _, user := range []*domain.User{legacy, dotted, other} {
+		if err := env.Repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	login := &dto.LoginRequest{Identifier: "First.Last@gmail.com", Password: "Password123"}
+	if _, err := auth.Login(ctx, login); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("Expected the legacy user to be unreachable before normalization, got %v", err)
+	}
+
+	normalization := service.NewEmailNormalizationService(env.Repos.User, normalizer, env.Redis)
+	updated, collisions, err := normalization.NormalizeAll(ctx)
+	if err != nil {
+		t.Fatalf("Failed to normalize emails: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 updated user, got %d", updated)
+	}
+	if len(collisions) != 1 || collisions[0].UserID != dotted.ID || collisions[0].OtherUserID != other.ID || collisions[0].EmailNormalized != "ab@gmail.com" {
+		t.Errorf("Expected a collision of the dotted user with the other user, got %+v", collisions)
+	}
+
+	if _, err := auth.Login(ctx, login); err != nil {
+		t.Fatalf("Expected the legacy user to log in after normalization, got %v", err)
+	}
+	if user, err := env.Repos.User.GetByID(ctx, dotted.ID); err != nil || user.EmailNormalized != "a.b@gmail.com" {
+		t.Errorf("Expected the colliding user to keep its normalized email, got %+v (%v)", user, err)
+	}
+
+	// The collision is reported again until it is resolved, the policy is recorded afterwards
+	if _, collisions, err := normalization.NormalizeAll(ctx); err != nil || len(collisions) != 1 {
+		t.Fatalf("Expected the collision to be reported again, got %+v (%v)", collisions, err)
+	}
+	if err := env.Repos.User.Delete(ctx, other.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if updated, collisions, err := normalization.NormalizeAll(ctx); err != nil || updated != 1 || len(collisions) != 0 {
+		t.Fatalf("Expected the resolved collision to be normalized, got %d updated, %+v (%v)", updated, collisions, err)
+	}
+	if err := env.Repos.User.SetEmailNormalized(ctx, dotted.ID, "a.b@gmail.com"); err != nil {
+		t.Fatalf("Failed to set normalized email: %v", err)
+	}
+	if updated, _, err := normalization.NormalizeAll(ctx); err != nil || updated != 0 {
+		t.Errorf("Expected no sweep under a recorded policy, got %d updated (%v)", updated, err)
+	}
+}
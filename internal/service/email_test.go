@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"github.com/prperemyshlev/auth-service-2/pkg/mailer"
+	"go.uber.org/zap"
+)
+
+// recordingMailer stores sent messages
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []*mailer.Message
+	err  error
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *recordingMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sent)
+}
+
+func newTestEmailService(t *testing.T, m mailer.Mailer) (*EmailService, *jobs.Runner) {
+	t.Helper()
+
+	rdb, _ := newTestRedis(t)
+	runner := jobs.NewRunner(rdb, zap.NewNop(), jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond})
+
+	emails, err := NewEmailService(runner, m, "en")
+	if err != nil {
+		t.Fatalf("Failed to create email service: %v", err)
+	}
+	return emails, runner
+}
+
+func TestEmailServiceRender(t *testing.T) {
+	emails, _ := newTestEmailService(t, mailer.Noop())
+
+	tests := []struct {
+		template string
+		locale   string
+		data     any
+		subject  string
+		contains string
+	}{
+		{EmailTemplateVerification, "en", LinkEmailData{Link: "https://example.com/verify?t=1", ExpiresIn: "24 h"}, "Confirm your email address", "https://example.com/verify?t=1"},
+		{EmailTemplateVerification, "ru-RU", LinkEmailData{Link: "https://example.com/verify", ExpiresIn: "24 ч"}, "Подтвердите адрес электронной почты", "24 ч"},
+		{EmailTemplatePasswordReset, "de", LinkEmailData{Link: "https://example.com/reset", ExpiresIn: "30 min"}, "Reset your password", "https://example.com/reset"},
+		{EmailTemplateNewDevice, "ru", NewDeviceEmailData{Device: "Firefox", IP: "203.0.113.1", Location: "Berlin, Germany"}, "Вход в аккаунт с нового устройства", "Berlin, Germany"},
+		{EmailTemplateEmailChanged, "en", EmailChangedEmailData{NewEmail: "n***@example.com", Provider: "github"}, "The email of your account was changed", "n***@example.com"},
+		{EmailTemplateUnverifiedExpiry, "en", UnverifiedExpiryEmailData{ExpiresOn: "2024-01-02"}, "Verify your email to keep your account", "deleted on 2024-01-02"},
+		{EmailTemplateUnverifiedExpiry, "ru", UnverifiedExpiryEmailData{ExpiresOn: "2024-01-02", Deactivate: true}, "Подтвердите email, чтобы сохранить аккаунт", "деактивирован 2024-01-02"},
+	}
+
+	for _, tt := range tests {
+		msg, err := emails.Render("user@example.com", tt.template, tt.locale, tt.data)
+		if err != nil {
+			t.Fatalf("Failed to render %s/%s: %v", tt.template, tt.locale, err)
+		}
+		if msg.Subject != tt.subject {
+			t.Errorf("Expected subject %q for %s/%s, got %q", tt.subject, tt.template, tt.locale, msg.Subject)
+		}
+		if !strings.Contains(msg.Text, tt.contains) || !strings.Contains(msg.HTML, tt.contains) {
+			t.Errorf("Expected %s/%s bodies to contain %q", tt.template, tt.locale, tt.contains)
+		}
+	}
+}
+
+func TestEmailServiceRenderEscapesHTML(t *testing.T) {
+	emails, _ := newTestEmailService(t, mailer.Noop())
+
+	msg, err := emails.Render("user@example.com", EmailTemplateNewDevice, "en", NewDeviceEmailData{Device: "<script>alert(1)</script>"})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Error("Expected HTML body to escape template data")
+	}
+}
+
+func TestEmailServiceRenderBranding(t *testing.T) {
+	emails, _ := newTestEmailService(t, mailer.Noop())
+
+	logoURL, color := "https://acme.test/logo.png", "#1a2b3c"
+	ctx := ContextWithTenant(context.Background(), &domain.Tenant{ID: "acme", Name: "Acme", LogoURL: &logoURL, BrandColor: &color})
+
+	msg, err := emails.Render("user@example.com", EmailTemplateVerification, "en", LinkEmailData{Link: "https://acme.test/verify", Brand: emailBranding(ctx)})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	for _, part := range []string{`<img src="https://acme.test/logo.png" alt="Acme"`, `style="color: #1a2b3c"`, "The Acme team"} {
+		if !strings.Contains(msg.HTML, part) {
+			t.Errorf("Expected HTML body to contain %q, got %s", part, msg.HTML)
+		}
+	}
+	if !strings.HasSuffix(msg.Text, "The Acme team") {
+		t.Errorf("Expected text body to be signed by the tenant, got %q", msg.Text)
+	}
+
+	unbranded, err := emails.Render("user@example.com", EmailTemplateVerification, "en", LinkEmailData{Link: "https://example.com/verify"})
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if strings.Contains(unbranded.HTML, "<img") || strings.Contains(unbranded.HTML, "style=") || strings.Contains(unbranded.Text, "team") {
+		t.Errorf("Expected no branding without a tenant, got %s", unbranded.HTML)
+	}
+}
+
+func TestEmailServiceSendDeliversThroughRunner(t *testing.T) {
+	recorder := &recordingMailer{}
+	emails, runner := newTestEmailService(t, recorder)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	from := "Acme <hello@acme.test>"
+	tenantCtx := ContextWithTenant(context.Background(), &domain.Tenant{ID: "acme", Name: "Acme", EmailFrom: &from})
+	if err := emails.SendPasswordReset(tenantCtx, "user@example.com", "en", "https://example.com/reset", 30*time.Minute); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for recorder.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for email delivery")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if msg := recorder.sent[0]; msg.To != "user@example.com" || msg.From != from || !strings.Contains(msg.Text, "30 min") {
+		t.Errorf("Unexpected delivered message: %+v", msg)
+	}
+}
+
+func TestEmailServiceRejectedIsPermanent(t *testing.T) {
+	emails, _ := newTestEmailService(t, &recordingMailer{err: mailer.ErrRejected})
+
+	err := emails.deliver(context.Background(), []byte(`{"To":"user@example.com"}`))
+	if !jobs.IsPermanent(err) || !errors.Is(err, mailer.ErrRejected) {
+		t.Errorf("Expected permanent rejected error, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Endpoints reported by the enumeration policy
+const (
+	EnumerationEndpointLogin             = "login"
+	EnumerationEndpointRegister          = "register"
+	EnumerationEndpointUsernameAvailable = "username-available"
+)
+
+// dummyPassword is hashed once to spend the time of a real password check on unknown accounts
+const dummyPassword = "enumeration-protection"
+
+// EnumerationConfig configures the anti-enumeration policy
+type EnumerationConfig struct {
+	// UniformResponses makes endpoints answer the same way whether or not an account exists
+	UniformResponses bool
+	// TargetLimit is the number of attempts per email or username within Window, 0 disables it
+	TargetLimit int
+	// IPLimit is the number of attempts per client IP within Window, 0 disables it
+	IPLimit int
+	Window  time.Duration
+}
+
+// EnumerationPolicy keeps public endpoints from revealing which accounts exist
+// Every endpoint that looks an account up by email or username asks Allow before the lookup,
+// reports the outcome with Observe and, when UniformResponses is set, answers the same for
+// unknown accounts, including the time a password check takes.
+type EnumerationPolicy struct {
+	config  EnumerationConfig
+	limiter RateLimiter
+	hasher  *PasswordHasher
+
+	mu        sync.Mutex
+	dummyHash string
+
+	lookups metric.Int64Counter
+	limited metric.Int64Counter
+}
+
+// NewEnumerationPolicy creates the policy, limiter may be nil when both limits are disabled
+func NewEnumerationPolicy(config EnumerationConfig, limiter RateLimiter, hasher *PasswordHasher) *EnumerationPolicy {
+	p := &EnumerationPolicy{
+		config:  config,
+		limiter: limiter,
+		hasher:  hasher,
+	}
+
+	var err error
+	if p.lookups, err = meter.Int64Counter("auth.enumeration.lookups",
+		metric.WithDescription("Number of account lookups by public endpoints, by whether the account exists"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create lookups counter: %w", err))
+	}
+	if p.limited, err = meter.Int64Counter("auth.enumeration.limited",
+		metric.WithDescription("Number of account lookups rejected by the anti-enumeration limits"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create limited counter: %w", err))
+	}
+
+	return p
+}
+
+// UniformResponses reports whether responses must not depend on the existence of an account
+func (p *EnumerationPolicy) UniformResponses() bool {
+	return p.config.UniformResponses
+}
+
+// Allow counts an attempt of endpoint to look up target against the target and the client IP
+// It returns a *RetryAfterError wrapping ErrTooManyAttempts once either limit is exhausted.
+// Limiter failures let the attempt through, like the HTTP rate limits do.
+func (p *EnumerationPolicy) Allow(ctx context.Context, endpoint, target string) error {
+	type counter struct {
+		key   string
+		limit int
+	}
+	var counters []counter
+	if p.config.TargetLimit > 0 && target != "" {
+		// Targets are hashed so that emails don't end up in Redis
+		sum := sha256.Sum256([]byte(target))
+		counters = append(counters, counter{"enumeration:target:" + hex.EncodeToString(sum[:]), p.config.TargetLimit})
+	}
+	if ip := ClientInfoFromContext(ctx).IP; p.config.IPLimit > 0 && ip != "" {
+		counters = append(counters, counter{"enumeration:ip:" + ip, p.config.IPLimit})
+	}
+
+	for _, c := range counters {
+		result, err := p.limiter.Allow(ctx, c.key, c.limit, p.config.Window)
+		if err != nil || result.Allowed {
+			continue
+		}
+
+		p.limited.Add(ctx, 1, metric.WithAttributes(attribute.String("endpoint", endpoint)))
+		return &RetryAfterError{Err: ErrTooManyAttempts, RetryAfter: result.RetryAfter(time.Now())}
+	}
+	return nil
+}
+
+// Observe records whether the account looked up by endpoint exists
+// A growing share of lookups of unknown accounts is the sign of an enumeration attempt.
+func (p *EnumerationPolicy) Observe(ctx context.Context, endpoint string, exists bool) {
+	p.lookups.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("endpoint", endpoint),
+		attribute.Bool("account_exists", exists),
+	))
+}
+
+// SimulatePasswordCheck spends the time of a password check when the account is unknown,
+// so that response times don't reveal whether it exists
+func (p *EnumerationPolicy) SimulatePasswordCheck(ctx context.Context, password string) error {
+	if !p.config.UniformResponses {
+		return nil
+	}
+
+	hash, err := p.getDummyHash(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.hasher.Check(ctx, password, hash)
+	return err
+}
+
+// getDummyHash hashes dummyPassword on first use, with the configured cost of real hashes
+func (p *EnumerationPolicy) getDummyHash(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dummyHash == "" {
+		hash, err := p.hasher.Hash(ctx, dummyPassword)
+		if err != nil {
+			return "", err
+		}
+		p.dummyHash = hash
+	}
+	return p.dummyHash, nil
+}
+
+// RetryAfterError is returned when a request is rejected until RetryAfter has passed
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
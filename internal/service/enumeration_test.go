@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEnumerationPolicyAllow(t *testing.T) {
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	policy := service.NewEnumerationPolicy(service.EnumerationConfig{
+		TargetLimit: 2,
+		IPLimit:     3,
+		Window:      time.Minute,
+	}, &testutil.RateLimiter{}, hasher)
+
+	ctx := service.ContextWithClientInfo(context.Background(), service.ClientInfo{IP: "192.0.2.1"})
+	for i := range 2 {
+		if err := policy.Allow(ctx, service.EnumerationEndpointRegister, "user@example.com"); err != nil {
+			t.Fatalf("Attempt %d: expected to be allowed, got %v", i+1, err)
+		}
+	}
+
+	err := policy.Allow(ctx, service.EnumerationEndpointRegister, "user@example.com")
+	var retryErr *service.RetryAfterError
+	if !errors.Is(err, service.ErrTooManyAttempts) || !errors.As(err, &retryErr) || retryErr.RetryAfter <= 0 {
+		t.Fatalf("Expected ErrTooManyAttempts with a retry delay after the target limit, got %v", err)
+	}
+
+	// The IP limit covers other targets of the same client
+	if err := policy.Allow(ctx, service.EnumerationEndpointRegister, "other@example.com"); err != nil {
+		t.Fatalf("Expected another target to be allowed, got %v", err)
+	}
+	if err := policy.Allow(ctx, service.EnumerationEndpointRegister, "third@example.com"); !errors.Is(err, service.ErrTooManyAttempts) {
+		t.Errorf("Expected ErrTooManyAttempts after the IP limit, got %v", err)
+	}
+}
+
+func TestLoginUniformResponses(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	user, err := env.Repos.User.GetByID(ctx, registered.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	user.IsActive = false
+	if err := env.Repos.User.Update(ctx, user); err != nil {
+		t.Fatalf("Failed to deactivate user: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     error
+	}{
+		{name: "unknown account", login: "unknown@example.com", password: "Password123", want: service.ErrInvalidCredentials},
+		{name: "inactive account with a wrong password", login: "user@example.com", password: "Wrong12345", want: service.ErrInvalidCredentials},
+		{name: "inactive account with the password", login: "user@example.com", password: "Password123", want: service.ErrUserInactive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: tt.login, Password: tt.password})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
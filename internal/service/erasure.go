@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+const (
+	// userErasedJob is the job type delivering UserErasedEvent to subscribers
+	userErasedJob = "user.erased"
+
+	// erasureBatchSize is the number of due erasures carried out per sweep query
+	erasureBatchSize = 100
+)
+
+// ErasureConfig configures the erasure pipeline
+type ErasureConfig struct {
+	// Mode is domain.ErasureModeDelete or domain.ErasureModeAnonymize
+	Mode string
+	// GracePeriod delays erasures requested by users, who can cancel them meanwhile
+	GracePeriod time.Duration
+	// SweepInterval is how often due erasures are looked for by Run
+	SweepInterval time.Duration
+}
+
+// ErasureStep removes the data of a user from one place, e.g. a table referencing users
+// Steps must be idempotent, an erasure interrupted halfway is carried out again from the start.
+type ErasureStep struct {
+	Name  string
+	Erase func(ctx context.Context, userID string) error
+}
+
+// UserErasedEvent is emitted once the data of a user has been erased
+type UserErasedEvent struct {
+	UserID      string    `json:"user_id"`
+	ErasureID   string    `json:"erasure_id"`
+	RequestedBy string    `json:"requested_by"`
+	Mode        string    `json:"mode"`
+	ErasedAt    time.Time `json:"erased_at"`
+}
+
+// ErasureService erases users on request, the right to be forgotten
+// Admins erase users at once, users request their own erasure and it is carried out by Run
+// after the grace period. Sessions and OAuth connections are removed by steps, tables added
+// later register theirs with AddStep, and the user row is deleted or anonymized last.
+// The erasure record is kept as a tombstone and a user.erased event is emitted through the
+// job runner.
+type ErasureService struct {
+	repo     repository.ErasureRepository
+	userRepo repository.UserRepository
+	runner   *jobs.Runner
+	config   ErasureConfig
+
+	mu          sync.RWMutex
+	steps       []ErasureStep
+	subscribers []func(ctx context.Context, event UserErasedEvent) error
+}
+
+// NewErasureService creates the erasure service and registers the event job handler
+func NewErasureService(
+	repo repository.ErasureRepository,
+	userRepo repository.UserRepository,
+	oauthRepo repository.OAuthProviderRepository,
+	revocations *RevocationService,
+	runner *jobs.Runner,
+	config ErasureConfig,
+) *ErasureService {
+	s := &ErasureService{
+		repo:     repo,
+		userRepo: userRepo,
+		runner:   runner,
+		config:   config,
+	}
+
+	// Deleting the user would remove both by cascade in SQL storage, but not in memory,
+	// and anonymized users keep their row
+	s.AddStep(ErasureStep{Name: "sessions", Erase: func(ctx context.Context, userID string) error {
+		_, err := revocations.Revoke(ctx, Revocation{UserID: userID})
+		return err
+	}})
+	s.AddStep(ErasureStep{Name: "oauth_providers", Erase: func(ctx context.Context, userID string) error {
+		providers, err := oauthRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		for _, provider := range providers {
+			if err := oauthRepo.Delete(ctx, provider.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	}})
+
+	runner.Register(userErasedJob, s.publish)
+	return s
+}
+
+// AddStep adds a step run before the user row is erased
+func (s *ErasureService) AddStep(step ErasureStep) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, step)
+}
+
+// Subscribe registers a handler of user.erased events
+// Handlers run in the job runner, events are delivered at least once and retried on failure,
+// so handlers must be idempotent.
+func (s *ErasureService) Subscribe(handler func(ctx context.Context, event UserErasedEvent) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, handler)
+}
+
+// Request schedules the erasure of a user by the user after the grace period
+// Without a grace period the user is erased at once.
+func (s *ErasureService) Request(ctx context.Context, userID string) (_ *domain.Erasure, err error) {
+	ctx, span := tracer.Start(ctx, "ErasureService.Request")
+	defer func() { endSpan(span, err) }()
+
+	erasure, err := s.create(ctx, userID, domain.ErasureRequestedByUser, time.Now().Add(s.config.GracePeriod))
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateErasure) {
+			return nil, ErrErasurePending
+		}
+		return nil, err
+	}
+
+	if s.config.GracePeriod <= 0 {
+		return s.carryOut(ctx, erasure)
+	}
+	return erasure, nil
+}
+
+// Cancel cancels the pending erasure of a user
+func (s *ErasureService) Cancel(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "ErasureService.Cancel")
+	defer func() { endSpan(span, err) }()
+
+	erasure, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrErasureNotFound
+		}
+		return err
+	}
+
+	if err := s.repo.DeletePending(ctx, erasure.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrErasureNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Erase erases a user at once, on behalf of an admin
+// A pending erasure requested by the user is carried out early. Erasing an erased user
+// returns its tombstone, unknown users return repository.ErrNotFound.
+func (s *ErasureService) Erase(ctx context.Context, userID string) (_ *domain.Erasure, err error) {
+	ctx, span := tracer.Start(ctx, "ErasureService.Erase")
+	defer func() { endSpan(span, err) }()
+
+	return s.eraseNow(ctx, userID, domain.ErasureRequestedByAdmin)
+}
+
+// EraseExpired erases a user at once on behalf of the retention policy of unverified accounts
+func (s *ErasureService) EraseExpired(ctx context.Context, userID string) (_ *domain.Erasure, err error) {
+	ctx, span := tracer.Start(ctx, "ErasureService.EraseExpired")
+	defer func() { endSpan(span, err) }()
+
+	return s.eraseNow(ctx, userID, domain.ErasureRequestedByRetention)
+}
+
+// eraseNow erases a user at once, recording requestedBy unless an erasure is pending already
+func (s *ErasureService) eraseNow(ctx context.Context, userID, requestedBy string) (*domain.Erasure, error) {
+	erasure, err := s.repo.GetByUserID(ctx, userID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		erasure, err = s.create(ctx, userID, requestedBy, time.Now())
+		if errors.Is(err, repository.ErrDuplicateErasure) {
+			// Requested concurrently
+			erasure, err = s.repo.GetByUserID(ctx, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	if !erasure.IsPending() {
+		return erasure, nil
+	}
+	return s.carryOut(ctx, erasure)
+}
+
+// Get returns the erasure of a user, pending or carried out
+func (s *ErasureService) Get(ctx context.Context, userID string) (*domain.Erasure, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+// EraseDue carries out pending erasures whose grace period is over and returns their number
+// Failed erasures stay pending and are retried by the next call.
+func (s *ErasureService) EraseDue(ctx context.Context) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "ErasureService.EraseDue")
+	defer func() { endSpan(span, err) }()
+
+	due, err := s.repo.ListDue(ctx, time.Now(), erasureBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	erased := 0
+	var errs []error
+	for _, erasure := range due {
+		if _, err := s.carryOut(ctx, erasure); err != nil {
+			errs = append(errs, fmt.Errorf("failed to erase user %s: %w", erasure.UserID, err))
+			continue
+		}
+		erased++
+	}
+	return erased, errors.Join(errs...)
+}
+
+// Run carries out due erasures on a fixed interval until ctx is cancelled
+func (s *ErasureService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Erasures that failed stay pending for the next sweep
+		if _, err := s.EraseDue(ctx); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to erase due users", zap.Error(err))
+		}
+	}
+}
+
+// create records an erasure of an existing user due at eraseAfter
+func (s *ErasureService) create(ctx context.Context, userID, requestedBy string, eraseAfter time.Time) (*domain.Erasure, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(user.EmailNormalized))
+	erasure := &domain.Erasure{
+		UserID:      user.ID,
+		EmailHash:   hex.EncodeToString(sum[:]),
+		RequestedBy: requestedBy,
+		Mode:        s.config.Mode,
+		EraseAfter:  eraseAfter,
+	}
+	if err := s.repo.Create(ctx, erasure); err != nil {
+		return nil, err
+	}
+	return erasure, nil
+}
+
+// carryOut runs the erasure steps, erases the user row, records the tombstone and emits the event
+func (s *ErasureService) carryOut(ctx context.Context, erasure *domain.Erasure) (*domain.Erasure, error) {
+	s.mu.RLock()
+	steps := append([]ErasureStep(nil), s.steps...)
+	s.mu.RUnlock()
+
+	for _, step := range steps {
+		if err := step.Erase(ctx, erasure.UserID); err != nil {
+			return nil, fmt.Errorf("erasure step %s failed: %w", step.Name, err)
+		}
+	}
+
+	if err := s.eraseUser(ctx, erasure); err != nil {
+		return nil, fmt.Errorf("failed to erase user row: %w", err)
+	}
+
+	// The event is emitted before the tombstone is recorded, so that it is delivered at least once
+	// even if recording fails and the erasure is carried out again
+	erasedAt := time.Now()
+	event := UserErasedEvent{
+		UserID:      erasure.UserID,
+		ErasureID:   erasure.ID,
+		RequestedBy: erasure.RequestedBy,
+		Mode:        erasure.Mode,
+		ErasedAt:    erasedAt,
+	}
+	if err := s.runner.Enqueue(ctx, userErasedJob, event); err != nil {
+		return nil, fmt.Errorf("failed to emit user erased event: %w", err)
+	}
+
+	if err := s.repo.MarkErased(ctx, erasure.ID, erasedAt); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Carried out concurrently, e.g. by another replica
+			return s.repo.GetByUserID(ctx, erasure.UserID)
+		}
+		return nil, err
+	}
+	erasure.ErasedAt = &erasedAt
+
+	return erasure, nil
+}
+
+// eraseUser deletes or anonymizes the user row, a missing row was erased before
+func (s *ErasureService) eraseUser(ctx context.Context, erasure *domain.Erasure) error {
+	if erasure.Mode != domain.ErasureModeAnonymize {
+		if err := s.userRepo.Delete(ctx, erasure.UserID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, erasure.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// The placeholder keeps the email unique, .invalid is reserved and never delivered
+	placeholder := "erased-" + user.ID + "@erased.invalid"
+	anonymized := &domain.User{
+		ID:              user.ID,
+		Email:           placeholder,
+		EmailNormalized: placeholder,
+		CreatedAt:       user.CreatedAt,
+	}
+	return s.userRepo.Update(ctx, anonymized)
+}
+
+// publish delivers a user.erased event to the subscribers
+func (s *ErasureService) publish(ctx context.Context, payload json.RawMessage) error {
+	var event UserErasedEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid user erased event: %w", err))
+	}
+
+	s.mu.RLock()
+	subscribers := append([]func(ctx context.Context, event UserErasedEvent) error(nil), s.subscribers...)
+	s.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if err := subscriber(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
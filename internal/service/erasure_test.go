@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"go.uber.org/zap"
+)
+
+func newTestErasureService(t *testing.T, env *testutil.AuthEnv, config service.ErasureConfig) (*service.ErasureService, chan service.UserErasedEvent) {
+	t.Helper()
+
+	runner := jobs.NewRunner(env.Redis, zap.NewNop(), jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond})
+	erasures := service.NewErasureService(env.Repos.Erasure, env.Repos.User, env.Repos.OAuthProvider,
+		service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute), runner, config)
+
+	events := make(chan service.UserErasedEvent, 1)
+	erasures.Subscribe(func(ctx context.Context, event service.UserErasedEvent) error {
+		events <- event
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go runner.Run(ctx)
+
+	return erasures, events
+}
+
+func waitErasedEvent(t *testing.T, events <-chan service.UserErasedEvent) service.UserErasedEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the user erased event")
+		return service.UserErasedEvent{}
+	}
+}
+
+func TestErasureServiceEraseDeletesUser(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	erasures, events := newTestErasureService(t, env, service.ErasureConfig{Mode: domain.ErasureModeDelete, GracePeriod: time.Hour})
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	userID := registered.AuthResponse.User.ID
+
+	var erasedBy string
+	erasures.AddStep(service.ErasureStep{Name: "test", Erase: func(ctx context.Context, id string) error {
+		erasedBy = id
+		return nil
+	}})
+
+	erasure, err := erasures.Erase(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to erase user: %v", err)
+	}
+	if erasure.IsPending() || erasure.RequestedBy != domain.ErasureRequestedByAdmin {
+		t.Errorf("Expected an erasure carried out for an admin, got %+v", erasure)
+	}
+	if erasedBy != userID {
+		t.Errorf("Expected registered steps to run, got user %q", erasedBy)
+	}
+
+	if _, err := env.Repos.User.GetByID(ctx, userID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected the user to be deleted, got %v", err)
+	}
+	if tokens, _ := env.Repos.Token.GetByUserID(ctx, userID); len(tokens) != 0 {
+		t.Errorf("Expected sessions to be deleted, got %d", len(tokens))
+	}
+	if _, err := env.Service.ValidateToken(ctx, registered.AuthResponse.AccessToken); err == nil {
+		t.Error("Expected access tokens of the erased user to be rejected")
+	}
+
+	if event := waitErasedEvent(t, events); event.UserID != userID || event.Mode != domain.ErasureModeDelete {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if _, err := erasures.Erase(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown user, got %v", err)
+	}
+}
+
+func TestErasureServiceGracePeriodAnonymizes(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	erasures, events := newTestErasureService(t, env, service.ErasureConfig{Mode: domain.ErasureModeAnonymize, GracePeriod: 20 * time.Millisecond})
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	userID := registered.AuthResponse.User.ID
+	if err := env.Repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: userID, Provider: "google", ProviderUserID: "123"}); err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+
+	if _, err := erasures.Request(ctx, userID); err != nil {
+		t.Fatalf("Failed to request erasure: %v", err)
+	}
+	if _, err := erasures.Request(ctx, userID); !errors.Is(err, service.ErrErasurePending) {
+		t.Errorf("Expected ErrErasurePending, got %v", err)
+	}
+	if erased, err := erasures.EraseDue(ctx); err != nil || erased != 0 {
+		t.Fatalf("Expected no erasure before the grace period, got %d %v", erased, err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if erased, err := erasures.EraseDue(ctx); err != nil || erased != 1 {
+		t.Fatalf("Expected the erasure to be carried out, got %d %v", erased, err)
+	}
+
+	user, err := env.Repos.User.GetByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("Expected the anonymized user to be kept, got %v", err)
+	}
+	if user.Email == "user@example.com" || user.IsActive || user.PasswordHash != "" {
+		t.Errorf("Expected the user to be anonymized, got %+v", user)
+	}
+	if providers, _ := env.Repos.OAuthProvider.GetByUserID(ctx, userID); len(providers) != 0 {
+		t.Errorf("Expected OAuth connections to be deleted, got %d", len(providers))
+	}
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if event := waitErasedEvent(t, events); event.RequestedBy != domain.ErasureRequestedByUser {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	if err := erasures.Cancel(ctx, userID); !errors.Is(err, service.ErrErasureNotFound) {
+		t.Errorf("Expected carried out erasures not to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import "errors"
+
+// Errors returned to API clients
+// Their messages are stable, so handlers can localize them through the i18n catalogs
+var (
+	// ErrInvalidEmail is returned when an email has an invalid format
+	ErrInvalidEmail = errors.New("invalid email format")
+
+	// ErrWeakPassword is returned when a password doesn't meet the password policy
+	ErrWeakPassword = errors.New("password must be at least 8 characters long and contain uppercase, lowercase, and number")
+
+	// ErrUserExists is returned when registering an email that already belongs to a user
+	ErrUserExists = errors.New("user with this email already exists")
+
+	// ErrInvalidUsername is returned when a username has an invalid format
+	ErrInvalidUsername = errors.New("username must be 3-32 characters of letters, digits, dots, underscores or hyphens, starting with a letter or digit")
+
+	// ErrUsernameTaken is returned when a username belongs to another user
+	ErrUsernameTaken = errors.New("username is already taken")
+
+	// ErrInvalidCredentials is returned when the login identifier or password is wrong
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrEmailNotVerified is returned when the email verification policy requires a verified email
+	ErrEmailNotVerified = errors.New("email address is not verified")
+
+	// ErrUserInactive is returned when the user account is deactivated
+	ErrUserInactive = errors.New("user account is inactive")
+
+	// ErrAccountBanned is returned when an admin banned the user
+	ErrAccountBanned = errors.New("this account has been banned")
+
+	// ErrInvalidRefreshToken is returned when a refresh token is malformed or unknown
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenExpired is returned when a refresh token has expired
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+
+	// ErrTokenRevoked is returned when a token was revoked, e.g. by logout or rotation
+	ErrTokenRevoked = errors.New("token has been revoked")
+
+	// ErrDeviceMismatch is returned when a refresh token bound to a device is used by another one
+	ErrDeviceMismatch = errors.New("refresh token was issued to another device")
+
+	// ErrSessionNotFound is returned when a session doesn't exist or belongs to another user
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrPasswordAlreadySet is returned when setting the first password of an account that has one
+	ErrPasswordAlreadySet = errors.New("account already has a password")
+
+	// ErrReauthenticationRequired is returned when an action needs a verified email or a recent sign-in with a provider
+	ErrReauthenticationRequired = errors.New("verify your email or sign in with your provider again to continue")
+
+	// ErrOAuthProviderNotFound is returned when signing in with a provider that isn't configured
+	ErrOAuthProviderNotFound = errors.New("unknown OAuth provider")
+
+	// ErrInvalidOAuthState is returned when an OAuth sign-in was tampered with, expired or completed already
+	ErrInvalidOAuthState = errors.New("OAuth sign-in is invalid or expired, try again")
+
+	// ErrOAuthEmailNotVerified is returned when the provider account has no verified email to link or create an account with
+	ErrOAuthEmailNotVerified = errors.New("the provider account has no verified email")
+
+	// ErrRecoveryNotAllowed is returned when the provider a user signed in with can't be used to recover the account,
+	// e.g. because it was linked recently
+	ErrRecoveryNotAllowed = errors.New("the account can't be recovered with this provider, contact support")
+
+	// ErrOAuthProviderNotLinked is returned when the user has no account of a provider linked
+	ErrOAuthProviderNotLinked = errors.New("no account of this provider is linked")
+
+	// ErrProviderTokenUnavailable is returned when no valid token of a linked provider account is stored
+	// and it can't be refreshed, the user has to sign in with the provider again
+	ErrProviderTokenUnavailable = errors.New("the provider token is unavailable, sign in with the provider again")
+
+	// ErrInvalidKerberosTicket is returned when a SPNEGO token isn't a valid ticket of an accepted realm
+	ErrInvalidKerberosTicket = errors.New("Kerberos ticket is invalid")
+
+	// ErrKerberosUserNotFound is returned when no user matches the principal of a Kerberos ticket
+	ErrKerberosUserNotFound = errors.New("no account matches your domain account")
+
+	// ErrInvalidKerberosPrincipal is returned when linking a principal that isn't name@REALM of an accepted realm
+	ErrInvalidKerberosPrincipal = errors.New("Kerberos principal must be like jdoe@CORP.EXAMPLE.COM of an accepted realm")
+
+	// ErrKerberosPrincipalLinked is returned when linking a principal that is linked to a user already
+	ErrKerberosPrincipalLinked = errors.New("Kerberos principal is linked to a user already")
+
+	// ErrInvalidSIWEMessage is returned for sign-in with Ethereum messages that are malformed, expired,
+	// for another domain or chain, or whose nonce wasn't issued or is used already
+	ErrInvalidSIWEMessage = errors.New("sign-in message is invalid or expired")
+
+	// ErrInvalidSIWESignature is returned when a sign-in message wasn't signed by its address
+	ErrInvalidSIWESignature = errors.New("signature does not match the wallet address")
+
+	// ErrInvalidToken is returned when an access token is malformed, expired or has an invalid signature
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrErasurePending is returned when the user already requested the erasure of the account
+	ErrErasurePending = errors.New("account erasure is already requested")
+
+	// ErrErasureNotFound is returned when cancelling an erasure that wasn't requested or was carried out
+	ErrErasureNotFound = errors.New("no pending account erasure")
+
+	// ErrConsentRequired is returned when registering without accepting the current terms of service and privacy policy
+	ErrConsentRequired = errors.New("the current terms of service and privacy policy must be accepted")
+
+	// ErrOutdatedConsent is returned when accepting a document or version that isn't currently published
+	ErrOutdatedConsent = errors.New("policy document version is not current")
+
+	// ErrInvitationRequired is returned when registering without an invitation while registration is invite-only
+	ErrInvitationRequired = errors.New("registration requires an invitation")
+
+	// ErrEmailDomainNotAllowed is returned when registering with an email outside the allowed domains
+	ErrEmailDomainNotAllowed = errors.New("registration is not open to this email domain")
+
+	// ErrInvalidInvitation is returned when an invitation token is unknown, expired, revoked or used
+	ErrInvalidInvitation = errors.New("invitation is invalid or expired")
+
+	// ErrInvitationNotFound is returned when revoking an invitation that doesn't exist, isn't pending or belongs to another user
+	ErrInvitationNotFound = errors.New("invitation not found")
+
+	// ErrOrganizationNotFound is returned when an organization doesn't exist or the user isn't a member of it
+	ErrOrganizationNotFound = errors.New("organization not found")
+
+	// ErrMemberNotFound is returned when acting on a user who isn't a member of the organization
+	ErrMemberNotFound = errors.New("member not found")
+
+	// ErrAlreadyMember is returned when adding a user who is a member of the organization already
+	ErrAlreadyMember = errors.New("user is already a member of the organization")
+
+	// ErrOrgPermissionDenied is returned when the organization role of the user doesn't allow the action
+	ErrOrgPermissionDenied = errors.New("organization role doesn't allow this action")
+
+	// ErrLastOwner is returned when removing or demoting the only owner of an organization
+	ErrLastOwner = errors.New("organization must keep at least one owner")
+
+	// ErrTenantNotFound is returned when a request names a tenant that doesn't exist
+	ErrTenantNotFound = errors.New("unknown tenant")
+
+	// ErrRedirectNotAllowed is returned when a redirect URL isn't on the allow-list of the tenant or the service
+	ErrRedirectNotAllowed = errors.New("redirect URL is not allowed")
+
+	// ErrTooManyAttempts is returned when the anti-enumeration limits of an account or client are exhausted
+	ErrTooManyAttempts = errors.New("too many attempts, try again later")
+
+	// ErrFeatureDisabled is returned by routes of features turned off in the configuration
+	ErrFeatureDisabled = errors.New("this feature is disabled")
+
+	// ErrServerBusy is returned when too many password hashing operations are waiting
+	ErrServerBusy = errors.New("server is busy, try again later")
+
+	// ErrRotationFailed is returned when a refresh token can't be rotated safely, the token stays valid for a retry
+	ErrRotationFailed = errors.New("refresh token could not be rotated, try again later")
+)
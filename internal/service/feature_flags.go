@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+const (
+	// featureFlagsKey is a hash of flags changed at runtime, by name
+	featureFlagsKey = "feature_flags"
+	// featureFlagsReloadChannel notifies all replicas that flags have changed
+	featureFlagsReloadChannel = "feature_flags:reload"
+
+	defaultFeatureFlagsReloadInterval = time.Minute
+)
+
+var (
+	// ErrInvalidFeatureFlag is returned when a flag has an invalid name or percentage
+	ErrInvalidFeatureFlag = errors.New("invalid feature flag")
+	// ErrFeatureFlagNotFound is returned when resetting a flag that wasn't changed at runtime
+	ErrFeatureFlagNotFound = errors.New("feature flag not found")
+)
+
+// FeatureFlagState is a flag with the source of its value
+type FeatureFlagState struct {
+	domain.FeatureFlag
+	// Overridden is set when the flag was changed at runtime instead of being configured
+	Overridden bool
+}
+
+// FeatureFlags decides which features are on for users, e.g. to roll a feature out per tenant
+// or to a percentage of users.
+//
+// Flags are configured with defaults and changed at runtime through the admin API. Changes
+// are stored in Redis, kept in memory and reloaded periodically and on change notifications.
+// Unknown flags are off.
+type FeatureFlags struct {
+	defaults       map[string]domain.FeatureFlag
+	redis          *database.Redis
+	reloadInterval time.Duration
+	flags          atomic.Pointer[map[string]FeatureFlagState]
+}
+
+// NewFeatureFlags creates feature flags with the configured defaults
+func NewFeatureFlags(defaults []domain.FeatureFlag, redis *database.Redis, reloadInterval time.Duration) *FeatureFlags {
+	if reloadInterval <= 0 {
+		reloadInterval = defaultFeatureFlagsReloadInterval
+	}
+
+	f := &FeatureFlags{
+		defaults:       make(map[string]domain.FeatureFlag, len(defaults)),
+		redis:          redis,
+		reloadInterval: reloadInterval,
+	}
+	flags := make(map[string]FeatureFlagState, len(defaults))
+	for _, flag := range defaults {
+		f.defaults[flag.Name] = flag
+		flags[flag.Name] = FeatureFlagState{FeatureFlag: flag}
+	}
+	f.flags.Store(&flags)
+	return f
+}
+
+// Enabled reports whether a flag is on for a user, a member of orgID unless it is empty
+func (f *FeatureFlags) Enabled(name, userID, orgID string) bool {
+	if f == nil {
+		return false
+	}
+	flag, ok := (*f.flags.Load())[name]
+	return ok && flag.EnabledFor(userID, orgID)
+}
+
+// Claims returns the sorted names of flags exposed in access tokens that are on for a user
+func (f *FeatureFlags) Claims(userID, orgID string) []string {
+	if f == nil {
+		return nil
+	}
+
+	var names []string
+	for name, flag := range *f.flags.Load() {
+		if flag.Claim && flag.EnabledFor(userID, orgID) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns all flags sorted by name
+func (f *FeatureFlags) List() []FeatureFlagState {
+	flags := *f.flags.Load()
+	result := make([]FeatureFlagState, 0, len(flags))
+	for _, flag := range flags {
+		result = append(result, flag)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Reload loads flags changed at runtime and replaces the in-memory set
+func (f *FeatureFlags) Reload(ctx context.Context) error {
+	values, err := f.redis.Client.HGetAll(ctx, featureFlagsKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+
+	flags := make(map[string]FeatureFlagState, len(f.defaults)+len(values))
+	for name, flag := range f.defaults {
+		flags[name] = FeatureFlagState{FeatureFlag: flag}
+	}
+	for name, value := range values {
+		var flag domain.FeatureFlag
+		if err := json.Unmarshal([]byte(value), &flag); err != nil {
+			return fmt.Errorf("failed to decode feature flag %s: %w", name, err)
+		}
+		flag.Name = name
+		flags[name] = FeatureFlagState{FeatureFlag: flag, Overridden: true}
+	}
+
+	f.flags.Store(&flags)
+	return nil
+}
+
+// Run reloads flags on change notifications and on a fixed interval until ctx is cancelled
+func (f *FeatureFlags) Run(ctx context.Context) {
+	pubsub := f.redis.Client.Subscribe(ctx, featureFlagsReloadChannel)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(f.reloadInterval)
+	defer ticker.Stop()
+
+	notifications := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notifications:
+		}
+
+		// Keep serving the previous flags if reload fails
+		if err := f.Reload(ctx); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to reload feature flags", zap.Error(err))
+		}
+	}
+}
+
+// Set validates and stores a flag overriding its configured default, then notifies all replicas
+func (f *FeatureFlags) Set(ctx context.Context, flag *domain.FeatureFlag) error {
+	if err := validateFeatureFlag(flag); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("failed to encode feature flag: %w", err)
+	}
+	if err := f.redis.Client.HSet(ctx, featureFlagsKey, flag.Name, value).Err(); err != nil {
+		return fmt.Errorf("failed to store feature flag: %w", err)
+	}
+
+	return f.notify(ctx)
+}
+
+// Reset removes a flag changed at runtime, restoring its configured default, then notifies all replicas
+func (f *FeatureFlags) Reset(ctx context.Context, name string) error {
+	removed, err := f.redis.Client.HDel(ctx, featureFlagsKey, name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to remove feature flag: %w", err)
+	}
+	if removed == 0 {
+		return ErrFeatureFlagNotFound
+	}
+
+	return f.notify(ctx)
+}
+
+// notify reloads local flags and publishes a reload notification
+func (f *FeatureFlags) notify(ctx context.Context) error {
+	if err := f.Reload(ctx); err != nil {
+		return err
+	}
+
+	if err := f.redis.Client.Publish(ctx, featureFlagsReloadChannel, "1").Err(); err != nil {
+		return fmt.Errorf("failed to publish feature flags reload: %w", err)
+	}
+
+	return nil
+}
+
+// validateFeatureFlag checks the name and percentage of a flag and normalizes its tenants
+func validateFeatureFlag(flag *domain.FeatureFlag) error {
+	if !domain.IsValidFeatureFlagName(flag.Name) {
+		return fmt.Errorf("%w: name must be 1-64 lowercase letters, digits, dots, underscores or hyphens", ErrInvalidFeatureFlag)
+	}
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		return fmt.Errorf("%w: percentage must be between 0 and 100", ErrInvalidFeatureFlag)
+	}
+
+	tenants := make([]string, 0, len(flag.Tenants))
+	for _, tenant := range flag.Tenants {
+		if tenant = strings.TrimSpace(tenant); tenant != "" && !slices.Contains(tenants, tenant) {
+			tenants = append(tenants, tenant)
+		}
+	}
+	flag.Tenants = tenants
+	return nil
+}
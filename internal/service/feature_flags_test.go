@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	ctx := context.Background()
+	redis := testutil.NewRedis(t)
+	defaults := []domain.FeatureFlag{
+		{Name: "magic_links", Percentage: 100, Claim: true},
+		{Name: "mfa", Percentage: 0, Tenants: []string{"org-1"}},
+	}
+	flags := service.NewFeatureFlags(defaults, redis, time.Minute)
+	replica := service.NewFeatureFlags(defaults, redis, time.Minute)
+
+	if !flags.Enabled("magic_links", "user-1", "") || flags.Enabled("mfa", "user-1", "") || !flags.Enabled("mfa", "user-1", "org-1") {
+		t.Error("Expected the configured defaults to apply")
+	}
+	if flags.Enabled("unknown", "user-1", "") {
+		t.Error("Expected unknown flags to be off")
+	}
+
+	if err := flags.Set(ctx, &domain.FeatureFlag{Name: "mfa", Percentage: 100, Claim: true}); err != nil {
+		t.Fatalf("Failed to set flag: %v", err)
+	}
+	if err := replica.Reload(ctx); err != nil {
+		t.Fatalf("Failed to reload flags: %v", err)
+	}
+	if claims := replica.Claims("user-1", ""); !slices.Equal(claims, []string{"magic_links", "mfa"}) {
+		t.Errorf("Expected the change to reach other replicas, got claims %v", claims)
+	}
+	if list := flags.List(); len(list) != 2 || list[0].Overridden || !list[1].Overridden {
+		t.Errorf("Expected only the changed flag to be overridden, got %+v", list)
+	}
+
+	if err := flags.Reset(ctx, "mfa"); err != nil {
+		t.Fatalf("Failed to reset flag: %v", err)
+	}
+	if flags.Enabled("mfa", "user-1", "") {
+		t.Error("Expected the reset flag to be back to its default")
+	}
+	if err := flags.Reset(ctx, "mfa"); !errors.Is(err, service.ErrFeatureFlagNotFound) {
+		t.Errorf("Expected ErrFeatureFlagNotFound, got %v", err)
+	}
+
+	for _, invalid := range []domain.FeatureFlag{{Name: "Magic Links", Percentage: 100}, {Name: "mfa", Percentage: 101}} {
+		if err := flags.Set(ctx, &invalid); !errors.Is(err, service.ErrInvalidFeatureFlag) {
+			t.Errorf("Expected ErrInvalidFeatureFlag for %+v, got %v", invalid, err)
+		}
+	}
+}
+
+func TestFeatureFlagPercentage(t *testing.T) {
+	partial := domain.FeatureFlag{Name: "v2_responses", Percentage: 30}
+	wider := domain.FeatureFlag{Name: "v2_responses", Percentage: 60}
+
+	enabled := 0
+	for i := range 1000 {
+		userID := fmt.Sprintf("user-%d", i)
+		if partial.EnabledFor(userID, "") {
+			enabled++
+			if !wider.EnabledFor(userID, "") {
+				t.Fatalf("Expected %s to keep the flag when the percentage is raised", userID)
+			}
+		}
+	}
+	if enabled < 250 || enabled > 350 {
+		t.Errorf("Expected about 30%% of users to have the flag, got %d of 1000", enabled)
+	}
+}
+
+func TestFeatureFlagClaims(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	flags := service.NewFeatureFlags([]domain.FeatureFlag{
+		{Name: "magic_links", Percentage: 100, Claim: true},
+		{Name: "new_billing", Tenants: []string{"org-1"}, Claim: true},
+		{Name: "internal_only", Percentage: 100},
+	}, env.Redis, time.Minute)
+
+	for name, tokens := range map[string]service.AccessTokenStrategy{
+		"jwt":    service.NewJWTAccessTokens(env.JWT, service.WithFeatureClaims(flags)),
+		"opaque": service.NewOpaqueAccessTokens(env.Redis, time.Minute, service.WithFeatureClaims(flags)),
+	} {
+		token, err := tokens.Issue(ctx, &domain.User{ID: "user-1", Email: "user@example.com"}, &domain.Membership{OrgID: "org-1", Role: domain.OrgRoleMember})
+		if err != nil {
+			t.Fatalf("Failed to issue %s token: %v", name, err)
+		}
+		claims, err := tokens.Validate(ctx, token, 0)
+		if err != nil {
+			t.Fatalf("Failed to validate %s token: %v", name, err)
+		}
+		if !slices.Equal(claims.Features, []string{"magic_links", "new_billing"}) {
+			t.Errorf("Expected the exposed flags in the %s token, got %v", name, claims.Features)
+		}
+	}
+}
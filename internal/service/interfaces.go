@@ -10,9 +10,18 @@ import (
 // AuthService defines methods for authentication operations
 type AuthService interface {
 	Register(ctx context.Context, req *dto.RegisterRequest) (*AuthResponseWithRefreshToken, error)
+	RegisterWithInvitation(ctx context.Context, token string, req *dto.RegisterWithInvitationRequest) (*AuthResponseWithRefreshToken, error)
 	Login(ctx context.Context, req *dto.LoginRequest) (*AuthResponseWithRefreshToken, error)
+	// IssueSession logs in a user authenticated by other means, e.g. an OAuth provider
+	IssueSession(ctx context.Context, userID string) (*AuthResponseWithRefreshToken, error)
 	RefreshToken(ctx context.Context, refreshToken string) (*AuthResponseWithRefreshToken, error)
 	Logout(ctx context.Context, userID, refreshToken string) error
+	// RevokeToken revokes an access or refresh token of any user, unknown tokens are ignored
+	RevokeToken(ctx context.Context, token, tokenTypeHint string) error
 	GetUser(ctx context.Context, userID string) (*dto.UserResponse, error)
-	ValidateToken(ctx context.Context, token string) (*domain.TokenClaims, error)
+	UpdateProfile(ctx context.Context, userID string, req *dto.UpdateProfileRequest) (*dto.UserResponse, error)
+	IsUsernameAvailable(ctx context.Context, username string) (bool, error)
+	ListSessions(ctx context.Context, userID string) ([]*dto.SessionResponse, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	ValidateToken(ctx context.Context, token string, opts ...ValidateOption) (*domain.TokenClaims, error)
 }
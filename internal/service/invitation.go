@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// invitationTokenBytes is the entropy of invitation tokens
+const invitationTokenBytes = 32
+
+// InvitationConfig configures signup invitations
+type InvitationConfig struct {
+	// Required makes registration invite-only
+	Required bool
+	// AllowUsers lets any user invite, otherwise only admins can
+	AllowUsers bool
+	// TTL is how long an invitation can be used
+	TTL time.Duration
+}
+
+// CreateInvitation describes an invitation to create
+type CreateInvitation struct {
+	Email  string
+	Role   *string
+	Tenant *string
+	// InvitedBy is the inviting user, empty for admins
+	InvitedBy string
+}
+
+// InvitationHook runs when a user registers with an invitation, before it is marked as accepted
+// An error fails the registration.
+type InvitationHook func(ctx context.Context, invitation *domain.Invitation, userID string) error
+
+// InvitationService manages signup invitations bound to an email
+// The token is returned once on creation, only its hash is stored. Registering with the token
+// through AuthService.RegisterWithInvitation creates the account for the invited email.
+type InvitationService struct {
+	repo            repository.InvitationRepository
+	emailNormalizer *utils.EmailNormalizer
+	config          InvitationConfig
+	hooks           []InvitationHook
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(repo repository.InvitationRepository, emailNormalizer *utils.EmailNormalizer, config InvitationConfig) *InvitationService {
+	return &InvitationService{repo: repo, emailNormalizer: emailNormalizer, config: config}
+}
+
+// OnAccept adds a hook run when a user registers with an invitation
+// Hooks must be added before the service is used.
+func (s *InvitationService) OnAccept(hook InvitationHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Required reports whether registration is invite-only
+func (s *InvitationService) Required() bool {
+	return s.config.Required
+}
+
+// UsersCanInvite reports whether users, not only admins, can create invitations
+func (s *InvitationService) UsersCanInvite() bool {
+	return s.config.AllowUsers
+}
+
+// Create creates an invitation and returns it along with its token
+func (s *InvitationService) Create(ctx context.Context, req CreateInvitation) (_ *domain.Invitation, _ string, err error) {
+	ctx, span := tracer.Start(ctx, "InvitationService.Create")
+	defer func() { endSpan(span, err) }()
+
+	if !utils.ValidateEmail(req.Email) {
+		return nil, "", ErrInvalidEmail
+	}
+
+	buf := make([]byte, invitationTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	invitation := &domain.Invitation{
+		TokenHash:       hashInvitationToken(token),
+		Email:           utils.SanitizeEmail(req.Email),
+		EmailNormalized: s.emailNormalizer.Normalize(req.Email),
+		Role:            req.Role,
+		Tenant:          req.Tenant,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(s.config.TTL),
+	}
+	if req.InvitedBy != "" {
+		invitation.InvitedBy = &req.InvitedBy
+	}
+
+	if err := s.repo.Create(ctx, invitation); err != nil {
+		return nil, "", err
+	}
+	return invitation, token, nil
+}
+
+// List returns invitations newest first, those created by invitedBy or all when it is empty
+func (s *InvitationService) List(ctx context.Context, invitedBy string) ([]*domain.Invitation, error) {
+	return s.repo.List(ctx, invitedBy)
+}
+
+// Revoke revokes a pending invitation, created by invitedBy unless it is empty
+func (s *InvitationService) Revoke(ctx context.Context, id, invitedBy string) (err error) {
+	ctx, span := tracer.Start(ctx, "InvitationService.Revoke")
+	defer func() { endSpan(span, err) }()
+
+	invitation, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+	if invitedBy != "" && (invitation.InvitedBy == nil || *invitation.InvitedBy != invitedBy) {
+		return ErrInvitationNotFound
+	}
+
+	if err := s.repo.Revoke(ctx, id, time.Now()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// lookup returns the pending invitation of a token
+func (s *InvitationService) lookup(ctx context.Context, token string) (*domain.Invitation, error) {
+	invitation, err := s.repo.GetByTokenHash(ctx, hashInvitationToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+	if invitation.Status(time.Now()) != domain.InvitationStatusPending {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+// accept records that userID registered with the invitation, once
+func (s *InvitationService) accept(ctx context.Context, invitation *domain.Invitation, userID string) error {
+	for _, hook := range s.hooks {
+		if err := hook(ctx, invitation, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.MarkAccepted(ctx, invitation.ID, userID, time.Now()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Accepted or revoked concurrently
+			return ErrInvalidInvitation
+		}
+		return fmt.Errorf("failed to accept invitation: %w", err)
+	}
+	return nil
+}
+
+// hashInvitationToken hashes an invitation token for storage
+func hashInvitationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+func TestInvitationOnlyRegistration(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{Required: true, TTL: time.Hour})
+	auth := newAuthService(env, nil, invitations)
+
+	if _, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"}); !errors.Is(err, service.ErrInvitationRequired) {
+		t.Fatalf("Expected ErrInvitationRequired, got %v", err)
+	}
+
+	role := "member"
+	invitation, token, err := invitations.Create(ctx, service.CreateInvitation{Email: "User@Example.com", Role: &role})
+	if err != nil {
+		t.Fatalf("Failed to create invitation: %v", err)
+	}
+	if stored, _ := env.Repos.Invitation.GetByID(ctx, invitation.ID); stored.TokenHash == token {
+		t.Error("Expected the token not to be stored in plain text")
+	}
+
+	if _, err := auth.RegisterWithInvitation(ctx, "unknown", &dto.RegisterWithInvitationRequest{Password: "Password123"}); !errors.Is(err, service.ErrInvalidInvitation) {
+		t.Errorf("Expected ErrInvalidInvitation for an unknown token, got %v", err)
+	}
+
+	registered, err := auth.RegisterWithInvitation(ctx, token, &dto.RegisterWithInvitationRequest{Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register with invitation: %v", err)
+	}
+	if registered.AuthResponse.User.Email != "user@example.com" {
+		t.Errorf("Expected the invited email, got %s", registered.AuthResponse.User.Email)
+	}
+
+	accepted, _ := env.Repos.Invitation.GetByID(ctx, invitation.ID)
+	if accepted.Status(time.Now()) != domain.InvitationStatusAccepted || *accepted.AcceptedBy != registered.AuthResponse.User.ID {
+		t.Errorf("Expected the invitation to be accepted by the new user, got %+v", accepted)
+	}
+	if _, err := auth.RegisterWithInvitation(ctx, token, &dto.RegisterWithInvitationRequest{Password: "Password123"}); !errors.Is(err, service.ErrInvalidInvitation) {
+		t.Errorf("Expected invitations to be used once, got %v", err)
+	}
+}
+
+func TestInvitationRevoke(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{AllowUsers: true, TTL: time.Hour})
+	auth := newAuthService(env, nil, invitations)
+
+	inviter, err := auth.Register(ctx, &dto.RegisterRequest{Email: "inviter@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	inviterID := inviter.AuthResponse.User.ID
+
+	invitation, token, err := invitations.Create(ctx, service.CreateInvitation{Email: "user@example.com", InvitedBy: inviterID})
+	if err != nil {
+		t.Fatalf("Failed to create invitation: %v", err)
+	}
+	if _, _, err := invitations.Create(ctx, service.CreateInvitation{Email: "not-an-email"}); !errors.Is(err, service.ErrInvalidEmail) {
+		t.Errorf("Expected ErrInvalidEmail, got %v", err)
+	}
+
+	if err := invitations.Revoke(ctx, invitation.ID, "other-user"); !errors.Is(err, service.ErrInvitationNotFound) {
+		t.Errorf("Expected invitations of others not to be revoked, got %v", err)
+	}
+	if err := invitations.Revoke(ctx, invitation.ID, inviterID); err != nil {
+		t.Fatalf("Failed to revoke invitation: %v", err)
+	}
+	if err := invitations.Revoke(ctx, invitation.ID, ""); !errors.Is(err, service.ErrInvitationNotFound) {
+		t.Errorf("Expected revoked invitations not to be revoked again, got %v", err)
+	}
+
+	if _, err := auth.RegisterWithInvitation(ctx, token, &dto.RegisterWithInvitationRequest{Password: "Password123"}); !errors.Is(err, service.ErrInvalidInvitation) {
+		t.Errorf("Expected revoked invitations to be rejected, got %v", err)
+	}
+	if _, err := env.Repos.User.GetByEmail(ctx, "user@example.com"); err == nil {
+		t.Error("Expected no user to be created with a revoked invitation")
+	}
+}
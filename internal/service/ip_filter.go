@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+const (
+	// ipFilterReloadChannel notifies all replicas that IP rules have changed
+	ipFilterReloadChannel = "ipfilter:reload"
+
+	defaultIPFilterReloadInterval = time.Minute
+)
+
+// ErrInvalidIPRule is returned when an IP rule has an invalid CIDR or action
+var ErrInvalidIPRule = errors.New("invalid ip rule")
+
+type compiledIPRule struct {
+	prefix netip.Prefix
+	allow  bool
+}
+
+// IPFilter decides whether client IPs are allowed based on CIDR rules stored in Postgres.
+// Rules are kept in memory and reloaded periodically and on change notifications via Redis.
+//
+// The most specific matching rule wins, so allow rules can carve exceptions out of
+// denied ranges. IPs that match no rule are allowed.
+type IPFilter struct {
+	repo           repository.IPRuleRepository
+	redis          *database.Redis
+	reloadInterval time.Duration
+	rules          atomic.Pointer[[]compiledIPRule]
+}
+
+// NewIPFilter creates a new IP filter
+func NewIPFilter(repo repository.IPRuleRepository, redis *database.Redis, reloadInterval time.Duration) *IPFilter {
+	if reloadInterval <= 0 {
+		reloadInterval = defaultIPFilterReloadInterval
+	}
+
+	f := &IPFilter{
+		repo:           repo,
+		redis:          redis,
+		reloadInterval: reloadInterval,
+	}
+	f.rules.Store(&[]compiledIPRule{})
+	return f
+}
+
+// Allowed checks if the given IP is allowed by the loaded rules
+func (f *IPFilter) Allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return true
+	}
+	addr = addr.Unmap()
+
+	// Rules are sorted by prefix length, most specific first
+	for _, rule := range *f.rules.Load() {
+		if rule.prefix.Contains(addr) {
+			return rule.allow
+		}
+	}
+
+	return true
+}
+
+// Reload loads rules from the database and replaces the in-memory set
+func (f *IPFilter) Reload(ctx context.Context) error {
+	rules, err := f.repo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load ip rules: %w", err)
+	}
+
+	compiled := make([]compiledIPRule, 0, len(rules))
+	for _, rule := range rules {
+		prefix, err := netip.ParsePrefix(rule.CIDR)
+		if err != nil {
+			return fmt.Errorf("failed to parse ip rule %s: %w", rule.ID, err)
+		}
+		compiled = append(compiled, compiledIPRule{
+			prefix: prefix.Masked(),
+			allow:  rule.Action == domain.IPRuleAllow,
+		})
+	}
+
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return compiled[i].prefix.Bits() > compiled[j].prefix.Bits()
+	})
+
+	f.rules.Store(&compiled)
+	return nil
+}
+
+// Run reloads rules on change notifications and on a fixed interval until ctx is cancelled
+func (f *IPFilter) Run(ctx context.Context) {
+	pubsub := f.redis.Client.Subscribe(ctx, ipFilterReloadChannel)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(f.reloadInterval)
+	defer ticker.Stop()
+
+	notifications := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notifications:
+		}
+
+		// Keep serving the previous rule set if reload fails
+		if err := f.Reload(ctx); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to reload IP rules", zap.Error(err))
+		}
+	}
+}
+
+// ListRules returns all stored IP rules
+func (f *IPFilter) ListRules(ctx context.Context) ([]*domain.IPRule, error) {
+	return f.repo.List(ctx)
+}
+
+// AddRule validates and stores a new IP rule, then notifies all replicas
+func (f *IPFilter) AddRule(ctx context.Context, rule *domain.IPRule) error {
+	cidr, err := normalizeCIDR(rule.CIDR)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIPRule, err)
+	}
+	rule.CIDR = cidr
+
+	if rule.Action != domain.IPRuleAllow && rule.Action != domain.IPRuleDeny {
+		return fmt.Errorf("%w: action must be %s or %s", ErrInvalidIPRule, domain.IPRuleAllow, domain.IPRuleDeny)
+	}
+
+	if err := f.repo.Create(ctx, rule); err != nil {
+		return err
+	}
+
+	return f.notify(ctx)
+}
+
+// RemoveRule deletes an IP rule, then notifies all replicas
+func (f *IPFilter) RemoveRule(ctx context.Context, ruleID string) error {
+	if err := f.repo.Delete(ctx, ruleID); err != nil {
+		return err
+	}
+
+	return f.notify(ctx)
+}
+
+// notify reloads local rules and publishes a reload notification
+func (f *IPFilter) notify(ctx context.Context) error {
+	if err := f.Reload(ctx); err != nil {
+		return err
+	}
+
+	if err := f.redis.Client.Publish(ctx, ipFilterReloadChannel, "1").Err(); err != nil {
+		return fmt.Errorf("failed to publish ip rules reload: %w", err)
+	}
+
+	return nil
+}
+
+// normalizeCIDR accepts a CIDR or a single IP address and returns a masked CIDR
+func normalizeCIDR(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return "", err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return "", err
+	}
+
+	return prefix.Masked().String(), nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+const (
+	// jwtKeysKey is a hash of HMAC secrets added by rotations, by key ID
+	jwtKeysKey = "jwt:keys"
+	// jwtKeysReloadChannel notifies all replicas that keys were rotated
+	jwtKeysReloadChannel = "jwt:keys:reload"
+
+	defaultJWTKeysReloadInterval = time.Minute
+	jwtKeySecretBytes            = 32
+)
+
+// jwtKey is a signing key added by a rotation, as stored in Redis
+type jwtKey struct {
+	Secret    []byte    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+	// ActivatesAt is when the key starts signing tokens, every replica has loaded it by then
+	ActivatesAt time.Time `json:"activates_at"`
+}
+
+// JWTKeyState describes a signing key without its secret
+type JWTKeyState struct {
+	ID          string
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+	// Current is set on the key new tokens are signed with
+	Current bool
+	// Configured is set on JWT_SECRET and JWT_PREVIOUS_SECRETS, others were added by rotations
+	Configured bool
+}
+
+// jwtKeys is a loaded keyring, rotated keys sorted by activation
+type jwtKeys struct {
+	ids     []string
+	rotated []jwtKey
+}
+
+// JWTKeyring rotates the HMAC secrets of tokens without downtime, for deployments that can't
+// move to asymmetric keys yet. It implements utils.SigningKeys.
+//
+// Rotations add a secret to Redis, which every replica reloads on a notification or within the
+// reload interval; the secret only starts signing tokens after that interval, so all replicas
+// can validate them by then. Replaced secrets keep validating tokens for the retention, the
+// lifetime of refresh tokens. Configured secrets sign tokens until the first rotation and always
+// validate them.
+type JWTKeyring struct {
+	configured     []utils.SigningKey
+	redis          *database.Redis
+	retention      time.Duration
+	reloadInterval time.Duration
+	keys           atomic.Pointer[jwtKeys]
+}
+
+// NewJWTKeyring creates a keyring, configured holds the current configured secret first
+func NewJWTKeyring(configured []utils.SigningKey, redis *database.Redis, retention, reloadInterval time.Duration) *JWTKeyring {
+	if reloadInterval <= 0 {
+		reloadInterval = defaultJWTKeysReloadInterval
+	}
+
+	k := &JWTKeyring{
+		configured:     configured,
+		redis:          redis,
+		retention:      retention,
+		reloadInterval: reloadInterval,
+	}
+	k.keys.Store(&jwtKeys{})
+	return k
+}
+
+// Current returns the rotated key activated last, or the configured secret before the first rotation
+func (k *JWTKeyring) Current() utils.SigningKey {
+	keys := k.keys.Load()
+	now := time.Now()
+	for i := len(keys.rotated) - 1; i >= 0; i-- {
+		if !keys.rotated[i].ActivatesAt.After(now) {
+			return utils.SigningKey{ID: keys.ids[i], Secret: keys.rotated[i].Secret}
+		}
+	}
+	return k.configured[0]
+}
+
+// Verification returns the rotated keys, including ones not active yet, and the configured ones
+func (k *JWTKeyring) Verification() []utils.SigningKey {
+	keys := k.keys.Load()
+	result := make([]utils.SigningKey, 0, len(keys.rotated)+len(k.configured))
+	for i := len(keys.rotated) - 1; i >= 0; i-- {
+		result = append(result, utils.SigningKey{ID: keys.ids[i], Secret: keys.rotated[i].Secret})
+	}
+	return append(result, k.configured...)
+}
+
+// List returns the keys, rotated ones by activation from the latest, then the configured ones
+func (k *JWTKeyring) List() []JWTKeyState {
+	keys := k.keys.Load()
+	current := k.Current().ID
+
+	result := make([]JWTKeyState, 0, len(keys.rotated)+len(k.configured))
+	for i := len(keys.rotated) - 1; i >= 0; i-- {
+		result = append(result, JWTKeyState{
+			ID:          keys.ids[i],
+			CreatedAt:   keys.rotated[i].CreatedAt,
+			ActivatesAt: keys.rotated[i].ActivatesAt,
+			Current:     keys.ids[i] == current,
+		})
+	}
+	for _, key := range k.configured {
+		result = append(result, JWTKeyState{ID: key.ID, Current: key.ID == current, Configured: true})
+	}
+	return result
+}
+
+// Reload loads the rotated keys and replaces the in-memory keyring
+func (k *JWTKeyring) Reload(ctx context.Context) error {
+	keys, _, err := k.load(ctx)
+	if err != nil {
+		return err
+	}
+	k.keys.Store(keys)
+	return nil
+}
+
+// load reads the rotated keys and leaves out the ones replaced by a key activated longer than
+// the retention ago, whose IDs it returns
+func (k *JWTKeyring) load(ctx context.Context) (*jwtKeys, []string, error) {
+	values, err := k.redis.Client.HGetAll(ctx, jwtKeysKey).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load jwt keys: %w", err)
+	}
+
+	keys := &jwtKeys{}
+	for id, value := range values {
+		var key jwtKey
+		if err := json.Unmarshal([]byte(value), &key); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode jwt key %s: %w", id, err)
+		}
+		keys.ids = append(keys.ids, id)
+		keys.rotated = append(keys.rotated, key)
+	}
+	sort.Sort(keys)
+
+	expired := 0
+	now := time.Now()
+	for i := 1; i < len(keys.rotated); i++ {
+		if keys.rotated[i].ActivatesAt.Add(k.retention).Before(now) {
+			expired = i
+		}
+	}
+	expiredIDs := keys.ids[:expired]
+	keys.ids, keys.rotated = keys.ids[expired:], keys.rotated[expired:]
+	return keys, expiredIDs, nil
+}
+
+// Run reloads keys on rotation notifications and on a fixed interval until ctx is cancelled
+func (k *JWTKeyring) Run(ctx context.Context) {
+	pubsub := k.redis.Client.Subscribe(ctx, jwtKeysReloadChannel)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(k.reloadInterval)
+	defer ticker.Stop()
+
+	notifications := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-notifications:
+		}
+
+		// Keep serving the previous keys if reload fails
+		if err := k.Reload(ctx); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to reload jwt keys", zap.Error(err))
+		}
+	}
+}
+
+// Rotate adds a random secret that starts signing tokens once every replica has loaded it,
+// removes expired keys and notifies all replicas
+func (k *JWTKeyring) Rotate(ctx context.Context) (*JWTKeyState, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, jwtKeySecretBytes)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate jwt key id: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate jwt key: %w", err)
+	}
+
+	now := time.Now()
+	key := jwtKey{Secret: secret, CreatedAt: now, ActivatesAt: now.Add(k.reloadInterval)}
+	value, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode jwt key: %w", err)
+	}
+	if err := k.redis.Client.HSet(ctx, jwtKeysKey, hex.EncodeToString(id), value).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store jwt key: %w", err)
+	}
+
+	keys, expired, err := k.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	k.keys.Store(keys)
+	if len(expired) > 0 {
+		if err := k.redis.Client.HDel(ctx, jwtKeysKey, expired...).Err(); err != nil {
+			return nil, fmt.Errorf("failed to delete expired jwt keys: %w", err)
+		}
+	}
+	if err := k.redis.Client.Publish(ctx, jwtKeysReloadChannel, "1").Err(); err != nil {
+		return nil, fmt.Errorf("failed to publish jwt keys reload: %w", err)
+	}
+
+	return &JWTKeyState{ID: hex.EncodeToString(id), CreatedAt: key.CreatedAt, ActivatesAt: key.ActivatesAt}, nil
+}
+
+func (k *jwtKeys) Len() int { return len(k.ids) }
+
+func (k *jwtKeys) Less(i, j int) bool {
+	return k.rotated[i].ActivatesAt.Before(k.rotated[j].ActivatesAt)
+}
+
+func (k *jwtKeys) Swap(i, j int) {
+	k.ids[i], k.ids[j] = k.ids[j], k.ids[i]
+	k.rotated[i], k.rotated[j] = k.rotated[j], k.rotated[i]
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+func TestJWTKeyringRotation(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	configured := utils.NewSigningKey(strings.Repeat("c", 32))
+	keyring := NewJWTKeyring([]utils.SigningKey{configured}, rdb, time.Hour, 50*time.Millisecond)
+	other := NewJWTKeyring([]utils.SigningKey{configured}, rdb, time.Hour, 50*time.Millisecond)
+	if err := keyring.Reload(ctx); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if keyring.Current().ID != configured.ID {
+		t.Fatalf("Expected the configured key to sign before the first rotation, got %s", keyring.Current().ID)
+	}
+
+	rotated, err := keyring.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if keyring.Current().ID != configured.ID {
+		t.Error("Expected the rotated key not to sign before replicas have loaded it")
+	}
+	if err := other.Reload(ctx); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if ids := keyIDs(other.Verification()); ids != rotated.ID+","+configured.ID {
+		t.Errorf("Expected other replicas to validate with the rotated key, got %s", ids)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if keyring.Current().ID != rotated.ID || other.Current().ID != rotated.ID {
+		t.Errorf("Expected the rotated key to sign once active, got %s and %s", keyring.Current().ID, other.Current().ID)
+	}
+
+	states := keyring.List()
+	if len(states) != 2 || !states[0].Current || states[0].ID != rotated.ID || !states[1].Configured || states[1].Current {
+		t.Errorf("Unexpected key states: %+v", states)
+	}
+}
+
+func TestJWTKeyringDropsExpiredKeys(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	ctx := context.Background()
+
+	configured := utils.NewSigningKey(strings.Repeat("c", 32))
+	keyring := NewJWTKeyring([]utils.SigningKey{configured}, rdb, 0, time.Millisecond)
+
+	first, err := keyring.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	second, err := keyring.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := keyring.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	// Without retention, keys are dropped once their successor is active
+	ids, err := rdb.Client.HKeys(ctx, jwtKeysKey).Result()
+	if err != nil {
+		t.Fatalf("HKeys failed: %v", err)
+	}
+	for _, id := range ids {
+		if id == first.ID {
+			t.Errorf("Expected the first key to be deleted, got %v", ids)
+		}
+	}
+	if verification := keyIDs(keyring.Verification()); !strings.Contains(verification, second.ID) || strings.Contains(verification, first.ID) {
+		t.Errorf("Expected only unexpired keys to validate tokens, got %s", verification)
+	}
+}
+
+func keyIDs(keys []utils.SigningKey) string {
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.ID)
+	}
+	return strings.Join(ids, ",")
+}
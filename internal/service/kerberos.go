@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/kerberos"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// Mappings of Kerberos principals to users
+const (
+	KerberosMappingUsername = "username"
+	KerberosMappingEmail    = "email"
+)
+
+// TicketAcceptor verifies SPNEGO tokens and returns the principal of their ticket
+type TicketAcceptor interface {
+	Accept(token []byte, clientAddr string) (*kerberos.Principal, error)
+}
+
+// KerberosConfig configures SPNEGO sign-in
+type KerberosConfig struct {
+	// Realms are the realms whose principals may sign in, compared case-insensitively
+	Realms []string
+	// UserMapping is KerberosMappingUsername or KerberosMappingEmail
+	UserMapping string
+	// EmailDomain replaces the realm in the email name@domain users of a principal must have verified
+	EmailDomain string
+}
+
+// KerberosService signs users of domain-joined machines in with their Kerberos ticket
+// Principals are linked to existing users, users aren't created. Links are created by admins, or
+// on the first sign-in of a principal whose user is found by UserMapping. Usernames and emails
+// are chosen by users themselves, so such users must have verified the email of the principal.
+type KerberosService struct {
+	auth            AuthService
+	userRepo        repository.UserRepository
+	identityRepo    repository.IdentityRepository
+	emailNormalizer *utils.EmailNormalizer
+	acceptor        TicketAcceptor
+	config          KerberosConfig
+}
+
+// NewKerberosService creates a Kerberos service accepting tickets with acceptor
+func NewKerberosService(
+	auth AuthService,
+	userRepo repository.UserRepository,
+	identityRepo repository.IdentityRepository,
+	emailNormalizer *utils.EmailNormalizer,
+	acceptor TicketAcceptor,
+	config KerberosConfig,
+) *KerberosService {
+	if config.UserMapping == "" {
+		config.UserMapping = KerberosMappingUsername
+	}
+	return &KerberosService{
+		auth:            auth,
+		userRepo:        userRepo,
+		identityRepo:    identityRepo,
+		emailNormalizer: emailNormalizer,
+		acceptor:        acceptor,
+		config:          config,
+	}
+}
+
+// Authenticate verifies the SPNEGO token of a client and starts a session for the user of its principal
+func (s *KerberosService) Authenticate(ctx context.Context, token []byte, clientAddr string) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "KerberosService.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	principal, err := s.acceptor.Accept(token, clientAddr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKerberosTicket, err)
+	}
+	if !s.realmAllowed(principal.Realm) {
+		return nil, fmt.Errorf("%w: realm %s is not accepted", ErrInvalidKerberosTicket, principal.Realm)
+	}
+
+	user, err := s.lookup(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.IssueSession(ctx, user.ID)
+}
+
+func (s *KerberosService) realmAllowed(realm string) bool {
+	for _, allowed := range s.config.Realms {
+		if strings.EqualFold(allowed, realm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Link links a principal like jdoe@CORP.EXAMPLE.COM to a user, who signs in with its tickets
+// from then on whatever the username and email of the user are
+func (s *KerberosService) Link(ctx context.Context, userID, principal string) (err error) {
+	ctx, span := tracer.Start(ctx, "KerberosService.Link")
+	defer func() { endSpan(span, err) }()
+
+	name, realm, ok := strings.Cut(principal, "@")
+	if !ok || !s.realmAllowed(realm) || !userPrincipal(&kerberos.Principal{Name: name, Realm: realm}) {
+		return ErrInvalidKerberosPrincipal
+	}
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	err = s.identityRepo.Create(ctx, &domain.Identity{UserID: userID, Type: domain.IdentityTypeKerberos, Subject: kerberosSubject(name, realm)})
+	if errors.Is(err, repository.ErrDuplicateIdentity) {
+		return ErrKerberosPrincipalLinked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link principal: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the user linked to a principal, or links the user UserMapping finds when
+// the user has verified the email of the principal
+func (s *KerberosService) lookup(ctx context.Context, principal *kerberos.Principal) (*domain.User, error) {
+	if !userPrincipal(principal) {
+		return nil, ErrKerberosUserNotFound
+	}
+
+	subject := kerberosSubject(principal.Name, principal.Realm)
+	identity, err := s.identityRepo.GetBySubject(ctx, domain.IdentityTypeKerberos, subject)
+	switch {
+	case err == nil:
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrKerberosUserNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		return user, nil
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	user, err := s.match(ctx, principal)
+	if err != nil {
+		return nil, err
+	}
+	// A concurrent first sign-in may have linked the principal already, to the same user
+	err = s.identityRepo.Create(ctx, &domain.Identity{UserID: user.ID, Type: domain.IdentityTypeKerberos, Subject: subject})
+	if err != nil && !errors.Is(err, repository.ErrDuplicateIdentity) {
+		return nil, fmt.Errorf("failed to link principal: %w", err)
+	}
+	return user, nil
+}
+
+// match returns the user of a principal that isn't linked yet by username or email
+// Anyone may register the username or email of a principal, so only users who verified the
+// email of the principal match; others must be linked by an admin.
+func (s *KerberosService) match(ctx context.Context, principal *kerberos.Principal) (*domain.User, error) {
+	domainName := s.config.EmailDomain
+	if domainName == "" {
+		domainName = strings.ToLower(principal.Realm)
+	}
+	email := s.emailNormalizer.Normalize(principal.Name + "@" + domainName)
+
+	var (
+		user *domain.User
+		err  error
+	)
+	switch s.config.UserMapping {
+	case KerberosMappingEmail:
+		user, err = s.userRepo.GetByEmail(ctx, email)
+	default:
+		user, err = s.userRepo.GetByUsername(ctx, utils.SanitizeUsername(principal.Name))
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrKerberosUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.IsEmailVerified || s.emailNormalizer.Normalize(user.Email) != email {
+		return nil, ErrKerberosUserNotFound
+	}
+	return user, nil
+}
+
+// userPrincipal reports whether a principal may belong to a user, principals with instances
+// such as jdoe/admin are service or admin principals and never do
+func userPrincipal(principal *kerberos.Principal) bool {
+	return principal.Name != "" && principal.Realm != "" && !strings.Contains(principal.Name, "/")
+}
+
+// kerberosSubject returns the identity subject of a principal
+func kerberosSubject(name, realm string) string {
+	return strings.ToLower(name) + "@" + strings.ToUpper(realm)
+}
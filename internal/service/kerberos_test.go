@@ -0,0 +1,98 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/kerberos"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// fakeAcceptor accepts tokens naming a principal, e.g. jdoe@CORP.EXAMPLE.COM
+type fakeAcceptor struct{}
+
+func (fakeAcceptor) Accept(token []byte, _ string) (*kerberos.Principal, error) {
+	name, realm, ok := strings.Cut(string(token), "@")
+	if !ok {
+		return nil, kerberos.ErrTicketRejected
+	}
+	return &kerberos.Principal{Name: name, Realm: realm}, nil
+}
+
+func TestKerberosServiceAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	create := func(email, username string, verified bool) *domain.User {
+		t.Helper()
+		user := &domain.User{Email: email, EmailNormalized: email, Username: &username, IsActive: true, IsEmailVerified: verified}
+		if err := env.Repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	user := create("jdoe@corp.example.com", "jdoe", true)
+	// Anyone may choose the username of a domain user, or register an email of the domain without verifying it
+	create("attacker@example.com", "asmith", true)
+	create("ceo@corp.example.com", "ceo", false)
+
+	byUsername := service.NewKerberosService(env.Service, env.Repos.User, env.Repos.Identity, utils.NewEmailNormalizer(nil, nil), fakeAcceptor{},
+		service.KerberosConfig{Realms: []string{"CORP.EXAMPLE.COM"}})
+	response, err := byUsername.Authenticate(ctx, []byte("JDoe@CORP.EXAMPLE.COM"), "10.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if response.AuthResponse.User.ID != user.ID {
+		t.Errorf("Expected user %s, got %s", user.ID, response.AuthResponse.User.ID)
+	}
+	if identity, err := env.Repos.Identity.GetBySubject(ctx, domain.IdentityTypeKerberos, "jdoe@CORP.EXAMPLE.COM"); err != nil || identity.UserID != user.ID {
+		t.Errorf("Expected the first sign-in to link the principal, got %+v (%v)", identity, err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "invalid ticket", token: "garbage", want: service.ErrInvalidKerberosTicket},
+		{name: "realm not accepted", token: "jdoe@PARTNER.EXAMPLE.COM", want: service.ErrInvalidKerberosTicket},
+		{name: "unknown user", token: "bwayne@CORP.EXAMPLE.COM", want: service.ErrKerberosUserNotFound},
+		{name: "admin principal", token: "jdoe/admin@CORP.EXAMPLE.COM", want: service.ErrKerberosUserNotFound},
+		{name: "self-registered username", token: "asmith@CORP.EXAMPLE.COM", want: service.ErrKerberosUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := byUsername.Authenticate(ctx, []byte(tt.token), "10.0.0.1:0"); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	byEmail := service.NewKerberosService(env.Service, env.Repos.User, env.Repos.Identity, utils.NewEmailNormalizer(nil, nil), fakeAcceptor{},
+		service.KerberosConfig{Realms: []string{"corp.example.com"}, UserMapping: service.KerberosMappingEmail})
+	if _, err := byEmail.Authenticate(ctx, []byte("ceo@CORP.EXAMPLE.COM"), "10.0.0.1:0"); !errors.Is(err, service.ErrKerberosUserNotFound) {
+		t.Errorf("Expected an unverified email to be refused, got %v", err)
+	}
+
+	// Admins link principals whose user has another username and email
+	if err := byEmail.Link(ctx, user.ID, "john.doe@CORP.EXAMPLE.COM"); err != nil {
+		t.Fatalf("Failed to link principal: %v", err)
+	}
+	response, err = byEmail.Authenticate(ctx, []byte("john.doe@CORP.EXAMPLE.COM"), "10.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to authenticate with a linked principal: %v", err)
+	}
+	if response.AuthResponse.User.ID != user.ID {
+		t.Errorf("Expected user %s, got %s", user.ID, response.AuthResponse.User.ID)
+	}
+	if err := byEmail.Link(ctx, user.ID, "john.doe@CORP.EXAMPLE.COM"); !errors.Is(err, service.ErrKerberosPrincipalLinked) {
+		t.Errorf("Expected ErrKerberosPrincipalLinked, got %v", err)
+	}
+	if err := byEmail.Link(ctx, user.ID, "jdoe@PARTNER.EXAMPLE.COM"); !errors.Is(err, service.ErrInvalidKerberosPrincipal) {
+		t.Errorf("Expected ErrInvalidKerberosPrincipal, got %v", err)
+	}
+}
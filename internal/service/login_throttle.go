@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// loginThrottleKey prefixes the counters of consecutive failed logins per account
+const loginThrottleKey = "login_throttle:"
+
+// LoginThrottle slows down password guessing with progressive delays per account
+// Logins wait for the delay of the number of consecutive failures of the account, e.g. 0s,
+// 1s, 2s, then 5s for every further attempt. Failures are counted in Redis, shared by all
+// replicas, until a successful login or until no login failed for the window. Unlike the
+// attempt limits of the enumeration policy, the owner can still log in, only slower.
+type LoginThrottle struct {
+	redis  *database.Redis
+	delays []time.Duration
+	window time.Duration
+
+	delayed metric.Int64Counter
+}
+
+// NewLoginThrottle creates a throttle waiting delays[n] after n consecutive failures, the last
+// delay applies to all further failures. Without delays logins aren't throttled.
+func NewLoginThrottle(redis *database.Redis, delays []time.Duration, window time.Duration) *LoginThrottle {
+	t := &LoginThrottle{
+		redis:  redis,
+		delays: delays,
+		window: window,
+	}
+
+	var err error
+	if t.delayed, err = meter.Int64Counter("auth.login_throttle.delayed",
+		metric.WithDescription("Number of logins delayed after consecutive failures of the account"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create delayed counter: %w", err))
+	}
+
+	return t
+}
+
+// Wait waits for the delay of the failures of account, or until ctx is done
+// Redis failures let the login through without delay, like the rate limits do.
+func (t *LoginThrottle) Wait(ctx context.Context, account string) error {
+	if len(t.delays) == 0 {
+		return nil
+	}
+
+	failures, err := t.redis.Client.Get(ctx, t.key(account)).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil
+	}
+	delay := t.delays[min(failures, len(t.delays)-1)]
+	if delay <= 0 {
+		return nil
+	}
+	t.delayed.Add(ctx, 1)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Failure counts a failed login of account
+func (t *LoginThrottle) Failure(ctx context.Context, account string) {
+	if len(t.delays) == 0 {
+		return
+	}
+
+	key := t.key(account)
+	pipe := t.redis.Client.TxPipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, t.window)
+	_, _ = pipe.Exec(ctx)
+}
+
+// Success resets the failures of account
+func (t *LoginThrottle) Success(ctx context.Context, account string) {
+	if len(t.delays) == 0 {
+		return
+	}
+	_ = t.redis.Client.Del(ctx, t.key(account)).Err()
+}
+
+// key hashes account so that emails of unknown accounts don't end up in Redis
+func (t *LoginThrottle) key(account string) string {
+	sum := sha256.Sum256([]byte(account))
+	return loginThrottleKey + hex.EncodeToString(sum[:])
+}
+
+// loginThrottleOrNop returns throttle, or a throttle without delays when it is nil
+func loginThrottleOrNop(throttle *LoginThrottle) *LoginThrottle {
+	if throttle == nil {
+		return &LoginThrottle{}
+	}
+	return throttle
+}
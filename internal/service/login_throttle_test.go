@@ -0,0 +1,77 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newThrottledAuthService creates an auth service of env delaying logins after failures
+func newThrottledAuthService(env *testutil.AuthEnv, delays ...time.Duration) service.AuthService {
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	return service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), service.NewLoginThrottle(env.Redis, delays, time.Minute), nil, time.Hour, 0)
+}
+
+// timedLogin logs in and returns the error and how long the login took
+func timedLogin(ctx context.Context, auth service.AuthService, identifier, password string) (time.Duration, error) {
+	start := time.Now()
+	_, err := auth.Login(ctx, &dto.LoginRequest{Identifier: identifier, Password: password})
+	return time.Since(start), err
+}
+
+func TestLoginThrottleDelaysConsecutiveFailures(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auth := newThrottledAuthService(env, 0, 100*time.Millisecond, 200*time.Millisecond)
+
+	if _, err := auth.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	// The first attempt isn't delayed, every failure delays the next one more, up to the last delay
+	for i, minDelay := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 200 * time.Millisecond} {
+		took, err := timedLogin(ctx, auth, "user@example.com", "Wrong1234")
+		if !errors.Is(err, service.ErrInvalidCredentials) {
+			t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+		}
+		if took < minDelay || (minDelay == 0 && took >= 100*time.Millisecond) {
+			t.Errorf("Attempt %d took %s, expected a delay of %s", i+1, took, minDelay)
+		}
+	}
+
+	// A successful login still works, only later, and resets the failures
+	if took, err := timedLogin(ctx, auth, "user@example.com", "Password123"); err != nil || took < 200*time.Millisecond {
+		t.Fatalf("Expected a delayed successful login, got %v after %s", err, took)
+	}
+	if took, err := timedLogin(ctx, auth, "user@example.com", "Password123"); err != nil || took >= 100*time.Millisecond {
+		t.Errorf("Expected no delay after a successful login, got %v after %s", err, took)
+	}
+}
+
+func TestLoginThrottleUnknownAccount(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+	auth := newThrottledAuthService(env, 0, time.Minute)
+
+	if _, err := timedLogin(context.Background(), auth, "nobody@example.com", "Password123"); !errors.Is(err, service.ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	// Unknown accounts are delayed like existing ones, a cancelled login stops waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := timedLogin(ctx, auth, "Nobody@Example.com", "Password123"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the login to wait until the deadline, got %v", err)
+	}
+}
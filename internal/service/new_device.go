@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/geoip"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+// locate returns the location of an IP address, the zero location when it is unknown or no
+// locator is configured
+func (s *authService) locate(ctx context.Context, ip string) geoip.Location {
+	if s.locator == nil || ip == "" {
+		return geoip.Location{}
+	}
+	location, err := s.locator.Lookup(ip)
+	if err != nil {
+		observability.LoggerFromContext(ctx).Debug("Failed to locate IP address", zap.Error(err))
+		return geoip.Location{}
+	}
+	if location == nil {
+		return geoip.Location{}
+	}
+	return *location
+}
+
+// sessionLocation returns the location a session was started from, nil when it is unknown
+func (s *authService) sessionLocation(ctx context.Context, token *domain.RefreshToken) *string {
+	if token.IPAddress == nil {
+		return nil
+	}
+	location := s.locate(ctx, *token.IPAddress).String()
+	if location == "" {
+		return nil
+	}
+	return &location
+}
+
+// alertNewDevice emails the user about a login from a device, or a country, none of the active
+// sessions of the user is from. The first session of a user isn't reported.
+// It must run before the session of the login is stored.
+func (s *authService) alertNewDevice(ctx context.Context, user *domain.User, location geoip.Location) {
+	if s.newDeviceAlerts == nil || user.HasPlaceholderEmail() {
+		return
+	}
+
+	tokens, err := s.tokenRepo.GetByUserID(ctx, user.ID)
+	if err != nil {
+		observability.LoggerFromContext(ctx).Warn("Failed to check for a new device", zap.String("user_id", user.ID), zap.Error(err))
+		return
+	}
+
+	client := ClientInfoFromContext(ctx)
+	now := time.Now()
+	active := false
+	for _, token := range tokens {
+		if token.RevokedAt != nil || token.ExpiresAt.Before(now) {
+			continue
+		}
+		active = true
+		if token.DeviceInfo == nil || *token.DeviceInfo != truncate(client.UserAgent, maxDeviceInfoLength) {
+			continue
+		}
+		// A known device in another country is reported too, its session may have been stolen
+		if token.IPAddress == nil || location.CountryCode == "" || s.locate(ctx, *token.IPAddress).CountryCode == location.CountryCode {
+			return
+		}
+	}
+	if !active {
+		return
+	}
+
+	locale := ""
+	if user.Locale != nil {
+		locale = *user.Locale
+	}
+	if err := s.newDeviceAlerts.SendNewDeviceAlert(ctx, user.Email, locale, NewDeviceEmailData{
+		Device:   client.UserAgent,
+		IP:       client.IP,
+		Location: location.String(),
+		Time:     now.UTC().Format("2006-01-02 15:04 UTC"),
+	}); err != nil {
+		observability.LoggerFromContext(ctx).Warn("Failed to send new device alert", zap.String("user_id", user.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,96 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/geoip"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeLocator resolves the IP addresses of its map
+type fakeLocator map[string]*geoip.Location
+
+func (f fakeLocator) Lookup(ip string) (*geoip.Location, error) {
+	return f[ip], nil
+}
+
+func (fakeLocator) Close() error {
+	return nil
+}
+
+func TestAuthServiceLocations(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	mail := &testutil.Mailer{}
+	runner := jobs.NewRunner(env.Redis, zap.NewNop(), jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond})
+	emails, err := service.NewEmailService(runner, mail, "en")
+	if err != nil {
+		t.Fatalf("Failed to create email service: %v", err)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go runner.Run(runCtx)
+
+	locator := fakeLocator{
+		"203.0.113.10": {CountryCode: "DE", Country: "Germany", City: "Berlin"},
+		"198.51.100.7": {CountryCode: "FR", Country: "France", City: "Paris"},
+	}
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, auditor, time.Hour, 0,
+		service.WithLocator(locator), service.WithNewDeviceAlerts(emails))
+
+	laptop := service.ContextWithClientInfo(context.Background(), service.ClientInfo{IP: "203.0.113.10", UserAgent: "laptop"})
+	login := func(ctx context.Context) {
+		t.Helper()
+		if _, err := auth.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}); err != nil {
+			t.Fatalf("Failed to log in: %v", err)
+		}
+	}
+
+	registered, err := auth.Register(laptop, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+
+	// Logins from the device of a session in the same country aren't reported
+	login(laptop)
+	if event, ok := auditor.last(service.AuditLoginSuccess); !ok || event.Location != "Berlin, Germany" {
+		t.Errorf("Expected the login to be audited with its location, got %+v", event)
+	}
+	sessions, err := auth.ListSessions(laptop, registered.AuthResponse.User.ID)
+	if err != nil || len(sessions) == 0 || sessions[0].Location == nil || *sessions[0].Location != "Berlin, Germany" {
+		t.Fatalf("Expected the sessions to have their location, got %+v (%v)", sessions, err)
+	}
+
+	// A new device and a known device in another country are reported
+	login(service.ContextWithClientInfo(context.Background(), service.ClientInfo{IP: "198.51.100.7", UserAgent: "phone"}))
+	login(service.ContextWithClientInfo(context.Background(), service.ClientInfo{IP: "198.51.100.7", UserAgent: "laptop"}))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mail.Sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := mail.Sent()
+	if len(sent) != 2 {
+		t.Fatalf("Expected 2 new device alerts, got %d", len(sent))
+	}
+	for _, msg := range sent {
+		if msg.To != "user@example.com" || !strings.Contains(msg.Text, "Paris, France") {
+			t.Errorf("Expected an alert with the location of the login, got %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// oauthCodeKey holds the user a login code was issued to until the client exchanges it
+	oauthCodeKey = "oauth:code:"
+	// oauthSignInKey is set while a sign-in with a provider counts as recent
+	oauthSignInKey = "oauth:signin:"
+
+	defaultOAuthStateTTL = 10 * time.Minute
+	oauthLoginCodeTTL    = time.Minute
+	oauthRandomBytes     = 32
+)
+
+// OAuthConfig configures sign-in with OAuth providers
+type OAuthConfig struct {
+	// Registration creates users for provider accounts matching no user
+	Registration bool
+	// InvitationRequired refuses new users, registration requires an invitation
+	InvitationRequired bool
+	// StateTTL is how long users have to sign in at the provider
+	StateTTL time.Duration
+	// EmailDomains restricts the domains of emails new users are created with, any when nil
+	EmailDomains *EmailDomainPolicy
+}
+
+// ProviderSignIns tells whether a user signed in with an OAuth provider moments ago
+type ProviderSignIns interface {
+	SignedInRecently(ctx context.Context, userID string) (bool, error)
+}
+
+// OAuthService signs users in with the providers of an oauth.Registry
+// Sign-ins start with AuthCodeURL, which sends the user to the provider. The provider redirects
+// back to Callback, which validates the callback with the oauth.StateStore, links the provider account to a user, or creates one, and sends the
+// user back to the client with a one-time login code. Clients exchange the code for tokens with
+// Token, so tokens never appear in URLs.
+//
+// Provider accounts are linked to the user with their verified email, accounts without a
+// verified email can only sign in once linked.
+type OAuthService struct {
+	auth            AuthService
+	userRepo        repository.UserRepository
+	oauthRepo       repository.OAuthProviderRepository
+	emailNormalizer *utils.EmailNormalizer
+	redirects       *RedirectValidator
+	redis           *database.Redis
+	config          OAuthConfig
+	providers       *oauth.Registry
+	states          *oauth.StateStore
+	// tokens stores the tokens of provider accounts on sign-in, nil unless encryption is configured
+	tokens *ProviderTokenService
+}
+
+// NewOAuthService creates an OAuth service signing users in with providers
+func NewOAuthService(
+	auth AuthService,
+	userRepo repository.UserRepository,
+	oauthRepo repository.OAuthProviderRepository,
+	emailNormalizer *utils.EmailNormalizer,
+	redirects *RedirectValidator,
+	redis *database.Redis,
+	config OAuthConfig,
+	providers *oauth.Registry,
+	tokens *ProviderTokenService,
+) *OAuthService {
+	if config.StateTTL <= 0 {
+		config.StateTTL = defaultOAuthStateTTL
+	}
+
+	return &OAuthService{
+		auth:            auth,
+		userRepo:        userRepo,
+		oauthRepo:       oauthRepo,
+		emailNormalizer: emailNormalizer,
+		redirects:       redirects,
+		redis:           redis,
+		config:          config,
+		providers:       providers,
+		states:          oauth.NewStateStore(redis.Client, config.StateTTL),
+		tokens:          tokens,
+	}
+}
+
+// Providers returns the names of the configured providers
+func (s *OAuthService) Providers() []string {
+	return s.providers.Names()
+}
+
+// AuthCodeURL starts a sign-in with a provider and returns the URL of its consent page, along
+// with the binding of the sign-in, which the browser must present on callback
+// The user is sent back to redirectURL, or the default one when empty, once signed in.
+func (s *OAuthService) AuthCodeURL(ctx context.Context, providerName, redirectURL string) (_, _ string, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.AuthCodeURL")
+	defer func() { endSpan(span, err) }()
+
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return "", "", ErrOAuthProviderNotFound
+	}
+	redirectURL, err = s.redirects.Validate(ctx, RedirectFlowOAuthCallback, redirectURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	req, binding, err := s.states.Begin(ctx, providerName, redirectURL)
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err := provider.BeginAuth(ctx, req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start %s sign-in: %w", providerName, err)
+	}
+	return authURL, binding, nil
+}
+
+// Callback completes a sign-in the provider redirected back with the parameters of, in the
+// browser presenting binding. It returns the URL to send the user back to, with a login code on
+// success. The URL is empty when the state is unknown, errors are then to be shown by the
+// service itself.
+func (s *OAuthService) Callback(ctx context.Context, providerName string, params url.Values, binding string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.Callback")
+	defer func() { endSpan(span, err) }()
+
+	pending, callback, err := s.states.Complete(ctx, providerName, params, binding)
+	if err != nil {
+		redirectURL := ""
+		if pending != nil {
+			redirectURL = pending.ReturnURL
+		}
+		if errors.Is(err, oauth.ErrInvalidState) || errors.Is(err, oauth.ErrInvalidCallback) {
+			return redirectURL, fmt.Errorf("%w: %v", ErrInvalidOAuthState, err)
+		}
+		return redirectURL, err
+	}
+	provider, ok := s.providers.Get(pending.Provider)
+	if !ok {
+		return "", ErrInvalidOAuthState
+	}
+
+	userID, err := s.signIn(ctx, provider, callback)
+	if err != nil {
+		return pending.ReturnURL, err
+	}
+
+	loginCode, err := randomToken()
+	if err != nil {
+		return pending.ReturnURL, fmt.Errorf("failed to generate login code: %w", err)
+	}
+	pipe := s.redis.Client.TxPipeline()
+	pipe.Set(ctx, oauthCodeKey+hashOpaqueToken(loginCode), userID, oauthLoginCodeTTL)
+	pipe.Set(ctx, oauthSignInKey+userID, provider.Name(), providerReauthWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return pending.ReturnURL, fmt.Errorf("failed to store login code: %w", err)
+	}
+
+	return withQuery(pending.ReturnURL, "code", loginCode)
+}
+
+// signIn completes the sign-in at the provider and returns the user of the provider account
+func (s *OAuthService) signIn(ctx context.Context, provider oauth.Provider, callback oauth.Callback) (string, error) {
+	token, err := provider.HandleCallback(ctx, callback)
+	if err != nil {
+		if errors.Is(err, oauth.ErrExchangeFailed) {
+			return "", fmt.Errorf("%w: %v", ErrInvalidOAuthState, err)
+		}
+		return "", err
+	}
+	identity, err := provider.FetchIdentity(ctx, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s account: %w", provider.Name(), err)
+	}
+
+	link, err := s.oauthRepo.GetByProvider(ctx, identity.Provider, identity.ID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if link, err = s.link(ctx, identity); err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", fmt.Errorf("failed to get oauth provider: %w", err)
+	}
+
+	if s.tokens != nil {
+		// The sign-in succeeds without the token, first-party apps needing it ask the user to sign in again
+		if err := s.tokens.Store(ctx, link, token); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to store provider token",
+				zap.String("user_id", link.UserID), zap.String("provider", link.Provider), zap.Error(err))
+		}
+	}
+	return link.UserID, nil
+}
+
+// link links a provider account that isn't linked yet to the user of its verified email, or a new user
+func (s *OAuthService) link(ctx context.Context, identity *oauth.Identity) (*domain.OAuthProvider, error) {
+	// Only a verified email proves that the provider account belongs to the user of that email
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOAuthEmailNotVerified
+	}
+	user, err := s.userRepo.GetByEmail(ctx, s.emailNormalizer.Normalize(identity.Email))
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if user, err = s.createUser(ctx, identity); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	case !user.IsEmailVerified:
+		user.IsEmailVerified = true
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to verify email: %w", err)
+		}
+	}
+
+	email := identity.Email
+	link := &domain.OAuthProvider{
+		UserID:         user.ID,
+		Provider:       identity.Provider,
+		ProviderUserID: identity.ID,
+		Email:          &email,
+	}
+	if err := s.oauthRepo.Create(ctx, link); err != nil {
+		return nil, fmt.Errorf("failed to link oauth provider: %w", err)
+	}
+	return link, nil
+}
+
+// createUser creates a user without password for a provider account
+func (s *OAuthService) createUser(ctx context.Context, identity *oauth.Identity) (*domain.User, error) {
+	if !s.config.Registration {
+		return nil, ErrFeatureDisabled
+	}
+	if s.config.InvitationRequired {
+		return nil, ErrInvitationRequired
+	}
+	if err := s.config.EmailDomains.Check(ctx, identity.Email); err != nil {
+		return nil, err
+	}
+
+	user := &domain.User{
+		Email:           utils.SanitizeEmail(identity.Email),
+		EmailNormalized: s.emailNormalizer.Normalize(identity.Email),
+		IsActive:        true,
+		IsEmailVerified: true,
+	}
+	if identity.Name != "" {
+		user.DisplayName = &identity.Name
+	}
+	if identity.AvatarURL != "" {
+		user.AvatarURL = &identity.AvatarURL
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// Token exchanges a login code for the tokens of a new session, each code can be used once
+func (s *OAuthService) Token(ctx context.Context, code string) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "OAuthService.Token")
+	defer func() { endSpan(span, err) }()
+
+	userID, err := s.redis.Client.GetDel(ctx, oauthCodeKey+hashOpaqueToken(code)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidOAuthState
+		}
+		return nil, fmt.Errorf("failed to load login code: %w", err)
+	}
+	return s.auth.IssueSession(ctx, userID)
+}
+
+// SignedInRecently reports whether the user signed in with a provider within providerReauthWindow
+func (s *OAuthService) SignedInRecently(ctx context.Context, userID string) (bool, error) {
+	n, err := s.redis.Client.Exists(ctx, oauthSignInKey+userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check provider sign-in: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RecentSignInProvider returns the provider the user signed in with within providerReauthWindow, or ""
+func (s *OAuthService) RecentSignInProvider(ctx context.Context, userID string) (string, error) {
+	provider, err := s.redis.Client.Get(ctx, oauthSignInKey+userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check provider sign-in: %w", err)
+	}
+	return provider, nil
+}
+
+// randomToken returns a random URL-safe token, e.g. a login code
+func randomToken() (string, error) {
+	buf := make([]byte, oauthRandomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// withQuery returns rawURL with a query parameter set
+func withQuery(rawURL, key, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse redirect url: %w", err)
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,161 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// fakeProvider signs in the identity of the authorization code
+type fakeProvider struct {
+	identities map[string]oauth.Identity
+}
+
+func (p *fakeProvider) Name() string { return oauth.ProviderGitHub }
+
+func (p *fakeProvider) BeginAuth(_ context.Context, req oauth.AuthRequest) (string, error) {
+	return "https://github.test/authorize?state=" + url.QueryEscape(req.State), nil
+}
+
+func (p *fakeProvider) HandleCallback(_ context.Context, callback oauth.Callback) (*oauth.Token, error) {
+	code := callback.Params.Get("code")
+	if _, ok := p.identities[code]; !ok || callback.Nonce == "" || callback.CodeVerifier == "" {
+		return nil, oauth.ErrExchangeFailed
+	}
+	return &oauth.Token{AccessToken: code}, nil
+}
+
+func (p *fakeProvider) FetchIdentity(_ context.Context, token *oauth.Token) (*oauth.Identity, error) {
+	identity := p.identities[token.AccessToken]
+	return &identity, nil
+}
+
+// providerRegistry registers the providers
+func providerRegistry(t *testing.T, providers ...oauth.Provider) *oauth.Registry {
+	t.Helper()
+	registry, err := oauth.NewRegistry(providers...)
+	if err != nil {
+		t.Fatalf("Failed to register providers: %v", err)
+	}
+	return registry
+}
+
+// signInWithProvider runs a sign-in with the code and returns the URL the user is sent back to
+func signInWithProvider(t *testing.T, oauthService *service.OAuthService, code string) (*url.URL, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	authURL, binding, err := oauthService.AuthCodeURL(ctx, oauth.ProviderGitHub, "https://app.example.test/oauth")
+	if err != nil {
+		t.Fatalf("Failed to start sign-in: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	redirectURL, err := oauthService.Callback(ctx, oauth.ProviderGitHub, url.Values{"code": {code}, "state": {parsed.Query().Get("state")}}, binding)
+	if redirectURL == "" {
+		t.Fatalf("Expected a redirect URL, got error %v", err)
+	}
+	returned, _ := url.Parse(redirectURL)
+	return returned, err
+}
+
+func TestOAuthServiceSignIn(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	provider := &fakeProvider{identities: map[string]oauth.Identity{
+		"new":        {Provider: oauth.ProviderGitHub, ID: "1", Email: "new@example.com", EmailVerified: true, Name: "New User"},
+		"existing":   {Provider: oauth.ProviderGitHub, ID: "2", Email: "Existing@example.com", EmailVerified: true},
+		"unverified": {Provider: oauth.ProviderGitHub, ID: "3", Email: "other@example.com"},
+	}}
+	oauthService := service.NewOAuthService(env.Service, env.Repos.User, env.Repos.OAuthProvider, utils.NewEmailNormalizer(nil, nil),
+		service.NewRedirectValidator([]string{"https://app.example.test"}), env.Redis, service.OAuthConfig{Registration: true}, providerRegistry(t, provider), nil)
+
+	existing := &domain.User{Email: "existing@example.com", EmailNormalized: "existing@example.com", IsActive: true}
+	if err := env.Repos.User.Create(ctx, existing); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if _, _, err := oauthService.AuthCodeURL(ctx, "facebook", ""); !errors.Is(err, service.ErrOAuthProviderNotFound) {
+		t.Errorf("Expected ErrOAuthProviderNotFound, got %v", err)
+	}
+	if _, err := oauthService.Callback(ctx, oauth.ProviderGitHub, url.Values{"code": {"new"}, "state": {"forged"}}, ""); !errors.Is(err, service.ErrInvalidOAuthState) {
+		t.Errorf("Expected ErrInvalidOAuthState for an unknown state, got %v", err)
+	}
+
+	// Callbacks must come from the browser that started the sign-in
+	authURL, _, err := oauthService.AuthCodeURL(ctx, oauth.ProviderGitHub, "")
+	if err != nil {
+		t.Fatalf("Failed to start sign-in: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if redirectURL, err := oauthService.Callback(ctx, oauth.ProviderGitHub, url.Values{"code": {"new"}, "state": {parsed.Query().Get("state")}}, "attacker"); redirectURL != "" || !errors.Is(err, service.ErrInvalidOAuthState) {
+		t.Errorf("Expected ErrInvalidOAuthState for another browser, got %q %v", redirectURL, err)
+	}
+
+	// A new user is created, signed in with a one-time login code
+	returned, err := signInWithProvider(t, oauthService, "new")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	code := returned.Query().Get("code")
+	response, err := oauthService.Token(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to exchange login code: %v", err)
+	}
+	created, err := env.Repos.User.GetByID(ctx, response.AuthResponse.User.ID)
+	if err != nil || created.Email != "new@example.com" || !created.IsEmailVerified || created.PasswordHash != "" {
+		t.Errorf("Expected a verified new user without password, got %+v (%v)", created, err)
+	}
+	if _, err := oauthService.Token(ctx, code); !errors.Is(err, service.ErrInvalidOAuthState) {
+		t.Errorf("Expected login codes to be single use, got %v", err)
+	}
+	if recent, err := oauthService.SignedInRecently(ctx, response.AuthResponse.User.ID); err != nil || !recent {
+		t.Errorf("Expected a recent provider sign-in, got %v (%v)", recent, err)
+	}
+
+	// The account of a verified email is linked and its email verified
+	returned, err = signInWithProvider(t, oauthService, "existing")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	if response, err = oauthService.Token(ctx, returned.Query().Get("code")); err != nil {
+		t.Fatalf("Failed to exchange login code: %v", err)
+	}
+	if response.AuthResponse.User.ID != existing.ID {
+		t.Errorf("Expected the existing user, got %+v", response.AuthResponse.User)
+	}
+	if user, err := env.Repos.User.GetByID(ctx, existing.ID); err != nil || !user.IsEmailVerified {
+		t.Errorf("Expected the email to be verified, got %+v (%v)", user, err)
+	}
+	link, err := env.Repos.OAuthProvider.GetByProvider(ctx, oauth.ProviderGitHub, "2")
+	if err != nil || link.UserID != existing.ID {
+		t.Errorf("Expected the provider account to be linked, got %+v (%v)", link, err)
+	}
+
+	// Unverified emails can't be linked
+	if _, err := signInWithProvider(t, oauthService, "unverified"); !errors.Is(err, service.ErrOAuthEmailNotVerified) {
+		t.Errorf("Expected ErrOAuthEmailNotVerified, got %v", err)
+	}
+	if _, err := signInWithProvider(t, oauthService, "rejected"); !errors.Is(err, service.ErrInvalidOAuthState) {
+		t.Errorf("Expected ErrInvalidOAuthState for a rejected code, got %v", err)
+	}
+}
+
+func TestOAuthServiceRegistrationDisabled(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+	provider := &fakeProvider{identities: map[string]oauth.Identity{
+		"new": {Provider: oauth.ProviderGitHub, ID: "1", Email: "new@example.com", EmailVerified: true},
+	}}
+	oauthService := service.NewOAuthService(env.Service, env.Repos.User, env.Repos.OAuthProvider, utils.NewEmailNormalizer(nil, nil),
+		service.NewRedirectValidator([]string{"https://app.example.test"}), env.Redis, service.OAuthConfig{Registration: true, InvitationRequired: true}, providerRegistry(t, provider), nil)
+
+	if _, err := signInWithProvider(t, oauthService, "new"); !errors.Is(err, service.ErrInvitationRequired) {
+		t.Errorf("Expected ErrInvitationRequired, got %v", err)
+	}
+}
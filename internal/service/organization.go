@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// OrganizationMembership is an organization along with the role of a user in it
+type OrganizationMembership struct {
+	Organization *domain.Organization
+	Membership   *domain.Membership
+}
+
+// Member is a membership along with the email of the member
+type Member struct {
+	*domain.Membership
+	Email string
+}
+
+// AddedMember is the result of adding a member by email
+// Existing users become members right away, others are invited: Invitation and Token are set
+// and the user joins when registering with the invitation.
+type AddedMember struct {
+	Member     *Member
+	Invitation *domain.Invitation
+	Token      string
+}
+
+// OrganizationService manages organizations and their members
+// Owners and admins manage members, only owners grant or revoke the owner role and an
+// organization always keeps an owner. Access tokens carry the org_id and org_role claims
+// of the oldest membership of the user, Token issues one scoped to another organization.
+type OrganizationService struct {
+	repo            repository.OrganizationRepository
+	userRepo        repository.UserRepository
+	invitations     *InvitationService
+	emailNormalizer *utils.EmailNormalizer
+	accessTokens    AccessTokenStrategy
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(
+	repo repository.OrganizationRepository,
+	userRepo repository.UserRepository,
+	invitations *InvitationService,
+	emailNormalizer *utils.EmailNormalizer,
+	accessTokens AccessTokenStrategy,
+) *OrganizationService {
+	return &OrganizationService{
+		repo:            repo,
+		userRepo:        userRepo,
+		invitations:     invitations,
+		emailNormalizer: emailNormalizer,
+		accessTokens:    accessTokens,
+	}
+}
+
+// Create creates an organization owned by userID
+func (s *OrganizationService) Create(ctx context.Context, name, userID string) (_ *OrganizationMembership, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.Create")
+	defer func() { endSpan(span, err) }()
+
+	org := &domain.Organization{Name: name}
+	if err := s.repo.Create(ctx, org); err != nil {
+		return nil, err
+	}
+
+	owner := &domain.Membership{OrgID: org.ID, UserID: userID, Role: domain.OrgRoleOwner}
+	if err := s.repo.AddMember(ctx, owner); err != nil {
+		// Don't leave an organization without owner behind
+		if deleteErr := s.repo.Delete(context.WithoutCancel(ctx), org.ID); deleteErr != nil {
+			return nil, errors.Join(err, fmt.Errorf("failed to delete organization: %w", deleteErr))
+		}
+		return nil, err
+	}
+
+	return &OrganizationMembership{Organization: org, Membership: owner}, nil
+}
+
+// List returns the organizations of a user, oldest membership first
+func (s *OrganizationService) List(ctx context.Context, userID string) (_ []OrganizationMembership, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.List")
+	defer func() { endSpan(span, err) }()
+
+	memberships, err := s.repo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]OrganizationMembership, 0, len(memberships))
+	for _, membership := range memberships {
+		org, err := s.repo.GetByID(ctx, membership.OrgID)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, OrganizationMembership{Organization: org, Membership: membership})
+	}
+	return orgs, nil
+}
+
+// Members returns the members of an organization to one of its members
+func (s *OrganizationService) Members(ctx context.Context, orgID, userID string) (_ []*Member, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.Members")
+	defer func() { endSpan(span, err) }()
+
+	if _, err := s.membership(ctx, orgID, userID); err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.repo.ListMembers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]*Member, 0, len(memberships))
+	for _, membership := range memberships {
+		member, err := s.member(ctx, membership)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// AddMember adds the user with email to an organization, or invites the email when there is no such user
+func (s *OrganizationService) AddMember(ctx context.Context, orgID, actorID, email, role string) (_ *AddedMember, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.AddMember")
+	defer func() { endSpan(span, err) }()
+
+	actor, err := s.membership(ctx, orgID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if !actor.CanManageMembers() || (role == domain.OrgRoleOwner && actor.Role != domain.OrgRoleOwner) {
+		return nil, ErrOrgPermissionDenied
+	}
+	if !utils.ValidateEmail(email) {
+		return nil, ErrInvalidEmail
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, s.emailNormalizer.Normalize(email))
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+
+		invitation, token, err := s.invitations.Create(ctx, CreateInvitation{
+			Email:     email,
+			Role:      &role,
+			Tenant:    &orgID,
+			InvitedBy: actorID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &AddedMember{Invitation: invitation, Token: token}, nil
+	}
+
+	membership := &domain.Membership{OrgID: orgID, UserID: user.ID, Role: role}
+	if err := s.repo.AddMember(ctx, membership); err != nil {
+		if errors.Is(err, repository.ErrDuplicateMembership) {
+			return nil, ErrAlreadyMember
+		}
+		return nil, err
+	}
+	return &AddedMember{Member: &Member{Membership: membership, Email: user.Email}}, nil
+}
+
+// UpdateMemberRole changes the role of a member
+func (s *OrganizationService) UpdateMemberRole(ctx context.Context, orgID, actorID, userID, role string) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.UpdateMemberRole")
+	defer func() { endSpan(span, err) }()
+
+	actor, target, err := s.manage(ctx, orgID, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if !actor.CanManageMembers() || (role == domain.OrgRoleOwner && actor.Role != domain.OrgRoleOwner) {
+		return ErrOrgPermissionDenied
+	}
+	if target.Role == domain.OrgRoleOwner && role != domain.OrgRoleOwner {
+		if err := s.requireAnotherOwner(ctx, orgID, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.UpdateMemberRole(ctx, orgID, userID, role); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrMemberNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveMember removes a member from an organization, any member can leave by removing themselves
+func (s *OrganizationService) RemoveMember(ctx context.Context, orgID, actorID, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.RemoveMember")
+	defer func() { endSpan(span, err) }()
+
+	actor, target, err := s.manage(ctx, orgID, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if actorID != userID && !actor.CanManageMembers() {
+		return ErrOrgPermissionDenied
+	}
+	if target.Role == domain.OrgRoleOwner {
+		if err := s.requireAnotherOwner(ctx, orgID, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.RemoveMember(ctx, orgID, userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrMemberNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Token issues an access token scoped to an organization of the user
+func (s *OrganizationService) Token(ctx context.Context, orgID, userID string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "OrganizationService.Token")
+	defer func() { endSpan(span, err) }()
+
+	membership, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := s.accessTokens.Issue(ctx, user, membership)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+	return token, nil
+}
+
+// AccessTokenExpiry returns the access token expiry in seconds
+func (s *OrganizationService) AccessTokenExpiry() int {
+	return s.accessTokens.ExpiresIn()
+}
+
+// DefaultMembership returns the oldest membership of a user, nil when the user has none
+func (s *OrganizationService) DefaultMembership(ctx context.Context, userID string) (*domain.Membership, error) {
+	memberships, err := s.repo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return nil, nil
+	}
+	return memberships[0], nil
+}
+
+// AcceptInvitation joins a user registering with an invitation to the organization of its tenant
+// It is an InvitationService.OnAccept hook, invitations whose tenant isn't an organization are ignored.
+func (s *OrganizationService) AcceptInvitation(ctx context.Context, invitation *domain.Invitation, userID string) error {
+	if invitation.Tenant == nil {
+		return nil
+	}
+	if _, err := s.repo.GetByID(ctx, *invitation.Tenant); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	role := domain.OrgRoleMember
+	if invitation.Role != nil && domain.IsValidOrgRole(*invitation.Role) {
+		role = *invitation.Role
+	}
+	if err := s.repo.AddMember(ctx, &domain.Membership{OrgID: *invitation.Tenant, UserID: userID, Role: role}); err != nil {
+		return fmt.Errorf("failed to join organization: %w", err)
+	}
+	return nil
+}
+
+// DeleteMemberships deletes the memberships of a user, it is an erasure step
+func (s *OrganizationService) DeleteMemberships(ctx context.Context, userID string) error {
+	return s.repo.DeleteMemberships(ctx, userID)
+}
+
+// membership returns the membership of a user, ErrOrganizationNotFound when the user
+// isn't a member so that non-members can't tell which organizations exist
+func (s *OrganizationService) membership(ctx context.Context, orgID, userID string) (*domain.Membership, error) {
+	membership, err := s.repo.GetMember(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return membership, nil
+}
+
+// manage returns the memberships of the acting user and of the member acted upon
+func (s *OrganizationService) manage(ctx context.Context, orgID, actorID, userID string) (actor, target *domain.Membership, err error) {
+	actor, err = s.membership(ctx, orgID, actorID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target, err = s.repo.GetMember(ctx, orgID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrMemberNotFound
+		}
+		return nil, nil, err
+	}
+	if target.Role == domain.OrgRoleOwner && actorID != userID && actor.Role != domain.OrgRoleOwner {
+		return nil, nil, ErrOrgPermissionDenied
+	}
+	return actor, target, nil
+}
+
+// requireAnotherOwner returns ErrLastOwner unless the organization has an owner besides userID
+func (s *OrganizationService) requireAnotherOwner(ctx context.Context, orgID, userID string) error {
+	members, err := s.repo.ListMembers(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.Role == domain.OrgRoleOwner && member.UserID != userID {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
+
+// member adds the email of the user to a membership
+func (s *OrganizationService) member(ctx context.Context, membership *domain.Membership) (*Member, error) {
+	user, err := s.userRepo.GetByID(ctx, membership.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	return &Member{Membership: membership, Email: user.Email}, nil
+}
@@ -0,0 +1,151 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// registerUser registers a user and returns its ID
+func registerUser(t *testing.T, auth service.AuthService, email string) string {
+	t.Helper()
+
+	registered, err := auth.Register(context.Background(), &dto.RegisterRequest{Email: email, Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register %s: %v", email, err)
+	}
+	return registered.AuthResponse.User.ID
+}
+
+func TestOrganizationMembers(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{TTL: time.Hour})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+
+	ownerID := registerUser(t, env.Service, "owner@example.com")
+	adminID := registerUser(t, env.Service, "admin@example.com")
+	memberID := registerUser(t, env.Service, "member@example.com")
+
+	created, err := orgs.Create(ctx, "Acme", ownerID)
+	if err != nil {
+		t.Fatalf("Failed to create organization: %v", err)
+	}
+	orgID := created.Organization.ID
+	if created.Membership.Role != domain.OrgRoleOwner {
+		t.Errorf("Expected the creator to own the organization, got %s", created.Membership.Role)
+	}
+
+	if _, err := orgs.AddMember(ctx, orgID, ownerID, "Admin@Example.com", domain.OrgRoleAdmin); err != nil {
+		t.Fatalf("Failed to add admin: %v", err)
+	}
+	if _, err := orgs.AddMember(ctx, orgID, adminID, "member@example.com", domain.OrgRoleOwner); !errors.Is(err, service.ErrOrgPermissionDenied) {
+		t.Errorf("Expected admins not to add owners, got %v", err)
+	}
+	if _, err := orgs.AddMember(ctx, orgID, adminID, "member@example.com", domain.OrgRoleMember); err != nil {
+		t.Fatalf("Failed to add member: %v", err)
+	}
+	if _, err := orgs.AddMember(ctx, orgID, adminID, "member@example.com", domain.OrgRoleMember); !errors.Is(err, service.ErrAlreadyMember) {
+		t.Errorf("Expected ErrAlreadyMember, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "member adds", err: second(orgs.AddMember(ctx, orgID, memberID, "other@example.com", domain.OrgRoleMember)), want: service.ErrOrgPermissionDenied},
+		{name: "member promotes itself", err: orgs.UpdateMemberRole(ctx, orgID, memberID, memberID, domain.OrgRoleAdmin), want: service.ErrOrgPermissionDenied},
+		{name: "admin demotes owner", err: orgs.UpdateMemberRole(ctx, orgID, adminID, ownerID, domain.OrgRoleMember), want: service.ErrOrgPermissionDenied},
+		{name: "admin removes owner", err: orgs.RemoveMember(ctx, orgID, adminID, ownerID), want: service.ErrOrgPermissionDenied},
+		{name: "last owner leaves", err: orgs.RemoveMember(ctx, orgID, ownerID, ownerID), want: service.ErrLastOwner},
+		{name: "last owner demoted", err: orgs.UpdateMemberRole(ctx, orgID, ownerID, ownerID, domain.OrgRoleAdmin), want: service.ErrLastOwner},
+		{name: "non-member lists", err: second(orgs.Members(ctx, orgID, "stranger")), want: service.ErrOrganizationNotFound},
+		{name: "unknown member", err: orgs.RemoveMember(ctx, orgID, ownerID, "stranger"), want: service.ErrMemberNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, tt.err)
+			}
+		})
+	}
+
+	// A second owner allows the first one to step down
+	if err := orgs.UpdateMemberRole(ctx, orgID, ownerID, adminID, domain.OrgRoleOwner); err != nil {
+		t.Fatalf("Failed to promote admin: %v", err)
+	}
+	if err := orgs.UpdateMemberRole(ctx, orgID, ownerID, ownerID, domain.OrgRoleMember); err != nil {
+		t.Fatalf("Failed to step down: %v", err)
+	}
+	if err := orgs.RemoveMember(ctx, orgID, memberID, memberID); err != nil {
+		t.Fatalf("Failed to leave organization: %v", err)
+	}
+
+	members, err := orgs.Members(ctx, orgID, ownerID)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("Expected 2 members, got %d %v", len(members), err)
+	}
+	if members[0].UserID != ownerID || members[0].Role != domain.OrgRoleMember || members[1].Email != "admin@example.com" || members[1].Role != domain.OrgRoleOwner {
+		t.Errorf("Unexpected members %+v %+v", members[0], members[1])
+	}
+}
+
+func TestOrganizationClaims(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{TTL: time.Hour})
+	auth := newAuthService(env, nil, invitations)
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+
+	ownerID := registerUser(t, auth, "owner@example.com")
+	firstOrg, _ := orgs.Create(ctx, "First", ownerID)
+	secondOrg, _ := orgs.Create(ctx, "Second", ownerID)
+
+	// Tokens are scoped to the oldest organization by default
+	login, err := auth.Login(ctx, &dto.LoginRequest{Identifier: "owner@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	claims, err := env.JWT.ValidateToken(login.AuthResponse.AccessToken)
+	if err != nil || claims.OrgID != firstOrg.Organization.ID || claims.OrgRole != domain.OrgRoleOwner {
+		t.Errorf("Expected the claims of the first organization, got %+v %v", claims, err)
+	}
+
+	token, err := orgs.Token(ctx, secondOrg.Organization.ID, ownerID)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if claims, _ := env.JWT.ValidateToken(token); claims.OrgID != secondOrg.Organization.ID || claims.UserID != ownerID {
+		t.Errorf("Expected the claims of the second organization, got %+v", claims)
+	}
+	if _, err := orgs.Token(ctx, secondOrg.Organization.ID, "stranger"); !errors.Is(err, service.ErrOrganizationNotFound) {
+		t.Errorf("Expected non-members not to get tokens, got %v", err)
+	}
+
+	// Emails without account are invited and join when registering
+	added, err := orgs.AddMember(ctx, secondOrg.Organization.ID, ownerID, "new@example.com", domain.OrgRoleAdmin)
+	if err != nil || added.Member != nil || added.Token == "" {
+		t.Fatalf("Expected an invitation, got %+v %v", added, err)
+	}
+	registered, err := auth.RegisterWithInvitation(ctx, added.Token, &dto.RegisterWithInvitationRequest{Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register with invitation: %v", err)
+	}
+	claims, _ = env.JWT.ValidateToken(registered.AuthResponse.AccessToken)
+	if claims.OrgID != secondOrg.Organization.ID || claims.OrgRole != domain.OrgRoleAdmin {
+		t.Errorf("Expected the invited user to join as admin, got %+v", claims)
+	}
+}
+
+// second returns the error of a call returning a value and an error
+func second[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+)
+
+// providerReauthWindow is how long after signing in with an OAuth provider a user without a
+// verified email may set a password
+const providerReauthWindow = 10 * time.Minute
+
+// PasswordService lets users who signed up with an OAuth provider add a password, so they can
+// also log in with their email and password
+type PasswordService struct {
+	userRepo repository.UserRepository
+	signIns  ProviderSignIns
+	hasher   *PasswordHasher
+	auditor  observability.Auditor
+	hooks    []PasswordHook
+}
+
+// PasswordHook is run after the password of a user changed
+type PasswordHook func(ctx context.Context, userID string)
+
+// NewPasswordService creates a password service
+func NewPasswordService(
+	userRepo repository.UserRepository,
+	signIns ProviderSignIns,
+	hasher *PasswordHasher,
+	auditor observability.Auditor,
+) *PasswordService {
+	return &PasswordService{
+		userRepo: userRepo,
+		signIns:  signIns,
+		hasher:   hasher,
+		auditor:  auditorOrNop(auditor),
+	}
+}
+
+// OnPasswordChange adds a hook run after the password of a user changed
+// Hooks must be added before the service is used.
+func (s *PasswordService) OnPasswordChange(hook PasswordHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// SetPassword sets the first password of a user, accounts that have one already must change it
+// instead. Without a verified email the user must have signed in with a provider moments ago,
+// so a stolen access token alone can't take over the account.
+func (s *PasswordService) SetPassword(ctx context.Context, userID, password string) (err error) {
+	ctx, span := tracer.Start(ctx, "PasswordService.SetPassword")
+	defer func() { endSpan(span, err) }()
+
+	if err := checkPasswordPolicy(password); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.PasswordHash != "" {
+		return ErrPasswordAlreadySet
+	}
+	if !user.IsEmailVerified {
+		recent, err := s.signIns.SignedInRecently(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !recent {
+			return ErrReauthenticationRequired
+		}
+	}
+
+	passwordHash, err := s.hasher.Hash(ctx, password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	user.PasswordHash = passwordHash
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+
+	event := newAuditEvent(ctx, AuditPasswordSet, observability.AuditOutcomeSuccess)
+	event.UserID = userID
+	s.auditor.Audit(ctx, event)
+
+	for _, hook := range s.hooks {
+		hook(ctx, userID)
+	}
+	return nil
+}
+
+// PasswordPolicyError is returned when a password breaks the password policy, it wraps ErrWeakPassword
+type PasswordPolicyError struct {
+	// Rules are the utils.PasswordRule* rules the password breaks
+	Rules []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error()
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// checkPasswordPolicy returns a *PasswordPolicyError if a password breaks the password policy
+func checkPasswordPolicy(password string) error {
+	if rules := utils.PasswordPolicyViolations(password); len(rules) > 0 {
+		return &PasswordPolicyError{Rules: rules}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var meter = otel.Meter("github.com/prperemyshlev/auth-service-2/internal/service")
+
+// PasswordHasher runs bcrypt with bounded concurrency
+// A burst of logins would otherwise occupy every CPU with hashing and starve other requests.
+// Calls wait for a free slot while fewer than maxQueue others do, beyond that they fail fast
+// with ErrServerBusy.
+// Besides bcrypt, hashes of other systems are verified by a chain of legacy verifiers, so that
+// imported users keep their passwords until NeedsRehash hashes them again on login.
+type PasswordHasher struct {
+	cost     int
+	legacy   *utils.HashVerifierChain
+	slots    chan struct{}
+	maxQueue int64
+	waiting  atomic.Int64
+
+	queued   metric.Int64UpDownCounter
+	active   metric.Int64UpDownCounter
+	rejected metric.Int64Counter
+	wait     metric.Float64Histogram
+}
+
+// NewPasswordHasher creates a hasher running at most concurrency bcrypt operations at once,
+// concurrency 0 uses the number of CPUs
+func NewPasswordHasher(cost, concurrency, maxQueue int) *PasswordHasher {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	h := &PasswordHasher{
+		cost:     cost,
+		legacy:   utils.NewHashVerifierChain(utils.LegacyHashVerifiers()...),
+		slots:    make(chan struct{}, concurrency),
+		maxQueue: int64(maxQueue),
+	}
+
+	var err error
+	if h.queued, err = meter.Int64UpDownCounter("auth.password_hashing.queued",
+		metric.WithDescription("Number of password hashing operations waiting for a free slot"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create queued gauge: %w", err))
+	}
+	if h.active, err = meter.Int64UpDownCounter("auth.password_hashing.active",
+		metric.WithDescription("Number of password hashing operations running"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create active gauge: %w", err))
+	}
+	if h.rejected, err = meter.Int64Counter("auth.password_hashing.rejected",
+		metric.WithDescription("Number of password hashing operations rejected because the queue was full"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create rejected counter: %w", err))
+	}
+	if h.wait, err = meter.Float64Histogram("auth.password_hashing.wait",
+		metric.WithDescription("Time password hashing operations waited for a free slot"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create wait histogram: %w", err))
+	}
+
+	return h
+}
+
+// Hash hashes a password once a slot is free
+func (h *PasswordHasher) Hash(ctx context.Context, password string) (string, error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	return utils.HashPassword(password, h.cost)
+}
+
+// Check compares a password with a hash once a slot is free
+func (h *PasswordHasher) Check(ctx context.Context, password, hash string) (bool, error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	if !utils.IsBcryptHash(hash) && h.legacy.Supports(hash) {
+		return h.legacy.Verify(password, hash)
+	}
+	return utils.CheckPasswordHash(password, hash), nil
+}
+
+// Supports reports whether hash is a bcrypt hash or of a legacy format that can be verified
+func (h *PasswordHasher) Supports(hash string) bool {
+	return utils.IsBcryptHash(hash) || h.legacy.Supports(hash)
+}
+
+// NeedsRehash reports whether a hash of a legacy format should be replaced by a bcrypt hash
+// Empty hashes of users without password are left as they are.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	return hash != "" && !utils.IsBcryptHash(hash)
+}
+
+// acquire takes a slot, waiting for one unless the queue is full or ctx is done
+func (h *PasswordHasher) acquire(ctx context.Context) (func(), error) {
+	select {
+	case h.slots <- struct{}{}:
+		return h.start(ctx), nil
+	default:
+	}
+
+	if h.waiting.Add(1) > h.maxQueue {
+		h.waiting.Add(-1)
+		h.rejected.Add(ctx, 1)
+		return nil, ErrServerBusy
+	}
+	defer h.waiting.Add(-1)
+
+	h.queued.Add(ctx, 1)
+	defer h.queued.Add(ctx, -1)
+
+	start := time.Now()
+	select {
+	case h.slots <- struct{}{}:
+		h.wait.Record(ctx, time.Since(start).Seconds())
+		return h.start(ctx), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// start records a running operation and returns the function releasing its slot
+func (h *PasswordHasher) start(ctx context.Context) func() {
+	h.active.Add(ctx, 1)
+	return func() {
+		h.active.Add(context.WithoutCancel(ctx), -1)
+		<-h.slots
+	}
+}
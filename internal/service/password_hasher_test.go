@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	ctx := context.Background()
+	hasher := NewPasswordHasher(bcrypt.MinCost, 1, 1)
+
+	hash, err := hasher.Hash(ctx, "Password123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if valid, err := hasher.Check(ctx, "Password123", hash); err != nil || !valid {
+		t.Fatalf("Expected the password to match, got %v %v", valid, err)
+	}
+
+	// Occupy the only slot, one caller may wait for it and the next one is rejected
+	release, err := hasher.acquire(ctx)
+	if err != nil {
+		t.Fatalf("Failed to acquire a slot: %v", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := hasher.Hash(timeoutCtx, "Password123"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected waiting to stop with the context, got %v", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := hasher.Check(ctx, "Password123", hash)
+		waited <- err
+	}()
+	for hasher.waiting.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := hasher.Hash(ctx, "Password123"); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("Expected ErrServerBusy with a full queue, got %v", err)
+	}
+
+	release()
+	if err := <-waited; err != nil {
+		t.Errorf("Expected the queued check to run once the slot was released, got %v", err)
+	}
+}
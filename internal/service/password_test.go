@@ -0,0 +1,67 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// signIns reports the users in it as signed in with a provider moments ago
+type signIns map[string]bool
+
+func (s signIns) SignedInRecently(_ context.Context, userID string) (bool, error) {
+	return s[userID], nil
+}
+
+func TestPasswordServiceSetPassword(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	recent := signIns{}
+	passwords := service.NewPasswordService(env.Repos.User, recent, service.NewPasswordHasher(bcrypt.MinCost, 0, 100), nil)
+
+	// Signed up with a provider a while ago, without a verified email
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com", IsActive: true}
+	if err := env.Repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	if err := passwords.SetPassword(ctx, user.ID, "weak"); !errors.Is(err, service.ErrWeakPassword) {
+		t.Errorf("Expected ErrWeakPassword, got %v", err)
+	}
+	if err := passwords.SetPassword(ctx, user.ID, "Password123"); !errors.Is(err, service.ErrReauthenticationRequired) {
+		t.Fatalf("Expected ErrReauthenticationRequired without a recent provider sign-in, got %v", err)
+	}
+
+	// Signing in with the provider again moments ago is enough
+	recent[user.ID] = true
+	if err := passwords.SetPassword(ctx, user.ID, "Password123"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}); err != nil {
+		t.Errorf("Expected to log in with the new password, got %v", err)
+	}
+
+	if err := passwords.SetPassword(ctx, user.ID, "Password456"); !errors.Is(err, service.ErrPasswordAlreadySet) {
+		t.Errorf("Expected ErrPasswordAlreadySet, got %v", err)
+	}
+}
+
+func TestPasswordServiceSetPasswordVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	passwords := service.NewPasswordService(env.Repos.User, signIns{}, service.NewPasswordHasher(bcrypt.MinCost, 0, 100), nil)
+
+	user := &domain.User{Email: "user@example.com", EmailNormalized: "user@example.com", IsActive: true, IsEmailVerified: true}
+	if err := env.Repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := passwords.SetPassword(ctx, user.ID, "Password123"); err != nil {
+		t.Fatalf("Expected a verified email to allow setting a password, got %v", err)
+	}
+}
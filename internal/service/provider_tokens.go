@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/encryption"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// providerTokenRefreshLeeway refreshes access tokens expiring within it, so that callers have
+// time to use the token they get
+const providerTokenRefreshLeeway = time.Minute
+
+// ProviderTokenService keeps the tokens of linked provider accounts, so that first-party apps can
+// call the API of the provider on behalf of the user, e.g. a calendar
+// Tokens are stored encrypted on the oauth_providers record of the account, expired access
+// tokens are refreshed on demand with the refresh token of providers implementing oauth.Refresher.
+type ProviderTokenService struct {
+	repo      repository.OAuthProviderRepository
+	enc       *encryption.Encryptor
+	providers *oauth.Registry
+}
+
+// NewProviderTokenService creates a provider token service encrypting tokens with enc
+func NewProviderTokenService(repo repository.OAuthProviderRepository, enc *encryption.Encryptor, providers *oauth.Registry) *ProviderTokenService {
+	return &ProviderTokenService{repo: repo, enc: enc, providers: providers}
+}
+
+// Store encrypts token and stores it on link, replacing the stored one
+func (s *ProviderTokenService) Store(ctx context.Context, link *domain.OAuthProvider, token *oauth.Token) (err error) {
+	ctx, span := tracer.Start(ctx, "ProviderTokenService.Store")
+	defer func() { endSpan(span, err) }()
+
+	accessToken, err := s.enc.Encrypt(ctx, token.AccessToken, providerAccessTokenData(link.ID))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	link.AccessToken = &accessToken
+
+	link.RefreshToken = nil
+	if token.RefreshToken != "" {
+		refreshToken, err := s.enc.Encrypt(ctx, token.RefreshToken, providerRefreshTokenData(link.ID))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt refresh token: %w", err)
+		}
+		link.RefreshToken = &refreshToken
+	}
+
+	link.TokenExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiresAt := token.Expiry
+		link.TokenExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.UpdateTokens(ctx, link); err != nil {
+		return fmt.Errorf("failed to store provider tokens: %w", err)
+	}
+	return nil
+}
+
+// Token returns an access token of the account of the provider linked to the user, refreshing
+// the stored one if it expired
+func (s *ProviderTokenService) Token(ctx context.Context, userID, providerName string) (_ *oauth.Token, err error) {
+	ctx, span := tracer.Start(ctx, "ProviderTokenService.Token")
+	defer func() { endSpan(span, err) }()
+
+	provider, ok := s.providers.Get(providerName)
+	if !ok {
+		return nil, ErrOAuthProviderNotFound
+	}
+	link, err := s.link(ctx, userID, providerName)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.decrypt(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	if token.Expiry.IsZero() || time.Until(token.Expiry) > providerTokenRefreshLeeway {
+		return token, nil
+	}
+
+	refresher, ok := provider.(oauth.Refresher)
+	if !ok || token.RefreshToken == "" {
+		return nil, fmt.Errorf("%w: the access token expired", ErrProviderTokenUnavailable)
+	}
+	refreshed, err := refresher.Refresh(ctx, token)
+	if errors.Is(err, oauth.ErrExchangeFailed) {
+		// Another request may have refreshed the token first, and providers rotating
+		// refresh tokens reject the one it used
+		if current, reloadErr := s.reload(ctx, userID, providerName, link); reloadErr == nil && current != nil {
+			return current, nil
+		}
+		return nil, fmt.Errorf("%w: %v", ErrProviderTokenUnavailable, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh %s token: %w", providerName, err)
+	}
+
+	if err := s.Store(ctx, link, refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// link returns the account of the provider linked to the user
+func (s *ProviderTokenService) link(ctx context.Context, userID, providerName string) (*domain.OAuthProvider, error) {
+	links, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth providers: %w", err)
+	}
+	for _, link := range links {
+		if link.Provider == providerName {
+			return link, nil
+		}
+	}
+	return nil, ErrOAuthProviderNotLinked
+}
+
+// reload returns the stored token if it was replaced since stale was read and is still valid
+func (s *ProviderTokenService) reload(ctx context.Context, userID, providerName string, stale *domain.OAuthProvider) (*oauth.Token, error) {
+	link, err := s.link(ctx, userID, providerName)
+	if err != nil {
+		return nil, err
+	}
+	if link.ID != stale.ID || link.AccessToken == nil || stale.AccessToken == nil || *link.AccessToken == *stale.AccessToken {
+		return nil, nil
+	}
+	token, err := s.decrypt(ctx, link)
+	if err != nil || (!token.Expiry.IsZero() && time.Until(token.Expiry) <= 0) {
+		return nil, err
+	}
+	return token, nil
+}
+
+// decrypt returns the stored token of link
+func (s *ProviderTokenService) decrypt(ctx context.Context, link *domain.OAuthProvider) (*oauth.Token, error) {
+	if link.AccessToken == nil {
+		return nil, fmt.Errorf("%w: no token is stored, sign in with the provider again", ErrProviderTokenUnavailable)
+	}
+
+	accessToken, err := s.enc.Decrypt(ctx, *link.AccessToken, providerAccessTokenData(link.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt access token: %w", err)
+	}
+	token := &oauth.Token{AccessToken: accessToken, TokenType: "Bearer"}
+	if link.RefreshToken != nil {
+		if token.RefreshToken, err = s.enc.Decrypt(ctx, *link.RefreshToken, providerRefreshTokenData(link.ID)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt refresh token: %w", err)
+		}
+	}
+	if link.TokenExpiresAt != nil {
+		token.Expiry = *link.TokenExpiresAt
+	}
+	return token, nil
+}
+
+// providerTokenReencryption re-encrypts the stored tokens of provider accounts
+type providerTokenReencryption struct {
+	repo repository.OAuthProviderRepository
+}
+
+// NewProviderTokenReencryption creates the ReencryptionTarget of the tokens stored by ProviderTokenService
+func NewProviderTokenReencryption(repo repository.OAuthProviderRepository) ReencryptionTarget {
+	return &providerTokenReencryption{repo: repo}
+}
+
+// Name returns the columns re-encrypted
+func (r *providerTokenReencryption) Name() string {
+	return "oauth_providers.tokens"
+}
+
+// Reencrypt re-encrypts the tokens of up to batch provider accounts
+func (r *providerTokenReencryption) Reencrypt(ctx context.Context, enc *encryption.Encryptor, batch int) (int, error) {
+	links, err := r.repo.ListStaleTokens(ctx, enc.KeyPrefix(), batch)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, link := range links {
+		if err := reencryptToken(ctx, enc, link.AccessToken, providerAccessTokenData(link.ID)); err != nil {
+			return i, err
+		}
+		if err := reencryptToken(ctx, enc, link.RefreshToken, providerRefreshTokenData(link.ID)); err != nil {
+			return i, err
+		}
+		if err := r.repo.UpdateTokens(ctx, link); err != nil {
+			return i, err
+		}
+	}
+	return len(links), nil
+}
+
+// reencryptToken re-encrypts an optional token in place
+func reencryptToken(ctx context.Context, enc *encryption.Encryptor, token *string, associatedData string) error {
+	if token == nil {
+		return nil
+	}
+	reencrypted, _, err := enc.Reencrypt(ctx, *token, associatedData)
+	if err != nil {
+		return err
+	}
+	*token = reencrypted
+	return nil
+}
+
+// providerAccessTokenData and providerRefreshTokenData bind encrypted tokens to their row
+func providerAccessTokenData(linkID string) string {
+	return "oauth_providers.access_token:" + linkID
+}
+
+func providerRefreshTokenData(linkID string) string {
+	return "oauth_providers.refresh_token:" + linkID
+}
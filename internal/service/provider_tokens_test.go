@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// refreshingProvider refreshes the refresh token "refresh", like providers not rotating refresh tokens
+type refreshingProvider struct {
+	fakeProvider
+}
+
+func (p *refreshingProvider) Refresh(_ context.Context, token *oauth.Token) (*oauth.Token, error) {
+	if token.RefreshToken != "refresh" {
+		return nil, oauth.ErrExchangeFailed
+	}
+	return &oauth.Token{AccessToken: "refreshed", RefreshToken: token.RefreshToken, Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestProviderTokenServiceSignIn(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	provider := &fakeProvider{identities: map[string]oauth.Identity{
+		"new": {Provider: oauth.ProviderGitHub, ID: "1", Email: "new@example.com", EmailVerified: true},
+	}}
+	registry := providerRegistry(t, provider)
+	tokens := service.NewProviderTokenService(env.Repos.OAuthProvider, newTestEncryptor(t, newTestKeyEntry(t, "k1")), registry)
+	oauthService := service.NewOAuthService(env.Service, env.Repos.User, env.Repos.OAuthProvider, utils.NewEmailNormalizer(nil, nil),
+		service.NewRedirectValidator([]string{"https://app.example.test"}), env.Redis, service.OAuthConfig{Registration: true}, registry, tokens)
+
+	returned, err := signInWithProvider(t, oauthService, "new")
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	response, err := oauthService.Token(ctx, returned.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("Failed to exchange login code: %v", err)
+	}
+	userID := response.AuthResponse.User.ID
+
+	link, err := env.Repos.OAuthProvider.GetByProvider(ctx, oauth.ProviderGitHub, "1")
+	if err != nil || link.AccessToken == nil || !strings.HasPrefix(*link.AccessToken, "enc:v1:k1:") {
+		t.Fatalf("Expected an encrypted access token, got %+v (%v)", link, err)
+	}
+	token, err := tokens.Token(ctx, userID, oauth.ProviderGitHub)
+	if err != nil || token.AccessToken != "new" {
+		t.Errorf("Expected the token of the sign-in, got %+v (%v)", token, err)
+	}
+
+	if _, err := tokens.Token(ctx, userID, oauth.ProviderGitLab); !errors.Is(err, service.ErrOAuthProviderNotFound) {
+		t.Errorf("Expected ErrOAuthProviderNotFound, got %v", err)
+	}
+	if _, err := tokens.Token(ctx, "other-user", oauth.ProviderGitHub); !errors.Is(err, service.ErrOAuthProviderNotLinked) {
+		t.Errorf("Expected ErrOAuthProviderNotLinked, got %v", err)
+	}
+}
+
+func TestProviderTokenServiceRefresh(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	tokens := service.NewProviderTokenService(env.Repos.OAuthProvider, newTestEncryptor(t, newTestKeyEntry(t, "k1")),
+		providerRegistry(t, &refreshingProvider{}))
+
+	link := &domain.OAuthProvider{UserID: "user-1", Provider: oauth.ProviderGitHub, ProviderUserID: "1"}
+	if err := env.Repos.OAuthProvider.Create(ctx, link); err != nil {
+		t.Fatalf("Failed to link provider: %v", err)
+	}
+	if _, err := tokens.Token(ctx, "user-1", oauth.ProviderGitHub); !errors.Is(err, service.ErrProviderTokenUnavailable) {
+		t.Errorf("Expected ErrProviderTokenUnavailable without a stored token, got %v", err)
+	}
+
+	// Tokens expiring soon are refreshed and stored
+	if err := tokens.Store(ctx, link, &oauth.Token{AccessToken: "expiring", RefreshToken: "refresh", Expiry: time.Now().Add(10 * time.Second)}); err != nil {
+		t.Fatalf("Failed to store token: %v", err)
+	}
+	token, err := tokens.Token(ctx, "user-1", oauth.ProviderGitHub)
+	if err != nil || token.AccessToken != "refreshed" {
+		t.Fatalf("Expected a refreshed token, got %+v (%v)", token, err)
+	}
+	if token, err = tokens.Token(ctx, "user-1", oauth.ProviderGitHub); err != nil || token.AccessToken != "refreshed" || token.RefreshToken != "refresh" {
+		t.Errorf("Expected the refreshed token to be stored, got %+v (%v)", token, err)
+	}
+
+	// Rejected refresh tokens need a new sign-in
+	if err := tokens.Store(ctx, link, &oauth.Token{AccessToken: "expired", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatalf("Failed to store token: %v", err)
+	}
+	if _, err := tokens.Token(ctx, "user-1", oauth.ProviderGitHub); !errors.Is(err, service.ErrProviderTokenUnavailable) {
+		t.Errorf("Expected ErrProviderTokenUnavailable for a rejected refresh token, got %v", err)
+	}
+}
+
+func TestProviderTokenReencryption(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	oldKey, newKey := newTestKeyEntry(t, "k1"), newTestKeyEntry(t, "k2")
+	registry := providerRegistry(t, &refreshingProvider{})
+
+	link := &domain.OAuthProvider{UserID: "user-1", Provider: oauth.ProviderGitHub, ProviderUserID: "1"}
+	if err := env.Repos.OAuthProvider.Create(ctx, link); err != nil {
+		t.Fatalf("Failed to link provider: %v", err)
+	}
+	old := service.NewProviderTokenService(env.Repos.OAuthProvider, newTestEncryptor(t, oldKey), registry)
+	if err := old.Store(ctx, link, &oauth.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("Failed to store token: %v", err)
+	}
+
+	rotated := newTestEncryptor(t, newKey, oldKey)
+	reencryption := service.NewReencryptionService(rotated, time.Hour, 10, service.NewProviderTokenReencryption(env.Repos.OAuthProvider))
+	if n, err := reencryption.ReencryptAll(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected 1 re-encrypted connection, got %d (%v)", n, err)
+	}
+
+	current := service.NewProviderTokenService(env.Repos.OAuthProvider, newTestEncryptor(t, newKey), registry)
+	if token, err := current.Token(ctx, "user-1", oauth.ProviderGitHub); err != nil || token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Errorf("Expected the tokens to be readable with the new key only, got %+v (%v)", token, err)
+	}
+}
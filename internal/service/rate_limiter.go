@@ -5,98 +5,112 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/prperemyshlev/auth-service-2/pkg/database"
 	"github.com/redis/go-redis/v9"
 )
 
-// RateLimiter handles rate limiting using Redis
-type RateLimiter struct {
-	redis *database.Redis
+// slidingWindowScript atomically trims the window, counts the remaining
+// entries and records the current request if the limit allows it.
+//
+// KEYS[1] - rate limit key
+// ARGV[1] - current time in milliseconds
+// ARGV[2] - window size in milliseconds
+// ARGV[3] - request limit
+// ARGV[4] - unique member for the current request
+//
+// Returns {allowed (0|1), count in window, time in milliseconds when the oldest entry leaves the window}
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+
+redis.call('PEXPIRE', key, window)
+
+local reset = now + window
+local entries = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if entries[2] then
+	reset = tonumber(entries[2]) + window
+end
+
+return {allowed, count, reset}
+`)
+
+// RateLimiter limits requests per key within a sliding window
+type RateLimiter interface {
+	// Allow checks if a request is allowed based on rate limit and records it when allowed
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (*RateLimitResult, error)
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(redis *database.Redis) *RateLimiter {
-	return &RateLimiter{redis: redis}
+// redisRateLimiter implements RateLimiter using Redis
+type redisRateLimiter struct {
+	redis *database.Redis
 }
 
-// Allow checks if a request is allowed based on rate limit
-// Returns true if request is allowed, false if rate limit exceeded
-func (r *RateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
-	now := time.Now()
-	windowStart := now.Add(-window)
-
-	// Use sliding window log algorithm
-	// Key format: "ratelimit:{key}"
-	redisKey := fmt.Sprintf("ratelimit:%s", key)
-
-	// Remove entries older than the window
-	err := r.redis.Client.ZRemRangeByScore(ctx, redisKey, "0", fmt.Sprintf("%d", windowStart.Unix())).Err()
-	if err != nil {
-		return false, fmt.Errorf("failed to clean old entries: %w", err)
-	}
-
-	// Count current entries in the window
-	count, err := r.redis.Client.ZCard(ctx, redisKey).Result()
-	if err != nil {
-		return false, fmt.Errorf("failed to count entries: %w", err)
-	}
-
-	// Check if limit is exceeded
-	if count >= int64(limit) {
-		// Get the oldest entry to calculate time until next request is allowed
-		oldest, err := r.redis.Client.ZRangeWithScores(ctx, redisKey, 0, 0).Result()
-		if err == nil && len(oldest) > 0 {
-			// Calculate remaining time
-			oldestTime := time.Unix(int64(oldest[0].Score), 0)
-			remaining := window - time.Since(oldestTime)
-			return false, fmt.Errorf("rate limit exceeded, try again in %v", remaining.Round(time.Second))
-		}
-		return false, fmt.Errorf("rate limit exceeded")
-	}
+// NewRateLimiter creates a new Redis-backed rate limiter
+func NewRateLimiter(redis *database.Redis) RateLimiter {
+	return &redisRateLimiter{redis: redis}
+}
 
-	// Add current request to the set with current timestamp as score
-	member := fmt.Sprintf("%d-%d", now.UnixNano(), now.Unix())
-	err = r.redis.Client.ZAdd(ctx, redisKey, redis.Z{
-		Score:  float64(now.Unix()),
-		Member: member,
-	}).Err()
-	if err != nil {
-		return false, fmt.Errorf("failed to add entry: %w", err)
-	}
+// RateLimitResult describes the state of a rate limit window after a request
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAt is the moment the oldest request leaves the window and frees a slot
+	ResetAt time.Time
+}
 
-	// Set expiration on the key (window duration + 1 minute buffer)
-	err = r.redis.Client.Expire(ctx, redisKey, window+time.Minute).Err()
-	if err != nil {
-		// Log error but don't fail the request
-		_ = err
+// RetryAfter returns the duration until the next request may be allowed
+func (r *RateLimitResult) RetryAfter(now time.Time) time.Duration {
+	if r.Allowed || !r.ResetAt.After(now) {
+		return 0
 	}
-
-	return true, nil
+	return r.ResetAt.Sub(now)
 }
 
-// GetRemainingRequests returns the number of remaining requests allowed
-func (r *RateLimiter) GetRemainingRequests(ctx context.Context, key string, limit int, window time.Duration) (int, error) {
+// Allow checks if a request is allowed based on rate limit and records it when allowed
+func (r *redisRateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*RateLimitResult, error) {
 	now := time.Now()
-	windowStart := now.Add(-window)
 
-	redisKey := fmt.Sprintf("ratelimit:%s", key)
-
-	// Remove entries older than the window
-	err := r.redis.Client.ZRemRangeByScore(ctx, redisKey, "0", fmt.Sprintf("%d", windowStart.Unix())).Err()
-	if err != nil {
-		return 0, fmt.Errorf("failed to clean old entries: %w", err)
-	}
-
-	// Count current entries in the window
-	count, err := r.redis.Client.ZCard(ctx, redisKey).Result()
+	// Use sliding window log algorithm executed as a single Lua script,
+	// so concurrent requests cannot slip past the limit between commands
+	result, err := slidingWindowScript.Run(ctx, r.redis.Client,
+		[]string{rateLimitKey(key)},
+		now.UnixMilli(),
+		window.Milliseconds(),
+		limit,
+		fmt.Sprintf("%d-%s", now.UnixNano(), uuid.New().String()),
+	).Int64Slice()
 	if err != nil {
-		return 0, fmt.Errorf("failed to count entries: %w", err)
+		return nil, fmt.Errorf("failed to evaluate rate limit: %w", err)
 	}
 
-	remaining := limit - int(count)
+	remaining := limit - int(result[1])
 	if remaining < 0 {
 		remaining = 0
 	}
 
-	return remaining, nil
+	return &RateLimitResult{
+		Allowed:   result[0] == 1,
+		Limit:     limit,
+		Remaining: remaining,
+		ResetAt:   time.UnixMilli(result[2]),
+	}, nil
+}
+
+// rateLimitKey builds the Redis key for a rate limit bucket
+func rateLimitKey(key string) string {
+	return fmt.Sprintf("ratelimit:%s", key)
 }
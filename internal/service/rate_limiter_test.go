@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// roundTripCounter counts commands sent to Redis
+type roundTripCounter struct {
+	count atomic.Int64
+}
+
+func (c *roundTripCounter) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (c *roundTripCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		c.count.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (c *roundTripCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		c.count.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+func newTestRedis(tb testing.TB) (*database.Redis, *roundTripCounter) {
+	tb.Helper()
+
+	server := miniredis.RunT(tb)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tb.Cleanup(func() { _ = client.Close() })
+
+	counter := &roundTripCounter{}
+	client.AddHook(counter)
+
+	return &database.Redis{Client: client}, counter
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	limiter := NewRateLimiter(rdb)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, "allow", 3, time.Minute)
+		if err != nil || !result.Allowed {
+			t.Fatalf("Expected request %d to be allowed, got result=%+v err=%v", i+1, result, err)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("Expected %d remaining requests, got %d", 2-i, result.Remaining)
+		}
+	}
+
+	result, err := limiter.Allow(ctx, "allow", 3, time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("Expected request over the limit to be rejected")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected 0 remaining requests, got %d", result.Remaining)
+	}
+	if result.ResetAt.Before(start.Add(time.Minute-time.Second)) || result.ResetAt.After(time.Now().Add(time.Minute)) {
+		t.Errorf("Expected reset about a minute after the first request, got %v", result.ResetAt)
+	}
+	if retryAfter := result.RetryAfter(time.Now()); retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("Expected retry after within the window, got %v", retryAfter)
+	}
+}
+
+func TestRateLimiterAllowConcurrent(t *testing.T) {
+	rdb, _ := newTestRedis(t)
+	limiter := NewRateLimiter(rdb)
+	ctx := context.Background()
+
+	const limit = 10
+	var allowedCount atomic.Int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result, err := limiter.Allow(ctx, "concurrent", limit, time.Minute); err == nil && result.Allowed {
+				allowedCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowedCount.Load(); got != limit {
+		t.Errorf("Expected exactly %d allowed requests, got %d", limit, got)
+	}
+}
+
+// legacyAllow reproduces the previous multi-command implementation for comparison
+func legacyAllow(ctx context.Context, rdb *database.Redis, key string, limit int, window time.Duration) (bool, error) {
+	now := time.Now()
+	redisKey := rateLimitKey(key)
+
+	if err := rdb.Client.ZRemRangeByScore(ctx, redisKey, "0", fmt.Sprintf("%d", now.Add(-window).Unix())).Err(); err != nil {
+		return false, err
+	}
+
+	count, err := rdb.Client.ZCard(ctx, redisKey).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if count >= int64(limit) {
+		_, err := rdb.Client.ZRangeWithScores(ctx, redisKey, 0, 0).Result()
+		return false, err
+	}
+
+	if err := rdb.Client.ZAdd(ctx, redisKey, redis.Z{Score: float64(now.Unix()), Member: now.UnixNano()}).Err(); err != nil {
+		return false, err
+	}
+
+	return true, rdb.Client.Expire(ctx, redisKey, window+time.Minute).Err()
+}
+
+func BenchmarkRateLimiterAllow(b *testing.B) {
+	rdb, counter := newTestRedis(b)
+	limiter := NewRateLimiter(rdb)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	counter.count.Store(0)
+	for i := 0; i < b.N; i++ {
+		if _, err := limiter.Allow(ctx, "bench", 100, time.Minute); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.count.Load())/float64(b.N), "roundtrips/op")
+}
+
+func BenchmarkRateLimiterAllowLegacy(b *testing.B) {
+	rdb, counter := newTestRedis(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	counter.count.Store(0)
+	for i := 0; i < b.N; i++ {
+		if _, err := legacyAllow(ctx, rdb, "bench", 100, time.Minute); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(counter.count.Load())/float64(b.N), "roundtrips/op")
+}
+
+// BenchmarkRateLimiterAllowParallel spreads concurrent requests over many keys,
+// like clients with different IPs hitting the same route
+func BenchmarkRateLimiterAllowParallel(b *testing.B) {
+	rdb, _ := newTestRedis(b)
+	limiter := NewRateLimiter(rdb)
+	ctx := context.Background()
+
+	var seq atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		key := fmt.Sprintf("bench-%d", seq.Add(1))
+		for pb.Next() {
+			if _, err := limiter.Allow(ctx, key, 100, time.Minute); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
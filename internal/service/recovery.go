@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+// recoveryAttemptKey counts the email changes a user attempted through recovery
+const recoveryAttemptKey = "recovery:attempts:"
+
+// Reasons account recovery is denied for, recorded in audit events
+const (
+	RecoveryReasonRateLimited    = "rate_limited"
+	RecoveryReasonNoSignIn       = "no_provider_sign_in"
+	RecoveryReasonNotLinked      = "provider_not_linked"
+	RecoveryReasonRecentlyLinked = "provider_linked_recently"
+	RecoveryReasonInactive       = "user_inactive"
+)
+
+// RecoveryConfig configures account recovery
+type RecoveryConfig struct {
+	// MinLinkAge is how long a provider account must have been linked to recover with it, so that
+	// a provider account linked by someone who took over the email can't be used right away
+	MinLinkAge time.Duration
+	// MaxAttempts limits the email changes a user may attempt per AttemptWindow
+	MaxAttempts   int
+	AttemptWindow time.Duration
+	// EmailDomains restricts the new emails to the allowed domains, nil allows any domain
+	EmailDomains *EmailDomainPolicy
+}
+
+// RecentProviderSignIns tells with which provider a user signed in moments ago
+type RecentProviderSignIns interface {
+	// RecentSignInProvider returns the provider the user signed in with within providerReauthWindow, or ""
+	RecentSignInProvider(ctx context.Context, userID string) (string, error)
+}
+
+// RecoveryService lets users who lost access to their email recover their account
+// Users re-verify by signing in with a linked OAuth provider, which starts a session without
+// the email or password, and may then change their email within providerReauthWindow. Risk
+// checks limit attempts and require the provider account to be linked for a while; every
+// attempt is audited, the former email is notified and all sessions are ended.
+type RecoveryService struct {
+	userRepo        repository.UserRepository
+	oauthRepo       repository.OAuthProviderRepository
+	signIns         RecentProviderSignIns
+	limiter         RateLimiter
+	revocation      *RevocationService
+	emails          *EmailService
+	emailNormalizer *utils.EmailNormalizer
+	auditor         observability.Auditor
+	config          RecoveryConfig
+}
+
+// NewRecoveryService creates a recovery service, emails may be nil to skip notices to former emails
+func NewRecoveryService(
+	userRepo repository.UserRepository,
+	oauthRepo repository.OAuthProviderRepository,
+	signIns RecentProviderSignIns,
+	limiter RateLimiter,
+	revocation *RevocationService,
+	emails *EmailService,
+	emailNormalizer *utils.EmailNormalizer,
+	auditor observability.Auditor,
+	config RecoveryConfig,
+) *RecoveryService {
+	return &RecoveryService{
+		userRepo:        userRepo,
+		oauthRepo:       oauthRepo,
+		signIns:         signIns,
+		limiter:         limiter,
+		revocation:      revocation,
+		emails:          emails,
+		emailNormalizer: emailNormalizer,
+		auditor:         auditorOrNop(auditor),
+		config:          config,
+	}
+}
+
+// ChangeEmail changes the email of a user who signed in with a linked provider moments ago
+// The new email is verified if the provider account has it, otherwise it has to be verified.
+func (s *RecoveryService) ChangeEmail(ctx context.Context, userID, email string) (_ *dto.UserResponse, err error) {
+	ctx, span := tracer.Start(ctx, "RecoveryService.ChangeEmail")
+	defer func() { endSpan(span, err) }()
+
+	if s.config.MaxAttempts > 0 {
+		// Limiter failures let the attempt through, like the HTTP rate limits do
+		result, err := s.limiter.Allow(ctx, recoveryAttemptKey+userID, s.config.MaxAttempts, s.config.AttemptWindow)
+		if err == nil && !result.Allowed {
+			s.auditDenied(ctx, userID, RecoveryReasonRateLimited)
+			return nil, &RetryAfterError{Err: ErrTooManyAttempts, RetryAfter: result.RetryAfter(time.Now())}
+		}
+	}
+
+	provider, err := s.signIns.RecentSignInProvider(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if provider == "" {
+		s.auditDenied(ctx, userID, RecoveryReasonNoSignIn)
+		return nil, ErrReauthenticationRequired
+	}
+	link, err := s.link(ctx, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		s.auditDenied(ctx, userID, RecoveryReasonNotLinked)
+		return nil, ErrRecoveryNotAllowed
+	}
+	if time.Since(link.CreatedAt) < s.config.MinLinkAge {
+		s.auditDenied(ctx, userID, RecoveryReasonRecentlyLinked)
+		return nil, ErrRecoveryNotAllowed
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.IsActive {
+		s.auditDenied(ctx, userID, RecoveryReasonInactive)
+		return nil, ErrUserInactive
+	}
+
+	normalized := s.emailNormalizer.Normalize(email)
+	if normalized == user.EmailNormalized {
+		return userResponse(user), nil
+	}
+	if err := s.config.EmailDomains.Check(ctx, normalized); err != nil {
+		return nil, err
+	}
+	if _, err := s.userRepo.GetByEmail(ctx, normalized); err == nil {
+		return nil, ErrUserExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check email: %w", err)
+	}
+
+	formerEmail := user.Email
+	user.Email = utils.SanitizeEmail(email)
+	user.EmailNormalized = normalized
+	user.IsEmailVerified = link.Email != nil && s.emailNormalizer.Normalize(*link.Email) == normalized
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return nil, ErrUserExists
+		}
+		return nil, fmt.Errorf("failed to change email: %w", err)
+	}
+
+	// Sessions started before the change, e.g. by someone else who had access to the email, end
+	if _, err := s.revocation.Revoke(ctx, Revocation{UserID: userID}); err != nil {
+		return nil, fmt.Errorf("failed to end sessions: %w", err)
+	}
+
+	event := newAuditEvent(ctx, AuditRecoveryEmailChanged, observability.AuditOutcomeSuccess)
+	event.UserID = userID
+	event.User = observability.MaskEmail(formerEmail)
+	s.auditor.Audit(ctx, event)
+
+	if s.emails != nil {
+		locale := ""
+		if user.Locale != nil {
+			locale = *user.Locale
+		}
+		if err := s.emails.SendEmailChanged(ctx, formerEmail, locale, EmailChangedEmailData{
+			NewEmail: observability.MaskEmail(user.Email),
+			Provider: provider,
+			Time:     time.Now().UTC().Format("2006-01-02 15:04 UTC"),
+		}); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to notify the former email", zap.String("user_id", userID), zap.Error(err))
+		}
+	}
+
+	return userResponse(user), nil
+}
+
+// link returns the account of the provider linked to the user, nil if none is
+func (s *RecoveryService) link(ctx context.Context, userID, provider string) (*domain.OAuthProvider, error) {
+	links, err := s.oauthRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth providers: %w", err)
+	}
+	for _, link := range links {
+		if link.Provider == provider {
+			return link, nil
+		}
+	}
+	return nil, nil
+}
+
+// auditDenied records a recovery attempt refused by a risk check
+func (s *RecoveryService) auditDenied(ctx context.Context, userID, reason string) {
+	event := newAuditEvent(ctx, AuditRecoveryDenied, observability.AuditOutcomeFailure)
+	event.UserID = userID
+	event.Reason = reason
+	s.auditor.Audit(ctx, event)
+}
@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/oauth"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+// recentProviders maps users to the provider they signed in with moments ago
+type recentProviders map[string]string
+
+func (r recentProviders) RecentSignInProvider(_ context.Context, userID string) (string, error) {
+	return r[userID], nil
+}
+
+func TestRecoveryServiceChangeEmail(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	recent := recentProviders{}
+	recovery := service.NewRecoveryService(env.Repos.User, env.Repos.OAuthProvider, recent, service.NewRateLimiter(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), nil, utils.NewEmailNormalizer(nil, nil), auditor,
+		service.RecoveryConfig{MinLinkAge: 24 * time.Hour, MaxAttempts: 6, AttemptWindow: time.Hour})
+
+	user := &domain.User{Email: "lost@example.com", EmailNormalized: "lost@example.com", IsActive: true, IsEmailVerified: true}
+	other := &domain.User{Email: "taken@example.com", EmailNormalized: "taken@example.com", IsActive: true}
+	for _, u := range []*domain.User{user, other} {
+		if err := env.Repos.User.Create(ctx, u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	providerEmail := "new@example.com"
+	for _, link := range []*domain.OAuthProvider{
+		{UserID: user.ID, Provider: oauth.ProviderGitHub, ProviderUserID: "1", Email: &providerEmail, CreatedAt: time.Now().Add(-30 * 24 * time.Hour)},
+		{UserID: user.ID, Provider: oauth.ProviderGitLab, ProviderUserID: "2", CreatedAt: time.Now().Add(-time.Hour)},
+	} {
+		if err := env.Repos.OAuthProvider.Create(ctx, link); err != nil {
+			t.Fatalf("Failed to link provider: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		email    string
+		want     error
+		reason   string
+	}{
+		{name: "no provider sign-in", email: "new@example.com", want: service.ErrReauthenticationRequired, reason: service.RecoveryReasonNoSignIn},
+		{name: "provider linked recently", provider: oauth.ProviderGitLab, email: "new@example.com", want: service.ErrRecoveryNotAllowed, reason: service.RecoveryReasonRecentlyLinked},
+		{name: "provider not linked", provider: "google", email: "new@example.com", want: service.ErrRecoveryNotAllowed, reason: service.RecoveryReasonNotLinked},
+		{name: "email of another user", provider: oauth.ProviderGitHub, email: "Taken@example.com", want: service.ErrUserExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recent[user.ID] = tt.provider
+			if _, err := recovery.ChangeEmail(ctx, user.ID, tt.email); !errors.Is(err, tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			if tt.reason != "" {
+				if event, ok := auditor.last(service.AuditRecoveryDenied); !ok || event.Reason != tt.reason || event.UserID != user.ID {
+					t.Errorf("Expected a denied recovery with reason %s, got %+v", tt.reason, event)
+				}
+			}
+		})
+	}
+
+	// The email of the provider account is verified
+	recent[user.ID] = oauth.ProviderGitHub
+	changed, err := recovery.ChangeEmail(ctx, user.ID, "New@example.com")
+	if err != nil {
+		t.Fatalf("Failed to change email: %v", err)
+	}
+	if changed.Email != "new@example.com" || !changed.IsEmailVerified {
+		t.Errorf("Expected the verified email of the provider account, got %+v", changed)
+	}
+	if event, ok := auditor.last(service.AuditRecoveryEmailChanged); !ok || event.UserID != user.ID || event.User != "l***@example.com" {
+		t.Errorf("Expected an audited email change, got %+v", event)
+	}
+
+	// Other emails have to be verified
+	changed, err = recovery.ChangeEmail(ctx, user.ID, "other@example.com")
+	if err != nil {
+		t.Fatalf("Failed to change email: %v", err)
+	}
+	if changed.IsEmailVerified {
+		t.Error("Expected an email the provider account doesn't have to be unverified")
+	}
+
+	if _, err := recovery.ChangeEmail(ctx, user.ID, "third@example.com"); !errors.Is(err, service.ErrTooManyAttempts) {
+		t.Errorf("Expected ErrTooManyAttempts once the attempts are used up, got %v", err)
+	}
+	if event, _ := auditor.last(service.AuditRecoveryDenied); event.Reason != service.RecoveryReasonRateLimited {
+		t.Errorf("Expected a rate limited recovery, got %+v", event)
+	}
+}
+
+func TestRecoveryServiceEmailDomains(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	recent := recentProviders{}
+	recovery := service.NewRecoveryService(env.Repos.User, env.Repos.OAuthProvider, recent, service.NewRateLimiter(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), nil, utils.NewEmailNormalizer(nil, nil), nil,
+		service.RecoveryConfig{EmailDomains: service.NewEmailDomainPolicy([]string{"acme.com"})})
+
+	user := &domain.User{Email: "lost@acme.com", EmailNormalized: "lost@acme.com", IsActive: true}
+	if err := env.Repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	link := &domain.OAuthProvider{UserID: user.ID, Provider: oauth.ProviderGitHub, ProviderUserID: "1", CreatedAt: time.Now().Add(-time.Hour)}
+	if err := env.Repos.OAuthProvider.Create(ctx, link); err != nil {
+		t.Fatalf("Failed to link provider: %v", err)
+	}
+	recent[user.ID] = oauth.ProviderGitHub
+
+	if _, err := recovery.ChangeEmail(ctx, user.ID, "lost@gmail.com"); !errors.Is(err, service.ErrEmailDomainNotAllowed) {
+		t.Errorf("Expected ErrEmailDomainNotAllowed, got %v", err)
+	}
+	if _, err := recovery.ChangeEmail(ctx, user.ID, "found@acme.com"); err != nil {
+		t.Errorf("Expected an email of an allowed domain to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Flows accepting a redirect URL, reported in metrics and logs
+const (
+	RedirectFlowOAuthCallback     = "oauth_callback"
+	RedirectFlowMagicLink         = "magic_link"
+	RedirectFlowEmailVerification = "email_verification"
+	RedirectFlowPasswordReset     = "password_reset"
+)
+
+// Reasons a redirect URL is rejected for
+const (
+	RedirectReasonMalformed     = "malformed"
+	RedirectReasonNotAbsolute   = "not_absolute"
+	RedirectReasonScheme        = "scheme"
+	RedirectReasonCredentials   = "credentials"
+	RedirectReasonPathTraversal = "path_traversal"
+	RedirectReasonNotAllowed    = "not_allowed"
+	RedirectReasonNoDefault     = "no_default"
+)
+
+// maxRedirectURLLength keeps redirect URLs within what browsers and proxies accept
+const maxRedirectURLLength = 2048
+
+// RedirectError is returned when a redirect URL is rejected, it wraps ErrRedirectNotAllowed
+type RedirectError struct {
+	Flow   string
+	Reason string
+	URL    string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%s: %s redirect to %q rejected (%s)", ErrRedirectNotAllowed, e.Flow, e.URL, e.Reason)
+}
+
+func (e *RedirectError) Unwrap() error {
+	return ErrRedirectNotAllowed
+}
+
+// RedirectValidator guards every flow that sends users back to a URL they supplied, e.g. OAuth
+// callbacks, magic links and email verification success pages, against open redirects.
+// The allow-list is the redirect URLs of the tenant of the request, or the configured ones
+// for requests without a tenant or tenants without redirect URLs.
+type RedirectValidator struct {
+	allowed   []*url.URL
+	validated metric.Int64Counter
+}
+
+// NewRedirectValidator creates a validator with the allow-list of requests without a tenant
+// Entries must be absolute http(s) URLs, others are skipped.
+func NewRedirectValidator(allowed []string) *RedirectValidator {
+	v := &RedirectValidator{}
+	for _, raw := range allowed {
+		if u, reason := parseRedirectURL(strings.TrimSpace(raw)); reason == "" {
+			v.allowed = append(v.allowed, u)
+		}
+	}
+
+	var err error
+	if v.validated, err = meter.Int64Counter("auth.redirects.validated",
+		metric.WithDescription("Number of redirect URLs validated, by flow, outcome (allowed or rejected) and reason"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create validated redirects counter: %w", err))
+	}
+
+	return v
+}
+
+// Validate returns the URL a flow sends the user back to: requested if the allow-list has a URL
+// with its scheme and host and a path it is below of, or the first URL of the allow-list if
+// requested is empty. Other URLs are rejected with a *RedirectError.
+func (v *RedirectValidator) Validate(ctx context.Context, flow, requested string) (string, error) {
+	redirectURL, reason := v.match(ctx, requested)
+	v.record(ctx, flow, reason)
+	if reason == "" {
+		return redirectURL, nil
+	}
+
+	fields := []zap.Field{zap.String("flow", flow), zap.String("reason", reason)}
+	if u, err := url.Parse(requested); err == nil {
+		// The rest of the URL may carry tokens, the host is enough to spot attempts
+		fields = append(fields, zap.String("host", u.Host))
+	}
+	observability.LoggerFromContext(ctx).Warn("Redirect URL rejected", fields...)
+
+	return "", &RedirectError{Flow: flow, Reason: reason, URL: requested}
+}
+
+// match returns the redirect URL, or the reason it is rejected for
+func (v *RedirectValidator) match(ctx context.Context, requested string) (string, string) {
+	allowed := v.allowList(ctx)
+	if requested == "" {
+		if len(allowed) == 0 {
+			return "", RedirectReasonNoDefault
+		}
+		return allowed[0].String(), ""
+	}
+
+	target, reason := parseRedirectURL(requested)
+	if reason != "" {
+		return "", reason
+	}
+	for _, base := range allowed {
+		if !strings.EqualFold(target.Scheme, base.Scheme) || !strings.EqualFold(target.Host, base.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(base.Path, "/")
+		if target.Path == prefix || strings.HasPrefix(target.Path, prefix+"/") {
+			return requested, ""
+		}
+	}
+	return "", RedirectReasonNotAllowed
+}
+
+// allowList returns the redirect URLs of the tenant of the request, or the configured ones
+func (v *RedirectValidator) allowList(ctx context.Context) []*url.URL {
+	tenant := TenantFromContext(ctx)
+	if tenant == nil || len(tenant.RedirectURLs) == 0 {
+		return v.allowed
+	}
+
+	allowed := make([]*url.URL, 0, len(tenant.RedirectURLs))
+	for _, raw := range tenant.RedirectURLs {
+		if u, reason := parseRedirectURL(raw); reason == "" {
+			allowed = append(allowed, u)
+		}
+	}
+	return allowed
+}
+
+// record counts a validation, reason is empty for allowed URLs
+func (v *RedirectValidator) record(ctx context.Context, flow, reason string) {
+	attrs := []attribute.KeyValue{attribute.String("flow", flow), attribute.String("outcome", "allowed")}
+	if reason != "" {
+		attrs = []attribute.KeyValue{attribute.String("flow", flow), attribute.String("outcome", "rejected"), attribute.String("reason", reason)}
+	}
+	v.validated.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attrs...))
+}
+
+// parseRedirectURL parses an absolute http(s) URL without credentials or dot segments,
+// or returns the reason it can't be redirected to
+func parseRedirectURL(raw string) (*url.URL, string) {
+	if len(raw) > maxRedirectURLLength {
+		return nil, RedirectReasonMalformed
+	}
+	u, err := url.Parse(raw)
+	switch {
+	case err != nil:
+		return nil, RedirectReasonMalformed
+	case u.Scheme == "" || u.Host == "":
+		return nil, RedirectReasonNotAbsolute
+	case !strings.EqualFold(u.Scheme, "https") && !strings.EqualFold(u.Scheme, "http"):
+		return nil, RedirectReasonScheme
+	case u.User != nil:
+		return nil, RedirectReasonCredentials
+	// Dot segments would let browsers resolve the path outside of the allowed one
+	case strings.Contains(u.Path, ".."):
+		return nil, RedirectReasonPathTraversal
+	}
+	return u, ""
+}
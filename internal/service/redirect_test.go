@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+func TestRedirectValidatorTenantAllowList(t *testing.T) {
+	validator := service.NewRedirectValidator([]string{"https://app.example.test"})
+	tenant := &domain.Tenant{ID: "acme", Name: "Acme", RedirectURLs: []string{"https://app.acme.test/auth", "https://admin.acme.test"}}
+	ctx := service.ContextWithTenant(context.Background(), tenant)
+
+	tests := []struct {
+		requested string
+		want      string
+		reason    string
+	}{
+		{requested: "", want: "https://app.acme.test/auth"},
+		{requested: "https://app.acme.test/auth/verified?next=%2F", want: "https://app.acme.test/auth/verified?next=%2F"},
+		{requested: "https://ADMIN.acme.test/settings", want: "https://ADMIN.acme.test/settings"},
+		{requested: "https://app.acme.test/authx", reason: service.RedirectReasonNotAllowed},
+		{requested: "http://app.acme.test/auth", reason: service.RedirectReasonNotAllowed},
+		{requested: "https://evil.test/auth", reason: service.RedirectReasonNotAllowed},
+		{requested: "https://app.example.test", reason: service.RedirectReasonNotAllowed},
+		{requested: "https://app.acme.test/auth/../admin", reason: service.RedirectReasonPathTraversal},
+		{requested: "https://app.acme.test@evil.test/auth", reason: service.RedirectReasonCredentials},
+		{requested: "//evil.test/auth", reason: service.RedirectReasonNotAbsolute},
+		{requested: "/auth", reason: service.RedirectReasonNotAbsolute},
+		{requested: "javascript://app.acme.test/auth", reason: service.RedirectReasonScheme},
+		{requested: "https://app.acme.test/%zz", reason: service.RedirectReasonMalformed},
+	}
+	for _, tt := range tests {
+		got, err := validator.Validate(ctx, service.RedirectFlowEmailVerification, tt.requested)
+		if tt.reason == "" {
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %q for %q, got %q (%v)", tt.want, tt.requested, got, err)
+			}
+			continue
+		}
+
+		var redirectErr *service.RedirectError
+		if !errors.Is(err, service.ErrRedirectNotAllowed) || !errors.As(err, &redirectErr) {
+			t.Errorf("Expected a RedirectError for %q, got %q (%v)", tt.requested, got, err)
+			continue
+		}
+		if redirectErr.Reason != tt.reason || redirectErr.Flow != service.RedirectFlowEmailVerification {
+			t.Errorf("Expected reason %s for %q, got %s", tt.reason, tt.requested, redirectErr.Reason)
+		}
+	}
+}
+
+func TestRedirectValidatorConfiguredAllowList(t *testing.T) {
+	validator := service.NewRedirectValidator([]string{" https://app.example.test/welcome ", "not a url"})
+
+	got, err := validator.Validate(context.Background(), service.RedirectFlowMagicLink, "")
+	if err != nil || got != "https://app.example.test/welcome" {
+		t.Errorf("Expected the first configured URL by default, got %q (%v)", got, err)
+	}
+	if _, err := validator.Validate(context.Background(), service.RedirectFlowMagicLink, "https://app.example.test/welcome/back"); err != nil {
+		t.Errorf("Expected a configured URL to be allowed without a tenant, got %v", err)
+	}
+
+	// Tenants without redirect URLs fall back to the configured ones
+	ctx := service.ContextWithTenant(context.Background(), &domain.Tenant{ID: "acme", Name: "Acme"})
+	if _, err := validator.Validate(ctx, service.RedirectFlowMagicLink, "https://app.example.test/welcome"); err != nil {
+		t.Errorf("Expected a configured URL to be allowed for a tenant without redirect URLs, got %v", err)
+	}
+
+	var redirectErr *service.RedirectError
+	_, err = service.NewRedirectValidator(nil).Validate(context.Background(), service.RedirectFlowOAuthCallback, "")
+	if !errors.As(err, &redirectErr) || redirectErr.Reason != service.RedirectReasonNoDefault {
+		t.Errorf("Expected no_default without an allow-list, got %v", err)
+	}
+}
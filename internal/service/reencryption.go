@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/encryption"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// ReencryptionTarget is an encrypted column re-encrypted after key rotations
+type ReencryptionTarget interface {
+	// Name identifies the column in logs and metrics, e.g. "users.phone"
+	Name() string
+	// Reencrypt re-encrypts up to batch values not encrypted with the current key of enc
+	// and returns how many it re-encrypted, fewer than batch once none are left
+	Reencrypt(ctx context.Context, enc *encryption.Encryptor, batch int) (int, error)
+}
+
+// ReencryptionService re-encrypts encrypted columns with the current key after key rotations,
+// so that old key encryption keys can be dropped once it has caught up
+type ReencryptionService struct {
+	enc      *encryption.Encryptor
+	targets  []ReencryptionTarget
+	interval time.Duration
+	batch    int
+
+	reencrypted metric.Int64Counter
+}
+
+// NewReencryptionService creates a service re-encrypting targets in batches every interval
+func NewReencryptionService(enc *encryption.Encryptor, interval time.Duration, batch int, targets ...ReencryptionTarget) *ReencryptionService {
+	s := &ReencryptionService{
+		enc:      enc,
+		targets:  targets,
+		interval: interval,
+		batch:    batch,
+	}
+
+	var err error
+	if s.reencrypted, err = meter.Int64Counter("encryption.values.reencrypted",
+		metric.WithDescription("Number of encrypted values re-encrypted with the current key, by column"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create re-encrypted values counter: %w", err))
+	}
+
+	return s
+}
+
+// ReencryptAll re-encrypts every stale value of the targets and returns their number
+func (s *ReencryptionService) ReencryptAll(ctx context.Context) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "ReencryptionService.ReencryptAll")
+	defer func() { endSpan(span, err) }()
+
+	total := 0
+	for _, target := range s.targets {
+		for {
+			if err := ctx.Err(); err != nil {
+				return total, err
+			}
+
+			n, err := target.Reencrypt(ctx, s.enc, s.batch)
+			total += n
+			if n > 0 {
+				s.reencrypted.Add(context.WithoutCancel(ctx), int64(n), metric.WithAttributes(attribute.String("column", target.Name())))
+			}
+			if err != nil {
+				return total, fmt.Errorf("failed to re-encrypt %s: %w", target.Name(), err)
+			}
+			if n < s.batch {
+				break
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// Run re-encrypts stale values on a fixed interval until ctx is cancelled
+func (s *ReencryptionService) Run(ctx context.Context) {
+	if len(s.targets) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		// Failed runs are retried on the next tick
+		if n, err := s.ReencryptAll(ctx); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to re-encrypt values", zap.Int("reencrypted", n), zap.Error(err))
+		} else if n > 0 {
+			observability.LoggerFromContext(ctx).Info("Re-encrypted values with the current key", zap.Int("reencrypted", n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
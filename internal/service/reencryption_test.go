@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/encryption"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// encryptedColumn is a ReencryptionTarget over values keyed by row ID
+type encryptedColumn struct {
+	values map[string]string
+}
+
+func (c *encryptedColumn) Name() string { return "test.secret" }
+
+func (c *encryptedColumn) Reencrypt(ctx context.Context, enc *encryption.Encryptor, batch int) (int, error) {
+	n := 0
+	for id, value := range c.values {
+		if n == batch {
+			break
+		}
+		reencrypted, changed, err := enc.Reencrypt(ctx, value, "test.secret:"+id)
+		if err != nil {
+			return n, err
+		}
+		if changed {
+			c.values[id] = reencrypted
+			n++
+		}
+	}
+	return n, nil
+}
+
+func newTestKeyEntry(t *testing.T, id string) string {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestEncryptor(t *testing.T, entries ...string) *encryption.Encryptor {
+	t.Helper()
+
+	keyring, err := encryption.NewKeyring(entries)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return encryption.New(keyring)
+}
+
+func TestReencryptionServiceReencryptAll(t *testing.T) {
+	ctx := context.Background()
+	oldKey := newTestKeyEntry(t, "k1")
+	oldEnc := newTestEncryptor(t, oldKey)
+
+	column := &encryptedColumn{values: make(map[string]string)}
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		value, err := oldEnc.Encrypt(ctx, "secret-"+id, "test.secret:"+id)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+		column.values[id] = value
+	}
+
+	rotated := newTestEncryptor(t, newTestKeyEntry(t, "k2"), oldKey)
+	reencryption := service.NewReencryptionService(rotated, 0, 2, column)
+	n, err := reencryption.ReencryptAll(ctx)
+	if err != nil || n != 5 {
+		t.Fatalf("Expected 5 values to be re-encrypted in batches, got %d (%v)", n, err)
+	}
+	for id, value := range column.values {
+		if keyID, _ := encryption.KeyID(value); keyID != "k2" {
+			t.Errorf("Expected value %s to be encrypted with k2, got %s", id, keyID)
+		}
+		if plaintext, err := rotated.Decrypt(ctx, value, "test.secret:"+id); err != nil || plaintext != "secret-"+id {
+			t.Errorf("Expected value %s to decrypt, got %q (%v)", id, plaintext, err)
+		}
+	}
+
+	if n, err := reencryption.ReencryptAll(ctx); err != nil || n != 0 {
+		t.Errorf("Expected nothing left to re-encrypt, got %d (%v)", n, err)
+	}
+}
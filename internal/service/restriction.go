@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+)
+
+// ErrInvalidRestriction is returned for restriction levels other than none, limited and banned
+var ErrInvalidRestriction = errors.New("invalid restriction")
+
+// RestrictionService restricts abusive accounts
+// Limited users keep signing in but get tokens with the restricted claim and lower rate limits,
+// banned users can't sign in nor refresh tokens. Every change is audited along with who made it.
+type RestrictionService struct {
+	users       repository.UserRepository
+	revocations *RevocationService
+	auditor     observability.Auditor
+}
+
+// NewRestrictionService creates a new restriction service
+func NewRestrictionService(users repository.UserRepository, revocations *RevocationService, auditor observability.Auditor) *RestrictionService {
+	return &RestrictionService{users: users, revocations: revocations, auditor: auditorOrNop(auditor)}
+}
+
+// Set changes the restriction level of a user, actor is who changes it
+// Banning a user also revokes its tokens, other changes apply to tokens issued from then on.
+func (s *RestrictionService) Set(ctx context.Context, userID, actor, restriction string) (_ *dto.UserRestrictionResponse, err error) {
+	ctx, span := tracer.Start(ctx, "RestrictionService.Set")
+	defer func() { endSpan(span, err) }()
+
+	switch restriction {
+	case domain.RestrictionNone, domain.RestrictionLimited, domain.RestrictionBanned:
+	default:
+		return nil, fmt.Errorf("%w: %q must be none, limited or banned", ErrInvalidRestriction, restriction)
+	}
+
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &dto.UserRestrictionResponse{UserID: user.ID, Restriction: restriction}
+	if user.Restriction == restriction {
+		return response, nil
+	}
+
+	if err := s.users.SetRestriction(ctx, user.ID, restriction); err != nil {
+		return nil, err
+	}
+
+	if restriction == domain.RestrictionBanned {
+		result, err := s.revocations.Revoke(ctx, Revocation{UserID: user.ID})
+		if err != nil {
+			return nil, err
+		}
+		response.SessionsRevoked = result.RefreshTokensDeleted
+	}
+
+	event := newAuditEvent(ctx, AuditRestrictionChanged, observability.AuditOutcomeSuccess)
+	event.UserID = user.ID
+	event.Actor = actor
+	event.Reason = fmt.Sprintf("from=%s to=%s", user.Restriction, restriction)
+	s.auditor.Audit(ctx, event)
+
+	return response, nil
+}
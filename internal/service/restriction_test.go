@@ -0,0 +1,87 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestRestrictionService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	restrictions := service.NewRestrictionService(env.Repos.User,
+		service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute), auditor)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	userID := registered.AuthResponse.User.ID
+	login := &dto.LoginRequest{Identifier: "user@example.com", Password: "Password123"}
+
+	if _, err := restrictions.Set(ctx, userID, "admin", domain.RestrictionLimited); err != nil {
+		t.Fatalf("Failed to limit user: %v", err)
+	}
+	event, ok := auditor.last(service.AuditRestrictionChanged)
+	if !ok || event.UserID != userID || event.Actor != "admin" || event.Reason != "from=none to=limited" {
+		t.Errorf("Expected the change to be audited, got %+v", event)
+	}
+
+	loggedIn, err := env.Service.Login(ctx, login)
+	if err != nil {
+		t.Fatalf("Expected a limited user to login, got %v", err)
+	}
+	claims, err := env.Service.ValidateToken(ctx, loggedIn.AuthResponse.AccessToken)
+	if err != nil || !claims.Restricted {
+		t.Errorf("Expected a restricted token, got %+v (%v)", claims, err)
+	}
+
+	banned, err := restrictions.Set(ctx, userID, "admin", domain.RestrictionBanned)
+	if err != nil {
+		t.Fatalf("Failed to ban user: %v", err)
+	}
+	if banned.Restriction != domain.RestrictionBanned || banned.SessionsRevoked != 2 {
+		t.Errorf("Expected both sessions to be revoked, got %+v", banned)
+	}
+	if _, err := env.Service.Login(ctx, login); !errors.Is(err, service.ErrAccountBanned) {
+		t.Errorf("Expected ErrAccountBanned on login, got %v", err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, loggedIn.RefreshToken); err == nil {
+		t.Error("Expected the refresh token of a banned user to be refused")
+	}
+
+	auditor.events = nil
+	if _, err := restrictions.Set(ctx, userID, "admin", domain.RestrictionBanned); err != nil {
+		t.Fatalf("Failed to ban user again: %v", err)
+	}
+	if _, ok := auditor.last(service.AuditRestrictionChanged); ok {
+		t.Error("Expected an unchanged restriction not to be audited")
+	}
+
+	if _, err := restrictions.Set(ctx, userID, "admin", domain.RestrictionNone); err != nil {
+		t.Fatalf("Failed to lift restriction: %v", err)
+	}
+	loggedIn, err = env.Service.Login(ctx, login)
+	if err != nil {
+		t.Fatalf("Expected a lifted ban to allow login, got %v", err)
+	}
+	// Tokens issued within the second of the ban count as revoked, the claims are checked without it
+	if claims, err := env.JWT.ValidateToken(loggedIn.AuthResponse.AccessToken); err != nil || claims.Restricted {
+		t.Errorf("Expected an unrestricted token, got %+v (%v)", claims, err)
+	}
+
+	if _, err := restrictions.Set(ctx, userID, "admin", "suspended"); !errors.Is(err, service.ErrInvalidRestriction) {
+		t.Errorf("Expected ErrInvalidRestriction, got %v", err)
+	}
+	if _, err := restrictions.Set(ctx, "00000000-0000-0000-0000-000000000000", "admin", domain.RestrictionBanned); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown user, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	globalNotValidBeforeKey = "revocation:not-valid-before:global"
+	userNotValidBeforeKey   = "revocation:not-valid-before:user:"
+)
+
+// raiseScript atomically replaces the unix time stored in KEYS[1] with ARGV[1] if it is later,
+// the key expires after ARGV[2] milliseconds
+var raiseScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return nil
+`)
+
+// Revocation describes tokens revoked at once, e.g. after a credential leak
+type Revocation struct {
+	// UserID limits the revocation to the tokens of a user, all users are affected when empty
+	UserID string
+	// IssuedBefore revokes tokens issued before this moment, zero means now
+	IssuedBefore time.Time
+}
+
+// RevocationResult reports what a revocation affected
+type RevocationResult struct {
+	// NotValidBefore is the moment access tokens must have been issued at or after to stay valid
+	NotValidBefore time.Time
+	// RefreshTokensDeleted is the number of sessions ended
+	RefreshTokensDeleted int64
+}
+
+// RevocationHook is run after tokens were revoked
+type RevocationHook func(ctx context.Context, r Revocation)
+
+// RevocationService revokes tokens by user or issue time
+// Refresh tokens are revoked, access tokens are stateless and rejected by ValidateToken
+// through a "not valid before" time kept in Redis for as long as access tokens live.
+type RevocationService struct {
+	redis             *database.Redis
+	tokenRepo         repository.TokenRepository
+	accessTokenExpiry time.Duration
+	hooks             []RevocationHook
+}
+
+// NewRevocationService creates a new revocation service
+func NewRevocationService(redis *database.Redis, tokenRepo repository.TokenRepository, accessTokenExpiry time.Duration) *RevocationService {
+	return &RevocationService{
+		redis:             redis,
+		tokenRepo:         tokenRepo,
+		accessTokenExpiry: accessTokenExpiry,
+	}
+}
+
+// OnRevoke adds a hook run after tokens were revoked
+// Hooks must be added before the service is used.
+func (s *RevocationService) OnRevoke(hook RevocationHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Revoke revokes the tokens described by r
+func (s *RevocationService) Revoke(ctx context.Context, r Revocation) (_ *RevocationResult, err error) {
+	ctx, span := tracer.Start(ctx, "RevocationService.Revoke")
+	defer func() { endSpan(span, err) }()
+
+	now := time.Now()
+	before := r.IssuedBefore
+	if before.IsZero() || before.After(now) {
+		before = now
+	}
+	// Token issue times have second precision, tokens issued within the second are revoked too
+	notValidBefore := before.Truncate(time.Second)
+	if notValidBefore.Before(before) {
+		notValidBefore = notValidBefore.Add(time.Second)
+	}
+
+	key := globalNotValidBeforeKey
+	if r.UserID != "" {
+		key = userNotValidBeforeKey + r.UserID
+	}
+	// An earlier revocation covering more tokens is kept, access tokens issued before
+	// now-expiry are expired anyway
+	if now.Sub(notValidBefore) < s.accessTokenExpiry {
+		if err := s.raiseNotValidBefore(ctx, key, notValidBefore); err != nil {
+			return nil, err
+		}
+	}
+
+	deleted, err := s.tokenRepo.RevokeIssuedBefore(ctx, r.UserID, notValidBefore, domain.TokenRevokeRevocation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	for _, hook := range s.hooks {
+		hook(ctx, r)
+	}
+
+	return &RevocationResult{NotValidBefore: notValidBefore, RefreshTokensDeleted: deleted}, nil
+}
+
+// raiseNotValidBefore stores t under key unless a later time is stored already
+func (s *RevocationService) raiseNotValidBefore(ctx context.Context, key string, t time.Time) error {
+	err := raiseScript.Run(ctx, s.redis.Client, []string{key}, t.Unix(), s.accessTokenExpiry.Milliseconds()).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to store not valid before time: %w", err)
+	}
+	return nil
+}
+
+// IsRevoked reports whether a token of the user issued at the given unix time was revoked
+func (s *RevocationService) IsRevoked(ctx context.Context, userID string, issuedAt int64) (bool, error) {
+	values, err := s.redis.Client.MGet(ctx, globalNotValidBeforeKey, userNotValidBeforeKey+userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to read not valid before times: %w", err)
+	}
+
+	for _, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		notValidBefore, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid not valid before time %q: %w", str, err)
+		}
+		if issuedAt < notValidBefore {
+			return true, nil
+		}
+	}
+	return false, nil
+}
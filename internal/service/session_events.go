@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// sessionEventsChannel carries the session events of all users to all replicas
+const sessionEventsChannel = "session_events"
+
+// sessionEventsTicketKey holds the claims of the access token a stream ticket was issued for
+const sessionEventsTicketKey = "session_events:ticket:"
+
+// SessionEventsTicketTTL is how long a stream ticket can be redeemed
+const SessionEventsTicketTTL = 30 * time.Second
+
+// sessionEventsBuffer is the number of events kept for a slow subscriber before they are dropped
+const sessionEventsBuffer = 16
+
+// Session event types
+const (
+	// SessionEventRevoked is published when a session ends, by logout or revocation from another device
+	SessionEventRevoked = "session_revoked"
+	// SessionEventPasswordChanged is published when the password of the user changes
+	SessionEventPasswordChanged = "password_changed"
+	// SessionEventLogoutAll is published when all sessions of the user are ended at once
+	SessionEventLogoutAll = "logout_all"
+)
+
+// SessionEvent tells the clients of a user that some of their sessions ended
+type SessionEvent struct {
+	Type string `json:"type"`
+	// UserID is the user the event is for, every user when empty
+	UserID string `json:"user_id,omitempty"`
+	// SessionID is the session that ended, for SessionEventRevoked
+	SessionID string `json:"session_id,omitempty"`
+	At        int64  `json:"at"`
+}
+
+// SessionEvents fans session events out to the clients connected to any replica
+// Events are published through Redis pub/sub, every replica delivers them to its local
+// subscribers. Delivery is best effort: events published while a replica isn't subscribed
+// or that a slow subscriber doesn't read in time are lost, clients still get 401 afterwards.
+type SessionEvents struct {
+	redis *database.Redis
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan SessionEvent]struct{}
+	closed      bool
+}
+
+// NewSessionEvents creates session events
+func NewSessionEvents(redis *database.Redis) *SessionEvents {
+	return &SessionEvents{
+		redis:       redis,
+		subscribers: make(map[string]map[chan SessionEvent]struct{}),
+	}
+}
+
+// Publish sends an event to the clients of its user on all replicas
+// Failures are logged, they don't fail the action the event is about.
+func (e *SessionEvents) Publish(ctx context.Context, event SessionEvent) {
+	if event.At == 0 {
+		event.At = time.Now().Unix()
+	}
+
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = e.redis.Client.Publish(ctx, sessionEventsChannel, payload).Err()
+	}
+	if err != nil {
+		observability.LoggerFromContext(ctx).Warn("Failed to publish session event",
+			zap.String("type", event.Type), zap.String("user_id", event.UserID), zap.Error(err))
+	}
+}
+
+// Subscribe returns the events of a user published from now on and a function to unsubscribe
+// The channel is closed by Close, when the service shuts down.
+func (e *SessionEvents) Subscribe(userID string) (<-chan SessionEvent, func()) {
+	events := make(chan SessionEvent, sessionEventsBuffer)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		close(events)
+		return events, func() {}
+	}
+	if e.subscribers[userID] == nil {
+		e.subscribers[userID] = make(map[chan SessionEvent]struct{})
+	}
+	e.subscribers[userID][events] = struct{}{}
+
+	return events, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subscribers[userID][events]; !ok {
+			return
+		}
+		delete(e.subscribers[userID], events)
+		if len(e.subscribers[userID]) == 0 {
+			delete(e.subscribers, userID)
+		}
+		close(events)
+	}
+}
+
+// Run delivers the events published by any replica to the local subscribers until ctx is cancelled
+func (e *SessionEvents) Run(ctx context.Context) {
+	pubsub := e.redis.Client.Subscribe(ctx, sessionEventsChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event SessionEvent
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				observability.LoggerFromContext(ctx).Warn("Failed to decode session event", zap.Error(err))
+				continue
+			}
+			e.deliver(event)
+		}
+	}
+}
+
+// IssueTicket issues a one-time ticket opening the stream of the user of an access token
+// Browsers' EventSource can't send an Authorization header, the ticket is passed in the URL instead.
+// Streams opened with it end when the access token expires.
+func (e *SessionEvents) IssueTicket(ctx context.Context, claims *domain.TokenClaims) (string, error) {
+	ticket, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	if err := e.redis.Client.Set(ctx, sessionEventsTicketKey+hashOpaqueToken(ticket), payload, SessionEventsTicketTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store stream ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// RedeemTicket returns the claims a ticket was issued for, each ticket can be redeemed once
+func (e *SessionEvents) RedeemTicket(ctx context.Context, ticket string) (*domain.TokenClaims, error) {
+	payload, err := e.redis.Client.GetDel(ctx, sessionEventsTicketKey+hashOpaqueToken(ticket)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidToken
+		}
+		return nil, fmt.Errorf("failed to load stream ticket: %w", err)
+	}
+	var claims domain.TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode stream ticket: %w", err)
+	}
+	if claims.IsExpired() {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// Close closes the channels of all subscribers, so that their streams end on shutdown
+func (e *SessionEvents) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	for userID, channels := range e.subscribers {
+		for events := range channels {
+			close(events)
+		}
+		delete(e.subscribers, userID)
+	}
+}
+
+// deliver sends an event to the local subscribers of its user, or to all of them
+func (e *SessionEvents) deliver(event SessionEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if event.UserID != "" {
+		sendSessionEvent(e.subscribers[event.UserID], event)
+		return
+	}
+	for _, channels := range e.subscribers {
+		sendSessionEvent(channels, event)
+	}
+}
+
+// sendSessionEvent sends an event to subscribers, slow ones lose it rather than holding up the others
+func sendSessionEvent(channels map[chan SessionEvent]struct{}, event SessionEvent) {
+	for events := range channels {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
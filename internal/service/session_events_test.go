@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestSessionEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	redis := testutil.NewRedis(t)
+
+	events := service.NewSessionEvents(redis)
+	go events.Run(ctx)
+	// Events published before the replica subscribed are lost
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		subscribed, err := redis.Client.PubSubNumSub(ctx, "session_events").Result()
+		if err == nil && subscribed["session_events"] > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the subscription")
+		}
+	}
+
+	alice, unsubscribeAlice := events.Subscribe("alice")
+	defer unsubscribeAlice()
+	bob, unsubscribeBob := events.Subscribe("bob")
+
+	revocations := service.NewRevocationService(redis, testutil.NewAuthEnv(t).Repos.Token, 15*time.Minute)
+	revocations.OnRevoke(func(ctx context.Context, r service.Revocation) {
+		events.Publish(ctx, service.SessionEvent{Type: service.SessionEventLogoutAll, UserID: r.UserID})
+	})
+	if _, err := revocations.Revoke(ctx, service.Revocation{UserID: "alice"}); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	if event := receiveSessionEvent(t, alice); event.Type != service.SessionEventLogoutAll || event.UserID != "alice" || event.At == 0 {
+		t.Errorf("Expected logout_all for alice, got %+v", event)
+	}
+
+	// Events without user are for everyone
+	events.Publish(ctx, service.SessionEvent{Type: service.SessionEventLogoutAll})
+	receiveSessionEvent(t, alice)
+	if event := receiveSessionEvent(t, bob); event.Type != service.SessionEventLogoutAll {
+		t.Errorf("Expected logout_all for bob, got %+v", event)
+	}
+	select {
+	case event := <-bob:
+		t.Errorf("Expected no event of alice for bob, got %+v", event)
+	default:
+	}
+
+	unsubscribeBob()
+	if _, ok := <-bob; ok {
+		t.Error("Expected the channel of bob to be closed by unsubscribing")
+	}
+
+	events.Close()
+	if _, ok := <-alice; ok {
+		t.Error("Expected the channel of alice to be closed on shutdown")
+	}
+	carol, _ := events.Subscribe("carol")
+	if _, ok := <-carol; ok {
+		t.Error("Expected subscriptions after shutdown to be closed")
+	}
+}
+
+func receiveSessionEvent(t *testing.T, events <-chan service.SessionEvent) service.SessionEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a session event")
+		return service.SessionEvent{}
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Supported shadow identity providers
+const (
+	ShadowIdPProviderNone     = "none"
+	ShadowIdPProviderKeycloak = "keycloak"
+)
+
+// FeatureShadowIdP is the feature flag users are mirrored to the shadow identity provider for
+// Unknown flags are off, so nothing is mirrored until it is turned on; turning it off through
+// the admin API is the kill switch.
+const FeatureShadowIdP = "shadow_idp"
+
+// Results of mirrored operations in metrics
+const (
+	shadowResultCreated = "created"
+	shadowResultSynced  = "synced"
+	shadowResultMatch   = "match"
+	shadowResultError   = "error"
+	shadowResultDropped = "dropped"
+)
+
+// ErrExternalUserExists is returned by ExternalIdP.CreateUser when the user already exists
+var ErrExternalUserExists = errors.New("user already exists in the external identity provider")
+
+// ExternalIdP is the API of an identity provider the service may migrate to
+type ExternalIdP interface {
+	// CreateUser creates a user with a password, ErrExternalUserExists if it already exists
+	CreateUser(ctx context.Context, user *domain.User, password string) error
+	// SetPassword replaces the password of an existing user
+	SetPassword(ctx context.Context, user *domain.User, password string) error
+	// VerifyPassword reports whether the provider accepts the password of a user, false for unknown users
+	VerifyPassword(ctx context.Context, user *domain.User, password string) (bool, error)
+}
+
+// ShadowIdP mirrors registrations and successful password checks to an external identity provider,
+// so that users can be moved to it gradually instead of all at once.
+//
+// Mirroring runs in the background and never affects the response. After a successful login the
+// password is verified with the provider too: users it doesn't know are created, and users whose
+// password differs get it replaced, so the provider converges as users log in. Mirroring is limited
+// to the users the FeatureShadowIdP flag is on for, which also allows rolling it out by percentage.
+type ShadowIdP struct {
+	idp     ExternalIdP
+	flags   *FeatureFlags
+	timeout time.Duration
+	// slots bounds concurrent mirrors, mirrors are dropped rather than queued when they are taken
+	slots chan struct{}
+
+	calls    metric.Int64Counter
+	duration metric.Float64Histogram
+	mirrors  metric.Int64Counter
+}
+
+// NewShadowIdP creates a shadow identity provider running at most concurrency mirrors at once,
+// each bounded by timeout
+func NewShadowIdP(idp ExternalIdP, flags *FeatureFlags, timeout time.Duration, concurrency int) *ShadowIdP {
+	s := &ShadowIdP{
+		idp:     idp,
+		flags:   flags,
+		timeout: timeout,
+		slots:   make(chan struct{}, concurrency),
+	}
+
+	var err error
+	if s.calls, err = meter.Int64Counter("auth.shadow_idp.calls",
+		metric.WithDescription("Number of calls to the shadow identity provider, by operation and outcome (success or error)"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create shadow idp calls counter: %w", err))
+	}
+	if s.duration, err = meter.Float64Histogram("auth.shadow_idp.duration",
+		metric.WithDescription("Duration of calls to the shadow identity provider, by operation"),
+		metric.WithUnit("s"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create shadow idp duration histogram: %w", err))
+	}
+	if s.mirrors, err = meter.Int64Counter("auth.shadow_idp.mirrors",
+		metric.WithDescription("Number of registrations and logins mirrored, by event and result (match, created, synced, error or dropped)"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create shadow idp mirrors counter: %w", err))
+	}
+
+	return s
+}
+
+// MirrorRegistration creates a registered user in the provider, or replaces the password of an existing one
+func (s *ShadowIdP) MirrorRegistration(ctx context.Context, user *domain.User, password string) {
+	s.mirror(ctx, "registration", user, func(ctx context.Context, user *domain.User) (string, error) {
+		err := s.call(ctx, "create_user", func(ctx context.Context) error {
+			return s.idp.CreateUser(ctx, user, password)
+		})
+		if !errors.Is(err, ErrExternalUserExists) {
+			return shadowResultCreated, err
+		}
+		return shadowResultSynced, s.call(ctx, "set_password", func(ctx context.Context) error {
+			return s.idp.SetPassword(ctx, user, password)
+		})
+	})
+}
+
+// MirrorLogin verifies the password a user logged in with in the provider, creating the user or
+// replacing the password when the provider doesn't accept it
+func (s *ShadowIdP) MirrorLogin(ctx context.Context, user *domain.User, password string) {
+	s.mirror(ctx, "login", user, func(ctx context.Context, user *domain.User) (string, error) {
+		var valid bool
+		err := s.call(ctx, "verify_password", func(ctx context.Context) (err error) {
+			valid, err = s.idp.VerifyPassword(ctx, user, password)
+			return err
+		})
+		if err != nil || valid {
+			return shadowResultMatch, err
+		}
+
+		err = s.call(ctx, "create_user", func(ctx context.Context) error {
+			return s.idp.CreateUser(ctx, user, password)
+		})
+		if !errors.Is(err, ErrExternalUserExists) {
+			return shadowResultCreated, err
+		}
+		return shadowResultSynced, s.call(ctx, "set_password", func(ctx context.Context) error {
+			return s.idp.SetPassword(ctx, user, password)
+		})
+	})
+}
+
+// mirror runs fn in the background for users the flag is on for, with a copy of the user
+func (s *ShadowIdP) mirror(ctx context.Context, event string, user *domain.User, fn func(ctx context.Context, user *domain.User) (string, error)) {
+	if s == nil || !s.flags.Enabled(FeatureShadowIdP, user.ID, "") {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	copied := *user
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.record(ctx, event, shadowResultDropped)
+		return
+	}
+
+	go func() {
+		defer func() { <-s.slots }()
+		ctx, cancel := context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+
+		result, err := fn(ctx, &copied)
+		if err != nil {
+			result = shadowResultError
+			observability.LoggerFromContext(ctx).Warn("Failed to mirror to the shadow identity provider",
+				zap.String("event", event), zap.String("user_id", copied.ID), zap.Error(err))
+		}
+		s.record(ctx, event, result)
+	}()
+}
+
+// call runs a call to the provider, counting and timing it
+func (s *ShadowIdP) call(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	err := fn(ctx)
+
+	outcome := "success"
+	if err != nil && !errors.Is(err, ErrExternalUserExists) {
+		outcome = "error"
+	}
+	attrs := metric.WithAttributes(attribute.String("operation", operation))
+	s.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+	s.calls.Add(ctx, 1, attrs, metric.WithAttributes(attribute.String("outcome", outcome)))
+	return err
+}
+
+func (s *ShadowIdP) record(ctx context.Context, event, result string) {
+	s.mirrors.Add(ctx, 1, metric.WithAttributes(attribute.String("event", event), attribute.String("result", result)))
+}
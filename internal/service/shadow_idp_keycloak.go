@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+)
+
+// keycloakTokenMargin renews admin tokens this long before they expire
+const keycloakTokenMargin = 30 * time.Second
+
+// keycloakIdP implements ExternalIdP with the admin REST API of a Keycloak realm
+// The client authenticates with the client credentials grant, its service account needs the
+// manage-users role of realm-management, and passwords are verified with the password grant,
+// which requires direct access grants to be enabled for the client. Users are named by email.
+type keycloakIdP struct {
+	baseURL      string
+	realm        string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewKeycloakIdP creates an ExternalIdP for a realm of the Keycloak server at baseURL
+func NewKeycloakIdP(baseURL, realm, clientID, clientSecret string, client *http.Client) ExternalIdP {
+	return &keycloakIdP{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		realm:        realm,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+	}
+}
+
+type keycloakCredential struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Temporary bool   `json:"temporary"`
+}
+
+// CreateUser creates an enabled user with the password, linked to the user of the service by attribute
+func (k *keycloakIdP) CreateUser(ctx context.Context, user *domain.User, password string) error {
+	body := map[string]any{
+		"username":      user.Email,
+		"email":         user.Email,
+		"emailVerified": user.IsEmailVerified,
+		"enabled":       user.IsActive,
+		"attributes":    map[string][]string{"auth_service_id": {user.ID}},
+		"credentials":   []keycloakCredential{{Type: "password", Value: password}},
+	}
+	if user.FirstName != nil {
+		body["firstName"] = *user.FirstName
+	}
+	if user.LastName != nil {
+		body["lastName"] = *user.LastName
+	}
+
+	resp, err := k.admin(ctx, http.MethodPost, "/users", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return ErrExternalUserExists
+	default:
+		return keycloakError("create user", resp)
+	}
+}
+
+// SetPassword looks the user up by email and resets its password
+func (k *keycloakIdP) SetPassword(ctx context.Context, user *domain.User, password string) error {
+	resp, err := k.admin(ctx, http.MethodGet, "/users?exact=true&email="+url.QueryEscape(user.Email), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return keycloakError("find user", resp)
+	}
+	var users []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
+		return fmt.Errorf("failed to decode keycloak users: %w", err)
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("keycloak user %s not found", user.ID)
+	}
+
+	reset, err := k.admin(ctx, http.MethodPut, "/users/"+url.PathEscape(users[0].ID)+"/reset-password",
+		keycloakCredential{Type: "password", Value: password})
+	if err != nil {
+		return err
+	}
+	defer reset.Body.Close()
+	if reset.StatusCode != http.StatusNoContent {
+		return keycloakError("reset password", reset)
+	}
+	return nil
+}
+
+// VerifyPassword asks for a token with the password grant, rejected grants mean a wrong password or unknown user
+func (k *keycloakIdP) VerifyPassword(ctx context.Context, user *domain.User, password string) (bool, error) {
+	resp, err := k.tokenRequest(ctx, url.Values{
+		"grant_type": {"password"},
+		"username":   {user.Email},
+		"password":   {password},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusUnauthorized, http.StatusBadRequest:
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Error == "invalid_grant" {
+			return false, nil
+		}
+		return false, fmt.Errorf("keycloak rejected the password grant with status %d: %s", resp.StatusCode, body.Error)
+	default:
+		return false, keycloakError("verify password", resp)
+	}
+}
+
+// admin sends a request to the admin API of the realm, with body encoded as JSON unless nil
+func (k *keycloakIdP) admin(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	token, err := k.adminToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode keycloak request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, k.baseURL+"/admin/realms/"+url.PathEscape(k.realm)+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keycloak request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call keycloak: %w", err)
+	}
+	return resp, nil
+}
+
+// adminToken returns an access token of the service account, cached until shortly before it expires
+func (k *keycloakIdP) adminToken(ctx context.Context) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.token != "" && time.Now().Before(k.tokenExpiry) {
+		return k.token, nil
+	}
+
+	resp, err := k.tokenRequest(ctx, url.Values{"grant_type": {"client_credentials"}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", keycloakError("get admin token", resp)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode keycloak token: %w", err)
+	}
+	k.token = body.AccessToken
+	k.tokenExpiry = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - keycloakTokenMargin)
+	return k.token, nil
+}
+
+// tokenRequest posts a grant to the token endpoint of the realm as the client
+func (k *keycloakIdP) tokenRequest(ctx context.Context, form url.Values) (*http.Response, error) {
+	form.Set("client_id", k.clientID)
+	form.Set("client_secret", k.clientSecret)
+
+	endpoint := k.baseURL + "/realms/" + url.PathEscape(k.realm) + "/protocol/openid-connect/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keycloak token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call keycloak: %w", err)
+	}
+	return resp, nil
+}
+
+// keycloakError describes an unexpected response, with the start of its body
+func keycloakError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("failed to %s in keycloak: status %d: %s", action, resp.StatusCode, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,198 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+)
+
+// fakeIdP keeps passwords by email and reports every call on calls
+type fakeIdP struct {
+	mu        sync.Mutex
+	passwords map[string]string
+	calls     chan string
+}
+
+func (f *fakeIdP) CreateUser(ctx context.Context, user *domain.User, password string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer func() { f.calls <- "create_user" }()
+	if _, ok := f.passwords[user.Email]; ok {
+		return service.ErrExternalUserExists
+	}
+	f.passwords[user.Email] = password
+	return nil
+}
+
+func (f *fakeIdP) SetPassword(ctx context.Context, user *domain.User, password string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer func() { f.calls <- "set_password" }()
+	f.passwords[user.Email] = password
+	return nil
+}
+
+func (f *fakeIdP) VerifyPassword(ctx context.Context, user *domain.User, password string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer func() { f.calls <- "verify_password" }()
+	stored, ok := f.passwords[user.Email]
+	return ok && stored == password, nil
+}
+
+func TestShadowIdP(t *testing.T) {
+	ctx := context.Background()
+	idp := &fakeIdP{passwords: map[string]string{}, calls: make(chan string, 10)}
+	flags := service.NewFeatureFlags([]domain.FeatureFlag{{Name: service.FeatureShadowIdP, Percentage: 100}}, nil, 0)
+	shadow := service.NewShadowIdP(idp, flags, time.Second, 10)
+
+	expectCalls := func(expected ...string) {
+		t.Helper()
+		for _, call := range expected {
+			select {
+			case got := <-idp.calls:
+				if got != call {
+					t.Fatalf("Expected %s, got %s", call, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for %s", call)
+			}
+		}
+	}
+
+	alice := &domain.User{ID: "alice", Email: "alice@example.com"}
+	shadow.MirrorRegistration(ctx, alice, "Password123")
+	expectCalls("create_user")
+
+	// Known passwords are only verified
+	shadow.MirrorLogin(ctx, alice, "Password123")
+	expectCalls("verify_password")
+
+	// Passwords changed in the service are replaced on the next login
+	shadow.MirrorLogin(ctx, alice, "Changed123")
+	expectCalls("verify_password", "create_user", "set_password")
+
+	// Users registered before mirroring are created on login
+	bob := &domain.User{ID: "bob", Email: "bob@example.com"}
+	shadow.MirrorLogin(ctx, bob, "Password123")
+	expectCalls("verify_password", "create_user")
+
+	idp.mu.Lock()
+	if idp.passwords["alice@example.com"] != "Changed123" || idp.passwords["bob@example.com"] != "Password123" {
+		t.Errorf("Expected the passwords of the service, got %v", idp.passwords)
+	}
+	idp.mu.Unlock()
+
+	// The feature flag is the kill switch
+	off := service.NewShadowIdP(idp, service.NewFeatureFlags(nil, nil, 0), time.Second, 1)
+	off.MirrorRegistration(ctx, &domain.User{ID: "carol", Email: "carol@example.com"}, "Password123")
+	var disabled *service.ShadowIdP
+	disabled.MirrorLogin(ctx, alice, "Password123")
+	select {
+	case call := <-idp.calls:
+		t.Errorf("Expected nothing to be mirrored, got %s", call)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestKeycloakIdP(t *testing.T) {
+	var mu sync.Mutex
+	passwords := map[string]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /realms/auth/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("client_id") != "auth-service" || r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials":
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "admin-token", "expires_in": 300})
+		case "password":
+			if stored, ok := passwords[r.PostForm.Get("username")]; !ok || stored != r.PostForm.Get("password") {
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "user-token"})
+		}
+	})
+	admin := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer admin-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			handler(w, r)
+		}
+	}
+	mux.HandleFunc("POST /admin/realms/auth/users", admin(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Username    string `json:"username"`
+			Credentials []struct {
+				Value string `json:"value"`
+			} `json:"credentials"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := passwords[body.Username]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		passwords[body.Username] = body.Credentials[0].Value
+		w.WriteHeader(http.StatusCreated)
+	}))
+	mux.HandleFunc("GET /admin/realms/auth/users", admin(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]string{{"id": "kc-" + r.URL.Query().Get("email")}})
+	}))
+	mux.HandleFunc("PUT /admin/realms/auth/users/{id}/reset-password", admin(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Value string `json:"value"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		passwords[r.PathValue("id")[len("kc-"):]] = body.Value
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	idp := service.NewKeycloakIdP(server.URL+"/", "auth", "auth-service", "secret", server.Client())
+	user := &domain.User{ID: "user-1", Email: "user@example.com", IsActive: true}
+
+	if err := idp.CreateUser(ctx, user, "Password123"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := idp.CreateUser(ctx, user, "Password123"); !errors.Is(err, service.ErrExternalUserExists) {
+		t.Errorf("Expected ErrExternalUserExists, got %v", err)
+	}
+	if valid, err := idp.VerifyPassword(ctx, user, "Password123"); err != nil || !valid {
+		t.Errorf("Expected the password to be accepted, got %v (%v)", valid, err)
+	}
+	if err := idp.SetPassword(ctx, user, "Changed123"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if valid, err := idp.VerifyPassword(ctx, user, "Password123"); err != nil || valid {
+		t.Errorf("Expected the old password to be refused, got %v (%v)", valid, err)
+	}
+	if valid, err := idp.VerifyPassword(ctx, user, "Changed123"); err != nil || !valid {
+		t.Errorf("Expected the new password to be accepted, got %v (%v)", valid, err)
+	}
+
+	// Rejected clients are errors rather than wrong passwords
+	misconfigured := service.NewKeycloakIdP(server.URL, "auth", "auth-service", "wrong", server.Client())
+	if _, err := misconfigured.VerifyPassword(ctx, user, "Changed123"); err == nil {
+		t.Error("Expected an error for a rejected client")
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/siwe"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// siweNonceKey is set while a nonce can be signed in with
+	siweNonceKey = "siwe:nonce:"
+
+	defaultSIWENonceTTL = 5 * time.Minute
+
+	// walletEmailDomain is the domain of the placeholder emails of users created for wallets, .invalid
+	// never resolves (RFC 2606)
+	walletEmailDomain = "wallet.invalid"
+)
+
+// SIWEConfig configures sign-in with Ethereum
+type SIWEConfig struct {
+	// Domain is the domain messages must be issued for, e.g. app.example.com
+	Domain string
+	// ChainIDs are the chains messages may name
+	ChainIDs []int64
+	// NonceTTL is how long users have to sign a message after requesting its nonce
+	NonceTTL time.Duration
+	// Registration creates users for wallets linked to no user
+	Registration bool
+	// InvitationRequired refuses new users, registration requires an invitation
+	InvitationRequired bool
+	// EmailDomains refuses new users when it allows some domains only, wallets have no email
+	EmailDomains *EmailDomainPolicy
+}
+
+// SIWEService signs users in with Ethereum wallets (EIP-4361)
+// Clients request a nonce with Nonce, have the wallet sign a message carrying it and send the
+// message and signature to SignIn. Wallets are stored as identities of their user, users created
+// for wallets get a placeholder email and no password.
+type SIWEService struct {
+	auth         AuthService
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	redis        *database.Redis
+	config       SIWEConfig
+}
+
+// NewSIWEService creates a service signing users in with messages issued for config.Domain
+func NewSIWEService(
+	auth AuthService,
+	userRepo repository.UserRepository,
+	identityRepo repository.IdentityRepository,
+	redis *database.Redis,
+	config SIWEConfig,
+) *SIWEService {
+	if config.NonceTTL <= 0 {
+		config.NonceTTL = defaultSIWENonceTTL
+	}
+	return &SIWEService{
+		auth:         auth,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		redis:        redis,
+		config:       config,
+	}
+}
+
+// Nonce issues a nonce for a message to sign, each nonce can be signed in with once
+func (s *SIWEService) Nonce(ctx context.Context) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "SIWEService.Nonce")
+	defer func() { endSpan(span, err) }()
+
+	nonce, err := siwe.GenerateNonce()
+	if err != nil {
+		return "", err
+	}
+	if err := s.redis.Client.Set(ctx, siweNonceKey+nonce, 1, s.config.NonceTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// SignIn verifies a signed EIP-4361 message and starts a session for the user of its wallet
+func (s *SIWEService) SignIn(ctx context.Context, message, signature string) (_ *AuthResponseWithRefreshToken, err error) {
+	ctx, span := tracer.Start(ctx, "SIWEService.SignIn")
+	defer func() { endSpan(span, err) }()
+
+	m, err := siwe.Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSIWEMessage, err)
+	}
+	if !strings.EqualFold(m.Domain, s.config.Domain) {
+		return nil, fmt.Errorf("%w: domain %s is not accepted", ErrInvalidSIWEMessage, m.Domain)
+	}
+	if !slices.Contains(s.config.ChainIDs, m.ChainID) {
+		return nil, fmt.Errorf("%w: chain %d is not accepted", ErrInvalidSIWEMessage, m.ChainID)
+	}
+	if err := m.Valid(time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSIWEMessage, err)
+	}
+
+	// The signature is checked before the nonce is consumed, so forged messages can't use up
+	// nonces of others
+	address, err := siwe.RecoverAddress(message, signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSIWESignature, err)
+	}
+	if address != m.Address {
+		return nil, ErrInvalidSIWESignature
+	}
+
+	if err := s.redis.Client.GetDel(ctx, siweNonceKey+m.Nonce).Err(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: unknown nonce", ErrInvalidSIWEMessage)
+		}
+		return nil, fmt.Errorf("failed to load nonce: %w", err)
+	}
+
+	userID, err := s.userOf(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.IssueSession(ctx, userID)
+}
+
+// userOf returns the user of a wallet, creating one for wallets linked to no user
+func (s *SIWEService) userOf(ctx context.Context, address string) (string, error) {
+	identity, err := s.identityRepo.GetBySubject(ctx, domain.IdentityTypeEthereum, address)
+	if err == nil {
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return "", fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	if !s.config.Registration {
+		return "", ErrFeatureDisabled
+	}
+	if s.config.InvitationRequired {
+		return "", ErrInvitationRequired
+	}
+	if len(s.config.EmailDomains.AllowList(ctx)) > 0 {
+		return "", ErrEmailDomainNotAllowed
+	}
+
+	email := strings.ToLower(address) + "@" + walletEmailDomain
+	user := &domain.User{Email: email, EmailNormalized: email, IsActive: true}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+	if err := s.identityRepo.Create(ctx, &domain.Identity{
+		UserID:  user.ID,
+		Type:    domain.IdentityTypeEthereum,
+		Subject: address,
+	}); err != nil {
+		return "", fmt.Errorf("failed to link wallet: %w", err)
+	}
+	return user.ID, nil
+}
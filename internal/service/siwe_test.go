@@ -0,0 +1,152 @@
+package service_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/siwe"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// walletAddress is the address of the private key 1
+const walletAddress = "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"
+
+// siweMessage returns a message of walletAddress and its personal_sign signature by key
+func siweMessage(key byte, domainName string, chainID int, nonce string) (string, string) {
+	message := fmt.Sprintf("%s wants you to sign in with your Ethereum account:\n%s\n\nSign in to Example\n\nURI: https://%s\nVersion: 1\nChain ID: %d\nNonce: %s\nIssued At: %s",
+		domainName, walletAddress, domainName, chainID, nonce, time.Now().UTC().Format(time.RFC3339))
+	compact := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes([]byte{key}), siwe.HashMessage(message), false)
+	return message, "0x" + hex.EncodeToString(append(compact[1:], compact[0]))
+}
+
+func TestSIWEServiceSignIn(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	siweService := service.NewSIWEService(env.Service, env.Repos.User, env.Repos.Identity, env.Redis, service.SIWEConfig{
+		Domain:       "app.example.com",
+		ChainIDs:     []int64{1},
+		Registration: true,
+	})
+
+	nonce, err := siweService.Nonce(ctx)
+	if err != nil {
+		t.Fatalf("Failed to issue nonce: %v", err)
+	}
+	message, signature := siweMessage(1, "app.example.com", 1, nonce)
+	response, err := siweService.SignIn(ctx, message, signature)
+	if err != nil {
+		t.Fatalf("Failed to sign in: %v", err)
+	}
+	identity, err := env.Repos.Identity.GetBySubject(ctx, domain.IdentityTypeEthereum, walletAddress)
+	if err != nil || identity.UserID != response.AuthResponse.User.ID {
+		t.Fatalf("Expected the wallet to be linked to the new user, got %v %v", identity, err)
+	}
+
+	// The nonce is used up
+	if _, err := siweService.SignIn(ctx, message, signature); !errors.Is(err, service.ErrInvalidSIWEMessage) {
+		t.Errorf("Expected ErrInvalidSIWEMessage for a used nonce, got %v", err)
+	}
+
+	// Signing in again returns the same user
+	nonce, _ = siweService.Nonce(ctx)
+	message, signature = siweMessage(1, "app.example.com", 1, nonce)
+	again, err := siweService.SignIn(ctx, message, signature)
+	if err != nil || again.AuthResponse.User.ID != response.AuthResponse.User.ID {
+		t.Fatalf("Expected to sign in as the same user, got %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     byte
+		domain  string
+		chainID int
+		want    error
+	}{
+		{name: "another domain", key: 1, domain: "evil.example.com", chainID: 1, want: service.ErrInvalidSIWEMessage},
+		{name: "another chain", key: 1, domain: "app.example.com", chainID: 5, want: service.ErrInvalidSIWEMessage},
+		{name: "signed by another key", key: 2, domain: "app.example.com", chainID: 1, want: service.ErrInvalidSIWESignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce, _ := siweService.Nonce(ctx)
+			message, signature := siweMessage(tt.key, tt.domain, tt.chainID, nonce)
+			if _, err := siweService.SignIn(ctx, message, signature); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	message, signature = siweMessage(1, "app.example.com", 1, "unissuednonce")
+	if _, err := siweService.SignIn(ctx, message, signature); !errors.Is(err, service.ErrInvalidSIWEMessage) {
+		t.Errorf("Expected ErrInvalidSIWEMessage for an unknown nonce, got %v", err)
+	}
+}
+
+func TestSIWEServiceRegistrationClosed(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	siweService := service.NewSIWEService(env.Service, env.Repos.User, env.Repos.Identity, env.Redis, service.SIWEConfig{
+		Domain:   "app.example.com",
+		ChainIDs: []int64{1},
+	})
+
+	nonce, _ := siweService.Nonce(ctx)
+	message, signature := siweMessage(1, "app.example.com", 1, nonce)
+	if _, err := siweService.SignIn(ctx, message, signature); !errors.Is(err, service.ErrFeatureDisabled) {
+		t.Errorf("Expected ErrFeatureDisabled for a new wallet, got %v", err)
+	}
+}
+
+func TestSIWEServiceEmailDomains(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	siweService := service.NewSIWEService(env.Service, env.Repos.User, env.Repos.Identity, env.Redis, service.SIWEConfig{
+		Domain:       "app.example.com",
+		ChainIDs:     []int64{1},
+		Registration: true,
+		EmailDomains: service.NewEmailDomainPolicy([]string{"acme.com"}),
+	})
+
+	nonce, _ := siweService.Nonce(ctx)
+	message, signature := siweMessage(1, "app.example.com", 1, nonce)
+	if _, err := siweService.SignIn(ctx, message, signature); !errors.Is(err, service.ErrEmailDomainNotAllowed) {
+		t.Errorf("Expected ErrEmailDomainNotAllowed for a new wallet, got %v", err)
+	}
+}
+
+func TestSIWEServiceEmailVerificationBlock(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour), utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0,
+		service.WithEmailVerification(service.EmailVerificationBlock))
+	siweService := service.NewSIWEService(auth, env.Repos.User, env.Repos.Identity, env.Redis, service.SIWEConfig{
+		Domain:       "app.example.com",
+		ChainIDs:     []int64{1},
+		Registration: true,
+	})
+
+	// Wallet users have a placeholder email, there is nothing to verify
+	for range 2 {
+		nonce, _ := siweService.Nonce(ctx)
+		message, signature := siweMessage(1, "app.example.com", 1, nonce)
+		if _, err := siweService.SignIn(ctx, message, signature); err != nil {
+			t.Fatalf("Expected the wallet user to sign in, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	statsCacheKey = "admin:stats:"
+	// statsLoginsKey holds the successful and failed logins of a UTC day
+	statsLoginsKey = "stats:logins:"
+	// statsActiveKey estimates the users logging in on a UTC day, with a HyperLogLog
+	statsActiveKey       = "stats:active:"
+	defaultStatsCacheTTL = time.Minute
+)
+
+// Statistics periods, in days
+const (
+	DefaultStatsDays = 30
+	// MaxStatsDays bounds the time-series, daily login counters are kept as long
+	MaxStatsDays = 90
+)
+
+// Login counter fields
+const (
+	statsLoginSuccess = "success"
+	statsLoginFailure = "failure"
+)
+
+// ErrInvalidStatsPeriod is returned for periods out of 1 to MaxStatsDays days
+var ErrInvalidStatsPeriod = errors.New("invalid statistics period")
+
+// StatsService computes the statistics of the admin dashboard
+// Users and sessions are counted in the database, logins aren't stored there and are counted per
+// day in Redis by RecordLogin. Results are cached in Redis so that dashboards polling them don't
+// load the database.
+type StatsService struct {
+	repo     repository.StatsRepository
+	redis    *database.Redis
+	cacheTTL time.Duration
+}
+
+// NewStatsService creates a new stats service
+func NewStatsService(repo repository.StatsRepository, redis *database.Redis, cacheTTL time.Duration) *StatsService {
+	if cacheTTL <= 0 {
+		cacheTTL = defaultStatsCacheTTL
+	}
+	return &StatsService{repo: repo, redis: redis, cacheTTL: cacheTTL}
+}
+
+// RecordLogin counts a login of the current UTC day, successful ones count the user as active
+// Failures are logged, they don't fail the login.
+func (s *StatsService) RecordLogin(ctx context.Context, userID string, success bool) {
+	day := time.Now().UTC().Format(time.DateOnly)
+	retention := (MaxStatsDays + 1) * 24 * time.Hour
+
+	field := statsLoginFailure
+	if success {
+		field = statsLoginSuccess
+	}
+
+	pipe := s.redis.Client.Pipeline()
+	pipe.HIncrBy(ctx, statsLoginsKey+day, field, 1)
+	pipe.Expire(ctx, statsLoginsKey+day, retention)
+	if success && userID != "" {
+		pipe.PFAdd(ctx, statsActiveKey+day, userID)
+		pipe.Expire(ctx, statsActiveKey+day, retention)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		observability.LoggerFromContext(ctx).Warn("Failed to count login", zap.Error(err))
+	}
+}
+
+// Stats returns the statistics of the last days UTC days, today included, from the cache if possible
+// Cache failures are logged and fall back to computing them.
+func (s *StatsService) Stats(ctx context.Context, days int) (_ *dto.AdminStatsResponse, err error) {
+	ctx, span := tracer.Start(ctx, "StatsService.Stats")
+	defer func() { endSpan(span, err) }()
+
+	if days < 1 || days > MaxStatsDays {
+		return nil, fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidStatsPeriod, MaxStatsDays)
+	}
+
+	logger := observability.LoggerFromContext(ctx)
+	key := statsCacheKey + strconv.Itoa(days)
+	value, err := s.redis.Client.Get(ctx, key).Bytes()
+	switch {
+	case err == nil:
+		var stats dto.AdminStatsResponse
+		if err := json.Unmarshal(value, &stats); err == nil {
+			return &stats, nil
+		}
+		logger.Warn("Failed to decode cached statistics", zap.Error(err))
+	case !errors.Is(err, redis.Nil):
+		logger.Warn("Failed to read cached statistics", zap.Error(err))
+	}
+
+	stats, err := s.compute(ctx, days, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if value, err := json.Marshal(stats); err == nil {
+		if err := s.redis.Client.Set(ctx, key, value, s.cacheTTL).Err(); err != nil {
+			logger.Warn("Failed to cache statistics", zap.Error(err))
+		}
+	}
+
+	return stats, nil
+}
+
+// compute computes the statistics of the days up to now
+func (s *StatsService) compute(ctx context.Context, days int, now time.Time) (*dto.AdminStatsResponse, error) {
+	stats := &dto.AdminStatsResponse{
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		Days:        days,
+		Daily:       make([]dto.DailyStats, days),
+	}
+
+	users, err := s.repo.CountUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Users = dto.UserStats{Total: users.Total, Active: users.Active, Verified: users.Verified}
+
+	for _, window := range []struct {
+		count  *int64
+		period time.Duration
+	}{
+		{&stats.ActiveUsers.Last24h, 24 * time.Hour},
+		{&stats.ActiveUsers.Last7d, 7 * 24 * time.Hour},
+		{&stats.ActiveUsers.Last30d, 30 * 24 * time.Hour},
+	} {
+		if *window.count, err = s.repo.CountActiveUsers(ctx, now.Add(-window.period)); err != nil {
+			return nil, err
+		}
+	}
+
+	if stats.ActiveSessions, err = s.repo.CountActiveSessions(ctx, now); err != nil {
+		return nil, err
+	}
+
+	first := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	registrations, err := s.repo.DailyRegistrations(ctx, first)
+	if err != nil {
+		return nil, err
+	}
+	perDay := make(map[string]int64, len(registrations))
+	for _, registration := range registrations {
+		perDay[registration.Day.Format(time.DateOnly)] = registration.Count
+	}
+
+	pipe := s.redis.Client.Pipeline()
+	logins := make([]*redis.MapStringStringCmd, days)
+	active := make([]*redis.IntCmd, days)
+	for i := range stats.Daily {
+		day := first.AddDate(0, 0, i).Format(time.DateOnly)
+		stats.Daily[i] = dto.DailyStats{Date: day, Registrations: perDay[day]}
+		logins[i] = pipe.HGetAll(ctx, statsLoginsKey+day)
+		active[i] = pipe.PFCount(ctx, statsActiveKey+day)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read login counters: %w", err)
+	}
+
+	for i := range stats.Daily {
+		daily := &stats.Daily[i]
+		counters := logins[i].Val()
+		daily.Logins, _ = strconv.ParseInt(counters[statsLoginSuccess], 10, 64)
+		daily.FailedLogins, _ = strconv.ParseInt(counters[statsLoginFailure], 10, 64)
+		daily.ActiveUsers = active[i].Val()
+		stats.Logins.Success += daily.Logins
+		stats.Logins.Failure += daily.FailedLogins
+	}
+	if total := stats.Logins.Success + stats.Logins.Failure; total > 0 {
+		stats.Logins.FailureRate = float64(stats.Logins.Failure) / float64(total)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,71 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestStatsService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	stats := service.NewStatsService(env.Repos.Stats, env.Redis, time.Minute)
+
+	for _, user := range []*domain.User{
+		{Email: "a@example.com", EmailNormalized: "a@example.com", IsActive: true, IsEmailVerified: true},
+		{Email: "b@example.com", EmailNormalized: "b@example.com", IsActive: true},
+	} {
+		if err := env.Repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		if err := env.Repos.User.UpdateLastLogin(ctx, user.ID, ""); err != nil {
+			t.Fatalf("Failed to update last login: %v", err)
+		}
+		stats.RecordLogin(ctx, user.ID, true)
+		stats.RecordLogin(ctx, user.ID, true)
+	}
+	stats.RecordLogin(ctx, "", false)
+	if err := env.Repos.Token.Create(ctx, &domain.RefreshToken{UserID: "user-1", TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	got, err := stats.Stats(ctx, 7)
+	if err != nil {
+		t.Fatalf("Failed to get statistics: %v", err)
+	}
+	if got.Users.Total != 2 || got.Users.Verified != 1 || got.ActiveUsers.Last24h != 2 || got.ActiveSessions != 1 {
+		t.Errorf("Expected 2 users, 1 verified, 2 active and 1 session, got %+v", got)
+	}
+	if got.Logins.Success != 4 || got.Logins.Failure != 1 || got.Logins.FailureRate != 0.2 {
+		t.Errorf("Expected 4 logins and 1 failure, got %+v", got.Logins)
+	}
+	if len(got.Daily) != 7 {
+		t.Fatalf("Expected 7 days, got %d", len(got.Daily))
+	}
+	today := got.Daily[6]
+	if today.Date != time.Now().UTC().Format(time.DateOnly) || today.Registrations != 2 || today.ActiveUsers != 2 || today.Logins != 4 || today.FailedLogins != 1 {
+		t.Errorf("Expected today to be last with 2 registrations and active users, got %+v", today)
+	}
+	if got.Daily[0].Registrations != 0 || got.Daily[0].Logins != 0 {
+		t.Errorf("Expected an empty first day, got %+v", got.Daily[0])
+	}
+
+	// Results are cached
+	if err := env.Repos.User.Create(ctx, &domain.User{Email: "c@example.com", EmailNormalized: "c@example.com"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if cached, err := stats.Stats(ctx, 7); err != nil || cached.Users.Total != 2 || cached.GeneratedAt != got.GeneratedAt {
+		t.Errorf("Expected cached statistics, got %+v (%v)", cached, err)
+	}
+
+	for _, days := range []int{0, service.MaxStatsDays + 1} {
+		if _, err := stats.Stats(ctx, days); !errors.Is(err, service.ErrInvalidStatsPeriod) {
+			t.Errorf("Expected ErrInvalidStatsPeriod for %d days, got %v", days, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	tenantCacheKey         = "tenant:"
+	defaultTenantCacheTTL  = 5 * time.Minute
+	maxTenantRedirectURLs  = 20
+	maxTenantSettingLength = 255
+)
+
+var brandColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ErrInvalidTenant is returned when saving a tenant with invalid settings
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+// TenantService manages the settings of tenants: email sender and branding, redirect URLs of
+// links in emails and the cookie domain. Tenants are cached in Redis, changes invalidate the cache.
+type TenantService struct {
+	repo     repository.TenantRepository
+	redis    *database.Redis
+	cacheTTL time.Duration
+}
+
+// NewTenantService creates a new tenant service
+func NewTenantService(repo repository.TenantRepository, redis *database.Redis, cacheTTL time.Duration) *TenantService {
+	if cacheTTL <= 0 {
+		cacheTTL = defaultTenantCacheTTL
+	}
+	return &TenantService{repo: repo, redis: redis, cacheTTL: cacheTTL}
+}
+
+// Get returns a tenant, from the cache if possible
+// Cache failures are logged and fall back to the database.
+func (s *TenantService) Get(ctx context.Context, id string) (_ *domain.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantService.Get")
+	defer func() { endSpan(span, err) }()
+
+	logger := observability.LoggerFromContext(ctx)
+	value, err := s.redis.Client.Get(ctx, tenantCacheKey+id).Bytes()
+	switch {
+	case err == nil:
+		var tenant domain.Tenant
+		if err := json.Unmarshal(value, &tenant); err == nil {
+			return &tenant, nil
+		}
+		logger.Warn("Failed to decode cached tenant", zap.String("tenant_id", id), zap.Error(err))
+	case !errors.Is(err, redis.Nil):
+		logger.Warn("Failed to read cached tenant", zap.String("tenant_id", id), zap.Error(err))
+	}
+
+	tenant, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+
+	if value, err := json.Marshal(tenant); err == nil {
+		if err := s.redis.Client.Set(ctx, tenantCacheKey+id, value, s.cacheTTL).Err(); err != nil {
+			logger.Warn("Failed to cache tenant", zap.String("tenant_id", id), zap.Error(err))
+		}
+	}
+
+	return tenant, nil
+}
+
+// List returns all tenants ordered by ID
+func (s *TenantService) List(ctx context.Context) ([]*domain.Tenant, error) {
+	tenants, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// Save validates and creates or replaces a tenant
+func (s *TenantService) Save(ctx context.Context, tenant *domain.Tenant) (err error) {
+	ctx, span := tracer.Start(ctx, "TenantService.Save")
+	defer func() { endSpan(span, err) }()
+
+	if err := validateTenant(tenant); err != nil {
+		return err
+	}
+	if err := s.repo.Save(ctx, tenant); err != nil {
+		return fmt.Errorf("failed to save tenant: %w", err)
+	}
+
+	return s.invalidate(ctx, tenant.ID)
+}
+
+// SetAllowedEmailDomains replaces the email domains allowed to register with a tenant, an empty
+// list falls back to the configured ones
+func (s *TenantService) SetAllowedEmailDomains(ctx context.Context, id string, domains []string) (_ *domain.Tenant, err error) {
+	ctx, span := tracer.Start(ctx, "TenantService.SetAllowedEmailDomains")
+	defer func() { endSpan(span, err) }()
+
+	tenant, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		return nil, fmt.Errorf("failed to get tenant: %w", err)
+	}
+
+	tenant.AllowedEmailDomains = domains
+	if err := s.Save(ctx, tenant); err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// Delete deletes a tenant
+func (s *TenantService) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "TenantService.Delete")
+	defer func() { endSpan(span, err) }()
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTenantNotFound
+		}
+		return fmt.Errorf("failed to delete tenant: %w", err)
+	}
+
+	return s.invalidate(ctx, id)
+}
+
+// invalidate removes a tenant from the cache, other replicas read the change once it is gone
+func (s *TenantService) invalidate(ctx context.Context, id string) error {
+	if err := s.redis.Client.Del(ctx, tenantCacheKey+id).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cached tenant: %w", err)
+	}
+	return nil
+}
+
+// validateTenant checks the settings of a tenant and normalizes its redirect URLs and allowed email domains
+func validateTenant(tenant *domain.Tenant) error {
+	if !domain.IsValidTenantID(tenant.ID) {
+		return fmt.Errorf("%w: id must be 1-100 lowercase letters, digits, dots, underscores or hyphens", ErrInvalidTenant)
+	}
+	if tenant.Name = strings.TrimSpace(tenant.Name); tenant.Name == "" || len(tenant.Name) > 100 {
+		return fmt.Errorf("%w: name must be 1-100 characters", ErrInvalidTenant)
+	}
+
+	if tenant.EmailFrom != nil {
+		if _, err := mail.ParseAddress(*tenant.EmailFrom); err != nil || len(*tenant.EmailFrom) > maxTenantSettingLength {
+			return fmt.Errorf("%w: invalid email sender %q", ErrInvalidTenant, *tenant.EmailFrom)
+		}
+	}
+	if tenant.BrandName != nil && len(*tenant.BrandName) > 100 {
+		return fmt.Errorf("%w: brand name must be at most 100 characters", ErrInvalidTenant)
+	}
+	if tenant.LogoURL != nil && !isAbsoluteURL(*tenant.LogoURL, "https") {
+		return fmt.Errorf("%w: logo URL must be an absolute https URL", ErrInvalidTenant)
+	}
+	if tenant.BrandColor != nil && !brandColorPattern.MatchString(*tenant.BrandColor) {
+		return fmt.Errorf("%w: brand color must be a hex color like #1a2b3c", ErrInvalidTenant)
+	}
+	if tenant.CookieDomain != nil {
+		domainName := strings.TrimPrefix(*tenant.CookieDomain, ".")
+		if domainName == "" || strings.ContainsAny(domainName, "/:;, ") || len(domainName) > maxTenantSettingLength {
+			return fmt.Errorf("%w: invalid cookie domain %q", ErrInvalidTenant, *tenant.CookieDomain)
+		}
+	}
+
+	if len(tenant.RedirectURLs) > maxTenantRedirectURLs {
+		return fmt.Errorf("%w: at most %d redirect URLs are allowed", ErrInvalidTenant, maxTenantRedirectURLs)
+	}
+	redirectURLs := make([]string, 0, len(tenant.RedirectURLs))
+	for _, redirectURL := range tenant.RedirectURLs {
+		redirectURL = strings.TrimSpace(redirectURL)
+		if _, reason := parseRedirectURL(redirectURL); reason != "" {
+			return fmt.Errorf("%w: redirect URL %q must be an absolute http(s) URL without credentials", ErrInvalidTenant, redirectURL)
+		}
+		redirectURLs = append(redirectURLs, redirectURL)
+	}
+	tenant.RedirectURLs = redirectURLs
+
+	allowedEmailDomains, err := normalizeEmailDomains(tenant.AllowedEmailDomains)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTenant, err)
+	}
+	tenant.AllowedEmailDomains = allowedEmailDomains
+
+	return nil
+}
+
+// isAbsoluteURL reports whether raw is a URL with one of the schemes and a host, without credentials
+func isAbsoluteURL(raw string, schemes ...string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil || len(raw) > 2048 {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a copy of ctx carrying the tenant of the request
+func ContextWithTenant(ctx context.Context, tenant *domain.Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant of the request, nil if it has none
+func TenantFromContext(ctx context.Context) *domain.Tenant {
+	tenant, _ := ctx.Value(tenantKey{}).(*domain.Tenant)
+	return tenant
+}
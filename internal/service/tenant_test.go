@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/memory"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestTenantServiceCachesTenants(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewTenantRepository()
+	tenants := service.NewTenantService(repo, testutil.NewRedis(t), time.Minute)
+
+	tenant := &domain.Tenant{ID: "acme", Name: " Acme ", RedirectURLs: []string{" https://app.acme.test/auth "}}
+	if err := tenants.Save(ctx, tenant); err != nil {
+		t.Fatalf("Failed to save tenant: %v", err)
+	}
+	if tenant.Name != "Acme" || tenant.RedirectURLs[0] != "https://app.acme.test/auth" {
+		t.Errorf("Expected settings to be trimmed, got %+v", tenant)
+	}
+
+	if _, err := tenants.Get(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to get tenant: %v", err)
+	}
+	// Changes behind the back of the service are served from the cache until it expires
+	_ = repo.Save(ctx, &domain.Tenant{ID: "acme", Name: "Renamed"})
+	if cached, err := tenants.Get(ctx, "acme"); err != nil || cached.Name != "Acme" {
+		t.Errorf("Expected the cached tenant, got %+v (%v)", cached, err)
+	}
+
+	// Saving through the service invalidates the cache
+	tenant.Name = "Acme Corp"
+	if err := tenants.Save(ctx, tenant); err != nil {
+		t.Fatalf("Failed to update tenant: %v", err)
+	}
+	if updated, err := tenants.Get(ctx, "acme"); err != nil || updated.Name != "Acme Corp" {
+		t.Errorf("Expected the updated tenant, got %+v (%v)", updated, err)
+	}
+
+	if err := tenants.Delete(ctx, "acme"); err != nil {
+		t.Fatalf("Failed to delete tenant: %v", err)
+	}
+	if _, err := tenants.Get(ctx, "acme"); !errors.Is(err, service.ErrTenantNotFound) {
+		t.Errorf("Expected ErrTenantNotFound for a deleted tenant, got %v", err)
+	}
+	if err := tenants.Delete(ctx, "acme"); !errors.Is(err, service.ErrTenantNotFound) {
+		t.Errorf("Expected ErrTenantNotFound when deleting twice, got %v", err)
+	}
+}
+
+func TestTenantServiceValidation(t *testing.T) {
+	tenants := service.NewTenantService(memory.NewTenantRepository(), testutil.NewRedis(t), time.Minute)
+
+	tests := []struct {
+		name   string
+		tenant domain.Tenant
+	}{
+		{name: "invalid id", tenant: domain.Tenant{ID: "Acme Inc", Name: "Acme"}},
+		{name: "missing name", tenant: domain.Tenant{ID: "acme", Name: " "}},
+		{name: "invalid sender", tenant: domain.Tenant{ID: "acme", Name: "Acme", EmailFrom: stringPtr("acme")}},
+		{name: "insecure logo", tenant: domain.Tenant{ID: "acme", Name: "Acme", LogoURL: stringPtr("http://acme.test/logo.png")}},
+		{name: "invalid color", tenant: domain.Tenant{ID: "acme", Name: "Acme", BrandColor: stringPtr("red")}},
+		{name: "invalid cookie domain", tenant: domain.Tenant{ID: "acme", Name: "Acme", CookieDomain: stringPtr("https://acme.test")}},
+		{name: "relative redirect", tenant: domain.Tenant{ID: "acme", Name: "Acme", RedirectURLs: []string{"/auth"}}},
+		{name: "javascript redirect", tenant: domain.Tenant{ID: "acme", Name: "Acme", RedirectURLs: []string{"javascript:alert(1)"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tenants.Save(context.Background(), &tt.tenant); !errors.Is(err, service.ErrInvalidTenant) {
+				t.Errorf("Expected ErrInvalidTenant, got %v", err)
+			}
+		})
+	}
+}
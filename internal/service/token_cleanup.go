@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.uber.org/zap"
+)
+
+// TokenCleanupService purges refresh tokens that expired or were revoked longer than the retention ago
+// Until then they are kept, so that security investigations can reconstruct the session history.
+type TokenCleanupService struct {
+	tokenRepo repository.TokenRepository
+	retention time.Duration
+	interval  time.Duration
+}
+
+// NewTokenCleanupService creates a cleanup purging tokens past retention every interval
+func NewTokenCleanupService(tokenRepo repository.TokenRepository, retention, interval time.Duration) *TokenCleanupService {
+	return &TokenCleanupService{
+		tokenRepo: tokenRepo,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Purge deletes the tokens past the retention and returns their number
+func (s *TokenCleanupService) Purge(ctx context.Context) (_ int64, err error) {
+	ctx, span := tracer.Start(ctx, "TokenCleanupService.Purge")
+	defer func() { endSpan(span, err) }()
+
+	return s.tokenRepo.Purge(ctx, time.Now().Add(-s.retention))
+}
+
+// Run purges tokens on a fixed interval until ctx is cancelled
+func (s *TokenCleanupService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Failed purges are retried on the next tick
+		if _, err := s.Purge(ctx); err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to purge refresh tokens", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestTokenCleanupService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	registered, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	// Rotation revokes the registered token and keeps it for the retention
+	if _, err := env.Service.RefreshToken(ctx, registered.RefreshToken); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	if purged, err := service.NewTokenCleanupService(env.Repos.Token, time.Hour, time.Hour).Purge(ctx); err != nil || purged != 0 {
+		t.Errorf("Expected the revoked token to be kept within the retention, got %d %v", purged, err)
+	}
+	if purged, err := service.NewTokenCleanupService(env.Repos.Token, 0, time.Hour).Purge(ctx); err != nil || purged != 1 {
+		t.Errorf("Expected the revoked token to be purged, got %d %v", purged, err)
+	}
+
+	sessions, err := env.Service.ListSessions(ctx, registered.AuthResponse.User.ID)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != registered.SessionID {
+		t.Errorf("Expected the rotated session to be kept, got %+v %v", sessions, err)
+	}
+}
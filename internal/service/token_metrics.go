@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Outcomes of token operations in metrics
+const (
+	tokenOutcomeSuccess = "success"
+	tokenOutcomeInvalid = "invalid"
+	tokenOutcomeRevoked = "revoked"
+	tokenOutcomeError   = "error"
+)
+
+// tokenMetrics counts token issuance and validation by outcome, so that error rates can be
+// alerted on. Rejected tokens are counted apart from validations that failed with an error.
+type tokenMetrics struct {
+	issued    metric.Int64Counter
+	validated metric.Int64Counter
+}
+
+func newTokenMetrics() *tokenMetrics {
+	m := &tokenMetrics{}
+
+	var err error
+	if m.issued, err = meter.Int64Counter("auth.tokens.issued",
+		metric.WithDescription("Number of token pairs issued, by outcome (success or error)"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create issued tokens counter: %w", err))
+	}
+	if m.validated, err = meter.Int64Counter("auth.tokens.validated",
+		metric.WithDescription("Number of access token validations, by outcome (success, invalid, revoked or error)"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create validated tokens counter: %w", err))
+	}
+
+	return m
+}
+
+// recordIssue counts the issuance of a token pair
+func (m *tokenMetrics) recordIssue(ctx context.Context, err error) {
+	outcome := tokenOutcomeSuccess
+	if err != nil {
+		outcome = tokenOutcomeError
+	}
+	m.issued.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+}
+
+// recordValidation counts the validation of an access token
+func (m *tokenMetrics) recordValidation(ctx context.Context, err error) {
+	outcome := tokenOutcomeSuccess
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrTokenRevoked):
+		outcome = tokenOutcomeRevoked
+	case errors.Is(err, ErrInvalidToken):
+		outcome = tokenOutcomeInvalid
+	default:
+		outcome = tokenOutcomeError
+	}
+	m.validated.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("outcome", outcome)))
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Actions on expired unverified accounts
+const (
+	// UnverifiedActionDelete erases expired accounts through the erasure pipeline
+	UnverifiedActionDelete = "delete"
+	// UnverifiedActionDeactivate keeps expired accounts, deactivated
+	UnverifiedActionDeactivate = "deactivate"
+)
+
+const (
+	// UnverifiedWarningLead is how long before their account expires users are warned
+	UnverifiedWarningLead = 48 * time.Hour
+
+	// unverifiedBatchSize is the number of users warned or expired per query
+	unverifiedBatchSize = 100
+)
+
+// UnverifiedExpiryConfig configures the retention policy of unverified accounts
+type UnverifiedExpiryConfig struct {
+	// Expiry is the age at which accounts whose email was never verified expire
+	Expiry time.Duration
+	// Action is UnverifiedActionDelete or UnverifiedActionDeactivate
+	Action string
+	// SweepInterval is how often accounts to warn and expire are looked for by Run
+	SweepInterval time.Duration
+}
+
+// UnverifiedExpiryService expires accounts whose email was never verified
+// Users are warned by email UnverifiedWarningLead before, when their account reaches Expiry minus
+// the lead, and their account expires once the lead has passed since the warning, so that accounts
+// older than Expiry when the policy is turned on are warned too. Expired accounts are erased, with
+// a tombstone requested by retention, or deactivated.
+type UnverifiedExpiryService struct {
+	users    repository.UserRepository
+	erasures *ErasureService
+	emails   *EmailService
+	config   UnverifiedExpiryConfig
+	hooks    []DeactivationHook
+
+	warned  metric.Int64Counter
+	expired metric.Int64Counter
+}
+
+// DeactivationHook is run after the account of a user was deactivated
+type DeactivationHook func(ctx context.Context, userID string)
+
+// NewUnverifiedExpiryService creates a new unverified account expiry service
+func NewUnverifiedExpiryService(users repository.UserRepository, erasures *ErasureService, emails *EmailService, config UnverifiedExpiryConfig) *UnverifiedExpiryService {
+	s := &UnverifiedExpiryService{
+		users:    users,
+		erasures: erasures,
+		emails:   emails,
+		config:   config,
+	}
+
+	var err error
+	if s.warned, err = meter.Int64Counter("auth.unverified_accounts.warned",
+		metric.WithDescription("Number of users warned that their unverified account expires"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create warned unverified accounts counter: %w", err))
+	}
+	if s.expired, err = meter.Int64Counter("auth.unverified_accounts.expired",
+		metric.WithDescription("Number of unverified accounts expired, by action (delete or deactivate)"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create expired unverified accounts counter: %w", err))
+	}
+
+	return s
+}
+
+// OnDeactivate adds a hook run after an expired account was deactivated
+// Hooks must be added before the service is used.
+func (s *UnverifiedExpiryService) OnDeactivate(hook DeactivationHook) {
+	s.hooks = append(s.hooks, hook)
+}
+
+// Sweep warns the users whose account expires within UnverifiedWarningLead and expires the accounts
+// of users warned longer ago, and returns how many it warned and expired
+// Users that failed are retried by the next call.
+func (s *UnverifiedExpiryService) Sweep(ctx context.Context) (warned, expired int, err error) {
+	ctx, span := tracer.Start(ctx, "UnverifiedExpiryService.Sweep")
+	defer func() { endSpan(span, err) }()
+
+	now := time.Now()
+	if warned, err = s.warn(ctx, now); err != nil {
+		return warned, 0, err
+	}
+	expired, err = s.expire(ctx, now)
+	return warned, expired, err
+}
+
+// Run sweeps unverified accounts on a fixed interval until ctx is cancelled
+func (s *UnverifiedExpiryService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		warned, expired, err := s.Sweep(ctx)
+		if err != nil {
+			observability.LoggerFromContext(ctx).Warn("Failed to sweep unverified accounts",
+				zap.Int("warned", warned), zap.Int("expired", expired), zap.Error(err))
+		} else if warned > 0 || expired > 0 {
+			observability.LoggerFromContext(ctx).Info("Swept unverified accounts", zap.Int("warned", warned), zap.Int("expired", expired))
+		}
+	}
+}
+
+// warn warns the users whose account is old enough and who weren't warned yet
+func (s *UnverifiedExpiryService) warn(ctx context.Context, now time.Time) (int, error) {
+	data := UnverifiedExpiryEmailData{
+		ExpiresOn:  now.Add(UnverifiedWarningLead).UTC().Format(time.DateOnly),
+		Deactivate: s.config.Action == UnverifiedActionDeactivate,
+	}
+
+	warned := 0
+	for {
+		users, err := s.users.ListUnverifiedToWarn(ctx, now.Add(UnverifiedWarningLead-s.config.Expiry), unverifiedBatchSize)
+		if err != nil {
+			return warned, err
+		}
+
+		for _, user := range users {
+			// Marked first, so that a user is warned once even by concurrent sweeps of several replicas
+			if err := s.users.MarkUnverifiedWarned(ctx, user.ID, now); err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					continue
+				}
+				return warned, err
+			}
+
+			locale := ""
+			if user.Locale != nil {
+				locale = *user.Locale
+			}
+			// The account expires after the lead even if the warning is lost
+			if err := s.emails.SendUnverifiedExpiry(ctx, user.Email, locale, data); err != nil {
+				observability.LoggerFromContext(ctx).Warn("Failed to warn user of the account expiry", zap.String("user_id", user.ID), zap.Error(err))
+			}
+			warned++
+			s.warned.Add(context.WithoutCancel(ctx), 1)
+		}
+
+		if len(users) < unverifiedBatchSize {
+			return warned, nil
+		}
+	}
+}
+
+// expire deletes or deactivates the accounts of users warned longer than the lead ago
+func (s *UnverifiedExpiryService) expire(ctx context.Context, now time.Time) (int, error) {
+	expired := 0
+	var errs []error
+	for {
+		users, err := s.users.ListUnverifiedWarnedBefore(ctx, now.Add(-UnverifiedWarningLead), unverifiedBatchSize)
+		if err != nil {
+			return expired, err
+		}
+
+		for _, user := range users {
+			if err := s.expireUser(ctx, user); err != nil {
+				errs = append(errs, fmt.Errorf("failed to expire user %s: %w", user.ID, err))
+				continue
+			}
+			expired++
+			s.expired.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("action", s.config.Action)))
+		}
+
+		// Users that failed are listed again, they are left to the next sweep
+		if len(users) < unverifiedBatchSize || len(errs) > 0 {
+			return expired, errors.Join(errs...)
+		}
+	}
+}
+
+// expireUser deletes or deactivates the account of a user
+func (s *UnverifiedExpiryService) expireUser(ctx context.Context, user *domain.User) error {
+	if s.config.Action == UnverifiedActionDeactivate {
+		user.IsActive = false
+		if err := s.users.Update(ctx, user); err != nil {
+			return err
+		}
+		for _, hook := range s.hooks {
+			hook(ctx, user.ID)
+		}
+		return nil
+	}
+
+	_, err := s.erasures.EraseExpired(ctx, user.ID)
+	return err
+}
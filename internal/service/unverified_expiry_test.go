@@ -0,0 +1,112 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"go.uber.org/zap"
+)
+
+func TestUnverifiedExpiryService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+
+	// Erasure events and emails share the runner, it would dead-letter the jobs of the other otherwise
+	mail := &testutil.Mailer{}
+	runner := jobs.NewRunner(env.Redis, zap.NewNop(), jobs.Config{Workers: 1, PollInterval: 10 * time.Millisecond})
+	emails, err := service.NewEmailService(runner, mail, "en")
+	if err != nil {
+		t.Fatalf("Failed to create email service: %v", err)
+	}
+	erasures := service.NewErasureService(env.Repos.Erasure, env.Repos.User, env.Repos.OAuthProvider,
+		service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute), runner, service.ErasureConfig{Mode: domain.ErasureModeDelete})
+	events := make(chan service.UserErasedEvent, 1)
+	erasures.Subscribe(func(ctx context.Context, event service.UserErasedEvent) error {
+		events <- event
+		return nil
+	})
+	runCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	go runner.Run(runCtx)
+
+	now := time.Now()
+	create := func(email string, age time.Duration, verified bool) *domain.User {
+		t.Helper()
+		user := &domain.User{Email: email, EmailNormalized: email, IsActive: true, IsEmailVerified: verified, CreatedAt: now.Add(-age)}
+		if err := env.Repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	day := 24 * time.Hour
+	due := create("due@example.com", 6*day, false)
+	create("young@example.com", 4*day, false)
+	create("verified@example.com", 30*day, true)
+	create("0xabc@wallet.invalid", 30*day, false)
+	warned := create("warned@example.com", 30*day, false)
+	if err := env.Repos.User.MarkUnverifiedWarned(ctx, warned.ID, now.Add(-service.UnverifiedWarningLead-time.Minute)); err != nil {
+		t.Fatalf("Failed to mark user warned: %v", err)
+	}
+
+	expiry := service.NewUnverifiedExpiryService(env.Repos.User, erasures, emails, service.UnverifiedExpiryConfig{
+		Expiry: 7 * day,
+		Action: service.UnverifiedActionDelete,
+	})
+	warnedCount, expiredCount, err := expiry.Sweep(ctx)
+	if err != nil || warnedCount != 1 || expiredCount != 1 {
+		t.Fatalf("Expected 1 user warned and 1 expired, got %d and %d (%v)", warnedCount, expiredCount, err)
+	}
+
+	if event := waitErasedEvent(t, events); event.UserID != warned.ID || event.RequestedBy != domain.ErasureRequestedByRetention {
+		t.Errorf("Expected the warned user to be erased by retention, got %+v", event)
+	}
+	if _, err := env.Repos.User.GetByID(ctx, warned.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected the expired user to be deleted, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mail.Sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := mail.Sent()
+	if len(sent) != 1 || sent[0].To != "due@example.com" || !strings.Contains(sent[0].Text, now.Add(2*day).UTC().Format(time.DateOnly)) {
+		t.Fatalf("Expected a warning with the expiry date to be sent to the due user, got %+v", sent)
+	}
+	if found, _ := env.Repos.User.GetByID(ctx, due.ID); found.UnverifiedWarnedAt == nil {
+		t.Error("Expected the warning to be recorded")
+	}
+
+	// Users are warned once
+	if warnedCount, expiredCount, err := expiry.Sweep(ctx); err != nil || warnedCount != 0 || expiredCount != 0 {
+		t.Errorf("Expected nothing to do, got %d warned and %d expired (%v)", warnedCount, expiredCount, err)
+	}
+
+	// Deactivated accounts are kept
+	if err := env.Repos.User.MarkUnverifiedWarned(ctx, create("other@example.com", 30*day, false).ID, now.Add(-3*day)); err != nil {
+		t.Fatalf("Failed to mark user warned: %v", err)
+	}
+	deactivate := service.NewUnverifiedExpiryService(env.Repos.User, erasures, emails, service.UnverifiedExpiryConfig{
+		Expiry: 7 * day,
+		Action: service.UnverifiedActionDeactivate,
+	})
+	var deactivated []string
+	deactivate.OnDeactivate(func(ctx context.Context, userID string) {
+		deactivated = append(deactivated, userID)
+	})
+	if _, expiredCount, err := deactivate.Sweep(ctx); err != nil || expiredCount != 1 {
+		t.Fatalf("Expected 1 user expired, got %d (%v)", expiredCount, err)
+	}
+	if found, err := env.Repos.User.GetByEmail(ctx, "other@example.com"); err != nil || found.IsActive {
+		t.Errorf("Expected the expired user to be deactivated, got %+v (%v)", found, err)
+	} else if len(deactivated) != 1 || deactivated[0] != found.ID {
+		t.Errorf("Expected the deactivation hook to run for the user, got %v", deactivated)
+	}
+}
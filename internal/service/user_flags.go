@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/observability"
+)
+
+// Limits of the notes and flags of a user
+const (
+	maxUserFlags       = 20
+	maxUserFlagLength  = 64
+	maxUserNotesLength = 10000
+)
+
+// userFlagPattern matches flags such as "chargeback" or "abuse-suspect"
+var userFlagPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ErrInvalidUserFlags is returned for too long notes and for invalid or too many flags
+var ErrInvalidUserFlags = errors.New("invalid user flags")
+
+// UserFlagsService manages the notes and flags support keeps on users
+// Every edit is audited along with who made it.
+type UserFlagsService struct {
+	users   repository.UserRepository
+	flags   repository.UserFlagsRepository
+	auditor observability.Auditor
+}
+
+// NewUserFlagsService creates a new user flags service
+func NewUserFlagsService(users repository.UserRepository, flags repository.UserFlagsRepository, auditor observability.Auditor) *UserFlagsService {
+	return &UserFlagsService{users: users, flags: flags, auditor: auditorOrNop(auditor)}
+}
+
+// GetUser returns a user along with its notes and flags
+func (s *UserFlagsService) GetUser(ctx context.Context, userID string) (_ *dto.AdminUserDetailsResponse, err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsService.GetUser")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := s.flags.Get(ctx, user.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	return adminUserDetailsResponse(user, flags), nil
+}
+
+// Update replaces the notes and flags of a user, actor is who edits them
+// Flags are lowercased, sorted and deduplicated.
+func (s *UserFlagsService) Update(ctx context.Context, userID, actor string, req *dto.UpdateUserFlagsRequest) (_ *dto.AdminUserDetailsResponse, err error) {
+	ctx, span := tracer.Start(ctx, "UserFlagsService.Update")
+	defer func() { endSpan(span, err) }()
+
+	if len(req.Notes) > maxUserNotesLength {
+		return nil, fmt.Errorf("%w: notes must have at most %d characters", ErrInvalidUserFlags, maxUserNotesLength)
+	}
+	flags, err := normalizeUserFlags(req.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := s.flags.Get(ctx, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		previous = &domain.UserFlags{UserID: user.ID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	updated := &domain.UserFlags{
+		UserID:    user.ID,
+		Notes:     req.Notes,
+		Flags:     flags,
+		UpdatedAt: time.Now(),
+		UpdatedBy: actor,
+	}
+	if err := s.flags.Save(ctx, updated); err != nil {
+		return nil, err
+	}
+
+	event := newAuditEvent(ctx, AuditUserFlagsUpdated, observability.AuditOutcomeSuccess)
+	event.UserID = user.ID
+	event.Actor = actor
+	event.Reason = userFlagsChanges(previous, updated)
+	s.auditor.Audit(ctx, event)
+
+	return adminUserDetailsResponse(user, updated), nil
+}
+
+// normalizeUserFlags validates flags and returns them lowercased, sorted and deduplicated
+func normalizeUserFlags(flags []string) ([]string, error) {
+	normalized := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		flag = strings.ToLower(strings.TrimSpace(flag))
+		if len(flag) > maxUserFlagLength || !userFlagPattern.MatchString(flag) {
+			return nil, fmt.Errorf("%w: %q must be lowercase words separated by hyphens, of at most %d characters",
+				ErrInvalidUserFlags, flag, maxUserFlagLength)
+		}
+		normalized = append(normalized, flag)
+	}
+
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > maxUserFlags {
+		return nil, fmt.Errorf("%w: a user can have at most %d flags", ErrInvalidUserFlags, maxUserFlags)
+	}
+	return normalized, nil
+}
+
+// userFlagsChanges summarizes an edit for the audit trail, notes themselves are left out
+// e.g. "flags_added=chargeback flags_removed=vip notes_changed"
+func userFlagsChanges(previous, updated *domain.UserFlags) string {
+	var changes []string
+	var added, removed []string
+	for _, flag := range updated.Flags {
+		if !slices.Contains(previous.Flags, flag) {
+			added = append(added, flag)
+		}
+	}
+	for _, flag := range previous.Flags {
+		if !slices.Contains(updated.Flags, flag) {
+			removed = append(removed, flag)
+		}
+	}
+
+	if len(added) > 0 {
+		changes = append(changes, "flags_added="+strings.Join(added, ","))
+	}
+	if len(removed) > 0 {
+		changes = append(changes, "flags_removed="+strings.Join(removed, ","))
+	}
+	if previous.Notes != updated.Notes {
+		changes = append(changes, "notes_changed")
+	}
+	if len(changes) == 0 {
+		return "unchanged"
+	}
+	return strings.Join(changes, " ")
+}
+
+// adminUserDetailsResponse describes a user with its notes and flags, flags is nil if none were saved
+func adminUserDetailsResponse(user *domain.User, flags *domain.UserFlags) *dto.AdminUserDetailsResponse {
+	response := &dto.AdminUserDetailsResponse{
+		UserResponse: *userResponse(user),
+		IsActive:     user.IsActive,
+		Restriction:  user.Restriction,
+		Flags:        []string{},
+	}
+	if flags == nil {
+		return response
+	}
+
+	response.Notes = flags.Notes
+	if flags.Flags != nil {
+		response.Flags = flags.Flags
+	}
+	updatedAt := flags.UpdatedAt.Format(time.RFC3339)
+	response.FlagsUpdatedAt = &updatedAt
+	response.FlagsUpdatedBy = &flags.UpdatedBy
+	return response
+}
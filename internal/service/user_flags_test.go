@@ -0,0 +1,77 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestUserFlagsService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	auditor := &recordingAuditor{}
+	flags := service.NewUserFlagsService(env.Repos.User, env.Repos.UserFlags, auditor)
+
+	user := &domain.User{Email: "alice@example.com", EmailNormalized: "alice@example.com", IsActive: true}
+	if err := env.Repos.User.Create(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	details, err := flags.GetUser(ctx, user.ID)
+	if err != nil || details.ID != user.ID || len(details.Flags) != 0 || details.FlagsUpdatedBy != nil {
+		t.Fatalf("Expected the user without flags, got %+v (%v)", details, err)
+	}
+
+	details, err = flags.Update(ctx, user.ID, "admin", &dto.UpdateUserFlagsRequest{
+		Notes: "Disputed a payment",
+		Flags: []string{" Chargeback", "abuse-suspect", "chargeback"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to update flags: %v", err)
+	}
+	if !slices.Equal(details.Flags, []string{"abuse-suspect", "chargeback"}) || details.Notes != "Disputed a payment" {
+		t.Errorf("Expected normalized flags and the notes, got %+v", details)
+	}
+	event, ok := auditor.last(service.AuditUserFlagsUpdated)
+	if !ok || event.UserID != user.ID || event.Actor != "admin" || event.Reason != "flags_added=abuse-suspect,chargeback notes_changed" {
+		t.Errorf("Expected the edit to be audited, got %+v", event)
+	}
+
+	if _, err := flags.Update(ctx, user.ID, "spiffe://example.org/support", &dto.UpdateUserFlagsRequest{
+		Notes: "Disputed a payment",
+		Flags: []string{"chargeback", "vip"},
+	}); err != nil {
+		t.Fatalf("Failed to update flags: %v", err)
+	}
+	event, _ = auditor.last(service.AuditUserFlagsUpdated)
+	if event.Actor != "spiffe://example.org/support" || event.Reason != "flags_added=vip flags_removed=abuse-suspect" {
+		t.Errorf("Expected the changes to be audited, got %+v", event)
+	}
+	details, err = flags.GetUser(ctx, user.ID)
+	if err != nil || !slices.Equal(details.Flags, []string{"chargeback", "vip"}) || *details.FlagsUpdatedBy != "spiffe://example.org/support" {
+		t.Errorf("Expected the saved flags, got %+v (%v)", details, err)
+	}
+
+	for _, req := range []*dto.UpdateUserFlagsRequest{
+		{Flags: []string{"not a flag"}},
+		{Flags: []string{"-chargeback"}},
+		{Flags: []string{strings.Repeat("a", 65)}},
+		{Notes: strings.Repeat("a", 10001)},
+	} {
+		if _, err := flags.Update(ctx, user.ID, "admin", req); !errors.Is(err, service.ErrInvalidUserFlags) {
+			t.Errorf("Expected ErrInvalidUserFlags for %+v, got %v", req, err)
+		}
+	}
+
+	if _, err := flags.Update(ctx, "00000000-0000-0000-0000-000000000000", "admin", &dto.UpdateUserFlagsRequest{}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown user, got %v", err)
+	}
+}
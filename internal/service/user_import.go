@@ -0,0 +1,520 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// userImportChunkJob is the job type creating the users of a chunk of an import
+	userImportChunkJob = "user_import.chunk"
+
+	// userImportKey prefixes the hash holding the progress of an import
+	userImportKey = "user_import:"
+	// userImportErrorsSuffix is appended to the progress key for the list of failed records
+	userImportErrorsSuffix = ":errors"
+
+	// userImportChunkSize is the number of records created per job
+	userImportChunkSize = 500
+	// userImportMaxErrors caps the number of failed records kept for the status
+	userImportMaxErrors = 100
+	// userImportTTL is how long the status of an import is kept
+	userImportTTL = 7 * 24 * time.Hour
+	// userImportMaxLineSize bounds a single NDJSON line
+	userImportMaxLineSize = 1 << 20
+)
+
+// User import formats
+const (
+	UserImportFormatNDJSON = "ndjson"
+	UserImportFormatCSV    = "csv"
+)
+
+// User import statuses
+const (
+	UserImportStatusProcessing = "processing"
+	UserImportStatusCompleted  = "completed"
+	UserImportStatusFailed     = "failed"
+)
+
+// ErrInvalidUserImport is returned when an import file can't be read, e.g. an unknown format or a malformed CSV header
+var ErrInvalidUserImport = errors.New("invalid user import")
+
+// UserImportRecord is a user of an import file
+// Either PasswordHash, a bcrypt hash or a hash of a legacy format supported by PasswordHasher, or
+// ForcePasswordReset has to be set. Users forced to reset
+// their password are created without one and can't log in with a password until they set one.
+type UserImportRecord struct {
+	Email              string  `json:"email"`
+	PasswordHash       string  `json:"password_hash,omitempty"`
+	ForcePasswordReset bool    `json:"force_password_reset,omitempty"`
+	EmailVerified      bool    `json:"email_verified,omitempty"`
+	Username           *string `json:"username,omitempty"`
+	FirstName          *string `json:"first_name,omitempty"`
+	LastName           *string `json:"last_name,omitempty"`
+	DisplayName        *string `json:"display_name,omitempty"`
+	Locale             *string `json:"locale,omitempty"`
+}
+
+// UserImportError describes a record of an import that wasn't imported
+type UserImportError struct {
+	Line  int    `json:"line"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// UserImport is the progress of an import
+// Records are counted as imported, skipped because the email exists already, or failed.
+type UserImport struct {
+	ID        string
+	Status    string
+	Total     int64
+	Imported  int64
+	Skipped   int64
+	Failed    int64
+	Error     string
+	CreatedAt time.Time
+	// Errors lists the first failed records
+	Errors []UserImportError
+}
+
+// Processed returns the number of records done
+func (i *UserImport) Processed() int64 {
+	return i.Imported + i.Skipped + i.Failed
+}
+
+// userImportLine is a record with its line in the import file
+type userImportLine struct {
+	Line   int              `json:"line"`
+	Record UserImportRecord `json:"record"`
+}
+
+// userImportChunk is the payload of a chunk job
+type userImportChunk struct {
+	ImportID string           `json:"import_id"`
+	Lines    []userImportLine `json:"lines"`
+}
+
+// UserImportService imports users in bulk, e.g. when migrating from a legacy system
+// Start parses the file while it is uploaded and enqueues chunks of records to the job runner,
+// which creates the users in the background. The progress is kept in Redis, so it is shared by
+// all replicas. Imports can be run again: users whose email exists already are skipped.
+type UserImportService struct {
+	redis           *database.Redis
+	userRepo        repository.UserRepository
+	emailNormalizer *utils.EmailNormalizer
+	passwordHasher  *PasswordHasher
+	runner          *jobs.Runner
+}
+
+// NewUserImportService creates the import service and registers the chunk job handler
+func NewUserImportService(
+	redis *database.Redis,
+	userRepo repository.UserRepository,
+	emailNormalizer *utils.EmailNormalizer,
+	passwordHasher *PasswordHasher,
+	runner *jobs.Runner,
+) *UserImportService {
+	s := &UserImportService{
+		redis:           redis,
+		userRepo:        userRepo,
+		emailNormalizer: emailNormalizer,
+		passwordHasher:  passwordHasher,
+		runner:          runner,
+	}
+	runner.Register(userImportChunkJob, s.processChunk)
+	return s
+}
+
+// Start reads an import file in format and enqueues its records
+// Invalid records are counted as failed and don't stop the import. A file that can't be read
+// fails the import with ErrInvalidUserImport, chunks enqueued before are dropped but users
+// created from them meanwhile stay.
+func (s *UserImportService) Start(ctx context.Context, format string, file io.Reader) (_ *UserImport, err error) {
+	ctx, span := tracer.Start(ctx, "UserImportService.Start")
+	defer func() { endSpan(span, err) }()
+
+	var next func() (userImportLine, error)
+	switch format {
+	case UserImportFormatNDJSON:
+		next = ndjsonRecords(file)
+	case UserImportFormatCSV:
+		if next, err = csvRecords(file); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidUserImport, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", ErrInvalidUserImport, format)
+	}
+
+	id := uuid.New().String()
+	key := userImportKey + id
+	if err := s.redis.Client.HSet(ctx, key, "created_at", time.Now().Unix(), "total", 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to create user import: %w", err)
+	}
+	if err := s.redis.Client.Expire(ctx, key, userImportTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to create user import: %w", err)
+	}
+
+	chunk := userImportChunk{ImportID: id}
+	var invalid []UserImportError
+	flush := func() error {
+		if len(chunk.Lines) == 0 && len(invalid) == 0 {
+			return nil
+		}
+		pipe := s.redis.Client.TxPipeline()
+		pipe.HIncrBy(ctx, key, "total", int64(len(chunk.Lines)+len(invalid)))
+		s.recordFailures(ctx, pipe, id, invalid)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to update user import: %w", err)
+		}
+		if len(chunk.Lines) > 0 {
+			if err := s.runner.Enqueue(ctx, userImportChunkJob, chunk); err != nil {
+				return err
+			}
+		}
+		chunk.Lines, invalid = nil, nil
+		return nil
+	}
+
+	for {
+		line, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err == nil {
+			err = s.validate(&line.Record)
+		}
+
+		var recordErr *userImportRecordError
+		switch {
+		case errors.As(err, &recordErr):
+			invalid = append(invalid, UserImportError{Line: line.Line, Email: line.Record.Email, Error: recordErr.Error()})
+		case err != nil:
+			return nil, s.fail(ctx, id, fmt.Errorf("%w: %w", ErrInvalidUserImport, err))
+		default:
+			chunk.Lines = append(chunk.Lines, line)
+		}
+
+		if len(chunk.Lines)+len(invalid) >= userImportChunkSize {
+			if err := flush(); err != nil {
+				return nil, s.fail(ctx, id, err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, s.fail(ctx, id, err)
+	}
+
+	// The import completes once all records counted in total are processed
+	if err := s.redis.Client.HSet(ctx, key, "parsed", 1).Err(); err != nil {
+		return nil, s.fail(ctx, id, fmt.Errorf("failed to update user import: %w", err))
+	}
+	return s.Get(ctx, id)
+}
+
+// Get returns the progress of an import, repository.ErrNotFound for unknown or expired imports
+func (s *UserImportService) Get(ctx context.Context, id string) (*UserImport, error) {
+	key := userImportKey + id
+	pipe := s.redis.Client.Pipeline()
+	fieldsCmd := pipe.HGetAll(ctx, key)
+	errorsCmd := pipe.LRange(ctx, key+userImportErrorsSuffix, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get user import: %w", err)
+	}
+
+	fields := fieldsCmd.Val()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("user import %s: %w", id, repository.ErrNotFound)
+	}
+
+	count := func(field string) int64 {
+		n, _ := strconv.ParseInt(fields[field], 10, 64)
+		return n
+	}
+	userImport := &UserImport{
+		ID:        id,
+		Status:    UserImportStatusProcessing,
+		Total:     count("total"),
+		Imported:  count("imported"),
+		Skipped:   count("skipped"),
+		Failed:    count("failed"),
+		Error:     fields["error"],
+		CreatedAt: time.Unix(count("created_at"), 0),
+		Errors:    make([]UserImportError, 0, len(errorsCmd.Val())),
+	}
+	switch {
+	case userImport.Error != "":
+		userImport.Status = UserImportStatusFailed
+	case fields["parsed"] != "" && userImport.Processed() >= userImport.Total:
+		userImport.Status = UserImportStatusCompleted
+	}
+
+	for _, item := range errorsCmd.Val() {
+		var importErr UserImportError
+		if err := json.Unmarshal([]byte(item), &importErr); err == nil {
+			userImport.Errors = append(userImport.Errors, importErr)
+		}
+	}
+	return userImport, nil
+}
+
+// processChunk creates the users of a chunk
+// Failed records aren't retried, they are reported in the status and can be imported again.
+func (s *UserImportService) processChunk(ctx context.Context, payload json.RawMessage) error {
+	var chunk userImportChunk
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		return jobs.Permanent(fmt.Errorf("invalid user import chunk: %w", err))
+	}
+
+	// Chunks of failed or expired imports are dropped
+	key := userImportKey + chunk.ImportID
+	fields, err := s.redis.Client.HMGet(ctx, key, "created_at", "error").Result()
+	if err != nil {
+		return fmt.Errorf("failed to get user import: %w", err)
+	}
+	if fields[0] == nil || fields[1] != nil {
+		return nil
+	}
+
+	var imported, skipped int64
+	var failures []UserImportError
+	for _, line := range chunk.Lines {
+		err := s.createUser(ctx, &line.Record)
+		switch {
+		case err == nil:
+			imported++
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			skipped++
+		case errors.Is(err, repository.ErrDuplicateUsername):
+			failures = append(failures, UserImportError{Line: line.Line, Email: line.Record.Email, Error: ErrUsernameTaken.Error()})
+		default:
+			failures = append(failures, UserImportError{Line: line.Line, Email: line.Record.Email, Error: err.Error()})
+		}
+	}
+
+	// Counting the chunk twice would complete the import early, so it isn't retried
+	pipe := s.redis.Client.TxPipeline()
+	pipe.HIncrBy(ctx, key, "imported", imported)
+	pipe.HIncrBy(ctx, key, "skipped", skipped)
+	s.recordFailures(ctx, pipe, chunk.ImportID, failures)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return jobs.Permanent(fmt.Errorf("failed to update user import: %w", err))
+	}
+	return nil
+}
+
+// createUser creates the user of a validated record
+func (s *UserImportService) createUser(ctx context.Context, record *UserImportRecord) error {
+	user := &domain.User{
+		Email:           utils.SanitizeEmail(record.Email),
+		EmailNormalized: s.emailNormalizer.Normalize(record.Email),
+		Username:        record.Username,
+		IsActive:        true,
+		IsEmailVerified: record.EmailVerified,
+		FirstName:       record.FirstName,
+		LastName:        record.LastName,
+		DisplayName:     record.DisplayName,
+		Locale:          record.Locale,
+	}
+	if !record.ForcePasswordReset {
+		user.PasswordHash = record.PasswordHash
+	}
+	return s.userRepo.Create(ctx, user)
+}
+
+// recordFailures adds failed records to the counters and the capped error list of an import
+func (s *UserImportService) recordFailures(ctx context.Context, pipe redis.Pipeliner, id string, failures []UserImportError) {
+	if len(failures) == 0 {
+		return
+	}
+	key := userImportKey + id
+	pipe.HIncrBy(ctx, key, "failed", int64(len(failures)))
+
+	values := make([]any, 0, len(failures))
+	for _, failure := range failures {
+		encoded, err := json.Marshal(failure)
+		if err != nil {
+			continue
+		}
+		values = append(values, encoded)
+	}
+	pipe.RPush(ctx, key+userImportErrorsSuffix, values...)
+	pipe.LTrim(ctx, key+userImportErrorsSuffix, 0, userImportMaxErrors-1)
+	pipe.Expire(ctx, key+userImportErrorsSuffix, userImportTTL)
+}
+
+// fail marks an import as failed and returns err
+func (s *UserImportService) fail(ctx context.Context, id string, err error) error {
+	// The import is marked failed even if the request was cancelled, so that its chunks are dropped
+	ctx = context.WithoutCancel(ctx)
+	if setErr := s.redis.Client.HSet(ctx, userImportKey+id, "error", err.Error()).Err(); setErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to mark user import as failed: %w", setErr))
+	}
+	return err
+}
+
+// userImportRecordError is a record that can't be imported, counted as failed
+type userImportRecordError struct {
+	msg string
+}
+
+func (e *userImportRecordError) Error() string { return e.msg }
+
+func invalidRecord(format string, args ...any) error {
+	return &userImportRecordError{msg: fmt.Sprintf(format, args...)}
+}
+
+// validate validates a record and sanitizes its username
+func (s *UserImportService) validate(record *UserImportRecord) error {
+	if !utils.ValidateEmail(strings.TrimSpace(record.Email)) {
+		return invalidRecord("%s", ErrInvalidEmail.Error())
+	}
+
+	switch {
+	case record.ForcePasswordReset && record.PasswordHash != "":
+		return invalidRecord("password_hash and force_password_reset are mutually exclusive")
+	case !record.ForcePasswordReset && record.PasswordHash == "":
+		return invalidRecord("password_hash or force_password_reset is required")
+	case record.PasswordHash != "" && !s.passwordHasher.Supports(record.PasswordHash):
+		return invalidRecord("password_hash has an unsupported format")
+	case utils.IsBcryptHash(record.PasswordHash):
+		if _, err := bcrypt.Cost([]byte(record.PasswordHash)); err != nil {
+			return invalidRecord("password_hash is not a valid bcrypt hash")
+		}
+	}
+
+	if record.Username != nil {
+		sanitized := utils.SanitizeUsername(*record.Username)
+		if !utils.ValidateUsername(sanitized) {
+			return invalidRecord("%s", ErrInvalidUsername.Error())
+		}
+		record.Username = &sanitized
+	}
+	return nil
+}
+
+// ndjsonRecords reads one JSON record per line, blank lines are ignored
+func ndjsonRecords(file io.Reader) func() (userImportLine, error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), userImportMaxLineSize)
+	lineNumber := 0
+
+	return func() (userImportLine, error) {
+		for scanner.Scan() {
+			lineNumber++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			line := userImportLine{Line: lineNumber}
+			if err := json.Unmarshal([]byte(text), &line.Record); err != nil {
+				return line, invalidRecord("invalid JSON: %v", err)
+			}
+			return line, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return userImportLine{}, fmt.Errorf("line %d: %w", lineNumber+1, err)
+		}
+		return userImportLine{}, io.EOF
+	}
+}
+
+// csvRecords reads records from a CSV file whose header row names the columns
+// Columns are the JSON names of UserImportRecord fields, email is required.
+func csvRecords(file io.Reader) (func() (userImportLine, error), error) {
+	reader := csv.NewReader(file)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "email", "password_hash", "force_password_reset", "email_verified", "username", "first_name", "last_name", "display_name", "locale":
+			columns[name] = i
+		default:
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("CSV header has no email column")
+	}
+
+	return func() (userImportLine, error) {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return userImportLine{}, io.EOF
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+			return userImportLine{Line: parseErr.StartLine}, invalidRecord("expected %d fields, got %d", len(header), len(fields))
+		}
+		if err != nil {
+			return userImportLine{}, err
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		line := userImportLine{Line: lineNumber}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		optional := func(column string) *string {
+			if v := value(column); v != "" {
+				return &v
+			}
+			return nil
+		}
+		flag := func(column string) (bool, error) {
+			v := value(column)
+			if v == "" {
+				return false, nil
+			}
+			parsed, err := strconv.ParseBool(v)
+			if err != nil {
+				return false, invalidRecord("%s must be a boolean, got %q", column, v)
+			}
+			return parsed, nil
+		}
+
+		line.Record = UserImportRecord{
+			Email:        value("email"),
+			PasswordHash: value("password_hash"),
+			Username:     optional("username"),
+			FirstName:    optional("first_name"),
+			LastName:     optional("last_name"),
+			DisplayName:  optional("display_name"),
+			Locale:       optional("locale"),
+		}
+		if line.Record.ForcePasswordReset, err = flag("force_password_reset"); err != nil {
+			return line, err
+		}
+		if line.Record.EmailVerified, err = flag("email_verified"); err != nil {
+			return line, err
+		}
+		return line, nil
+	}, nil
+}
@@ -0,0 +1,155 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/jobs"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestUserImportService(t *testing.T, env *testutil.AuthEnv) *service.UserImportService {
+	t.Helper()
+
+	runner := jobs.NewRunner(env.Redis, zap.NewNop(), jobs.Config{Workers: 2, PollInterval: 10 * time.Millisecond})
+	imports := service.NewUserImportService(env.Redis, env.Repos.User, utils.NewEmailNormalizer(nil, nil),
+		service.NewPasswordHasher(bcrypt.MinCost, 0, 100), runner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go runner.Run(ctx)
+
+	return imports
+}
+
+func waitUserImport(t *testing.T, imports *service.UserImportService, id string) *service.UserImport {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		userImport, err := imports.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Failed to get import: %v", err)
+		}
+		if userImport.Status != service.UserImportStatusProcessing {
+			return userImport
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the import, got %+v", userImport)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUserImportServiceNDJSON(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	imports := newTestUserImportService(t, env)
+
+	if _, err := env.Service.Register(ctx, &dto.RegisterRequest{Email: "existing@example.com", Password: "Password123"}); err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("Legacy123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	file := strings.Join([]string{
+		`{"email":"Migrated@Example.com","password_hash":"` + string(hash) + `","username":"Migrated","email_verified":true}`,
+		`{"email":"reset@example.com","force_password_reset":true,"first_name":"Reset"}`,
+		``,
+		`{"email":"existing@example.com","force_password_reset":true}`,
+		`{"email":"plain@example.com","password_hash":"secret"}`,
+		`{"email":"not-an-email","force_password_reset":true}`,
+		`{"email":`,
+	}, "\n")
+
+	started, err := imports.Start(ctx, service.UserImportFormatNDJSON, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Failed to start import: %v", err)
+	}
+	if started.Total != 6 {
+		t.Errorf("Expected 6 records, got %d", started.Total)
+	}
+
+	done := waitUserImport(t, imports, started.ID)
+	if done.Status != service.UserImportStatusCompleted || done.Imported != 2 || done.Skipped != 1 || done.Failed != 3 {
+		t.Fatalf("Unexpected import result: %+v", done)
+	}
+	if len(done.Errors) != 3 || done.Errors[0].Line != 5 || done.Errors[1].Line != 6 || done.Errors[2].Line != 7 {
+		t.Errorf("Expected errors for lines 5, 6 and 7, got %+v", done.Errors)
+	}
+
+	// Imported hashes are used as they are
+	response, err := env.Service.Login(ctx, &dto.LoginRequest{Email: "migrated@example.com", Password: "Legacy123"})
+	if err != nil {
+		t.Fatalf("Failed to login with the imported password: %v", err)
+	}
+	migrated, err := env.Repos.User.GetByID(ctx, response.AuthResponse.User.ID)
+	if err != nil {
+		t.Fatalf("Failed to get imported user: %v", err)
+	}
+	if migrated.Email != "migrated@example.com" || migrated.Username == nil || *migrated.Username != "migrated" || !migrated.IsEmailVerified {
+		t.Errorf("Unexpected imported user: %+v", migrated)
+	}
+
+	reset, err := env.Repos.User.GetByEmail(ctx, "reset@example.com")
+	if err != nil {
+		t.Fatalf("Failed to get imported user: %v", err)
+	}
+	if reset.PasswordHash != "" || reset.FirstName == nil || *reset.FirstName != "Reset" {
+		t.Errorf("Expected a user without password, got %+v", reset)
+	}
+}
+
+func TestUserImportServiceCSV(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	imports := newTestUserImportService(t, env)
+
+	file := "email,force_password_reset,username\n" +
+		"first@example.com,true,first\n" +
+		"second@example.com,true,first\n" +
+		"third@example.com,yes,\n" +
+		"fourth@example.com,true\n"
+
+	started, err := imports.Start(ctx, service.UserImportFormatCSV, strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Failed to start import: %v", err)
+	}
+
+	done := waitUserImport(t, imports, started.ID)
+	if done.Total != 4 || done.Imported != 1 || done.Failed != 3 {
+		t.Fatalf("Unexpected import result: %+v", done)
+	}
+	if done.Errors[0].Line != 4 || done.Errors[1].Line != 5 {
+		t.Errorf("Expected parse errors first, got %+v", done.Errors)
+	}
+	if last := done.Errors[2]; last.Line != 3 || last.Error != service.ErrUsernameTaken.Error() {
+		t.Errorf("Expected the duplicate username to fail, got %+v", last)
+	}
+}
+
+func TestUserImportServiceInvalidFile(t *testing.T) {
+	env := testutil.NewAuthEnv(t)
+	imports := newTestUserImportService(t, env)
+
+	if _, err := imports.Start(context.Background(), service.UserImportFormatCSV, strings.NewReader("mail,password\n")); !errors.Is(err, service.ErrInvalidUserImport) {
+		t.Errorf("Expected ErrInvalidUserImport for an unknown column, got %v", err)
+	}
+	if _, err := imports.Start(context.Background(), "xml", strings.NewReader("")); !errors.Is(err, service.ErrInvalidUserImport) {
+		t.Errorf("Expected ErrInvalidUserImport for an unknown format, got %v", err)
+	}
+	if _, err := imports.Get(context.Background(), "unknown"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown import, got %v", err)
+	}
+}
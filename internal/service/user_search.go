@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+)
+
+// Limits of user searches
+const (
+	DefaultUserSearchLimit = 20
+	MaxUserSearchLimit     = 100
+	// minEmailSearchLength is the shortest partial email searched for, shorter ones match most
+	// users and trigram indexes can't serve them
+	minEmailSearchLength = 3
+	maxUserSearchLength  = 254
+)
+
+// What user searches matched
+const (
+	UserMatchID             = "id"
+	UserMatchProviderUserID = "provider_user_id"
+	UserMatchEmail          = "email"
+	UserMatchFlag           = "flag"
+)
+
+// ErrInvalidUserSearch is returned for empty or too long search queries, invalid flags and limits out of 1 to MaxUserSearchLimit
+var ErrInvalidUserSearch = errors.New("invalid user search")
+
+// UserSearchService finds users for admin support
+type UserSearchService struct {
+	users     repository.UserRepository
+	oauthRepo repository.OAuthProviderRepository
+	flags     repository.UserFlagsRepository
+}
+
+// NewUserSearchService creates a new user search service
+func NewUserSearchService(users repository.UserRepository, oauthRepo repository.OAuthProviderRepository, flags repository.UserFlagsRepository) *UserSearchService {
+	return &UserSearchService{users: users, oauthRepo: oauthRepo, flags: flags}
+}
+
+// Search returns up to limit users whose ID is query, who linked a provider account with the ID query,
+// or whose email contains query, in this order
+// With a flag, only users with it are returned and query may be empty to list them, last flagged first.
+func (s *UserSearchService) Search(ctx context.Context, query, flag string, limit int) (_ []*dto.AdminUserResponse, err error) {
+	ctx, span := tracer.Start(ctx, "UserSearchService.Search")
+	defer func() { endSpan(span, err) }()
+
+	query = strings.TrimSpace(query)
+	if (query == "" && flag == "") || len(query) > maxUserSearchLength {
+		return nil, fmt.Errorf("%w: the query must have 1 to %d characters", ErrInvalidUserSearch, maxUserSearchLength)
+	}
+	if flag != "" && !userFlagPattern.MatchString(flag) {
+		return nil, fmt.Errorf("%w: invalid flag %q", ErrInvalidUserSearch, flag)
+	}
+	if limit < 1 || limit > MaxUserSearchLimit {
+		return nil, fmt.Errorf("%w: the limit must be between 1 and %d", ErrInvalidUserSearch, MaxUserSearchLimit)
+	}
+
+	var results []*dto.AdminUserResponse
+	if query == "" {
+		results, err = s.listFlagged(ctx, flag, limit)
+	} else {
+		results, err = s.search(ctx, query, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withFlags(ctx, results, flag)
+}
+
+// search returns up to limit users matching query
+func (s *UserSearchService) search(ctx context.Context, query string, limit int) ([]*dto.AdminUserResponse, error) {
+	results := make([]*dto.AdminUserResponse, 0, limit)
+	found := make(map[string]bool)
+	add := func(result *dto.AdminUserResponse) bool {
+		if !found[result.ID] {
+			found[result.ID] = true
+			results = append(results, result)
+		}
+		return len(results) < limit
+	}
+
+	if _, err := uuid.Parse(query); err == nil {
+		user, err := s.users.GetByID(ctx, query)
+		if err == nil {
+			add(adminUserResponse(user, UserMatchID, ""))
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+	}
+
+	links, err := s.oauthRepo.ListByProviderUserID(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth providers: %w", err)
+	}
+	for _, link := range links {
+		if len(results) == limit || found[link.UserID] {
+			continue
+		}
+		user, err := s.users.GetByID(ctx, link.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		add(adminUserResponse(user, UserMatchProviderUserID, link.Provider))
+	}
+
+	if len(query) >= minEmailSearchLength && len(results) < limit {
+		// Users found already may match again, fetch enough to fill the limit
+		users, err := s.users.SearchByEmail(ctx, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if !add(adminUserResponse(user, UserMatchEmail, "")) {
+				break
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// listFlagged returns up to limit users with the flag
+func (s *UserSearchService) listFlagged(ctx context.Context, flag string, limit int) ([]*dto.AdminUserResponse, error) {
+	flagged, err := s.flags.ListByFlag(ctx, flag, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*dto.AdminUserResponse, 0, len(flagged))
+	for _, flags := range flagged {
+		user, err := s.users.GetByID(ctx, flags.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		results = append(results, adminUserResponse(user, UserMatchFlag, ""))
+	}
+	return results, nil
+}
+
+// withFlags sets the flags of results, leaving out users without the flag unless it is empty
+func (s *UserSearchService) withFlags(ctx context.Context, results []*dto.AdminUserResponse, flag string) ([]*dto.AdminUserResponse, error) {
+	userIDs := make([]string, len(results))
+	for i, result := range results {
+		userIDs[i] = result.ID
+	}
+	saved, err := s.flags.ListByUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	perUser := make(map[string][]string, len(saved))
+	for _, flags := range saved {
+		perUser[flags.UserID] = flags.Flags
+	}
+
+	filtered := results[:0]
+	for _, result := range results {
+		if flags := perUser[result.ID]; flags != nil {
+			result.Flags = flags
+		}
+		if flag == "" || slices.Contains(result.Flags, flag) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered, nil
+}
+
+// adminUserResponse describes a user found by a search
+func adminUserResponse(user *domain.User, matchedBy, provider string) *dto.AdminUserResponse {
+	return &dto.AdminUserResponse{
+		UserResponse: *userResponse(user),
+		IsActive:     user.IsActive,
+		Restriction:  user.Restriction,
+		MatchedBy:    matchedBy,
+		Provider:     provider,
+		Flags:        []string{},
+	}
+}
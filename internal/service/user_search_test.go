@@ -0,0 +1,77 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestUserSearchService(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	search := service.NewUserSearchService(env.Repos.User, env.Repos.OAuthProvider, env.Repos.UserFlags)
+
+	var users []*domain.User
+	for _, email := range []string{"alice@example.com", "bob@example.com", "carol@example.org"} {
+		user := &domain.User{Email: email, EmailNormalized: email, IsActive: true}
+		if err := env.Repos.User.Create(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		users = append(users, user)
+	}
+	if err := env.Repos.OAuthProvider.Create(ctx, &domain.OAuthProvider{UserID: users[2].ID, Provider: "github", ProviderUserID: "example.com"}); err != nil {
+		t.Fatalf("Failed to link provider: %v", err)
+	}
+
+	found, err := search.Search(ctx, users[1].ID, "", 10)
+	if err != nil || len(found) != 1 || found[0].ID != users[1].ID || found[0].MatchedBy != service.UserMatchID || !found[0].IsActive {
+		t.Errorf("Expected the user with the ID, got %+v (%v)", found, err)
+	}
+
+	// Provider accounts match before emails, users are listed once
+	found, err = search.Search(ctx, " example.com ", "", 10)
+	if err != nil || len(found) != 3 {
+		t.Fatalf("Expected 3 users, got %+v (%v)", found, err)
+	}
+	if found[0].ID != users[2].ID || found[0].MatchedBy != service.UserMatchProviderUserID || found[0].Provider != "github" {
+		t.Errorf("Expected the linked user first, got %+v", found[0])
+	}
+	if found[1].ID != users[0].ID || found[1].MatchedBy != service.UserMatchEmail || found[2].ID != users[1].ID {
+		t.Errorf("Expected matches by email next, got %+v %+v", found[1], found[2])
+	}
+	if found, err = search.Search(ctx, "example", "", 1); err != nil || len(found) != 1 {
+		t.Errorf("Expected the limit to apply, got %+v (%v)", found, err)
+	}
+
+	if found, err = search.Search(ctx, "ex", "", 10); err != nil || len(found) != 0 {
+		t.Errorf("Expected short queries not to search emails, got %+v (%v)", found, err)
+	}
+
+	// Flags filter matches and list flagged users without a query
+	if err := env.Repos.UserFlags.Save(ctx, &domain.UserFlags{UserID: users[1].ID, Flags: []string{"chargeback"}}); err != nil {
+		t.Fatalf("Failed to save flags: %v", err)
+	}
+	found, err = search.Search(ctx, "example.com", "chargeback", 10)
+	if err != nil || len(found) != 1 || found[0].ID != users[1].ID || !slices.Equal(found[0].Flags, []string{"chargeback"}) {
+		t.Errorf("Expected the flagged user, got %+v (%v)", found, err)
+	}
+	found, err = search.Search(ctx, "", "chargeback", 10)
+	if err != nil || len(found) != 1 || found[0].ID != users[1].ID || found[0].MatchedBy != service.UserMatchFlag {
+		t.Errorf("Expected the flagged user to be listed, got %+v (%v)", found, err)
+	}
+
+	for _, tt := range []struct {
+		query string
+		flag  string
+		limit int
+	}{{"", "", 10}, {"example", "", 0}, {"example", "", service.MaxUserSearchLimit + 1}, {"example", "Not a flag", 10}} {
+		if _, err := search.Search(ctx, tt.query, tt.flag, tt.limit); !errors.Is(err, service.ErrInvalidUserSearch) {
+			t.Errorf("Expected ErrInvalidUserSearch for %q, flag %q and limit %d, got %v", tt.query, tt.flag, tt.limit, err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ValidationCache keeps the claims of recently validated access tokens in memory for a few seconds,
+// so that busy clients don't cost Redis lookups of the blacklist and revocations on every request
+// Entries are dropped on the invalidations published on revocation and deactivation, tokens of
+// affected users are checked with Redis again right away. Replicas that miss an invalidation keep
+// accepting the tokens for at most the TTL.
+type ValidationCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+	// generation changes on every invalidation, results of validations running meanwhile aren't stored
+	generation uint64
+
+	lookups metric.Int64Counter
+}
+
+type validationCacheEntry struct {
+	key       [sha256.Size]byte
+	claims    domain.TokenClaims
+	expiresAt time.Time
+}
+
+// NewValidationCache creates a validation cache of at most size tokens kept for ttl
+func NewValidationCache(ttl time.Duration, size int) *ValidationCache {
+	c := &ValidationCache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+
+	var err error
+	if c.lookups, err = meter.Int64Counter("auth.tokens.validation_cache",
+		metric.WithDescription("Number of access token validation cache lookups, by result (hit or miss)"),
+	); err != nil {
+		otel.Handle(fmt.Errorf("failed to create validation cache counter: %w", err))
+	}
+
+	return c
+}
+
+// get returns the cached claims of a token still valid with the expiry grace, and the generation
+// to pass to put when the token has to be validated
+func (c *ValidationCache) get(ctx context.Context, token string, expiryGrace time.Duration) (*domain.TokenClaims, uint64) {
+	key := sha256.Sum256([]byte(token))
+	now := c.now()
+
+	c.mu.Lock()
+	var claims *domain.TokenClaims
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*validationCacheEntry)
+		switch {
+		case !now.Before(entry.expiresAt):
+			c.remove(element)
+		case now.Unix() > entry.claims.Exp+int64(expiryGrace.Seconds()):
+			// Expired tokens are left to the validation, which knows the leeway
+		default:
+			c.order.MoveToFront(element)
+			copied := entry.claims
+			claims = &copied
+		}
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	result := "miss"
+	if claims != nil {
+		result = "hit"
+	}
+	c.lookups.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("result", result)))
+
+	return claims, generation
+}
+
+// put caches the claims of a validated token, unless an invalidation happened since generation
+func (c *ValidationCache) put(token string, claims *domain.TokenClaims, generation uint64) {
+	key := sha256.Sum256([]byte(token))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&validationCacheEntry{key: key, claims: *claims, expiresAt: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate drops the cached tokens of a user, or all of them when userID is empty
+func (c *ValidationCache) Invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if userID == "" {
+		clear(c.entries)
+		c.order.Init()
+		return
+	}
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if element.Value.(*validationCacheEntry).claims.UserID == userID {
+			c.remove(element)
+		}
+		element = next
+	}
+}
+
+// Len returns the number of cached tokens
+func (c *ValidationCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *ValidationCache) remove(element *list.Element) {
+	delete(c.entries, element.Value.(*validationCacheEntry).key)
+	c.order.Remove(element)
+}
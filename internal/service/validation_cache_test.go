@@ -0,0 +1,83 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidationCache(t *testing.T) {
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	cache := service.NewValidationCache(time.Minute, 1)
+	revocations := service.NewRevocationService(env.Redis, env.Repos.Token, time.Hour)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	auth := service.NewAuthService(env.Repos.User, env.Repos.Token, env.JWT, env.AccessTokens, service.NewTokenBlacklistService(env.Redis),
+		revocations, utils.NewEmailNormalizer(nil, nil), hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{}, nil, hasher), service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations, orgs, service.NewDeviceBinding(service.DeviceBindingOff, nil), nil, nil, time.Hour, 0,
+		service.WithValidationCache(cache))
+
+	alice, err := auth.Register(ctx, &dto.RegisterRequest{Email: "alice@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	token := alice.AuthResponse.AccessToken
+	if _, err := auth.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("Failed to validate: %v", err)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("Expected the validated token to be cached, got %d entries", cache.Len())
+	}
+
+	// Cached tokens are accepted until the invalidation arrives
+	if _, err := revocations.Revoke(ctx, service.Revocation{UserID: alice.AuthResponse.User.ID, IssuedBefore: time.Now().Add(time.Second)}); err != nil {
+		t.Fatalf("Failed to revoke: %v", err)
+	}
+	claims, err := auth.ValidateToken(ctx, token)
+	if err != nil || claims.UserID != alice.AuthResponse.User.ID {
+		t.Fatalf("Expected the cached claims, got %+v (%v)", claims, err)
+	}
+	cache.Invalidate("someone-else")
+	if cache.Len() != 1 {
+		t.Error("Expected invalidations of other users to keep the token")
+	}
+	cache.Invalidate(alice.AuthResponse.User.ID)
+	if _, err := auth.ValidateToken(ctx, token); !errors.Is(err, service.ErrTokenRevoked) {
+		t.Errorf("Expected the revoked token to be rejected after the invalidation, got %v", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected rejected tokens not to be cached, got %d entries", cache.Len())
+	}
+
+	// The least recently used token is dropped once the cache is full
+	bob, err := auth.Register(ctx, &dto.RegisterRequest{Email: "bob@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	carol, err := auth.Register(ctx, &dto.RegisterRequest{Email: "carol@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to register: %v", err)
+	}
+	for _, token := range []string{bob.AuthResponse.AccessToken, carol.AuthResponse.AccessToken} {
+		if _, err := auth.ValidateToken(ctx, token); err != nil {
+			t.Fatalf("Failed to validate: %v", err)
+		}
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected the cache to stay within its size, got %d entries", cache.Len())
+	}
+	cache.Invalidate("")
+	if cache.Len() != 0 {
+		t.Errorf("Expected invalidations without user to drop everything, got %d entries", cache.Len())
+	}
+}
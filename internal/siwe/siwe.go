@@ -0,0 +1,311 @@
+// Package siwe parses and verifies Sign-In with Ethereum (EIP-4361) messages, signed by wallets
+// with personal_sign (EIP-191).
+package siwe
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// header ends the first line of a message, after the domain requesting the sign-in
+	header = " wants you to sign in with your Ethereum account:"
+
+	// nonceAlphabet are the characters of nonces, EIP-4361 requires alphanumeric ones
+	nonceAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	nonceLength   = 17
+	minNonceLen   = 8
+
+	signatureLength = 65
+)
+
+var (
+	// ErrInvalidMessage is returned for messages not following EIP-4361
+	ErrInvalidMessage = errors.New("invalid sign-in with ethereum message")
+
+	// ErrExpired is returned for messages past their expiration time
+	ErrExpired = errors.New("sign-in with ethereum message expired")
+
+	// ErrNotYetValid is returned for messages before their not before time
+	ErrNotYetValid = errors.New("sign-in with ethereum message not yet valid")
+
+	// ErrInvalidSignature is returned for signatures that are malformed or weren't made by the address
+	ErrInvalidSignature = errors.New("invalid sign-in with ethereum signature")
+
+	// ErrInvalidAddress is returned for strings that aren't Ethereum addresses
+	ErrInvalidAddress = errors.New("invalid ethereum address")
+)
+
+// Message is a parsed EIP-4361 message
+type Message struct {
+	// Scheme is the URI scheme of the origin, empty if the message leaves it out
+	Scheme string
+	// Domain is the authority requesting the sign-in, e.g. app.example.com
+	Domain string
+	// Address is the EIP-55 checksummed address of the account signing in
+	Address   string
+	Statement string
+	URI       string
+	Version   string
+	ChainID   int64
+	Nonce     string
+	IssuedAt  time.Time
+	// ExpirationTime and NotBefore are nil if the message leaves them out
+	ExpirationTime *time.Time
+	NotBefore      *time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// Parse parses an EIP-4361 message
+func Parse(text string) (*Message, error) {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	p := &parser{lines: lines}
+	m := &Message{}
+
+	origin, ok := strings.CutSuffix(p.next(), header)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidMessage)
+	}
+	if scheme, domain, ok := strings.Cut(origin, "://"); ok {
+		m.Scheme, m.Domain = scheme, domain
+	} else {
+		m.Domain = origin
+	}
+	if m.Domain == "" {
+		return nil, fmt.Errorf("%w: missing domain", ErrInvalidMessage)
+	}
+
+	address := p.next()
+	checksummed, err := ChecksumAddress(address)
+	if err != nil || checksummed != address {
+		return nil, fmt.Errorf("%w: address %q is not EIP-55 checksummed", ErrInvalidMessage, address)
+	}
+	m.Address = address
+
+	// The statement is optional and surrounded by empty lines, wallets differ in how many they
+	// write when it's left out
+	p.skipEmpty()
+	if !strings.HasPrefix(p.peek(), "URI: ") {
+		m.Statement = p.next()
+		p.skipEmpty()
+	}
+
+	if m.URI, err = p.field("URI"); err != nil {
+		return nil, err
+	}
+	if m.Version, err = p.field("Version"); err != nil {
+		return nil, err
+	}
+	if m.Version != "1" {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidMessage, m.Version)
+	}
+	chainID, err := p.field("Chain ID")
+	if err != nil {
+		return nil, err
+	}
+	if m.ChainID, err = strconv.ParseInt(chainID, 10, 64); err != nil || m.ChainID <= 0 {
+		return nil, fmt.Errorf("%w: invalid chain id %q", ErrInvalidMessage, chainID)
+	}
+	if m.Nonce, err = p.field("Nonce"); err != nil {
+		return nil, err
+	}
+	if !validNonce(m.Nonce) {
+		return nil, fmt.Errorf("%w: nonce must be at least %d alphanumeric characters", ErrInvalidMessage, minNonceLen)
+	}
+	issuedAt, err := p.field("Issued At")
+	if err != nil {
+		return nil, err
+	}
+	if m.IssuedAt, err = parseTime("Issued At", issuedAt); err != nil {
+		return nil, err
+	}
+
+	if value, ok := p.optionalField("Expiration Time"); ok {
+		t, err := parseTime("Expiration Time", value)
+		if err != nil {
+			return nil, err
+		}
+		m.ExpirationTime = &t
+	}
+	if value, ok := p.optionalField("Not Before"); ok {
+		t, err := parseTime("Not Before", value)
+		if err != nil {
+			return nil, err
+		}
+		m.NotBefore = &t
+	}
+	m.RequestID, _ = p.optionalField("Request ID")
+	if p.peek() == "Resources:" {
+		p.next()
+		for p.more() && strings.HasPrefix(p.peek(), "- ") {
+			m.Resources = append(m.Resources, strings.TrimPrefix(p.next(), "- "))
+		}
+	}
+
+	if p.more() {
+		return nil, fmt.Errorf("%w: unexpected line %q", ErrInvalidMessage, p.peek())
+	}
+	return m, nil
+}
+
+// Valid checks the expiration and not before times of the message at now
+func (m *Message) Valid(now time.Time) error {
+	if m.ExpirationTime != nil && !now.Before(*m.ExpirationTime) {
+		return ErrExpired
+	}
+	if m.NotBefore != nil && now.Before(*m.NotBefore) {
+		return ErrNotYetValid
+	}
+	return nil
+}
+
+// RecoverAddress returns the checksummed address that made an EIP-191 personal_sign signature of
+// message, given hex encoded with or without 0x prefix
+func RecoverAddress(message, signature string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil || len(sig) != signatureLength {
+		return "", fmt.Errorf("%w: expected %d hex encoded bytes", ErrInvalidSignature, signatureLength)
+	}
+
+	// Signatures are R || S || V with V 27 or 28, some wallets use 0 or 1. Compact signatures of
+	// secp256k1 put V first.
+	v := sig[64]
+	if v < 27 {
+		v += 27
+	}
+	if v != 27 && v != 28 {
+		return "", fmt.Errorf("%w: invalid recovery id %d", ErrInvalidSignature, sig[64])
+	}
+	compact := append([]byte{v}, sig[:64]...)
+
+	publicKey, _, err := ecdsa.RecoverCompact(compact, HashMessage(message))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	address := keccak256(publicKey.SerializeUncompressed()[1:])[12:]
+	return ChecksumAddress("0x" + hex.EncodeToString(address))
+}
+
+// HashMessage returns the EIP-191 hash personal_sign signs for message
+func HashMessage(message string) []byte {
+	return keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+}
+
+// ChecksumAddress returns the EIP-55 mixed-case form of an address, given in any case
+func ChecksumAddress(address string) (string, error) {
+	hexAddress, ok := strings.CutPrefix(address, "0x")
+	if !ok || len(hexAddress) != 40 {
+		return "", ErrInvalidAddress
+	}
+	hexAddress = strings.ToLower(hexAddress)
+	if _, err := hex.DecodeString(hexAddress); err != nil {
+		return "", ErrInvalidAddress
+	}
+
+	hash := hex.EncodeToString(keccak256([]byte(hexAddress)))
+	checksummed := []byte(hexAddress)
+	for i, c := range checksummed {
+		if c >= 'a' && hash[i] >= '8' {
+			checksummed[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(checksummed), nil
+}
+
+// GenerateNonce returns a random alphanumeric nonce
+func GenerateNonce() (string, error) {
+	nonce := make([]byte, nonceLength)
+	limit := big.NewInt(int64(len(nonceAlphabet)))
+	for i := range nonce {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		nonce[i] = nonceAlphabet[n.Int64()]
+	}
+	return string(nonce), nil
+}
+
+func validNonce(nonce string) bool {
+	if len(nonce) < minNonceLen {
+		return false
+	}
+	for _, c := range nonce {
+		if !strings.ContainsRune(nonceAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTime(name, value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid %s %q", ErrInvalidMessage, name, value)
+	}
+	return t, nil
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// parser reads the lines of a message in order
+type parser struct {
+	lines []string
+	pos   int
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.lines)
+}
+
+func (p *parser) peek() string {
+	if !p.more() {
+		return ""
+	}
+	return p.lines[p.pos]
+}
+
+func (p *parser) next() string {
+	line := p.peek()
+	p.pos++
+	return line
+}
+
+func (p *parser) skipEmpty() {
+	for p.more() && p.peek() == "" {
+		p.pos++
+	}
+}
+
+// field reads the required "name: value" line
+func (p *parser) field(name string) (string, error) {
+	value, ok := p.optionalField(name)
+	if !ok {
+		return "", fmt.Errorf("%w: missing %s", ErrInvalidMessage, name)
+	}
+	return value, nil
+}
+
+// optionalField reads the "name: value" line if it is the next one
+func (p *parser) optionalField(name string) (string, bool) {
+	value, ok := strings.CutPrefix(p.peek(), name+": ")
+	if !ok || !p.more() {
+		return "", false
+	}
+	p.pos++
+	return value, true
+}
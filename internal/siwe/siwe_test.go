@@ -0,0 +1,152 @@
+package siwe
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// address of the private key 1
+const testAddress = "0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf"
+
+const testMessage = `https://app.example.com wants you to sign in with your Ethereum account:
+0x7E5F4552091A69125d5DfCb7b8C2659029395Bdf
+
+I accept the Terms of Service: https://app.example.com/tos
+
+URI: https://app.example.com/login
+Version: 1
+Chain ID: 1
+Nonce: 32891756abcdEF
+Issued At: 2026-01-01T12:00:00Z
+Expiration Time: 2026-01-01T12:10:00.000Z
+Request ID: request-1
+Resources:
+- ipfs://bafybeiemxf5abjwjbikoz4mc3a3dla6ual3jsgpdr4cjr3oz3evfyavhwq/
+- https://example.com/my-web2-claim.json`
+
+// sign signs message with personal_sign of the private key 1, V is 27 or 28
+func sign(t *testing.T, message string) string {
+	t.Helper()
+	key := secp256k1.PrivKeyFromBytes([]byte{1})
+	compact := ecdsa.SignCompact(key, HashMessage(message), false)
+	return "0x" + hex.EncodeToString(append(compact[1:], compact[0]))
+}
+
+func TestParse(t *testing.T) {
+	m, err := Parse(testMessage)
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if m.Scheme != "https" || m.Domain != "app.example.com" || m.Address != testAddress {
+		t.Errorf("Unexpected origin or address: %s %s %s", m.Scheme, m.Domain, m.Address)
+	}
+	if m.Statement != "I accept the Terms of Service: https://app.example.com/tos" || m.URI != "https://app.example.com/login" {
+		t.Errorf("Unexpected statement or URI: %q %q", m.Statement, m.URI)
+	}
+	if m.ChainID != 1 || m.Nonce != "32891756abcdEF" || m.RequestID != "request-1" || len(m.Resources) != 2 {
+		t.Errorf("Unexpected fields: %+v", m)
+	}
+	if m.ExpirationTime == nil || !m.ExpirationTime.Equal(m.IssuedAt.Add(10*time.Minute)) || m.NotBefore != nil {
+		t.Errorf("Unexpected times: %v %v %v", m.IssuedAt, m.ExpirationTime, m.NotBefore)
+	}
+
+	minimal := "app.example.com" + header + "\n" + testAddress + "\n\n\nURI: https://app.example.com\nVersion: 1\nChain ID: 137\nNonce: abcdefgh\nIssued At: 2026-01-01T12:00:00+02:00\n"
+	if m, err := Parse(minimal); err != nil || m.Scheme != "" || m.Statement != "" || m.ChainID != 137 {
+		t.Errorf("Expected a message without optional fields to parse, got %+v %v", m, err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{name: "missing header", message: strings.Replace(testMessage, header, " wants you to sign in", 1)},
+		{name: "address not checksummed", message: strings.Replace(testMessage, testAddress, strings.ToLower(testAddress), 1)},
+		{name: "unsupported version", message: strings.Replace(testMessage, "Version: 1", "Version: 2", 1)},
+		{name: "short nonce", message: strings.Replace(testMessage, "32891756abcdEF", "abc", 1)},
+		{name: "invalid issued at", message: strings.Replace(testMessage, "2026-01-01T12:00:00Z", "yesterday", 1)},
+		{name: "missing nonce", message: strings.Replace(testMessage, "Nonce: 32891756abcdEF\n", "", 1)},
+		{name: "trailing line", message: testMessage + "\nextra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.message); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("Expected ErrInvalidMessage, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMessageValid(t *testing.T) {
+	m, err := Parse(strings.Replace(testMessage, "Request ID", "Not Before: 2026-01-01T12:00:00Z\nRequest ID", 1))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if err := m.Valid(m.IssuedAt.Add(time.Minute)); err != nil {
+		t.Errorf("Expected message to be valid, got %v", err)
+	}
+	if err := m.Valid(m.IssuedAt.Add(-time.Second)); !errors.Is(err, ErrNotYetValid) {
+		t.Errorf("Expected ErrNotYetValid, got %v", err)
+	}
+	if err := m.Valid(*m.ExpirationTime); !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got %v", err)
+	}
+}
+
+func TestRecoverAddress(t *testing.T) {
+	signature := sign(t, testMessage)
+	address, err := RecoverAddress(testMessage, signature)
+	if err != nil || address != testAddress {
+		t.Fatalf("Expected %s, got %s %v", testAddress, address, err)
+	}
+
+	// Some wallets use 0 or 1 for V
+	raw, _ := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	raw[64] -= 27
+	if address, err := RecoverAddress(testMessage, hex.EncodeToString(raw)); err != nil || address != testAddress {
+		t.Errorf("Expected %s with V 0 or 1, got %s %v", testAddress, address, err)
+	}
+
+	if address, _ := RecoverAddress(testMessage+" ", signature); address == testAddress {
+		t.Error("Expected another message to recover another address")
+	}
+	for _, signature := range []string{"0x1234", "not hex", "0x" + strings.Repeat("00", 64) + "05"} {
+		if _, err := RecoverAddress(testMessage, signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected ErrInvalidSignature for %q, got %v", signature, err)
+		}
+	}
+}
+
+func TestChecksumAddress(t *testing.T) {
+	// Test vectors of EIP-55
+	for _, want := range []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	} {
+		if got, err := ChecksumAddress(strings.ToLower(want)); err != nil || got != want {
+			t.Errorf("Expected %s, got %s %v", want, got, err)
+		}
+	}
+	for _, address := range []string{"5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "0x5aaeb6", "0xzzaeb6053f3e94c9b9a09f33669435e7ef1beaed"} {
+		if _, err := ChecksumAddress(address); !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("Expected ErrInvalidAddress for %s, got %v", address, err)
+		}
+	}
+}
+
+func TestGenerateNonce(t *testing.T) {
+	nonce, err := GenerateNonce()
+	if err != nil || !validNonce(nonce) {
+		t.Fatalf("Expected a valid nonce, got %q %v", nonce, err)
+	}
+	if other, _ := GenerateNonce(); other == nonce {
+		t.Error("Expected nonces to differ")
+	}
+}
@@ -0,0 +1,488 @@
+package testutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/pkg/mailer"
+)
+
+// The fakes call the stub of a method if it is set and delegate to Base otherwise,
+// so a test can override single methods of a real or in-memory implementation.
+// Methods without a stub and without Base return ErrNotStubbed.
+var (
+	_ service.AuthService        = (*AuthService)(nil)
+	_ repository.UserRepository  = (*UserRepository)(nil)
+	_ repository.TokenRepository = (*TokenRepository)(nil)
+	_ service.RateLimiter        = (*RateLimiter)(nil)
+	_ mailer.Mailer              = (*Mailer)(nil)
+)
+
+// AuthService is a fake service.AuthService
+type AuthService struct {
+	Base service.AuthService
+
+	RegisterFunc               func(ctx context.Context, req *dto.RegisterRequest) (*service.AuthResponseWithRefreshToken, error)
+	RegisterWithInvitationFunc func(ctx context.Context, token string, req *dto.RegisterWithInvitationRequest) (*service.AuthResponseWithRefreshToken, error)
+	LoginFunc                  func(ctx context.Context, req *dto.LoginRequest) (*service.AuthResponseWithRefreshToken, error)
+	IssueSessionFunc           func(ctx context.Context, userID string) (*service.AuthResponseWithRefreshToken, error)
+	RefreshTokenFunc           func(ctx context.Context, refreshToken string) (*service.AuthResponseWithRefreshToken, error)
+	LogoutFunc                 func(ctx context.Context, userID, refreshToken string) error
+	RevokeTokenFunc            func(ctx context.Context, token, tokenTypeHint string) error
+	GetUserFunc                func(ctx context.Context, userID string) (*dto.UserResponse, error)
+	UpdateProfileFunc          func(ctx context.Context, userID string, req *dto.UpdateProfileRequest) (*dto.UserResponse, error)
+	IsUsernameAvailableFunc    func(ctx context.Context, username string) (bool, error)
+	ListSessionsFunc           func(ctx context.Context, userID string) ([]*dto.SessionResponse, error)
+	RevokeSessionFunc          func(ctx context.Context, userID, sessionID string) error
+	ValidateTokenFunc          func(ctx context.Context, token string) (*domain.TokenClaims, error)
+}
+
+func (f *AuthService) Register(ctx context.Context, req *dto.RegisterRequest) (*service.AuthResponseWithRefreshToken, error) {
+	if f.RegisterFunc != nil {
+		return f.RegisterFunc(ctx, req)
+	}
+	if f.Base != nil {
+		return f.Base.Register(ctx, req)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) RegisterWithInvitation(ctx context.Context, token string, req *dto.RegisterWithInvitationRequest) (*service.AuthResponseWithRefreshToken, error) {
+	if f.RegisterWithInvitationFunc != nil {
+		return f.RegisterWithInvitationFunc(ctx, token, req)
+	}
+	if f.Base != nil {
+		return f.Base.RegisterWithInvitation(ctx, token, req)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) Login(ctx context.Context, req *dto.LoginRequest) (*service.AuthResponseWithRefreshToken, error) {
+	if f.LoginFunc != nil {
+		return f.LoginFunc(ctx, req)
+	}
+	if f.Base != nil {
+		return f.Base.Login(ctx, req)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*service.AuthResponseWithRefreshToken, error) {
+	if f.RefreshTokenFunc != nil {
+		return f.RefreshTokenFunc(ctx, refreshToken)
+	}
+	if f.Base != nil {
+		return f.Base.RefreshToken(ctx, refreshToken)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) IssueSession(ctx context.Context, userID string) (*service.AuthResponseWithRefreshToken, error) {
+	if f.IssueSessionFunc != nil {
+		return f.IssueSessionFunc(ctx, userID)
+	}
+	if f.Base != nil {
+		return f.Base.IssueSession(ctx, userID)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) Logout(ctx context.Context, userID, refreshToken string) error {
+	if f.LogoutFunc != nil {
+		return f.LogoutFunc(ctx, userID, refreshToken)
+	}
+	if f.Base != nil {
+		return f.Base.Logout(ctx, userID, refreshToken)
+	}
+	return ErrNotStubbed
+}
+
+func (f *AuthService) RevokeToken(ctx context.Context, token, tokenTypeHint string) error {
+	if f.RevokeTokenFunc != nil {
+		return f.RevokeTokenFunc(ctx, token, tokenTypeHint)
+	}
+	if f.Base != nil {
+		return f.Base.RevokeToken(ctx, token, tokenTypeHint)
+	}
+	return ErrNotStubbed
+}
+
+func (f *AuthService) GetUser(ctx context.Context, userID string) (*dto.UserResponse, error) {
+	if f.GetUserFunc != nil {
+		return f.GetUserFunc(ctx, userID)
+	}
+	if f.Base != nil {
+		return f.Base.GetUser(ctx, userID)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) UpdateProfile(ctx context.Context, userID string, req *dto.UpdateProfileRequest) (*dto.UserResponse, error) {
+	if f.UpdateProfileFunc != nil {
+		return f.UpdateProfileFunc(ctx, userID, req)
+	}
+	if f.Base != nil {
+		return f.Base.UpdateProfile(ctx, userID, req)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) IsUsernameAvailable(ctx context.Context, username string) (bool, error) {
+	if f.IsUsernameAvailableFunc != nil {
+		return f.IsUsernameAvailableFunc(ctx, username)
+	}
+	if f.Base != nil {
+		return f.Base.IsUsernameAvailable(ctx, username)
+	}
+	return false, ErrNotStubbed
+}
+
+func (f *AuthService) ListSessions(ctx context.Context, userID string) ([]*dto.SessionResponse, error) {
+	if f.ListSessionsFunc != nil {
+		return f.ListSessionsFunc(ctx, userID)
+	}
+	if f.Base != nil {
+		return f.Base.ListSessions(ctx, userID)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if f.RevokeSessionFunc != nil {
+		return f.RevokeSessionFunc(ctx, userID, sessionID)
+	}
+	if f.Base != nil {
+		return f.Base.RevokeSession(ctx, userID, sessionID)
+	}
+	return ErrNotStubbed
+}
+
+func (f *AuthService) ValidateToken(ctx context.Context, token string, opts ...service.ValidateOption) (*domain.TokenClaims, error) {
+	if f.ValidateTokenFunc != nil {
+		return f.ValidateTokenFunc(ctx, token)
+	}
+	if f.Base != nil {
+		return f.Base.ValidateToken(ctx, token, opts...)
+	}
+	return nil, ErrNotStubbed
+}
+
+// UserRepository is a fake repository.UserRepository, e.g. to inject storage errors
+type UserRepository struct {
+	Base repository.UserRepository
+
+	CreateFunc                     func(ctx context.Context, user *domain.User) error
+	GetByEmailFunc                 func(ctx context.Context, email string) (*domain.User, error)
+	GetByIDFunc                    func(ctx context.Context, id string) (*domain.User, error)
+	GetByUsernameFunc              func(ctx context.Context, username string) (*domain.User, error)
+	SearchByEmailFunc              func(ctx context.Context, query string, limit int) ([]*domain.User, error)
+	UpdateFunc                     func(ctx context.Context, user *domain.User) error
+	UpdateLastLoginFunc            func(ctx context.Context, userID, ip string) error
+	SetRestrictionFunc             func(ctx context.Context, userID, restriction string) error
+	ListAfterFunc                  func(ctx context.Context, afterID string, limit int) ([]*domain.User, error)
+	SetEmailNormalizedFunc         func(ctx context.Context, userID, emailNormalized string) error
+	ListUnverifiedToWarnFunc       func(ctx context.Context, createdBefore time.Time, limit int) ([]*domain.User, error)
+	ListUnverifiedWarnedBeforeFunc func(ctx context.Context, warnedBefore time.Time, limit int) ([]*domain.User, error)
+	MarkUnverifiedWarnedFunc       func(ctx context.Context, userID string, at time.Time) error
+	DeleteFunc                     func(ctx context.Context, id string) error
+}
+
+func (f *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	if f.CreateFunc != nil {
+		return f.CreateFunc(ctx, user)
+	}
+	if f.Base != nil {
+		return f.Base.Create(ctx, user)
+	}
+	return ErrNotStubbed
+}
+
+func (f *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if f.GetByEmailFunc != nil {
+		return f.GetByEmailFunc(ctx, email)
+	}
+	if f.Base != nil {
+		return f.Base.GetByEmail(ctx, email)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	if f.GetByIDFunc != nil {
+		return f.GetByIDFunc(ctx, id)
+	}
+	if f.Base != nil {
+		return f.Base.GetByID(ctx, id)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	if f.GetByUsernameFunc != nil {
+		return f.GetByUsernameFunc(ctx, username)
+	}
+	if f.Base != nil {
+		return f.Base.GetByUsername(ctx, username)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) SearchByEmail(ctx context.Context, query string, limit int) ([]*domain.User, error) {
+	if f.SearchByEmailFunc != nil {
+		return f.SearchByEmailFunc(ctx, query, limit)
+	}
+	if f.Base != nil {
+		return f.Base.SearchByEmail(ctx, query, limit)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) Update(ctx context.Context, user *domain.User) error {
+	if f.UpdateFunc != nil {
+		return f.UpdateFunc(ctx, user)
+	}
+	if f.Base != nil {
+		return f.Base.Update(ctx, user)
+	}
+	return ErrNotStubbed
+}
+
+func (f *UserRepository) UpdateLastLogin(ctx context.Context, userID, ip string) error {
+	if f.UpdateLastLoginFunc != nil {
+		return f.UpdateLastLoginFunc(ctx, userID, ip)
+	}
+	if f.Base != nil {
+		return f.Base.UpdateLastLogin(ctx, userID, ip)
+	}
+	return ErrNotStubbed
+}
+
+func (f *UserRepository) SetRestriction(ctx context.Context, userID, restriction string) error {
+	if f.SetRestrictionFunc != nil {
+		return f.SetRestrictionFunc(ctx, userID, restriction)
+	}
+	if f.Base != nil {
+		return f.Base.SetRestriction(ctx, userID, restriction)
+	}
+	return ErrNotStubbed
+}
+
+func (f *UserRepository) ListAfter(ctx context.Context, afterID string, limit int) ([]*domain.User, error) {
+	if f.ListAfterFunc != nil {
+		return f.ListAfterFunc(ctx, afterID, limit)
+	}
+	if f.Base != nil {
+		return f.Base.ListAfter(ctx, afterID, limit)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) SetEmailNormalized(ctx context.Context, userID, emailNormalized string) error {
+	if f.SetEmailNormalizedFunc != nil {
+		return f.SetEmailNormalizedFunc(ctx, userID, emailNormalized)
+	}
+	if f.Base != nil {
+		return f.Base.SetEmailNormalized(ctx, userID, emailNormalized)
+	}
+	return ErrNotStubbed
+}
+
+func (f *UserRepository) ListUnverifiedToWarn(ctx context.Context, createdBefore time.Time, limit int) ([]*domain.User, error) {
+	if f.ListUnverifiedToWarnFunc != nil {
+		return f.ListUnverifiedToWarnFunc(ctx, createdBefore, limit)
+	}
+	if f.Base != nil {
+		return f.Base.ListUnverifiedToWarn(ctx, createdBefore, limit)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) ListUnverifiedWarnedBefore(ctx context.Context, warnedBefore time.Time, limit int) ([]*domain.User, error) {
+	if f.ListUnverifiedWarnedBeforeFunc != nil {
+		return f.ListUnverifiedWarnedBeforeFunc(ctx, warnedBefore, limit)
+	}
+	if f.Base != nil {
+		return f.Base.ListUnverifiedWarnedBefore(ctx, warnedBefore, limit)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *UserRepository) MarkUnverifiedWarned(ctx context.Context, userID string, at time.Time) error {
+	if f.MarkUnverifiedWarnedFunc != nil {
+		return f.MarkUnverifiedWarnedFunc(ctx, userID, at)
+	}
+	if f.Base != nil {
+		return f.Base.MarkUnverifiedWarned(ctx, userID, at)
+	}
+	return ErrNotStubbed
+}
+
+func (f *UserRepository) Delete(ctx context.Context, id string) error {
+	if f.DeleteFunc != nil {
+		return f.DeleteFunc(ctx, id)
+	}
+	if f.Base != nil {
+		return f.Base.Delete(ctx, id)
+	}
+	return ErrNotStubbed
+}
+
+// TokenRepository is a fake repository.TokenRepository, e.g. to inject storage errors
+type TokenRepository struct {
+	Base repository.TokenRepository
+
+	CreateFunc             func(ctx context.Context, token *domain.RefreshToken) error
+	GetByTokenHashFunc     func(ctx context.Context, tokenHash string) (*domain.RefreshToken, error)
+	GetByUserIDFunc        func(ctx context.Context, userID string) ([]*domain.RefreshToken, error)
+	RevokeFunc             func(ctx context.Context, tokenID, reason string) error
+	RevokeByTokenHashFunc  func(ctx context.Context, tokenHash, reason string) error
+	RotateFunc             func(ctx context.Context, tokenHash string, next *domain.RefreshToken) error
+	RevokeIssuedBeforeFunc func(ctx context.Context, userID string, before time.Time, reason string) (int64, error)
+	PurgeFunc              func(ctx context.Context, before time.Time) (int64, error)
+}
+
+func (f *TokenRepository) Create(ctx context.Context, token *domain.RefreshToken) error {
+	if f.CreateFunc != nil {
+		return f.CreateFunc(ctx, token)
+	}
+	if f.Base != nil {
+		return f.Base.Create(ctx, token)
+	}
+	return ErrNotStubbed
+}
+
+func (f *TokenRepository) GetByTokenHash(ctx context.Context, tokenHash string) (*domain.RefreshToken, error) {
+	if f.GetByTokenHashFunc != nil {
+		return f.GetByTokenHashFunc(ctx, tokenHash)
+	}
+	if f.Base != nil {
+		return f.Base.GetByTokenHash(ctx, tokenHash)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *TokenRepository) GetByUserID(ctx context.Context, userID string) ([]*domain.RefreshToken, error) {
+	if f.GetByUserIDFunc != nil {
+		return f.GetByUserIDFunc(ctx, userID)
+	}
+	if f.Base != nil {
+		return f.Base.GetByUserID(ctx, userID)
+	}
+	return nil, ErrNotStubbed
+}
+
+func (f *TokenRepository) Revoke(ctx context.Context, tokenID, reason string) error {
+	if f.RevokeFunc != nil {
+		return f.RevokeFunc(ctx, tokenID, reason)
+	}
+	if f.Base != nil {
+		return f.Base.Revoke(ctx, tokenID, reason)
+	}
+	return ErrNotStubbed
+}
+
+func (f *TokenRepository) RevokeByTokenHash(ctx context.Context, tokenHash, reason string) error {
+	if f.RevokeByTokenHashFunc != nil {
+		return f.RevokeByTokenHashFunc(ctx, tokenHash, reason)
+	}
+	if f.Base != nil {
+		return f.Base.RevokeByTokenHash(ctx, tokenHash, reason)
+	}
+	return ErrNotStubbed
+}
+
+func (f *TokenRepository) Rotate(ctx context.Context, tokenHash string, next *domain.RefreshToken) error {
+	if f.RotateFunc != nil {
+		return f.RotateFunc(ctx, tokenHash, next)
+	}
+	if f.Base != nil {
+		return f.Base.Rotate(ctx, tokenHash, next)
+	}
+	return ErrNotStubbed
+}
+
+func (f *TokenRepository) RevokeIssuedBefore(ctx context.Context, userID string, before time.Time, reason string) (int64, error) {
+	if f.RevokeIssuedBeforeFunc != nil {
+		return f.RevokeIssuedBeforeFunc(ctx, userID, before, reason)
+	}
+	if f.Base != nil {
+		return f.Base.RevokeIssuedBefore(ctx, userID, before, reason)
+	}
+	return 0, ErrNotStubbed
+}
+
+func (f *TokenRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	if f.PurgeFunc != nil {
+		return f.PurgeFunc(ctx, before)
+	}
+	if f.Base != nil {
+		return f.Base.Purge(ctx, before)
+	}
+	return 0, ErrNotStubbed
+}
+
+// RateLimiter is a fake service.RateLimiter allowing a fixed number of requests per key
+// Windows never expire, a zero Limit uses the limit passed by the caller
+type RateLimiter struct {
+	Limit int
+	Err   error
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (f *RateLimiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*service.RateLimitResult, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.Limit > 0 {
+		limit = f.Limit
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.counts == nil {
+		f.counts = make(map[string]int)
+	}
+
+	result := &service.RateLimitResult{Limit: limit, ResetAt: time.Now().Add(window)}
+	if f.counts[key] < limit {
+		f.counts[key]++
+		result.Allowed = true
+	}
+	result.Remaining = limit - f.counts[key]
+	return result, nil
+}
+
+// Mailer is a fake mailer.Mailer recording sent messages
+type Mailer struct {
+	// Err is returned by Send instead of recording the message
+	Err error
+
+	mu   sync.Mutex
+	sent []*mailer.Message
+}
+
+func (f *Mailer) Send(ctx context.Context, msg *mailer.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far
+func (f *Mailer) Sent() []*mailer.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*mailer.Message(nil), f.sent...)
+}
@@ -0,0 +1,82 @@
+// Package testutil provides fakes and in-memory dependencies for unit tests
+// Tests using it need neither Postgres nor Redis.
+package testutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/internal/repository/memory"
+	"github.com/prperemyshlev/auth-service-2/internal/service"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// JWTSecret is the JWT secret used by NewAuthEnv
+const JWTSecret = "testutil-secret-key-with-at-least-32-characters"
+
+// ErrNotStubbed is returned by fakes for methods that have neither a stub nor a base implementation
+var ErrNotStubbed = errors.New("testutil: method not stubbed")
+
+// NewRedis starts an in-memory Redis server that is stopped when the test ends
+func NewRedis(tb testing.TB) *database.Redis {
+	tb.Helper()
+
+	server := miniredis.RunT(tb)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tb.Cleanup(func() { _ = client.Close() })
+
+	return &database.Redis{Client: client}
+}
+
+// AuthEnv is a real auth service wired to in-memory repositories and Redis
+type AuthEnv struct {
+	Service service.AuthService
+	Repos   *repository.Repositories
+	Redis   *database.Redis
+	JWT     *utils.JWTManager
+	// AccessTokens issues JWT access tokens signed by JWT
+	AccessTokens service.AccessTokenStrategy
+}
+
+// NewAuthEnv creates an auth service for tests
+// Passwords are hashed with the minimal bcrypt cost to keep tests fast
+func NewAuthEnv(tb testing.TB) *AuthEnv {
+	tb.Helper()
+
+	env := &AuthEnv{
+		Repos: memory.NewRepositories(),
+		Redis: NewRedis(tb),
+		JWT:   utils.NewJWTManager(JWTSecret, 15*time.Minute, 24*time.Hour),
+	}
+	env.AccessTokens = service.NewJWTAccessTokens(env.JWT)
+	hasher := service.NewPasswordHasher(bcrypt.MinCost, 0, 100)
+	invitations := service.NewInvitationService(env.Repos.Invitation, utils.NewEmailNormalizer(nil, nil), service.InvitationConfig{TTL: 24 * time.Hour})
+	orgs := service.NewOrganizationService(env.Repos.Organization, env.Repos.User, invitations, utils.NewEmailNormalizer(nil, nil), env.AccessTokens)
+	invitations.OnAccept(orgs.AcceptInvitation)
+	env.Service = service.NewAuthService(
+		env.Repos.User,
+		env.Repos.Token,
+		env.JWT,
+		env.AccessTokens,
+		service.NewTokenBlacklistService(env.Redis),
+		service.NewRevocationService(env.Redis, env.Repos.Token, 15*time.Minute),
+		utils.NewEmailNormalizer(nil, nil),
+		hasher,
+		service.NewEnumerationPolicy(service.EnumerationConfig{UniformResponses: true}, nil, hasher),
+		service.NewConsentService(env.Repos.Consent, "", ""),
+		invitations,
+		orgs,
+		service.NewDeviceBinding(service.DeviceBindingOff, nil),
+		nil,
+		nil,
+		24*time.Hour,
+		0,
+	)
+	return env
+}
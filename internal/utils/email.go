@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// wildcardDomain matches every email domain in normalization policies
+const wildcardDomain = "*"
+
+// EmailNormalizer produces a canonical form of email addresses used for uniqueness checks
+// On top of lowercasing and trimming it can strip "+tag" suffixes and dots from
+// the local part for providers that ignore them, e.g. gmail.com
+type EmailNormalizer struct {
+	plusDomains map[string]bool
+	dotDomains  map[string]bool
+}
+
+// NewEmailNormalizer creates a new email normalizer
+// plusDomains and dotDomains list domains where "+tags" and dots are ignored, "*" matches all domains
+func NewEmailNormalizer(plusDomains, dotDomains []string) *EmailNormalizer {
+	return &EmailNormalizer{
+		plusDomains: domainSet(plusDomains),
+		dotDomains:  domainSet(dotDomains),
+	}
+}
+
+// Normalize returns the canonical form of an email address
+func (n *EmailNormalizer) Normalize(email string) string {
+	email = SanitizeEmail(email)
+
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || n == nil {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if matchesDomain(n.plusDomains, domain) {
+		if plus := strings.Index(local, "+"); plus > 0 {
+			local = local[:plus]
+		}
+	}
+
+	if matchesDomain(n.dotDomains, domain) {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+
+	return local + "@" + domain
+}
+
+// Policy describes the normalization rules, e.g. "plus=gmail.com;dot=gmail.com", so that a
+// change of policy can be told apart
+func (n *EmailNormalizer) Policy() string {
+	if n == nil {
+		return "plus=;dot="
+	}
+	plus := slices.Sorted(maps.Keys(n.plusDomains))
+	dot := slices.Sorted(maps.Keys(n.dotDomains))
+	return "plus=" + strings.Join(plus, ",") + ";dot=" + strings.Join(dot, ",")
+}
+
+func domainSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			set[domain] = true
+		}
+	}
+	return set
+}
+
+func matchesDomain(domains map[string]bool, domain string) bool {
+	return domains[wildcardDomain] || domains[domain]
+}
@@ -0,0 +1,47 @@
+package utils
+
+import "testing"
+
+func TestEmailNormalizer(t *testing.T) {
+	normalizer := NewEmailNormalizer([]string{"gmail.com", "googlemail.com"}, []string{"gmail.com"})
+
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{" User@Example.com ", "user@example.com"},
+		{"user+1@gmail.com", "user@gmail.com"},
+		{"first.last+news@GMAIL.com", "firstlast@gmail.com"},
+		{"first.last+news@googlemail.com", "first.last@googlemail.com"},
+		{"first.last+news@example.com", "first.last+news@example.com"},
+		{"+tag@gmail.com", "+tag@gmail.com"},
+		{"not-an-email", "not-an-email"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizer.Normalize(tt.email); got != tt.expected {
+			t.Errorf("Normalize(%q) = %q, expected %q", tt.email, got, tt.expected)
+		}
+	}
+}
+
+func TestEmailNormalizerWildcard(t *testing.T) {
+	normalizer := NewEmailNormalizer([]string{"*"}, nil)
+
+	if got := normalizer.Normalize("user+tag@example.com"); got != "user@example.com" {
+		t.Errorf("Expected plus tag to be stripped for all domains, got %q", got)
+	}
+	if got := normalizer.Normalize("first.last@gmail.com"); got != "first.last@gmail.com" {
+		t.Errorf("Expected dots to be kept without a dot policy, got %q", got)
+	}
+}
+
+func TestEmailNormalizerPolicy(t *testing.T) {
+	normalizer := NewEmailNormalizer([]string{"googlemail.com", "GMAIL.com"}, []string{"gmail.com"})
+	if got := normalizer.Policy(); got != "plus=gmail.com,googlemail.com;dot=gmail.com" {
+		t.Errorf("Unexpected policy %q", got)
+	}
+	if got := NewEmailNormalizer(nil, nil).Policy(); got != "plus=;dot=" {
+		t.Errorf("Unexpected empty policy %q", got)
+	}
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -9,39 +13,234 @@ import (
 	"github.com/prperemyshlev/auth-service-2/internal/domain"
 )
 
+// defaultLeeway tolerates clock differences between the service and its clients when checking exp, iat and nbf
+const defaultLeeway = 30 * time.Second
+
+// SigningKey is an HMAC secret, tokens it signs name its ID in the kid header
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// NewSigningKey creates a key for a configured secret, its ID is derived from the secret
+// so that all replicas name it the same
+func NewSigningKey(secret string) SigningKey {
+	sum := sha256.Sum256([]byte(secret))
+	return SigningKey{ID: hex.EncodeToString(sum[:8]), Secret: []byte(secret)}
+}
+
+// SigningKeys provides the HMAC secrets of a JWTManager, e.g. a keyring rotated at runtime
+type SigningKeys interface {
+	// Current returns the key new tokens are signed with
+	Current() SigningKey
+	// Verification returns the keys tokens are validated with, including the current one
+	Verification() []SigningKey
+}
+
+// staticSigningKeys are signing keys that don't change
+type staticSigningKeys struct {
+	keys []SigningKey
+}
+
+// StaticSigningKeys signs tokens with current and validates tokens signed with current or previous
+func StaticSigningKeys(current SigningKey, previous ...SigningKey) SigningKeys {
+	return &staticSigningKeys{keys: append([]SigningKey{current}, previous...)}
+}
+
+func (s *staticSigningKeys) Current() SigningKey {
+	return s.keys[0]
+}
+
+func (s *staticSigningKeys) Verification() []SigningKey {
+	return s.keys
+}
+
 // JWTManager manages JWT token operations
 type JWTManager struct {
-	secret             []byte
+	keys               SigningKeys
 	accessTokenExpiry  time.Duration
 	refreshTokenExpiry time.Duration
+	issuer             string
+	audience           []string
+	leeway             time.Duration
+	parserOpts         []jwt.ParserOption
+	parser             *jwt.Parser
 }
 
-// NewJWTManager creates a new JWT manager
-func NewJWTManager(secret string, accessTokenExpiry, refreshTokenExpiry time.Duration) *JWTManager {
-	return &JWTManager{
-		secret:             []byte(secret),
+// JWTOption configures a JWTManager
+type JWTOption func(*JWTManager)
+
+// WithIssuer sets the iss claim of issued tokens and requires it on validated ones
+func WithIssuer(issuer string) JWTOption {
+	return func(j *JWTManager) {
+		j.issuer = issuer
+	}
+}
+
+// WithAudience sets the aud claim of issued tokens, validated tokens must name at least one of the audiences
+func WithAudience(audience ...string) JWTOption {
+	return func(j *JWTManager) {
+		j.audience = audience
+	}
+}
+
+// WithLeeway overrides the clock skew tolerated when validating exp, iat and nbf, 30s by default
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(j *JWTManager) {
+		j.leeway = leeway
+	}
+}
+
+// WithSigningKeys replaces the secret with keys, e.g. to rotate secrets without downtime
+func WithSigningKeys(keys SigningKeys) JWTOption {
+	return func(j *JWTManager) {
+		j.keys = keys
+	}
+}
+
+// NewJWTManager creates a new JWT manager signing tokens with secret
+func NewJWTManager(secret string, accessTokenExpiry, refreshTokenExpiry time.Duration, opts ...JWTOption) *JWTManager {
+	j := &JWTManager{
+		keys:               StaticSigningKeys(NewSigningKey(secret)),
 		accessTokenExpiry:  accessTokenExpiry,
 		refreshTokenExpiry: refreshTokenExpiry,
+		leeway:             defaultLeeway,
+	}
+	for _, opt := range opts {
+		opt(j)
 	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}),
+		jwt.WithLeeway(j.leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if j.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(j.issuer))
+	}
+	if len(j.audience) > 0 {
+		parserOpts = append(parserOpts, jwt.WithAudience(j.audience...))
+	}
+	j.parserOpts = parserOpts
+	j.parser = jwt.NewParser(parserOpts...)
+
+	return j
+}
+
+// registeredClaims adds the standard sub, nbf, iss and aud claims
+func (j *JWTManager) registeredClaims(claims jwt.MapClaims, userID string) jwt.MapClaims {
+	claims["sub"] = userID
+	claims["nbf"] = claims["iat"]
+	if j.issuer != "" {
+		claims["iss"] = j.issuer
+	}
+	if len(j.audience) > 0 {
+		claims["aud"] = jwt.ClaimStrings(j.audience)
+	}
+	return claims
+}
+
+// sign signs claims with the current key and names it in the kid header
+func (j *JWTManager) sign(claims jwt.MapClaims) (string, error) {
+	key := j.keys.Current()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.Secret)
+}
+
+// verificationKey returns the key a token names in its kid header, or all keys for tokens
+// without one, e.g. issued before keys had IDs
+func (j *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	keys := j.keys.Verification()
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		set := jwt.VerificationKeySet{Keys: make([]jwt.VerificationKey, 0, len(keys))}
+		for _, key := range keys {
+			set.Keys = append(set.Keys, key.Secret)
+		}
+		return set, nil
+	}
+
+	for _, key := range keys {
+		if key.ID == kid {
+			return key.Secret, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// parse verifies the signature and the registered claims of a token
+func (j *JWTManager) parse(tokenString string) (jwt.MapClaims, error) {
+	return j.parseWith(j.parser, tokenString)
+}
+
+func (j *JWTManager) parseWith(parser *jwt.Parser, tokenString string) (jwt.MapClaims, error) {
+	token, err := parser.Parse(tokenString, j.verificationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	return claims, nil
 }
 
 // GenerateAccessToken generates a new access token
 func (j *JWTManager) GenerateAccessToken(userID, email string) (string, error) {
+	return j.GenerateOrgAccessToken(userID, email, nil)
+}
+
+// GenerateOrgAccessToken generates a new access token scoped to an organization
+// The org_id and org_role claims are left out when membership is nil, features are set
+// as the features claim when given.
+func (j *JWTManager) GenerateOrgAccessToken(userID, email string, membership *domain.Membership, features ...string) (string, error) {
 	claims := &domain.TokenClaims{
-		UserID: userID,
-		Email:  email,
-		Exp:    time.Now().Add(j.accessTokenExpiry).Unix(),
-		Iat:    time.Now().Unix(),
+		UserID:   userID,
+		Email:    email,
+		Features: features,
+	}
+	if membership != nil {
+		claims.OrgID = membership.OrgID
+		claims.OrgRole = membership.Role
 	}
+	return j.GenerateAccessTokenWithClaims(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// GenerateAccessTokenWithClaims generates a new access token with the claims, Exp and Iat are set
+// from the access token expiry and optional claims are left out when empty
+func (j *JWTManager) GenerateAccessTokenWithClaims(claims *domain.TokenClaims) (string, error) {
+	now := time.Now()
+	claims.Exp = now.Add(j.accessTokenExpiry).Unix()
+	claims.Iat = now.Unix()
+
+	mapClaims := j.registeredClaims(jwt.MapClaims{
 		"user_id": claims.UserID,
 		"email":   claims.Email,
 		"exp":     claims.Exp,
 		"iat":     claims.Iat,
-	})
+	}, claims.UserID)
+	if claims.OrgID != "" {
+		mapClaims["org_id"] = claims.OrgID
+		mapClaims["org_role"] = claims.OrgRole
+	}
+	if len(claims.Features) > 0 {
+		mapClaims["features"] = claims.Features
+	}
+	if claims.Restricted {
+		mapClaims["restricted"] = true
+	}
 
-	tokenString, err := token.SignedString(j.secret)
+	tokenString, err := j.sign(mapClaims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -51,16 +250,15 @@ func (j *JWTManager) GenerateAccessToken(userID, email string) (string, error) {
 
 // GenerateRefreshToken generates a new refresh token
 func (j *JWTManager) GenerateRefreshToken(userID string) (string, error) {
-	claims := jwt.MapClaims{
+	claims := j.registeredClaims(jwt.MapClaims{
 		"user_id": userID,
 		"exp":     time.Now().Add(j.refreshTokenExpiry).Unix(),
 		"iat":     time.Now().Unix(),
 		"type":    "refresh",
 		"jti":     uuid.New().String(),
-	}
+	}, userID)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(j.secret)
+	tokenString, err := j.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign refresh token: %w", err)
 	}
@@ -70,26 +268,30 @@ func (j *JWTManager) GenerateRefreshToken(userID string) (string, error) {
 
 // ValidateToken validates a JWT token and returns claims
 func (j *JWTManager) ValidateToken(tokenString string) (*domain.TokenClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return j.secret, nil
-	})
-
+	claims, err := j.parse(tokenString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, err
 	}
+	return accessTokenClaims(claims)
+}
 
-	if !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+// ValidateTokenWithGrace validates a token like ValidateToken, but also accepts tokens expired
+// for less than grace
+func (j *JWTManager) ValidateTokenWithGrace(tokenString string, grace time.Duration) (*domain.TokenClaims, error) {
+	claims, err := j.parse(tokenString)
+	if errors.Is(err, jwt.ErrTokenExpired) && grace > 0 {
+		// Only expired tokens are parsed again, the larger leeway doesn't relax nbf and iat of others
+		parser := jwt.NewParser(append(slices.Clone(j.parserOpts), jwt.WithLeeway(j.leeway+grace))...)
+		claims, err = j.parseWith(parser, tokenString)
 	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, fmt.Errorf("invalid token claims")
+	if err != nil {
+		return nil, err
 	}
+	return accessTokenClaims(claims)
+}
 
+// accessTokenClaims extracts the claims of an access token
+func accessTokenClaims(claims jwt.MapClaims) (*domain.TokenClaims, error) {
 	userID, ok := claims["user_id"].(string)
 	if !ok {
 		return nil, fmt.Errorf("invalid user_id in token")
@@ -110,20 +312,40 @@ func (j *JWTManager) ValidateToken(tokenString string) (*domain.TokenClaims, err
 		return nil, fmt.Errorf("invalid iat in token")
 	}
 
-	tokenClaims := &domain.TokenClaims{
-		UserID: userID,
-		Email:  email,
-		Exp:    int64(exp),
-		Iat:    int64(iat),
-	}
+	// Organization claims are optional, tokens aren't always scoped to one
+	orgID, _ := claims["org_id"].(string)
+	orgRole, _ := claims["org_role"].(string)
+	restricted, _ := claims["restricted"].(bool)
 
-	if tokenClaims.IsExpired() {
-		return nil, fmt.Errorf("token is expired")
+	tokenClaims := &domain.TokenClaims{
+		UserID:     userID,
+		Email:      email,
+		Exp:        int64(exp),
+		Iat:        int64(iat),
+		OrgID:      orgID,
+		OrgRole:    orgRole,
+		Features:   stringClaims(claims["features"]),
+		Restricted: restricted,
 	}
 
 	return tokenClaims, nil
 }
 
+// stringClaims returns the strings of an array claim, nil if it isn't one
+func stringClaims(value any) []string {
+	values, ok := value.([]any)
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
 // GetAccessTokenExpiry returns the access token expiry duration in seconds
 func (j *JWTManager) GetAccessTokenExpiry() int {
 	return int(j.accessTokenExpiry.Seconds())
@@ -131,24 +353,9 @@ func (j *JWTManager) GetAccessTokenExpiry() int {
 
 // ValidateRefreshToken validates a refresh token and returns user ID
 func (j *JWTManager) ValidateRefreshToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return j.secret, nil
-	})
-
+	claims, err := j.parse(tokenString)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse token: %w", err)
-	}
-
-	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return "", fmt.Errorf("invalid token claims")
+		return "", err
 	}
 
 	// Check token type
@@ -161,15 +368,5 @@ func (j *JWTManager) ValidateRefreshToken(tokenString string) (string, error) {
 		return "", fmt.Errorf("invalid user_id in token")
 	}
 
-	// Check expiration
-	exp, ok := claims["exp"].(float64)
-	if !ok {
-		return "", fmt.Errorf("invalid exp in token")
-	}
-
-	if time.Now().Unix() > int64(exp) {
-		return "", fmt.Errorf("token is expired")
-	}
-
 	return userID, nil
 }
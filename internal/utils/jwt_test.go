@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+)
+
+const testSecret = "test-secret-key-that-is-at-least-32-characters-long"
+
+func TestJWTManagerValidateToken(t *testing.T) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+
+	token, err := manager.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Email != "user@example.com" {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+
+	other := NewJWTManager(strings.Repeat("x", 32), 15*time.Minute, time.Hour)
+	if _, err := other.ValidateToken(token); err == nil {
+		t.Error("Expected a token signed with another secret to be rejected")
+	}
+
+	expired := NewJWTManager(testSecret, -time.Minute, time.Hour)
+	token, err = expired.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+	if _, err := manager.ValidateToken(token); err == nil {
+		t.Error("Expected an expired token to be rejected")
+	}
+}
+
+func TestJWTManagerOrgClaims(t *testing.T) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+
+	token, err := manager.GenerateOrgAccessToken("user-1", "user@example.com", &domain.Membership{OrgID: "org-1", Role: domain.OrgRoleAdmin})
+	if err != nil {
+		t.Fatalf("GenerateOrgAccessToken failed: %v", err)
+	}
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	if claims.OrgID != "org-1" || claims.OrgRole != domain.OrgRoleAdmin {
+		t.Errorf("Expected the organization claims, got %+v", claims)
+	}
+
+	token, _ = manager.GenerateAccessToken("user-1", "user@example.com")
+	if claims, _ := manager.ValidateToken(token); claims.OrgID != "" || claims.OrgRole != "" || claims.Restricted {
+		t.Errorf("Expected no organization claims, got %+v", claims)
+	}
+}
+
+func TestJWTManagerRestrictedClaim(t *testing.T) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+
+	token, err := manager.GenerateAccessTokenWithClaims(&domain.TokenClaims{UserID: "user-1", Email: "user@example.com", Restricted: true})
+	if err != nil {
+		t.Fatalf("GenerateAccessTokenWithClaims failed: %v", err)
+	}
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	if !claims.Restricted || claims.Exp-claims.Iat != int64((15*time.Minute).Seconds()) {
+		t.Errorf("Expected a restricted token valid for 15m, got %+v", claims)
+	}
+}
+
+func TestJWTManagerIssuerAudience(t *testing.T) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithIssuer("https://auth.example.com"), WithAudience("api", "admin"))
+
+	token, err := manager.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+	if _, err := manager.ValidateToken(token); err != nil {
+		t.Errorf("ValidateToken failed: %v", err)
+	}
+	refresh, err := manager.GenerateRefreshToken("user-1")
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+	if userID, err := manager.ValidateRefreshToken(refresh); err != nil || userID != "user-1" {
+		t.Errorf("ValidateRefreshToken returned %q, %v", userID, err)
+	}
+
+	// An instance sharing the secret but serving another audience
+	api := NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithIssuer("https://auth.example.com"), WithAudience("api"))
+	if _, err := api.ValidateToken(token); err != nil {
+		t.Errorf("Expected a token naming one of the audiences to be accepted, got %v", err)
+	}
+
+	for name, other := range map[string]*JWTManager{
+		"without issuer":   NewJWTManager(testSecret, 15*time.Minute, time.Hour),
+		"other issuer":     NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithIssuer("https://auth.staging.example.com"), WithAudience("api")),
+		"other audience":   NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithIssuer("https://auth.example.com"), WithAudience("billing")),
+		"without audience": NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithIssuer("https://auth.example.com")),
+	} {
+		token, _ := other.GenerateAccessToken("user-1", "user@example.com")
+		if _, err := manager.ValidateToken(token); err == nil {
+			t.Errorf("Expected a token issued %s to be rejected", name)
+		}
+		refresh, _ := other.GenerateRefreshToken("user-1")
+		if _, err := manager.ValidateRefreshToken(refresh); err == nil {
+			t.Errorf("Expected a refresh token issued %s to be rejected", name)
+		}
+	}
+}
+
+func TestJWTManagerLeeway(t *testing.T) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+	strict := NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithLeeway(0))
+
+	token, err := manager.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse token: %v", err)
+	}
+	if nbf, _ := parsed.Claims.GetNotBefore(); nbf == nil || time.Since(nbf.Time) > time.Minute {
+		t.Errorf("Expected an nbf claim of now, got %v", nbf)
+	}
+
+	// Expired a moment ago
+	expired := NewJWTManager(testSecret, -10*time.Second, time.Hour)
+	token, _ = expired.GenerateAccessToken("user-1", "user@example.com")
+	if _, err := manager.ValidateToken(token); err != nil {
+		t.Errorf("Expected a token expired within the leeway to be accepted, got %v", err)
+	}
+	if _, err := strict.ValidateToken(token); err == nil {
+		t.Error("Expected an expired token to be rejected without leeway")
+	}
+
+	// Issued by a client or instance whose clock is ahead
+	ahead, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user-1",
+		"email":   "user@example.com",
+		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+		"iat":     time.Now().Add(10 * time.Second).Unix(),
+		"nbf":     time.Now().Add(10 * time.Second).Unix(),
+	}).SignedString([]byte(testSecret))
+	if _, err := manager.ValidateToken(ahead); err != nil {
+		t.Errorf("Expected a token not yet valid within the leeway to be accepted, got %v", err)
+	}
+	if _, err := strict.ValidateToken(ahead); err == nil {
+		t.Error("Expected a token not yet valid to be rejected without leeway")
+	}
+}
+
+func TestJWTManagerValidateTokenWithGrace(t *testing.T) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour, WithLeeway(0))
+
+	expired := NewJWTManager(testSecret, -20*time.Second, time.Hour)
+	token, _ := expired.GenerateAccessToken("user-1", "user@example.com")
+	if _, err := manager.ValidateToken(token); err == nil {
+		t.Fatal("Expected an expired token to be rejected")
+	}
+	claims, err := manager.ValidateTokenWithGrace(token, 30*time.Second)
+	if err != nil || claims.UserID != "user-1" {
+		t.Errorf("Expected a token expired within the grace period to be accepted, got %v", err)
+	}
+	if _, err := manager.ValidateTokenWithGrace(token, 10*time.Second); err == nil {
+		t.Error("Expected a token expired before the grace period to be rejected")
+	}
+
+	forged, _ := NewJWTManager(strings.Repeat("x", 32), -time.Second, time.Hour).GenerateAccessToken("user-1", "user@example.com")
+	if _, err := manager.ValidateTokenWithGrace(forged, time.Minute); err == nil {
+		t.Error("Expected a token with an invalid signature to be rejected")
+	}
+}
+
+// BenchmarkValidateToken measures the access token check done by every authenticated request
+func BenchmarkValidateToken(b *testing.B) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+	token, err := manager.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := manager.ValidateToken(token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateAccessToken(b *testing.B) {
+	manager := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := manager.GenerateAccessToken("user-1", "user@example.com"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestJWTManagerSigningKeyRotation(t *testing.T) {
+	previous := NewSigningKey(testSecret)
+	current := NewSigningKey(strings.Repeat("n", 32))
+
+	before := NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+	oldToken, err := before.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+
+	rotated := NewJWTManager("", 15*time.Minute, time.Hour, WithSigningKeys(StaticSigningKeys(current, previous)))
+	if _, err := rotated.ValidateToken(oldToken); err != nil {
+		t.Errorf("Expected a token of the previous secret to stay valid, got %v", err)
+	}
+
+	newToken, err := rotated.GenerateAccessToken("user-1", "user@example.com")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	if err != nil || parsed.Header["kid"] != current.ID {
+		t.Fatalf("Expected new tokens to name the current key, got %v (%v)", parsed.Header["kid"], err)
+	}
+	if _, err := before.ValidateToken(newToken); err == nil {
+		t.Error("Expected a token of the current secret to be rejected without it")
+	}
+
+	// Tokens without a kid header are tried against every key
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "user-1",
+		"email":   "user@example.com",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+		"iat":     time.Now().Unix(),
+	})
+	legacyToken, err := legacy.SignedString(previous.Secret)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	if _, err := rotated.ValidateToken(legacyToken); err != nil {
+		t.Errorf("Expected a token without kid to be validated with the previous key, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// ErrMalformedHash is returned when a hash has a known prefix but can't be parsed
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// HashVerifier checks passwords against hashes of one format, identified by a prefix
+type HashVerifier struct {
+	// Prefix identifies hashes of the format, e.g. "$1$" or "pbkdf2_sha256$"
+	Prefix string
+	Verify func(password, hash string) (bool, error)
+}
+
+// HashVerifierChain verifies hashes with the first verifier whose prefix matches
+type HashVerifierChain struct {
+	verifiers []HashVerifier
+}
+
+// NewHashVerifierChain creates a chain trying the verifiers in order
+func NewHashVerifierChain(verifiers ...HashVerifier) *HashVerifierChain {
+	return &HashVerifierChain{verifiers: verifiers}
+}
+
+// Supports reports whether a verifier of the chain handles hash
+func (c *HashVerifierChain) Supports(hash string) bool {
+	_, ok := c.verifier(hash)
+	return ok
+}
+
+// Verify compares a password with a hash, hashes of unknown formats never match
+func (c *HashVerifierChain) Verify(password, hash string) (bool, error) {
+	verifier, ok := c.verifier(hash)
+	if !ok {
+		return false, nil
+	}
+	return verifier.Verify(password, hash)
+}
+
+func (c *HashVerifierChain) verifier(hash string) (HashVerifier, bool) {
+	for _, verifier := range c.verifiers {
+		if strings.HasPrefix(hash, verifier.Prefix) {
+			return verifier, true
+		}
+	}
+	return HashVerifier{}, false
+}
+
+// IsBcryptHash reports whether hash is a bcrypt hash
+func IsBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// LegacyHashVerifiers returns the verifiers of hash formats of other systems, so that imported
+// users keep their passwords:
+//
+//   - $1$salt$hash - MD5-crypt
+//   - $argon2id$v=19$m=65536,t=3,p=4$salt$hash - Argon2id (PHC string)
+//   - pbkdf2_sha256$iterations$salt$hash, pbkdf2_sha1$... - Django PBKDF2
+//   - sha1$salt$hex, md5$salt$hex - Django salted SHA1 and MD5, unsalted hashes have an empty salt
+//   - {SHA}base64, {SSHA}base64 - LDAP SHA1 and salted SHA1
+func LegacyHashVerifiers() []HashVerifier {
+	return []HashVerifier{
+		{Prefix: "$1$", Verify: verifyMD5Crypt},
+		{Prefix: "$argon2id$", Verify: verifyArgon2id},
+		{Prefix: "pbkdf2_sha256$", Verify: verifyDjangoPBKDF2(sha256.New)},
+		{Prefix: "pbkdf2_sha1$", Verify: verifyDjangoPBKDF2(sha1.New)},
+		{Prefix: "sha1$", Verify: verifyDjangoSalted(sha1.New)},
+		{Prefix: "md5$", Verify: verifyDjangoSalted(md5.New)},
+		{Prefix: "{SHA}", Verify: verifyLDAPSHA},
+		{Prefix: "{SSHA}", Verify: verifyLDAPSSHA},
+	}
+}
+
+// verifyDjangoPBKDF2 verifies algorithm$iterations$salt$base64
+func verifyDjangoPBKDF2(newHash func() hash.Hash) func(password, encoded string) (bool, error) {
+	return func(password, encoded string) (bool, error) {
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 4 {
+			return false, ErrMalformedHash
+		}
+		iterations, err := strconv.Atoi(parts[1])
+		if err != nil || iterations <= 0 {
+			return false, ErrMalformedHash
+		}
+		expected, err := base64.StdEncoding.DecodeString(parts[3])
+		if err != nil || len(expected) == 0 {
+			return false, ErrMalformedHash
+		}
+
+		key, err := pbkdf2.Key(newHash, password, []byte(parts[2]), iterations, len(expected))
+		if err != nil {
+			return false, fmt.Errorf("failed to derive key: %w", err)
+		}
+		return subtle.ConstantTimeCompare(key, expected) == 1, nil
+	}
+}
+
+// verifyDjangoSalted verifies algorithm$salt$hex(hash(salt + password))
+func verifyDjangoSalted(newHash func() hash.Hash) func(password, encoded string) (bool, error) {
+	return func(password, encoded string) (bool, error) {
+		parts := strings.Split(encoded, "$")
+		if len(parts) != 3 {
+			return false, ErrMalformedHash
+		}
+		expected, err := hex.DecodeString(parts[2])
+		if err != nil {
+			return false, ErrMalformedHash
+		}
+
+		h := newHash()
+		h.Write([]byte(parts[1] + password))
+		return subtle.ConstantTimeCompare(h.Sum(nil), expected) == 1, nil
+	}
+}
+
+// verifyLDAPSHA verifies {SHA}base64(sha1(password))
+func verifyLDAPSHA(password, encoded string) (bool, error) {
+	expected, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, "{SHA}"))
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	sum := sha1.Sum([]byte(password))
+	return subtle.ConstantTimeCompare(sum[:], expected) == 1, nil
+}
+
+// verifyLDAPSSHA verifies {SSHA}base64(sha1(password + salt) + salt)
+func verifyLDAPSSHA(password, encoded string) (bool, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, "{SSHA}"))
+	if err != nil || len(decoded) <= sha1.Size {
+		return false, ErrMalformedHash
+	}
+	expected, salt := decoded[:sha1.Size], decoded[sha1.Size:]
+	sum := sha1.Sum(append([]byte(password), salt...))
+	return subtle.ConstantTimeCompare(sum[:], expected) == 1, nil
+}
+
+// verifyArgon2id verifies $argon2id$v=19$m=memory,t=time,p=threads$salt$hash
+func verifyArgon2id(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return false, ErrMalformedHash
+	}
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || threads == 0 {
+		return false, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrMalformedHash
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) == 0 {
+		return false, ErrMalformedHash
+	}
+
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+// md5CryptAlphabet is the base64 alphabet of crypt(3)
+const md5CryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// verifyMD5Crypt verifies $1$salt$hash, the FreeBSD MD5-based crypt(3)
+func verifyMD5Crypt(password, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 {
+		return false, ErrMalformedHash
+	}
+	salt := parts[2]
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	expected := "$1$" + salt + "$" + md5Crypt([]byte(password), []byte(salt))
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(encoded)) == 1, nil
+}
+
+// md5Crypt returns the encoded MD5-crypt digest of a password
+func md5Crypt(password, salt []byte) string {
+	alternate := md5.New()
+	alternate.Write(password)
+	alternate.Write(salt)
+	alternate.Write(password)
+	alternateSum := alternate.Sum(nil)
+
+	h := md5.New()
+	h.Write(password)
+	h.Write([]byte("$1$"))
+	h.Write(salt)
+	for i := len(password); i > 0; i -= md5.Size {
+		h.Write(alternateSum[:min(i, md5.Size)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(password[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	// Rounds slowing down brute force
+	for i := range 1000 {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(password)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write(salt)
+		}
+		if i%7 != 0 {
+			round.Write(password)
+		}
+		if i&1 != 0 {
+			round.Write(sum)
+		} else {
+			round.Write(password)
+		}
+		sum = round.Sum(nil)
+	}
+
+	var out strings.Builder
+	encode := func(v uint32, n int) {
+		for range n {
+			out.WriteByte(md5CryptAlphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(sum[group[0]])<<16|uint32(sum[group[1]])<<8|uint32(sum[group[2]]), 4)
+	}
+	encode(uint32(sum[11]), 2)
+	return out.String()
+}
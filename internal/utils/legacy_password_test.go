@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestLegacyHashVerifiers(t *testing.T) {
+	salt := []byte("somesalt")
+	argon2Hash := "$argon2id$v=19$m=1024,t=1,p=1$" + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("Password123"), salt, 1, 1024, 1, 32))
+
+	chain := NewHashVerifierChain(LegacyHashVerifiers()...)
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"md5-crypt", "$1$saltsalt$LQjc41g.x5TIs3YZr.UWF/"},
+		{"argon2id", argon2Hash},
+		{"django pbkdf2_sha256", "pbkdf2_sha256$1000$seasalt$4i48HIIUBSIPnunWTQsj29h9Ke2FGCmHqiMk92VIkQw="},
+		{"django pbkdf2_sha1", "pbkdf2_sha1$1000$seasalt$oWi0nU/QresGuH3mX0nxUZPBmh8="},
+		{"django sha1", "sha1$salt$cae9de2fca39be21cde04d66456c208e5938b415"},
+		{"ldap sha", "{SHA}sumK1vbrhQjdahTPpwS61/Bfb7E="},
+		{"ldap ssha", "{SSHA}ME3B82D3RNlUwxig1drqjoAziilzYWx0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !chain.Supports(tt.hash) {
+				t.Fatalf("Expected %s to be supported", tt.hash)
+			}
+			if ok, err := chain.Verify("Password123", tt.hash); err != nil || !ok {
+				t.Errorf("Expected the password to match, got %v, %v", ok, err)
+			}
+			if ok, err := chain.Verify("Password124", tt.hash); err != nil || ok {
+				t.Errorf("Expected a different password not to match, got %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestHashVerifierChainUnknownAndMalformed(t *testing.T) {
+	chain := NewHashVerifierChain(LegacyHashVerifiers()...)
+
+	if chain.Supports("$2a$10$abcdefghijklmnopqrstuu") || chain.Supports("5f4dcc3b5aa765d61d8327deb882cf99") {
+		t.Error("Expected bcrypt and unprefixed hashes not to be supported")
+	}
+	if ok, err := chain.Verify("Password123", "plain"); ok || err != nil {
+		t.Errorf("Expected unknown formats not to match, got %v, %v", ok, err)
+	}
+	if _, err := chain.Verify("Password123", "pbkdf2_sha256$many$salt$hash"); !errors.Is(err, ErrMalformedHash) {
+		t.Errorf("Expected ErrMalformedHash, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("Password123", bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+
+	if !CheckPasswordHash("Password123", hash) {
+		t.Error("Expected the password to match its hash")
+	}
+	if CheckPasswordHash("Password124", hash) {
+		t.Error("Expected a different password not to match")
+	}
+
+	if _, err := HashPassword("Password123", bcrypt.MaxCost+1); err == nil {
+		t.Error("Expected an error for an invalid cost")
+	}
+}
+
+// BenchmarkHashPassword shows the cost of registration and password changes per BCRYPT_COST
+// Every step doubles the time, login takes as long via CheckPasswordHash
+func BenchmarkHashPassword(b *testing.B) {
+	for _, cost := range []int{4, 8, 10, 12, 14} {
+		b.Run(fmt.Sprintf("cost=%d", cost), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := HashPassword("Password123", cost); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCheckPasswordHash(b *testing.B) {
+	hash, err := HashPassword("Password123", bcrypt.DefaultCost)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for b.Loop() {
+		if !CheckPasswordHash("Password123", hash) {
+			b.Fatal("password does not match")
+		}
+	}
+}
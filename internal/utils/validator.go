@@ -7,18 +7,34 @@ import (
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 
+// usernameRegex allows 3-32 lowercase letters, digits, dots, underscores and hyphens,
+// starting with a letter or digit. Usernames never contain "@", so they cannot be confused with emails
+var usernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9._\-]{2,31}$`)
+
 // ValidateEmail validates an email address
 func ValidateEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
+// MinPasswordLength is the minimum length of a password
+const MinPasswordLength = 8
+
+// Password policy rules, as returned by PasswordPolicyViolations
+const (
+	PasswordRuleMinLength = "min_length"
+	PasswordRuleUppercase = "uppercase"
+	PasswordRuleLowercase = "lowercase"
+	PasswordRuleNumber    = "number"
+)
+
 // ValidatePassword validates a password
 // Minimum 8 characters, at least one uppercase letter, one lowercase letter, one number
 func ValidatePassword(password string) bool {
-	if len(password) < 8 {
-		return false
-	}
+	return len(PasswordPolicyViolations(password)) == 0
+}
 
+// PasswordPolicyViolations returns the password policy rules a password breaks, none if it is valid
+func PasswordPolicyViolations(password string) []string {
 	hasUpper := false
 	hasLower := false
 	hasNumber := false
@@ -34,10 +50,38 @@ func ValidatePassword(password string) bool {
 		}
 	}
 
-	return hasUpper && hasLower && hasNumber
+	var violations []string
+	if len(password) < MinPasswordLength {
+		violations = append(violations, PasswordRuleMinLength)
+	}
+	if !hasUpper {
+		violations = append(violations, PasswordRuleUppercase)
+	}
+	if !hasLower {
+		violations = append(violations, PasswordRuleLowercase)
+	}
+	if !hasNumber {
+		violations = append(violations, PasswordRuleNumber)
+	}
+	return violations
 }
 
 // SanitizeEmail sanitizes an email address
 func SanitizeEmail(email string) string {
 	return strings.ToLower(strings.TrimSpace(email))
 }
+
+// ValidateUsername validates a sanitized username
+func ValidateUsername(username string) bool {
+	return usernameRegex.MatchString(username)
+}
+
+// SanitizeUsername sanitizes a username
+func SanitizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// IsEmailIdentifier reports whether a login identifier is an email rather than a username
+func IsEmailIdentifier(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPasswordPolicyViolations(t *testing.T) {
+	tests := []struct {
+		password string
+		expected []string
+	}{
+		{"Password123", nil},
+		{"short", []string{PasswordRuleMinLength, PasswordRuleUppercase, PasswordRuleNumber}},
+		{"password123", []string{PasswordRuleUppercase}},
+		{"PASSWORD123", []string{PasswordRuleLowercase}},
+		{"Passwordxyz", []string{PasswordRuleNumber}},
+		{"", []string{PasswordRuleMinLength, PasswordRuleUppercase, PasswordRuleLowercase, PasswordRuleNumber}},
+	}
+
+	for _, tt := range tests {
+		if got := PasswordPolicyViolations(tt.password); !slices.Equal(got, tt.expected) {
+			t.Errorf("PasswordPolicyViolations(%q) = %v, expected %v", tt.password, got, tt.expected)
+		}
+		if got := ValidatePassword(tt.password); got != (len(tt.expected) == 0) {
+			t.Errorf("ValidatePassword(%q) = %v", tt.password, got)
+		}
+	}
+}
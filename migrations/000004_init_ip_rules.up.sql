@@ -0,0 +1,8 @@
+-- Create ip_rules table
+CREATE TABLE IF NOT EXISTS ip_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cidr CIDR UNIQUE NOT NULL,
+    action VARCHAR(10) NOT NULL CHECK (action IN ('allow', 'deny')),
+    comment VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
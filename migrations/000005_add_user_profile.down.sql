@@ -0,0 +1,7 @@
+-- Drop profile columns
+ALTER TABLE users
+    DROP COLUMN IF EXISTS first_name,
+    DROP COLUMN IF EXISTS last_name,
+    DROP COLUMN IF EXISTS display_name,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS locale;
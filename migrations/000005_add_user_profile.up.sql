@@ -0,0 +1,7 @@
+-- Add profile columns to users table
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS first_name VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS last_name VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS display_name VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(2048),
+    ADD COLUMN IF NOT EXISTS locale VARCHAR(35);
@@ -0,0 +1,3 @@
+-- Drop username
+DROP INDEX IF EXISTS idx_users_username;
+ALTER TABLE users DROP COLUMN IF EXISTS username;
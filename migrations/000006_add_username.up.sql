@@ -0,0 +1,5 @@
+-- Add optional unique username to users table
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username VARCHAR(32);
+
+-- Usernames are stored lowercased, so a plain unique index is case-insensitive
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users(username);
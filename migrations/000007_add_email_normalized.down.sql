@@ -0,0 +1,3 @@
+-- Drop normalized email
+DROP INDEX IF EXISTS idx_users_email_normalized;
+ALTER TABLE users DROP COLUMN IF EXISTS email_normalized;
@@ -0,0 +1,10 @@
+-- Add normalized email used for uniqueness checks and lookups
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_normalized VARCHAR(255);
+
+-- Existing users are backfilled with the lowercased address; the service re-normalizes
+-- them with the configured EMAIL_NORMALIZE_* policy on startup
+UPDATE users SET email_normalized = LOWER(TRIM(email)) WHERE email_normalized IS NULL;
+
+ALTER TABLE users ALTER COLUMN email_normalized SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_normalized ON users(email_normalized);
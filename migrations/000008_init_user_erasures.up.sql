@@ -0,0 +1,15 @@
+-- Create user_erasures table
+-- Erasures are compliance evidence and outlive the users they refer to, so user_id has no foreign key
+CREATE TABLE IF NOT EXISTS user_erasures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID UNIQUE NOT NULL,
+    email_hash VARCHAR(64) NOT NULL,
+    requested_by VARCHAR(10) NOT NULL CHECK (requested_by IN ('user', 'admin')),
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('delete', 'anonymize')),
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    erase_after TIMESTAMP NOT NULL,
+    erased_at TIMESTAMP
+);
+
+-- Pending erasures are looked up by due time
+CREATE INDEX IF NOT EXISTS idx_user_erasures_pending ON user_erasures(erase_after) WHERE erased_at IS NULL;
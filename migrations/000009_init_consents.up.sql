@@ -0,0 +1,13 @@
+-- Create consents table
+CREATE TABLE IF NOT EXISTS consents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document VARCHAR(20) NOT NULL CHECK (document IN ('terms', 'privacy')),
+    version VARCHAR(50) NOT NULL,
+    accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ip_address VARCHAR(45),
+    UNIQUE(user_id, document, version)
+);
+
+-- Create index on user_id for consent lookups
+CREATE INDEX IF NOT EXISTS idx_consents_user_id ON consents(user_id);
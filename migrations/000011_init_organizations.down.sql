@@ -0,0 +1,3 @@
+-- Drop tables
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,9 @@
+-- Group refresh tokens rotated from one login into a session
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id UUID;
+
+-- Existing tokens start their own session
+UPDATE refresh_tokens SET session_id = id WHERE session_id IS NULL;
+
+ALTER TABLE refresh_tokens ALTER COLUMN session_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
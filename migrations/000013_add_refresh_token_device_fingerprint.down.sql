@@ -0,0 +1,2 @@
+-- Drop device fingerprints
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS device_fingerprint;
@@ -0,0 +1,2 @@
+-- Hash of the device a refresh token was issued to, for device binding
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS device_fingerprint VARCHAR(64);
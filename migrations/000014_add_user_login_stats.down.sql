@@ -0,0 +1,5 @@
+-- Drop login statistics
+ALTER TABLE users DROP COLUMN IF EXISTS previous_login_ip;
+ALTER TABLE users DROP COLUMN IF EXISTS previous_login_at;
+ALTER TABLE users DROP COLUMN IF EXISTS last_login_ip;
+ALTER TABLE users DROP COLUMN IF EXISTS login_count;
@@ -0,0 +1,7 @@
+-- Login statistics shown to users, e.g. "last login from X at Y"
+-- previous_login_* keep the login before the last one, so that the current session
+-- can show where the account was used before
+ALTER TABLE users ADD COLUMN IF NOT EXISTS login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_login_ip VARCHAR(45);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS previous_login_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS previous_login_ip VARCHAR(45);
@@ -0,0 +1,6 @@
+-- Revoked tokens would become valid again without the columns
+DELETE FROM refresh_tokens WHERE revoked_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_revoked_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS revoke_reason;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS revoked_at;
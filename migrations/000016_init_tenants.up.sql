@@ -0,0 +1,15 @@
+-- Create tenants table
+-- Tenants are the frontends of a multi-tenant deployment, identified by the tenant of invitations
+-- and the X-Tenant-ID header. Redirect URLs bound where links in emails may send users back to.
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    email_from VARCHAR(255),
+    brand_name VARCHAR(100),
+    logo_url VARCHAR(2048),
+    brand_color VARCHAR(7),
+    redirect_urls TEXT[] NOT NULL DEFAULT '{}',
+    cookie_domain VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
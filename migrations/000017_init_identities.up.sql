@@ -0,0 +1,12 @@
+-- Create identities table, credentials users sign in with besides email and password
+CREATE TABLE IF NOT EXISTS identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(type, subject)
+);
+
+-- Create index on user_id for identity lookups
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities(user_id);
@@ -0,0 +1,4 @@
+-- Drop tokens of upstream provider accounts
+ALTER TABLE oauth_providers DROP COLUMN IF EXISTS token_expires_at;
+ALTER TABLE oauth_providers DROP COLUMN IF EXISTS refresh_token;
+ALTER TABLE oauth_providers DROP COLUMN IF EXISTS access_token;
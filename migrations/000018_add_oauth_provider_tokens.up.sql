@@ -0,0 +1,5 @@
+-- Tokens of upstream provider accounts, for first-party apps calling provider APIs on behalf of users
+-- Tokens are encrypted by the service (enc:v1:<key ID>:...), see ENCRYPTION_KEYS
+ALTER TABLE oauth_providers ADD COLUMN IF NOT EXISTS access_token TEXT;
+ALTER TABLE oauth_providers ADD COLUMN IF NOT EXISTS refresh_token TEXT;
+ALTER TABLE oauth_providers ADD COLUMN IF NOT EXISTS token_expires_at TIMESTAMP;
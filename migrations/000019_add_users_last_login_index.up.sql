@@ -0,0 +1,2 @@
+-- Count active users for the admin statistics without scanning all users
+CREATE INDEX IF NOT EXISTS idx_users_last_login_at ON users(last_login_at);
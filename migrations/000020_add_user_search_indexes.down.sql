@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_oauth_providers_provider_user_id;
+DROP INDEX IF EXISTS idx_users_email_trgm;
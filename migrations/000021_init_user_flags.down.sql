@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_user_flags_flags;
+DROP TABLE IF EXISTS user_flags;
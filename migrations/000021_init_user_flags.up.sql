@@ -0,0 +1,11 @@
+-- Notes and flags support keeps on users, e.g. chargeback or abuse-suspect; never shown to users
+CREATE TABLE IF NOT EXISTS user_flags (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    notes TEXT NOT NULL DEFAULT '',
+    flags TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_by VARCHAR(255) NOT NULL
+);
+
+-- Filter users by flag
+CREATE INDEX IF NOT EXISTS idx_user_flags_flags ON user_flags USING gin (flags);
@@ -0,0 +1,6 @@
+-- Restriction level of abusive accounts: limited users get restricted tokens and lower rate limits,
+-- banned users can't log in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS restriction VARCHAR(16) NOT NULL DEFAULT 'none'
+    CHECK (restriction IN ('none', 'limited', 'banned'));
+
+CREATE INDEX IF NOT EXISTS idx_users_restriction ON users(restriction) WHERE restriction <> 'none';
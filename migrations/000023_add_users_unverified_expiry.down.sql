@@ -0,0 +1,7 @@
+ALTER TABLE user_erasures DROP CONSTRAINT IF EXISTS user_erasures_requested_by_check;
+UPDATE user_erasures SET requested_by = 'admin' WHERE requested_by = 'retention';
+ALTER TABLE user_erasures ADD CONSTRAINT user_erasures_requested_by_check
+    CHECK (requested_by IN ('user', 'admin'));
+
+DROP INDEX IF EXISTS idx_users_unverified;
+ALTER TABLE users DROP COLUMN IF EXISTS unverified_warned_at;
@@ -0,0 +1,10 @@
+-- Accounts whose email was never verified are warned, then deleted or deactivated by the
+-- retention policy; unverified_warned_at records when the warning was sent
+ALTER TABLE users ADD COLUMN IF NOT EXISTS unverified_warned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_unverified ON users(created_at) WHERE is_email_verified = false AND is_active = true;
+
+-- Erasures carried out by the retention policy
+ALTER TABLE user_erasures DROP CONSTRAINT IF EXISTS user_erasures_requested_by_check;
+ALTER TABLE user_erasures ADD CONSTRAINT user_erasures_requested_by_check
+    CHECK (requested_by IN ('user', 'admin', 'retention'));
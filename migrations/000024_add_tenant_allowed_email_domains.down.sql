@@ -0,0 +1 @@
+ALTER TABLE tenants DROP COLUMN IF EXISTS allowed_email_domains;
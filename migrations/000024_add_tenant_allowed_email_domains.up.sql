@@ -0,0 +1,2 @@
+-- Email domains allowed to register with the tenant, the configured ones when empty
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS allowed_email_domains TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,9 @@
+// Package migrations embeds the PostgreSQL schema migrations, which are applied with make migrate-up
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ip_rules;
+DROP TABLE IF EXISTS oauth_providers;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,15 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000008
+-- Erasures are compliance evidence and outlive the users they refer to, so user_id has no foreign key
+
+CREATE TABLE IF NOT EXISTS user_erasures (
+    id TEXT PRIMARY KEY,
+    user_id TEXT UNIQUE NOT NULL,
+    email_hash VARCHAR(64) NOT NULL,
+    requested_by VARCHAR(10) NOT NULL CHECK (requested_by IN ('user', 'admin')),
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('delete', 'anonymize')),
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    erase_after TIMESTAMP NOT NULL,
+    erased_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_erasures_pending ON user_erasures(erase_after) WHERE erased_at IS NULL;
@@ -0,0 +1,13 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000009
+
+CREATE TABLE IF NOT EXISTS consents (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    document VARCHAR(20) NOT NULL CHECK (document IN ('terms', 'privacy')),
+    version VARCHAR(50) NOT NULL,
+    accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ip_address VARCHAR(45),
+    UNIQUE(user_id, document, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_consents_user_id ON consents(user_id);
@@ -0,0 +1,19 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000010
+
+CREATE TABLE IF NOT EXISTS invitations (
+    id TEXT PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    email_normalized VARCHAR(255) NOT NULL,
+    role VARCHAR(50),
+    tenant VARCHAR(100),
+    invited_by TEXT REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    accepted_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_invited_by ON invitations(invited_by);
+CREATE INDEX IF NOT EXISTS idx_invitations_created_at ON invitations(created_at);
@@ -0,0 +1,7 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000012
+
+ALTER TABLE refresh_tokens ADD COLUMN session_id TEXT NOT NULL DEFAULT '';
+
+UPDATE refresh_tokens SET session_id = id WHERE session_id = '';
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
@@ -0,0 +1,3 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000013
+
+ALTER TABLE refresh_tokens ADD COLUMN device_fingerprint VARCHAR(64);
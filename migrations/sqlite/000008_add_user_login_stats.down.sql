@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN previous_login_ip;
+ALTER TABLE users DROP COLUMN previous_login_at;
+ALTER TABLE users DROP COLUMN last_login_ip;
+ALTER TABLE users DROP COLUMN login_count;
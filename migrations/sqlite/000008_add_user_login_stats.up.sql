@@ -0,0 +1,6 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000014
+
+ALTER TABLE users ADD COLUMN login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN last_login_ip VARCHAR(45);
+ALTER TABLE users ADD COLUMN previous_login_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN previous_login_ip VARCHAR(45);
@@ -0,0 +1,5 @@
+DELETE FROM refresh_tokens WHERE revoked_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_refresh_tokens_revoked_at;
+ALTER TABLE refresh_tokens DROP COLUMN revoke_reason;
+ALTER TABLE refresh_tokens DROP COLUMN revoked_at;
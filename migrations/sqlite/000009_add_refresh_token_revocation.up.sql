@@ -0,0 +1,6 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000015
+
+ALTER TABLE refresh_tokens ADD COLUMN revoked_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN revoke_reason VARCHAR(32);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_revoked_at ON refresh_tokens(revoked_at) WHERE revoked_at IS NOT NULL;
@@ -0,0 +1,15 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000016
+-- Redirect URLs are stored as a JSON array
+
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    email_from VARCHAR(255),
+    brand_name VARCHAR(100),
+    logo_url VARCHAR(2048),
+    brand_color VARCHAR(7),
+    redirect_urls TEXT NOT NULL DEFAULT '[]',
+    cookie_domain VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,12 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000017
+
+CREATE TABLE IF NOT EXISTS identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(type, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE oauth_providers DROP COLUMN token_expires_at;
+ALTER TABLE oauth_providers DROP COLUMN refresh_token;
+ALTER TABLE oauth_providers DROP COLUMN access_token;
@@ -0,0 +1,5 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000018
+
+ALTER TABLE oauth_providers ADD COLUMN access_token TEXT;
+ALTER TABLE oauth_providers ADD COLUMN refresh_token TEXT;
+ALTER TABLE oauth_providers ADD COLUMN token_expires_at TIMESTAMP;
@@ -0,0 +1,3 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000019
+
+CREATE INDEX IF NOT EXISTS idx_users_last_login_at ON users(last_login_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_oauth_providers_provider_user_id;
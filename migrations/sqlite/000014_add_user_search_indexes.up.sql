@@ -0,0 +1,4 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000020
+-- SQLite has no trigram indexes, searches by partial email scan the users
+
+CREATE INDEX IF NOT EXISTS idx_oauth_providers_provider_user_id ON oauth_providers(provider_user_id);
@@ -0,0 +1,10 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000021
+-- Flags are stored as a JSON array
+
+CREATE TABLE IF NOT EXISTS user_flags (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    notes TEXT NOT NULL DEFAULT '',
+    flags TEXT NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_by VARCHAR(255) NOT NULL
+);
@@ -0,0 +1,3 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000022
+ALTER TABLE users ADD COLUMN restriction TEXT NOT NULL DEFAULT 'none'
+    CHECK (restriction IN ('none', 'limited', 'banned'));
@@ -0,0 +1,20 @@
+CREATE TABLE user_erasures_old (
+    id TEXT PRIMARY KEY,
+    user_id TEXT UNIQUE NOT NULL,
+    email_hash VARCHAR(64) NOT NULL,
+    requested_by VARCHAR(10) NOT NULL CHECK (requested_by IN ('user', 'admin')),
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('delete', 'anonymize')),
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    erase_after TIMESTAMP NOT NULL,
+    erased_at TIMESTAMP
+);
+INSERT INTO user_erasures_old
+    SELECT id, user_id, email_hash, CASE requested_by WHEN 'retention' THEN 'admin' ELSE requested_by END, mode, requested_at, erase_after, erased_at
+    FROM user_erasures;
+DROP TABLE user_erasures;
+ALTER TABLE user_erasures_old RENAME TO user_erasures;
+
+CREATE INDEX IF NOT EXISTS idx_user_erasures_pending ON user_erasures(erase_after) WHERE erased_at IS NULL;
+
+DROP INDEX IF EXISTS idx_users_unverified;
+ALTER TABLE users DROP COLUMN unverified_warned_at;
@@ -0,0 +1,21 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000023
+ALTER TABLE users ADD COLUMN unverified_warned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_users_unverified ON users(created_at) WHERE is_email_verified = 0 AND is_active = 1;
+
+-- CHECK constraints can't be altered, user_erasures is rebuilt to allow the retention requester
+CREATE TABLE user_erasures_new (
+    id TEXT PRIMARY KEY,
+    user_id TEXT UNIQUE NOT NULL,
+    email_hash VARCHAR(64) NOT NULL,
+    requested_by VARCHAR(10) NOT NULL CHECK (requested_by IN ('user', 'admin', 'retention')),
+    mode VARCHAR(10) NOT NULL CHECK (mode IN ('delete', 'anonymize')),
+    requested_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    erase_after TIMESTAMP NOT NULL,
+    erased_at TIMESTAMP
+);
+INSERT INTO user_erasures_new SELECT id, user_id, email_hash, requested_by, mode, requested_at, erase_after, erased_at FROM user_erasures;
+DROP TABLE user_erasures;
+ALTER TABLE user_erasures_new RENAME TO user_erasures;
+
+CREATE INDEX IF NOT EXISTS idx_user_erasures_pending ON user_erasures(erase_after) WHERE erased_at IS NULL;
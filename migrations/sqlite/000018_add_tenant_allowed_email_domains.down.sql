@@ -0,0 +1 @@
+ALTER TABLE tenants DROP COLUMN allowed_email_domains;
@@ -0,0 +1,2 @@
+-- SQLite schema, equivalent to the PostgreSQL migration 000024
+ALTER TABLE tenants ADD COLUMN allowed_email_domains TEXT NOT NULL DEFAULT '[]';
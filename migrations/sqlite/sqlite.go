@@ -0,0 +1,9 @@
+// Package sqlite embeds the SQLite schema migrations, which are applied on startup
+package sqlite
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
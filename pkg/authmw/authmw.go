@@ -0,0 +1,258 @@
+// Package authmw authenticates requests of resource servers with access tokens issued by the auth service
+//
+// Tokens are validated locally with the shared JWT secret or keys from a JWKS endpoint.
+// Optionally every token is also checked with the introspection endpoint, so revoked tokens are rejected
+// before they expire.
+package authmw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrMissingToken is returned when a request has no bearer token
+	ErrMissingToken = errors.New("authorization header is required")
+	// ErrInvalidToken is returned when a token is malformed, expired or has an invalid signature
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrTokenRevoked is returned when the introspection endpoint reports a token as inactive
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// minSecretLength matches the JWT_SECRET requirement of the service
+const minSecretLength = 32
+
+var (
+	hmacMethods       = []string{"HS256", "HS384", "HS512"}
+	asymmetricMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+// Config configures a Verifier, at least one of Secret and JWKSURL is required
+type Config struct {
+	// Secret is the JWT_SECRET of the service, used for HMAC-signed tokens
+	Secret string
+	// PreviousSecrets are the JWT_PREVIOUS_SECRETS of the service, accepted while secrets are rotated
+	// Secrets rotated at runtime with JWT_KEYRING=redis aren't known here, use introspection then.
+	PreviousSecrets []string
+	// JWKSURL is a JSON Web Key Set with public keys for asymmetrically signed tokens
+	JWKSURL string
+	// JWKSRefreshInterval is how often the key set is reloaded, 1h by default
+	// Unknown key IDs trigger a reload earlier, at most once a minute
+	JWKSRefreshInterval time.Duration
+	// IntrospectionURL enables revocation checks, e.g. "https://auth.example.com/api/v2/auth/introspect"
+	IntrospectionURL string
+	// IntrospectionCacheTTL caches introspection results per token, 0 checks every request
+	// Pass the messages of the service's InvalidationChannel to HandleInvalidation to drop
+	// results of revoked users right away.
+	IntrospectionCacheTTL time.Duration
+	// Issuer and Audience must match JWT_ISSUER and one of JWT_AUDIENCE of the service when set
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew between the service and the resource server
+	Leeway time.Duration
+	// HTTPClient is used for JWKS and introspection requests
+	HTTPClient *http.Client
+	// ErrorHandler writes responses for rejected requests of the net/http middlewares
+	// By default a JSON error in the format of the service is written
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Claims are the claims of a validated access token
+type Claims struct {
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	// OrgID and OrgRole are set when the token is scoped to an organization
+	OrgID   string
+	OrgRole string
+	// Features are the feature flags of the service that are on for the user
+	Features []string
+	// Restricted is set for users limited by an admin of the service, e.g. to refuse them posting
+	Restricted bool
+	// Raw holds all claims of the token, including ones not mapped above
+	Raw map[string]any
+}
+
+// Verifier validates access tokens
+type Verifier struct {
+	secrets      jwt.VerificationKeySet
+	keys         *keySet
+	introspector *introspector
+	parser       *jwt.Parser
+	errorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// New creates a verifier
+func New(cfg Config) (*Verifier, error) {
+	if cfg.Secret == "" && cfg.JWKSURL == "" {
+		return nil, errors.New("authmw: either Secret or JWKSURL is required")
+	}
+	for _, secret := range append([]string{cfg.Secret}, cfg.PreviousSecrets...) {
+		if secret != "" && len(secret) < minSecretLength {
+			return nil, fmt.Errorf("authmw: secret must be at least %d characters long", minSecretLength)
+		}
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	v := &Verifier{errorHandler: cfg.ErrorHandler}
+	if v.errorHandler == nil {
+		v.errorHandler = writeError
+	}
+
+	var methods []string
+	if cfg.Secret != "" {
+		for _, secret := range append([]string{cfg.Secret}, cfg.PreviousSecrets...) {
+			v.secrets.Keys = append(v.secrets.Keys, []byte(secret))
+		}
+		methods = append(methods, hmacMethods...)
+	}
+	if cfg.JWKSURL != "" {
+		v.keys = newKeySet(cfg.JWKSURL, httpClient, cfg.JWKSRefreshInterval)
+		methods = append(methods, asymmetricMethods...)
+	}
+	if cfg.IntrospectionURL != "" {
+		v.introspector = newIntrospector(cfg.IntrospectionURL, httpClient, cfg.IntrospectionCacheTTL)
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(parserOpts...)
+
+	return v, nil
+}
+
+// Verify validates a token and returns its claims
+// Errors other than ErrInvalidToken and ErrTokenRevoked mean the token could not be checked,
+// e.g. because the JWKS or introspection endpoint is unavailable
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	var keyErr error
+	parsed, err := v.parser.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+			if len(v.secrets.Keys) == 0 {
+				return nil, errors.New("HMAC-signed tokens are not accepted")
+			}
+			return v.secrets, nil
+		}
+
+		if v.keys == nil {
+			return nil, errors.New("asymmetrically signed tokens are not accepted")
+		}
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.keys.key(ctx, kid)
+		if err != nil && !errors.Is(err, errUnknownKey) {
+			keyErr = err
+		}
+		return key, err
+	})
+	if keyErr != nil {
+		return nil, keyErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, err := parseClaims(parsed.Claims.(jwt.MapClaims))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if v.introspector != nil {
+		active, err := v.introspector.active(ctx, token, claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// InvalidationChannel is the Redis pub/sub channel the service publishes cache invalidations on
+const InvalidationChannel = "cache_invalidation"
+
+// HandleInvalidation drops cached introspection results as told by a message of InvalidationChannel
+// Messages name the user whose tokens were revoked or deactivated, or no user when all tokens were revoked.
+func (v *Verifier) HandleInvalidation(payload []byte) error {
+	var inv struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(payload, &inv); err != nil {
+		return fmt.Errorf("authmw: failed to decode invalidation: %w", err)
+	}
+
+	if v.introspector != nil {
+		v.introspector.invalidate(inv.UserID)
+	}
+	return nil
+}
+
+// parseClaims maps access token claims, refresh tokens are rejected
+func parseClaims(raw jwt.MapClaims) (*Claims, error) {
+	if raw["type"] == "refresh" {
+		return nil, errors.New("refresh tokens can't be used for authentication")
+	}
+
+	userID, ok := raw["user_id"].(string)
+	if !ok || userID == "" {
+		return nil, errors.New("invalid user_id in token")
+	}
+	email, ok := raw["email"].(string)
+	if !ok {
+		return nil, errors.New("invalid email in token")
+	}
+
+	claims := &Claims{UserID: userID, Email: email, Raw: raw}
+	claims.OrgID, _ = raw["org_id"].(string)
+	claims.OrgRole, _ = raw["org_role"].(string)
+	claims.Restricted, _ = raw["restricted"].(bool)
+	if features, ok := raw["features"].([]any); ok {
+		for _, feature := range features {
+			if name, ok := feature.(string); ok {
+				claims.Features = append(claims.Features, name)
+			}
+		}
+	}
+	if exp, err := raw.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if iat, err := raw.GetIssuedAt(); err == nil && iat != nil {
+		claims.IssuedAt = iat.Time
+	}
+
+	return claims, nil
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying claims
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims of the authenticated request, if any
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
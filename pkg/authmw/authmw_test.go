@@ -0,0 +1,493 @@
+package authmw
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/utils"
+)
+
+const testSecret = "test-secret-key-with-at-least-32-characters"
+
+func accessClaims(exp time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id": "user-1",
+		"email":   "user@example.com",
+		"exp":     exp.Unix(),
+		"iat":     time.Now().Unix(),
+	}
+}
+
+func TestVerifySharedSecret(t *testing.T) {
+	v, err := New(Config{Secret: testSecret})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	// Tokens issued by the service itself
+	manager := utils.NewJWTManager(testSecret, 15*time.Minute, time.Hour)
+	token, err := manager.GenerateOrgAccessToken("user-1", "user@example.com", &domain.Membership{OrgID: "org-1", Role: domain.OrgRoleMember})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	claims, err := v.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Failed to verify token: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Email != "user@example.com" || claims.OrgID != "org-1" || claims.OrgRole != domain.OrgRoleMember || claims.Restricted {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if time.Until(claims.ExpiresAt) <= 0 {
+		t.Errorf("Expected expiry in the future, got %v", claims.ExpiresAt)
+	}
+
+	restricted, _ := manager.GenerateAccessTokenWithClaims(&domain.TokenClaims{UserID: "user-1", Email: "user@example.com", Restricted: true})
+	if claims, err := v.Verify(context.Background(), restricted); err != nil || !claims.Restricted {
+		t.Errorf("Expected the restricted claim, got %+v (%v)", claims, err)
+	}
+
+	refresh, _ := manager.GenerateRefreshToken("user-1")
+	expired, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(-time.Minute))).SignedString([]byte(testSecret))
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte("another-secret-key-with-32-characters!"))
+
+	for name, token := range map[string]string{"refresh": refresh, "expired": expired, "forged": forged, "malformed": "not-a-jwt"} {
+		if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected %s token to be invalid, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyLeeway(t *testing.T) {
+	v, _ := New(Config{Secret: testSecret, Leeway: time.Minute})
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(-10*time.Second))).SignedString([]byte(testSecret))
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Expected token within leeway to be accepted, got %v", err)
+	}
+}
+
+func TestVerifyIssuerAudience(t *testing.T) {
+	v, _ := New(Config{Secret: testSecret, Issuer: "https://auth.example.com", Audience: "api"})
+
+	manager := utils.NewJWTManager(testSecret, 15*time.Minute, time.Hour, utils.WithIssuer("https://auth.example.com"), utils.WithAudience("api", "admin"))
+	token, _ := manager.GenerateAccessToken("user-1", "user@example.com")
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Expected token of the issuer and audience to be accepted, got %v", err)
+	}
+
+	staging := utils.NewJWTManager(testSecret, 15*time.Minute, time.Hour, utils.WithIssuer("https://auth.staging.example.com"), utils.WithAudience("api"))
+	token, _ = staging.GenerateAccessToken("user-1", "user@example.com")
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected token of another issuer to be invalid, got %v", err)
+	}
+}
+
+func TestVerifyPreviousSecrets(t *testing.T) {
+	const newSecret = "rotated-secret-key-with-at-least-32-characters"
+	v, err := New(Config{Secret: newSecret, PreviousSecrets: []string{testSecret}})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	for _, secret := range []string{newSecret, testSecret} {
+		token, _ := utils.NewJWTManager(secret, 15*time.Minute, time.Hour).GenerateAccessToken("user-1", "user@example.com")
+		if _, err := v.Verify(context.Background(), token); err != nil {
+			t.Errorf("Expected token of a current or previous secret to be accepted, got %v", err)
+		}
+	}
+}
+
+func TestNewRequiresKeys(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("Expected error without secret and JWKS URL")
+	}
+	if _, err := New(Config{Secret: "short"}); err == nil {
+		t.Error("Expected error for a short secret")
+	}
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	var (
+		fetches atomic.Int32
+		mu      sync.Mutex
+	)
+	keys := []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer server.Close()
+
+	v, err := New(Config{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	rsaToken := jwt.NewWithClaims(jwt.SigningMethodRS256, accessClaims(time.Now().Add(time.Minute)))
+	rsaToken.Header["kid"] = "rsa-1"
+	signed, _ := rsaToken.SignedString(rsaKey)
+
+	if _, err := v.Verify(context.Background(), signed); err != nil {
+		t.Fatalf("Failed to verify RSA token: %v", err)
+	}
+
+	// HMAC tokens must not be accepted when only JWKS is configured
+	hmacToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+	if _, err := v.Verify(context.Background(), hmacToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected HMAC token to be rejected, got %v", err)
+	}
+
+	// A rotated key is picked up by reloading the set once the minimum interval has passed
+	mu.Lock()
+	keys = append(keys, map[string]string{
+		"kty": "EC", "kid": "ec-1", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+	})
+	mu.Unlock()
+	ecToken := jwt.NewWithClaims(jwt.SigningMethodES256, accessClaims(time.Now().Add(time.Minute)))
+	ecToken.Header["kid"] = "ec-1"
+	signed, _ = ecToken.SignedString(ecKey)
+
+	if _, err := v.Verify(context.Background(), signed); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected unknown key to be rejected before the minimum refresh interval, got %v", err)
+	}
+
+	v.keys.now = func() time.Time { return time.Now().Add(2 * minJWKSRefreshInterval) }
+	if _, err := v.Verify(context.Background(), signed); err != nil {
+		t.Errorf("Failed to verify token signed with a rotated key: %v", err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", got)
+	}
+}
+
+// introspectionServer reports tokens in revoked as inactive
+func introspectionServer(t *testing.T, revoked map[string]bool, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]bool{"active": !revoked[r.PostForm.Get("token")]})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerifyIntrospection(t *testing.T) {
+	active, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+	claims := accessClaims(time.Now().Add(time.Minute))
+	claims["user_id"] = "user-2"
+	revoked, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+
+	var calls atomic.Int32
+	server := introspectionServer(t, map[string]bool{revoked: true}, &calls)
+
+	v, _ := New(Config{Secret: testSecret, IntrospectionURL: server.URL, IntrospectionCacheTTL: time.Minute})
+
+	for range 2 {
+		if _, err := v.Verify(context.Background(), active); err != nil {
+			t.Fatalf("Failed to verify active token: %v", err)
+		}
+		if _, err := v.Verify(context.Background(), revoked); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("Expected revoked token to be rejected, got %v", err)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected cached introspection results, got %d calls", got)
+	}
+
+	server.Close()
+	uncached, _ := New(Config{Secret: testSecret, IntrospectionURL: server.URL})
+	_, err := uncached.Verify(context.Background(), active)
+	if err == nil || errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected an unavailability error, got %v", err)
+	}
+}
+
+func TestHandleInvalidation(t *testing.T) {
+	alice, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+	claims := accessClaims(time.Now().Add(time.Minute))
+	claims["user_id"] = "user-2"
+	bob, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+
+	var calls atomic.Int32
+	revoked := map[string]bool{}
+	server := introspectionServer(t, revoked, &calls)
+	v, _ := New(Config{Secret: testSecret, IntrospectionURL: server.URL, IntrospectionCacheTTL: time.Minute})
+
+	for _, token := range []string{alice, bob} {
+		if _, err := v.Verify(context.Background(), token); err != nil {
+			t.Fatalf("Failed to verify token: %v", err)
+		}
+	}
+
+	// Only the results of the invalidated user are dropped
+	revoked[bob] = true
+	if err := v.HandleInvalidation([]byte(`{"reason":"revoked","user_id":"user-2","at":1}`)); err != nil {
+		t.Fatalf("Failed to handle invalidation: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), bob); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected the invalidated token to be rejected, got %v", err)
+	}
+	if _, err := v.Verify(context.Background(), alice); err != nil {
+		t.Errorf("Expected the token of another user to stay cached, got %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Expected 3 introspection calls, got %d", got)
+	}
+
+	// Invalidations without user drop everything
+	revoked[alice] = true
+	if err := v.HandleInvalidation([]byte(`{"reason":"revoked","at":1}`)); err != nil {
+		t.Fatalf("Failed to handle invalidation: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), alice); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected all tokens to be checked again, got %v", err)
+	}
+
+	if err := v.HandleInvalidation([]byte("not json")); err == nil {
+		t.Error("Expected malformed invalidations to fail")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	v, _ := New(Config{Secret: testSecret})
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		if !ok {
+			_, _ = w.Write([]byte("anonymous"))
+			return
+		}
+		_, _ = w.Write([]byte(claims.UserID))
+	}
+
+	tests := []struct {
+		name     string
+		optional bool
+		header   string
+		status   int
+		body     string
+	}{
+		{name: "valid token", header: "Bearer " + token, status: http.StatusOK, body: "user-1"},
+		{name: "lowercase scheme", header: "bearer " + token, status: http.StatusOK, body: "user-1"},
+		{name: "missing header", status: http.StatusUnauthorized},
+		{name: "invalid token", header: "Bearer invalid", status: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic dXNlcjpwYXNz", status: http.StatusUnauthorized},
+		{name: "optional anonymous", optional: true, status: http.StatusOK, body: "anonymous"},
+		{name: "optional invalid token", optional: true, header: "Bearer invalid", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := v.Middleware
+			if tt.optional {
+				mw = v.OptionalMiddleware
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			mw(http.HandlerFunc(handler)).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusUnauthorized {
+				var resp errorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Code == "" {
+					t.Errorf("Expected JSON error with a code, got %q", rec.Body.String())
+				}
+				if rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("Expected WWW-Authenticate header")
+				}
+				return
+			}
+			if rec.Body.String() != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v, _ := New(Config{Secret: testSecret})
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+
+	router := gin.New()
+	router.GET("/me", v.Gin(), func(c *gin.Context) {
+		claims, ok := FromGin(c)
+		if !ok || c.GetString("user_id") != claims.UserID {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.String(http.StatusOK, claims.Email)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "user@example.com" {
+		t.Errorf("Expected authenticated request, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rec.Code)
+	}
+}
+
+func TestRequirePolicy(t *testing.T) {
+	v, _ := New(Config{Secret: testSecret})
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+
+	var got PolicyInput
+	policy := PolicyFunc(func(ctx context.Context, input PolicyInput) (bool, error) {
+		got = input
+		switch input.Action {
+		case http.MethodGet:
+			return true, nil
+		case http.MethodDelete:
+			return false, errors.New("engine unavailable")
+		}
+		return false, nil
+	})
+	handler := v.Middleware(v.RequirePolicy(policy, "", "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	for method, status := range map[string]int{http.MethodGet: http.StatusNoContent, http.MethodPost: http.StatusForbidden, http.MethodDelete: http.StatusServiceUnavailable} {
+		req := httptest.NewRequest(method, "/orders/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != status {
+			t.Errorf("Expected %s to get %d, got %d", method, status, rec.Code)
+		}
+		if got.Subject == nil || got.Subject.UserID != "user-1" || got.Resource != "/orders/1" || got.Action != method {
+			t.Errorf("Unexpected policy input for %s: %+v", method, got)
+		}
+	}
+
+	// Anonymous requests are rejected without asking the policy
+	anonymous := v.OptionalMiddleware(v.RequirePolicy(policy, "orders", "read")(http.NotFoundHandler()))
+	rec := httptest.NewRecorder()
+	anonymous.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/1", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an anonymous request, got %d", rec.Code)
+	}
+}
+
+func TestRemotePolicy(t *testing.T) {
+	var input map[string]any
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input map[string]any `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		input = body.Input
+
+		switch body.Input["action"] {
+		case "read":
+			_, _ = w.Write([]byte(`{"result": true}`))
+		case "write":
+			_, _ = w.Write([]byte(`{"result": {"allow": true}}`))
+		case "delete":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer pdp.Close()
+
+	policy := NewRemotePolicy(pdp.URL, nil)
+	subject := &Claims{UserID: "user-1", Raw: map[string]any{"user_id": "user-1", "org_role": "admin"}}
+
+	for action, want := range map[string]bool{"read": true, "write": true, "delete": false} {
+		allowed, err := policy.Evaluate(context.Background(), PolicyInput{Subject: subject, Resource: "orders", Action: action})
+		if err != nil || allowed != want {
+			t.Errorf("Expected %s to be allowed=%v, got %v, %v", action, want, allowed, err)
+		}
+	}
+	if sub, _ := input["subject"].(map[string]any); sub["org_role"] != "admin" || input["resource"] != "orders" {
+		t.Errorf("Expected the claims and resource to be posted, got %+v", input)
+	}
+
+	if _, err := policy.Evaluate(context.Background(), PolicyInput{Subject: subject, Action: "unknown"}); err == nil {
+		t.Error("Expected an error for a failing decision point")
+	}
+}
+
+func TestGinRequirePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v, _ := New(Config{Secret: testSecret})
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims(time.Now().Add(time.Minute))).SignedString([]byte(testSecret))
+
+	var resource string
+	policy := PolicyFunc(func(ctx context.Context, input PolicyInput) (bool, error) {
+		resource = input.Resource
+		return input.Subject.UserID == "user-1", nil
+	})
+
+	router := gin.New()
+	router.GET("/orders/:id", v.Gin(), v.GinRequirePolicy(policy, "", ""), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent || resource != "/orders/:id" {
+		t.Errorf("Expected the request to be allowed on the route, got %d for %q", rec.Code, resource)
+	}
+}
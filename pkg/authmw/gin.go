@@ -0,0 +1,52 @@
+package authmw
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gin returns a gin middleware rejecting requests without a valid bearer token
+// Like the service's own middleware it sets "user_id", "email" and "claims" in the gin context,
+// the claims are also available from the request context with FromContext
+func (v *Verifier) Gin() gin.HandlerFunc {
+	return v.ginMiddleware(true)
+}
+
+// GinOptional returns a gin middleware authenticating requests carrying an Authorization header
+func (v *Verifier) GinOptional() gin.HandlerFunc {
+	return v.ginMiddleware(false)
+}
+
+func (v *Verifier) ginMiddleware(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.authenticate(c.Request, required)
+		if err != nil {
+			abortGin(c, err)
+			return
+		}
+
+		if claims != nil {
+			c.Request = c.Request.WithContext(NewContext(c.Request.Context(), claims))
+			c.Set("user_id", claims.UserID)
+			c.Set("email", claims.Email)
+			c.Set("claims", claims)
+		}
+
+		c.Next()
+	}
+}
+
+// abortGin rejects a gin request with the response for err
+func abortGin(c *gin.Context, err error) {
+	status, code, message := errorStatus(err)
+	if status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	c.AbortWithStatusJSON(status, errorResponse{Error: http.StatusText(status), Code: code, Message: message})
+}
+
+// FromGin returns the claims of an authenticated gin request, if any
+func FromGin(c *gin.Context) (*Claims, bool) {
+	return FromContext(c.Request.Context())
+}
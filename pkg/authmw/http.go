@@ -0,0 +1,89 @@
+package authmw
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// errorResponse mirrors the error format of the service
+type errorResponse struct {
+	Error   string `json:"error"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Middleware rejects requests without a valid bearer token and stores the claims in the request context
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return v.middleware(next, true)
+}
+
+// OptionalMiddleware authenticates requests carrying an Authorization header
+// Requests without the header are passed through anonymously, invalid tokens are still rejected
+func (v *Verifier) OptionalMiddleware(next http.Handler) http.Handler {
+	return v.middleware(next, false)
+}
+
+func (v *Verifier) middleware(next http.Handler, required bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.authenticate(r, required)
+		if err != nil {
+			v.errorHandler(w, r, err)
+			return
+		}
+		if claims != nil {
+			r = r.WithContext(NewContext(r.Context(), claims))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate verifies the bearer token of a request, no claims and no error mean an anonymous request
+func (v *Verifier) authenticate(r *http.Request, required bool) (*Claims, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		if required {
+			return nil, ErrMissingToken
+		}
+		return nil, nil
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return v.Verify(r.Context(), token)
+}
+
+// errorStatus maps verification errors to a response status, code and message
+func errorStatus(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return http.StatusUnauthorized, "unauthorized", ErrMissingToken.Error()
+	case errors.Is(err, ErrTokenRevoked):
+		return http.StatusUnauthorized, "token_revoked", ErrTokenRevoked.Error()
+	case errors.Is(err, ErrInvalidToken):
+		return http.StatusUnauthorized, "invalid_token", ErrInvalidToken.Error()
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden, "forbidden", ErrForbidden.Error()
+	case errors.Is(err, errPolicyUnavailable):
+		// No decision, failing closed
+		return http.StatusServiceUnavailable, "service_unavailable", "authorization is unavailable"
+	default:
+		// The token could not be checked, failing closed
+		return http.StatusServiceUnavailable, "service_unavailable", "token verification is unavailable"
+	}
+}
+
+// writeError is the default error handler
+func writeError(w http.ResponseWriter, _ *http.Request, err error) {
+	status, code, message := errorStatus(err)
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: http.StatusText(status), Code: code, Message: message})
+}
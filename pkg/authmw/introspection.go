@@ -0,0 +1,122 @@
+package authmw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedIntrospections bounds the introspection cache, expired entries are dropped when it is reached
+const maxCachedIntrospections = 10000
+
+// introspector checks tokens with the introspection endpoint of the service (RFC 7662)
+type introspector struct {
+	url    string
+	client *http.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]introspection
+}
+
+type introspection struct {
+	active    bool
+	userID    string
+	expiresAt time.Time
+}
+
+func newIntrospector(url string, client *http.Client, ttl time.Duration) *introspector {
+	return &introspector{
+		url:    url,
+		client: client,
+		ttl:    ttl,
+		now:    time.Now,
+		cache:  make(map[[sha256.Size]byte]introspection),
+	}
+}
+
+// active reports whether the service considers the token of the user active
+func (i *introspector) active(ctx context.Context, token, userID string) (bool, error) {
+	// Tokens are cached by hash so the cache doesn't hold usable credentials
+	key := sha256.Sum256([]byte(token))
+	if i.ttl > 0 {
+		i.mu.Lock()
+		cached, ok := i.cache[key]
+		i.mu.Unlock()
+		if ok && i.now().Before(cached.expiresAt) {
+			return cached.active, nil
+		}
+	}
+
+	form := url.Values{"token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to introspect token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to introspect token: unexpected status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Active bool `json:"active"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	if i.ttl > 0 {
+		i.store(key, userID, result.Active)
+	}
+	return result.Active, nil
+}
+
+func (i *introspector) store(key [sha256.Size]byte, userID string, active bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := i.now()
+	if len(i.cache) >= maxCachedIntrospections {
+		for k, entry := range i.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(i.cache, k)
+			}
+		}
+		// Still full of fresh entries, start over rather than grow without bound
+		if len(i.cache) >= maxCachedIntrospections {
+			clear(i.cache)
+		}
+	}
+	i.cache[key] = introspection{active: active, userID: userID, expiresAt: now.Add(i.ttl)}
+}
+
+// invalidate drops the cached results for the tokens of a user, or all of them when userID is empty
+func (i *introspector) invalidate(userID string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if userID == "" {
+		clear(i.cache)
+		return
+	}
+	for key, entry := range i.cache {
+		if entry.userID == userID {
+			delete(i.cache, key)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package authmw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrForbidden is returned when a policy denies a request
+var ErrForbidden = errors.New("access denied by policy")
+
+// errPolicyUnavailable wraps evaluator errors, no decision could be made
+var errPolicyUnavailable = errors.New("policy evaluation failed")
+
+// PolicyInput is what an authorization decision is made on
+type PolicyInput struct {
+	// Subject holds the claims of the authenticated request
+	Subject *Claims
+	// Resource and Action default to the request path and method
+	Resource string
+	Action   string
+}
+
+// PolicyEvaluator decides whether a subject may perform an action on a resource
+// An error means no decision could be made, the request is then rejected with 503
+type PolicyEvaluator interface {
+	Evaluate(ctx context.Context, input PolicyInput) (bool, error)
+}
+
+// PolicyFunc adapts a function, e.g. wrapping an embedded OPA or Cedar engine, to a PolicyEvaluator
+type PolicyFunc func(ctx context.Context, input PolicyInput) (bool, error)
+
+// Evaluate calls f
+func (f PolicyFunc) Evaluate(ctx context.Context, input PolicyInput) (bool, error) {
+	return f(ctx, input)
+}
+
+// RemotePolicy asks an external policy decision point, e.g. the OPA data API
+//
+// The input is posted as {"input": {"subject": <claims>, "resource": ..., "action": ...}} and the response
+// must be {"result": true} or {"result": {"allow": true}}, an undefined result denies the request.
+type RemotePolicy struct {
+	url    string
+	client *http.Client
+}
+
+// NewRemotePolicy creates an evaluator posting decisions to url, e.g. "http://opa:8181/v1/data/authz"
+// A nil client has a timeout of 10s.
+func NewRemotePolicy(url string, client *http.Client) *RemotePolicy {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &RemotePolicy{url: url, client: client}
+}
+
+// Evaluate asks the decision point whether input is allowed
+func (p *RemotePolicy) Evaluate(ctx context.Context, input PolicyInput) (bool, error) {
+	var subject map[string]any
+	if input.Subject != nil {
+		subject = input.Subject.Raw
+	}
+	body, err := json.Marshal(map[string]any{
+		"input": map[string]any{
+			"subject":  subject,
+			"resource": input.Resource,
+			"action":   input.Action,
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create policy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to evaluate policy: unexpected status %d", resp.StatusCode)
+	}
+
+	var decision struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return false, fmt.Errorf("failed to decode policy decision: %w", err)
+	}
+	if len(decision.Result) == 0 {
+		return false, nil
+	}
+
+	var allowed bool
+	if err := json.Unmarshal(decision.Result, &allowed); err == nil {
+		return allowed, nil
+	}
+	var result struct {
+		Allow bool `json:"allow"`
+	}
+	if err := json.Unmarshal(decision.Result, &result); err != nil {
+		return false, fmt.Errorf("failed to decode policy decision: %w", err)
+	}
+	return result.Allow, nil
+}
+
+// RequirePolicy returns a middleware rejecting requests the evaluator doesn't allow
+// It must run after Middleware or OptionalMiddleware, anonymous requests are rejected.
+// An empty resource or action is taken from the request path or method.
+func (v *Verifier) RequirePolicy(evaluator PolicyEvaluator, resource, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := authorize(r, evaluator, resource, action); err != nil {
+				v.errorHandler(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GinRequirePolicy returns a gin middleware rejecting requests the evaluator doesn't allow
+// It must run after Gin or GinOptional. An empty resource defaults to the route, e.g. "/orders/:id".
+func (v *Verifier) GinRequirePolicy(evaluator PolicyEvaluator, resource, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := resource
+		if route == "" {
+			route = c.FullPath()
+		}
+		if err := authorize(c.Request, evaluator, route, action); err != nil {
+			abortGin(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorize evaluates the policy for the claims of an authenticated request
+func authorize(r *http.Request, evaluator PolicyEvaluator, resource, action string) error {
+	claims, ok := FromContext(r.Context())
+	if !ok {
+		return ErrMissingToken
+	}
+	if resource == "" {
+		resource = r.URL.Path
+	}
+	if action == "" {
+		action = r.Method
+	}
+
+	allowed, err := evaluator.Evaluate(r.Context(), PolicyInput{Subject: claims, Resource: resource, Action: action})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPolicyUnavailable, err)
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
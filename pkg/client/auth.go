@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Register creates a user and signs them in
+func (c *Client) Register(ctx context.Context, req *RegisterRequest) (*Tokens, error) {
+	var tokens Tokens
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/auth/register", body: req}, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return withRefreshCookie(resp, &tokens), nil
+}
+
+// Login signs a user in by email or username
+func (c *Client) Login(ctx context.Context, req *LoginRequest) (*Tokens, error) {
+	var tokens Tokens
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/auth/login", body: req}, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return withRefreshCookie(resp, &tokens), nil
+}
+
+// Refresh exchanges a refresh token for new tokens, the old refresh token stops working
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	if refreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	req := request{method: http.MethodPost, path: "/auth/refresh"}
+	if c.version >= V2 {
+		req.body = map[string]string{"refresh_token": refreshToken}
+	} else {
+		req.cookies = []*http.Cookie{{Name: refreshTokenCookie, Value: refreshToken}}
+	}
+
+	var tokens Tokens
+	resp, err := c.do(ctx, req, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return withRefreshCookie(resp, &tokens), nil
+}
+
+// Logout signs the user out and revokes refreshToken if it is set
+func (c *Client) Logout(ctx context.Context, accessToken, refreshToken string) error {
+	req := request{method: http.MethodPost, path: "/auth/logout", accessToken: accessToken}
+	if refreshToken != "" {
+		if c.version >= V2 {
+			req.body = map[string]string{"refresh_token": refreshToken}
+		} else {
+			req.cookies = []*http.Cookie{{Name: refreshTokenCookie, Value: refreshToken}}
+		}
+	}
+
+	_, err := c.do(ctx, req, nil)
+	return err
+}
+
+// GetMe returns the profile of the current user
+func (c *Client) GetMe(ctx context.Context, accessToken string) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/auth/me", accessToken: accessToken}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateMe partially updates the profile of the current user
+func (c *Client) UpdateMe(ctx context.Context, accessToken string, req *UpdateProfileRequest) (*User, error) {
+	var user User
+	if _, err := c.do(ctx, request{method: http.MethodPatch, path: "/auth/me", body: req, accessToken: accessToken}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UsernameAvailable checks whether a username is valid and not taken
+func (c *Client) UsernameAvailable(ctx context.Context, username string) (*UsernameAvailability, error) {
+	var result UsernameAvailability
+	path := "/auth/username-available?username=" + url.QueryEscape(username)
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: path}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListSessions returns the active sessions of the current user, newest first
+func (c *Client) ListSessions(ctx context.Context, accessToken string) ([]Session, error) {
+	var sessions []Session
+	if _, err := c.do(ctx, request{method: http.MethodGet, path: "/auth/sessions", accessToken: accessToken}, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession ends a session of the current user
+func (c *Client) RevokeSession(ctx context.Context, accessToken, sessionID string) error {
+	path := "/auth/sessions/" + url.PathEscape(sessionID)
+	_, err := c.do(ctx, request{method: http.MethodDelete, path: path, accessToken: accessToken}, nil)
+	return err
+}
+
+// withRefreshCookie fills the refresh token from the API v1 cookie
+func withRefreshCookie(resp *http.Response, tokens *Tokens) *Tokens {
+	if tokens.RefreshToken != "" {
+		return tokens
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == refreshTokenCookie && cookie.Value != "" {
+			tokens.RefreshToken = cookie.Value
+			tokens.RefreshTokenExpiresIn = cookie.MaxAge
+		}
+	}
+	return tokens
+}
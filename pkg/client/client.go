@@ -0,0 +1,240 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion selects the API version used by the client
+type APIVersion int
+
+// Supported API versions
+const (
+	// V1 keeps the refresh token in a cookie, the client reads and sends it transparently
+	V1 APIVersion = 1
+	// V2 returns and accepts the refresh token in the body and adds error codes
+	V2 APIVersion = 2
+)
+
+const refreshTokenCookie = "refresh_token"
+
+// RetryPolicy configures retries of failed requests
+// Requests rejected with 429 are retried for all methods since they were not processed,
+// network errors and 502/503/504 responses only for idempotent methods
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy returns the default retry policy
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
+
+// Client is a typed client of the auth service API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	version    APIVersion
+	retry      RetryPolicy
+	userAgent  string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAPIVersion sets the API version, V2 by default
+func WithAPIVersion(version APIVersion) Option {
+	return func(c *Client) {
+		c.version = version
+	}
+}
+
+// WithRetryPolicy sets the retry policy, MaxAttempts of 1 disables retries
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithUserAgent sets the User-Agent header, recorded by the service as session device info
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New creates a client for the service at baseURL, e.g. "https://auth.example.com"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		version:    V2,
+		retry:      DefaultRetryPolicy(),
+		userAgent:  "auth-service-go-client",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts <= 0 {
+		c.retry.MaxAttempts = 1
+	}
+	return c
+}
+
+// request describes a single API call
+type request struct {
+	method      string
+	path        string
+	body        any
+	accessToken string
+	cookies     []*http.Cookie
+}
+
+// do sends the request with retries and decodes the response into out
+// The returned response has its body consumed and closed, only headers and cookies are usable
+func (c *Client) do(ctx context.Context, req request, out any) (*http.Response, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/v%d%s", c.baseURL, c.version, req.path)
+
+	for attempt := 1; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		if body != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+		httpReq.Header.Set("Accept", "application/json")
+		httpReq.Header.Set("User-Agent", c.userAgent)
+		if req.accessToken != "" {
+			httpReq.Header.Set("Authorization", "Bearer "+req.accessToken)
+		}
+		for _, cookie := range req.cookies {
+			httpReq.AddCookie(cookie)
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			if attempt < c.retry.MaxAttempts && idempotent(req.method) && ctx.Err() == nil {
+				if err := c.wait(ctx, attempt, 0); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, fmt.Errorf("request failed: %w", err)
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			if attempt < c.retry.MaxAttempts && retryable(resp.StatusCode, req.method) {
+				if err := c.wait(ctx, attempt, retryAfter(resp)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, apiError(resp.StatusCode, data)
+		}
+
+		if out != nil && len(data) > 0 {
+			if err := json.Unmarshal(data, out); err != nil {
+				return nil, fmt.Errorf("failed to decode response: %w", err)
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// wait sleeps before the next attempt, using the server's Retry-After if it is longer
+func (c *Client) wait(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	delay := c.retry.InitialBackoff
+	for i := 1; i < attempt && delay < c.retry.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if c.retry.MaxBackoff > 0 {
+		delay = min(delay, c.retry.MaxBackoff)
+	}
+	// Jitter spreads retries of concurrent clients
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+	delay = max(delay, retryAfter)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryable(status int, method string) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func apiError(status int, data []byte) error {
+	apiErr := &APIError{StatusCode: status}
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Title == "" {
+		apiErr.Title = http.StatusText(status)
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return apiErr
+}
@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer imitates the token endpoints of both API versions
+type fakeServer struct {
+	mu           sync.Mutex
+	generation   int
+	refreshCalls atomic.Int32
+	meCalls      atomic.Int32
+}
+
+func (f *fakeServer) issue() (access, refresh string) {
+	f.generation++
+	return fmt.Sprintf("access-%d", f.generation), fmt.Sprintf("refresh-%d", f.generation)
+}
+
+func (f *fakeServer) currentAccess() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return fmt.Sprintf("access-%d", f.generation)
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writeJSON := func(status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	unauthorized := func(code string) {
+		writeJSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized", "code": code, "message": code})
+	}
+
+	switch r.URL.Path {
+	case "/api/v2/auth/login":
+		var req LoginRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Password != "Password123" {
+			unauthorized(CodeInvalidCredentials)
+			return
+		}
+		access, refresh := f.issue()
+		writeJSON(http.StatusOK, Tokens{AccessToken: access, TokenType: "Bearer", ExpiresIn: 900, RefreshToken: refresh, RefreshTokenExpiresIn: 3600})
+
+	case "/api/v2/auth/refresh":
+		f.refreshCalls.Add(1)
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.RefreshToken != fmt.Sprintf("refresh-%d", f.generation) {
+			unauthorized(CodeInvalidRefreshToken)
+			return
+		}
+		access, refresh := f.issue()
+		writeJSON(http.StatusOK, Tokens{AccessToken: access, TokenType: "Bearer", ExpiresIn: 900, RefreshToken: refresh, RefreshTokenExpiresIn: 3600})
+
+	case "/api/v1/auth/login", "/api/v1/auth/refresh":
+		if r.URL.Path == "/api/v1/auth/refresh" {
+			cookie, err := r.Cookie(refreshTokenCookie)
+			if err != nil || cookie.Value != fmt.Sprintf("refresh-%d", f.generation) {
+				writeJSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized", "message": "invalid refresh token"})
+				return
+			}
+		}
+		access, refresh := f.issue()
+		http.SetCookie(w, &http.Cookie{Name: refreshTokenCookie, Value: refresh, MaxAge: 3600, Path: "/api/v1/auth/refresh"})
+		writeJSON(http.StatusOK, map[string]any{"access_token": access, "token_type": "Bearer", "expires_in": 900})
+
+	case "/api/v2/auth/me":
+		// The first call is rate limited to exercise retries
+		if f.meCalls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			writeJSON(http.StatusTooManyRequests, map[string]string{"error": "Too many requests", "code": "too_many_requests"})
+			return
+		}
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer access-%d", f.generation) {
+			unauthorized(CodeUnauthorized)
+			return
+		}
+		writeJSON(http.StatusOK, User{ID: "user-1", Email: "user@example.com"})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, *fakeServer, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeServer{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	opts = append([]Option{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})}, opts...)
+	return New(server.URL, opts...), fake, server
+}
+
+func TestClientLoginAndRefreshV2(t *testing.T) {
+	c, _, _ := newTestClient(t)
+	ctx := context.Background()
+
+	tokens, err := c.Login(ctx, &LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if tokens.AccessToken != "access-1" || tokens.RefreshToken != "refresh-1" {
+		t.Fatalf("Unexpected tokens: %+v", tokens)
+	}
+
+	refreshed, err := c.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if refreshed.RefreshToken != "refresh-2" {
+		t.Errorf("Expected rotated refresh token, got %q", refreshed.RefreshToken)
+	}
+
+	if _, err := c.Refresh(ctx, tokens.RefreshToken); !IsCode(err, CodeInvalidRefreshToken) {
+		t.Errorf("Expected reused refresh token to fail with %s, got %v", CodeInvalidRefreshToken, err)
+	}
+}
+
+func TestClientRefreshCookieV1(t *testing.T) {
+	c, _, _ := newTestClient(t, WithAPIVersion(V1))
+	ctx := context.Background()
+
+	tokens, err := c.Login(ctx, &LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+	if tokens.RefreshToken != "refresh-1" || tokens.RefreshTokenExpiresIn != 3600 {
+		t.Fatalf("Expected refresh token to be read from the cookie, got %+v", tokens)
+	}
+
+	refreshed, err := c.Refresh(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	if refreshed.RefreshToken != "refresh-2" {
+		t.Errorf("Expected rotated refresh token, got %q", refreshed.RefreshToken)
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	c, _, _ := newTestClient(t)
+
+	_, err := c.Login(context.Background(), &LoginRequest{Identifier: "user@example.com", Password: "wrong"})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != CodeInvalidCredentials || apiErr.Title != "Unauthorized" {
+		t.Errorf("Unexpected API error: %+v", apiErr)
+	}
+	if !IsStatus(err, http.StatusUnauthorized) {
+		t.Error("Expected IsStatus to match 401")
+	}
+}
+
+func TestClientRetriesRateLimitedRequests(t *testing.T) {
+	c, fake, _ := newTestClient(t)
+	ctx := context.Background()
+
+	tokens, err := c.Login(ctx, &LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	user, err := c.GetMe(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if user.Email != "user@example.com" {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if calls := fake.meCalls.Load(); calls != 2 {
+		t.Errorf("Expected one retry, got %d calls", calls)
+	}
+}
+
+func TestClientNoRetryWhenDisabled(t *testing.T) {
+	c, _, _ := newTestClient(t, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	if _, err := c.GetMe(context.Background(), "access-0"); !IsStatus(err, http.StatusTooManyRequests) {
+		t.Errorf("Expected 429 without retries, got %v", err)
+	}
+}
+
+func TestTransportRefreshesRejectedTokens(t *testing.T) {
+	c, fake, _ := newTestClient(t)
+	ctx := context.Background()
+
+	tokens, err := c.Login(ctx, &LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	var rotated atomic.Value
+	source := c.NewTokenSource(tokens)
+	source.OnRefresh(func(tokens Tokens) { rotated.Store(tokens.RefreshToken) })
+
+	// The resource server only accepts the newest access token
+	resource := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fake.currentAccess() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer resource.Close()
+
+	httpClient := &http.Client{Transport: source.Transport(nil)}
+
+	// Tokens are rotated behind the source's back, so the next request is rejected once
+	if _, err := c.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+	source.mu.Lock()
+	source.tokens.RefreshToken = "refresh-2"
+	source.mu.Unlock()
+
+	resp, err := httpClient.Post(resource.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected request to succeed after refresh, got %d", resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "payload" {
+		t.Errorf("Expected request body to be replayed, got %q", body)
+	}
+	if rotated.Load() != "refresh-3" {
+		t.Errorf("Expected OnRefresh to receive the rotated refresh token, got %v", rotated.Load())
+	}
+}
+
+func TestTokenSourceRefreshesExpiringTokens(t *testing.T) {
+	c, fake, _ := newTestClient(t)
+	ctx := context.Background()
+
+	tokens, err := c.Login(ctx, &LoginRequest{Identifier: "user@example.com", Password: "Password123"})
+	if err != nil {
+		t.Fatalf("Failed to login: %v", err)
+	}
+
+	source := c.NewTokenSource(tokens)
+	source.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := source.AccessToken(ctx); err != nil {
+				t.Errorf("Failed to get access token: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := fake.refreshCalls.Load(); calls != 1 {
+		t.Errorf("Expected concurrent callers to share one refresh, got %d", calls)
+	}
+	if source.Tokens().AccessToken != "access-2" {
+		t.Errorf("Expected refreshed access token, got %q", source.Tokens().AccessToken)
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes returned by API v2, see the service README for the full list
+const (
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeInvalidRefreshToken = "invalid_refresh_token"
+	CodeRefreshTokenExpired = "refresh_token_expired"
+	CodeTokenRevoked        = "token_revoked"
+	CodeUserExists          = "user_exists"
+	CodeUsernameTaken       = "username_taken"
+	CodeSessionNotFound     = "session_not_found"
+	CodeValidationFailed    = "validation_failed"
+	CodeWeakPassword        = "weak_password"
+	CodeUnauthorized        = "unauthorized"
+)
+
+// ErrNoRefreshToken is returned when tokens can't be refreshed because no refresh token is known
+var ErrNoRefreshToken = errors.New("no refresh token")
+
+// APIError is an error response of the service
+type APIError struct {
+	StatusCode int
+	// Title is the short error title, e.g. "Unauthorized"
+	Title string `json:"error"`
+	// Code is the machine-readable error code, only returned by API v2
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+	// Fields are the fields the request got wrong, on validation errors
+	Fields []FieldError `json:"details"`
+}
+
+// FieldError is a request field that failed validation
+type FieldError struct {
+	// Field is the JSON name of the field, e.g. "password"
+	Field string `json:"field"`
+	// Rule is the rule the field breaks, e.g. "required" or the password policy rule "uppercase"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("auth service: %d %s (%s): %s", e.StatusCode, e.Title, e.Code, e.Message)
+	}
+	return fmt.Sprintf("auth service: %d %s: %s", e.StatusCode, e.Title, e.Message)
+}
+
+// IsCode checks if err is an API error with the given code
+func IsCode(err error, code string) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// IsStatus checks if err is an API error with the given HTTP status
+func IsStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
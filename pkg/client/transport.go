@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// refreshLeeway is how long before expiry access tokens are refreshed proactively
+const refreshLeeway = 30 * time.Second
+
+// TokenSource keeps the tokens of a signed-in user and refreshes them when they are about to expire
+// It is safe for concurrent use, concurrent callers share a single refresh
+type TokenSource struct {
+	client    *Client
+	mu        sync.Mutex
+	tokens    Tokens
+	expiresAt time.Time
+	onRefresh func(Tokens)
+	now       func() time.Time
+}
+
+// NewTokenSource creates a token source for tokens returned by Register, Login or Refresh
+// The client is used for refreshes and must not use a Transport of this source itself
+func (c *Client) NewTokenSource(tokens *Tokens) *TokenSource {
+	s := &TokenSource{client: c, now: time.Now}
+	s.set(*tokens)
+	return s
+}
+
+// OnRefresh sets a callback receiving rotated tokens, e.g. to persist the new refresh token
+func (s *TokenSource) OnRefresh(fn func(Tokens)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRefresh = fn
+}
+
+// Tokens returns the current tokens
+func (s *TokenSource) Tokens() Tokens {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens
+}
+
+// AccessToken returns a valid access token, refreshing the tokens if it expires soon
+func (s *TokenSource) AccessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens.AccessToken != "" && s.now().Add(refreshLeeway).Before(s.expiresAt) {
+		return s.tokens.AccessToken, nil
+	}
+	if err := s.refreshLocked(ctx); err != nil {
+		return "", err
+	}
+	return s.tokens.AccessToken, nil
+}
+
+// Refresh refreshes the tokens unconditionally
+func (s *TokenSource) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshLocked(ctx)
+}
+
+// refreshRejected refreshes the tokens after the access token was rejected by a server
+// If another request already refreshed them meanwhile, the current token is returned as is
+func (s *TokenSource) refreshRejected(ctx context.Context, rejected string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens.AccessToken != rejected {
+		return s.tokens.AccessToken, nil
+	}
+	if err := s.refreshLocked(ctx); err != nil {
+		return "", err
+	}
+	return s.tokens.AccessToken, nil
+}
+
+func (s *TokenSource) refreshLocked(ctx context.Context) error {
+	tokens, err := s.client.Refresh(ctx, s.tokens.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	s.set(*tokens)
+	if s.onRefresh != nil {
+		s.onRefresh(*tokens)
+	}
+	return nil
+}
+
+func (s *TokenSource) set(tokens Tokens) {
+	s.tokens = tokens
+	s.expiresAt = s.now().Add(time.Duration(tokens.ExpiresIn) * time.Second)
+}
+
+// Transport returns an http.RoundTripper authenticating requests with the access token of the source
+// Use it for calls to resource servers that accept tokens of this service
+func (s *TokenSource) Transport(base http.RoundTripper) *Transport {
+	return &Transport{Source: s, Base: base}
+}
+
+// Transport is an http.RoundTripper injecting access tokens into requests
+// A request rejected with 401 is retried once with refreshed tokens if its body can be replayed
+type Transport struct {
+	Source *TokenSource
+	// Base is the underlying transport, http.DefaultTransport if nil
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.AccessToken(req.Context())
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	resp, err := t.base().RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The body was consumed by the first attempt and can only be retried if it can be recreated
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	token, err = t.Source.refreshRejected(req.Context(), token)
+	if err != nil {
+		// Keep the original 401 response, the caller has to sign in again
+		return resp, nil
+	}
+
+	retry := authorize(req, token)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	resp.Body.Close()
+	return t.base().RoundTrip(retry)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// authorize clones the request with the Authorization header set, RoundTrippers must not modify requests
+func authorize(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+// RegisterRequest is the payload of Register
+type RegisterRequest struct {
+	Email    string  `json:"email"`
+	Username *string `json:"username,omitempty"`
+	Password string  `json:"password"`
+}
+
+// LoginRequest is the payload of Login
+type LoginRequest struct {
+	// Identifier is either an email or a username
+	Identifier string `json:"identifier"`
+	Password   string `json:"password"`
+}
+
+// UpdateProfileRequest is the payload of UpdateMe
+// Nil fields are left unchanged, empty strings clear the field
+type UpdateProfileRequest struct {
+	Username    *string `json:"username,omitempty"`
+	FirstName   *string `json:"first_name,omitempty"`
+	LastName    *string `json:"last_name,omitempty"`
+	DisplayName *string `json:"display_name,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	Locale      *string `json:"locale,omitempty"`
+}
+
+// Tokens are the tokens issued by Register, Login and Refresh
+// The refresh token is filled for both API versions, from the cookie in v1 and from the body in v2
+type Tokens struct {
+	AccessToken           string   `json:"access_token"`
+	TokenType             string   `json:"token_type"`
+	ExpiresIn             int      `json:"expires_in"`
+	RefreshToken          string   `json:"refresh_token"`
+	RefreshTokenExpiresIn int      `json:"refresh_token_expires_in"`
+	User                  UserInfo `json:"user"`
+}
+
+// UserInfo is the user summary returned with tokens
+type UserInfo struct {
+	ID       string  `json:"id"`
+	Email    string  `json:"email"`
+	Username *string `json:"username,omitempty"`
+}
+
+// User is the profile of the current user
+// PreviousLoginAt and PreviousLoginIP describe the login before the last one
+type User struct {
+	ID              string  `json:"id"`
+	Email           string  `json:"email"`
+	Username        *string `json:"username"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+	LastLoginAt     *string `json:"last_login_at"`
+	LastLoginIP     *string `json:"last_login_ip"`
+	PreviousLoginAt *string `json:"previous_login_at"`
+	PreviousLoginIP *string `json:"previous_login_ip"`
+	LoginCount      int     `json:"login_count"`
+	IsEmailVerified bool    `json:"is_email_verified"`
+	FirstName       *string `json:"first_name"`
+	LastName        *string `json:"last_name"`
+	DisplayName     *string `json:"display_name"`
+	AvatarURL       *string `json:"avatar_url"`
+	Locale          *string `json:"locale"`
+}
+
+// Session is an active session of the current user
+type Session struct {
+	ID         string  `json:"id"`
+	CreatedAt  string  `json:"created_at"`
+	ExpiresAt  string  `json:"expires_at"`
+	DeviceInfo *string `json:"device_info"`
+	IPAddress  *string `json:"ip_address"`
+}
+
+// UsernameAvailability is the result of UsernameAvailable
+type UsernameAvailability struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// LatestMigration returns the version of the last up migration in migrations,
+// named like golang-migrate's 000001_name.up.sql
+func LatestMigration(migrations fs.FS) (uint, error) {
+	names, err := fs.Glob(migrations, "*.up.sql")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var latest uint
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration name %s", name)
+		}
+		latest = max(latest, uint(version))
+	}
+	return latest, nil
+}
+
+// migrationVersion returns the version of the last applied migration from the golang-migrate
+// table, dirty is set when it failed halfway
+func migrationVersion(ctx context.Context, db *sql.DB) (version uint, dirty bool, err error) {
+	var v int64
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&v, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read migration version: %w", err)
+	}
+	return uint(v), dirty, nil
+}
+
+// MigrationVersion returns the version of the last applied migration
+func (p *Postgres) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	return migrationVersion(ctx, p.DB)
+}
+
+// MigrationVersion returns the version of the last applied migration
+func (s *SQLite) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	return migrationVersion(ctx, s.DB)
+}
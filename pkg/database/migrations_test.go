@@ -0,0 +1,34 @@
+package database
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prperemyshlev/auth-service-2/migrations"
+	sqlitemigrations "github.com/prperemyshlev/auth-service-2/migrations/sqlite"
+)
+
+func TestLatestMigration(t *testing.T) {
+	latest, err := LatestMigration(fstest.MapFS{
+		"000001_init.up.sql":      {},
+		"000001_init.down.sql":    {},
+		"000012_users.up.sql":     {},
+		"000012_users.down.sql":   {},
+		"000003_tokens.up.sql":    {},
+		"000013_pending.down.sql": {},
+	})
+	if err != nil || latest != 12 {
+		t.Errorf("Expected latest migration 12, got %d (%v)", latest, err)
+	}
+
+	if _, err := LatestMigration(fstest.MapFS{"init.up.sql": {}}); err == nil {
+		t.Error("Expected an error for a migration without version")
+	}
+
+	for name, migrations := range map[string]fs.FS{"postgres": migrations.FS, "sqlite": sqlitemigrations.FS} {
+		if latest, err := LatestMigration(migrations); err != nil || latest == 0 {
+			t.Errorf("Expected the %s migrations to have a version, got %d (%v)", name, latest, err)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Postgres represents a PostgreSQL database connection
@@ -14,13 +16,17 @@ type Postgres struct {
 }
 
 // NewPostgres creates a new PostgreSQL connection
+// Queries are traced with OpenTelemetry
 func NewPostgres(dsn string) (*Postgres, error) {
-	db, err := sql.Open("postgres", dsn)
+	db, err := otelsql.Open("postgres", dsn, otelsql.WithAttributes(
+		attribute.String("db.system", "postgresql"),
+	))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	if err := db.Ping(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
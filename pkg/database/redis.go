@@ -2,35 +2,121 @@ package database
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
 )
 
 // Redis represents a Redis client
 type Redis struct {
 	Client *redis.Client
+
+	// embedded is the in-process server of NewInMemoryRedis
+	embedded *miniredis.Miniredis
+}
+
+// RedisOption configures the client of NewRedis
+type RedisOption func(*redis.Options)
+
+// WithRetries retries commands failing with network errors up to maxRetries times, waiting
+// between minBackoff and maxBackoff. Broken connections are dropped from the pool and dialed
+// again on demand, so the client recovers by itself once Redis is back.
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) RedisOption {
+	return func(o *redis.Options) {
+		o.MaxRetries = maxRetries
+		if maxRetries == 0 {
+			// go-redis treats 0 as its default of 3 retries
+			o.MaxRetries = -1
+		}
+		o.MinRetryBackoff = minBackoff
+		o.MaxRetryBackoff = maxBackoff
+	}
+}
+
+// WithDialTimeout bounds the time to establish a connection
+func WithDialTimeout(timeout time.Duration) RedisOption {
+	return func(o *redis.Options) {
+		o.DialTimeout = timeout
+	}
+}
+
+// WithUsername authenticates as an ACL user (Redis 6+) rather than the default user
+func WithUsername(username string) RedisOption {
+	return func(o *redis.Options) {
+		o.Username = username
+	}
+}
+
+// WithTLS connects over TLS, the server name is taken from the address unless set in config
+func WithTLS(config *tls.Config) RedisOption {
+	return func(o *redis.Options) {
+		o.TLSConfig = config
+	}
 }
 
 // NewRedis creates a new Redis client
-func NewRedis(addr, password string, db int) (*Redis, error) {
-	client := redis.NewClient(&redis.Options{
+// Commands are traced with OpenTelemetry and failed commands are counted in redis_errors_total
+func NewRedis(addr, password string, db int, opts ...RedisOption) (*Redis, error) {
+	options := &redis.Options{
 		Addr:     addr,
 		Password: password,
 		DB:       db,
-	})
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	client := redis.NewClient(options)
+
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to instrument redis tracing: %w", err)
+	}
+	errorsHook, err := newRedisErrorsHook(otel.Meter("github.com/prperemyshlev/auth-service-2/pkg/database"))
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	client.AddHook(errorsHook)
 
 	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
 	return &Redis{Client: client}, nil
 }
 
-// Close closes the Redis connection
+// NewInMemoryRedis starts an in-process Redis emulation and connects to it
+// It is meant for local development without external dependencies, data is lost on Close
+func NewInMemoryRedis() (*Redis, error) {
+	server, err := miniredis.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start in-memory redis: %w", err)
+	}
+
+	r, err := NewRedis(server.Addr(), "", 0)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	r.embedded = server
+
+	return r, nil
+}
+
+// Close closes the Redis connection and stops the in-memory server, if any
 func (r *Redis) Close() error {
-	return r.Client.Close()
+	err := r.Client.Close()
+	if r.embedded != nil {
+		r.embedded.Close()
+	}
+	return err
 }
 
 // Ping checks if Redis is available
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// redisErrorsHook counts failed Redis commands by operation, exported as redis_errors_total
+// Missing keys and aborted transactions are expected outcomes and are not counted, neither are
+// the handshake commands go-redis sends on new connections, older servers reject them.
+type redisErrorsHook struct {
+	errors metric.Int64Counter
+}
+
+// newRedisErrorsHook creates the hook with a counter of meter
+func newRedisErrorsHook(meter metric.Meter) (*redisErrorsHook, error) {
+	counter, err := meter.Int64Counter("redis.errors",
+		metric.WithDescription("Number of failed Redis commands, by operation"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redis errors counter: %w", err)
+	}
+	return &redisErrorsHook{errors: counter}, nil
+}
+
+// DialHook counts failed connection attempts as the "dial" operation
+func (h *redisErrorsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.record(ctx, "dial", err)
+		}
+		return conn, err
+	}
+}
+
+// ProcessHook counts a failed command
+func (h *redisErrorsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		h.record(ctx, cmd.Name(), err)
+		return err
+	}
+}
+
+// ProcessPipelineHook counts every failed command of a pipeline or transaction
+func (h *redisErrorsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			h.record(ctx, cmd.Name(), cmd.Err())
+		}
+		return err
+	}
+}
+
+// handshakeCommands are sent by go-redis when connecting, their errors are ignored by the client
+var handshakeCommands = map[string]bool{"hello": true, "client": true}
+
+func (h *redisErrorsHook) record(ctx context.Context, operation string, err error) {
+	if err == nil || handshakeCommands[operation] || errors.Is(err, redis.Nil) || errors.Is(err, redis.TxFailedErr) || errors.Is(err, context.Canceled) {
+		return
+	}
+	h.errors.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(attribute.String("operation", operation)))
+}
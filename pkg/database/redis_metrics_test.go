@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRedisErrorsHook(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	reader := sdkmetric.NewManualReader()
+	hook, err := newRedisErrorsHook(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	if err != nil {
+		t.Fatalf("Failed to create hook: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	client.AddHook(hook)
+
+	// Missing keys are not errors
+	if err := client.Get(ctx, "missing").Err(); err != redis.Nil {
+		t.Fatalf("Expected redis.Nil, got %v", err)
+	}
+
+	server.SetError("LOADING Redis is loading the dataset in memory")
+	_ = client.Get(ctx, "key").Err()
+	pipe := client.Pipeline()
+	pipe.Incr(ctx, "counter")
+	pipe.Expire(ctx, "counter", 0)
+	_, _ = pipe.Exec(ctx)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+
+	got := map[string]int64{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != "redis.errors" {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				operation, _ := point.Attributes.Value(attribute.Key("operation"))
+				got[operation.AsString()] += point.Value
+			}
+		}
+	}
+
+	want := map[string]int64{"get": 1, "incr": 1, "expire": 1}
+	if len(got) != len(want) {
+		t.Fatalf("Expected errors %v, got %v", want, got)
+	}
+	for operation, count := range want {
+		if got[operation] != count {
+			t.Errorf("Expected %d errors of %s, got %d", count, operation, got[operation])
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy configures connection attempts on startup, so that the service can start before
+// its dependencies are up. Delays start at InitialBackoff and double up to MaxBackoff until
+// MaxWait has passed, a zero MaxWait attempts once.
+type RetryPolicy struct {
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	MaxWait        time.Duration
+	// OnRetry is called with the failed attempt before waiting for the next one, it may be nil
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// ConnectWithRetry calls connect until it succeeds, MaxWait has passed or ctx is done
+func ConnectWithRetry[T any](ctx context.Context, policy RetryPolicy, connect func() (T, error)) (T, error) {
+	deadline := time.Now().Add(policy.MaxWait)
+	delay := policy.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		conn, err := connect()
+		if err == nil {
+			return conn, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if attempt > 1 {
+				return conn, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return conn, err
+		}
+		delay = min(delay, remaining)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return conn, fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		}
+		delay = min(delay*2, policy.MaxBackoff)
+	}
+}
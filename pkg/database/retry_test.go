@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnectWithRetry(t *testing.T) {
+	errDown := errors.New("connection refused")
+
+	t.Run("succeeds once the dependency is up", func(t *testing.T) {
+		var delays []time.Duration
+		policy := RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     3 * time.Millisecond,
+			MaxWait:        time.Minute,
+			OnRetry:        func(_ int, delay time.Duration, _ error) { delays = append(delays, delay) },
+		}
+
+		attempts := 0
+		conn, err := ConnectWithRetry(context.Background(), policy, func() (string, error) {
+			if attempts++; attempts < 4 {
+				return "", errDown
+			}
+			return "conn", nil
+		})
+		if err != nil || conn != "conn" {
+			t.Fatalf("Expected a connection, got %q, %v", conn, err)
+		}
+		want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}
+		if len(delays) != len(want) {
+			t.Fatalf("Expected delays %v, got %v", want, delays)
+		}
+		for i := range want {
+			if delays[i] != want[i] {
+				t.Errorf("Expected delays %v, got %v", want, delays)
+			}
+		}
+	})
+
+	t.Run("gives up after max wait", func(t *testing.T) {
+		policy := RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, MaxWait: 20 * time.Millisecond}
+		_, err := ConnectWithRetry(context.Background(), policy, func() (string, error) { return "", errDown })
+		if !errors.Is(err, errDown) {
+			t.Errorf("Expected the last error, got %v", err)
+		}
+	})
+
+	t.Run("attempts once without max wait", func(t *testing.T) {
+		attempts := 0
+		_, err := ConnectWithRetry(context.Background(), RetryPolicy{}, func() (string, error) {
+			attempts++
+			return "", errDown
+		})
+		if !errors.Is(err, errDown) || attempts != 1 {
+			t.Errorf("Expected a single failed attempt, got %d: %v", attempts, err)
+		}
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := RetryPolicy{InitialBackoff: time.Hour, MaxBackoff: time.Hour, MaxWait: time.Hour, OnRetry: func(int, time.Duration, error) { cancel() }}
+		_, err := ConnectWithRetry(ctx, policy, func() (string, error) { return "", errDown })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
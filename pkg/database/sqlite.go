@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrSQLiteUnsupported is returned when the binary is built without the sqlite build tag
+var ErrSQLiteUnsupported = errors.New("sqlite support is not compiled in, build with -tags sqlite")
+
+// SQLite represents an SQLite database connection
+type SQLite struct {
+	DB *sql.DB
+}
+
+// NewSQLite opens the SQLite database file at path, creating it if needed
+// A single connection is used, so writes never fail with "database is locked"
+// Queries are traced with OpenTelemetry
+func NewSQLite(path string) (*SQLite, error) {
+	if !slices.Contains(sql.Drivers(), sqliteDriver) {
+		return nil, ErrSQLiteUnsupported
+	}
+
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL", path)
+	db, err := otelsql.Open(sqliteDriver, dsn, otelsql.WithAttributes(
+		attribute.String("db.system", "sqlite"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &SQLite{DB: db}, nil
+}
+
+// Migrate applies the pending up migrations found in migrations
+func (s *SQLite) Migrate(migrations fs.FS) error {
+	return migrateSQLite(s.DB, migrations)
+}
+
+// Close closes the database connection
+func (s *SQLite) Close() error {
+	return s.DB.Close()
+}
+
+// Ping checks if the database is available
+func (s *SQLite) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
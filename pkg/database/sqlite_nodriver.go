@@ -0,0 +1,15 @@
+//go:build !sqlite
+
+package database
+
+import (
+	"database/sql"
+	"io/fs"
+)
+
+// sqliteDriver is never registered without the sqlite build tag
+const sqliteDriver = "sqlite3"
+
+func migrateSQLite(db *sql.DB, migrations fs.FS) error {
+	return ErrSQLiteUnsupported
+}
@@ -0,0 +1,120 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// ErrDatabaseNotFound is returned when the GeoIP database file does not exist
+var ErrDatabaseNotFound = errors.New("geoip database not found")
+
+// Location represents a resolved location of an IP address
+type Location struct {
+	CountryCode string `json:"country_code"`
+	Country     string `json:"country"`
+	City        string `json:"city,omitempty"`
+}
+
+// String returns a human-readable location, e.g. "Berlin, Germany"
+func (l Location) String() string {
+	parts := make([]string, 0, 2)
+	if l.City != "" {
+		parts = append(parts, l.City)
+	}
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Locator resolves IP addresses to locations
+type Locator interface {
+	// Lookup returns the location of the IP address, or nil if it is unknown
+	Lookup(ip string) (*Location, error)
+	Close() error
+}
+
+// Open opens a MaxMind GeoIP2/GeoLite2 City or Country database
+func Open(path string) (Locator, error) {
+	if path == "" {
+		return nil, ErrDatabaseNotFound
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, path)
+		}
+		return nil, fmt.Errorf("failed to stat geoip database: %w", err)
+	}
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+
+	return &maxMindLocator{reader: reader}, nil
+}
+
+// Noop returns a locator that never resolves locations
+func Noop() Locator {
+	return noopLocator{}
+}
+
+// maxMindLocator implements Locator on top of a MaxMind database
+type maxMindLocator struct {
+	reader *maxminddb.Reader
+}
+
+type maxMindRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Lookup resolves the IP address using the MaxMind database
+func (l *maxMindLocator) Lookup(ip string) (*Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid ip address: %s", ip)
+	}
+
+	var record maxMindRecord
+	if err := l.reader.Lookup(parsed, &record); err != nil {
+		return nil, fmt.Errorf("failed to lookup ip address: %w", err)
+	}
+
+	if record.Country.ISOCode == "" {
+		return nil, nil
+	}
+
+	return &Location{
+		CountryCode: record.Country.ISOCode,
+		Country:     record.Country.Names["en"],
+		City:        record.City.Names["en"],
+	}, nil
+}
+
+// Close closes the MaxMind database
+func (l *maxMindLocator) Close() error {
+	return l.reader.Close()
+}
+
+// noopLocator is used when GeoIP is disabled or the database is absent
+type noopLocator struct{}
+
+func (noopLocator) Lookup(string) (*Location, error) {
+	return nil, nil
+}
+
+func (noopLocator) Close() error {
+	return nil
+}
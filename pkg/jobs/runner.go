@@ -0,0 +1,353 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	queueKey      = "jobs:queue"
+	retryKey      = "jobs:retry"
+	deadLetterKey = "jobs:dead"
+
+	// dequeueTimeout bounds blocking pops, so workers notice shutdown
+	dequeueTimeout = time.Second
+	// retryBatchSize limits how many due retries are moved per poll
+	retryBatchSize = 100
+)
+
+// promoteRetriesScript atomically moves due jobs from the retry set back to the queue
+//
+// KEYS[1] - retry sorted set
+// KEYS[2] - queue list
+// ARGV[1] - current time in milliseconds
+// ARGV[2] - batch size
+var promoteRetriesScript = redis.NewScript(`
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, job in ipairs(jobs) do
+	redis.call('ZREM', KEYS[1], job)
+	redis.call('LPUSH', KEYS[2], job)
+end
+return #jobs
+`)
+
+// Job is a unit of background work stored in Redis
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempt    int             `json:"attempt"`
+	LastError  string          `json:"last_error,omitempty"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+}
+
+// Handler processes the payload of a job
+// Returning an error schedules a retry unless the error is permanent
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Config configures the job runner
+type Config struct {
+	Workers     int
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubled on every attempt up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	PollInterval    time.Duration
+	JobTimeout      time.Duration
+	// DeadLetterLimit caps the number of jobs kept in the dead-letter list
+	DeadLetterLimit int64
+}
+
+// DefaultConfig returns the default runner configuration
+func DefaultConfig() Config {
+	return Config{
+		Workers:         4,
+		MaxAttempts:     5,
+		RetryBackoff:    10 * time.Second,
+		MaxRetryBackoff: 10 * time.Minute,
+		PollInterval:    time.Second,
+		JobTimeout:      30 * time.Second,
+		DeadLetterLimit: 1000,
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as non-retryable, the job is moved to the dead-letter list immediately
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent checks if an error was marked as non-retryable
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Runner executes jobs from a Redis-backed queue with retries and a dead-letter list
+// Jobs survive restarts and are shared between all replicas
+type Runner struct {
+	redis    *database.Redis
+	logger   *zap.Logger
+	cfg      Config
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewRunner creates a new job runner
+func NewRunner(redis *database.Redis, logger *zap.Logger, cfg Config) *Runner {
+	defaults := DefaultConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaults.RetryBackoff
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = defaults.MaxRetryBackoff
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = defaults.JobTimeout
+	}
+	if cfg.DeadLetterLimit <= 0 {
+		cfg.DeadLetterLimit = defaults.DeadLetterLimit
+	}
+
+	return &Runner{
+		redis:    redis,
+		logger:   logger,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for a job type
+func (r *Runner) Register(jobType string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[jobType] = handler
+}
+
+// Enqueue adds a job to the queue
+func (r *Runner) Enqueue(ctx context.Context, jobType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+
+	job := &Job{
+		ID:         uuid.New().String(),
+		Type:       jobType,
+		Payload:    data,
+		EnqueuedAt: time.Now(),
+	}
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	if err := r.redis.Client.LPush(ctx, queueKey, encoded).Err(); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return nil
+}
+
+// Run processes jobs until ctx is cancelled
+// Jobs in progress are allowed to finish before Run returns
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.promoteRetries(ctx)
+	}()
+
+	for i := 0; i < r.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// DeadLetters returns the most recent jobs that exhausted their attempts
+func (r *Runner) DeadLetters(ctx context.Context, limit int64) ([]*Job, error) {
+	items, err := r.redis.Client.LRange(ctx, deadLetterKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(items))
+	for _, item := range items {
+		var job Job
+		if err := json.Unmarshal([]byte(item), &job); err != nil {
+			return nil, fmt.Errorf("failed to decode dead letter: %w", err)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
+
+// work pops and processes jobs until ctx is cancelled
+func (r *Runner) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		result, err := r.redis.Client.BRPop(ctx, dequeueTimeout, queueKey).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				r.logger.Error("Failed to dequeue job", zap.Error(err))
+				sleep(ctx, r.cfg.PollInterval)
+			}
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal([]byte(result[1]), &job); err != nil {
+			r.logger.Error("Failed to decode job, dropping it", zap.Error(err))
+			continue
+		}
+
+		// Jobs taken from the queue are finished even if shutdown was requested meanwhile
+		jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.JobTimeout)
+		r.process(jobCtx, &job)
+		cancel()
+	}
+}
+
+// process runs a job and schedules a retry or moves it to the dead-letter list on failure
+func (r *Runner) process(ctx context.Context, job *Job) {
+	r.mu.RLock()
+	handler, ok := r.handlers[job.Type]
+	r.mu.RUnlock()
+
+	var err error
+	if ok {
+		err = handler(ctx, job.Payload)
+	} else {
+		err = Permanent(fmt.Errorf("no handler registered for job type %s", job.Type))
+	}
+
+	if err == nil {
+		return
+	}
+
+	job.Attempt++
+	job.LastError = err.Error()
+
+	if IsPermanent(err) || job.Attempt >= r.cfg.MaxAttempts {
+		r.deadLetter(ctx, job)
+		return
+	}
+
+	r.logger.Warn("Job failed, scheduling retry",
+		zap.String("job_id", job.ID),
+		zap.String("job_type", job.Type),
+		zap.Int("attempt", job.Attempt),
+		zap.Error(err),
+	)
+
+	encoded, marshalErr := json.Marshal(job)
+	if marshalErr != nil {
+		r.logger.Error("Failed to encode job for retry", zap.String("job_id", job.ID), zap.Error(marshalErr))
+		return
+	}
+
+	retryAt := time.Now().Add(r.backoff(job.Attempt))
+	if err := r.redis.Client.ZAdd(ctx, retryKey, redis.Z{Score: float64(retryAt.UnixMilli()), Member: encoded}).Err(); err != nil {
+		r.logger.Error("Failed to schedule job retry", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// deadLetter records a job that will not be retried
+func (r *Runner) deadLetter(ctx context.Context, job *Job) {
+	r.logger.Error("Job moved to dead-letter list",
+		zap.String("job_id", job.ID),
+		zap.String("job_type", job.Type),
+		zap.Int("attempts", job.Attempt),
+		zap.String("error", job.LastError),
+	)
+
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		r.logger.Error("Failed to encode dead letter", zap.String("job_id", job.ID), zap.Error(err))
+		return
+	}
+
+	pipe := r.redis.Client.TxPipeline()
+	pipe.LPush(ctx, deadLetterKey, encoded)
+	pipe.LTrim(ctx, deadLetterKey, 0, r.cfg.DeadLetterLimit-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logger.Error("Failed to store dead letter", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// promoteRetries periodically moves due retries back to the queue
+func (r *Runner) promoteRetries(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := promoteRetriesScript.Run(ctx, r.redis.Client,
+			[]string{retryKey, queueKey},
+			time.Now().UnixMilli(),
+			retryBatchSize,
+		).Err()
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("Failed to promote job retries", zap.Error(err))
+		}
+	}
+}
+
+// backoff returns the delay before the given retry attempt
+func (r *Runner) backoff(attempt int) time.Duration {
+	delay := r.cfg.RetryBackoff
+	for i := 1; i < attempt && delay < r.cfg.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.cfg.MaxRetryBackoff)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+func newTestRunner(t *testing.T, cfg Config) *Runner {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewRunner(&database.Redis{Client: client}, zap.NewNop(), cfg)
+}
+
+// runUntil runs the runner until cond is met or the timeout expires
+func runUntil(t *testing.T, runner *Runner, cond func() bool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			cancel()
+			<-done
+			t.Fatal("Timed out waiting for jobs to be processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestRunnerProcessesJobs(t *testing.T) {
+	runner := newTestRunner(t, Config{Workers: 2})
+	ctx := context.Background()
+
+	var sum atomic.Int64
+	runner.Register("add", func(ctx context.Context, payload json.RawMessage) error {
+		var n int64
+		if err := json.Unmarshal(payload, &n); err != nil {
+			return err
+		}
+		sum.Add(n)
+		return nil
+	})
+
+	for i := 1; i <= 10; i++ {
+		if err := runner.Enqueue(ctx, "add", i); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	runUntil(t, runner, func() bool { return sum.Load() == 55 })
+}
+
+func TestRunnerRetriesFailedJobs(t *testing.T) {
+	runner := newTestRunner(t, Config{
+		Workers:      1,
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	var attempts atomic.Int64
+	runner.Register("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	if err := runner.Enqueue(context.Background(), "flaky", nil); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	runUntil(t, runner, func() bool { return attempts.Load() == 3 })
+
+	deadLetters, err := runner.DeadLetters(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Failed to list dead letters: %v", err)
+	}
+	if len(deadLetters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(deadLetters))
+	}
+}
+
+func TestRunnerDeadLetters(t *testing.T) {
+	runner := newTestRunner(t, Config{
+		Workers:      1,
+		MaxAttempts:  2,
+		RetryBackoff: time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	runner.Register("failing", func(ctx context.Context, payload json.RawMessage) error {
+		return errors.New("always fails")
+	})
+	runner.Register("invalid", func(ctx context.Context, payload json.RawMessage) error {
+		return Permanent(errors.New("invalid payload"))
+	})
+
+	for _, jobType := range []string{"failing", "invalid", "unknown"} {
+		if err := runner.Enqueue(ctx, jobType, nil); err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+	}
+
+	runUntil(t, runner, func() bool {
+		deadLetters, err := runner.DeadLetters(ctx, 10)
+		return err == nil && len(deadLetters) == 3
+	})
+
+	deadLetters, _ := runner.DeadLetters(ctx, 10)
+	attempts := make(map[string]int)
+	for _, job := range deadLetters {
+		attempts[job.Type] = job.Attempt
+		if job.LastError == "" {
+			t.Errorf("Expected dead letter %s to record the last error", job.Type)
+		}
+	}
+
+	expected := map[string]int{"failing": 2, "invalid": 1, "unknown": 1}
+	for jobType, want := range expected {
+		if attempts[jobType] != want {
+			t.Errorf("Expected %s to be dead-lettered after %d attempts, got %d", jobType, want, attempts[jobType])
+		}
+	}
+}
+
+func TestRunnerBackoff(t *testing.T) {
+	runner := NewRunner(nil, zap.NewNop(), Config{RetryBackoff: time.Second, MaxRetryBackoff: 5 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := runner.backoff(i + 1); got != want {
+			t.Errorf("Expected backoff for attempt %d to be %v, got %v", i+1, want, got)
+		}
+	}
+}
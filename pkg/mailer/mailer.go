@@ -0,0 +1,79 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Supported mail providers
+const (
+	ProviderNone     = "none"
+	ProviderSMTP     = "smtp"
+	ProviderSES      = "ses"
+	ProviderSendGrid = "sendgrid"
+)
+
+// ErrRejected is returned when the provider permanently rejects a message,
+// e.g. because of an invalid recipient, so retrying makes no sense
+var ErrRejected = errors.New("message rejected by mail provider")
+
+// Message is an email with plain text and HTML bodies
+type Message struct {
+	// From overrides the configured sender when set, e.g. with the sender of a tenant.
+	// Messages are still submitted as the configured sender.
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Pinger is implemented by mailers that can check that their provider is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type noopMailer struct{}
+
+// Noop returns a mailer that discards all messages
+func Noop() Mailer {
+	return noopMailer{}
+}
+
+func (noopMailer) Send(context.Context, *Message) error {
+	return nil
+}
+
+// Config selects and configures a mail provider
+type Config struct {
+	Provider       string
+	From           string
+	SMTP           SMTPConfig
+	SESRegion      string
+	SendGridAPIKey string
+}
+
+// New creates a mailer for the configured provider
+// SES uses the SMTP credentials from cfg.SMTP
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Provider {
+	case "", ProviderNone:
+		return Noop(), nil
+	case ProviderSMTP:
+		smtpCfg := cfg.SMTP
+		smtpCfg.From = cfg.From
+		return NewSMTP(smtpCfg)
+	case ProviderSES:
+		return NewSES(cfg.SESRegion, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	case ProviderSendGrid:
+		return NewSendGrid(cfg.SendGridAPIKey, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mail provider: %s", cfg.Provider)
+	}
+}
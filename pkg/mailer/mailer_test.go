@@ -0,0 +1,164 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuildMIME(t *testing.T) {
+	data, err := buildMIME("noreply@example.com", &Message{
+		To:      "user@example.com",
+		Subject: "Подтверждение email",
+		Text:    "Plain body",
+		HTML:    "<p>HTML body</p>",
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || decoded != "Подтверждение email" {
+		t.Errorf("Expected encoded subject to round-trip, got %q (err=%v)", decoded, err)
+	}
+	if msg.Header.Get("To") != "user@example.com" {
+		t.Errorf("Expected To header, got %q", msg.Header.Get("To"))
+	}
+
+	body, _ := io.ReadAll(msg.Body)
+	for _, part := range []string{"text/plain", "text/html", "Plain body", "<p>HTML body</p>"} {
+		if !strings.Contains(string(body), part) {
+			t.Errorf("Expected body to contain %q", part)
+		}
+	}
+}
+
+func TestBuildMIMERejectsHeaderInjection(t *testing.T) {
+	_, err := buildMIME("noreply@example.com", &Message{To: "user@example.com\r\nBcc: victim@example.com"})
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected, got %v", err)
+	}
+}
+
+func TestBuildMIMESenderOverride(t *testing.T) {
+	data, err := buildMIME("noreply@example.com", &Message{From: "Acme <hello@acme.test>", To: "user@example.com", Text: "Body"})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if from, err := msg.Header.AddressList("From"); err != nil || from[0].Address != "hello@acme.test" || from[0].Name != "Acme" {
+		t.Errorf("Expected the sender of the message, got %v (err=%v)", from, err)
+	}
+
+	if _, err := buildMIME("noreply@example.com", &Message{From: "not an address", To: "user@example.com"}); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected for an invalid sender, got %v", err)
+	}
+}
+
+func TestSendGrid(t *testing.T) {
+	var received sendGridRequest
+	status := http.StatusAccepted
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("Expected bearer API key, got %q", r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	m, err := NewSendGrid("test-key", "noreply@example.com")
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+	m.(*sendGridMailer).endpoint = server.URL
+
+	msg := &Message{To: "user@example.com", Subject: "Hi", Text: "text", HTML: "<p>html</p>"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if received.Personalizations[0].To[0].Email != "user@example.com" || len(received.Content) != 2 || received.Content[0].Type != "text/plain" {
+		t.Errorf("Unexpected request payload: %+v", received)
+	}
+
+	status = http.StatusBadRequest
+	if err := m.Send(context.Background(), msg); !errors.Is(err, ErrRejected) {
+		t.Errorf("Expected ErrRejected for 400, got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := m.Send(context.Background(), msg); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("Expected retryable error for 503, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{Provider: "carrier-pigeon"}); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+	if _, err := New(Config{Provider: ProviderSMTP, From: "noreply@example.com"}); err == nil {
+		t.Error("Expected error for missing smtp host")
+	}
+	if _, err := New(Config{Provider: ProviderSES, SESRegion: "eu-west-1", From: "noreply@example.com"}); err != nil {
+		t.Errorf("Expected SES mailer, got %v", err)
+	}
+}
+
+func TestSMTPPing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			_, _ = conn.Write([]byte("220 localhost ESMTP\r\n"))
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil || strings.HasPrefix(line, "QUIT") {
+					_, _ = conn.Write([]byte("221 Bye\r\n"))
+					break
+				}
+				_, _ = conn.Write([]byte("250 localhost\r\n"))
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	m, err := NewSMTP(SMTPConfig{Host: host, Port: port, From: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+	if err := m.(Pinger).Ping(context.Background()); err != nil {
+		t.Errorf("Expected ping to succeed, got %v", err)
+	}
+
+	_ = listener.Close()
+	if err := m.(Pinger).Ping(context.Background()); err == nil {
+		t.Error("Expected ping to fail once the server is down")
+	}
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"time"
+)
+
+const (
+	sendGridEndpoint = "https://api.sendgrid.com/v3/mail/send"
+	sendGridTimeout  = 10 * time.Second
+)
+
+type sendGridMailer struct {
+	apiKey   string
+	from     string
+	endpoint string
+	client   *http.Client
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridRequest struct {
+	Personalizations []struct {
+		To []sendGridAddress `json:"to"`
+	} `json:"personalizations"`
+	From    sendGridAddress   `json:"from"`
+	Subject string            `json:"subject"`
+	Content []sendGridContent `json:"content"`
+}
+
+// NewSendGrid creates a mailer that delivers messages through the SendGrid v3 API
+func NewSendGrid(apiKey, from string) (Mailer, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("sendgrid api key is required")
+	}
+	if from == "" {
+		return nil, fmt.Errorf("sender address is required")
+	}
+
+	return &sendGridMailer{
+		apiKey:   apiKey,
+		from:     from,
+		endpoint: sendGridEndpoint,
+		client:   &http.Client{Timeout: sendGridTimeout},
+	}, nil
+}
+
+// Send delivers the message
+func (m *sendGridMailer) Send(ctx context.Context, msg *Message) error {
+	payload := sendGridRequest{
+		From:    sendGridAddress{Email: m.from},
+		Subject: msg.Subject,
+	}
+	if msg.From != "" {
+		address, err := mail.ParseAddress(msg.From)
+		if err != nil {
+			return fmt.Errorf("%w: invalid sender: %v", ErrRejected, err)
+		}
+		payload.From = sendGridAddress{Email: address.Address, Name: address.Name}
+	}
+	payload.Personalizations = make([]struct {
+		To []sendGridAddress `json:"to"`
+	}, 1)
+	payload.Personalizations[0].To = []sendGridAddress{{Email: msg.To}}
+
+	// SendGrid requires text/plain to precede text/html
+	if msg.Text != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/plain", Value: msg.Text})
+	}
+	if msg.HTML != "" {
+		payload.Content = append(payload.Content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sendgrid request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create sendgrid request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call sendgrid: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	details, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: sendgrid returned status %d: %s", ErrRejected, resp.StatusCode, details)
+	}
+	return fmt.Errorf("sendgrid returned status %d: %s", resp.StatusCode, details)
+}
@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPConfig configures the SMTP mailer
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// sesSMTPHost is the Amazon SES SMTP interface endpoint for a region
+const sesSMTPHost = "email-smtp.%s.amazonaws.com"
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+// NewSMTP creates a mailer that delivers messages through an SMTP server
+// STARTTLS is used when the server supports it
+func NewSMTP(cfg SMTPConfig) (Mailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("smtp host is required")
+	}
+	if cfg.From == "" {
+		return nil, fmt.Errorf("sender address is required")
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+
+	return &smtpMailer{cfg: cfg}, nil
+}
+
+// NewSES creates a mailer that delivers messages through the Amazon SES SMTP interface
+// username and password are SES SMTP credentials, not IAM access keys
+func NewSES(region, username, password, from string) (Mailer, error) {
+	if region == "" {
+		return nil, fmt.Errorf("ses region is required")
+	}
+
+	return NewSMTP(SMTPConfig{
+		Host:     fmt.Sprintf(sesSMTPHost, region),
+		Port:     "587",
+		Username: username,
+		Password: password,
+		From:     from,
+	})
+}
+
+// Send delivers the message
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	body, err := buildMIME(m.cfg.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	// net/smtp doesn't support contexts, so run it in the background and stop waiting on cancellation
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(net.JoinHostPort(m.cfg.Host, m.cfg.Port), auth, m.cfg.From, []string{msg.To}, body)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		if err == nil {
+			return nil
+		}
+		// 5xx replies are permanent failures
+		if tpErr, ok := err.(*textproto.Error); ok && tpErr.Code >= 500 {
+			return fmt.Errorf("%w: %v", ErrRejected, err)
+		}
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+}
+
+// Ping connects to the SMTP server and waits for its greeting
+func (m *smtpMailer) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.cfg.Host, m.cfg.Port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMIME renders a multipart/alternative message with text and HTML parts
+// The sender of the message overrides from
+func buildMIME(from string, msg *Message) ([]byte, error) {
+	if msg.From != "" {
+		address, err := mail.ParseAddress(msg.From)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid sender: %v", ErrRejected, err)
+		}
+		from = address.String()
+	}
+	// Addresses end up in headers verbatim, so line breaks would allow header injection
+	if strings.ContainsAny(from+msg.To, "\r\n") {
+		return nil, fmt.Errorf("%w: invalid address", ErrRejected)
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	headers := []struct{ key, value string }{
+		{"From", from},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", uuid.New().String(), domainOf(from))},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", writer.Boundary())},
+	}
+
+	var header bytes.Buffer
+	for _, h := range headers {
+		fmt.Fprintf(&header, "%s: %s\r\n", h.key, h.value)
+	}
+	header.WriteString("\r\n")
+
+	parts := []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create mime part: %w", err)
+		}
+
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, fmt.Errorf("failed to write mime part: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to write mime part: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish mime message: %w", err)
+	}
+
+	return append(header.Bytes(), buf.Bytes()...), nil
+}
+
+func domainOf(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.TrimSuffix(address[at+1:], ">")
+	}
+	return "localhost"
+}
@@ -0,0 +1,272 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// Audit sinks
+const (
+	AuditSinkNone   = "none"
+	AuditSinkSyslog = "syslog"
+	AuditSinkHTTP   = "http"
+)
+
+// Audit event formats of the syslog sink
+const (
+	AuditFormatCEF  = "cef"
+	AuditFormatLEEF = "leef"
+)
+
+// Audit event outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+const (
+	auditSendAttempts   = 3
+	auditRetryBackoff   = 500 * time.Millisecond
+	auditFlushTimeout   = 5 * time.Second
+	defaultAuditBuffer  = 10000
+	defaultAuditBatch   = 100
+	defaultAuditFlushIn = time.Second
+)
+
+// AuditEvent is a security event exported to a SIEM
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	// Type identifies the kind of event, e.g. "login.failure"
+	Type string `json:"type"`
+	// Name is a human-readable description of the type
+	Name string `json:"name"`
+	// Severity ranges from 0 (lowest) to 10 (highest) as in CEF
+	Severity int    `json:"severity"`
+	Outcome  string `json:"outcome"`
+	UserID   string `json:"user_id,omitempty"`
+	// User is the (masked) identifier the client used, for events without a known user
+	User      string `json:"user,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// Location of the IP address, e.g. "Berlin, Germany", when GeoIP is enabled
+	Location  string `json:"location,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	// Actor is who performed an administrative action on the user, e.g. "admin" or the SPIFFE ID of a peer
+	Actor string `json:"actor,omitempty"`
+}
+
+// Auditor records security events
+// Implementations must not block the caller.
+type Auditor interface {
+	Audit(ctx context.Context, event AuditEvent)
+}
+
+// NopAuditor discards events, it is used when no audit sink is configured
+type NopAuditor struct{}
+
+// Audit discards the event
+func (NopAuditor) Audit(context.Context, AuditEvent) {}
+
+// AuditSink ships batches of events to a SIEM
+type AuditSink interface {
+	Send(ctx context.Context, events []AuditEvent) error
+	Close() error
+}
+
+// AuditConfig configures the audit export pipeline
+type AuditConfig struct {
+	// Sink is one of the AuditSink* constants
+	Sink string
+	// Format is one of the AuditFormat* constants, used by the syslog sink
+	Format string
+	// SyslogNetwork is udp or tcp, SyslogAddress is host:port of the collector
+	SyslogNetwork string
+	SyslogAddress string
+	// HTTPURL receives batches as JSON arrays, HTTPToken is sent as bearer token when set
+	HTTPURL   string
+	HTTPToken string
+	// BufferSize bounds the number of queued events, further events are dropped
+	BufferSize int
+	// BatchSize and FlushInterval bound how many events are sent at once and how long they wait
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// AuditExporter buffers events and ships them to a sink in the background
+// Audit never blocks: when the sink can't keep up and the buffer is full, events are dropped
+// and counted in the audit.events.dropped metric instead of slowing down requests.
+// Failed batches are retried a few times before they are given up.
+type AuditExporter struct {
+	sink          AuditSink
+	queue         chan AuditEvent
+	batchSize     int
+	flushInterval time.Duration
+	logger        *zap.Logger
+	// droppedSince counts events dropped since the last warning
+	droppedSince atomic.Int64
+
+	exported metric.Int64Counter
+	dropped  metric.Int64Counter
+	failed   metric.Int64Counter
+}
+
+// NewAuditExporter creates an exporter shipping to the sink of cfg, Run must be called to start it
+func NewAuditExporter(cfg AuditConfig, logger *zap.Logger) (*AuditExporter, error) {
+	var sink AuditSink
+	switch cfg.Sink {
+	case AuditSinkSyslog:
+		var err error
+		if sink, err = NewSyslogAuditSink(cfg.SyslogNetwork, cfg.SyslogAddress, cfg.Format); err != nil {
+			return nil, err
+		}
+	case AuditSinkHTTP:
+		sink = NewHTTPAuditSink(cfg.HTTPURL, cfg.HTTPToken, nil)
+	default:
+		return nil, fmt.Errorf("unsupported audit sink: %s", cfg.Sink)
+	}
+	return NewAuditExporterWithSink(sink, cfg, logger)
+}
+
+// NewAuditExporterWithSink creates an exporter shipping to a custom sink
+func NewAuditExporterWithSink(sink AuditSink, cfg AuditConfig, logger *zap.Logger) (*AuditExporter, error) {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultAuditBuffer
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultAuditBatch
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultAuditFlushIn
+	}
+
+	e := &AuditExporter{
+		sink:          sink,
+		queue:         make(chan AuditEvent, cfg.BufferSize),
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		logger:        logger,
+	}
+
+	meter := otel.Meter("github.com/prperemyshlev/auth-service-2/pkg/observability")
+	var err error
+	if e.exported, err = meter.Int64Counter("audit.events.exported",
+		metric.WithDescription("Audit events shipped to the SIEM")); err != nil {
+		return nil, fmt.Errorf("failed to create audit metrics: %w", err)
+	}
+	if e.dropped, err = meter.Int64Counter("audit.events.dropped",
+		metric.WithDescription("Audit events dropped because the buffer was full")); err != nil {
+		return nil, fmt.Errorf("failed to create audit metrics: %w", err)
+	}
+	if e.failed, err = meter.Int64Counter("audit.events.failed",
+		metric.WithDescription("Audit events given up after failed deliveries")); err != nil {
+		return nil, fmt.Errorf("failed to create audit metrics: %w", err)
+	}
+
+	return e, nil
+}
+
+// Audit queues an event, filling in its time and the request ID of ctx
+func (e *AuditExporter) Audit(ctx context.Context, event AuditEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.RequestID == "" {
+		event.RequestID = RequestIDFromContext(ctx)
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		e.droppedSince.Add(1)
+		e.dropped.Add(ctx, 1)
+	}
+}
+
+// Run ships queued events until ctx is done, then flushes what is left and closes the sink
+func (e *AuditExporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AuditEvent, 0, e.batchSize)
+	for {
+		select {
+		case event := <-e.queue:
+			batch = append(batch, event)
+			if len(batch) >= e.batchSize {
+				e.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.flush(ctx, batch)
+				batch = batch[:0]
+			}
+		case <-ctx.Done():
+			e.shutdown(batch)
+			return
+		}
+	}
+}
+
+// shutdown ships the remaining events within auditFlushTimeout
+func (e *AuditExporter) shutdown(batch []AuditEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditFlushTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case event := <-e.queue:
+			batch = append(batch, event)
+			if len(batch) < e.batchSize {
+				continue
+			}
+		default:
+		}
+		if len(batch) == 0 || ctx.Err() != nil {
+			break
+		}
+		e.flush(ctx, batch)
+		batch = batch[:0]
+	}
+
+	if err := e.sink.Close(); err != nil {
+		e.logger.Warn("Failed to close audit sink", zap.Error(err))
+	}
+}
+
+// flush sends a batch, retrying failed deliveries
+func (e *AuditExporter) flush(ctx context.Context, batch []AuditEvent) {
+	if dropped := e.droppedSince.Swap(0); dropped > 0 {
+		e.logger.Warn("Audit buffer full, events dropped", zap.Int64("dropped", dropped))
+	}
+
+	err := e.sink.Send(ctx, batch)
+	backoff := auditRetryBackoff
+retry:
+	for attempt := 1; err != nil && attempt < auditSendAttempts; attempt++ {
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+			err = e.sink.Send(ctx, batch)
+		case <-ctx.Done():
+			err = errors.Join(err, ctx.Err())
+			break retry
+		}
+	}
+	if err == nil {
+		e.exported.Add(ctx, int64(len(batch)))
+		return
+	}
+
+	e.failed.Add(context.Background(), int64(len(batch)))
+	e.logger.Error("Failed to export audit events", zap.Int("events", len(batch)), zap.Error(err))
+}
@@ -0,0 +1,100 @@
+package observability
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Device fields of CEF and LEEF headers
+const (
+	auditVendor  = "prperemyshlev"
+	auditProduct = "auth-service"
+	auditVersion = "2"
+)
+
+// auditTimeFormat is RFC 3339 with milliseconds, as expected by syslog and LEEF parsers
+const auditTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefValueEscaper    = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+// FormatCEF formats an event in ArcSight Common Event Format
+// e.g. CEF:0|prperemyshlev|auth-service|2|login.failure|Login failed|5|rt=... outcome=failure src=...
+func FormatCEF(event AuditEvent) string {
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	for _, field := range []string{auditVendor, auditProduct, auditVersion, event.Type, event.Name, strconv.Itoa(event.Severity)} {
+		b.WriteString(cefHeaderEscaper.Replace(field))
+		b.WriteByte('|')
+	}
+
+	ext := []string{"rt=" + strconv.FormatInt(event.Time.UnixMilli(), 10)}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	add("outcome", event.Outcome)
+	add("suid", event.UserID)
+	add("suser", event.User)
+	add("src", event.IP)
+	add("requestClientApplication", event.UserAgent)
+	add("reason", event.Reason)
+	if event.RequestID != "" {
+		add("cs1Label", "requestId")
+		add("cs1", event.RequestID)
+	}
+	if event.SessionID != "" {
+		add("cs2Label", "sessionId")
+		add("cs2", event.SessionID)
+	}
+	if event.Actor != "" {
+		add("cs3Label", "actor")
+		add("cs3", event.Actor)
+	}
+	if event.Location != "" {
+		add("cs4Label", "location")
+		add("cs4", event.Location)
+	}
+	b.WriteString(strings.Join(ext, " "))
+
+	return b.String()
+}
+
+// FormatLEEF formats an event in IBM QRadar Log Event Extended Format 1.0, attributes are tab-separated
+func FormatLEEF(event AuditEvent) string {
+	var b strings.Builder
+	b.WriteString("LEEF:1.0|")
+	for _, field := range []string{auditVendor, auditProduct, auditVersion, event.Type} {
+		b.WriteString(cefHeaderEscaper.Replace(field))
+		b.WriteByte('|')
+	}
+
+	attrs := []string{
+		"devTime=" + event.Time.UTC().Format(auditTimeFormat),
+		"devTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSX",
+		"cat=" + leefValueEscaper.Replace(event.Name),
+		"sev=" + strconv.Itoa(event.Severity),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, key+"="+leefValueEscaper.Replace(value))
+		}
+	}
+	add("outcome", event.Outcome)
+	add("usrId", event.UserID)
+	add("usrName", event.User)
+	add("src", event.IP)
+	add("userAgent", event.UserAgent)
+	add("reason", event.Reason)
+	add("requestId", event.RequestID)
+	add("sessionId", event.SessionID)
+	add("actor", event.Actor)
+	add("location", event.Location)
+	b.WriteString(strings.Join(attrs, "\t"))
+
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	auditDialTimeout  = 5 * time.Second
+	auditWriteTimeout = 5 * time.Second
+	// syslogFacilityAuthPriv is the facility of security/authorization messages
+	syslogFacilityAuthPriv = 10
+)
+
+// syslogAuditSink sends events as RFC 5424 syslog messages
+// Over TCP messages are newline-terminated (RFC 6587 non-transparent framing), over UDP
+// each message is a datagram. The connection is re-established after write errors.
+type syslogAuditSink struct {
+	network  string
+	address  string
+	format   func(AuditEvent) string
+	hostname string
+	conn     net.Conn
+}
+
+// NewSyslogAuditSink creates a sink sending events in CEF or LEEF format to a syslog collector
+func NewSyslogAuditSink(network, address, format string) (AuditSink, error) {
+	sink := &syslogAuditSink{network: network, address: address}
+	switch format {
+	case AuditFormatCEF:
+		sink.format = FormatCEF
+	case AuditFormatLEEF:
+		sink.format = FormatLEEF
+	default:
+		return nil, fmt.Errorf("unsupported audit format: %s", format)
+	}
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog network: %s", network)
+	}
+
+	sink.hostname, _ = os.Hostname()
+	if sink.hostname == "" {
+		sink.hostname = "-"
+	}
+	return sink, nil
+}
+
+// Send writes every event of the batch, the exporter calls it from a single goroutine
+func (s *syslogAuditSink) Send(ctx context.Context, events []AuditEvent) error {
+	if s.conn == nil {
+		dialer := net.Dialer{Timeout: auditDialTimeout}
+		conn, err := dialer.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog collector: %w", err)
+		}
+		s.conn = conn
+	}
+
+	for _, event := range events {
+		msg := s.message(event)
+		if s.network == "tcp" {
+			msg = append(msg, '\n')
+		}
+		if err := s.conn.SetWriteDeadline(time.Now().Add(auditWriteTimeout)); err != nil {
+			return s.reset(err)
+		}
+		if _, err := s.conn.Write(msg); err != nil {
+			return s.reset(err)
+		}
+	}
+	return nil
+}
+
+// message formats an event as syslog message, e.g.
+// <84>1 2024-01-02T15:04:05.000Z host auth-service - login.failure - CEF:0|...
+func (s *syslogAuditSink) message(event AuditEvent) []byte {
+	pri := syslogFacilityAuthPriv*8 + syslogSeverity(event.Severity)
+	return []byte("<" + strconv.Itoa(pri) + ">1 " +
+		event.Time.UTC().Format(auditTimeFormat) + " " +
+		s.hostname + " " + auditProduct + " - " + event.Type + " - " + s.format(event))
+}
+
+// reset drops the connection so that the next batch reconnects
+func (s *syslogAuditSink) reset(err error) error {
+	_ = s.conn.Close()
+	s.conn = nil
+	return fmt.Errorf("failed to write to syslog collector: %w", err)
+}
+
+// Close closes the connection to the collector
+func (s *syslogAuditSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogSeverity maps CEF severities (0-10) to syslog severities
+func syslogSeverity(severity int) int {
+	switch {
+	case severity >= 9:
+		return 2 // critical
+	case severity >= 7:
+		return 3 // error
+	case severity >= 4:
+		return 4 // warning
+	case severity >= 1:
+		return 5 // notice
+	default:
+		return 6 // informational
+	}
+}
+
+// httpAuditSink posts batches of events as JSON arrays
+type httpAuditSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPAuditSink creates a sink posting events to a SIEM collector endpoint
+func NewHTTPAuditSink(url, token string, client *http.Client) AuditSink {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &httpAuditSink{url: url, token: token, client: client}
+}
+
+// Send posts a batch, any non-2xx response is an error
+func (s *httpAuditSink) Send(ctx context.Context, events []AuditEvent) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send audit events: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close releases idle connections
+func (s *httpAuditSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,189 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var auditTestEvent = AuditEvent{
+	Time:      time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC),
+	Type:      "login.failure",
+	Name:      "Login failed",
+	Severity:  5,
+	Outcome:   AuditOutcomeFailure,
+	UserID:    "user-1",
+	User:      "u***@example.com",
+	IP:        "203.0.113.10",
+	UserAgent: "curl/8.0",
+	RequestID: "req-1",
+	Reason:    "invalid=password\nagain",
+}
+
+func TestFormatCEF(t *testing.T) {
+	event := auditTestEvent
+	event.Name = "Login|failed"
+	event.Actor = "admin"
+	event.Location = "Berlin, Germany"
+
+	want := `CEF:0|prperemyshlev|auth-service|2|login.failure|Login\|failed|5|rt=1704207845000 outcome=failure suid=user-1 suser=u***@example.com ` +
+		`src=203.0.113.10 requestClientApplication=curl/8.0 reason=invalid\=password\nagain cs1Label=requestId cs1=req-1 cs3Label=actor cs3=admin cs4Label=location cs4=Berlin, Germany`
+	if got := FormatCEF(event); got != want {
+		t.Errorf("FormatCEF() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatLEEF(t *testing.T) {
+	event := auditTestEvent
+	event.UserAgent = "curl\t8.0"
+	event.Actor = "admin"
+	event.Location = "Berlin, Germany"
+
+	got := FormatLEEF(event)
+	if !strings.HasPrefix(got, "LEEF:1.0|prperemyshlev|auth-service|2|login.failure|devTime=2024-01-02T15:04:05.000Z\t") {
+		t.Errorf("Unexpected LEEF header: %s", got)
+	}
+	for _, attr := range []string{"sev=5", "usrName=u***@example.com", "src=203.0.113.10", "userAgent=curl 8.0", "reason=invalid=password again", "requestId=req-1", "actor=admin", "location=Berlin, Germany"} {
+		if !strings.Contains(got, "\t"+attr) {
+			t.Errorf("Expected attribute %q in %s", attr, got)
+		}
+	}
+}
+
+// recordingSink keeps batches in memory
+type recordingSink struct {
+	mu      sync.Mutex
+	batches [][]AuditEvent
+	closed  bool
+}
+
+func (s *recordingSink) Send(_ context.Context, events []AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]AuditEvent(nil), events...))
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestAuditExporter(t *testing.T) {
+	sink := &recordingSink{}
+	exporter, err := NewAuditExporterWithSink(sink, AuditConfig{BatchSize: 2, FlushInterval: time.Hour}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		exporter.Run(ctx)
+		close(done)
+	}()
+
+	requestCtx := ContextWithRequestID(context.Background(), "req-1")
+	for range 3 {
+		exporter.Audit(requestCtx, AuditEvent{Type: "login.success"})
+	}
+	cancel()
+	<-done
+
+	// The full batch is sent at once, the rest on shutdown
+	if len(sink.batches) != 2 || len(sink.batches[0]) != 2 || len(sink.batches[1]) != 1 {
+		t.Fatalf("Expected batches of 2 and 1 events, got %v", sink.batches)
+	}
+	if event := sink.batches[0][0]; event.RequestID != "req-1" || event.Time.IsZero() {
+		t.Errorf("Expected request ID and time to be filled in, got %+v", event)
+	}
+	if !sink.closed {
+		t.Error("Expected the sink to be closed on shutdown")
+	}
+}
+
+func TestAuditExporterDropsWhenFull(t *testing.T) {
+	exporter, err := NewAuditExporterWithSink(&recordingSink{}, AuditConfig{BufferSize: 2}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Failed to create exporter: %v", err)
+	}
+
+	// Nothing consumes the queue, Audit must not block
+	for range 5 {
+		exporter.Audit(context.Background(), AuditEvent{Type: "login.success"})
+	}
+	if len(exporter.queue) != 2 || exporter.droppedSince.Load() != 3 {
+		t.Errorf("Expected 2 queued and 3 dropped events, got %d and %d", len(exporter.queue), exporter.droppedSince.Load())
+	}
+}
+
+func TestSyslogAuditSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogAuditSink("udp", conn.LocalAddr().String(), AuditFormatCEF)
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(context.Background(), []AuditEvent{auditTestEvent}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	msg := string(buf[:n])
+
+	// authpriv (10) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<84>1 2024-01-02T15:04:05.000Z ") {
+		t.Errorf("Unexpected syslog header: %s", msg)
+	}
+	if !strings.Contains(msg, " auth-service - login.failure - CEF:0|") {
+		t.Errorf("Expected a CEF message, got %s", msg)
+	}
+}
+
+func TestHTTPAuditSink(t *testing.T) {
+	var received []AuditEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	if err := NewHTTPAuditSink(server.URL, "secret", nil).Send(context.Background(), []AuditEvent{auditTestEvent}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if len(received) != 1 || received[0].Type != "login.failure" || received[0].UserID != "user-1" {
+		t.Errorf("Unexpected events received: %+v", received)
+	}
+
+	if err := NewHTTPAuditSink(server.URL, "wrong", nil).Send(context.Background(), []AuditEvent{auditTestEvent}); err == nil {
+		t.Error("Expected an error for a rejected batch")
+	}
+}
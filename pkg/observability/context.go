@@ -0,0 +1,45 @@
+package observability
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// LoggerWithContext returns a logger enriched with request-scoped fields from ctx
+func LoggerWithContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		return logger.With(zap.String("request_id", requestID))
+	}
+	return logger
+}
+
+// ContextWithLogger returns a copy of ctx carrying logger, for code without a logger of its own
+func ContextWithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger stored in ctx, or the global logger, enriched with
+// request-scoped fields from ctx. Non-fatal failures are logged with it instead of being ignored.
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	logger, ok := ctx.Value(loggerKey{}).(*zap.Logger)
+	if !ok {
+		logger = zap.L()
+	}
+	return LoggerWithContext(ctx, logger)
+}
@@ -0,0 +1,74 @@
+package observability
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveQueryParams are query parameters whose values must never be logged
+var sensitiveQueryParams = map[string]bool{
+	"token":         true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"code":          true,
+	"password":      true,
+	"secret":        true,
+	"email":         true,
+}
+
+// MaskEmail keeps the first character of the local part and the domain,
+// e.g. john.doe@example.com -> j***@example.com
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
+
+// HashValue returns a short stable SHA-256 fingerprint of the value,
+// so that log entries can be correlated without exposing it
+func HashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Email creates a log field with a masked email address
+func Email(key, email string) zap.Field {
+	return zap.String(key, MaskEmail(email))
+}
+
+// Token creates a log field with a fingerprint of a secret token
+func Token(key, token string) zap.Field {
+	if token == "" {
+		return zap.String(key, "")
+	}
+	return zap.String(key, "sha256:"+HashValue(token))
+}
+
+// RedactQuery replaces values of sensitive parameters in a raw query string
+func RedactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+
+	for key := range values {
+		if sensitiveQueryParams[strings.ToLower(key)] {
+			values[key] = []string{redacted}
+		}
+	}
+
+	return values.Encode()
+}
@@ -0,0 +1,61 @@
+package observability
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"john.doe@example.com", "j***@example.com"},
+		{"a@b.io", "a***@b.io"},
+		{"not-an-email", "***"},
+		{"@example.com", "***"},
+		{"", "***"},
+	}
+
+	for _, tt := range tests {
+		if got := MaskEmail(tt.email); got != tt.expected {
+			t.Errorf("MaskEmail(%q) = %q, expected %q", tt.email, got, tt.expected)
+		}
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	first := HashValue("secret-token")
+	if first != HashValue("secret-token") {
+		t.Error("Expected hash to be stable")
+	}
+	if first == HashValue("other-token") {
+		t.Error("Expected different values to have different hashes")
+	}
+	if strings.Contains(first, "secret") {
+		t.Errorf("Expected hash not to contain the value, got %s", first)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	redactedQuery := RedactQuery("token=abc&page=2&Email=user%40example.com")
+
+	values, err := url.ParseQuery(redactedQuery)
+	if err != nil {
+		t.Fatalf("Failed to parse redacted query: %v", err)
+	}
+	if values.Get("token") != redacted {
+		t.Errorf("Expected token to be redacted, got %q", values.Get("token"))
+	}
+	if values.Get("Email") != redacted {
+		t.Errorf("Expected email to be redacted, got %q", values.Get("Email"))
+	}
+	if values.Get("page") != "2" {
+		t.Errorf("Expected page to be kept, got %q", values.Get("page"))
+	}
+
+	if got := RedactQuery("token=%zz"); got != redacted {
+		t.Errorf("Expected unparseable query to be redacted, got %q", got)
+	}
+}
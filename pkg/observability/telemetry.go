@@ -40,25 +40,66 @@ func InitTelemetry(serviceName string) (*metric.MeterProvider, http.Handler, err
 	return meterProvider, handler, nil
 }
 
+// Supported log encodings
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// LoggerConfig configures the structured logger
+// Empty Level and Format fall back to environment defaults:
+// info/json in production, debug/console otherwise
+type LoggerConfig struct {
+	Env    string
+	Level  string
+	Format string
+}
+
 // InitLogger initializes structured logger
-func InitLogger(env string) (*zap.Logger, error) {
-	var logger *zap.Logger
-	var err error
+func InitLogger(cfg LoggerConfig) (*zap.Logger, error) {
+	logger, _, err := InitLoggerWithLevel(cfg)
+	return logger, err
+}
 
-	if env == "production" {
-		logger, err = zap.NewProduction()
+// InitLoggerWithLevel initializes structured logger and returns its level,
+// which can be changed at runtime
+func InitLoggerWithLevel(cfg LoggerConfig) (*zap.Logger, zap.AtomicLevel, error) {
+	var zapConfig zap.Config
+	if cfg.Env == "production" {
+		zapConfig = zap.NewProductionConfig()
 	} else {
-		logger, err = zap.NewDevelopment()
+		zapConfig = zap.NewDevelopmentConfig()
+	}
+
+	if cfg.Level != "" {
+		level, err := zap.ParseAtomicLevel(cfg.Level)
+		if err != nil {
+			return nil, zap.AtomicLevel{}, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+		}
+		zapConfig.Level = level
+	}
+
+	switch cfg.Format {
+	case "":
+	case LogFormatJSON:
+		zapConfig.Encoding = LogFormatJSON
+		zapConfig.EncoderConfig = zap.NewProductionEncoderConfig()
+	case LogFormatConsole:
+		zapConfig.Encoding = LogFormatConsole
+		zapConfig.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, zap.AtomicLevel{}, fmt.Errorf("invalid log format %q", cfg.Format)
 	}
 
+	logger, err := zapConfig.Build()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+		return nil, zap.AtomicLevel{}, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
 	// Replace global logger
 	zap.ReplaceGlobals(logger)
 
-	return logger, nil
+	return logger, zapConfig.Level, nil
 }
 
 // Shutdown gracefully shuts down telemetry
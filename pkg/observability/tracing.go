@@ -0,0 +1,66 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// InitTracing initializes OpenTelemetry tracing with an OTLP/HTTP exporter
+// endpoint is a host:port of the collector, e.g. "otel-collector:4318"
+func InitTracing(ctx context.Context, serviceName, endpoint string, insecure bool, sampleRatio float64) (*trace.TracerProvider, error) {
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint),
+	}
+	if insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	// Create OTLP exporter
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	// Create tracer provider, honoring upstream sampling decisions
+	tracerProvider := trace.NewTracerProvider(
+		trace.WithBatcher(exporter),
+		trace.WithResource(res),
+		trace.WithSampler(trace.ParentBased(trace.TraceIDRatioBased(sampleRatio))),
+	)
+
+	// Set global tracer provider and W3C propagation
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return tracerProvider, nil
+}
+
+// ShutdownTracing flushes pending spans and shuts down the tracer provider
+func ShutdownTracing(ctx context.Context, tracerProvider *trace.TracerProvider) error {
+	if tracerProvider == nil {
+		return nil
+	}
+
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown tracer provider: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *Suite) adminRequest(method, path string, body interface{}) *http.Response {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, _ := http.NewRequest(method, s.BaseURL+path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) TestAdmin_NoToken() {
+	resp, err := http.Get(s.BaseURL + "/api/v1/admin/ip-rules")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (s *Suite) TestAdmin_IPRulesLifecycle() {
+	createResp := s.adminRequest("POST", "/api/v1/admin/ip-rules", dto.CreateIPRuleRequest{
+		CIDR:   "203.0.113.7/24",
+		Action: "deny",
+	})
+	defer createResp.Body.Close()
+	s.Equal(http.StatusCreated, createResp.StatusCode)
+
+	var rule dto.IPRuleResponse
+	s.Require().NoError(json.NewDecoder(createResp.Body).Decode(&rule))
+	s.Equal("203.0.113.0/24", rule.CIDR)
+	s.Equal("deny", rule.Action)
+
+	duplicateResp := s.adminRequest("POST", "/api/v1/admin/ip-rules", dto.CreateIPRuleRequest{
+		CIDR:   "203.0.113.0/24",
+		Action: "allow",
+	})
+	defer duplicateResp.Body.Close()
+	s.Equal(http.StatusConflict, duplicateResp.StatusCode)
+
+	listResp := s.adminRequest("GET", "/api/v1/admin/ip-rules", nil)
+	defer listResp.Body.Close()
+	s.Equal(http.StatusOK, listResp.StatusCode)
+
+	var rules []dto.IPRuleResponse
+	s.Require().NoError(json.NewDecoder(listResp.Body).Decode(&rules))
+	s.Len(rules, 1)
+
+	deleteResp := s.adminRequest("DELETE", "/api/v1/admin/ip-rules/"+rule.ID, nil)
+	defer deleteResp.Body.Close()
+	s.Equal(http.StatusOK, deleteResp.StatusCode)
+}
+
+func (s *Suite) TestAdmin_CreateIPRuleInvalidCIDR() {
+	resp := s.adminRequest("POST", "/api/v1/admin/ip-rules", dto.CreateIPRuleRequest{
+		CIDR:   "not-a-cidr",
+		Action: "deny",
+	})
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *Suite) getMe(accessToken string) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, s.BaseURL+"/api/v1/auth/me", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) TestAdmin_RevokeUserTokens() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(2))
+	other := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	resp := s.adminRequest("POST", "/api/v1/admin/revocations", dto.CreateRevocationRequest{
+		Scope:  dto.RevocationScopeUser,
+		UserID: user.ID,
+	})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var revocation dto.RevocationResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&revocation))
+	s.Equal(int64(2), revocation.RefreshTokensDeleted)
+	s.NotEmpty(revocation.NotValidBefore)
+
+	meResp := s.getMe(user.AccessToken)
+	defer meResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, meResp.StatusCode, "access tokens issued before the revocation must be rejected")
+
+	refreshResp := s.postV2("/auth/refresh", "", dto.RefreshRequest{RefreshToken: user.RefreshTokens[0]})
+	defer refreshResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, refreshResp.StatusCode)
+
+	otherResp := s.getMe(other.AccessToken)
+	defer otherResp.Body.Close()
+	s.Equal(http.StatusOK, otherResp.StatusCode, "tokens of other users must stay valid")
+}
+
+func (s *Suite) TestAdmin_RevokeIssuedBefore() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	// Tokens issued after the moment stay valid
+	before := time.Now().Add(-time.Hour)
+	resp := s.adminRequest("POST", "/api/v1/admin/revocations", dto.CreateRevocationRequest{
+		Scope:        dto.RevocationScopeAll,
+		IssuedBefore: &before,
+	})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	meResp := s.getMe(user.AccessToken)
+	defer meResp.Body.Close()
+	s.Equal(http.StatusOK, meResp.StatusCode)
+
+	invalidResp := s.adminRequest("POST", "/api/v1/admin/revocations", dto.CreateRevocationRequest{Scope: dto.RevocationScopeUser})
+	defer invalidResp.Body.Close()
+	s.Equal(http.StatusBadRequest, invalidResp.StatusCode, "the user scope requires user_id")
+}
+
+func (s *Suite) TestAdmin_ImportUsers() {
+	hash, err := bcrypt.GenerateFromPassword([]byte("Legacy123"), bcrypt.MinCost)
+	s.Require().NoError(err)
+	suffix := time.Now().UnixNano()
+	file := fmt.Sprintf("email,password_hash,force_password_reset\n"+
+		"imported-%[1]d@example.com,%[2]s,\n"+
+		"reset-%[1]d@example.com,,true\n"+
+		"invalid-%[1]d@example.com,,\n", suffix, hash)
+
+	req, _ := http.NewRequest(http.MethodPost, s.BaseURL+"/api/v1/admin/users/import", strings.NewReader(file))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusAccepted, resp.StatusCode)
+
+	var started dto.UserImportResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&started))
+	s.Equal(int64(3), started.Total)
+
+	var status dto.UserImportResponse
+	s.Require().Eventually(func() bool {
+		statusResp := s.adminRequest("GET", "/api/v1/admin/users/import/"+started.ID, nil)
+		defer statusResp.Body.Close()
+		status = dto.UserImportResponse{}
+		return statusResp.StatusCode == http.StatusOK &&
+			json.NewDecoder(statusResp.Body).Decode(&status) == nil && status.Status == "completed"
+	}, 10*time.Second, 50*time.Millisecond)
+	s.Equal(int64(2), status.Imported)
+	s.Equal(int64(1), status.Failed)
+	s.Require().Len(status.Errors, 1)
+	s.Equal(4, status.Errors[0].Line)
+
+	// Imported users log in with the password of the legacy system
+	loginResp := s.login(dto.LoginRequest{Email: fmt.Sprintf("imported-%d@example.com", suffix), Password: "Legacy123"})
+	defer loginResp.Body.Close()
+	s.Equal(http.StatusOK, loginResp.StatusCode)
+
+	missingResp := s.adminRequest("GET", "/api/v1/admin/users/import/unknown", nil)
+	defer missingResp.Body.Close()
+	s.Equal(http.StatusNotFound, missingResp.StatusCode)
+}
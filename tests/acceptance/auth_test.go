@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
 )
 
 func (s *Suite) TestRegister_Success() {
@@ -70,6 +71,29 @@ func (s *Suite) TestRegister_DuplicateEmail() {
 	s.Equal("Conflict", errResp.Error)
 }
 
+func (s *Suite) TestRegister_DuplicateNormalizedEmail() {
+	s.registerUser("first.last@gmail.com", "Password123")
+
+	body, _ := json.Marshal(dto.RegisterRequest{
+		Email:    "FirstLast+alias@gmail.com",
+		Password: "Password123",
+	})
+	resp, err := http.Post(s.BaseURL+"/api/v1/auth/register", "application/json", bytes.NewBuffer(body))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusConflict, resp.StatusCode)
+
+	// The original address is stored, any alias can be used to log in
+	loginResp := s.login(dto.LoginRequest{Identifier: "firstlast+other@gmail.com", Password: "Password123"})
+	defer loginResp.Body.Close()
+	s.Require().Equal(http.StatusOK, loginResp.StatusCode)
+
+	var authResp dto.AuthResponse
+	s.Require().NoError(json.NewDecoder(loginResp.Body).Decode(&authResp))
+	s.Equal("first.last@gmail.com", authResp.User.Email)
+}
+
 func (s *Suite) TestRegister_InvalidEmail() {
 	reqBody := dto.RegisterRequest{
 		Email:    "invalid-email",
@@ -106,6 +130,28 @@ func (s *Suite) TestRegister_ShortPassword() {
 	s.Equal(http.StatusBadRequest, resp.StatusCode)
 }
 
+func (s *Suite) TestRegister_WeakPasswordDetails() {
+	reqBody := dto.RegisterRequest{
+		Email:    "weak@example.com",
+		Password: "password",
+	}
+	body, _ := json.Marshal(reqBody)
+
+	resp, err := http.Post(s.BaseURL+"/api/v2/auth/register", "application/json", bytes.NewBuffer(body))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&errResp))
+	s.Equal("weak_password", errResp.Code)
+	s.Equal([]dto.FieldError{
+		{Field: "password", Rule: "uppercase", Message: "Must contain an uppercase letter"},
+		{Field: "password", Rule: "number", Message: "Must contain a number"},
+	}, errResp.Details)
+}
+
 func (s *Suite) TestLogin_Success() {
 	registerReq := dto.RegisterRequest{
 		Email:    "login@example.com",
@@ -193,24 +239,10 @@ func (s *Suite) TestLogin_WrongPassword() {
 }
 
 func (s *Suite) TestGetMe_Success() {
-	registerReq := dto.RegisterRequest{
-		Email:    "getme@example.com",
-		Password: "Password123",
-	}
-	body, _ := json.Marshal(registerReq)
-	registerResp, err := http.Post(
-		s.BaseURL+"/api/v1/auth/register",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
-	s.Require().NoError(err)
-	defer registerResp.Body.Close()
-
-	var authResp dto.AuthResponse
-	json.NewDecoder(registerResp.Body).Decode(&authResp)
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithVerifiedEmail())
 
 	req, _ := http.NewRequest("GET", s.BaseURL+"/api/v1/auth/me", nil)
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authResp.AccessToken))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", user.AccessToken))
 
 	resp, err := http.DefaultClient.Do(req)
 	s.Require().NoError(err)
@@ -222,11 +254,11 @@ func (s *Suite) TestGetMe_Success() {
 	err = json.NewDecoder(resp.Body).Decode(&userResp)
 	s.Require().NoError(err)
 
-	s.NotEmpty(userResp.ID)
-	s.Equal("getme@example.com", userResp.Email)
+	s.Equal(user.ID, userResp.ID)
+	s.Equal(user.Email, userResp.Email)
 	s.NotEmpty(userResp.CreatedAt)
 	s.NotEmpty(userResp.UpdatedAt)
-	s.False(userResp.IsEmailVerified)
+	s.True(userResp.IsEmailVerified)
 }
 
 func (s *Suite) TestGetMe_NoToken() {
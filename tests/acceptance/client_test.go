@@ -0,0 +1,75 @@
+package acceptance
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/client"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
+)
+
+func (s *Suite) TestClient_Sessions() {
+	ctx := context.Background()
+	c := client.New(s.BaseURL)
+
+	first, err := c.Register(ctx, &client.RegisterRequest{Email: "client@example.com", Password: "Password123"})
+	s.Require().NoError(err)
+	second, err := c.Login(ctx, &client.LoginRequest{Identifier: "client@example.com", Password: "Password123"})
+	s.Require().NoError(err)
+
+	sessions, err := c.ListSessions(ctx, second.AccessToken)
+	s.Require().NoError(err)
+	s.Require().Len(sessions, 2)
+
+	// Sessions are listed newest first, revoke the one created by registration
+	s.Require().NoError(c.RevokeSession(ctx, second.AccessToken, sessions[1].ID))
+
+	_, err = c.Refresh(ctx, first.RefreshToken)
+	s.True(client.IsStatus(err, http.StatusUnauthorized), "revoked session must not refresh: %v", err)
+
+	err = c.RevokeSession(ctx, second.AccessToken, sessions[1].ID)
+	s.True(client.IsCode(err, client.CodeSessionNotFound), "unexpected error: %v", err)
+
+	refreshed, err := c.Refresh(ctx, second.RefreshToken)
+	s.Require().NoError(err)
+
+	user, err := c.GetMe(ctx, refreshed.AccessToken)
+	s.Require().NoError(err)
+	s.Equal("client@example.com", user.Email)
+}
+
+func (s *Suite) TestClient_V1RefreshCookie() {
+	ctx := context.Background()
+	c := client.New(s.BaseURL, client.WithAPIVersion(client.V1))
+
+	tokens, err := c.Register(ctx, &client.RegisterRequest{Email: "client-v1@example.com", Password: "Password123"})
+	s.Require().NoError(err)
+	s.NotEmpty(tokens.RefreshToken, "refresh token must be read from the cookie")
+
+	refreshed, err := c.Refresh(ctx, tokens.RefreshToken)
+	s.Require().NoError(err)
+	s.NotEqual(tokens.RefreshToken, refreshed.RefreshToken)
+
+	s.Require().NoError(c.Logout(ctx, refreshed.AccessToken, refreshed.RefreshToken))
+	_, err = c.Refresh(ctx, refreshed.RefreshToken)
+	s.Error(err)
+}
+
+func (s *Suite) TestClient_FixtureSessions() {
+	ctx := context.Background()
+	c := client.New(s.BaseURL)
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(3))
+
+	sessions, err := c.ListSessions(ctx, user.AccessToken)
+	s.Require().NoError(err)
+	s.Len(sessions, 3)
+
+	for _, refreshToken := range user.RefreshTokens {
+		_, err := c.Refresh(ctx, refreshToken)
+		s.Require().NoError(err)
+	}
+
+	tokens, err := c.Login(ctx, &client.LoginRequest{Identifier: user.Email, Password: user.Password})
+	s.Require().NoError(err)
+	s.NotEmpty(tokens.AccessToken)
+}
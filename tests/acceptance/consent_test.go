@@ -0,0 +1,33 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
+)
+
+func (s *Suite) TestConsent_NotRequiredWithoutPublishedVersions() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	req, _ := http.NewRequest(http.MethodGet, s.BaseURL+"/api/v1/auth/me/consents", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", user.AccessToken))
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	var consents []dto.ConsentResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&consents))
+	s.Empty(consents)
+
+	acceptResp := s.postV2("/auth/me/consents", user.AccessToken, dto.AcceptConsentRequest{Document: "terms", Version: "2024-01"})
+	defer acceptResp.Body.Close()
+	s.Equal(http.StatusConflict, acceptResp.StatusCode, "unpublished documents can't be accepted")
+
+	invalidResp := s.postV2("/auth/me/consents", user.AccessToken, dto.AcceptConsentRequest{Document: "cookies", Version: "2024-01"})
+	defer invalidResp.Body.Close()
+	s.Equal(http.StatusBadRequest, invalidResp.StatusCode)
+}
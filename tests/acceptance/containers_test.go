@@ -0,0 +1,175 @@
+package acceptance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/prperemyshlev/auth-service-2/internal/repository"
+	"github.com/prperemyshlev/auth-service-2/pkg/database"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+)
+
+const (
+	postgresImage = "postgres:15-alpine"
+	redisImage    = "redis:7-alpine"
+
+	// templateDatabase holds the migrated schema, test databases are created from it
+	templateDatabase = "auth_service_template"
+	// redisDatabases is the number of logical databases of a default Redis server
+	redisDatabases = 16
+)
+
+// containers are the Postgres and Redis instances of one suite run
+// Each test gets a copy of the migrated template database and its own
+// logical Redis database, so at most redisDatabases tests run at once.
+type containers struct {
+	postgres *tcpostgres.PostgresContainer
+	redis    *tcredis.RedisContainer
+
+	postgresDSN string
+	redisAddr   string
+	// admin is connected to the maintenance database to create and drop test databases
+	admin *sql.DB
+	// createMu serializes CREATE DATABASE, which fails while the template is being copied
+	createMu sync.Mutex
+	seq      atomic.Int64
+	redisDBs chan int
+}
+
+var _ backend = (*containers)(nil)
+
+// startContainers starts fresh Postgres and Redis containers on random ports
+// and applies the migrations from the migrations directory to the template database
+func startContainers(ctx context.Context) (_ *containers, err error) {
+	c := &containers{redisDBs: make(chan int, redisDatabases)}
+	defer func() {
+		if err != nil {
+			_ = c.terminate()
+		}
+	}()
+
+	c.postgres, err = tcpostgres.Run(ctx, postgresImage,
+		tcpostgres.WithDatabase(templateDatabase),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start postgres: %w", err)
+	}
+
+	c.postgresDSN, err = c.postgres.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get postgres dsn: %w", err)
+	}
+
+	if err := migratePostgres(c.postgresDSN); err != nil {
+		return nil, err
+	}
+
+	c.admin, err = sql.Open("postgres", c.dsn("postgres"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	c.redis, err = tcredis.Run(ctx, redisImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start redis: %w", err)
+	}
+
+	c.redisAddr, err = c.redis.Endpoint(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redis address: %w", err)
+	}
+
+	for i := range redisDatabases {
+		c.redisDBs <- i
+	}
+
+	return c, nil
+}
+
+// isolate creates a database from the template and reserves a Redis database for t
+func (c *containers) isolate(t *testing.T) (*storage, error) {
+	name := fmt.Sprintf("test_%d", c.seq.Add(1))
+
+	c.createMu.Lock()
+	_, err := c.admin.Exec("CREATE DATABASE " + name + " TEMPLATE " + templateDatabase)
+	c.createMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+	t.Cleanup(func() {
+		if _, err := c.admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)"); err != nil {
+			t.Logf("Failed to drop database %s: %v", name, err)
+		}
+	})
+
+	pg, err := database.NewPostgres(c.dsn(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	t.Cleanup(func() { _ = pg.Close() })
+
+	index := <-c.redisDBs
+	t.Cleanup(func() { c.redisDBs <- index })
+
+	redis, err := database.NewRedis(c.redisAddr, "", index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	t.Cleanup(func() { _ = redis.Close() })
+
+	if err := redis.Client.FlushDB(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to flush Redis: %w", err)
+	}
+
+	return &storage{postgres: pg, redis: redis, repos: repository.NewRepositories(pg)}, nil
+}
+
+// dsn returns the connection string of the database name
+func (c *containers) dsn(name string) string {
+	u, err := url.Parse(c.postgresDSN)
+	if err != nil {
+		// The DSN is produced by testcontainers and always valid
+		panic(err)
+	}
+	u.Path = "/" + name
+	return u.String()
+}
+
+// terminate stops and removes the containers
+func (c *containers) terminate() error {
+	if c.admin != nil {
+		_ = c.admin.Close()
+	}
+	return errors.Join(
+		testcontainers.TerminateContainer(c.postgres),
+		testcontainers.TerminateContainer(c.redis),
+	)
+}
+
+// migratePostgres applies the same migrations as make migrate-up
+func migratePostgres(dsn string) error {
+	m, err := migrate.New("file://"+filepath.Join("..", "..", "migrations"), dsn)
+	if err != nil {
+		return fmt.Errorf("failed to prepare migrations: %w", err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	return nil
+}
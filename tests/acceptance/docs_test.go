@@ -0,0 +1,33 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (s *Suite) TestDocs_OpenAPISpec() {
+	resp, err := http.Get(s.BaseURL + "/openapi.json")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var spec struct {
+		BasePath string                     `json:"basePath"`
+		Paths    map[string]json.RawMessage `json:"paths"`
+	}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&spec))
+	s.Equal("/api", spec.BasePath)
+	for _, path := range []string{"/v1/auth/register", "/v1/auth/login", "/v1/auth/me", "/v2/auth/refresh", "/v1/admin/ip-rules"} {
+		s.Contains(spec.Paths, path)
+	}
+}
+
+func (s *Suite) TestDocs_SwaggerUI() {
+	resp, err := http.Get(s.BaseURL + "/swagger/index.html")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(resp.Header.Get("Content-Type"), "text/html")
+}
@@ -0,0 +1,111 @@
+package acceptance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
+)
+
+// meErasure requests or cancels the erasure of the account of accessToken
+func (s *Suite) meErasure(method, accessToken string) *http.Response {
+	req, _ := http.NewRequest(method, s.BaseURL+"/api/v1/auth/me/erasure", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) TestErasure_UserRequestAndCancel() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	resp := s.meErasure(http.MethodPost, user.AccessToken)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusAccepted, resp.StatusCode)
+
+	var erasure dto.ErasureResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&erasure))
+	s.Equal(dto.ErasureStatusPending, erasure.Status)
+	s.Equal("user", erasure.RequestedBy)
+	s.Nil(erasure.ErasedAt)
+
+	duplicateResp := s.meErasure(http.MethodPost, user.AccessToken)
+	defer duplicateResp.Body.Close()
+	s.Equal(http.StatusConflict, duplicateResp.StatusCode)
+
+	// The account stays usable during the grace period
+	meResp := s.getMe(user.AccessToken)
+	defer meResp.Body.Close()
+	s.Equal(http.StatusOK, meResp.StatusCode)
+
+	cancelResp := s.meErasure(http.MethodDelete, user.AccessToken)
+	defer cancelResp.Body.Close()
+	s.Equal(http.StatusNoContent, cancelResp.StatusCode)
+
+	missingResp := s.meErasure(http.MethodDelete, user.AccessToken)
+	defer missingResp.Body.Close()
+	s.Equal(http.StatusNotFound, missingResp.StatusCode)
+
+	adminResp := s.adminRequest("GET", "/api/v1/admin/users/"+user.ID+"/erasure", nil)
+	defer adminResp.Body.Close()
+	s.Equal(http.StatusNotFound, adminResp.StatusCode)
+}
+
+func (s *Suite) TestErasure_AdminErasesUser() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+	other := s.Fixtures.NewUser(s.T())
+
+	// A pending erasure requested by the user is carried out early
+	requestResp := s.meErasure(http.MethodPost, user.AccessToken)
+	defer requestResp.Body.Close()
+	s.Require().Equal(http.StatusAccepted, requestResp.StatusCode)
+
+	resp := s.adminRequest("POST", "/api/v1/admin/users/"+user.ID+"/erasure", nil)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	var erasure dto.ErasureResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&erasure))
+	s.Equal(dto.ErasureStatusErased, erasure.Status)
+	s.Equal("delete", erasure.Mode)
+	s.NotNil(erasure.ErasedAt)
+	sum := sha256.Sum256([]byte(user.EmailNormalized))
+	s.Equal(hex.EncodeToString(sum[:]), erasure.EmailHash)
+
+	meResp := s.getMe(user.AccessToken)
+	defer meResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, meResp.StatusCode, "access tokens of erased users must be rejected")
+
+	refreshResp := s.postV2("/auth/refresh", "", dto.RefreshRequest{RefreshToken: user.RefreshTokens[0]})
+	defer refreshResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, refreshResp.StatusCode)
+
+	loginResp := s.postV2("/auth/login", "", dto.LoginRequest{Identifier: user.Email, Password: user.Password})
+	defer loginResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, loginResp.StatusCode)
+
+	// The tombstone is kept and erasing again is a no-op
+	againResp := s.adminRequest("POST", "/api/v1/admin/users/"+user.ID+"/erasure", nil)
+	defer againResp.Body.Close()
+	s.Equal(http.StatusOK, againResp.StatusCode)
+
+	tombstoneResp := s.adminRequest("GET", "/api/v1/admin/users/"+user.ID+"/erasure", nil)
+	defer tombstoneResp.Body.Close()
+	s.Require().Equal(http.StatusOK, tombstoneResp.StatusCode)
+	var tombstone dto.ErasureResponse
+	s.Require().NoError(json.NewDecoder(tombstoneResp.Body).Decode(&tombstone))
+	s.Equal(dto.ErasureStatusErased, tombstone.Status)
+
+	otherResp := s.getMe(other.AccessToken)
+	defer otherResp.Body.Close()
+	s.Equal(http.StatusOK, otherResp.StatusCode, "other users must not be affected")
+
+	unknownResp := s.adminRequest("POST", "/api/v1/admin/users/00000000-0000-0000-0000-000000000000/erasure", nil)
+	defer unknownResp.Body.Close()
+	s.Equal(http.StatusNotFound, unknownResp.StatusCode)
+}
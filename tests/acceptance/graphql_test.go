@@ -0,0 +1,96 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// graphQL sends a GraphQL request, authenticated if accessToken is set
+func (s *Suite) graphQL(accessToken, query string, variables map[string]interface{}) graphQLResponse {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	req, _ := http.NewRequest(http.MethodPost, s.BaseURL+"/graphql", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	var result graphQLResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func (s *Suite) TestGraphQL_LoginMeSessionsLogout() {
+	s.registerUser("graphql@example.com", "Password123")
+
+	login := s.graphQL("", `mutation Login($identifier: String!, $password: String!) {
+		login(identifier: $identifier, password: $password) { accessToken refreshToken user { email } }
+	}`, map[string]interface{}{"identifier": "graphql@example.com", "password": "Password123"})
+	s.Require().Empty(login.Errors)
+
+	var loginData struct {
+		Login struct {
+			AccessToken  string `json:"accessToken"`
+			RefreshToken string `json:"refreshToken"`
+			User         struct {
+				Email string `json:"email"`
+			} `json:"user"`
+		} `json:"login"`
+	}
+	s.Require().NoError(json.Unmarshal(login.Data, &loginData))
+	s.NotEmpty(loginData.Login.AccessToken)
+	s.NotEmpty(loginData.Login.RefreshToken)
+	s.Equal("graphql@example.com", loginData.Login.User.Email)
+
+	me := s.graphQL(loginData.Login.AccessToken, `{ me { email displayName } sessions { id expiresAt } }`, nil)
+	s.Require().Empty(me.Errors)
+
+	var meData struct {
+		Me struct {
+			Email       string  `json:"email"`
+			DisplayName *string `json:"displayName"`
+		} `json:"me"`
+		Sessions []struct {
+			ID string `json:"id"`
+		} `json:"sessions"`
+	}
+	s.Require().NoError(json.Unmarshal(me.Data, &meData))
+	s.Equal("graphql@example.com", meData.Me.Email)
+	s.Nil(meData.Me.DisplayName)
+	s.Len(meData.Sessions, 2)
+
+	logout := s.graphQL(loginData.Login.AccessToken, `mutation($token: String) { logout(refreshToken: $token) }`,
+		map[string]interface{}{"token": loginData.Login.RefreshToken})
+	s.Require().Empty(logout.Errors)
+
+	refresh := s.graphQL("", `mutation($token: String!) { refresh(refreshToken: $token) { accessToken } }`,
+		map[string]interface{}{"token": loginData.Login.RefreshToken})
+	s.Require().NotEmpty(refresh.Errors)
+	s.NotEmpty(refresh.Errors[0].Extensions.Code)
+}
+
+func (s *Suite) TestGraphQL_Errors() {
+	me := s.graphQL("", `{ me { id } }`, nil)
+	s.Require().NotEmpty(me.Errors)
+	s.Equal("unauthorized", me.Errors[0].Extensions.Code)
+
+	login := s.graphQL("", `mutation { login(identifier: "nobody@example.com", password: "Password123") { accessToken } }`, nil)
+	s.Require().NotEmpty(login.Errors)
+	s.Equal("invalid_credentials", login.Errors[0].Extensions.Code)
+}
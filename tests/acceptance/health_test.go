@@ -1,7 +1,11 @@
 package acceptance
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
 )
 
 func (s *Suite) TestHealthEndpoint() {
@@ -10,4 +14,49 @@ func (s *Suite) TestHealthEndpoint() {
 	defer resp.Body.Close()
 
 	s.Equal(http.StatusOK, resp.StatusCode, "Expected status 200")
+	s.Equal("application/health+json", resp.Header.Get("Content-Type"))
+
+	var health struct {
+		Status string                      `json:"status"`
+		Checks map[string][]map[string]any `json:"checks"`
+	}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&health), "Failed to decode response")
+	s.Equal("pass", health.Status)
+	s.Contains(health.Checks, "migrations:version", "Expected the schema version to be checked")
+	s.Contains(health.Checks, "redis:responseTime", "Expected the redis latency")
+}
+
+func (s *Suite) TestMetricsEndpoint_HTTPServerMetrics() {
+	resp, err := http.Get(s.BaseURL + "/health")
+	s.Require().NoError(err, "Failed to make request")
+	resp.Body.Close()
+
+	resp, err = http.Get(s.BaseURL + "/metrics")
+	s.Require().NoError(err, "Failed to make request")
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode, "Expected status 200")
+
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err, "Failed to read response body")
+
+	s.Contains(string(body), "http_server_requests_total", "Expected request counter")
+	s.Contains(string(body), "http_server_request_duration_seconds", "Expected duration histogram")
+	s.Contains(string(body), "http_server_active_requests", "Expected in-flight gauge")
+	s.Contains(string(body), `route="/health"`, "Expected route template label")
+	s.Contains(string(body), `status_class="2xx"`, "Expected status class label")
+}
+
+func (s *Suite) TestMetricsEndpoint_LoginDuration() {
+	s.login(dto.LoginRequest{Identifier: "nobody@example.com", Password: "Password123"}).Body.Close()
+
+	resp, err := http.Get(s.BaseURL + "/metrics")
+	s.Require().NoError(err, "Failed to make request")
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	s.Require().NoError(err, "Failed to read response body")
+
+	s.Contains(string(body), `auth_login_duration_seconds_bucket{`, "Expected login duration histogram")
+	s.Contains(string(body), `route="/api/v1/auth/login",status_class="4xx"`, "Expected route and status class labels")
 }
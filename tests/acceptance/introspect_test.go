@@ -0,0 +1,51 @@
+package acceptance
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/pkg/authmw"
+)
+
+func (s *Suite) introspect(token string) dto.IntrospectionResponse {
+	resp, err := http.PostForm(s.BaseURL+"/api/v2/auth/introspect", url.Values{"token": {token}})
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	var result dto.IntrospectionResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+func (s *Suite) TestIntrospect() {
+	resp := s.postV2("/auth/register", "", dto.RegisterRequest{Email: "introspect@example.com", Password: "Password123"})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var tokens dto.TokenResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&tokens))
+
+	result := s.introspect(tokens.AccessToken)
+	s.True(result.Active)
+	s.Equal(tokens.User.ID, result.Sub)
+	s.Equal("introspect@example.com", result.Email)
+
+	s.Equal(dto.IntrospectionResponse{Active: false}, s.introspect("invalid-token"))
+	s.False(s.introspect(tokens.RefreshToken).Active, "refresh tokens are not access tokens")
+
+	// Resource servers validate tokens locally and check them with the introspection endpoint
+	verifier, err := authmw.New(authmw.Config{
+		Secret:           s.createTestConfig().JWT.Secret,
+		IntrospectionURL: s.BaseURL + "/api/v2/auth/introspect",
+	})
+	s.Require().NoError(err)
+
+	claims, err := verifier.Verify(context.Background(), tokens.AccessToken)
+	s.Require().NoError(err)
+	s.Equal(tokens.User.ID, claims.UserID)
+}
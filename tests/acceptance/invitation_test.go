@@ -0,0 +1,99 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
+)
+
+func (s *Suite) TestInvitation_AdminInvitesUser() {
+	email := fmt.Sprintf("invited-%s@example.com", uuid.NewString()[:8])
+	role := "member"
+
+	resp := s.adminRequest("POST", "/api/v1/admin/invitations", dto.CreateInvitationRequest{Email: email, Role: &role})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var created dto.CreateInvitationResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&created))
+	s.NotEmpty(created.Token)
+	s.Equal(domain.InvitationStatusPending, created.Status)
+	s.Nil(created.InvitedBy)
+
+	registerResp := s.postV2("/auth/register/invite/"+created.Token, "", dto.RegisterWithInvitationRequest{Password: "Password123"})
+	defer registerResp.Body.Close()
+	s.Require().Equal(http.StatusCreated, registerResp.StatusCode)
+
+	var tokens dto.TokenResponse
+	s.Require().NoError(json.NewDecoder(registerResp.Body).Decode(&tokens))
+	s.Equal(email, tokens.User.Email)
+
+	againResp := s.postV2("/auth/register/invite/"+created.Token, "", dto.RegisterWithInvitationRequest{Password: "Password123"})
+	defer againResp.Body.Close()
+	s.Equal(http.StatusBadRequest, againResp.StatusCode, "invitations can be used once")
+
+	revokeResp := s.adminRequest("DELETE", "/api/v1/admin/invitations/"+created.ID, nil)
+	defer revokeResp.Body.Close()
+	s.Equal(http.StatusNotFound, revokeResp.StatusCode, "accepted invitations can't be revoked")
+
+	listResp := s.adminRequest("GET", "/api/v1/admin/invitations", nil)
+	defer listResp.Body.Close()
+	s.Require().Equal(http.StatusOK, listResp.StatusCode)
+	var invitations []dto.InvitationResponse
+	s.Require().NoError(json.NewDecoder(listResp.Body).Decode(&invitations))
+	for _, invitation := range invitations {
+		if invitation.ID == created.ID {
+			s.Equal(domain.InvitationStatusAccepted, invitation.Status)
+			s.Equal(tokens.User.ID, *invitation.AcceptedBy)
+			return
+		}
+	}
+	s.Fail("created invitation not listed")
+}
+
+func (s *Suite) TestInvitation_UserInvitesAndRevokes() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+	other := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	resp := s.postV2("/auth/invitations", user.AccessToken, dto.CreateInvitationRequest{Email: "friend@example.com"})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var created dto.CreateInvitationResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&created))
+	s.Require().NotNil(created.InvitedBy)
+	s.Equal(user.ID, *created.InvitedBy)
+
+	otherResp := s.userRequest(http.MethodDelete, "/api/v2/auth/invitations/"+created.ID, other.AccessToken)
+	defer otherResp.Body.Close()
+	s.Equal(http.StatusNotFound, otherResp.StatusCode, "users only revoke their own invitations")
+
+	listResp := s.userRequest(http.MethodGet, "/api/v2/auth/invitations", other.AccessToken)
+	defer listResp.Body.Close()
+	var invitations []dto.InvitationResponse
+	s.Require().NoError(json.NewDecoder(listResp.Body).Decode(&invitations))
+	s.Empty(invitations)
+
+	revokeResp := s.userRequest(http.MethodDelete, "/api/v2/auth/invitations/"+created.ID, user.AccessToken)
+	defer revokeResp.Body.Close()
+	s.Equal(http.StatusNoContent, revokeResp.StatusCode)
+
+	registerResp := s.postV2("/auth/register/invite/"+created.Token, "", dto.RegisterWithInvitationRequest{Password: "Password123"})
+	defer registerResp.Body.Close()
+	s.Equal(http.StatusBadRequest, registerResp.StatusCode, "revoked invitations can't be used")
+}
+
+// userRequest sends a request without body on behalf of the user of accessToken
+func (s *Suite) userRequest(method, path, accessToken string) *http.Response {
+	req, _ := http.NewRequest(method, s.BaseURL+path, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
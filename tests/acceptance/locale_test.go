@@ -0,0 +1,48 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+func (s *Suite) TestLocale_TranslatedErrorMessage() {
+	body, _ := json.Marshal(dto.LoginRequest{
+		Identifier: "nonexistent@example.com",
+		Password:   "wrongpassword",
+	})
+
+	req, _ := http.NewRequest("POST", s.BaseURL+"/api/v1/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en;q=0.8")
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal("ru", resp.Header.Get("Content-Language"))
+
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&errResp))
+	s.Equal("Unauthorized", errResp.Error)
+	s.Equal("Неверные учетные данные", errResp.Message)
+}
+
+func (s *Suite) TestLocale_DefaultsToEnglish() {
+	req, _ := http.NewRequest("GET", s.BaseURL+"/api/v1/auth/me", nil)
+	req.Header.Set("Accept-Language", "de-DE")
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal("en", resp.Header.Get("Content-Language"))
+
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&errResp))
+	s.Equal("Authorization header is required", errResp.Message)
+}
@@ -0,0 +1,97 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/domain"
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/tests/fixtures"
+)
+
+func (s *Suite) TestOrganization_MembershipLifecycle() {
+	owner := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+	member := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	resp := s.postV2("/auth/orgs", owner.AccessToken, dto.CreateOrganizationRequest{Name: "Acme"})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var org dto.OrganizationResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&org))
+	s.Equal(domain.OrgRoleOwner, org.Role)
+	membersPath := "/api/v2/auth/orgs/" + org.ID + "/members"
+
+	addResp := s.postV2("/auth/orgs/"+org.ID+"/members", owner.AccessToken, dto.AddMemberRequest{Email: member.Email, Role: domain.OrgRoleMember})
+	defer addResp.Body.Close()
+	s.Require().Equal(http.StatusCreated, addResp.StatusCode)
+	var added dto.AddMemberResponse
+	s.Require().NoError(json.NewDecoder(addResp.Body).Decode(&added))
+	s.Require().NotNil(added.Member)
+	s.Nil(added.Invitation)
+	s.Equal(member.ID, added.Member.UserID)
+
+	promoteResp := s.userJSON(http.MethodPatch, membersPath+"/"+member.ID, member.AccessToken, dto.UpdateMemberRequest{Role: domain.OrgRoleAdmin})
+	defer promoteResp.Body.Close()
+	s.Equal(http.StatusForbidden, promoteResp.StatusCode, "members can't change roles")
+
+	promoteResp = s.userJSON(http.MethodPatch, membersPath+"/"+member.ID, owner.AccessToken, dto.UpdateMemberRequest{Role: domain.OrgRoleAdmin})
+	defer promoteResp.Body.Close()
+	s.Equal(http.StatusNoContent, promoteResp.StatusCode)
+
+	leaveResp := s.userRequest(http.MethodDelete, membersPath+"/"+owner.ID, owner.AccessToken)
+	defer leaveResp.Body.Close()
+	s.Require().Equal(http.StatusConflict, leaveResp.StatusCode)
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(leaveResp.Body).Decode(&errResp))
+	s.Equal("last_owner", errResp.Code)
+
+	listResp := s.userRequest(http.MethodGet, membersPath, member.AccessToken)
+	defer listResp.Body.Close()
+	s.Require().Equal(http.StatusOK, listResp.StatusCode)
+	var members []dto.MemberResponse
+	s.Require().NoError(json.NewDecoder(listResp.Body).Decode(&members))
+	s.Require().Len(members, 2)
+	s.Equal(domain.OrgRoleAdmin, members[1].Role)
+
+	strangerResp := s.userRequest(http.MethodGet, membersPath, s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1)).AccessToken)
+	defer strangerResp.Body.Close()
+	s.Equal(http.StatusNotFound, strangerResp.StatusCode, "non-members can't see the organization")
+}
+
+func (s *Suite) TestOrganization_ScopedToken() {
+	user := s.Fixtures.NewUser(s.T(), fixtures.WithTokens(1))
+
+	s.Empty(s.introspect(user.AccessToken).OrgID, "users without organization get unscoped tokens")
+
+	resp := s.postV2("/auth/orgs", user.AccessToken, dto.CreateOrganizationRequest{Name: "Acme"})
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+	var org dto.OrganizationResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&org))
+
+	tokenResp := s.postV2("/auth/orgs/"+org.ID+"/token", user.AccessToken, nil)
+	defer tokenResp.Body.Close()
+	s.Require().Equal(http.StatusOK, tokenResp.StatusCode)
+	var token dto.OrganizationTokenResponse
+	s.Require().NoError(json.NewDecoder(tokenResp.Body).Decode(&token))
+
+	introspection := s.introspect(token.AccessToken)
+	s.True(introspection.Active)
+	s.Equal(org.ID, introspection.OrgID)
+	s.Equal(domain.OrgRoleOwner, introspection.OrgRole)
+}
+
+// userJSON sends a request with a JSON body on behalf of the user of accessToken
+func (s *Suite) userJSON(method, path, accessToken string, body interface{}) *http.Response {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, s.BaseURL+path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
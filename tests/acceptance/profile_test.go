@@ -0,0 +1,93 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+// registerUser registers a user and returns the auth response
+func (s *Suite) registerUser(email, password string) dto.AuthResponse {
+	body, _ := json.Marshal(dto.RegisterRequest{Email: email, Password: password})
+	resp, err := http.Post(s.BaseURL+"/api/v1/auth/register", "application/json", bytes.NewBuffer(body))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var authResp dto.AuthResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&authResp))
+	return authResp
+}
+
+// updateMe sends a PATCH /me request with the given raw JSON body
+func (s *Suite) updateMe(accessToken, body string) *http.Response {
+	req, _ := http.NewRequest(http.MethodPatch, s.BaseURL+"/api/v1/auth/me", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) TestUpdateMe_Success() {
+	authResp := s.registerUser("profile@example.com", "Password123")
+
+	resp := s.updateMe(authResp.AccessToken, `{
+		"first_name": " Jane ",
+		"last_name": "Doe",
+		"avatar_url": "https://example.com/avatar.png",
+		"locale": "en-US"
+	}`)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var userResp dto.UserResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&userResp))
+	s.Require().NotNil(userResp.FirstName)
+	s.Equal("Jane", *userResp.FirstName)
+	s.Require().NotNil(userResp.LastName)
+	s.Equal("Doe", *userResp.LastName)
+	s.Nil(userResp.DisplayName)
+	s.Require().NotNil(userResp.Locale)
+	s.Equal("en-US", *userResp.Locale)
+
+	// Omitted fields are kept, empty strings clear the field
+	resp = s.updateMe(authResp.AccessToken, `{"display_name": "jd", "last_name": ""}`)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	userResp = dto.UserResponse{}
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&userResp))
+	s.Require().NotNil(userResp.FirstName)
+	s.Equal("Jane", *userResp.FirstName)
+	s.Nil(userResp.LastName)
+	s.Require().NotNil(userResp.DisplayName)
+	s.Equal("jd", *userResp.DisplayName)
+}
+
+func (s *Suite) TestUpdateMe_InvalidFields() {
+	authResp := s.registerUser("profile-invalid@example.com", "Password123")
+
+	resp := s.updateMe(authResp.AccessToken, `{"avatar_url": "not a url"}`)
+	defer resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp = s.updateMe(authResp.AccessToken, `{"locale": "not_a_locale!"}`)
+	defer resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (s *Suite) TestUpdateMe_NoToken() {
+	resp := s.updateMe("", `{"first_name": "Jane"}`)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
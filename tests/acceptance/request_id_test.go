@@ -0,0 +1,32 @@
+package acceptance
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+func (s *Suite) TestRequestID_Generated() {
+	resp, err := http.Get(s.BaseURL + "/health")
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.NotEmpty(resp.Header.Get("X-Request-ID"))
+}
+
+func (s *Suite) TestRequestID_PropagatedToErrorResponse() {
+	req, _ := http.NewRequest("GET", s.BaseURL+"/api/v1/auth/me", nil)
+	req.Header.Set("X-Request-ID", "acceptance-request-id")
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal("acceptance-request-id", resp.Header.Get("X-Request-ID"))
+
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&errResp))
+	s.Equal("acceptance-request-id", errResp.RequestID)
+}
@@ -0,0 +1,88 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+func (s *Suite) registerWithUsername(email, username string) *http.Response {
+	body, _ := json.Marshal(dto.RegisterRequest{
+		Email:    email,
+		Username: &username,
+		Password: "Password123",
+	})
+	resp, err := http.Post(s.BaseURL+"/api/v1/auth/register", "application/json", bytes.NewBuffer(body))
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) login(req dto.LoginRequest) *http.Response {
+	body, _ := json.Marshal(req)
+	resp, err := http.Post(s.BaseURL+"/api/v1/auth/login", "application/json", bytes.NewBuffer(body))
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) TestUsername_RegisterAndLogin() {
+	resp := s.registerWithUsername("username@example.com", "Jane.Doe")
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	var authResp dto.AuthResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&authResp))
+	s.Require().NotNil(authResp.User.Username)
+	s.Equal("jane.doe", *authResp.User.Username)
+
+	for _, identifier := range []string{"jane.doe", "JANE.DOE", "username@example.com"} {
+		loginResp := s.login(dto.LoginRequest{Identifier: identifier, Password: "Password123"})
+		loginResp.Body.Close()
+		s.Equal(http.StatusOK, loginResp.StatusCode, "Expected login with %s to succeed", identifier)
+	}
+
+	loginResp := s.login(dto.LoginRequest{Identifier: "jane.doe", Password: "WrongPassword123"})
+	defer loginResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, loginResp.StatusCode)
+}
+
+func (s *Suite) TestUsername_Duplicate() {
+	resp := s.registerWithUsername("first@example.com", "taken")
+	resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	resp = s.registerWithUsername("second@example.com", "Taken")
+	defer resp.Body.Close()
+	s.Equal(http.StatusConflict, resp.StatusCode)
+}
+
+func (s *Suite) TestUsername_Availability() {
+	resp := s.registerWithUsername("available@example.com", "occupied")
+	resp.Body.Close()
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+
+	tests := []struct {
+		username  string
+		status    int
+		available bool
+	}{
+		{"occupied", http.StatusOK, false},
+		{"free_name", http.StatusOK, true},
+		{"no", http.StatusBadRequest, false},
+		{"user@example.com", http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		resp, err := http.Get(s.BaseURL + "/api/v1/auth/username-available?username=" + tt.username)
+		s.Require().NoError(err)
+
+		s.Equal(tt.status, resp.StatusCode, "Unexpected status for %s", tt.username)
+		if tt.status == http.StatusOK {
+			var availability dto.UsernameAvailabilityResponse
+			s.Require().NoError(json.NewDecoder(resp.Body).Decode(&availability))
+			s.Equal(tt.available, availability.Available, "Unexpected availability for %s", tt.username)
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,99 @@
+package acceptance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+)
+
+// postV2 sends a JSON POST request to API v2
+func (s *Suite) postV2(path, accessToken string, body interface{}) *http.Response {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, s.BaseURL+"/api/v2"+path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	return resp
+}
+
+func (s *Suite) TestV2_RefreshTokenInBody() {
+	resp := s.postV2("/auth/register", "", dto.RegisterRequest{Email: "v2@example.com", Password: "Password123"})
+	defer resp.Body.Close()
+
+	s.Require().Equal(http.StatusCreated, resp.StatusCode)
+	s.Empty(resp.Cookies(), "v2 must not set the refresh token cookie")
+	s.Empty(resp.Header.Get("Deprecation"))
+
+	var registered dto.TokenResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&registered))
+	s.NotEmpty(registered.AccessToken)
+	s.NotEmpty(registered.RefreshToken)
+	s.Positive(registered.RefreshTokenExpiresIn)
+
+	refreshResp := s.postV2("/auth/refresh", "", dto.RefreshRequest{RefreshToken: registered.RefreshToken})
+	defer refreshResp.Body.Close()
+
+	s.Require().Equal(http.StatusOK, refreshResp.StatusCode)
+
+	var refreshed dto.TokenResponse
+	s.Require().NoError(json.NewDecoder(refreshResp.Body).Decode(&refreshed))
+	s.NotEmpty(refreshed.RefreshToken)
+	s.NotEqual(registered.RefreshToken, refreshed.RefreshToken)
+	s.NotEmpty(refreshed.SessionID)
+	s.Equal(registered.SessionID, refreshed.SessionID, "rotation keeps the session")
+
+	expiresAt, err := time.Parse(time.RFC3339, refreshed.ExpiresAt)
+	s.Require().NoError(err)
+	refreshExpiresAt, err := time.Parse(time.RFC3339, refreshed.RefreshExpiresAt)
+	s.Require().NoError(err)
+	s.WithinDuration(time.Now().Add(time.Duration(refreshed.ExpiresIn)*time.Second), expiresAt, 5*time.Second)
+	s.WithinDuration(time.Now().Add(time.Duration(refreshed.RefreshTokenExpiresIn)*time.Second), refreshExpiresAt, 5*time.Second)
+
+	logoutResp := s.postV2("/auth/logout", refreshed.AccessToken, dto.LogoutRequest{RefreshToken: refreshed.RefreshToken})
+	defer logoutResp.Body.Close()
+	s.Equal(http.StatusOK, logoutResp.StatusCode)
+
+	reuseResp := s.postV2("/auth/refresh", "", dto.RefreshRequest{RefreshToken: refreshed.RefreshToken})
+	defer reuseResp.Body.Close()
+	s.Equal(http.StatusUnauthorized, reuseResp.StatusCode)
+}
+
+func (s *Suite) TestV2_ErrorCodes() {
+	resp := s.postV2("/auth/login", "", dto.LoginRequest{Identifier: "nobody@example.com", Password: "Password123"})
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&errResp))
+	s.Equal("invalid_credentials", errResp.Code)
+
+	validationResp := s.postV2("/auth/refresh", "", map[string]string{})
+	defer validationResp.Body.Close()
+
+	s.Equal(http.StatusBadRequest, validationResp.StatusCode)
+	s.Require().NoError(json.NewDecoder(validationResp.Body).Decode(&errResp))
+	s.Equal("validation_failed", errResp.Code)
+}
+
+func (s *Suite) TestV1_DeprecationHeaders() {
+	body, _ := json.Marshal(dto.LoginRequest{Identifier: "nobody@example.com", Password: "Password123"})
+	resp, err := http.Post(s.BaseURL+"/api/v1/auth/login", "application/json", bytes.NewBuffer(body))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal("true", resp.Header.Get("Deprecation"))
+	s.Equal(`</api/v2>; rel="successor-version"`, resp.Header.Get("Link"))
+
+	var errResp dto.ErrorResponse
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&errResp))
+	s.Empty(errResp.Code, "v1 error responses must stay unchanged")
+}
@@ -0,0 +1,52 @@
+package fixtures
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prperemyshlev/auth-service-2/internal/dto"
+	"github.com/prperemyshlev/auth-service-2/internal/testutil"
+)
+
+func TestNewUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	env := testutil.NewAuthEnv(t)
+	fx := New(Config{Repos: env.Repos, JWT: env.JWT})
+
+	user := fx.NewUser(t, WithVerifiedEmail(), WithUsername("Alice"), WithTokens(2))
+	other := fx.NewUser(t)
+	if user.Email == other.Email {
+		t.Fatalf("Expected unique emails, got %s twice", user.Email)
+	}
+
+	// Users can log in with their password and refresh their sessions
+	if _, err := env.Service.Login(ctx, &dto.LoginRequest{Identifier: "alice", Password: DefaultPassword}); err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if _, err := env.Service.RefreshToken(ctx, user.RefreshTokens[0]); err != nil {
+		t.Fatalf("Failed to refresh: %v", err)
+	}
+
+	me, err := env.Service.GetUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !me.IsEmailVerified {
+		t.Error("Expected the email to be verified")
+	}
+
+	sessions, err := env.Service.ListSessions(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 3 {
+		t.Errorf("Expected 2 fixture sessions and 1 from login, got %d", len(sessions))
+	}
+
+	claims, err := env.Service.ValidateToken(ctx, other.AccessToken)
+	if err != nil || claims.UserID != other.ID {
+		t.Errorf("Expected a valid access token, got %v", err)
+	}
+}
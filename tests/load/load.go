@@ -0,0 +1,264 @@
+// Package load generates register, login, refresh and validate traffic against
+// a running auth service at a fixed rate and reports latency percentiles.
+//
+// Rate limits of the service apply to the generated traffic, raise
+// RATE_LIMIT_REQUESTS and RATE_LIMIT_POLICIES of the target for meaningful results.
+package load
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prperemyshlev/auth-service-2/pkg/client"
+)
+
+// Scenario is a kind of request sent by the generator
+type Scenario string
+
+// Supported scenarios
+const (
+	// Register creates a new user
+	Register Scenario = "register"
+	// Login logs in one of the pre-registered users
+	Login Scenario = "login"
+	// Refresh rotates the refresh token of a pre-registered user
+	Refresh Scenario = "refresh"
+	// Validate fetches the profile with an access token, which validates it
+	Validate Scenario = "validate"
+)
+
+// Scenarios lists all scenarios in report order
+var Scenarios = []Scenario{Register, Login, Refresh, Validate}
+
+const password = "LoadTest123"
+
+// Config configures a load run
+type Config struct {
+	BaseURL string
+	// RPS is the target number of requests per second over all scenarios
+	RPS int
+	// Duration is how long traffic is generated
+	Duration time.Duration
+	// Concurrency is the maximum number of requests in flight
+	// Requests that would exceed it are dropped and counted, not queued
+	Concurrency int
+	// Users is the number of users registered before the run for login, refresh and validate
+	Users int
+	// Mix is the relative weight of each scenario
+	Mix map[Scenario]int
+	// HTTPClient is used for requests, nil uses a client with a 30s timeout
+	HTTPClient *http.Client
+}
+
+// DefaultMix is a read-heavy mix resembling production traffic
+func DefaultMix() map[Scenario]int {
+	return map[Scenario]int{Register: 1, Login: 2, Refresh: 2, Validate: 5}
+}
+
+// ParseMix parses a mix like "register=1,login=2,validate=5"
+func ParseMix(s string) (map[Scenario]int, error) {
+	mix := make(map[Scenario]int)
+	for _, part := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mix entry %q, expected scenario=weight", part)
+		}
+		scenario := Scenario(name)
+		if !validScenario(scenario) {
+			return nil, fmt.Errorf("unknown scenario %q", name)
+		}
+		w, err := strconv.Atoi(weight)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q of scenario %s", weight, name)
+		}
+		mix[scenario] = w
+	}
+	return mix, nil
+}
+
+func validScenario(s Scenario) bool {
+	for _, known := range Scenarios {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	if c.BaseURL == "" {
+		errs = append(errs, errors.New("base URL is required"))
+	}
+	if c.RPS <= 0 {
+		errs = append(errs, errors.New("RPS must be positive"))
+	}
+	if c.Duration <= 0 {
+		errs = append(errs, errors.New("duration must be positive"))
+	}
+	if c.Concurrency <= 0 {
+		errs = append(errs, errors.New("concurrency must be positive"))
+	}
+	total := 0
+	for _, w := range c.Mix {
+		total += w
+	}
+	if total == 0 {
+		errs = append(errs, errors.New("mix must contain a scenario with a positive weight"))
+	}
+	if c.Users <= 0 && total > c.Mix[Register] {
+		errs = append(errs, errors.New("login, refresh and validate need at least one user"))
+	}
+	return errors.Join(errs...)
+}
+
+// user is a pre-registered user, its tokens are rotated by Refresh
+type user struct {
+	mu     sync.Mutex
+	email  string
+	tokens *client.Tokens
+}
+
+type runner struct {
+	cfg    Config
+	client *client.Client
+	users  []*user
+	picker []Scenario
+	seq    atomic.Int64
+	prefix string
+}
+
+// Run registers the users and generates traffic until cfg.Duration elapses or ctx is canceled
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Mix == nil {
+		cfg.Mix = DefaultMix()
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	opts := []client.Option{
+		// Every request is measured once, retries would hide rejections
+		client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}),
+		client.WithUserAgent("auth-service-loadgen"),
+	}
+	if cfg.HTTPClient != nil {
+		opts = append(opts, client.WithHTTPClient(cfg.HTTPClient))
+	}
+
+	r := &runner{
+		cfg:    cfg,
+		client: client.New(cfg.BaseURL, opts...),
+		prefix: uuid.NewString()[:8],
+	}
+	for _, s := range Scenarios {
+		for range cfg.Mix[s] {
+			r.picker = append(r.picker, s)
+		}
+	}
+
+	if err := r.registerUsers(ctx); err != nil {
+		return nil, err
+	}
+
+	return r.run(ctx), nil
+}
+
+func (r *runner) registerUsers(ctx context.Context) error {
+	for range r.cfg.Users {
+		email := r.email()
+		tokens, err := r.client.Register(ctx, &client.RegisterRequest{Email: email, Password: password})
+		if err != nil {
+			if client.IsStatus(err, http.StatusTooManyRequests) {
+				return fmt.Errorf("failed to register load test users, raise the register rate limit of the service: %w", err)
+			}
+			return fmt.Errorf("failed to register load test users: %w", err)
+		}
+		r.users = append(r.users, &user{email: email, tokens: tokens})
+	}
+	return nil
+}
+
+func (r *runner) email() string {
+	return fmt.Sprintf("load-%s-%d@example.com", r.prefix, r.seq.Add(1))
+}
+
+func (r *runner) run(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Duration)
+	defer cancel()
+
+	recorder := newRecorder()
+	slots := make(chan struct{}, r.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	ticker := time.NewTicker(time.Second / time.Duration(r.cfg.RPS))
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return recorder.report(time.Since(start))
+		case <-ticker.C:
+		}
+
+		scenario := r.picker[rand.IntN(len(r.picker))]
+		select {
+		case slots <- struct{}{}:
+		default:
+			recorder.drop(scenario)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// In-flight requests are allowed to finish after the run ends
+			began := time.Now()
+			err := r.send(context.WithoutCancel(ctx), scenario)
+			recorder.record(scenario, time.Since(began), err)
+		}()
+	}
+}
+
+func (r *runner) send(ctx context.Context, scenario Scenario) error {
+	if scenario == Register {
+		_, err := r.client.Register(ctx, &client.RegisterRequest{Email: r.email(), Password: password})
+		return err
+	}
+
+	u := r.users[rand.IntN(len(r.users))]
+	switch scenario {
+	case Login:
+		_, err := r.client.Login(ctx, &client.LoginRequest{Identifier: u.email, Password: password})
+		return err
+	case Refresh:
+		// Rotation invalidates the previous token, so refreshes of one user are serialized
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		tokens, err := r.client.Refresh(ctx, u.tokens.RefreshToken)
+		if err != nil {
+			return err
+		}
+		u.tokens = tokens
+		return nil
+	default:
+		u.mu.Lock()
+		accessToken := u.tokens.AccessToken
+		u.mu.Unlock()
+		_, err := r.client.GetMe(ctx, accessToken)
+		return err
+	}
+}
@@ -0,0 +1,131 @@
+package load
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prperemyshlev/auth-service-2/internal/app"
+	"github.com/prperemyshlev/auth-service-2/internal/config"
+)
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret-key-that-is-at-least-32-characters-long")
+	t.Setenv("DEV_STORAGE", config.DevStorageMemory)
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("RATE_LIMIT_REQUESTS", "100000")
+	t.Setenv("RATE_LIMIT_POLICIES", "/api/v1/auth/refresh=100000/1m/ip")
+
+	cfg, err := config.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	infra, err := app.NewInfrastructure(context.Background(), *cfg)
+	if err != nil {
+		t.Fatalf("Failed to create infrastructure: %v", err)
+	}
+	application, err := app.NewApp(infra, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create app: %v", err)
+	}
+	t.Cleanup(func() { _ = application.Shutdown() })
+
+	server := httptest.NewServer(application.Router())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRun(t *testing.T) {
+	server := newServer(t)
+
+	report, err := Run(context.Background(), Config{
+		BaseURL:     server.URL,
+		RPS:         200,
+		Duration:    500 * time.Millisecond,
+		Concurrency: 20,
+		Users:       3,
+		Mix:         map[Scenario]int{Register: 1, Login: 1, Refresh: 1, Validate: 1},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	total := report.Total()
+	if total.Requests == 0 {
+		t.Fatal("Expected requests to be sent")
+	}
+	if total.Failed() != 0 {
+		t.Errorf("Expected no failed requests, got %v", total.Errors)
+	}
+	if p50, p99 := total.Percentile(50), total.Percentile(99); p50 <= 0 || p99 < p50 {
+		t.Errorf("Unexpected percentiles p50=%s p99=%s", p50, p99)
+	}
+
+	var out bytes.Buffer
+	if err := report.Print(&out); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "p99") || !strings.Contains(out.String(), "total") {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+}
+
+func TestRun_InvalidConfig(t *testing.T) {
+	_, err := Run(context.Background(), Config{BaseURL: "http://localhost", Mix: map[Scenario]int{Validate: 1}})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"RPS", "duration", "concurrency", "at least one user"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 50, want: 50 * time.Millisecond},
+		{p: 99, want: 99 * time.Millisecond},
+		{p: 100, want: 100 * time.Millisecond},
+		{p: 0, want: time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no latencies = %s, want 0", got)
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("register=1, validate=5")
+	if err != nil {
+		t.Fatalf("ParseMix failed: %v", err)
+	}
+	if mix[Register] != 1 || mix[Validate] != 5 || len(mix) != 2 {
+		t.Errorf("Unexpected mix: %v", mix)
+	}
+
+	for _, invalid := range []string{"register", "unknown=1", "login=-1", "login=x"} {
+		if _, err := ParseMix(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
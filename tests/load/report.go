@@ -0,0 +1,178 @@
+package load
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prperemyshlev/auth-service-2/pkg/client"
+)
+
+// Stats are the results of one scenario
+type Stats struct {
+	Scenario Scenario
+	// Requests is the number of sent requests, including failed ones
+	Requests int
+	// Errors counts failed requests by cause, e.g. "429" or "network"
+	Errors map[string]int
+	// Dropped is the number of requests not sent because Concurrency was reached
+	Dropped int
+	// Latencies of all sent requests, sorted ascending
+	Latencies []time.Duration
+}
+
+// Failed returns the number of failed requests
+func (s *Stats) Failed() int {
+	failed := 0
+	for _, n := range s.Errors {
+		failed += n
+	}
+	return failed
+}
+
+// Percentile returns the latency below which p percent of the requests completed
+func (s *Stats) Percentile(p float64) time.Duration {
+	return percentile(s.Latencies, p)
+}
+
+// percentile uses the nearest-rank method on sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+// Report is the result of a load run
+type Report struct {
+	Elapsed time.Duration
+	// Stats per scenario, only scenarios that were picked at least once
+	Stats []*Stats
+}
+
+// Total returns the stats of all scenarios together
+func (r *Report) Total() *Stats {
+	total := &Stats{Scenario: "total", Errors: make(map[string]int)}
+	for _, s := range r.Stats {
+		total.Requests += s.Requests
+		total.Dropped += s.Dropped
+		total.Latencies = append(total.Latencies, s.Latencies...)
+		for cause, n := range s.Errors {
+			total.Errors[cause] += n
+		}
+	}
+	slices.Sort(total.Latencies)
+	return total
+}
+
+// Print writes the report as a table
+func (r *Report) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "scenario\trequests\trps\tfailed\tdropped\tp50\tp90\tp95\tp99\tmax\t")
+
+	rows := append(slices.Clone(r.Stats), r.Total())
+	for _, s := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t\n",
+			s.Scenario, s.Requests, float64(s.Requests)/r.Elapsed.Seconds(), s.Failed(), s.Dropped,
+			round(s.Percentile(50)), round(s.Percentile(90)), round(s.Percentile(95)),
+			round(s.Percentile(99)), round(s.Percentile(100)))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	total := r.Total()
+	if len(total.Errors) > 0 {
+		fmt.Fprintln(w, "\nerrors:")
+		causes := make([]string, 0, len(total.Errors))
+		for cause := range total.Errors {
+			causes = append(causes, cause)
+		}
+		slices.Sort(causes)
+		for _, cause := range causes {
+			fmt.Fprintf(w, "  %s: %d\n", cause, total.Errors[cause])
+		}
+	}
+	return nil
+}
+
+func round(d time.Duration) time.Duration {
+	if d >= time.Millisecond {
+		return d.Round(100 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// recorder collects results of concurrent requests
+type recorder struct {
+	mu    sync.Mutex
+	stats map[Scenario]*Stats
+}
+
+func newRecorder() *recorder {
+	return &recorder{stats: make(map[Scenario]*Stats)}
+}
+
+func (r *recorder) get(scenario Scenario) *Stats {
+	s, ok := r.stats[scenario]
+	if !ok {
+		s = &Stats{Scenario: scenario, Errors: make(map[string]int)}
+		r.stats[scenario] = s
+	}
+	return s
+}
+
+func (r *recorder) record(scenario Scenario, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.get(scenario)
+	s.Requests++
+	s.Latencies = append(s.Latencies, latency)
+	if err != nil {
+		s.Errors[errorCause(err)]++
+	}
+}
+
+func (r *recorder) drop(scenario Scenario) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.get(scenario).Dropped++
+}
+
+func (r *recorder) report(elapsed time.Duration) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &Report{Elapsed: elapsed}
+	for _, scenario := range Scenarios {
+		s, ok := r.stats[scenario]
+		if !ok {
+			continue
+		}
+		slices.Sort(s.Latencies)
+		report.Stats = append(report.Stats, s)
+	}
+	return report
+}
+
+// errorCause groups errors by HTTP status, or by kind for transport failures
+func errorCause(err error) string {
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("%d", apiErr.StatusCode)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "network"
+}